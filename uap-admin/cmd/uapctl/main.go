@@ -0,0 +1,132 @@
+// uapctl 管理后台运维命令
+//
+//	uapctl wallet-genkey                 生成新的钱包主密钥（Hex）
+//	uapctl wallet-encrypt [-db 路径]     加密仍以明文存储的托管钱包私钥
+//	uapctl wallet-rotate  [-db 路径]     用当前主密钥重新加密旧主密钥下的数据密钥
+//	uapctl migrate        [-db 路径]     执行尚未执行的数据库迁移
+//
+// 主密钥与服务端读取相同的环境变量（UAP_WALLET_MASTER_KEY[_FILE] / UAP_WALLET_MASTER_KEY_PREVIOUS[_FILE]）
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `用法: uapctl <命令> [参数]
+
+命令:
+  wallet-genkey    生成新的钱包主密钥（Hex），用于首次部署或轮换
+  wallet-encrypt   加密仍以明文存储的托管钱包私钥（可重复执行）
+  wallet-rotate    轮换主密钥：用当前主密钥重新加密旧主密钥下的数据密钥（可重复执行）
+  migrate          执行尚未执行的数据库迁移（服务启动时也会自动执行，可重复执行）
+
+轮换步骤:
+  1. 把旧主密钥配置为 UAP_WALLET_MASTER_KEY_PREVIOUS[_FILE]，新主密钥配置为 UAP_WALLET_MASTER_KEY[_FILE]，重启服务
+  2. 使用相同的环境变量执行 uapctl wallet-rotate
+  3. 确认输出为 "全部使用当前主密钥" 后删除旧主密钥配置`)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "wallet-genkey":
+		key := make([]byte, custody.MasterKeySize)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("❌ 生成主密钥失败: %v", err)
+		}
+		fmt.Println(hex.EncodeToString(key))
+	case "wallet-encrypt":
+		db, keyring := openWithKeyring(os.Args[2:])
+		n, err := custody.EncryptPlaintext(db, keyring)
+		if err != nil {
+			log.Fatalf("❌ 加密失败（已加密 %d 个，可修复后重新执行）: %v", n, err)
+		}
+		log.Printf("✅ 已加密 %d 个托管钱包私钥（主密钥 %s）", n, keyring.PrimaryID())
+		report(db, keyring)
+	case "wallet-rotate":
+		db, keyring := openWithKeyring(os.Args[2:])
+		n, err := custody.Rewrap(db, keyring)
+		if err != nil {
+			log.Fatalf("❌ 轮换失败（已处理 %d 个，可修复后重新执行）: %v", n, err)
+		}
+		log.Printf("✅ 已重新加密 %d 个数据密钥（主密钥 %s）", n, keyring.PrimaryID())
+		report(db, keyring)
+	case "migrate":
+		db := openDB(os.Args[2:])
+		n, err := database.Migrate(db, models.All(), models.Migrations)
+		if err != nil {
+			log.Fatalf("❌ 迁移失败（已执行 %d 个，可修复后重新执行）: %v", n, err)
+		}
+		version, err := database.SchemaVersion(db)
+		if err != nil {
+			log.Fatalf("❌ 查询结构版本失败: %v", err)
+		}
+		log.Printf("✅ 已执行 %d 个迁移，当前结构版本 %d", n, version)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// openWithKeyring 解析公共参数，打开数据库并加载主密钥（不会自动生成主密钥）
+func openWithKeyring(args []string) (*gorm.DB, *custody.Keyring) {
+	keyring, err := custody.KeyringFromEnv(false)
+	if err != nil {
+		log.Fatalf("❌ 加载钱包主密钥失败: %v", err)
+	}
+	return openDB(args), keyring
+}
+
+// openDB 解析公共参数并打开已存在的数据库
+func openDB(args []string) *gorm.DB {
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dbPath := fs.String("db", "uap_admin.db", "数据库文件路径")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		log.Fatalf("❌ 数据库文件不存在: %s", *dbPath)
+	}
+	db, err := database.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("❌ 数据库连接失败: %v", err)
+	}
+	return db
+}
+
+// report 打印托管私钥按主密钥的分布
+func report(db *gorm.DB, keyring *custody.Keyring) {
+	stats, err := custody.KeyStats(db)
+	if err != nil {
+		log.Fatalf("❌ 统计失败: %v", err)
+	}
+	if len(stats) == 0 || (len(stats) == 1 && stats[keyring.PrimaryID()] > 0) {
+		log.Printf("✅ 托管钱包私钥全部使用当前主密钥 %s", keyring.PrimaryID())
+		return
+	}
+	for kid, n := range stats {
+		if kid == "" {
+			log.Printf("⚠️  明文: %d", n)
+		} else if kid != keyring.PrimaryID() {
+			log.Printf("⚠️  旧主密钥 %s: %d", kid, n)
+		} else {
+			log.Printf("   当前主密钥 %s: %d", kid, n)
+		}
+	}
+}
@@ -1,95 +1,472 @@
 package main
 
 import (
-	"encoding/pem"
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"uap-admin/pkg/api"
+	"uap-admin/pkg/apidoc"
 	"uap-admin/pkg/auth"
+	"uap-admin/pkg/billing"
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/emailcode"
 	"uap-admin/pkg/models"
-	"uap-admin/pkg/response"
+	"uap-admin/pkg/nodehealth"
+	"uap-admin/pkg/notify"
+	"uap-admin/pkg/utils"
+	"uap-admin/pkg/version"
+	"uap-admin/pkg/worker"
 
-	"github.com/gin-gonic/gin"
-	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 )
 
-// ADMIN_SECRET 管理员密钥（实际项目中应从环境变量读取）
-const ADMIN_SECRET = "uap-admin-secret-8888"
+// buildVersion 发布版本号，构建时通过 -ldflags "-X main.buildVersion=v1.2.3" 注入
+var buildVersion string
 
-func main() {
-	// 调用 auth 包的初始化逻辑（通过导入触发 init 函数）
-	_ = auth.GenerateToken // 触发包初始化
+// defaultAdminSecret 开发环境默认管理员密钥（生产环境必须通过 UAP_ADMIN_SECRET 覆盖）
+const defaultAdminSecret = "uap-admin-secret-8888"
 
-	// 初始化数据库
-	db, err := gorm.Open(sqlite.Open("uap_admin.db"), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("❌ 数据库连接失败: %v", err)
+// defaultWalletLoginDomain 未配置 UAP_WALLET_LOGIN_DOMAIN 时写入钱包签名消息的服务身份
+const defaultWalletLoginDomain = "uap-admin"
+
+// billingJobInterval 计费周期滚动任务的执行间隔
+const billingJobInterval = 10 * time.Minute
+
+// emailCodeCleanInterval 过期邮箱验证码的清理间隔（过期在读取时判断，清理只回收空间）
+const emailCodeCleanInterval = 10 * time.Minute
+
+// nodeHealthInterval 节点健康检查（拨测评分 + 心跳超时）的执行间隔
+const nodeHealthInterval = 30 * time.Second
+
+// 运维告警默认值
+const (
+	defaultAlertCooldown  = 30 * time.Minute // 同一事件（类型 + 对象）的最短告警间隔
+	defaultProbeThreshold = 20               // 一个上报周期内触发探测告警的鉴权失败次数
+	defaultOfflineAfter   = 3 * time.Minute  // 节点超过该时间未上报标记为下线（节点默认每 60 秒上报一次）
+)
+
+// shutdownTimeout 优雅退出时每个阶段（HTTP 请求 / 后台任务）的最长等待时间
+const shutdownTimeout = 15 * time.Second
+
+// 单写协程参数：排队上限 / 每个事务最多合并的写入数
+const (
+	writerQueueSize = 1024
+	writerMaxBatch  = 64
+)
+
+// loadAdminSecrets 从环境变量读取管理员密钥
+// UAP_ADMIN_SECRET: 当前密钥
+// UAP_ADMIN_SECRET_PREVIOUS: 轮换期间仍然有效的旧密钥（可选），轮换完成后删除即可
+func loadAdminSecrets() []string {
+	current := strings.TrimSpace(os.Getenv("UAP_ADMIN_SECRET"))
+	if current == "" {
+		log.Println("⚠️  未设置 UAP_ADMIN_SECRET，使用开发环境默认管理员密钥（请勿用于生产环境）")
+		current = defaultAdminSecret
 	}
 
-	// 自动迁移
-	if err := db.AutoMigrate(&models.User{}, &models.Node{}); err != nil {
-		log.Fatalf("❌ 数据库迁移失败: %v", err)
+	secrets := []string{current}
+	if previous := strings.TrimSpace(os.Getenv("UAP_ADMIN_SECRET_PREVIOUS")); previous != "" {
+		log.Println("🔑 管理员密钥轮换中：旧密钥仍然有效")
+		secrets = append(secrets, previous)
 	}
-	log.Println("✅ 数据库初始化完成")
+	return secrets
+}
+
+// loadBuildInfo 读取构建信息：版本号优先使用 -ldflags 注入的值，其次是模块版本
+// Git 提交与时间来自 Go 工具链写入的 vcs 信息（在 Git 工作区内 go build 时自动写入）
+func loadBuildInfo() api.BuildInfo {
+	info := api.BuildInfo{Version: buildVersion}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
 
-	// 初始化节点数据（如果数据库里没有节点，自动插入一条测试数据）
-	initNodeData(db)
+// loadSystemInfoPublic 从环境变量读取系统信息接口是否公开
+// UAP_SYSTEM_INFO_PUBLIC: 设为 true 后 /api/v1/system/info 无需管理员密钥（默认需要 X-Admin-Secret）
+func loadSystemInfoPublic() bool {
+	raw := strings.TrimSpace(os.Getenv("UAP_SYSTEM_INFO_PUBLIC"))
+	if raw == "" {
+		return false
+	}
+	public, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("❌ UAP_SYSTEM_INFO_PUBLIC 无效: %v", err)
+	}
+	return public
+}
 
-	// 初始化 Gin 路由
-	r := gin.Default()
+// loadVersionPolicy 从环境变量读取客户端版本策略
+// UAP_MIN_CLIENT_VERSION: 最低可用版本（默认 0.0.0，即不限制）
+// UAP_LATEST_CLIENT_VERSION: 最新版本（默认与最低版本相同）
+// UAP_CLIENT_UPGRADE_URL: 升级下载地址
+func loadVersionPolicy() api.VersionPolicy {
+	parse := func(name, fallback string) version.Semver {
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			raw = fallback
+		}
+		v, err := version.Parse(raw)
+		if err != nil {
+			log.Fatalf("❌ %s 无效: %v", name, err)
+		}
+		return v
+	}
 
-	// 健康检查路由
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, response.Success(map[string]string{
-			"status": "ok",
-		}))
-	})
+	policy := api.VersionPolicy{
+		MinClientVersion: parse("UAP_MIN_CLIENT_VERSION", "0.0.0"),
+		UpgradeURL:       strings.TrimSpace(os.Getenv("UAP_CLIENT_UPGRADE_URL")),
+	}
+	policy.LatestVersion = parse("UAP_LATEST_CLIENT_VERSION", policy.MinClientVersion.String())
+	if version.Compare(policy.LatestVersion, policy.MinClientVersion) < 0 {
+		log.Fatalf("❌ UAP_LATEST_CLIENT_VERSION (%s) 低于 UAP_MIN_CLIENT_VERSION (%s)", policy.LatestVersion, policy.MinClientVersion)
+	}
+	log.Printf("📱 客户端版本策略: 最低 %s, 最新 %s", policy.MinClientVersion, policy.LatestVersion)
+	return policy
+}
+
+// loadWalletLoginPolicy 从环境变量读取钱包登录签名策略
+// UAP_WALLET_LOGIN_DOMAIN: 服务身份（建议填写后台的公网域名），写入 v2 签名消息
+// UAP_WALLET_LOGIN_REQUIRE_V2: 设为 true 后拒绝旧版 uap-login:<timestamp> 消息
+func loadWalletLoginPolicy() api.WalletLoginPolicy {
+	policy := api.WalletLoginPolicy{Domain: strings.TrimSpace(os.Getenv("UAP_WALLET_LOGIN_DOMAIN"))}
+	if policy.Domain == "" {
+		log.Printf("⚠️  未设置 UAP_WALLET_LOGIN_DOMAIN，钱包登录使用默认服务身份 %q（请在生产环境设置为后台域名）", defaultWalletLoginDomain)
+		policy.Domain = defaultWalletLoginDomain
+	}
+	if strings.Contains(policy.Domain, "|") {
+		log.Fatalf("❌ UAP_WALLET_LOGIN_DOMAIN 不能包含 |")
+	}
 
-	// API 路由组
-	apiV1 := r.Group("/api/v1")
-	{
-		authGroup := apiV1.Group("/auth")
-		{
-			// 钱包登录/注册（公开接口，无需 JWT）
-			authGroup.POST("/wallet", api.HandleWalletLogin(db))
-			// 邮箱验证码发送（公开接口，无需 JWT）
-			authGroup.POST("/email/code", api.HandleEmailCode())
-			// 邮箱登录/注册（公开接口，无需 JWT）
-			authGroup.POST("/email/login", api.HandleEmailLogin(db))
+	if raw := strings.TrimSpace(os.Getenv("UAP_WALLET_LOGIN_REQUIRE_V2")); raw != "" {
+		requireV2, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("❌ UAP_WALLET_LOGIN_REQUIRE_V2 无效: %v", err)
 		}
+		policy.RequireV2 = requireV2
+	}
+	log.Printf("👛 钱包登录: 服务身份 %s, 接受旧版消息 %v", policy.Domain, !policy.RequireV2)
+	return policy
+}
+
+// loadEmailCodeStore 从环境变量选择邮箱验证码存储
+// UAP_EMAIL_CODE_STORE: db（默认，重启后已发送的验证码仍然有效）/ memory（重启后全部失效，仅用于开发）
+func loadEmailCodeStore(db *gorm.DB) emailcode.Store {
+	switch kind := strings.ToLower(strings.TrimSpace(os.Getenv("UAP_EMAIL_CODE_STORE"))); kind {
+	case "", "db":
+		log.Println("📧 邮箱验证码存储: 数据库")
+		return emailcode.NewDBStore(db)
+	case "memory":
+		log.Println("📧 邮箱验证码存储: 内存（重启后已发送的验证码失效）")
+		return emailcode.NewMemoryStore()
+	default:
+		log.Fatalf("❌ UAP_EMAIL_CODE_STORE 无效: %q（可选 db / memory）", kind)
+		return nil
+	}
+}
 
-		clientGroup := apiV1.Group("/client")
-		{
-			// 获取节点列表（需要 JWT 鉴权）
-			clientGroup.GET("/nodes", api.AuthMiddleware(), api.GetNodeList(db))
+// loadEmailCodeLog 从环境变量读取是否把邮箱验证码明文打印到日志
+// UAP_EMAIL_CODE_LOG: true 时打印明文（未对接邮件服务时的开发用法），默认只打印指纹
+func loadEmailCodeLog() bool {
+	raw := strings.TrimSpace(os.Getenv("UAP_EMAIL_CODE_LOG"))
+	if raw == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("❌ UAP_EMAIL_CODE_LOG 无效: %v", err)
+	}
+	if enabled {
+		log.Println("⚠️  UAP_EMAIL_CODE_LOG=true：邮箱验证码明文打印到日志（仅用于开发环境）")
+	}
+	return enabled
+}
+
+// loadEmailCodeFormat 从环境变量读取邮箱验证码格式
+// UAP_EMAIL_CODE_LENGTH: 验证码长度（6-16，默认 6）
+// UAP_EMAIL_CODE_ALPHABET: digits（默认，纯数字）/ alnum（大写字母与数字，不含易混淆字符，输入时不区分大小写）
+func loadEmailCodeFormat() emailcode.CodeFormat {
+	format := emailcode.DefaultCodeFormat
+	if raw := strings.TrimSpace(os.Getenv("UAP_EMAIL_CODE_LENGTH")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Fatalf("❌ UAP_EMAIL_CODE_LENGTH 无效: %v", err)
 		}
+		format.Length = n
+	}
+	switch kind := strings.ToLower(strings.TrimSpace(os.Getenv("UAP_EMAIL_CODE_ALPHABET"))); kind {
+	case "", "digits":
+	case "alnum":
+		format.Alphabet = emailcode.AlphabetAlnum
+	default:
+		log.Fatalf("❌ UAP_EMAIL_CODE_ALPHABET 无效: %q（可选 digits / alnum）", kind)
+	}
+	if err := format.Validate(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	log.Printf("📧 邮箱验证码格式: %d 位, 字符集 %d 个字符", format.Length, len(format.Alphabet))
+	return format
+}
+
+// alertConfig 运维告警配置
+type alertConfig struct {
+	notifiers      []notify.Notifier
+	cooldown       time.Duration
+	probeThreshold int64
+	offlineAfter   time.Duration
+}
 
-		systemGroup := apiV1.Group("/system")
-		{
-			// 获取系统公钥（公开接口，无需鉴权）
-			systemGroup.GET("/public-key", api.GetPublicKey())
+// loadAlertConfig 从环境变量读取运维告警配置
+// UAP_ALERT_WEBHOOK_URL: 通用 Webhook 地址（POST JSON 事件）
+// UAP_ALERT_TELEGRAM_BOT_TOKEN / UAP_ALERT_TELEGRAM_CHAT_ID: Telegram Bot 渠道（需同时设置）
+// UAP_ALERT_COOLDOWN: 同一事件的最短告警间隔；UAP_ALERT_PROBE_THRESHOLD: 探测告警阈值（0 关闭）
+// UAP_NODE_OFFLINE_AFTER: 节点心跳超时（不配置告警渠道时同样生效）
+func loadAlertConfig() alertConfig {
+	cfg := alertConfig{
+		cooldown:       envDuration("UAP_ALERT_COOLDOWN", defaultAlertCooldown),
+		probeThreshold: defaultProbeThreshold,
+		offlineAfter:   envDuration("UAP_NODE_OFFLINE_AFTER", defaultOfflineAfter),
+	}
+	if raw := strings.TrimSpace(os.Getenv("UAP_ALERT_PROBE_THRESHOLD")); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ UAP_ALERT_PROBE_THRESHOLD 无效: %q", raw)
 		}
+		cfg.probeThreshold = n
+	}
+
+	var channels []string
+	if url := strings.TrimSpace(os.Getenv("UAP_ALERT_WEBHOOK_URL")); url != "" {
+		cfg.notifiers = append(cfg.notifiers, &notify.Webhook{URL: url})
+		channels = append(channels, "Webhook")
+	}
+	botToken := strings.TrimSpace(os.Getenv("UAP_ALERT_TELEGRAM_BOT_TOKEN"))
+	chatID := strings.TrimSpace(os.Getenv("UAP_ALERT_TELEGRAM_CHAT_ID"))
+	if (botToken == "") != (chatID == "") {
+		log.Fatalf("❌ UAP_ALERT_TELEGRAM_BOT_TOKEN 与 UAP_ALERT_TELEGRAM_CHAT_ID 需同时设置")
+	}
+	if botToken != "" {
+		cfg.notifiers = append(cfg.notifiers, &notify.Telegram{BotToken: botToken, ChatID: chatID})
+		channels = append(channels, "Telegram")
+	}
+
+	if len(channels) == 0 {
+		log.Printf("🔕 未配置告警渠道（节点心跳超时 %v）", cfg.offlineAfter)
+	} else {
+		log.Printf("🔔 运维告警: %s, 冷却 %v, 探测阈值 %d, 节点心跳超时 %v", strings.Join(channels, " + "), cfg.cooldown, cfg.probeThreshold, cfg.offlineAfter)
+	}
+	return cfg
+}
+
+// loadScoreWeights 从环境变量 UAP_NODE_SCORE_WEIGHTS 读取节点质量评分权重
+// 格式为逗号分隔的 key=value（probe_latency / probe_success / client_latency / load），未设置的指标使用默认权重
+func loadScoreWeights() nodehealth.ScoreWeights {
+	raw := strings.TrimSpace(os.Getenv("UAP_NODE_SCORE_WEIGHTS"))
+	weights, err := nodehealth.ParseScoreWeights(raw)
+	if err != nil {
+		log.Fatalf("❌ UAP_NODE_SCORE_WEIGHTS 无效: %v", err)
 	}
+	log.Printf("📊 节点质量评分权重: 拨测延迟 %g, 拨测成功率 %g, 客户端延迟 %g, 负载 %g",
+		weights.ProbeLatency, weights.ProbeSuccess, weights.ClientLatency, weights.Load)
+	return weights
+}
 
-	// 管理员接口：节点注册（简单的管理员密钥鉴权）
-	r.POST("/api/v1/admin/node/register", api.HandleNodeRegister(db, ADMIN_SECRET))
-	// 管理员接口：节点删除（简单的管理员密钥鉴权）
-	r.DELETE("/api/v1/admin/node", api.HandleDeleteNode(db, ADMIN_SECRET))
+// envDuration 读取时长类型的环境变量（未设置时返回默认值，无效或不为正时退出）
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Fatalf("❌ %s 无效: %q（示例: 30m, 90s）", name, raw)
+	}
+	return d
+}
+
+// loadKeyConfig 从环境变量读取 JWT 签名密钥配置
+// UAP_JWT_PRIVATE_KEY: PEM 格式的私钥内容（设置后不读写任何密钥文件）
+// UAP_JWT_PRIVATE_KEY_FILE / UAP_JWT_PUBLIC_KEY_FILE: 密钥文件路径（默认 private_key.pem / public_key.pem，不存在时自动生成）
+// UAP_JWT_PUBLIC_KEY_PREVIOUS: 轮换期间仍然有效的旧公钥 PEM（可拼接多个，可选），旧 Token 全部过期后删除即可
+func loadKeyConfig() auth.KeyConfig {
+	cfg := auth.KeyConfig{
+		PrivateKeyPEM:  pemFromEnv("UAP_JWT_PRIVATE_KEY"),
+		PrivateKeyPath: strings.TrimSpace(os.Getenv("UAP_JWT_PRIVATE_KEY_FILE")),
+		PublicKeyPath:  strings.TrimSpace(os.Getenv("UAP_JWT_PUBLIC_KEY_FILE")),
+
+		PreviousPublicKeysPEM: pemFromEnv("UAP_JWT_PUBLIC_KEY_PREVIOUS"),
+	}
+	if cfg.PrivateKeyPath == "" {
+		cfg.PrivateKeyPath = "private_key.pem"
+	}
+	if cfg.PublicKeyPath == "" {
+		cfg.PublicKeyPath = "public_key.pem"
+	}
+	if cfg.PreviousPublicKeysPEM != "" {
+		log.Println("🔑 签名密钥轮换中：旧公钥签发的 Token 仍然有效")
+	}
+
+	if cfg.PrivateKeyPEM != "" {
+		log.Println("🔑 使用环境变量 UAP_JWT_PRIVATE_KEY 中的签名密钥")
+	} else {
+		log.Printf("🔑 使用签名密钥文件: %s", cfg.PrivateKeyPath)
+	}
+	return cfg
+}
+
+// pemFromEnv 读取 PEM 格式的环境变量
+// 部分部署平台不支持多行环境变量，值中没有真实换行时把字面量 \n 还原为换行
+func pemFromEnv(name string) string {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" || strings.Contains(raw, "\n") {
+		return raw
+	}
+	return strings.ReplaceAll(raw, `\n`, "\n")
+}
+
+func main() {
+	startedAt := time.Now()
 
 	// 解析命令行参数
 	var certFile string
 	var keyFile string
 	flag.StringVar(&certFile, "cert", "", "TLS 证书文件路径 (启用 HTTPS)")
 	flag.StringVar(&keyFile, "key", "", "TLS 私钥文件路径 (启用 HTTPS)")
+	apiDocs := flag.Bool("api-docs", false, "在 "+apidoc.DocsPath+" 提供 OpenAPI 文档与 Swagger UI")
+	seed := flag.Bool("seed", false, "数据库中没有节点时写入一条演示节点（仅用于开发/测试环境）")
 	flag.Parse()
 
+	// 加载签名密钥（环境变量 PEM 优先，否则读取/生成密钥文件）
+	if err := auth.Init(loadKeyConfig()); err != nil {
+		log.Fatalf("❌ 加载签名密钥失败: %v", err)
+	}
+
+	// 初始化数据库
+	db, err := database.Open("uap_admin.db")
+	if err != nil {
+		log.Fatalf("❌ 数据库连接失败: %v", err)
+	}
+
+	// 结构迁移：全新数据库直接建表，已有数据库按版本执行未执行的迁移
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		log.Fatalf("❌ 数据库迁移失败: %v", err)
+	}
+	log.Println("✅ 数据库初始化完成")
+
+	// 托管钱包主密钥（新建托管钱包的私钥加密后落库）
+	keyring, err := custody.KeyringFromEnv(true)
+	if err != nil {
+		log.Fatalf("❌ 加载钱包主密钥失败: %v", err)
+	}
+	custody.Init(keyring)
+	if n, err := custody.PlaintextCount(db); err == nil && n > 0 {
+		log.Printf("⚠️  %d 个托管钱包私钥仍为明文，请执行 uapctl wallet-encrypt 加密", n)
+	}
+
+	// 演示节点（仅在 -seed 时写入，生产环境通过 /api/v1/admin/node/register 注册真实节点）
+	if *seed {
+		seedDemoNode(db)
+	}
+
+	// 后台任务统一注册到 workers，关闭时等待全部退出后再关闭数据库
+	workers := worker.NewManager()
+
+	// 高频写入（节点上报）的单写协程
+	reportWriter := database.NewWriter(db, writerQueueSize, writerMaxBatch)
+	workers.Go("report-writer", reportWriter.Run)
+
+	// 计费周期滚动任务（每月重置已用流量并保存快照）
+	workers.Go("billing-period", func(ctx context.Context) {
+		billing.RunPeriodJob(ctx, db, billingJobInterval)
+	})
+
+	emailCodeFormat := loadEmailCodeFormat()
+	emailCodeLog := loadEmailCodeLog()
+
+	// 过期邮箱验证码清理
+	emailCodes := loadEmailCodeStore(db)
+	workers.Go("email-code-cleaner", func(ctx context.Context) {
+		emailcode.RunCleaner(ctx, emailCodes, emailCodeCleanInterval)
+	})
+	// 过期钱包登录 nonce 清理
+	workers.Go("wallet-nonce-cleaner", api.RunWalletNonceCleaner)
+	// 过期托管签名限流窗口清理
+	workers.Go("client-sign-limiter-cleaner", api.RunClientSignLimiterCleaner)
+	// 过期客户端测速上报记录清理
+	workers.Go("report-limiter-cleaner", api.RunReportLimiterCleaner)
+
+	// 运维告警（节点下线/恢复、主动探测、流量用尽）
+	alerts := loadAlertConfig()
+	if len(alerts.notifiers) > 0 {
+		dispatcher := notify.NewDispatcher(alerts.cooldown, alerts.notifiers...)
+		notify.Init(dispatcher)
+		workers.Go("alert-dispatcher", dispatcher.Run)
+	}
+	// 节点健康检查：拨测并更新质量评分；超时未上报的节点标记为下线，不再下发给客户端
+	scoreWeights := loadScoreWeights()
+	workers.Go("node-health", func(ctx context.Context) {
+		nodehealth.RunChecker(ctx, db, nodeHealthInterval, alerts.offlineAfter, scoreWeights)
+	})
+
+	adminSecrets := loadAdminSecrets()
+	build := loadBuildInfo()
+	log.Printf("🏷️  版本 %s (commit %s)", build.Version, build.Commit)
+
+	r := newRouter(routerConfig{
+		db:               db,
+		reportWriter:     reportWriter,
+		emailCodes:       emailCodes,
+		emailCodeFormat:  emailCodeFormat,
+		emailCodeLog:     emailCodeLog,
+		adminSecrets:     adminSecrets,
+		build:            build,
+		startedAt:        startedAt,
+		systemInfoPublic: loadSystemInfoPublic(),
+		versionPolicy:    loadVersionPolicy(),
+		walletPolicy:     loadWalletLoginPolicy(),
+		probeThreshold:   alerts.probeThreshold,
+		apiDocs:          *apiDocs,
+	})
+
 	// 打印启动日志
 	log.Println("[UAP-Admin] 服务启动成功，密钥对已就绪")
 
-	// 启动服务器
+	// 启动服务器（设置读写超时，防止慢速请求长期占用连接）
+	srv := &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
 	if certFile != "" && keyFile != "" {
 		// HTTPS 模式：验证证书文件是否存在
 		if _, err := os.Stat(certFile); os.IsNotExist(err) {
@@ -98,58 +475,97 @@ func main() {
 		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
 			log.Fatalf("❌ 私钥文件不存在: %s", keyFile)
 		}
+	}
 
-		log.Println("🚀 UAP Admin HTTPS 服务启动在 :443")
-		if err := r.RunTLS(":443", certFile, keyFile); err != nil {
-			log.Fatalf("服务启动失败: %v", err)
-		}
-	} else {
-		// HTTP 模式（开发模式）
-		log.Println("[UAP-Admin] 服务监听在 :8080")
-		if err := r.Run(":8080"); err != nil {
-			log.Fatalf("服务启动失败: %v", err)
+	// 收到 SIGINT / SIGTERM 后优雅退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if certFile != "" && keyFile != "" {
+			log.Println("🚀 UAP Admin HTTPS 服务启动在 :443")
+			srv.Addr = ":443"
+			serveErr <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			// HTTP 模式（开发模式）
+			log.Println("[UAP-Admin] 服务监听在 :8080")
+			srv.Addr = ":8080"
+			serveErr <- srv.ListenAndServe()
 		}
+	}()
+
+	var listenErr error
+	select {
+	case listenErr = <-serveErr:
+	case <-ctx.Done():
+		log.Println("🛑 收到退出信号，正在关闭服务...")
+	}
+
+	if err := shutdown(srv, workers, db); err != nil {
+		log.Fatalf("❌ 服务关闭异常: %v", err)
+	}
+	if listenErr != nil {
+		log.Fatalf("服务启动失败: %v", listenErr)
 	}
+	log.Println("✅ 服务已安全退出")
 }
 
-// initNodeData 初始化节点数据
-func initNodeData(db *gorm.DB) {
-	var count int64
-	db.Model(&models.Node{}).Count(&count)
+// shutdown 依次关闭：停止接收新请求并等待处理中的请求 -> 停止后台任务 -> 关闭数据库
+// 顺序不能颠倒：请求处理中可能还在向单写协程提交写入
+func shutdown(srv *http.Server, workers *worker.Manager, db *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("HTTP 服务关闭超时: %w", err)
+	}
 
-	if count == 0 {
-		// 读取 public_key.pem 文件内容
-		publicKeyPath := "public_key.pem"
-		publicKeyData, err := os.ReadFile(publicKeyPath)
-		if err != nil {
-			log.Fatalf("❌ 读取公钥文件失败: %v (请确保 public_key.pem 文件存在)", err)
-		}
+	if !workers.Shutdown(shutdownTimeout) {
+		return fmt.Errorf("后台任务 %s 内未全部退出", shutdownTimeout)
+	}
 
-		// 解析 PEM 块
-		block, _ := pem.Decode(publicKeyData)
-		if block == nil {
-			log.Fatalf("❌ 解析公钥 PEM 失败")
-		}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
 
-		// 将 PEM 块编码为字符串（包含完整的 PEM 格式）
-		publicKeyPEM := string(pem.EncodeToMemory(block))
-
-		// 创建测试节点
-		testNode := models.Node{
-			Name:      "🇺🇸 美国核心测试节点",
-			Address:   "uaptest.org:52222",
-			PublicKey: publicKeyPEM,
-			Region:    "US",
-			IsVIP:     false,
-			Status:    1, // 在线
-		}
+// seedDemoNode 数据库里没有节点时写入一条演示节点
+// UAP_SEED_NODE_PUBLIC_KEY: 演示节点公钥 PEM（默认使用本服务的签名公钥，即单机部署时节点与后台共用一对密钥）
+// UAP_SEED_NODE_ADDRESS: 演示节点地址（默认 uaptest.org:52222）
+func seedDemoNode(db *gorm.DB) {
+	var count int64
+	db.Model(&models.Node{}).Count(&count)
+	if count > 0 {
+		log.Printf("✅ 节点数据已存在（共 %d 个节点），跳过演示节点", count)
+		return
+	}
 
-		if err := db.Create(&testNode).Error; err != nil {
-			log.Fatalf("❌ 创建测试节点失败: %v", err)
-		}
+	publicKeyPEM := auth.PublicKeyPEM()
+	if raw := pemFromEnv("UAP_SEED_NODE_PUBLIC_KEY"); raw != "" {
+		publicKeyPEM = raw
+	}
+	publicKeyPEM, err := utils.NormalizePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		log.Fatalf("❌ 演示节点公钥不是有效的 Ed25519 公钥 PEM: %v", err)
+	}
 
-		log.Printf("✅ 已创建测试节点: %s", testNode.Name)
-	} else {
-		log.Printf("✅ 节点数据已存在（共 %d 个节点）", count)
+	address := strings.TrimSpace(os.Getenv("UAP_SEED_NODE_ADDRESS"))
+	if address == "" {
+		address = "uaptest.org:52222"
+	}
+
+	testNode := models.Node{
+		Name:      "🇺🇸 美国核心测试节点",
+		Address:   address,
+		PublicKey: publicKeyPEM,
+		Region:    "US",
+		IsVIP:     false,
+		Status:    1, // 在线
+	}
+	if err := db.Create(&testNode).Error; err != nil {
+		log.Fatalf("❌ 创建测试节点失败: %v", err)
 	}
+	log.Printf("✅ 已创建测试节点: %s (%s)", testNode.Name, testNode.Address)
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/utils"
+)
+
+// chdirTemp 切换到空的临时目录，测试结束时切回
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestStartupWithEnvKeys(t *testing.T) {
+	dir := chdirTemp(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := utils.EncodePrivateKeyPEM(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不支持多行环境变量的平台上以字面量 \n 传入
+	t.Setenv("UAP_JWT_PRIVATE_KEY", strings.ReplaceAll(string(privPEM), "\n", `\n`))
+
+	cfg := loadKeyConfig()
+	if strings.TrimSpace(cfg.PrivateKeyPEM) != strings.TrimSpace(string(privPEM)) {
+		t.Fatalf("环境变量中的私钥未还原换行: %q", cfg.PrivateKeyPEM)
+	}
+	if err := auth.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !auth.GetPublicKey().Equal(pub) {
+		t.Fatal("签名公钥与环境变量中的私钥不匹配")
+	}
+
+	// 不种子数据启动：没有演示节点，也不读写工作目录中的密钥文件
+	db := newTestDB(t)
+	r := newTestRouter(t, db)
+	token, err := auth.GenerateToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/client/nodes", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Code int               `json:"code"`
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != 200 || len(resp.Data) != 0 {
+		t.Fatalf("未种子数据时的节点列表: %s", w.Body.String())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("工作目录中出现了文件 %v", entries)
+	}
+}
+
+func TestSeedDemoNode(t *testing.T) {
+	db := newTestDB(t)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := utils.EncodePublicKeyPEM(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UAP_SEED_NODE_PUBLIC_KEY", strings.ReplaceAll(string(pubPEM), "\n", `\n`))
+	t.Setenv("UAP_SEED_NODE_ADDRESS", "seed.example:443")
+
+	seedDemoNode(db)
+	seedDemoNode(db) // 已有节点时跳过
+
+	var nodes []models.Node
+	if err := db.Find(&nodes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Address != "seed.example:443" {
+		t.Fatalf("演示节点 %+v", nodes)
+	}
+	want, _ := utils.NormalizePublicKeyPEM(string(pubPEM))
+	if nodes[0].PublicKey != want {
+		t.Fatalf("演示节点公钥 %q，期望来自 UAP_SEED_NODE_PUBLIC_KEY", nodes[0].PublicKey)
+	}
+}
+
+func TestLoadBuildInfo(t *testing.T) {
+	old := buildVersion
+	t.Cleanup(func() { buildVersion = old })
+
+	// -ldflags 注入的版本号优先
+	buildVersion = "v9.9.9"
+	if info := loadBuildInfo(); info.Version != "v9.9.9" {
+		t.Fatalf("注入版本后的构建信息 %+v", info)
+	}
+	// 未注入时取模块版本（go test 构建的是 "(devel)"），总不为空
+	buildVersion = ""
+	if info := loadBuildInfo(); info.Version == "" {
+		t.Fatalf("未注入版本时的构建信息 %+v", info)
+	}
+}
+
+func TestLoadSystemInfoPublic(t *testing.T) {
+	for raw, want := range map[string]bool{"": false, "true": true, "1": true, "false": false, " TRUE ": true} {
+		t.Setenv("UAP_SYSTEM_INFO_PUBLIC", raw)
+		if got := loadSystemInfoPublic(); got != want {
+			t.Errorf("UAP_SYSTEM_INFO_PUBLIC=%q 返回 %v，期望 %v", raw, got, want)
+		}
+	}
+}
+
+func TestLoadEmailCodeFormat(t *testing.T) {
+	for _, tc := range []struct {
+		length, alphabet string
+		want             emailcode.CodeFormat
+	}{
+		{"", "", emailcode.DefaultCodeFormat},
+		{"8", "alnum", emailcode.CodeFormat{Length: 8, Alphabet: emailcode.AlphabetAlnum}},
+		{" 10 ", " Digits ", emailcode.CodeFormat{Length: 10, Alphabet: emailcode.AlphabetDigits}},
+	} {
+		t.Setenv("UAP_EMAIL_CODE_LENGTH", tc.length)
+		t.Setenv("UAP_EMAIL_CODE_ALPHABET", tc.alphabet)
+		if got := loadEmailCodeFormat(); got != tc.want {
+			t.Errorf("长度 %q 字符集 %q 返回 %+v，期望 %+v", tc.length, tc.alphabet, got, tc.want)
+		}
+	}
+}
@@ -48,6 +48,10 @@ fi
 
 echo "✅ 编译成功: $APP_NAME"
 
+# 运维命令（钱包私钥加密 / 主密钥轮换）
+go build -o uapctl ./cmd/uapctl || { echo "❌ uapctl 编译失败"; exit 1; }
+echo "✅ 编译成功: uapctl"
+
 # 3. 配置 Systemd 服务
 echo ">>> 配置系统服务..."
 SERVICE_FILE="/etc/systemd/system/${SERVICE_NAME}.service"
@@ -59,7 +63,7 @@ if [ ! -f "$SERVICE_FILE" ]; then
     NEED_UPDATE=true
 else
     # 检查 WorkingDirectory 是否正确
-    if ! grep -q "WorkingDirectory=$SCRIPT_DIR" "$SERVICE_FILE"; then
+    if ! grep -q "WorkingDirectory=$SCRIPT_DIR" "$SERVICE_FILE" || ! grep -q "EnvironmentFile=-$SCRIPT_DIR/.env" "$SERVICE_FILE"; then
         echo ">>> 服务文件配置已过期，更新配置..."
         NEED_UPDATE=true
     fi
@@ -76,6 +80,8 @@ Type=simple
 User=root
 Restart=always
 WorkingDirectory=$SCRIPT_DIR
+# 管理员密钥等敏感配置 (UAP_ADMIN_SECRET / UAP_ADMIN_SECRET_PREVIOUS)
+EnvironmentFile=-$SCRIPT_DIR/.env
 ExecStart=$SCRIPT_DIR/$APP_NAME
 
 [Install]
@@ -115,6 +121,11 @@ if [ ! -f "$SCRIPT_DIR/private_key.pem" ]; then
     WARNINGS=$((WARNINGS + 1))
 fi
 
+if [ ! -f "$SCRIPT_DIR/wallet_master.key" ] && ! grep -q "^UAP_WALLET_MASTER_KEY" "$SCRIPT_DIR/.env" 2>/dev/null; then
+    echo -e "\033[33m⚠️  警告: wallet_master.key 不存在（这是新部署，钱包主密钥将自动生成，请务必备份）\033[0m"
+    WARNINGS=$((WARNINGS + 1))
+fi
+
 if [ ! -f "$SCRIPT_DIR/uap_admin.db" ]; then
     echo -e "\033[33m⚠️  警告: uap_admin.db 不存在（这是新部署，数据库将自动创建）\033[0m"
     WARNINGS=$((WARNINGS + 1))
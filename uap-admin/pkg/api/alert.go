@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+// markNodeReported 记录节点上报时间、活跃连接数与维护模式；节点此前被健康检查标记为下线时恢复为在线并返回 true
+func markNodeReported(tx *gorm.DB, nodeID uint, now time.Time, conns int, draining bool) (bool, error) {
+	result := tx.Model(&models.Node{}).
+		Where("id = ? AND status = ?", nodeID, 0).
+		Updates(map[string]interface{}{"status": 1, "last_report_at": now, "active_conns": conns, "draining": draining})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+	return false, tx.Model(&models.Node{}).Where("id = ?", nodeID).
+		Updates(map[string]interface{}{"last_report_at": now, "active_conns": conns, "draining": draining}).Error
+}
+
+// logDraining 节点进入 / 退出维护模式（由运维主动发起，只记录日志不告警）
+func logDraining(node models.Node, draining bool) {
+	if draining {
+		log.Printf("🚧 节点进入维护模式（排空中），不再下发给客户端: %s (%s)", node.Name, node.Address)
+	} else {
+		log.Printf("✅ 节点退出维护模式，恢复下发: %s (%s)", node.Name, node.Address)
+	}
+}
+
+// emitReportAlerts 根据一次已入库的节点上报发出运维告警
+// probeThreshold: 一个上报周期内的鉴权失败次数达到该值时告警（0 表示不告警）
+func emitReportAlerts(node models.Node, probes, probeThreshold int64, recovered bool, exhausted []string, now time.Time) {
+	if recovered {
+		log.Printf("🟢 节点恢复上报，已重新上线: %s (%s)", node.Name, node.Address)
+		notify.Emit(notify.Event{
+			Kind: notify.KindNodeUp, Subject: node.Address, Time: now,
+			Message: fmt.Sprintf("节点 %s (%s) 恢复上报，已重新上线", node.Name, node.Address),
+		})
+	}
+	if probeThreshold > 0 && probes >= probeThreshold {
+		log.Printf("🕵️ 节点鉴权失败次数异常: %s (%s), 本周期 %d 次", node.Name, node.Address, probes)
+		notify.Emit(notify.Event{
+			Kind: notify.KindProbeDetected, Subject: node.Address, Time: now,
+			Message: fmt.Sprintf("节点 %s (%s) 一个上报周期内 %d 次鉴权失败（阈值 %d），可能正在被主动探测", node.Name, node.Address, probes, probeThreshold),
+		})
+	}
+	for _, userUUID := range exhausted {
+		notify.Emit(notify.Event{
+			Kind: notify.KindQuotaExhausted, Subject: userUUID, Time: now,
+			Message: fmt.Sprintf("用户 %s 本计费周期流量已用尽", userUUID),
+		})
+	}
+}
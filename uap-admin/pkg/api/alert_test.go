@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/notify"
+)
+
+// withAlerts 测试期间把告警发送到 Recorder，返回停止分发并取出已发送告警的函数
+func withAlerts(t *testing.T) func() []notify.Event {
+	rec := &notify.Recorder{}
+	d := notify.NewDispatcher(time.Minute, rec)
+	notify.Init(d)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(func() {
+		stop()
+		notify.Init(nil)
+	})
+	return func() []notify.Event {
+		stop()
+		return rec.Events()
+	}
+}
+
+func TestNodeReportAlerts(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "us-1")
+	if err := db.Model(&node).Update("status", 0).Error; err != nil { // 被健康检查标记为下线
+		t.Fatal(err)
+	}
+	user := createUser(t, db, models.User{TrafficLimitBytes: 100})
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	events := withAlerts(t)
+
+	r := newRequest(t, "POST", "/", NodeReportRequest{
+		PublicKey: node.PublicKey,
+		Probes:    20,
+		Sessions:  []SessionReport{{SessionID: "s1", UserUUID: user.UUID, BytesUp: 200}},
+	})
+	r.Header.Set("X-Admin-Secret", "admin-secret")
+	if _, resp := serveRequest(t, HandleNodeReport(db, writer, []string{"admin-secret"}, 10), r, ""); resp.Code != 200 {
+		t.Fatalf("上报失败: %d %s", resp.Code, resp.Msg)
+	}
+
+	kinds := make(map[notify.Kind]string)
+	for _, e := range events() {
+		kinds[e.Kind] = e.Subject
+	}
+	want := map[notify.Kind]string{
+		notify.KindNodeUp:         node.Address,
+		notify.KindProbeDetected:  node.Address,
+		notify.KindQuotaExhausted: user.UUID,
+	}
+	for kind, subject := range want {
+		if kinds[kind] != subject {
+			t.Errorf("告警 %s 的对象 %q，期望 %q（全部告警 %v）", kind, kinds[kind], subject, kinds)
+		}
+	}
+	var got models.Node
+	db.First(&got, node.ID)
+	if got.Status != 1 {
+		t.Fatal("恢复上报的节点未重新上线")
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+
+	// 签名密钥只在内存中生成，不读写密钥文件
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	privPEM, err := utils.EncodePrivateKeyPEM(priv)
+	if err != nil {
+		panic(err)
+	}
+	if err := auth.Init(auth.KeyConfig{PrivateKeyPEM: string(privPEM)}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newNodeKeyPEM 随机生成节点公钥（PEM）
+func newNodeKeyPEM(t testing.TB) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := utils.EncodePublicKeyPEM(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// testResponse 解析后的统一响应
+type testResponse struct {
+	Code  int             `json:"code"`
+	Error string          `json:"error"`
+	Msg   string          `json:"msg"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// newTestDB 在临时目录创建已迁移到最新结构的数据库
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// serve 以 userUUID 的身份（代替 AuthMiddleware）调用 handler，body 为 nil 时不带请求体
+func serve(t testing.TB, handler gin.HandlerFunc, method, userUUID string, body interface{}) (int, testResponse) {
+	t.Helper()
+	return serveRequest(t, handler, newRequest(t, method, "/", body), userUUID)
+}
+
+// newRequest 构造 JSON 请求，body 为 nil 时不带请求体
+func newRequest(t testing.TB, method, target string, body interface{}) *http.Request {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// serveRequest 以 userUUID 的身份（为空时不设置）调用 handler 处理 req
+func serveRequest(t testing.TB, handler gin.HandlerFunc, req *http.Request, userUUID string) (int, testResponse) {
+	t.Helper()
+	r := gin.New()
+	r.Handle(req.Method, req.URL.Path, func(c *gin.Context) {
+		if userUUID != "" {
+			c.Set("user_uuid", userUUID)
+		}
+	}, handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+// decodeData 解析成功响应中的 data
+func decodeData(t testing.TB, resp testResponse, v interface{}) {
+	t.Helper()
+	if resp.Code != http.StatusOK {
+		t.Fatalf("期望成功响应，实际 %d %s: %s", resp.Code, resp.Error, resp.Msg)
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		t.Fatal(err)
+	}
+}
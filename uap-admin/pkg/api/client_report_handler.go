@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/notify"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 客户端连接上报参数
+const (
+	// clientConnectAlpha 连接成功率指数移动平均的平滑系数
+	clientConnectAlpha = 0.1
+	// clientReportInterval 每个账户两次连接上报的最短间隔
+	clientReportInterval = 1 * time.Minute
+	// clientReportNodeInterval 同一账户对同一节点计入样本的最短间隔：单个账户每小时最多影响一个节点 6 次，
+	// 无法独自把节点的评分刷低（或刷高）
+	clientReportNodeInterval = 10 * time.Minute
+)
+
+// ClientNodeReport 客户端对单个节点的一次连接结果（只含节点地址与结果，不记录客户端地址）
+type ClientNodeReport struct {
+	Address   string `json:"address" binding:"required,max=255"` // 节点地址（与节点列表中的 address 一致）
+	Success   bool   `json:"success"`                            // 是否建立了 QUIC 连接
+	LatencyMs int    `json:"latency_ms"`                         // QUIC 握手耗时（毫秒），成功时计入客户端延迟；<= 0 表示未测量
+	Reason    string `json:"reason" binding:"max=32"`            // 失败原因（可选）：tls-verify / alpn / timeout / dns / auth / other
+}
+
+// misconfiguredReasons 说明节点配置错误的失败原因（证书与节点域名不符或已过期、信任模式与客户端不一致），
+// 收到时发出运维告警；超时、鉴权被拒等可能由客户端网络或账户引起，只计入成功率
+var misconfiguredReasons = map[string]string{
+	"tls-verify": "证书校验失败",
+	"alpn":       "ALPN 协商失败（信任模式不一致）",
+}
+
+// ClientReportRequest 客户端连接上报
+type ClientReportRequest struct {
+	Nodes []ClientNodeReport `json:"nodes" binding:"required,max=20,dive"`
+}
+
+// ClientReportResponse 客户端连接上报响应
+type ClientReportResponse struct {
+	Accepted int `json:"accepted"` // 计入节点评分的样本数（不在线的节点、重复的地址、间隔不足的节点被忽略）
+}
+
+var (
+	clientReportLimiter     = newReportLimiter(clientReportInterval)
+	clientReportNodeLimiter = newReportLimiter(clientReportNodeInterval)
+)
+
+// HandleClientReport 接收客户端对节点的连接结果（需要 JWT 鉴权），聚合为节点的客户端连接成功率，参与质量评分
+// 节点从管理后台可达、从部分地区的客户端不可达时，只有客户端能发现；评分由健康检查任务下一轮重新计算
+// 防止投毒：每个账户每分钟最多上报一次，同一账户对同一节点每 10 分钟最多计入一个样本，只计入在线节点
+func HandleClientReport(writer *database.Writer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		var req ClientReportRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		now := time.Now()
+		if !clientReportLimiter.allow(userUUID, now) {
+			fail(c, response.CodeRateLimited, "连接上报过于频繁，请稍后再试")
+			return
+		}
+
+		// 同一地址只取第一条，间隔不足的节点不计入
+		seen := make(map[string]bool, len(req.Nodes))
+		reports := make([]ClientNodeReport, 0, len(req.Nodes))
+		for _, n := range req.Nodes {
+			n.Address = strings.TrimSpace(n.Address)
+			if n.Address == "" || seen[n.Address] {
+				continue
+			}
+			seen[n.Address] = true
+			if !clientReportNodeLimiter.allow(userUUID+"|"+n.Address, now) {
+				continue
+			}
+			reports = append(reports, n)
+		}
+
+		accepted := 0
+		var misconfigured []ClientNodeReport
+		err := writer.Submit(func(tx *gorm.DB) error {
+			accepted, misconfigured = 0, nil
+			for _, n := range reports {
+				rate := 0.0
+				if n.Success {
+					rate = 1
+				}
+				// 没有上报过的节点以成功率 1 为初始值：单个样本最多改变 clientConnectAlpha
+				updates := map[string]interface{}{
+					"client_connect_rate": gorm.Expr("(CASE WHEN client_connect_at IS NULL THEN 1 ELSE client_connect_rate END) * ? + ?",
+						1-clientConnectAlpha, rate*clientConnectAlpha),
+					"client_connect_at": now,
+				}
+				if n.Success && n.LatencyMs > 0 {
+					for column, value := range clientLatencyUpdate(n.LatencyMs, now) {
+						updates[column] = value
+					}
+				}
+				result := tx.Model(&models.Node{}).Where("address = ? AND status = ?", n.Address, 1).Updates(updates)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected > 0 {
+					accepted++
+					if !n.Success && misconfiguredReasons[n.Reason] != "" {
+						misconfigured = append(misconfigured, n)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ 记录客户端连接上报失败: UUID=%s, err=%v", userUUID, err)
+			fail(c, response.CodeDatabase, "记录连接结果失败")
+			return
+		}
+
+		// 节点配置错误的告警按节点去重（见 notify.Dispatcher 的冷却时间）
+		for _, n := range misconfigured {
+			log.Printf("🛠️ 客户端报告节点握手失败: %s (%s)", n.Address, n.Reason)
+			notify.Emit(notify.Event{
+				Kind: notify.KindNodeMisconfigured, Subject: n.Address, Time: now,
+				Message: fmt.Sprintf("客户端连接节点 %s 时%s，请检查节点的证书与 -trusted 配置", n.Address, misconfiguredReasons[n.Reason]),
+			})
+		}
+
+		c.JSON(200, response.Success(ClientReportResponse{Accepted: accepted}))
+	}
+}
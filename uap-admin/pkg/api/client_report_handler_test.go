@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/nodehealth"
+	"uap-admin/pkg/notify"
+	"uap-admin/pkg/response"
+)
+
+// withClientReportLimiters 测试期间使用新的连接上报限流器
+func withClientReportLimiters(t *testing.T) {
+	oldUser, oldNode := clientReportLimiter, clientReportNodeLimiter
+	clientReportLimiter = newReportLimiter(clientReportInterval)
+	clientReportNodeLimiter = newReportLimiter(clientReportNodeInterval)
+	t.Cleanup(func() { clientReportLimiter, clientReportNodeLimiter = oldUser, oldNode })
+}
+
+// clientReport 以 userUUID 的身份上报连接结果，返回响应码与计入的样本数
+func clientReport(t *testing.T, writer *database.Writer, userUUID string, nodes ...ClientNodeReport) (int, int) {
+	t.Helper()
+	_, resp := serve(t, HandleClientReport(writer), "POST", userUUID, ClientReportRequest{Nodes: nodes})
+	if resp.Code != 200 {
+		return resp.Code, 0
+	}
+	var data ClientReportResponse
+	decodeData(t, resp, &data)
+	return resp.Code, data.Accepted
+}
+
+func TestHandleClientReport(t *testing.T) {
+	db := newTestDB(t)
+	a := createNode(t, db, "a")
+	b := createNode(t, db, "b")
+	off := createNode(t, db, "off")
+	if err := db.Model(&off).Update("status", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	withClientReportLimiters(t)
+	alerts := withAlerts(t)
+
+	report := func(userUUID string, nodes ...ClientNodeReport) (int, int) {
+		return clientReport(t, writer, userUUID, nodes...)
+	}
+	loadNode := func(id uint) models.Node {
+		var node models.Node
+		if err := db.First(&node, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+
+	// 重复的地址只取第一条，不在线与未知的节点被忽略；成功时握手耗时计入客户端延迟
+	_, accepted := report("user-1",
+		ClientNodeReport{Address: a.Address, Success: false, Reason: "tls-verify"},
+		ClientNodeReport{Address: a.Address, Success: true},
+		ClientNodeReport{Address: " " + b.Address + " ", Success: true, LatencyMs: 80},
+		ClientNodeReport{Address: off.Address, Success: false},
+		ClientNodeReport{Address: "unknown:443", Success: false},
+	)
+	if accepted != 2 {
+		t.Fatalf("计入 %d 个节点，期望 2", accepted)
+	}
+	got := loadNode(a.ID)
+	if got.ClientConnectAt == nil || math.Abs(got.ClientConnectRate-(1-clientConnectAlpha)) > 1e-9 {
+		t.Fatalf("节点 a 的连接成功率 %v（上报时间 %v）", got.ClientConnectRate, got.ClientConnectAt)
+	}
+	if got = loadNode(b.ID); got.ClientConnectRate != 1 || got.ClientLatencyMs != 80 {
+		t.Fatalf("节点 b 的连接成功率 %v、客户端延迟 %v", got.ClientConnectRate, got.ClientLatencyMs)
+	}
+	if got = loadNode(off.ID); got.ClientConnectAt != nil {
+		t.Fatal("不在线的节点计入了样本")
+	}
+
+	// 同一账户频繁上报被拒绝
+	if code, _ := report("user-1", ClientNodeReport{Address: b.Address}); code != int(response.CodeRateLimited) {
+		t.Fatalf("频繁上报返回 %d", code)
+	}
+	// 限流窗口过后，同一账户对同一节点 10 分钟内仍只计入一个样本
+	clientReportLimiter = newReportLimiter(clientReportInterval)
+	if _, accepted := report("user-1", ClientNodeReport{Address: a.Address}); accepted != 0 {
+		t.Fatalf("同一账户 10 分钟内对同一节点计入了 %d 个样本", accepted)
+	}
+
+	// 证书校验失败发出节点配置错误告警，超时只计入成功率
+	report("user-2", ClientNodeReport{Address: b.Address, Success: false, Reason: "timeout"})
+	var misconfigured []string
+	for _, e := range alerts() {
+		if e.Kind == notify.KindNodeMisconfigured {
+			misconfigured = append(misconfigured, e.Subject)
+		}
+	}
+	if len(misconfigured) != 1 || misconfigured[0] != a.Address {
+		t.Fatalf("配置错误告警 %v，期望只有 %s", misconfigured, a.Address)
+	}
+}
+
+// TestClientReportLowersScore 多个账户上报连接失败后节点评分下降，在节点列表中排到健康节点之后
+func TestClientReportLowersScore(t *testing.T) {
+	db := newTestDB(t)
+	a := createNode(t, db, "a")
+	b := createNode(t, db, "b")
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	withClientReportLimiters(t)
+
+	// 健康检查从管理后台拨测两个节点都可达
+	probe := func(string) (time.Duration, error) { return 40 * time.Millisecond, nil }
+	listNodes := func() []string {
+		if err := nodehealth.UpdateScores(db, time.Now(), nodehealth.DefaultScoreWeights, probe); err != nil {
+			t.Fatal(err)
+		}
+		var nodes []models.Node
+		_, resp := serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/", nil), "")
+		decodeData(t, resp, &nodes)
+		names := make([]string, len(nodes))
+		for i, n := range nodes {
+			names[i] = n.Name
+		}
+		return names
+	}
+	if names := listNodes(); len(names) != 2 || names[0] != "a" {
+		t.Fatalf("上报前的节点列表 %v", names)
+	}
+
+	for i := 0; i < 10; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if _, accepted := clientReport(t, writer, user,
+			ClientNodeReport{Address: a.Address, Success: false, Reason: "timeout"},
+			ClientNodeReport{Address: b.Address, Success: true, LatencyMs: 40},
+		); accepted != 2 {
+			t.Fatalf("%s 的上报计入 %d 个节点", user, accepted)
+		}
+	}
+	if names := listNodes(); len(names) != 2 || names[0] != "b" || names[1] != "a" {
+		t.Fatalf("上报后的节点列表 %v，期望 b, a", names)
+	}
+	var scoreA, scoreB models.Node
+	db.First(&scoreA, a.ID)
+	db.First(&scoreB, b.ID)
+	if scoreB.Score != models.MaxNodeScore || scoreA.Score >= scoreB.Score {
+		t.Fatalf("节点 a 评分 %d、b 评分 %d", scoreA.Score, scoreB.Score)
+	}
+}
+
+// TestClientReportMisconfiguredAlert 证书校验与 ALPN 失败按节点发出配置错误告警（冷却期内去重），未知节点与其他原因不告警
+func TestClientReportMisconfiguredAlert(t *testing.T) {
+	db := newTestDB(t)
+	a := createNode(t, db, "a")
+	b := createNode(t, db, "b")
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	withClientReportLimiters(t)
+	alerts := withAlerts(t)
+
+	clientReport(t, writer, "user-1", ClientNodeReport{Address: a.Address, Reason: "tls-verify"})
+	clientReport(t, writer, "user-2", ClientNodeReport{Address: a.Address, Reason: "tls-verify"})
+	clientReport(t, writer, "user-3",
+		ClientNodeReport{Address: b.Address, Reason: "alpn"},
+		ClientNodeReport{Address: "unknown:443", Reason: "tls-verify"},
+	)
+	clientReport(t, writer, "user-4", ClientNodeReport{Address: a.Address, Reason: "auth"})
+	// 成功的上报即使带有原因也不告警
+	clientReport(t, writer, "user-5", ClientNodeReport{Address: b.Address, Success: true, Reason: "alpn"})
+
+	got := make(map[string]int)
+	for _, e := range alerts() {
+		if e.Kind == notify.KindNodeMisconfigured {
+			got[e.Subject]++
+		}
+	}
+	if len(got) != 2 || got[a.Address] != 1 || got[b.Address] != 1 {
+		t.Fatalf("配置错误告警 %v，期望节点 a、b 各一次", got)
+	}
+}
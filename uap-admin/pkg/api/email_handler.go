@@ -4,17 +4,20 @@ import (
 	"crypto/ed25519"
 	cryptorand "crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/mail"
 	"strings"
-	"sync"
 	"time"
 
 	"uap-admin/pkg/auth"
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/emailcode"
 	"uap-admin/pkg/models"
 	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -26,35 +29,8 @@ type EmailCodeRequest struct {
 	Email string `json:"email" binding:"required"`
 }
 
-// codeCacheItem 验证码缓存项
-type codeCacheItem struct {
-	Code      string
-	ExpiresAt time.Time
-}
-
-// emailCodeCache 邮箱验证码缓存（使用 sync.Map 存储）
-var emailCodeCache sync.Map
-
-// 定期清理过期验证码的 goroutine
-func init() {
-	// 初始化随机数种子
-	rand.Seed(time.Now().UnixNano())
-
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute) // 每分钟清理一次
-		defer ticker.Stop()
-		for range ticker.C {
-			now := time.Now()
-			emailCodeCache.Range(func(key, value interface{}) bool {
-				item := value.(codeCacheItem)
-				if now.After(item.ExpiresAt) {
-					emailCodeCache.Delete(key)
-				}
-				return true
-			})
-		}
-	}()
-}
+// emailCodeTTL 验证码有效期
+const emailCodeTTL = 5 * time.Minute
 
 // validateEmail 验证邮箱格式
 func validateEmail(email string) bool {
@@ -62,65 +38,62 @@ func validateEmail(email string) bool {
 	return err == nil
 }
 
-// generateCode 生成6位数随机验证码
-func generateCode() string {
-	// 生成 100000 到 999999 之间的随机数
-	code := rand.Intn(900000) + 100000
-	return fmt.Sprintf("%06d", code)
-}
-
-// HandleEmailCode 处理邮箱验证码发送请求
-func HandleEmailCode() gin.HandlerFunc {
+// HandleEmailCode 处理邮箱验证码发送请求（验证码格式见 emailcode.CodeFormat）
+// logCode 为 true 时把验证码明文打印到日志（未对接邮件服务时的开发用法），否则日志中只有指纹
+func HandleEmailCode(codes emailcode.Store, format emailcode.CodeFormat, logCode bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req EmailCodeRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, response.Error(400, fmt.Sprintf("参数错误: %v", err)))
+		if !bindJSON(c, &req) {
 			return
 		}
 
 		// 校验邮箱格式
 		if !validateEmail(req.Email) {
-			c.JSON(400, response.Error(400, "邮箱格式错误"))
+			fail(c, response.CodeInvalidEmail, "邮箱格式错误")
 			return
 		}
 
-		// 生成6位数随机验证码
-		code := generateCode()
+		// 生成随机验证码（crypto/rand）
+		code, err := format.Generate()
+		if err != nil {
+			log.Printf("❌ %v", err)
+			fail(c, response.CodeInternal, "验证码生成失败")
+			return
+		}
 
 		// 打印验证码到控制台（临时方案，不真发邮件）
-		log.Printf("====== 验证码: %s ======", code)
-		log.Printf("邮箱: %s", req.Email)
+		if logCode {
+			log.Printf("====== 验证码: %s ======", code)
+			log.Printf("邮箱: %s", req.Email)
+		} else {
+			log.Printf("📧 已生成验证码: 邮箱=%s, 验证码=%s", req.Email, utils.Fingerprint(code))
+		}
 
-		// 将验证码存入内存缓存，设置5分钟过期
-		item := codeCacheItem{
-			Code:      code,
-			ExpiresAt: time.Now().Add(5 * time.Minute),
+		// 保存验证码哈希，设置5分钟过期（覆盖该邮箱之前的验证码）
+		if err := codes.Save(req.Email, code, time.Now().Add(emailCodeTTL)); err != nil {
+			log.Printf("❌ 保存验证码失败: %v", err)
+			fail(c, response.CodeDatabase, "验证码保存失败")
+			return
 		}
-		emailCodeCache.Store(req.Email, item)
 
 		// 返回成功响应
-		c.JSON(200, response.Success(map[string]string{
-			"msg": "验证码已发送",
-		}))
+		c.JSON(200, response.Success(MessageResponse{Msg: "验证码已发送"}))
 	}
 }
 
-// GetEmailCode 获取邮箱对应的验证码（用于后续验证）
-func GetEmailCode(email string) (string, bool) {
-	value, ok := emailCodeCache.Load(email)
-	if !ok {
-		return "", false
-	}
-
-	item := value.(codeCacheItem)
-	
-	// 检查是否过期
-	if time.Now().After(item.ExpiresAt) {
-		emailCodeCache.Delete(email)
-		return "", false
+// consumeEmailCode 校验并消费邮箱验证码
+// 校验通过返回 (0, "") 并删除验证码，否则返回错误码和错误信息
+func consumeEmailCode(codes emailcode.Store, email, code string) (response.Code, string) {
+	err := codes.Consume(email, emailcode.NormalizeCode(code), time.Now())
+	switch {
+	case err == nil:
+		return 0, ""
+	case errors.Is(err, emailcode.ErrNotFound), errors.Is(err, emailcode.ErrMismatch), errors.Is(err, emailcode.ErrTooManyAttempts):
+		return response.CodeVerificationFailed, err.Error()
+	default:
+		log.Printf("❌ 校验验证码失败: %v", err)
+		return response.CodeDatabase, "数据库错误"
 	}
-
-	return item.Code, true
 }
 
 // EmailLoginRequest 邮箱登录请求
@@ -136,35 +109,25 @@ type EmailLoginResponse struct {
 }
 
 // HandleEmailLogin 处理邮箱登录/注册
-func HandleEmailLogin(db *gorm.DB) gin.HandlerFunc {
+func HandleEmailLogin(db *gorm.DB, codes emailcode.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req EmailLoginRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, response.Error(400, fmt.Sprintf("参数错误: %v", err)))
+		if !bindJSON(c, &req) {
 			return
 		}
 
 		// 校验邮箱格式
 		if !validateEmail(req.Email) {
-			c.JSON(400, response.Error(400, "邮箱格式错误"))
-			return
-		}
-
-		// 校验验证码
-		correctCode, ok := GetEmailCode(req.Email)
-		if !ok {
-			c.JSON(401, response.Error(401, "验证码不存在或已过期"))
+			fail(c, response.CodeInvalidEmail, "邮箱格式错误")
 			return
 		}
 
-		if req.Code != correctCode {
-			c.JSON(401, response.Error(401, "验证码错误"))
+		// 校验验证码（校验成功后验证码即被删除，防止重复使用）
+		if code, msg := consumeEmailCode(codes, req.Email, req.Code); code != 0 {
+			fail(c, code, msg)
 			return
 		}
 
-		// 验证码验证成功后，删除验证码（防止重复使用）
-		emailCodeCache.Delete(req.Email)
-
 		// 查询数据库中是否存在该邮箱
 		var user models.User
 		err := db.Where("email = ?", req.Email).First(&user).Error
@@ -175,13 +138,13 @@ func HandleEmailLogin(db *gorm.DB) gin.HandlerFunc {
 				user, err = createUserWithEmail(db, req.Email)
 				if err != nil {
 					log.Printf("❌ 创建用户失败: %v", err)
-					c.JSON(500, response.Error(500, "用户注册失败"))
+					fail(c, response.CodeDatabase, "用户注册失败")
 					return
 				}
 				log.Printf("✅ 新用户注册: UUID=%s, Email=%s", user.UUID, req.Email)
 			} else {
 				log.Printf("❌ 数据库查询错误: %v", err)
-				c.JSON(500, response.Error(500, "数据库错误"))
+				fail(c, response.CodeDatabase, "数据库错误")
 				return
 			}
 		} else {
@@ -193,7 +156,7 @@ func HandleEmailLogin(db *gorm.DB) gin.HandlerFunc {
 		token, err := auth.GenerateToken(user.UUID)
 		if err != nil {
 			log.Printf("❌ JWT 生成失败: %v", err)
-			c.JSON(500, response.Error(500, "Token 生成失败"))
+			fail(c, response.CodeInternal, "Token 生成失败")
 			return
 		}
 
@@ -215,23 +178,28 @@ func createUserWithEmail(db *gorm.DB, email string) (models.User, error) {
 
 	// 转换为 Hex 编码
 	publicKeyHex := hex.EncodeToString(pub)
-	privateKeyHex := hex.EncodeToString(priv)
 
 	// 生成 UUID
 	newUUID := uuid.New().String()
 
+	// 托管私钥加密后再落库（信封加密，绑定用户 UUID）
+	sealedPrivKey, err := custody.SealPrivateKey(newUUID, priv)
+	if err != nil {
+		return models.User{}, fmt.Errorf("加密钱包私钥失败: %w", err)
+	}
+
 	// 创建用户记录
 	user := models.User{
 		UUID:          newUUID,
 		Email:         &email, // 使用指针类型
 		WalletPubKey:  publicKeyHex,
-		WalletPrivKey: privateKeyHex,
+		WalletPrivKey: sealedPrivKey,
 		GoogleID:      nil, // 邮箱注册不设置 Google ID
 	}
 
 	// 使用事务处理并发冲突
 	var result models.User
-	err = db.Transaction(func(tx *gorm.DB) error {
+	err = database.Transaction(db, func(tx *gorm.DB) error {
 		// 再次检查邮箱是否已存在（防止并发注册）
 		var existingUser models.User
 		if err := tx.Where("email = ?", email).First(&existingUser).Error; err == nil {
@@ -273,4 +241,3 @@ func isUniqueConstraintError(err error) bool {
 	errStr := strings.ToLower(err.Error())
 	return strings.Contains(errStr, "unique constraint") || strings.Contains(errStr, "duplicate")
 }
-
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+)
+
+// recordingStore 记录最近保存的验证码明文的 emailcode.Store
+type recordingStore struct {
+	emailcode.Store
+	last string
+}
+
+func (s *recordingStore) Save(email, code string, expiresAt time.Time) error {
+	s.last = code
+	return s.Store.Save(email, code, expiresAt)
+}
+
+func TestEmailCodeFormat(t *testing.T) {
+	db := newTestDB(t)
+	email := "a@example.com"
+	user := createUser(t, db, models.User{Email: &email})
+	codes := &recordingStore{Store: emailcode.NewMemoryStore()}
+	format := emailcode.CodeFormat{Length: 8, Alphabet: emailcode.AlphabetAlnum}
+	send := HandleEmailCode(codes, format, false)
+	login := HandleEmailLogin(db, codes)
+
+	if _, resp := serve(t, send, http.MethodPost, "", EmailCodeRequest{Email: "bad"}); resp.Code != int(response.CodeInvalidEmail) {
+		t.Fatalf("邮箱格式错误时返回 %+v", resp)
+	}
+
+	if _, resp := serve(t, send, http.MethodPost, "", EmailCodeRequest{Email: "a@example.com"}); resp.Code != http.StatusOK {
+		t.Fatalf("发送验证码 %+v", resp)
+	}
+	if len(codes.last) != 8 || strings.Trim(codes.last, emailcode.AlphabetAlnum) != "" {
+		t.Fatalf("验证码 %q 不符合配置的格式", codes.last)
+	}
+
+	// 字母验证码输入时不区分大小写
+	_, resp := serve(t, login, http.MethodPost, "", EmailLoginRequest{Email: "a@example.com", Code: " " + strings.ToLower(codes.last) + " "})
+	var out EmailLoginResponse
+	decodeData(t, resp, &out)
+	if out.Token == "" || out.UUID != user.UUID {
+		t.Fatalf("登录响应 %+v", out)
+	}
+	// 验证码一次性
+	if _, resp := serve(t, login, http.MethodPost, "", EmailLoginRequest{Email: "a@example.com", Code: codes.last}); resp.Code != int(response.CodeVerificationFailed) {
+		t.Fatalf("重复使用验证码返回 %+v", resp)
+	}
+}
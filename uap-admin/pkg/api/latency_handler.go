@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 客户端测速上报参数
+const (
+	// clientLatencyCapMs 上报延迟的上限（客户端测速超时），测速失败按该值计入
+	clientLatencyCapMs = 2000
+	// clientLatencyAlpha 指数移动平均的平滑系数：单个客户端的上报只能小幅影响节点的聚合延迟
+	clientLatencyAlpha = 0.1
+	// nodeLatencyInterval 每个账户两次上报的最短间隔（超出的上报被拒绝，防止单个账户刷低/刷高节点评分）
+	nodeLatencyInterval = 1 * time.Minute
+)
+
+// NodeLatency 客户端对单个节点的测速结果
+type NodeLatency struct {
+	Address   string `json:"address" binding:"required"` // 节点地址（与节点列表中的 address 一致）
+	LatencyMs int    `json:"latency_ms"`                 // TCP 测速延迟（毫秒），-1 表示超时/失败
+}
+
+// NodeLatencyRequest 客户端测速上报
+type NodeLatencyRequest struct {
+	Nodes []NodeLatency `json:"nodes" binding:"required,max=200,dive"`
+}
+
+// NodeLatencyResponse 客户端测速上报响应
+type NodeLatencyResponse struct {
+	Accepted int `json:"accepted"` // 计入聚合延迟的节点数（未知地址被忽略）
+}
+
+// nodeLatencyLimiter 每个账户每 nodeLatencyInterval 最多上报一次测速结果
+var nodeLatencyLimiter = newReportLimiter(nodeLatencyInterval)
+
+// reportLimiter 客户端上报的频率限制：同一个 key 两次上报的间隔不小于 interval
+type reportLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	last     map[string]time.Time // key -> 上次上报时间
+}
+
+// reportLimiters 所有上报频率限制，由 RunReportLimiterCleaner 统一清理
+var reportLimiters []*reportLimiter
+
+func newReportLimiter(interval time.Duration) *reportLimiter {
+	l := &reportLimiter{interval: interval, last: make(map[string]time.Time)}
+	reportLimiters = append(reportLimiters, l)
+	return l
+}
+
+// allow 距离该 key 上次上报已超过 interval 时记录本次上报并返回 true
+func (l *reportLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[key]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+	l.last[key] = now
+	return true
+}
+
+// clean 清理已过期的记录
+func (l *reportLimiter) clean(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, last := range l.last {
+		if now.Sub(last) >= l.interval {
+			delete(l.last, key)
+		}
+	}
+}
+
+// RunReportLimiterCleaner 定期清理过期的上报记录，直到 ctx 取消
+func RunReportLimiterCleaner(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, l := range reportLimiters {
+				l.clean(now)
+			}
+		}
+	}
+}
+
+// clientLatencyUpdate 把一次客户端延迟样本计入节点的聚合延迟（指数移动平均，首个样本直接作为初始值）
+func clientLatencyUpdate(ms int, now time.Time) map[string]interface{} {
+	if ms < 0 || ms > clientLatencyCapMs {
+		ms = clientLatencyCapMs
+	}
+	return map[string]interface{}{
+		"client_latency_ms": gorm.Expr("CASE WHEN client_report_at IS NULL THEN ? ELSE client_latency_ms * ? + ? END",
+			ms, 1-clientLatencyAlpha, float64(ms)*clientLatencyAlpha),
+		"client_report_at": now,
+	}
+}
+
+// HandleNodeLatency 接收客户端的节点测速结果（需要 JWT 鉴权），聚合为节点的客户端延迟，参与质量评分
+// 与节点上报一样经由单写协程提交；评分由健康检查任务下一轮重新计算
+func HandleNodeLatency(writer *database.Writer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		var req NodeLatencyRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		now := time.Now()
+		if !nodeLatencyLimiter.allow(userUUID, now) {
+			fail(c, response.CodeRateLimited, "测速上报过于频繁，请稍后再试")
+			return
+		}
+
+		accepted := 0
+		err := writer.Submit(func(tx *gorm.DB) error {
+			accepted = 0
+			for _, n := range req.Nodes {
+				result := tx.Model(&models.Node{}).Where("address = ?", n.Address).Updates(clientLatencyUpdate(n.LatencyMs, now))
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected > 0 {
+					accepted++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ 记录客户端测速失败: UUID=%s, err=%v", userUUID, err)
+			fail(c, response.CodeDatabase, "记录测速结果失败")
+			return
+		}
+
+		c.JSON(200, response.Success(NodeLatencyResponse{Accepted: accepted}))
+	}
+}
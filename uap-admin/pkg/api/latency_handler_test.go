@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+)
+
+func TestHandleNodeLatency(t *testing.T) {
+	db := newTestDB(t)
+	a := createNode(t, db, "a")
+	b := createNode(t, db, "b")
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	oldLimiter := nodeLatencyLimiter
+	nodeLatencyLimiter = &reportLimiter{interval: time.Minute, last: make(map[string]time.Time)}
+	t.Cleanup(func() { nodeLatencyLimiter = oldLimiter })
+
+	report := func(userUUID string, nodes ...NodeLatency) (int, int) {
+		_, resp := serve(t, HandleNodeLatency(writer), "POST", userUUID, NodeLatencyRequest{Nodes: nodes})
+		if resp.Code != 200 {
+			return resp.Code, 0
+		}
+		var data NodeLatencyResponse
+		decodeData(t, resp, &data)
+		return resp.Code, data.Accepted
+	}
+	latencyOf := func(id uint) float64 {
+		var node models.Node
+		if err := db.First(&node, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return node.ClientLatencyMs
+	}
+
+	// 首个样本直接作为初始值；未知地址被忽略
+	_, accepted := report("user-1",
+		NodeLatency{Address: a.Address, LatencyMs: 100},
+		NodeLatency{Address: b.Address, LatencyMs: -1},
+		NodeLatency{Address: "unknown:443", LatencyMs: 10},
+	)
+	if accepted != 2 {
+		t.Fatalf("计入 %d 个节点，期望 2", accepted)
+	}
+	if got := latencyOf(a.ID); got != 100 {
+		t.Fatalf("节点 a 的客户端延迟 %v", got)
+	}
+	// 测速失败按上限计入
+	if got := latencyOf(b.ID); got != clientLatencyCapMs {
+		t.Fatalf("节点 b 的客户端延迟 %v，期望 %d", got, clientLatencyCapMs)
+	}
+
+	// 同一账户频繁上报被拒绝，不能刷低/刷高节点评分
+	if code, _ := report("user-1", NodeLatency{Address: a.Address, LatencyMs: 0}); code != int(response.CodeRateLimited) {
+		t.Fatalf("频繁上报返回 %d", code)
+	}
+
+	// 其他账户的上报按指数移动平均小幅影响聚合延迟
+	report("user-2", NodeLatency{Address: a.Address, LatencyMs: 0})
+	if got, want := latencyOf(a.ID), 100*(1-clientLatencyAlpha); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("聚合延迟 %v，期望 %v", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LinkEmailRequest 绑定邮箱请求
+type LinkEmailRequest struct {
+	Email string `json:"email" binding:"required"`
+	Code  string `json:"code" binding:"required"` // 通过 /auth/email/code 获取的新验证码
+}
+
+// LinkWalletRequest 绑定钱包请求
+type LinkWalletRequest struct {
+	PublicKey        string `json:"public_key" binding:"required"`                      // Hex 编码的公钥
+	Signature        string `json:"signature" binding:"required"`                       // Hex 编码的签名，消息格式: uap-link|v2|<domain>|<uuid>|<timestamp>|<nonce>
+	Timestamp        int64  `json:"timestamp" binding:"required"`                       // Unix 时间戳（秒）
+	Nonce            string `json:"nonce" binding:"required,hexadecimal,min=16,max=64"` // 客户端生成的随机 Hex 串
+	ReplaceCustodial bool   `json:"replace_custodial"`                                  // 确认替换托管钱包（托管私钥将被永久删除）
+}
+
+// LinkEmailResponse 绑定邮箱响应
+type LinkEmailResponse struct {
+	UUID  string `json:"uuid"`
+	Email string `json:"email"`
+}
+
+// LinkWalletResponse 绑定钱包响应
+type LinkWalletResponse struct {
+	UUID         string `json:"uuid"`
+	WalletPubKey string `json:"wallet_pub_key"`
+}
+
+// errLinkConflict 目标邮箱/钱包已属于其他账户（合并账户暂不支持）
+var errLinkConflict = errors.New("already owned by another account")
+
+// errAlreadyLinked 当前账户已经绑定过同类凭证
+var errAlreadyLinked = errors.New("already linked")
+
+// errCustodialWallet 当前账户持有托管钱包，请求未确认替换
+var errCustodialWallet = errors.New("custodial wallet not confirmed for replacement")
+
+// walletLinkMessage 构造绑定钱包的签名消息（与登录消息 v2 相同的域隔离格式，另外绑定当前账户 UUID）
+func walletLinkMessage(domain, userUUID string, timestamp int64, nonce string) string {
+	return fmt.Sprintf("uap-link|v2|%s|%s|%d|%s", domain, userUUID, timestamp, nonce)
+}
+
+// HandleLinkEmail 为当前账户绑定邮箱（需要 JWT 鉴权 + 新鲜的邮箱验证码）
+func HandleLinkEmail(db *gorm.DB, codes emailcode.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LinkEmailRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		// 校验邮箱格式
+		if !validateEmail(req.Email) {
+			fail(c, response.CodeInvalidEmail, "邮箱格式错误")
+			return
+		}
+
+		// 校验验证码
+		if code, msg := consumeEmailCode(codes, req.Email, req.Code); code != 0 {
+			fail(c, code, msg)
+			return
+		}
+
+		userUUID := c.GetString("user_uuid")
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			var user models.User
+			if err := tx.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+				return err
+			}
+			if user.Email != nil {
+				if *user.Email == req.Email {
+					return nil // 重复绑定同一邮箱，视为成功
+				}
+				return errAlreadyLinked
+			}
+
+			// 检查邮箱是否已被其他账户占用
+			var owner models.User
+			if err := tx.Where("email = ?", req.Email).First(&owner).Error; err == nil {
+				return errLinkConflict
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if err := tx.Model(&user).Update("email", req.Email).Error; err != nil {
+				if isUniqueConstraintError(err) {
+					return errLinkConflict
+				}
+				return err
+			}
+			return nil
+		})
+
+		if !writeLinkError(c, err, "邮箱") {
+			return
+		}
+
+		log.Printf("✅ 账户绑定邮箱: UUID=%s, Email=%s", userUUID, req.Email)
+		c.JSON(200, response.Success(LinkEmailResponse{
+			UUID:  userUUID,
+			Email: req.Email,
+		}))
+	}
+}
+
+// HandleLinkWallet 为当前账户绑定自托管钱包（需要 JWT 鉴权 + 钱包签名）
+// 邮箱用户原有的托管钱包只有在请求确认 replace_custodial 时才会被替换，托管私钥随之删除且无法恢复
+func HandleLinkWallet(db *gorm.DB, policy WalletLoginPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LinkWalletRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		// 防重放攻击：检查时间戳
+		if ok, timeDiff := checkTimestamp(req.Timestamp); !ok {
+			fail(c, response.CodeRequestExpired, fmt.Sprintf("请求已过期（时间差 %d 秒，最大允许 300 秒）", timeDiff))
+			return
+		}
+
+		// 签名消息带服务身份并绑定当前账户 UUID，防止签名被挪用到其他服务或其他账户
+		userUUID := c.GetString("user_uuid")
+		message := walletLinkMessage(policy.Domain, userUUID, req.Timestamp, req.Nonce)
+		if code, msg := verifyWalletSignature(req.PublicKey, req.Signature, []byte(message)); code != 0 {
+			fail(c, code, msg)
+			return
+		}
+		if _, used := walletNonceCache.LoadOrStore("link|"+req.PublicKey+"|"+req.Nonce, time.Now().Add(walletNonceTTL)); used {
+			fail(c, response.CodeNonceReused, "nonce 已使用，请重新签名")
+			return
+		}
+
+		var replacedCustodial string
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			replacedCustodial = ""
+			var user models.User
+			if err := tx.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+				return err
+			}
+			if user.WalletPubKey == req.PublicKey {
+				return nil // 重复绑定同一钱包，视为成功
+			}
+			// 已经绑定了自托管钱包（没有托管私钥）
+			if user.WalletPubKey != "" && user.WalletPrivKey == "" {
+				return errAlreadyLinked
+			}
+			// 托管钱包的私钥替换后无法恢复，必须由客户端明确确认
+			if user.WalletPrivKey != "" && !req.ReplaceCustodial {
+				return errCustodialWallet
+			}
+
+			// 检查钱包是否已被其他账户占用
+			var owner models.User
+			if err := tx.Where("wallet_pub_key = ?", req.PublicKey).First(&owner).Error; err == nil {
+				return errLinkConflict
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"wallet_pub_key":  req.PublicKey,
+				"wallet_priv_key": "",
+			}).Error; err != nil {
+				if isUniqueConstraintError(err) {
+					return errLinkConflict
+				}
+				return err
+			}
+			if user.WalletPrivKey != "" {
+				replacedCustodial = user.WalletPubKey
+			}
+			return nil
+		})
+
+		if !writeLinkError(c, err, "钱包") {
+			return
+		}
+
+		if replacedCustodial != "" {
+			log.Printf("⚠️ 托管钱包已被替换，托管私钥已删除: UUID=%s, 原公钥=%s", userUUID, utils.Fingerprint(replacedCustodial))
+		}
+
+		log.Printf("✅ 账户绑定钱包: UUID=%s, PublicKey=%s", userUUID, utils.Fingerprint(req.PublicKey))
+		c.JSON(200, response.Success(LinkWalletResponse{
+			UUID:         userUUID,
+			WalletPubKey: req.PublicKey,
+		}))
+	}
+}
+
+// writeLinkError 将绑定过程中的错误写入响应
+// 没有错误时返回 true，调用方继续写成功响应
+func writeLinkError(c *gin.Context, err error, kind string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errLinkConflict):
+		fail(c, response.CodeIdentityInUse, fmt.Sprintf("该%s已属于其他账户，暂不支持合并账户", kind))
+	case errors.Is(err, errAlreadyLinked):
+		fail(c, response.CodeAlreadyLinked, fmt.Sprintf("当前账户已绑定其他%s", kind))
+	case errors.Is(err, errCustodialWallet):
+		fail(c, response.CodeCustodialWallet, "当前账户持有托管钱包，替换后托管私钥将被永久删除，确认后请带 replace_custodial=true 重新提交")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		fail(c, response.CodeUserNotFound, "用户不存在")
+	default:
+		log.Printf("❌ 绑定%s失败: %v", kind, err)
+		fail(c, response.CodeDatabase, "数据库错误")
+	}
+	return false
+}
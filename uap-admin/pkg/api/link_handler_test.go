@@ -0,0 +1,252 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var testLinkPolicy = WalletLoginPolicy{Domain: "uap-test"}
+
+// createUser 创建测试用户
+func createUser(t testing.TB, db *gorm.DB, user models.User) models.User {
+	t.Helper()
+	if user.UUID == "" {
+		user.UUID = uuid.New().String()
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// loadUser 重新读取用户
+func loadUser(t testing.TB, db *gorm.DB, userUUID string) models.User {
+	t.Helper()
+	var user models.User
+	if err := db.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newNonce 随机 nonce
+func newNonce(t testing.TB) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// linkWalletRequest 用新钱包对 userUUID 签名的绑定请求
+func linkWalletRequest(t testing.TB, userUUID string) (LinkWalletRequest, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signLinkWallet(priv, pub, userUUID, newNonce(t)), priv
+}
+
+// signLinkWallet 按 v2 格式签名绑定请求
+func signLinkWallet(priv ed25519.PrivateKey, pub ed25519.PublicKey, userUUID, nonce string) LinkWalletRequest {
+	ts := time.Now().Unix()
+	message := walletLinkMessage(testLinkPolicy.Domain, userUUID, ts, nonce)
+	return LinkWalletRequest{
+		PublicKey: hex.EncodeToString(pub),
+		Signature: hex.EncodeToString(ed25519.Sign(priv, []byte(message))),
+		Timestamp: ts,
+		Nonce:     nonce,
+	}
+}
+
+func TestLinkWalletMessageFormat(t *testing.T) {
+	got := walletLinkMessage("uap-admin", "u-1", 1700000000, "00ff")
+	if want := "uap-link|v2|uap-admin|u-1|1700000000|00ff"; got != want {
+		t.Fatalf("签名消息 %q，期望 %q", got, want)
+	}
+}
+
+func TestLinkWallet(t *testing.T) {
+	db := newTestDB(t)
+	email := "a@uap.test"
+	user := createUser(t, db, models.User{Email: &email})
+
+	req, priv := linkWalletRequest(t, user.UUID)
+	status, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req)
+	if status != 200 {
+		t.Fatalf("绑定钱包失败: %d %s", resp.Code, resp.Msg)
+	}
+	var linked LinkWalletResponse
+	decodeData(t, resp, &linked)
+	if linked.UUID != user.UUID || linked.WalletPubKey != req.PublicKey {
+		t.Fatalf("响应 %+v", linked)
+	}
+	if got := loadUser(t, db, user.UUID); got.WalletPubKey != req.PublicKey {
+		t.Fatalf("钱包公钥 %q，期望 %q", got.WalletPubKey, req.PublicKey)
+	}
+
+	// 重复绑定同一钱包（新的签名）视为成功
+	req = signLinkWallet(priv, priv.Public().(ed25519.PublicKey), user.UUID, newNonce(t))
+	if status, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); status != 200 {
+		t.Fatalf("重复绑定同一钱包失败: %d %s", resp.Code, resp.Msg)
+	}
+}
+
+func TestLinkWalletRejectsLegacyMessage(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{})
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	ts := time.Now().Unix()
+	legacy := fmt.Sprintf("uap-link:%s:%d", user.UUID, ts)
+	req := LinkWalletRequest{
+		PublicKey: hex.EncodeToString(pub),
+		Signature: hex.EncodeToString(ed25519.Sign(priv, []byte(legacy))),
+		Timestamp: ts,
+		Nonce:     newNonce(t),
+	}
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeSignatureMismatch) {
+		t.Fatalf("旧格式签名应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestLinkWalletBindsDomainAndAccount(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{})
+	other := createUser(t, db, models.User{WalletPubKey: "other-wallet"})
+
+	// 为其他账户生成的签名不能绑定到当前账户
+	req, _ := linkWalletRequest(t, other.UUID)
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeSignatureMismatch) {
+		t.Fatalf("其他账户的签名应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+
+	// 为其他服务身份生成的签名不能通过
+	req, _ = linkWalletRequest(t, user.UUID)
+	if _, resp := serve(t, HandleLinkWallet(db, WalletLoginPolicy{Domain: "other"}), "POST", user.UUID, req); resp.Code != int(response.CodeSignatureMismatch) {
+		t.Fatalf("其他服务身份的签名应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestLinkWalletNonceReuse(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{})
+
+	req, _ := linkWalletRequest(t, user.UUID)
+	if status, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); status != 200 {
+		t.Fatalf("绑定钱包失败: %d %s", resp.Code, resp.Msg)
+	}
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeNonceReused) {
+		t.Fatalf("重放的绑定请求应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestLinkWalletCustodialRequiresConfirmation(t *testing.T) {
+	db := newTestDB(t)
+	email := "custodial@uap.test"
+	user := createUser(t, db, models.User{Email: &email, WalletPubKey: "custodial-pub", WalletPrivKey: "sealed-priv"})
+
+	req, priv := linkWalletRequest(t, user.UUID)
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeCustodialWallet) {
+		t.Fatalf("未确认替换托管钱包应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+	if got := loadUser(t, db, user.UUID); got.WalletPubKey != "custodial-pub" || got.WalletPrivKey != "sealed-priv" {
+		t.Fatalf("被拒绝的请求不应修改托管钱包: %q %q", got.WalletPubKey, got.WalletPrivKey)
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	req = signLinkWallet(priv, pub, user.UUID, newNonce(t))
+	req.ReplaceCustodial = true
+	if status, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); status != 200 {
+		t.Fatalf("确认后替换托管钱包失败: %d %s", resp.Code, resp.Msg)
+	}
+	if got := loadUser(t, db, user.UUID); got.WalletPubKey != req.PublicKey || got.WalletPrivKey != "" {
+		t.Fatalf("替换后应为自托管钱包: %q %q", got.WalletPubKey, got.WalletPrivKey)
+	}
+}
+
+func TestLinkWalletSelfCustodyAlreadyLinked(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{WalletPubKey: "self-pub"})
+
+	req, _ := linkWalletRequest(t, user.UUID)
+	req.ReplaceCustodial = true
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeAlreadyLinked) {
+		t.Fatalf("已绑定自托管钱包时应拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestLinkWalletOwnedByAnotherAccount(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{})
+
+	req, _ := linkWalletRequest(t, user.UUID)
+	createUser(t, db, models.User{WalletPubKey: req.PublicKey})
+
+	if _, resp := serve(t, HandleLinkWallet(db, testLinkPolicy), "POST", user.UUID, req); resp.Code != int(response.CodeIdentityInUse) {
+		t.Fatalf("钱包属于其他账户时应拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+	if got := loadUser(t, db, user.UUID); got.WalletPubKey != "" {
+		t.Fatalf("被拒绝的请求不应修改钱包: %q", got.WalletPubKey)
+	}
+}
+
+func TestLinkEmail(t *testing.T) {
+	db := newTestDB(t)
+	codes := emailcode.NewMemoryStore()
+	user := createUser(t, db, models.User{WalletPubKey: "wallet"})
+
+	codes.Save("new@uap.test", "123456", time.Now().Add(time.Minute))
+	status, resp := serve(t, HandleLinkEmail(db, codes), "POST", user.UUID, LinkEmailRequest{Email: "new@uap.test", Code: "123456"})
+	if status != 200 {
+		t.Fatalf("绑定邮箱失败: %d %s", resp.Code, resp.Msg)
+	}
+	if got := loadUser(t, db, user.UUID); got.Email == nil || *got.Email != "new@uap.test" {
+		t.Fatalf("邮箱未写入: %v", got.Email)
+	}
+
+	// 已绑定邮箱的账户不能再绑定其他邮箱
+	codes.Save("second@uap.test", "123456", time.Now().Add(time.Minute))
+	if _, resp := serve(t, HandleLinkEmail(db, codes), "POST", user.UUID, LinkEmailRequest{Email: "second@uap.test", Code: "123456"}); resp.Code != int(response.CodeAlreadyLinked) {
+		t.Fatalf("重复绑定其他邮箱应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestLinkEmailOwnedByAnotherAccount(t *testing.T) {
+	db := newTestDB(t)
+	codes := emailcode.NewMemoryStore()
+	email := "taken@uap.test"
+	createUser(t, db, models.User{Email: &email})
+	user := createUser(t, db, models.User{WalletPubKey: "wallet"})
+
+	codes.Save(email, "123456", time.Now().Add(time.Minute))
+	if _, resp := serve(t, HandleLinkEmail(db, codes), "POST", user.UUID, LinkEmailRequest{Email: email, Code: "123456"}); resp.Code != int(response.CodeIdentityInUse) {
+		t.Fatalf("邮箱属于其他账户时应拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+	if got := loadUser(t, db, user.UUID); got.Email != nil {
+		t.Fatalf("被拒绝的请求不应修改邮箱: %v", *got.Email)
+	}
+}
+
+func TestLinkEmailWrongCode(t *testing.T) {
+	db := newTestDB(t)
+	codes := emailcode.NewMemoryStore()
+	user := createUser(t, db, models.User{WalletPubKey: "wallet"})
+
+	codes.Save("new@uap.test", "123456", time.Now().Add(time.Minute))
+	if _, resp := serve(t, HandleLinkEmail(db, codes), "POST", user.UUID, LinkEmailRequest{Email: "new@uap.test", Code: "654321"}); resp.Code != int(response.CodeVerificationFailed) {
+		t.Fatalf("验证码错误应被拒绝，实际 %d %s", resp.Code, resp.Error)
+	}
+}
@@ -1,17 +1,32 @@
 package api
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"sort"
 	"strings"
 
 	"uap-admin/pkg/auth"
 	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// claimNames Claims 的字段名（排序后），日志只记录有哪些字段，不记录取值
+func claimNames(claims jwt.MapClaims) []string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // AuthMiddleware JWT 鉴权中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -19,7 +34,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			log.Printf("[鉴权] 缺少 Authorization Header")
-			c.JSON(401, response.Error(401, "缺少 Authorization Header"))
+			fail(c, response.CodeTokenMissing, "缺少 Authorization Header")
 			c.Abort()
 			return
 		}
@@ -34,47 +49,36 @@ func AuthMiddleware() gin.HandlerFunc {
 		publicKey := auth.GetPublicKey()
 		if len(publicKey) == 0 {
 			log.Printf("[鉴权] 获取公钥失败：公钥为空")
-			c.JSON(500, response.Error(500, "服务器配置错误：公钥未初始化"))
+			fail(c, response.CodeServerConfig, "服务器配置错误：公钥未初始化")
 			c.Abort()
 			return
 		}
 
-		// 验证 Token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 必须检查签名算法是否匹配 jwt.SigningMethodEdDSA
-			// 注意：jwt.SigningMethodEdDSA 是用于 Ed25519 的签名方法
-			if token.Method != jwt.SigningMethodEdDSA {
-				log.Printf("[鉴权] 签名方法不匹配：期望 %v，实际 %v", jwt.SigningMethodEdDSA.Alg(), token.Method.Alg())
-				return nil, fmt.Errorf("unexpected signing method: %v (expected: %v)", token.Method.Alg(), jwt.SigningMethodEdDSA.Alg())
-			}
-
-			// 返回 ed25519.PublicKey 类型
-			// 严禁返回私钥，也严禁返回 nil
-			return publicKey, nil
-		})
+		// 验证 Token（按头部的 kid 选择公钥，轮换期间旧公钥签发的 Token 仍然有效）
+		token, err := jwt.Parse(tokenString, auth.Keyfunc)
 
 		// 详细的错误处理
 		if err != nil {
 			// 打印详细的错误信息用于调试
-			log.Printf("[鉴权] Token 验证失败：%v (错误类型: %T)", err, err)
-			
+			log.Printf("[鉴权] Token %s 验证失败：%v (错误类型: %T)", utils.Fingerprint(tokenString), err, err)
+
 			// 根据错误信息判断具体原因
 			errMsg := strings.ToLower(err.Error())
 			if strings.Contains(errMsg, "expired") || strings.Contains(errMsg, "exp") {
 				log.Printf("[鉴权] 具体错误：Token 已过期")
-				c.JSON(401, response.Error(401, "Token 已过期"))
+				fail(c, response.CodeTokenExpired, "Token 已过期")
 			} else if strings.Contains(errMsg, "signature") || strings.Contains(errMsg, "crypto") {
 				log.Printf("[鉴权] 具体错误：Token 签名验证失败（可能是公钥不匹配或签名算法错误）")
-				c.JSON(401, response.Error(401, "Token 签名验证失败"))
+				fail(c, response.CodeTokenInvalid, "Token 签名验证失败")
 			} else if strings.Contains(errMsg, "malformed") || strings.Contains(errMsg, "invalid") {
 				log.Printf("[鉴权] 具体错误：Token 格式错误或无效")
-				c.JSON(401, response.Error(401, "Token 格式错误"))
+				fail(c, response.CodeTokenInvalid, "Token 格式错误")
 			} else if strings.Contains(errMsg, "signing method") {
 				log.Printf("[鉴权] 具体错误：签名方法不匹配")
-				c.JSON(401, response.Error(401, "Token 签名方法不匹配"))
+				fail(c, response.CodeTokenInvalid, "Token 签名方法不匹配")
 			} else {
 				log.Printf("[鉴权] 具体错误：未知错误")
-				c.JSON(401, response.Error(401, fmt.Sprintf("Token 验证失败: %v", err)))
+				fail(c, response.CodeTokenInvalid, fmt.Sprintf("Token 验证失败: %v", err))
 			}
 			c.Abort()
 			return
@@ -82,8 +86,8 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// 再次检查 token 是否有效
 		if !token.Valid {
-			log.Printf("[鉴权] Token 无效")
-			c.JSON(401, response.Error(401, "Token 无效"))
+			log.Printf("[鉴权] Token %s 无效", utils.Fingerprint(tokenString))
+			fail(c, response.CodeTokenInvalid, "Token 无效")
 			c.Abort()
 			return
 		}
@@ -92,15 +96,15 @@ func AuthMiddleware() gin.HandlerFunc {
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
 			log.Printf("[鉴权] 无法解析 Token Claims（类型断言失败）")
-			c.JSON(401, response.Error(401, "无法解析 Token Claims"))
+			fail(c, response.CodeTokenInvalid, "无法解析 Token Claims")
 			c.Abort()
 			return
 		}
 
 		userUUID, ok := claims["uuid"].(string)
 		if !ok {
-			log.Printf("[鉴权] Token 中缺少 uuid 字段（Claims: %+v）", claims)
-			c.JSON(401, response.Error(401, "Token 中缺少 uuid 字段"))
+			log.Printf("[鉴权] Token %s 中缺少 uuid 字段（Claims 字段: %s）", utils.Fingerprint(tokenString), strings.Join(claimNames(claims), ", "))
+			fail(c, response.CodeTokenInvalid, "Token 中缺少 uuid 字段")
 			c.Abort()
 			return
 		}
@@ -112,3 +116,63 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// verifyAdminSecret 常量时间比较管理员密钥
+// adminSecrets 包含当前密钥和轮换期间仍然有效的旧密钥，任意一个匹配即通过
+// 所有候选密钥都会参与比较，避免通过响应时间推断匹配位置
+func verifyAdminSecret(provided string, adminSecrets []string) bool {
+	provided = strings.TrimSpace(provided)
+	if provided == "" {
+		return false
+	}
+
+	matched := 0
+	for _, secret := range adminSecrets {
+		if secret == "" {
+			continue
+		}
+		matched |= subtle.ConstantTimeCompare([]byte(provided), []byte(secret))
+	}
+	return matched == 1
+}
+
+// MaxBodyBytes 请求体大小上限（所有接口的 JSON 请求体都远小于该值）
+const MaxBodyBytes int64 = 1 << 20 // 1MB
+
+// BodyLimitMiddleware 限制请求体大小，超出上限返回 413
+// Content-Length 已知时直接拒绝；分块传输等未知长度的请求在读取超限时由 bindJSON 返回 413
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			log.Printf("[请求] 请求体过大: %s %s (%d 字节)", c.Request.Method, c.Request.URL.Path, c.Request.ContentLength)
+			fail(c, response.CodeBodyTooLarge, fmt.Sprintf("请求体过大（最大 %d 字节）", maxBytes))
+			c.Abort()
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
+
+// fail 按错误码返回统一格式的错误响应（HTTP 状态码由错误码前 3 位决定）
+func fail(c *gin.Context, code response.Code, msg string) {
+	c.JSON(code.Status(), response.Error(code, msg))
+}
+
+// bindJSON 解析并校验 JSON 请求体，失败时写入错误响应并返回 false
+// 请求体超过 BodyLimitMiddleware 的上限返回 413，其余解析/校验错误返回 400
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		fail(c, response.CodeBodyTooLarge, fmt.Sprintf("请求体过大（最大 %d 字节）", maxErr.Limit))
+		return false
+	}
+	fail(c, response.CodeBadRequest, fmt.Sprintf("参数错误: %v", err))
+	return false
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerifyAdminSecret(t *testing.T) {
+	secrets := []string{"current-secret", "previous-secret"}
+	cases := []struct {
+		provided string
+		want     bool
+	}{
+		{"current-secret", true},
+		{"previous-secret", true},
+		{"  current-secret\t", true},
+		{"current-secre", false},
+		{"current-secret-x", false},
+		{"", false},
+		{"   ", false},
+	}
+	for _, tc := range cases {
+		if got := verifyAdminSecret(tc.provided, secrets); got != tc.want {
+			t.Errorf("verifyAdminSecret(%q) = %v，期望 %v", tc.provided, got, tc.want)
+		}
+	}
+
+	// 空的候选密钥不能被空字符串或任意值匹配
+	if verifyAdminSecret("x", []string{""}) {
+		t.Error("空的候选密钥不应匹配")
+	}
+}
+
+func TestAdminSecretRotation(t *testing.T) {
+	db := newTestDB(t)
+	handler := HandleDeleteNode(db, []string{"new-secret", "old-secret"})
+
+	for secret, want := range map[string]response.Code{
+		"new-secret":   response.CodeNodeNotFound, // 鉴权通过，节点不存在
+		"old-secret":   response.CodeNodeNotFound,
+		"wrong-secret": response.CodeForbidden,
+		"":             response.CodeForbidden,
+	} {
+		req := newRequest(t, "DELETE", "/", NodeDeleteRequest{Address: "1.1.1.1:443"})
+		req.Header.Set("X-Admin-Secret", secret)
+		if _, resp := serveRequest(t, handler, req, ""); resp.Code != int(want) {
+			t.Errorf("密钥 %q: 响应码 %d，期望 %d", secret, resp.Code, want)
+		}
+	}
+}
+
+// serveLimited 经过 BodyLimitMiddleware(limit) 后用 bindJSON 解析请求体，返回 HTTP 状态码与响应
+func serveLimited(t *testing.T, limit int64, req *http.Request) (int, testResponse) {
+	t.Helper()
+	r := gin.New()
+	r.Use(BodyLimitMiddleware(limit))
+	r.POST("/", func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if !bindJSON(c, &body) {
+			return
+		}
+		c.JSON(200, response.Success(body.Name))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+func TestBodyLimit(t *testing.T) {
+	const limit = 64
+	big := `{"name":"` + strings.Repeat("x", 2*limit) + `"}`
+
+	cases := []struct {
+		name   string
+		body   string
+		length int64 // -1 表示未知长度（分块传输）
+		status int
+		code   response.Code
+	}{
+		{"正常请求", `{"name":"ok"}`, 13, 200, 200},
+		{"Content-Length 超限", big, int64(len(big)), 413, response.CodeBodyTooLarge},
+		{"分块传输超限", big, -1, 413, response.CodeBodyTooLarge},
+		{"分块传输未超限", `{"name":"ok"}`, -1, 200, 200},
+		{"JSON 格式错误", `{"name":`, 8, 400, response.CodeBadRequest},
+		{"缺少必填字段", `{}`, 2, 400, response.CodeBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", "/", io.NopCloser(strings.NewReader(tc.body)))
+		req.ContentLength = tc.length
+		req.Header.Set("Content-Type", "application/json")
+		status, resp := serveLimited(t, limit, req)
+		if status != tc.status || resp.Code != int(tc.code) {
+			t.Errorf("%s: HTTP %d / 响应码 %d，期望 %d / %d", tc.name, status, resp.Code, tc.status, tc.code)
+		}
+	}
+}
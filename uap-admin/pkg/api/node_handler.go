@@ -1,11 +1,14 @@
 package api
 
 import (
+	"fmt"
 	"log"
-	"strings"
+	"strconv"
 
+	"uap-admin/pkg/database"
 	"uap-admin/pkg/models"
 	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -16,67 +19,106 @@ import (
 type NodeRegisterRequest struct {
 	Name      string `json:"name" binding:"required"`
 	Address   string `json:"address" binding:"required"`    // e.g. "1.2.3.4:443"
-	PublicKey string `json:"public_key" binding:"required"` // 节点的公钥内容
+	PublicKey string `json:"public_key" binding:"required"` // 节点的 Ed25519 公钥 PEM（入库前规范化）
 	Region    string `json:"region" binding:"required"`     // e.g. "US"
+	Weight    int    `json:"weight"`                        // 选路权重（可选，1-1000；不传时新节点为默认值，已有节点保持不变）
+	Capacity  int    `json:"capacity" binding:"min=0"`      // 承载能力（可选，并发连接数，用于质量评分中的负载；不传时已有节点保持不变）
 }
 
-// GetNodeList 获取节点列表（客户端使用）
+// GetNodeList 获取节点列表（客户端使用），按质量评分从高到低排列
+// 可选查询参数 region 只返回该地区的节点；两种查询都由 (status, region) 索引覆盖
+// 可选查询参数 sticky=true 开启粘性选路：用户的固定节点仍健康时排在首位并标记 pinned
 func GetNodeList(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var nodes []models.Node
 
-		// 查询所有 Status=1 的节点
-		if err := db.Where("status = ?", 1).Find(&nodes).Error; err != nil {
+		// 查询所有 Status=1 且不在维护模式的节点
+		query := db.Where("status = ? AND draining = ?", 1, false)
+		if region := c.Query("region"); region != "" {
+			query = query.Where("region = ?", region)
+		}
+		if err := query.Order("score DESC, id").Find(&nodes).Error; err != nil {
 			log.Printf("查询节点列表失败: %v", err)
-			c.JSON(500, response.Error(500, "查询节点列表失败"))
+			fail(c, response.CodeDatabase, "查询节点列表失败")
 			return
 		}
 
+		// 粘性选路失败不影响返回节点列表
+		if sticky, _ := strconv.ParseBool(c.Query("sticky")); sticky {
+			if err := pinNode(db, c.GetString("user_uuid"), nodes); err != nil {
+				log.Printf("⚠️  查询固定节点失败: %v", err)
+			}
+		}
+
 		// 返回节点列表
 		c.JSON(200, response.Success(nodes))
 	}
 }
 
 // HandleNodeRegister 处理节点注册/更新（管理员接口）
-func HandleNodeRegister(db *gorm.DB, adminSecret string) gin.HandlerFunc {
+func HandleNodeRegister(db *gorm.DB, adminSecrets []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 管理员鉴权：检查 X-Admin-Secret
 		secret := c.GetHeader("X-Admin-Secret")
-		if strings.TrimSpace(secret) != adminSecret {
+		if !verifyAdminSecret(secret, adminSecrets) {
 			log.Printf("❌ 管理员密钥错误，拒绝节点注册请求")
-			c.JSON(403, response.Error(403, "forbidden"))
+			fail(c, response.CodeForbidden, "forbidden")
 			return
 		}
 
 		// 解析请求体
 		var req NodeRegisterRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, response.Error(400, "参数错误"))
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		// 校验选路权重（0 表示未指定）
+		updateColumns := []string{"name", "address", "region", "status"}
+		weight := models.DefaultNodeWeight
+		if req.Weight != 0 {
+			if req.Weight < models.MinNodeWeight || req.Weight > models.MaxNodeWeight {
+				fail(c, response.CodeBadRequest, fmt.Sprintf("weight 超出范围（%d-%d）", models.MinNodeWeight, models.MaxNodeWeight))
+				return
+			}
+			weight = req.Weight
+			updateColumns = append(updateColumns, "weight")
+		}
+		if req.Capacity != 0 {
+			updateColumns = append(updateColumns, "capacity")
+		}
+
+		// 规范化公钥：格式不同（换行、空白、折行）的同一把公钥对应同一个节点
+		publicKey, err := utils.NormalizePublicKeyPEM(req.PublicKey)
+		if err != nil {
+			log.Printf("❌ 节点公钥格式错误: Name=%s, Address=%s: %v", req.Name, req.Address, err)
+			fail(c, response.CodeInvalidNodeKey, "public_key 不是有效的 Ed25519 公钥 PEM")
 			return
 		}
 
-		// 使用 PublicKey 作为唯一键进行 upsert
+		// 使用规范化后的 PublicKey 作为唯一键进行 upsert
 		node := models.Node{
 			Name:      req.Name,
 			Address:   req.Address,
-			PublicKey: req.PublicKey,
+			PublicKey: publicKey,
 			Region:    req.Region,
 			Status:    1, // 在线
+			Weight:    weight,
+			Capacity:  req.Capacity,
 		}
 
-		if err := db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "public_key"}},
-			DoUpdates: clause.AssignmentColumns([]string{"name", "address", "region", "status"}),
-		}).Create(&node).Error; err != nil {
+		if err := database.Retry(func() error {
+			return db.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "public_key"}},
+				DoUpdates: clause.AssignmentColumns(updateColumns),
+			}).Create(&node).Error
+		}); err != nil {
 			log.Printf("❌ 节点注册失败: %v", err)
-			c.JSON(500, response.Error(500, "节点注册失败"))
+			fail(c, response.CodeDatabase, "节点注册失败")
 			return
 		}
 
-		log.Printf("✅ 节点注册/更新成功: Name=%s, Address=%s, Region=%s", req.Name, req.Address, req.Region)
-		c.JSON(200, response.Success(map[string]string{
-			"msg": "Node registered",
-		}))
+		log.Printf("✅ 节点注册/更新成功: Name=%s, Address=%s, Region=%s, Weight=%d, Capacity=%d", req.Name, req.Address, req.Region, req.Weight, req.Capacity)
+		c.JSON(200, response.Success(MessageResponse{Msg: "Node registered"}))
 	}
 }
 
@@ -86,42 +128,43 @@ type NodeDeleteRequest struct {
 }
 
 // HandleDeleteNode 处理节点删除（管理员接口）
-func HandleDeleteNode(db *gorm.DB, adminSecret string) gin.HandlerFunc {
+func HandleDeleteNode(db *gorm.DB, adminSecrets []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 管理员鉴权：检查 X-Admin-Secret
 		secret := c.GetHeader("X-Admin-Secret")
-		if strings.TrimSpace(secret) != adminSecret {
+		if !verifyAdminSecret(secret, adminSecrets) {
 			log.Printf("❌ 管理员密钥错误，拒绝节点删除请求")
-			c.JSON(403, response.Error(403, "forbidden"))
+			fail(c, response.CodeForbidden, "forbidden")
 			return
 		}
 
 		// 解析请求体
 		var req NodeDeleteRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, response.Error(400, "参数错误"))
+		if !bindJSON(c, &req) {
 			return
 		}
 
 		// 查找并删除节点（通过地址）
-		result := db.Where("address = ?", req.Address).Delete(&models.Node{})
-		if result.Error != nil {
-			log.Printf("❌ 节点删除失败: %v", result.Error)
-			c.JSON(500, response.Error(500, "节点删除失败"))
+		var deleted int64
+		err := database.Retry(func() error {
+			result := db.Where("address = ?", req.Address).Delete(&models.Node{})
+			deleted = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			log.Printf("❌ 节点删除失败: %v", err)
+			fail(c, response.CodeDatabase, "节点删除失败")
 			return
 		}
 
 		// 检查是否找到并删除了节点
-		if result.RowsAffected == 0 {
+		if deleted == 0 {
 			log.Printf("⚠️  未找到地址为 %s 的节点", req.Address)
-			c.JSON(404, response.Error(404, "节点不存在"))
+			fail(c, response.CodeNodeNotFound, "节点不存在")
 			return
 		}
 
 		log.Printf("✅ 节点删除成功: Address=%s", req.Address)
-		c.JSON(200, response.Success(map[string]string{
-			"msg": "Node deleted",
-		}))
+		c.JSON(200, response.Success(MessageResponse{Msg: "Node deleted"}))
 	}
 }
-
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"gorm.io/gorm"
+)
+
+// registerNode 以管理员身份注册/更新节点
+func registerNode(t testing.TB, db *gorm.DB, req NodeRegisterRequest) testResponse {
+	t.Helper()
+	r := newRequest(t, "POST", "/", req)
+	r.Header.Set("X-Admin-Secret", "admin-secret")
+	_, resp := serveRequest(t, HandleNodeRegister(db, []string{"admin-secret"}), r, "")
+	return resp
+}
+
+// nodeByKey 按公钥读取节点
+func nodeByKey(t testing.TB, db *gorm.DB, publicKey string) models.Node {
+	t.Helper()
+	var node models.Node
+	if err := db.Where("public_key = ?", publicKey).First(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestNodeRegisterWeight(t *testing.T) {
+	db := newTestDB(t)
+	key := newNodeKeyPEM(t)
+	req := NodeRegisterRequest{Name: "us-1", Address: "1.1.1.1:443", PublicKey: key, Region: "US"}
+
+	if resp := registerNode(t, db, req); resp.Code != 200 {
+		t.Fatalf("注册节点: %d %s", resp.Code, resp.Msg)
+	}
+	if w := nodeByKey(t, db, key).Weight; w != models.DefaultNodeWeight {
+		t.Fatalf("未指定权重的新节点权重 %d", w)
+	}
+
+	req.Weight = 500
+	registerNode(t, db, req)
+	if w := nodeByKey(t, db, key).Weight; w != 500 {
+		t.Fatalf("更新后的权重 %d", w)
+	}
+	// 重新注册不带权重：保持运营方设置的权重
+	req.Weight = 0
+	req.Name = "us-1-renamed"
+	registerNode(t, db, req)
+	if node := nodeByKey(t, db, key); node.Weight != 500 || node.Name != "us-1-renamed" {
+		t.Fatalf("重新注册后的节点 %+v", node)
+	}
+
+	for _, weight := range []int{-1, models.MaxNodeWeight + 1} {
+		req.Weight = weight
+		if resp := registerNode(t, db, req); resp.Code != int(response.CodeBadRequest) {
+			t.Errorf("权重 %d: 响应码 %d", weight, resp.Code)
+		}
+	}
+}
+
+// TestNodeRegisterNormalizesKey 格式不同的同一把公钥注册为同一个节点
+func TestNodeRegisterNormalizesKey(t *testing.T) {
+	db := newTestDB(t)
+	key := newNodeKeyPEM(t)
+	for i, variant := range []string{
+		strings.ReplaceAll(key, "\n", "\r\n"),
+		"  " + key + "\n\n",
+		strings.ReplaceAll(strings.TrimSpace(key), "\n", `\n`), // 环境变量中常见的字面量 \n
+		key,
+	} {
+		req := NodeRegisterRequest{Name: fmt.Sprintf("us-%d", i), Address: "1.1.1.1:443", PublicKey: variant, Region: "US"}
+		if resp := registerNode(t, db, req); resp.Code != 200 {
+			t.Fatalf("第 %d 次注册: %d %s", i+1, resp.Code, resp.Msg)
+		}
+	}
+	var nodes []models.Node
+	if err := db.Find(&nodes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].PublicKey != key || nodes[0].Name != "us-3" {
+		t.Fatalf("节点 %+v，期望一个以规范公钥存储的节点", nodes)
+	}
+
+	for _, invalid := range []string{"not a key", key + newNodeKeyPEM(t)} {
+		req := NodeRegisterRequest{Name: "bad", Address: "2.2.2.2:443", PublicKey: invalid, Region: "US"}
+		if resp := registerNode(t, db, req); resp.Code != int(response.CodeInvalidNodeKey) {
+			t.Errorf("无效公钥 %q: 响应码 %d", invalid, resp.Code)
+		}
+	}
+}
+
+func TestGetNodeList(t *testing.T) {
+	db := newTestDB(t)
+	for _, n := range []models.Node{
+		{Name: "us-1", Region: "US", Status: 1, Score: 80, Weight: 300},
+		{Name: "jp-1", Region: "JP", Status: 1, Score: 95},
+		{Name: "us-off", Region: "US", Status: 0, Score: 100},
+		{Name: "us-drain", Region: "US", Status: 1, Score: 100, Draining: true},
+	} {
+		n.Address = n.Name + ":443"
+		n.PublicKey = newNodeKeyPEM(t)
+		if err := db.Create(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var nodes []models.Node
+	_, resp := serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/", nil), "")
+	decodeData(t, resp, &nodes)
+	if len(nodes) != 2 || nodes[0].Name != "jp-1" || nodes[1].Name != "us-1" || nodes[1].Weight != 300 {
+		t.Fatalf("节点列表 %+v，期望按评分排列的 jp-1, us-1", nodes)
+	}
+
+	_, resp = serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/?region=US", nil), "")
+	decodeData(t, resp, &nodes)
+	if len(nodes) != 1 || nodes[0].Name != "us-1" {
+		t.Fatalf("US 节点列表 %+v", nodes)
+	}
+}
+
+// indexColumns 索引包含的列（按索引中的顺序）
+func indexColumns(t testing.TB, db *gorm.DB, index string) []string {
+	t.Helper()
+	var cols []struct{ Name string }
+	if err := db.Raw("SELECT name FROM pragma_index_info(?) ORDER BY seqno", index).Scan(&cols).Error; err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// queryPlan 查询计划（EXPLAIN QUERY PLAN 的 detail 列）
+func queryPlan(t testing.TB, db *gorm.DB, query func(tx *gorm.DB) *gorm.DB) string {
+	t.Helper()
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB { return query(tx) })
+	var rows []struct{ Detail string }
+	if err := db.Raw("EXPLAIN QUERY PLAN " + sql).Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	details := make([]string, len(rows))
+	for i, r := range rows {
+		details[i] = r.Detail
+	}
+	return strings.Join(details, "; ")
+}
+
+func TestNodeIndexes(t *testing.T) {
+	db := newTestDB(t)
+	for index, want := range map[string]string{
+		"idx_nodes_status_region":  "status,region",
+		"idx_nodes_address_status": "address,status",
+	} {
+		if !db.Migrator().HasIndex(&models.Node{}, index) {
+			t.Fatalf("迁移后缺少索引 %s", index)
+		}
+		if got := strings.Join(indexColumns(t, db, index), ","); got != want {
+			t.Errorf("索引 %s 的列 %s，期望 %s", index, got, want)
+		}
+	}
+
+	// 客户端拉取节点列表与签发连接票据的查询使用复合索引，不扫描全表
+	plans := map[string]func(tx *gorm.DB) *gorm.DB{
+		"idx_nodes_status_region": func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("status = ? AND draining = ?", 1, false).Where("region = ?", "US").Order("score DESC, id").Find(&[]models.Node{})
+		},
+		"idx_nodes_address_status": func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("address = ? AND status = ? AND draining = ?", "1.1.1.1:443", 1, false).First(&models.Node{})
+		},
+	}
+	for index, query := range plans {
+		if plan := queryPlan(t, db, query); !strings.Contains(plan, "USING INDEX "+index) {
+			t.Errorf("查询未使用 %s: %s", index, plan)
+		}
+	}
+}
+
+// seedNodes 写入 n 个节点（5% 在线，分布在 7 个地区）
+func seedNodes(b *testing.B, db *gorm.DB, n int) {
+	b.Helper()
+	regions := []string{"US", "JP", "HK", "SG", "DE", "GB", "KR"}
+	nodes := make([]models.Node, n)
+	for i := range nodes {
+		status := 0
+		if i%20 == 0 {
+			status = 1
+		}
+		nodes[i] = models.Node{
+			Name:      fmt.Sprintf("node-%d", i),
+			Address:   fmt.Sprintf("10.%d.%d.%d:443", i>>16&0xff, i>>8&0xff, i&0xff),
+			PublicKey: fmt.Sprintf("key-%d", i),
+			Region:    regions[i%len(regions)],
+			Status:    status,
+			Score:     i % models.MaxNodeScore,
+		}
+	}
+	if err := db.CreateInBatches(nodes, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkGetNodeList 按地区查询在线节点：有 / 无 (status, region) 索引对比
+func BenchmarkGetNodeList(b *testing.B) {
+	for _, indexed := range []bool{true, false} {
+		name := "有索引"
+		if !indexed {
+			name = "无索引"
+		}
+		b.Run(name, func(b *testing.B) {
+			db := newTestDB(b)
+			seedNodes(b, db, 20000)
+			if !indexed {
+				for _, index := range []string{"idx_nodes_status_region", "idx_nodes_address_status"} {
+					if err := db.Migrator().DropIndex(&models.Node{}, index); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			handler := GetNodeList(db)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				serveRequest(b, handler, newRequest(b, "GET", "/?region=JP", nil), "")
+			}
+		})
+	}
+}
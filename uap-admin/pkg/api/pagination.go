@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 列表分页的条数
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// cursorPrefix 游标内容的版本前缀（游标对客户端不透明，之后可以改变编码）
+const cursorPrefix = "id:"
+
+// pageParams 管理员列表接口的分页参数（查询参数 limit / cursor / offset）
+// 默认按自增 id 倒序做 keyset 分页：cursor 为上一页返回的 next_cursor，下一页只取 id 更小的行，
+// 翻页期间插入的新行（id 更大）不会让后面的页重复或遗漏；不带 cursor 时可用 offset（小表兼容用法，翻页期间有插入时可能重复）
+type pageParams struct {
+	limit  int
+	before uint // 游标解码出的 id（0 表示第一页）
+	offset int
+}
+
+// parsePage 解析分页参数，参数错误时已返回 CodeBadRequest
+func parsePage(c *gin.Context) (pageParams, bool) {
+	p := pageParams{limit: defaultPageLimit}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			fail(c, response.CodeBadRequest, "参数错误: limit 取值范围 1-500")
+			return p, false
+		}
+		p.limit = n
+	}
+	cursor, offset := c.Query("cursor"), c.Query("offset")
+	if cursor != "" && offset != "" {
+		fail(c, response.CodeBadRequest, "参数错误: cursor 与 offset 不能同时使用")
+		return p, false
+	}
+	if cursor != "" {
+		id, ok := decodeCursor(cursor)
+		if !ok {
+			fail(c, response.CodeBadRequest, "参数错误: cursor 无效")
+			return p, false
+		}
+		p.before = id
+	}
+	if offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			fail(c, response.CodeBadRequest, "参数错误: offset 必须是非负整数")
+			return p, false
+		}
+		p.offset = n
+	}
+	return p, true
+}
+
+// apply 给查询加上排序与分页条件（多取一行用于判断是否还有下一页，见 pageIDs）
+func (p pageParams) apply(query *gorm.DB, table string) *gorm.DB {
+	if p.before > 0 {
+		query = query.Where(table+".id < ?", p.before)
+	}
+	return query.Order(table + ".id DESC").Limit(p.limit + 1).Offset(p.offset)
+}
+
+// trim 去掉多取的一行，返回保留的行数与下一页的游标（没有下一页时为空）
+// ids 为查询结果按顺序的 id
+func (p pageParams) trim(ids []uint) (int, string) {
+	if len(ids) <= p.limit {
+		return len(ids), ""
+	}
+	return p.limit, encodeCursor(ids[p.limit-1])
+}
+
+// encodeCursor 把 id 编码为不透明的游标
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatUint(uint64(id), 10)))
+}
+
+// decodeCursor 解码游标，格式不对时返回 false
+func decodeCursor(cursor string) (uint, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	v, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
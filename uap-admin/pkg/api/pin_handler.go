@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// stickyMinScore 固定节点的最低质量评分：低于该值视为不健康，清除固定，由客户端重新选路
+const stickyMinScore = 50
+
+// pinNode 粘性选路：用户的固定节点仍健康且在本次返回的列表中时移到首位并标记 pinned
+// 固定节点已下线、被删除或评分低于 stickyMinScore 时清除固定（下次签发票据时固定到新选中的节点）；
+// 节点健康但不在列表中（按其他地区查询）时保留固定
+func pinNode(db *gorm.DB, userUUID string, nodes []models.Node) error {
+	var user models.User
+	if err := db.Select("id", "pinned_node_id").Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.PinnedNodeID == nil {
+		return nil
+	}
+	pinnedID := *user.PinnedNodeID
+
+	var node models.Node
+	err := db.First(&node, pinnedID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil || node.Status != 1 || node.Score < stickyMinScore {
+		log.Printf("📌 固定节点已下线或评分过低，已清除: UUID=%s, NodeID=%d", userUUID, pinnedID)
+		// 只清除仍指向该节点的固定，不覆盖并发签发票据时写入的新固定
+		return database.Retry(func() error {
+			return db.Model(&models.User{}).Where("id = ? AND pinned_node_id = ?", user.ID, pinnedID).
+				Updates(map[string]interface{}{"pinned_node_id": nil, "pinned_at": nil}).Error
+		})
+	}
+
+	for i := range nodes {
+		if nodes[i].ID == pinnedID {
+			pinned := nodes[i]
+			pinned.Pinned = true
+			copy(nodes[1:i+1], nodes[:i])
+			nodes[0] = pinned
+			break
+		}
+	}
+	return nil
+}
+
+// recordNodePin 把用户固定到本次签发票据的节点（客户端开启粘性选路时调用）
+// 固定未变化时不写库
+func recordNodePin(db *gorm.DB, user models.User, nodeID uint, now time.Time) error {
+	if user.PinnedNodeID != nil && *user.PinnedNodeID == nodeID {
+		return nil
+	}
+	return database.Retry(func() error {
+		return db.Model(&models.User{}).Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"pinned_node_id": nodeID, "pinned_at": now}).Error
+	})
+}
+
+// HandleClearNodePin 清除当前账户的固定节点（需要 JWT 鉴权）
+// App 的"切换节点"操作调用，之后重新启动时客户端按延迟与权重重新选路
+func HandleClearNodePin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		if err := database.Retry(func() error {
+			return db.Model(&models.User{}).Where("uuid = ?", userUUID).
+				Updates(map[string]interface{}{"pinned_node_id": nil, "pinned_at": nil}).Error
+		}); err != nil {
+			log.Printf("❌ 清除固定节点失败: UUID=%s, err=%v", userUUID, err)
+			fail(c, response.CodeDatabase, "清除固定节点失败")
+			return
+		}
+
+		log.Printf("📌 已清除固定节点: UUID=%s", userUUID)
+		c.JSON(200, response.Success(MessageResponse{Msg: "Node pin cleared"}))
+	}
+}
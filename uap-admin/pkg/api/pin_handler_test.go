@@ -0,0 +1,121 @@
+package api
+
+import (
+	"testing"
+
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// stickyNodeList 以 userUUID 的身份请求粘性选路的节点列表
+func stickyNodeList(t *testing.T, db *gorm.DB, userUUID, query string) []models.Node {
+	t.Helper()
+	_, resp := serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/?sticky=true"+query, nil), userUUID)
+	var nodes []models.Node
+	decodeData(t, resp, &nodes)
+	return nodes
+}
+
+// pinnedID 用户当前的固定节点（未固定时为 0）
+func pinnedID(t *testing.T, db *gorm.DB, userUUID string) uint {
+	t.Helper()
+	user := loadUser(t, db, userUUID)
+	if user.PinnedNodeID == nil {
+		return 0
+	}
+	return *user.PinnedNodeID
+}
+
+func TestStickyNodePin(t *testing.T) {
+	db := newTestDB(t)
+	a := createNode(t, db, "a")
+	b := createNode(t, db, "b")
+	c := createNode(t, db, "c")
+	user := createUser(t, db, models.User{WalletPubKey: "sticky"})
+
+	// 开启粘性选路时签发票据即固定到该节点；未开启时不固定
+	if _, resp := serve(t, HandleConnectTicket(db), "POST", user.UUID, ConnectTicketRequest{Address: b.Address}); resp.Code != 200 {
+		t.Fatalf("签发票据失败: %s", resp.Msg)
+	}
+	if pinnedID(t, db, user.UUID) != 0 {
+		t.Fatal("未开启粘性选路时固定了节点")
+	}
+	if _, resp := serve(t, HandleConnectTicket(db), "POST", user.UUID, ConnectTicketRequest{Address: c.Address, Sticky: true}); resp.Code != 200 {
+		t.Fatalf("签发票据失败: %s", resp.Msg)
+	}
+	if pinnedID(t, db, user.UUID) != c.ID {
+		t.Fatal("开启粘性选路时未固定到签发票据的节点")
+	}
+
+	// 固定节点排在首位并标记 pinned，其余节点保持原有顺序
+	nodes := stickyNodeList(t, db, user.UUID, "")
+	if len(nodes) != 3 || nodes[0].ID != c.ID || !nodes[0].Pinned || nodes[1].ID != a.ID || nodes[2].ID != b.ID || nodes[1].Pinned {
+		t.Fatalf("节点列表 %+v", nodes)
+	}
+	// 未开启粘性选路的请求不受影响
+	_, resp := serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/", nil), user.UUID)
+	var plain []models.Node
+	decodeData(t, resp, &plain)
+	if plain[0].ID != a.ID || plain[2].Pinned {
+		t.Fatalf("未开启粘性选路的节点列表 %+v", plain)
+	}
+	// 按其他地区查询时固定节点不在列表中，保留固定
+	if nodes := stickyNodeList(t, db, user.UUID, "&region=JP"); len(nodes) != 0 || pinnedID(t, db, user.UUID) != c.ID {
+		t.Fatalf("其他地区的列表 %+v", nodes)
+	}
+}
+
+func TestStickyNodePinExpires(t *testing.T) {
+	cases := map[string]func(db *gorm.DB, node models.Node) error{
+		"节点下线": func(db *gorm.DB, node models.Node) error {
+			return db.Model(&node).Update("status", 0).Error
+		},
+		"评分过低": func(db *gorm.DB, node models.Node) error {
+			return db.Model(&node).Update("score", stickyMinScore-1).Error
+		},
+		"节点被删除": func(db *gorm.DB, node models.Node) error {
+			return db.Delete(&node).Error
+		},
+	}
+	for name, unhealthy := range cases {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t)
+			healthy := createNode(t, db, "healthy")
+			pinned := createNode(t, db, "pinned")
+			user := createUser(t, db, models.User{PinnedNodeID: &pinned.ID})
+
+			if err := unhealthy(db, pinned); err != nil {
+				t.Fatal(err)
+			}
+			nodes := stickyNodeList(t, db, user.UUID, "")
+			for _, n := range nodes {
+				if n.Pinned {
+					t.Fatalf("不健康的固定节点仍被标记: %+v", nodes)
+				}
+			}
+			if len(nodes) == 0 || nodes[0].ID != healthy.ID {
+				t.Fatalf("节点列表 %+v", nodes)
+			}
+			if pinnedID(t, db, user.UUID) != 0 {
+				t.Fatal("不健康的固定节点未被清除")
+			}
+		})
+	}
+}
+
+func TestHandleClearNodePin(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "a")
+	user := createUser(t, db, models.User{PinnedNodeID: &node.ID})
+
+	if _, resp := serve(t, HandleClearNodePin(db), "POST", user.UUID, nil); resp.Code != 200 {
+		t.Fatalf("清除固定节点失败: %s", resp.Msg)
+	}
+	if got := loadUser(t, db, user.UUID); got.PinnedNodeID != nil || got.PinnedAt != nil {
+		t.Fatalf("固定节点未清除: %v", got.PinnedNodeID)
+	}
+	if nodes := stickyNodeList(t, db, user.UUID, ""); nodes[0].Pinned {
+		t.Fatal("清除后节点仍被标记为固定")
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/billing"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// QuotaWarningThresholds 流量用量预警阈值（百分比，升序）
+// 每个计费周期内每个阈值只触发一次
+var QuotaWarningThresholds = []int{80, 95}
+
+// NotificationQuotaWarning 用量预警通知类型
+const NotificationQuotaWarning = "quota_warning"
+
+// SetQuotaRequest 设置用户流量配额请求
+type SetQuotaRequest struct {
+	UUID              string `json:"uuid" binding:"required"`
+	TrafficLimitBytes int64  `json:"traffic_limit_bytes" binding:"min=0"` // 0 表示不限
+}
+
+// SetQuotaResponse 设置流量配额响应
+type SetQuotaResponse struct {
+	UUID              string `json:"uuid"`
+	TrafficLimitBytes int64  `json:"traffic_limit_bytes"`
+	TrafficUsedBytes  int64  `json:"traffic_used_bytes"` // 当前计费周期已用流量
+}
+
+// HandleSetQuota 设置用户每个计费周期的流量上限（管理员接口）
+// 上限变化后重新计算预警阈值：已越过新上限的预警线时立即补发一次通知
+func HandleSetQuota(db *gorm.DB, adminSecrets []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 管理员鉴权：检查 X-Admin-Secret
+		if !verifyAdminSecret(c.GetHeader("X-Admin-Secret"), adminSecrets) {
+			log.Printf("❌ 管理员密钥错误，拒绝设置流量配额")
+			fail(c, response.CodeForbidden, "forbidden")
+			return
+		}
+
+		var req SetQuotaRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		var user models.User
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			if err := tx.Where("uuid = ?", req.UUID).First(&user).Error; err != nil {
+				return err
+			}
+			if user.TrafficLimitBytes == req.TrafficLimitBytes {
+				return nil
+			}
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"traffic_limit_bytes":  req.TrafficLimitBytes,
+				"quota_warned_percent": 0,
+			}).Error; err != nil {
+				return err
+			}
+			_, err := checkQuotaThresholds(tx, req.UUID, 0)
+			return err
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, response.CodeUserNotFound, "用户不存在")
+			return
+		}
+		if err != nil {
+			log.Printf("❌ 设置流量配额失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		log.Printf("✅ 设置流量配额: UUID=%s, Limit=%d", req.UUID, req.TrafficLimitBytes)
+		c.JSON(200, response.Success(SetQuotaResponse{
+			UUID:              req.UUID,
+			TrafficLimitBytes: req.TrafficLimitBytes,
+			TrafficUsedBytes:  user.TrafficUsedBytes,
+		}))
+	}
+}
+
+// addTrafficUsage 累加用户流量（增量累加，与并发上报、计费周期滚动互不覆盖），记入每日账本并检查用量预警阈值
+// 返回本次累加是否使用户流量用尽
+func addTrafficUsage(tx *gorm.DB, userUUID string, delta int64, now time.Time) (bool, error) {
+	if delta <= 0 {
+		return false, nil
+	}
+
+	if err := tx.Model(&models.User{}).
+		Where("uuid = ?", userUUID).
+		Update("traffic_used_bytes", gorm.Expr("traffic_used_bytes + ?", delta)).Error; err != nil {
+		return false, err
+	}
+	if err := billing.RecordUsage(tx, userUUID, delta, now); err != nil {
+		return false, err
+	}
+	return checkQuotaThresholds(tx, userUUID, delta)
+}
+
+// checkQuotaThresholds 用量越过预警阈值时为用户记录一条待推送通知
+// 通过条件更新 quota_warned_percent 保证幂等：同一阈值在同一计费周期内只会被一次上报触发
+// delta 为刚累加的用量，返回这次累加是否使用量从低于上限变为达到上限（流量用尽）
+func checkQuotaThresholds(tx *gorm.DB, userUUID string, delta int64) (bool, error) {
+	var user models.User
+	if err := tx.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil // 节点上报了未知用户（例如已删除），忽略
+		}
+		return false, err
+	}
+	if user.TrafficLimitBytes <= 0 {
+		return false, nil // 不限流量
+	}
+	exhausted := user.TrafficUsedBytes >= user.TrafficLimitBytes && user.TrafficUsedBytes-delta < user.TrafficLimitBytes
+
+	// 找出已越过的最高阈值
+	crossed := 0
+	for _, threshold := range QuotaWarningThresholds {
+		if user.TrafficUsedBytes*100 >= user.TrafficLimitBytes*int64(threshold) {
+			crossed = threshold
+		}
+	}
+	if crossed <= user.QuotaWarnedPercent {
+		return exhausted, nil
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("uuid = ? AND quota_warned_percent < ?", userUUID, crossed).
+		Update("quota_warned_percent", crossed)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return exhausted, nil // 已被并发上报触发
+	}
+
+	log.Printf("📈 用户流量越过 %d%% 预警线: UUID=%s, 已用 %d / %d 字节", crossed, userUUID, user.TrafficUsedBytes, user.TrafficLimitBytes)
+	return exhausted, tx.Create(&models.Notification{
+		UserUUID: userUUID,
+		Kind:     NotificationQuotaWarning,
+		Percent:  crossed,
+	}).Error
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"gorm.io/gorm"
+)
+
+// warningPercents 用户已记录的预警通知（按创建顺序）
+func warningPercents(t testing.TB, db *gorm.DB, userUUID string) []int {
+	t.Helper()
+	var notifications []models.Notification
+	if err := db.Where("user_uuid = ? AND kind = ?", userUUID, NotificationQuotaWarning).Order("id").Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	percents := make([]int, 0, len(notifications))
+	for _, n := range notifications {
+		percents = append(percents, n.Percent)
+	}
+	return percents
+}
+
+func TestQuotaWarningThresholds(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{TrafficLimitBytes: 1000})
+	now := time.Now()
+
+	add := func(delta int64) bool {
+		t.Helper()
+		exhausted, err := addTrafficUsage(db, user.UUID, delta, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exhausted
+	}
+
+	add(700)
+	if got := warningPercents(t, db, user.UUID); len(got) != 0 {
+		t.Fatalf("未越过预警线时产生了通知 %v", got)
+	}
+	add(150) // 850：越过 80%
+	add(50)  // 900：同一阈值不重复通知
+	if got := warningPercents(t, db, user.UUID); len(got) != 1 || got[0] != 80 {
+		t.Fatalf("越过 80%% 后的通知 %v", got)
+	}
+	// 一次上报越过 95% 与上限：只通知最高的阈值，并报告流量用尽
+	if !add(200) {
+		t.Fatal("用量达到上限时应报告流量用尽")
+	}
+	if add(10) {
+		t.Fatal("已用尽后的上报不应再次报告流量用尽")
+	}
+	if got := warningPercents(t, db, user.UUID); len(got) != 2 || got[1] != 95 {
+		t.Fatalf("越过 95%% 后的通知 %v", got)
+	}
+}
+
+func TestQuotaWarningUnlimited(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{})
+	if exhausted, err := addTrafficUsage(db, user.UUID, 1<<40, time.Now()); err != nil || exhausted {
+		t.Fatalf("不限流量的用户: exhausted=%v err=%v", exhausted, err)
+	}
+	if got := warningPercents(t, db, user.UUID); len(got) != 0 {
+		t.Fatalf("不限流量的用户产生了通知 %v", got)
+	}
+}
+
+func TestClientStatusDeliversOnce(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{TrafficLimitBytes: 1000})
+	if _, err := addTrafficUsage(db, user.UUID, 960, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var status ClientStatus
+	_, resp := serve(t, GetClientStatus(db), "GET", user.UUID, nil)
+	decodeData(t, resp, &status)
+	if status.TrafficUsedBytes != 960 || status.TrafficLimitBytes != 1000 {
+		t.Fatalf("账户状态 %+v", status)
+	}
+	if len(status.Notifications) != 1 || status.Notifications[0].Percent != 95 {
+		t.Fatalf("首次轮询的通知 %+v", status.Notifications)
+	}
+
+	_, resp = serve(t, GetClientStatus(db), "GET", user.UUID, nil)
+	decodeData(t, resp, &status)
+	if len(status.Notifications) != 0 {
+		t.Fatalf("通知被重复投递 %+v", status.Notifications)
+	}
+}
+
+func TestSetQuotaRechecksThresholds(t *testing.T) {
+	db := newTestDB(t)
+	user := createUser(t, db, models.User{TrafficLimitBytes: 10000})
+	if _, err := addTrafficUsage(db, user.UUID, 850, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	handler := HandleSetQuota(db, []string{"admin-secret"})
+
+	setQuota := func(limit int64) testResponse {
+		t.Helper()
+		req := newRequest(t, "POST", "/", SetQuotaRequest{UUID: user.UUID, TrafficLimitBytes: limit})
+		req.Header.Set("X-Admin-Secret", "admin-secret")
+		_, resp := serveRequest(t, handler, req, "")
+		return resp
+	}
+
+	// 下调上限后已越过新的预警线：立即补发通知
+	var out SetQuotaResponse
+	decodeData(t, setQuota(1000), &out)
+	if out.TrafficUsedBytes != 850 {
+		t.Fatalf("设置配额响应 %+v", out)
+	}
+	if got := warningPercents(t, db, user.UUID); len(got) != 1 || got[0] != 80 {
+		t.Fatalf("下调上限后的通知 %v", got)
+	}
+	// 上限不变不重复通知
+	setQuota(1000)
+	if got := warningPercents(t, db, user.UUID); len(got) != 1 {
+		t.Fatalf("上限不变时重复通知 %v", got)
+	}
+	if resp := setQuota(-1); resp.Code != int(response.CodeBadRequest) {
+		t.Fatalf("负数上限: 响应码 %d", resp.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureLogs 测试期间把日志写入缓冲区（TestMain 默认丢弃日志；handler 在 ServeHTTP 中同步执行）
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(old) })
+	return &buf
+}
+
+// assertNoSecrets 日志中不含任何敏感值原文
+func assertNoSecrets(t *testing.T, logs string, secrets ...string) {
+	t.Helper()
+	for _, secret := range secrets {
+		if secret != "" && strings.Contains(logs, secret) {
+			t.Fatalf("日志包含敏感值原文 %.24q...:\n%s", secret, logs)
+		}
+	}
+}
+
+// TestAuthFailureLogsRedacted 鉴权失败的日志只有 Token 的指纹，不含 Token 或签名原文
+func TestAuthFailureLogsRedacted(t *testing.T) {
+	logs := captureLogs(t)
+	token, err := auth.GenerateToken("redact-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := strings.LastIndex(token, ".")
+	forged := token[:dot+1] + strings.Repeat("A", len(token)-dot-1)
+	garbage := "not-a-jwt-but-still-a-bearer-secret"
+
+	r := gin.New()
+	r.GET("/", AuthMiddleware(), func(c *gin.Context) { c.JSON(200, response.Success(nil)) })
+	for _, header := range []string{"Bearer " + forged, garbage} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if strings.Contains(w.Body.String(), `"code":200`) {
+			t.Fatalf("无效的 Token 通过了鉴权: %s", header)
+		}
+	}
+
+	out := logs.String()
+	assertNoSecrets(t, out, forged, garbage, token[dot+1:], forged[dot+1:])
+	for _, secret := range []string{forged, garbage} {
+		if !strings.Contains(out, utils.Fingerprint(secret)) {
+			t.Fatalf("日志中没有 Token 指纹 %s:\n%s", utils.Fingerprint(secret), out)
+		}
+	}
+}
+
+// TestEmailCodeLogRedacted 默认日志中只有验证码的指纹，UAP_EMAIL_CODE_LOG 开启时才打印明文
+func TestEmailCodeLogRedacted(t *testing.T) {
+	logs := captureLogs(t)
+	codes := &recordingStore{Store: emailcode.NewMemoryStore()}
+	format := emailcode.CodeFormat{Length: 8, Alphabet: emailcode.AlphabetAlnum}
+
+	if _, resp := serve(t, HandleEmailCode(codes, format, false), http.MethodPost, "", EmailCodeRequest{Email: "a@example.com"}); resp.Code != http.StatusOK {
+		t.Fatalf("发送验证码 %+v", resp)
+	}
+	assertNoSecrets(t, logs.String(), codes.last)
+	if !strings.Contains(logs.String(), utils.Fingerprint(codes.last)) {
+		t.Fatalf("日志中没有验证码指纹:\n%s", logs)
+	}
+
+	logs.Reset()
+	serve(t, HandleEmailCode(codes, format, true), http.MethodPost, "", EmailCodeRequest{Email: "a@example.com"})
+	if !strings.Contains(logs.String(), codes.last) {
+		t.Fatalf("开发模式下日志中没有验证码明文:\n%s", logs)
+	}
+}
+
+// TestWalletLoginLogRedacted 钱包登录 / 注册的日志只有公钥指纹
+func TestWalletLoginLogRedacted(t *testing.T) {
+	logs := captureLogs(t)
+	db := newTestDB(t)
+	policy := WalletLoginPolicy{Domain: "uap-admin"}
+	wallet := newTestWallet(t)
+	for i := 0; i < 2; i++ { // 注册，再登录
+		var out WalletLoginResponse
+		_, resp := serve(t, HandleWalletLogin(db, policy), http.MethodPost, "", wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), newNonce(t)))
+		decodeData(t, resp, &out)
+		assertNoSecrets(t, logs.String(), out.Token)
+	}
+	// v1 消息的告警同样不含公钥
+	serve(t, HandleWalletLogin(db, policy), http.MethodPost, "", wallet.login(WalletMessageV1, policy.Domain, time.Now().Unix(), ""))
+
+	pubHex := hex.EncodeToString(wallet.pub)
+	assertNoSecrets(t, logs.String(), pubHex)
+	if !strings.Contains(logs.String(), utils.Fingerprint(pubHex)) {
+		t.Fatalf("日志中没有公钥指纹:\n%s", logs)
+	}
+}
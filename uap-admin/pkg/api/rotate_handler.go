@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errSelfCustody 钱包为自托管，服务端不持有私钥，无法轮换
+var errSelfCustody = errors.New("self-custody wallet")
+
+// errSealFailed 新私钥加密失败（主密钥未初始化等）
+var errSealFailed = errors.New("seal failed")
+
+// WalletRotateResponse 轮换托管钱包响应
+type WalletRotateResponse struct {
+	PublicKey         string `json:"public_key"`          // 新钱包公钥（Hex 编码）
+	PreviousPublicKey string `json:"previous_public_key"` // 已作废的旧钱包公钥（Hex 编码）
+}
+
+// HandleWalletRotate 重新生成当前账户的托管钱包密钥对（需要 JWT 鉴权）
+// 旧公钥随之作废：不再对应该账户，绑定旧公钥的连接票据无法再完成签名握手
+// 自托管钱包返回 409。每次轮换（包括拒绝）都会记录审计日志
+func HandleWalletRotate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Printf("❌ 生成钱包密钥失败: %v", err)
+			fail(c, response.CodeInternal, "生成钱包密钥失败")
+			return
+		}
+		newPubKey := hex.EncodeToString(pub)
+
+		var oldPubKey string
+		err = database.Transaction(db, func(tx *gorm.DB) error {
+			var user models.User
+			if err := tx.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+				return err
+			}
+			if user.WalletPrivKey == "" {
+				return errSelfCustody
+			}
+			oldPubKey = user.WalletPubKey
+
+			sealed, err := custody.SealPrivateKey(userUUID, priv)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errSealFailed, err)
+			}
+			// 以旧公钥为条件更新，并发轮换时只有一个生效
+			result := tx.Model(&models.User{}).
+				Where("uuid = ? AND wallet_pub_key = ?", userUUID, oldPubKey).
+				Updates(map[string]interface{}{
+					"wallet_pub_key":  newPubKey,
+					"wallet_priv_key": sealed,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		})
+
+		switch {
+		case err == nil:
+		case errors.Is(err, errSelfCustody):
+			log.Printf("🔏 [审计] 拒绝轮换托管钱包: UUID=%s, IP=%s, 原因=自托管钱包", userUUID, c.ClientIP())
+			fail(c, response.CodeSelfCustody, "钱包为自托管，服务端不持有私钥，请在本地更换钱包")
+			return
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			fail(c, response.CodeUserNotFound, "用户不存在")
+			return
+		case errors.Is(err, errSealFailed):
+			log.Printf("❌ 加密托管钱包私钥失败: UUID=%s, err=%v", userUUID, err)
+			fail(c, response.CodeServerConfig, "托管钱包私钥不可用")
+			return
+		default:
+			log.Printf("❌ 轮换托管钱包失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		log.Printf("🔏 [审计] 轮换托管钱包: UUID=%s, IP=%s, 旧公钥=%s, 新公钥=%s", userUUID, c.ClientIP(), utils.Fingerprint(oldPubKey), utils.Fingerprint(newPubKey))
+		c.JSON(200, response.Success(WalletRotateResponse{
+			PublicKey:         newPubKey,
+			PreviousPublicKey: oldPubKey,
+		}))
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/google/uuid"
+)
+
+func TestHandleWalletRotate(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := createCustodialUser(t, db)
+
+	var data WalletRotateResponse
+	_, resp := serve(t, HandleWalletRotate(db), "POST", user.UUID, nil)
+	decodeData(t, resp, &data)
+	if data.PreviousPublicKey != user.WalletPubKey || data.PublicKey == user.WalletPubKey || len(data.PublicKey) != 2*ed25519.PublicKeySize {
+		t.Fatalf("轮换响应 %+v", data)
+	}
+
+	stored := loadUser(t, db, user.UUID)
+	if stored.WalletPubKey != data.PublicKey || stored.WalletPrivKey == user.WalletPrivKey {
+		t.Fatal("轮换后数据库中的密钥未更新")
+	}
+	// 旧公钥不再对应任何账户
+	var count int64
+	db.Model(&models.User{}).Where("wallet_pub_key = ?", user.WalletPubKey).Count(&count)
+	if count != 0 {
+		t.Fatal("旧公钥仍对应账户")
+	}
+
+	// 托管签名改用新私钥，可用新公钥验证
+	challenge := connectChallenge(t, time.Now())
+	var signed ClientSignResponse
+	_, resp = serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: challenge})
+	decodeData(t, resp, &signed)
+	pub, _ := hex.DecodeString(data.PublicKey)
+	sig, _ := hex.DecodeString(signed.Signature)
+	if signed.PublicKey != data.PublicKey || !ed25519.Verify(pub, []byte(challenge), sig) {
+		t.Fatal("轮换后的托管签名无法用新公钥验证")
+	}
+}
+
+func TestHandleWalletRotateRejected(t *testing.T) {
+	db := newTestDB(t)
+
+	// 自托管钱包：服务端不持有私钥
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	selfCustody := createUser(t, db, models.User{WalletPubKey: hex.EncodeToString(pub)})
+	if status, resp := serve(t, HandleWalletRotate(db), "POST", selfCustody.UUID, nil); status != 409 || resp.Code != int(response.CodeSelfCustody) {
+		t.Fatalf("自托管钱包返回 %d %d", status, resp.Code)
+	}
+	if loadUser(t, db, selfCustody.UUID).WalletPubKey != selfCustody.WalletPubKey {
+		t.Fatal("拒绝轮换后公钥被修改")
+	}
+
+	if _, resp := serve(t, HandleWalletRotate(db), "POST", uuid.New().String(), nil); resp.Code != int(response.CodeUserNotFound) {
+		t.Fatalf("不存在的用户返回 %d", resp.Code)
+	}
+
+	// 主密钥不可用：新私钥无法加密，事务回滚，原密钥保持不变
+	user, _ := createCustodialUser(t, db)
+	custody.Init(nil)
+	if _, resp := serve(t, HandleWalletRotate(db), "POST", user.UUID, nil); resp.Code != int(response.CodeServerConfig) {
+		t.Fatalf("主密钥不可用时返回 %d", resp.Code)
+	}
+	if stored := loadUser(t, db, user.UUID); stored.WalletPubKey != user.WalletPubKey || stored.WalletPrivKey != user.WalletPrivKey {
+		t.Fatal("轮换失败后密钥被修改")
+	}
+}
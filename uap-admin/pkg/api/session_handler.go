@@ -0,0 +1,252 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionTTL 会话在节点上报中消失后的最长保留时间
+// 节点停止上报（宕机/重启）时，其会话在 TTL 后自然过期
+const SessionTTL = 3 * time.Minute
+
+// SessionReport 节点上报的单个会话
+type SessionReport struct {
+	SessionID   string `json:"session_id" binding:"required"`
+	UserUUID    string `json:"user_uuid" binding:"required"`
+	ClientAddr  string `json:"client_addr"`
+	ConnectedAt int64  `json:"connected_at"` // Unix 秒
+	BytesUp     int64  `json:"bytes_up"`
+	BytesDown   int64  `json:"bytes_down"`
+	Closed      bool   `json:"closed"` // 连接已在两次上报之间关闭（携带最终流量，入账后删除）
+}
+
+// NodeReportRequest 节点定期上报（心跳 + 活跃会话）
+type NodeReportRequest struct {
+	PublicKey string          `json:"public_key" binding:"required"` // 节点公钥（与注册时为同一把公钥即可，格式可以不同）
+	Sessions  []SessionReport `json:"sessions"`
+	Probes    int64           `json:"probes" binding:"min=0"` // 上次上报以来鉴权失败（进入伪装模式）的次数
+	Draining  bool            `json:"draining"`               // 节点处于维护模式（拒绝新连接，已有连接继续转发）
+}
+
+// NodeReportResponse 节点上报响应
+type NodeReportResponse struct {
+	Sessions int `json:"sessions"` // 本次上报的会话数
+}
+
+// SessionView 会话展示（"MacBook via US-1 since 14:02"）
+type SessionView struct {
+	SessionID   string    `json:"session_id"`
+	UserUUID    string    `json:"user_uuid,omitempty"`
+	NodeName    string    `json:"node_name"`
+	NodeRegion  string    `json:"node_region"`
+	ClientAddr  string    `json:"client_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	BytesUp     int64     `json:"bytes_up"`
+	BytesDown   int64     `json:"bytes_down"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// HandleNodeReport 处理节点定期上报（管理员密钥鉴权）
+// 上报是高频写入，经由单写协程合并提交，避免与登录等写入争抢 SQLite 写锁
+// 上报同时作为节点心跳；probeThreshold 为一个上报周期内触发探测告警的鉴权失败次数（0 表示不告警）
+func HandleNodeReport(db *gorm.DB, writer *database.Writer, adminSecrets []string, probeThreshold int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 管理员鉴权：检查 X-Admin-Secret
+		if !verifyAdminSecret(c.GetHeader("X-Admin-Secret"), adminSecrets) {
+			log.Printf("❌ 管理员密钥错误，拒绝节点上报")
+			fail(c, response.CodeForbidden, "forbidden")
+			return
+		}
+
+		var req NodeReportRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		publicKey, err := utils.NormalizePublicKeyPEM(req.PublicKey)
+		if err != nil {
+			fail(c, response.CodeInvalidNodeKey, "public_key 不是有效的 Ed25519 公钥 PEM")
+			return
+		}
+		var node models.Node
+		if err := db.Where("public_key = ?", publicKey).First(&node).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeNodeNotFound, "节点未注册")
+				return
+			}
+			log.Printf("❌ 查询节点失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		now := time.Now()
+		var recovered bool
+		var exhausted []string
+		err = writer.Submit(func(tx *gorm.DB) error {
+			var err error
+			if recovered, err = markNodeReported(tx, node.ID, now, activeConns(req.Sessions), req.Draining); err != nil {
+				return err
+			}
+			exhausted, err = ReconcileSessions(tx, node.ID, req.Sessions, now)
+			return err
+		})
+		if err != nil {
+			log.Printf("❌ 会话同步失败: Node=%s, err=%v", node.Address, err)
+			fail(c, response.CodeDatabase, "会话同步失败")
+			return
+		}
+		emitReportAlerts(node, req.Probes, probeThreshold, recovered, exhausted, now)
+		if req.Draining != node.Draining {
+			logDraining(node, req.Draining)
+		}
+
+		c.JSON(200, response.Success(NodeReportResponse{Sessions: len(req.Sessions)}))
+	}
+}
+
+// activeConns 上报中仍在线的会话数（节点负载）
+func activeConns(reported []SessionReport) int {
+	n := 0
+	for _, r := range reported {
+		if !r.Closed {
+			n++
+		}
+	}
+	return n
+}
+
+// ReconcileSessions 用节点最新上报的会话列表同步该节点的会话表
+// 1. 上报中存在的会话：插入或更新（字节数、最后出现时间）
+// 2. 该节点不在本次上报中的会话（以及标记为已关闭的会话）：已断开，删除
+// 3. 所有节点超过 SessionTTL 未出现的会话：节点停止上报（宕机/重启），删除
+// 会话流量是连接建立以来的累计值，与上次上报的差值计入用户的流量用量；返回因本次入账流量用尽的用户
+func ReconcileSessions(tx *gorm.DB, nodeID uint, reported []SessionReport, now time.Time) ([]string, error) {
+	// 上次上报时各会话的累计流量
+	var known []models.Session
+	if err := tx.Where("node_id = ?", nodeID).Find(&known).Error; err != nil {
+		return nil, err
+	}
+	lastBytes := make(map[string]int64, len(known))
+	for _, s := range known {
+		lastBytes[s.SessionID] = s.BytesUp + s.BytesDown
+	}
+
+	usage := make(map[string]int64)
+	sessionIDs := make([]string, 0, len(reported))
+	for _, r := range reported {
+		if delta := r.BytesUp + r.BytesDown - lastBytes[r.SessionID]; delta > 0 {
+			usage[r.UserUUID] += delta
+		}
+		if r.Closed {
+			continue
+		}
+
+		session := models.Session{
+			SessionID:   r.SessionID,
+			NodeID:      nodeID,
+			UserUUID:    r.UserUUID,
+			ClientAddr:  r.ClientAddr,
+			ConnectedAt: time.Unix(r.ConnectedAt, 0),
+			BytesUp:     r.BytesUp,
+			BytesDown:   r.BytesDown,
+			LastSeenAt:  now,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}, {Name: "node_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"bytes_up", "bytes_down", "last_seen_at"}),
+		}).Create(&session).Error; err != nil {
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, r.SessionID)
+	}
+
+	// 删除本节点已断开的会话
+	stale := tx.Where("node_id = ?", nodeID)
+	if len(sessionIDs) > 0 {
+		stale = stale.Where("session_id NOT IN ?", sessionIDs)
+	}
+	if err := stale.Delete(&models.Session{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 删除长时间未上报的会话（其他节点宕机/重启遗留）
+	if err := tx.Where("last_seen_at < ?", now.Add(-SessionTTL)).Delete(&models.Session{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 流量入账
+	var exhausted []string
+	for userUUID, delta := range usage {
+		done, err := addTrafficUsage(tx, userUUID, delta, now)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			exhausted = append(exhausted, userUUID)
+		}
+	}
+	return exhausted, nil
+}
+
+// listSessions 查询未过期的会话（userUUID 为空时查询全部）
+func listSessions(db *gorm.DB, userUUID string) ([]SessionView, error) {
+	var views []SessionView
+	query := db.Table("sessions").
+		Select("sessions.session_id, sessions.user_uuid, nodes.name AS node_name, nodes.region AS node_region, sessions.client_addr, sessions.connected_at, sessions.bytes_up, sessions.bytes_down, sessions.last_seen_at").
+		Joins("LEFT JOIN nodes ON nodes.id = sessions.node_id").
+		Where("sessions.last_seen_at >= ?", time.Now().Add(-SessionTTL)).
+		Order("sessions.connected_at DESC")
+	if userUUID != "" {
+		query = query.Where("sessions.user_uuid = ?", userUUID)
+	}
+	if err := query.Scan(&views).Error; err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+// GetMySessions 获取当前用户的在线设备（需要 JWT 鉴权）
+func GetMySessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		views, err := listSessions(db, c.GetString("user_uuid"))
+		if err != nil {
+			log.Printf("查询会话失败: %v", err)
+			fail(c, response.CodeDatabase, "查询会话失败")
+			return
+		}
+		// 用户视图不需要重复返回自己的 UUID
+		for i := range views {
+			views[i].UserUUID = ""
+		}
+		c.JSON(200, response.Success(views))
+	}
+}
+
+// GetAllSessions 获取全部在线会话（管理员接口）
+func GetAllSessions(db *gorm.DB, adminSecrets []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !verifyAdminSecret(c.GetHeader("X-Admin-Secret"), adminSecrets) {
+			log.Printf("❌ 管理员密钥错误，拒绝查询会话")
+			fail(c, response.CodeForbidden, "forbidden")
+			return
+		}
+
+		views, err := listSessions(db, "")
+		if err != nil {
+			log.Printf("查询会话失败: %v", err)
+			fail(c, response.CodeDatabase, "查询会话失败")
+			return
+		}
+		c.JSON(200, response.Success(views))
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"gorm.io/gorm"
+)
+
+// createNode 登记一个测试节点
+func createNode(t testing.TB, db *gorm.DB, name string) models.Node {
+	t.Helper()
+	node := models.Node{Name: name, Region: "US", Address: name + ":443", PublicKey: newNodeKeyPEM(t), Status: 1}
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+// nodeSessionIDs 节点当前登记的会话 ID
+func nodeSessionIDs(t testing.TB, db *gorm.DB, nodeID uint) map[string]models.Session {
+	t.Helper()
+	var sessions []models.Session
+	if err := db.Where("node_id = ?", nodeID).Find(&sessions).Error; err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]models.Session, len(sessions))
+	for _, s := range sessions {
+		m[s.SessionID] = s
+	}
+	return m
+}
+
+func TestReconcileSessions(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "us-1")
+	user := createUser(t, db, models.User{})
+	now := time.Now()
+
+	reconcile := func(reported ...SessionReport) {
+		t.Helper()
+		if _, err := ReconcileSessions(db, node.ID, reported, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile(
+		SessionReport{SessionID: "a", UserUUID: user.UUID, BytesUp: 100, BytesDown: 200},
+		SessionReport{SessionID: "b", UserUUID: user.UUID, BytesUp: 10},
+	)
+	if got := nodeSessionIDs(t, db, node.ID); len(got) != 2 {
+		t.Fatalf("会话数 %d，期望 2", len(got))
+	}
+	if used := loadUser(t, db, user.UUID).TrafficUsedBytes; used != 310 {
+		t.Fatalf("首次上报后用量 %d，期望 310", used)
+	}
+
+	// 累计值只按差值入账；b 从上报中消失即视为断开；c 在两次上报之间建立又关闭
+	now = now.Add(30 * time.Second)
+	reconcile(
+		SessionReport{SessionID: "a", UserUUID: user.UUID, BytesUp: 150, BytesDown: 200},
+		SessionReport{SessionID: "c", UserUUID: user.UUID, BytesDown: 40, Closed: true},
+	)
+	got := nodeSessionIDs(t, db, node.ID)
+	if len(got) != 1 || got["a"].BytesUp != 150 {
+		t.Fatalf("第二次上报后的会话 %+v", got)
+	}
+	if used := loadUser(t, db, user.UUID).TrafficUsedBytes; used != 400 {
+		t.Fatalf("第二次上报后用量 %d，期望 400", used)
+	}
+
+	// 重复上报相同的累计值不重复入账；空上报清空本节点会话
+	reconcile(SessionReport{SessionID: "a", UserUUID: user.UUID, BytesUp: 150, BytesDown: 200})
+	reconcile()
+	if got := nodeSessionIDs(t, db, node.ID); len(got) != 0 {
+		t.Fatalf("空上报后仍有会话 %+v", got)
+	}
+	if used := loadUser(t, db, user.UUID).TrafficUsedBytes; used != 400 {
+		t.Fatalf("重复上报后用量 %d，期望 400", used)
+	}
+}
+
+func TestReconcileSessionsExpiresSilentNodes(t *testing.T) {
+	db := newTestDB(t)
+	silent, active := createNode(t, db, "us-1"), createNode(t, db, "jp-1")
+	user := createUser(t, db, models.User{})
+	now := time.Now()
+
+	if _, err := ReconcileSessions(db, silent.ID, []SessionReport{{SessionID: "x", UserUUID: user.UUID}}, now); err != nil {
+		t.Fatal(err)
+	}
+	// 其他节点的上报不影响 TTL 内的会话
+	if _, err := ReconcileSessions(db, active.ID, nil, now.Add(SessionTTL/2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeSessionIDs(t, db, silent.ID)) != 1 {
+		t.Fatal("TTL 内的会话被其他节点的上报删除")
+	}
+	// 停止上报的节点的会话超过 TTL 后由任意节点的上报清理
+	if _, err := ReconcileSessions(db, active.ID, nil, now.Add(SessionTTL+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeSessionIDs(t, db, silent.ID)) != 0 {
+		t.Fatal("超过 TTL 的会话未被清理")
+	}
+}
+
+func TestSessionViews(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "us-1")
+	alice := createUser(t, db, models.User{})
+	bob := createUser(t, db, models.User{WalletPubKey: "bob-wallet"})
+	now := time.Now()
+	_, err := ReconcileSessions(db, node.ID, []SessionReport{
+		{SessionID: "a1", UserUUID: alice.UUID, ClientAddr: "10.0.0.1:5000", ConnectedAt: now.Add(-time.Hour).Unix()},
+		{SessionID: "a2", UserUUID: alice.UUID, ConnectedAt: now.Unix()},
+		{SessionID: "b1", UserUUID: bob.UUID},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mine []SessionView
+	_, resp := serve(t, GetMySessions(db), "GET", alice.UUID, nil)
+	decodeData(t, resp, &mine)
+	if len(mine) != 2 || mine[0].SessionID != "a2" || mine[1].SessionID != "a1" {
+		t.Fatalf("用户会话 %+v，期望按连接时间倒序的 a2, a1", mine)
+	}
+	if mine[1].NodeName != "us-1" || mine[1].NodeRegion != "US" || mine[1].ClientAddr != "10.0.0.1:5000" || mine[1].UserUUID != "" {
+		t.Fatalf("用户会话视图 %+v", mine[1])
+	}
+
+	handler := GetAllSessions(db, []string{"admin-secret"})
+	req := newRequest(t, "GET", "/", nil)
+	req.Header.Set("X-Admin-Secret", "admin-secret")
+	var all []SessionView
+	_, resp = serveRequest(t, handler, req, "")
+	decodeData(t, resp, &all)
+	if len(all) != 3 {
+		t.Fatalf("全部会话 %d，期望 3", len(all))
+	}
+	if _, resp := serveRequest(t, handler, newRequest(t, "GET", "/", nil), ""); resp.Code != int(response.CodeForbidden) {
+		t.Fatalf("缺少管理员密钥: 响应码 %d", resp.Code)
+	}
+}
+
+func TestHandleNodeReport(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "us-1")
+	user := createUser(t, db, models.User{})
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	handler := HandleNodeReport(db, writer, []string{"admin-secret"}, 0)
+
+	report := func(req NodeReportRequest) testResponse {
+		t.Helper()
+		r := newRequest(t, "POST", "/", req)
+		r.Header.Set("X-Admin-Secret", "admin-secret")
+		_, resp := serveRequest(t, handler, r, "")
+		return resp
+	}
+
+	var out NodeReportResponse
+	decodeData(t, report(NodeReportRequest{
+		PublicKey: node.PublicKey,
+		Sessions:  []SessionReport{{SessionID: "s1", UserUUID: user.UUID, BytesUp: 64}},
+	}), &out)
+	if out.Sessions != 1 || len(nodeSessionIDs(t, db, node.ID)) != 1 {
+		t.Fatalf("上报响应 %+v", out)
+	}
+	if resp := report(NodeReportRequest{PublicKey: newNodeKeyPEM(t)}); resp.Code != int(response.CodeNodeNotFound) {
+		t.Fatalf("未注册节点: 响应码 %d", resp.Code)
+	}
+
+	// 与注册时格式不同的同一把公钥识别为同一个节点
+	if resp := report(NodeReportRequest{PublicKey: strings.ReplaceAll(node.PublicKey, "\n", "\r\n") + "  "}); resp.Code != 200 {
+		t.Fatalf("格式不同的公钥: 响应码 %d", resp.Code)
+	}
+	if resp := report(NodeReportRequest{PublicKey: "not a key"}); resp.Code != int(response.CodeInvalidNodeKey) {
+		t.Fatalf("无效公钥: 响应码 %d", resp.Code)
+	}
+}
+
+func TestHandleNodeReportDraining(t *testing.T) {
+	db := newTestDB(t)
+	node := createNode(t, db, "us-1")
+	writer := database.NewWriter(db, 16, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+	handler := HandleNodeReport(db, writer, []string{"admin-secret"}, 0)
+
+	report := func(draining bool) {
+		t.Helper()
+		r := newRequest(t, "POST", "/", NodeReportRequest{PublicKey: node.PublicKey, Draining: draining})
+		r.Header.Set("X-Admin-Secret", "admin-secret")
+		if _, resp := serveRequest(t, handler, r, ""); resp.Code != 200 {
+			t.Fatalf("上报响应码 %d", resp.Code)
+		}
+	}
+	listed := func() int {
+		t.Helper()
+		var nodes []models.Node
+		_, resp := serveRequest(t, GetNodeList(db), newRequest(t, "GET", "/", nil), "")
+		decodeData(t, resp, &nodes)
+		return len(nodes)
+	}
+
+	// 维护模式的节点不再下发；被健康检查标记为下线的节点上报维护模式时恢复在线但仍不下发
+	if err := db.Model(&node).Update("status", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	report(true)
+	var got models.Node
+	if err := db.First(&got, node.ID).Error; err != nil || got.Status != 1 || !got.Draining {
+		t.Fatalf("维护模式上报后的节点 %+v: %v", got, err)
+	}
+	if n := listed(); n != 0 {
+		t.Fatalf("维护中的节点被下发（%d 个）", n)
+	}
+
+	// 退出维护模式后恢复下发
+	report(false)
+	if n := listed(); n != 1 {
+		t.Fatalf("退出维护模式后下发 %d 个节点", n)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// connectChallengePattern 签名握手的挑战格式：uap-connect:<票据 jti>:<Unix 秒>
+// 只签这一种格式，托管私钥不能被用来签任意消息（如钱包登录消息）
+var connectChallengePattern = regexp.MustCompile(`^uap-connect:([0-9a-f]{32}):([0-9]{1,12})$`)
+
+// connectChallengeWindow 挑战时间戳允许的偏差（节点校验同样的窗口）
+const connectChallengeWindow = 60
+
+// 托管签名限流：每个账户每个窗口内的最大签名次数（每次建立连接签一次）
+const (
+	clientSignLimit  = 10
+	clientSignWindow = 1 * time.Minute
+)
+
+// ClientSignRequest 托管签名请求
+type ClientSignRequest struct {
+	Challenge string `json:"challenge" binding:"required,max=128"` // uap-connect:<jti>:<timestamp>
+}
+
+// ClientSignResponse 托管签名响应
+type ClientSignResponse struct {
+	Signature string `json:"signature"`  // Ed25519 签名（Hex 编码）
+	PublicKey string `json:"public_key"` // 签名使用的钱包公钥（Hex 编码）
+}
+
+// signWindow 单个账户的限流窗口
+type signWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	clientSignMu      sync.Mutex
+	clientSignWindows = make(map[string]*signWindow)
+)
+
+// allowClientSign 固定窗口限流，超出返回 false
+func allowClientSign(userUUID string, now time.Time) bool {
+	clientSignMu.Lock()
+	defer clientSignMu.Unlock()
+
+	w, ok := clientSignWindows[userUUID]
+	if !ok || now.Sub(w.start) >= clientSignWindow {
+		clientSignWindows[userUUID] = &signWindow{start: now, count: 1}
+		return true
+	}
+	if w.count >= clientSignLimit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// RunClientSignLimiterCleaner 定期清理过期的限流窗口，直到 ctx 取消
+func RunClientSignLimiterCleaner(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			clientSignMu.Lock()
+			for userUUID, w := range clientSignWindows {
+				if now.Sub(w.start) >= clientSignWindow {
+					delete(clientSignWindows, userUUID)
+				}
+			}
+			clientSignMu.Unlock()
+		}
+	}
+}
+
+// HandleClientSign 用托管钱包私钥签名隧道握手挑战（需要 JWT 鉴权）
+// 邮箱注册的账户没有本地私钥，无法完成签名握手；服务端持有其托管私钥，代为签名
+// 自托管钱包返回 409，客户端应在本地签名。每次签名（包括拒绝）都会记录审计日志
+func HandleClientSign(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		var req ClientSignRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		m := connectChallengePattern.FindStringSubmatch(req.Challenge)
+		if m == nil {
+			log.Printf("🔏 [审计] 拒绝托管签名: UUID=%s, IP=%s, 原因=挑战格式错误", userUUID, c.ClientIP())
+			fail(c, response.CodeBadRequest, "挑战格式错误，期望 uap-connect:<jti>:<timestamp>")
+			return
+		}
+		timestamp, _ := strconv.ParseInt(m[2], 10, 64)
+		if diff := time.Now().Unix() - timestamp; diff > connectChallengeWindow || diff < -connectChallengeWindow {
+			log.Printf("🔏 [审计] 拒绝托管签名: UUID=%s, IP=%s, 原因=时间戳过期 (偏差 %d 秒)", userUUID, c.ClientIP(), diff)
+			fail(c, response.CodeRequestExpired, "挑战时间戳已过期，请校准设备时间")
+			return
+		}
+
+		if !allowClientSign(userUUID, time.Now()) {
+			log.Printf("🔏 [审计] 拒绝托管签名: UUID=%s, IP=%s, 原因=超出频率限制", userUUID, c.ClientIP())
+			fail(c, response.CodeRateLimited, "签名请求过于频繁，请稍后再试")
+			return
+		}
+
+		var user models.User
+		if err := db.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeUserNotFound, "用户不存在")
+				return
+			}
+			log.Printf("❌ 查询用户失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		priv, err := custody.PrivateKey(&user)
+		if err != nil {
+			log.Printf("❌ 读取托管钱包私钥失败: UUID=%s, err=%v", userUUID, err)
+			fail(c, response.CodeServerConfig, "托管钱包私钥不可用")
+			return
+		}
+		if priv == nil {
+			log.Printf("🔏 [审计] 拒绝托管签名: UUID=%s, IP=%s, 原因=自托管钱包", userUUID, c.ClientIP())
+			fail(c, response.CodeSelfCustody, "钱包为自托管，请使用本地私钥签名")
+			return
+		}
+
+		signature := ed25519.Sign(priv, []byte(req.Challenge))
+		log.Printf("🔏 [审计] 托管签名: UUID=%s, IP=%s, Challenge=%s", userUUID, c.ClientIP(), req.Challenge)
+		c.JSON(200, response.Success(ClientSignResponse{
+			Signature: hex.EncodeToString(signature),
+			PublicKey: hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		}))
+	}
+}
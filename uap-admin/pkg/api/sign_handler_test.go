@@ -0,0 +1,126 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/custody"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createCustodialUser 创建邮箱注册的托管钱包用户（托管私钥用临时主密钥加密）
+func createCustodialUser(t testing.TB, db *gorm.DB) (models.User, ed25519.PrivateKey) {
+	t.Helper()
+	master := make([]byte, 32)
+	rand.Read(master)
+	keyring, err := custody.NewKeyring(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custody.Init(keyring)
+	t.Cleanup(func() { custody.Init(nil) })
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userUUID := uuid.New().String()
+	sealed, err := custody.SealPrivateKey(userUUID, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := userUUID + "@uap.test"
+	user := createUser(t, db, models.User{UUID: userUUID, Email: &email, WalletPubKey: hex.EncodeToString(pub), WalletPrivKey: sealed})
+	return user, priv
+}
+
+// connectChallenge 签名握手的挑战：uap-connect:<jti>:<时间戳>
+func connectChallenge(t testing.TB, at time.Time) string {
+	return "uap-connect:" + newNonce(t) + ":" + strconv.FormatInt(at.Unix(), 10)
+}
+
+func TestClientSign(t *testing.T) {
+	db := newTestDB(t)
+	user, priv := createCustodialUser(t, db)
+
+	challenge := connectChallenge(t, time.Now())
+	var data ClientSignResponse
+	_, resp := serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: challenge})
+	decodeData(t, resp, &data)
+
+	if data.PublicKey != user.WalletPubKey {
+		t.Fatalf("签名公钥 %s，期望 %s", data.PublicKey, user.WalletPubKey)
+	}
+	sig, err := hex.DecodeString(data.Signature)
+	if err != nil || !ed25519.Verify(priv.Public().(ed25519.PublicKey), []byte(challenge), sig) {
+		t.Fatal("托管签名无法用钱包公钥验证")
+	}
+}
+
+func TestClientSignRejectsChallenges(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := createCustodialUser(t, db)
+	now := time.Now()
+
+	cases := []struct {
+		name      string
+		challenge string
+		code      response.Code
+	}{
+		{"钱包登录消息", "uap-login:v2:uap-test:" + strconv.FormatInt(now.Unix(), 10) + ":" + newNonce(t), response.CodeBadRequest},
+		{"缺少时间戳", "uap-connect:" + newNonce(t), response.CodeBadRequest},
+		{"jti 不是 Hex", "uap-connect:" + "zz" + newNonce(t)[2:] + ":" + strconv.FormatInt(now.Unix(), 10), response.CodeBadRequest},
+		{"多余后缀", connectChallenge(t, now) + "\nextra", response.CodeBadRequest},
+		{"空挑战", "", response.CodeBadRequest},
+		{"时间戳过期", connectChallenge(t, now.Add(-2*time.Minute)), response.CodeRequestExpired},
+		{"时间戳超前", connectChallenge(t, now.Add(2*time.Minute)), response.CodeRequestExpired},
+	}
+	for _, tc := range cases {
+		if _, resp := serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: tc.challenge}); resp.Code != int(tc.code) {
+			t.Errorf("%s: 响应码 %d，期望 %d", tc.name, resp.Code, tc.code)
+		}
+	}
+}
+
+func TestClientSignSelfCustody(t *testing.T) {
+	db := newTestDB(t)
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	user := createUser(t, db, models.User{WalletPubKey: hex.EncodeToString(pub)})
+
+	// 自托管钱包：服务端不持有私钥，客户端应在本地签名
+	status, resp := serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: connectChallenge(t, time.Now())})
+	if status != 409 || resp.Code != int(response.CodeSelfCustody) {
+		t.Fatalf("自托管钱包返回 %d %d", status, resp.Code)
+	}
+
+	if _, resp := serve(t, HandleClientSign(db), "POST", uuid.New().String(), ClientSignRequest{Challenge: connectChallenge(t, time.Now())}); resp.Code != int(response.CodeUserNotFound) {
+		t.Fatalf("不存在的用户返回 %d", resp.Code)
+	}
+}
+
+func TestClientSignRateLimit(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := createCustodialUser(t, db)
+
+	for i := 0; i < clientSignLimit; i++ {
+		if status, resp := serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: connectChallenge(t, time.Now())}); status != 200 {
+			t.Fatalf("第 %d 次签名失败: %d %s", i+1, resp.Code, resp.Msg)
+		}
+	}
+	if _, resp := serve(t, HandleClientSign(db), "POST", user.UUID, ClientSignRequest{Challenge: connectChallenge(t, time.Now())}); resp.Code != int(response.CodeRateLimited) {
+		t.Fatalf("超出频率限制返回 %d", resp.Code)
+	}
+
+	// 窗口过后恢复
+	if !allowClientSign(user.UUID, time.Now().Add(clientSignWindow)) {
+		t.Fatal("新窗口内仍被限流")
+	}
+}
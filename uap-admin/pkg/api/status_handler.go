@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ClientStatus 客户端定期轮询的账户状态
+type ClientStatus struct {
+	TrafficLimitBytes int64                 `json:"traffic_limit_bytes"` // 0 表示不限
+	TrafficUsedBytes  int64                 `json:"traffic_used_bytes"`
+	Notifications     []models.Notification `json:"notifications"` // 待推送通知（每条只返回一次）
+}
+
+// GetClientStatus 获取账户状态并取走待推送通知（需要 JWT 鉴权）
+func GetClientStatus(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID := c.GetString("user_uuid")
+
+		var user models.User
+		if err := db.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeUserNotFound, "用户不存在")
+				return
+			}
+			log.Printf("❌ 查询用户失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		notifications, err := takePendingNotifications(db, userUUID)
+		if err != nil {
+			log.Printf("❌ 查询通知失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		c.JSON(200, response.Success(ClientStatus{
+			TrafficLimitBytes: user.TrafficLimitBytes,
+			TrafficUsedBytes:  user.TrafficUsedBytes,
+			Notifications:     notifications,
+		}))
+	}
+}
+
+// takePendingNotifications 取走用户的待推送通知并标记为已投递
+// 逐条条件更新 delivered_at，并发轮询时每条通知只会被其中一个请求返回
+func takePendingNotifications(db *gorm.DB, userUUID string) ([]models.Notification, error) {
+	var pending []models.Notification
+	if err := db.Where("user_uuid = ? AND delivered_at IS NULL", userUUID).
+		Order("id").Find(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	taken := make([]models.Notification, 0, len(pending))
+	for _, n := range pending {
+		var claimed int64
+		err := database.Retry(func() error {
+			result := db.Model(&models.Notification{}).
+				Where("id = ? AND delivered_at IS NULL", n.ID).
+				Update("delivered_at", now)
+			claimed = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if claimed == 1 {
+			taken = append(taken, n)
+		}
+	}
+	return taken, nil
+}
@@ -2,28 +2,150 @@ package api
 
 import (
 	"log"
-	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
 
+// MessageResponse 只带提示信息的响应
+type MessageResponse struct {
+	Msg string `json:"msg"`
+}
+
+// HealthResponse 健康检查响应
+type HealthResponse struct {
+	Status string `json:"status"` // 固定为 "ok"
+}
+
+// PublicKeyResponse 系统公钥响应
+type PublicKeyResponse struct {
+	PublicKey string `json:"public_key"` // PEM 格式的 Ed25519 公钥（当前签名密钥）
+	Kid       string `json:"kid"`        // 密钥 ID，与 Token 头部的 kid、JWKS 中的 kid 一致
+	Alg       string `json:"alg"`        // 签名算法，固定为 "EdDSA"
+}
+
+// BuildInfo 构建信息（启动时读取，运行期间不变）
+type BuildInfo struct {
+	Version   string `json:"version"`              // 版本号（-ldflags "-X main.buildVersion=..." 注入，未注入时取模块版本）
+	Commit    string `json:"commit,omitempty"`     // 构建时的 Git 提交
+	BuildTime string `json:"build_time,omitempty"` // 提交时间（RFC3339）
+	Modified  bool   `json:"modified,omitempty"`   // 构建时工作区有未提交的修改
+}
+
+// SigningKeyStatus 签名密钥状态
+type SigningKeyStatus struct {
+	Present bool   `json:"present"`       // 签名密钥已加载
+	Kid     string `json:"kid,omitempty"` // 当前签名密钥的 kid
+}
+
+// SystemInfoResponse 系统信息响应
+type SystemInfoResponse struct {
+	BuildInfo
+	GoVersion     string           `json:"go_version"`
+	StartedAt     int64            `json:"started_at"`     // 启动时间（Unix 秒）
+	UptimeSeconds int64            `json:"uptime_seconds"` // 已运行秒数
+	SigningKey    SigningKeyStatus `json:"signing_key"`
+}
+
+// keyCacheControl 公钥 / JWKS 的缓存策略
+// 密钥只在 uap-admin 重启时变化；轮换时旧公钥会继续发布，节点缓存 5 分钟不会拒绝新旧任一密钥签发的 Token
+const keyCacheControl = "public, max-age=300"
+
+// Health 健康检查（公开接口，无需鉴权）
+func Health() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, response.Success(HealthResponse{Status: "ok"}))
+	}
+}
+
 // GetPublicKey 获取系统公钥（公开接口，无需鉴权）
+// 返回 {"code":200,"data":{"public_key":"-----BEGIN PUBLIC KEY-----\n...","kid":"...","alg":"EdDSA"}}
+// 轮换期间只返回当前签名公钥，需要同时验证旧 Token 的节点请使用 GetJWKS
 func GetPublicKey() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 读取 public_key.pem 文件
-		publicKeyPath := "public_key.pem"
-		publicKeyData, err := os.ReadFile(publicKeyPath)
-		if err != nil {
-			log.Printf("❌ 读取公钥文件失败: %v", err)
-			c.JSON(500, gin.H{
-				"code": 500,
-				"msg":  "公钥文件读取失败",
-			})
+		// 直接返回启动时加载的签名公钥，不依赖 public_key.pem 文件
+		publicKeyPEM := auth.PublicKeyPEM()
+		if publicKeyPEM == "" {
+			fail(c, response.CodeServerConfig, "签名密钥未初始化")
+			return
+		}
+
+		// 响应内容只取决于公钥，kid 即可作为 ETag
+		kid := auth.SigningKeyID()
+		if notModified(c, `"`+kid+`"`) {
+			return
+		}
+		c.JSON(200, response.Success(PublicKeyResponse{PublicKey: publicKeyPEM, Kid: kid, Alg: "EdDSA"}))
+	}
+}
+
+// GetJWKS 获取 JWKS 公钥集合（公开接口，无需鉴权）
+// 返回标准 JWKS 文档 {"keys":[{"kty":"OKP","crv":"Ed25519","x":"...","kid":"...","alg":"EdDSA","use":"sig"}]}（不使用统一响应包装）
+// 第一个为当前签名密钥，其余为轮换期间仍然有效的旧公钥
+func GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc, etag := auth.JWKSDocument()
+		if len(doc) == 0 {
+			fail(c, response.CodeServerConfig, "签名密钥未初始化")
+			return
+		}
+		if notModified(c, etag) {
+			return
+		}
+		c.Data(200, "application/json", doc)
+	}
+}
+
+// GetSystemInfo 系统版本、运行时长与签名密钥状态（排查部署版本不一致等问题）
+// public 为 false 时需要 X-Admin-Secret
+func GetSystemInfo(build BuildInfo, startedAt time.Time, public bool, adminSecrets []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !public && !verifyAdminSecret(c.GetHeader("X-Admin-Secret"), adminSecrets) {
+			fail(c, response.CodeForbidden, "forbidden")
 			return
 		}
 
-		// 以 text/plain 格式返回公钥内容
-		c.Data(200, "text/plain; charset=utf-8", publicKeyData)
+		kid := auth.SigningKeyID()
+		c.JSON(200, response.Success(SystemInfoResponse{
+			BuildInfo:     build,
+			GoVersion:     runtime.Version(),
+			StartedAt:     startedAt.Unix(),
+			UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+			SigningKey:    SigningKeyStatus{Present: auth.PublicKeyPEM() != "", Kid: kid},
+		}))
+	}
+}
+
+// notModified 设置缓存响应头；请求的 If-None-Match 与 etag 一致时回复 304 并返回 true
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", keyCacheControl)
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		if tag = strings.TrimSpace(tag); tag == etag || tag == "*" {
+			c.Status(304)
+			return true
+		}
 	}
+	return false
 }
 
+// NotFound 未匹配到路由时返回统一格式的 404
+func NotFound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fail(c, response.CodeNotFound, "接口不存在")
+	}
+}
+
+// Recovery 捕获 handler panic 并返回统一格式的 500（替代 gin 默认的空响应）
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		log.Printf("❌ 请求处理 panic: %s %s: %v", c.Request.Method, c.Request.URL.Path, recovered)
+		fail(c, response.CodeInternal, "服务器内部错误")
+		c.Abort()
+	})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getWithETag 以 If-None-Match 请求公开接口，返回原始响应
+func getWithETag(handler gin.HandlerFunc, ifNoneMatch string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/", handler)
+	req := httptest.NewRequest("GET", "/", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetJWKS(t *testing.T) {
+	w := getWithETag(GetJWKS(), "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("状态码 %d，Content-Type %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Cache-Control") != keyCacheControl {
+		t.Fatalf("Cache-Control = %q", w.Header().Get("Cache-Control"))
+	}
+	// 标准 JWKS 文档，不使用统一响应包装
+	var doc auth.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Keys) == 0 || doc.Keys[0].Kid != auth.SigningKeyID() {
+		t.Fatalf("JWKS %s", w.Body.String())
+	}
+
+	etag := w.Header().Get("ETag")
+	for _, header := range []string{etag, `"stale", ` + etag, "*"} {
+		if w := getWithETag(GetJWKS(), header); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match: %s 返回 %d (%d 字节)", header, w.Code, w.Body.Len())
+		}
+	}
+	if w := getWithETag(GetJWKS(), `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("过期的 ETag 返回 %d", w.Code)
+	}
+}
+
+func TestGetPublicKey(t *testing.T) {
+	w := getWithETag(GetPublicKey(), "")
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var key PublicKeyResponse
+	decodeData(t, resp, &key)
+	if key.PublicKey != auth.PublicKeyPEM() || key.Kid != auth.SigningKeyID() || key.Alg != "EdDSA" {
+		t.Fatalf("公钥响应 %+v", key)
+	}
+	if w.Header().Get("ETag") != `"`+key.Kid+`"` || w.Header().Get("Cache-Control") != keyCacheControl {
+		t.Fatalf("缓存响应头 %v", w.Header())
+	}
+	if w := getWithETag(GetPublicKey(), `"`+key.Kid+`"`); w.Code != http.StatusNotModified {
+		t.Fatalf("未变化的公钥返回 %d", w.Code)
+	}
+}
+
+func TestGetSystemInfo(t *testing.T) {
+	build := BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildTime: "2026-01-01T00:00:00Z"}
+	startedAt := time.Now().Add(-90 * time.Second)
+	secrets := []string{"admin-secret"}
+
+	req := newRequest(t, "GET", "/", nil)
+	req.Header.Set("X-Admin-Secret", "admin-secret")
+	_, resp := serveRequest(t, GetSystemInfo(build, startedAt, false, secrets), req, "")
+	var info SystemInfoResponse
+	decodeData(t, resp, &info)
+	if info.BuildInfo != build || info.GoVersion != runtime.Version() || info.StartedAt != startedAt.Unix() {
+		t.Fatalf("系统信息 %+v", info)
+	}
+	// 运行时长与启动时间一致（允许测试本身的耗时）
+	if info.UptimeSeconds < 90 || info.UptimeSeconds > 95 {
+		t.Fatalf("运行时长 %d 秒，期望约 90 秒", info.UptimeSeconds)
+	}
+	if !info.SigningKey.Present || info.SigningKey.Kid != auth.SigningKeyID() {
+		t.Fatalf("签名密钥状态 %+v", info.SigningKey)
+	}
+	// 字段名是对外约定
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"version", "commit", "build_time", "go_version", "started_at", "uptime_seconds", "signing_key"} {
+		if _, ok := raw[field]; !ok {
+			t.Errorf("响应缺少字段 %s: %s", field, resp.Data)
+		}
+	}
+}
+
+func TestGetSystemInfoGuard(t *testing.T) {
+	secrets := []string{"admin-secret"}
+	for _, secret := range []string{"", "wrong"} {
+		req := newRequest(t, "GET", "/", nil)
+		if secret != "" {
+			req.Header.Set("X-Admin-Secret", secret)
+		}
+		if _, resp := serveRequest(t, GetSystemInfo(BuildInfo{}, time.Now(), false, secrets), req, ""); resp.Code != int(response.CodeForbidden) {
+			t.Errorf("管理员密钥 %q 返回 %d，期望 %d", secret, resp.Code, response.CodeForbidden)
+		}
+	}
+	// 配置为公开时无需管理员密钥
+	_, resp := serve(t, GetSystemInfo(BuildInfo{Version: "dev"}, time.Now(), true, secrets), "GET", "", nil)
+	var info SystemInfoResponse
+	decodeData(t, resp, &info)
+	if info.Version != "dev" || info.UptimeSeconds != 0 {
+		t.Fatalf("公开的系统信息 %+v", info)
+	}
+}
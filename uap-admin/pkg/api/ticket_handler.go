@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ConnectTicketRequest 连接票据请求
+type ConnectTicketRequest struct {
+	Address string `json:"address" binding:"required"` // 即将连接的节点地址 e.g. "uaptest.org:52222"
+	Signed  bool   `json:"signed"`                     // 签名握手：票据绑定账户钱包公钥，节点要求握手时附带钱包签名
+	Sticky  bool   `json:"sticky"`                     // 粘性选路：把账户固定到该节点，之后的节点列表优先返回它
+}
+
+// ConnectTicketResponse 连接票据响应
+type ConnectTicketResponse struct {
+	Ticket    string `json:"ticket"`     // 短期连接票据（替代 JWT 在隧道握手中出示）
+	ExpiresAt int64  `json:"expires_at"` // 过期时间（Unix 秒）
+}
+
+// HandleConnectTicket 用用户 JWT 换取绑定到指定节点的短期连接票据（需要 JWT 鉴权）
+// 客户端在拨号前调用，避免 7 天有效期的 JWT 出现在隧道握手中
+func HandleConnectTicket(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ConnectTicketRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		// 查找在线且不在维护模式的节点，票据绑定到该节点的公钥
+		var node models.Node
+		if err := db.Where("address = ? AND status = ? AND draining = ?", req.Address, 1, false).First(&node).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeNodeNotFound, "节点不存在、已下线或正在维护")
+				return
+			}
+			log.Printf("❌ 查询节点失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		fingerprint, err := auth.KeyFingerprint(node.PublicKey)
+		if err != nil {
+			log.Printf("❌ 节点公钥无效: Address=%s, err=%v", node.Address, err)
+			fail(c, response.CodeServerConfig, "节点公钥无效")
+			return
+		}
+
+		userUUID := c.GetString("user_uuid")
+
+		// 流量已用尽时不再签发票据（不限流量时 traffic_limit_bytes 为 0）
+		var user models.User
+		if err := db.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeUserNotFound, "用户不存在")
+				return
+			}
+			log.Printf("❌ 查询用户失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+		if user.TrafficLimitBytes > 0 && user.TrafficUsedBytes >= user.TrafficLimitBytes {
+			log.Printf("⛔ 流量已用尽，拒绝签发票据: UUID=%s, 已用 %d / %d 字节", userUUID, user.TrafficUsedBytes, user.TrafficLimitBytes)
+			fail(c, response.CodeQuotaExceeded, "本计费周期流量已用尽")
+			return
+		}
+
+		// 签名握手要求账户已有钱包（托管钱包可通过 /client/sign 签名）
+		walletPubKey := ""
+		if req.Signed {
+			if user.WalletPubKey == "" {
+				fail(c, response.CodeBadRequest, "账户未绑定钱包，无法使用签名握手")
+				return
+			}
+			walletPubKey = user.WalletPubKey
+		}
+
+		ticket, expiresAt, err := auth.GenerateConnectTicket(userUUID, fingerprint, walletPubKey)
+		if err != nil {
+			log.Printf("❌ 连接票据生成失败: %v", err)
+			fail(c, response.CodeInternal, "票据生成失败")
+			return
+		}
+
+		// 固定节点写入失败不影响签发票据
+		if req.Sticky {
+			if err := recordNodePin(db, user, node.ID, time.Now()); err != nil {
+				log.Printf("⚠️  记录固定节点失败: UUID=%s, err=%v", userUUID, err)
+			}
+		}
+
+		log.Printf("🎫 签发连接票据: UUID=%s, Node=%s, Signed=%v, Sticky=%v", userUUID, node.Address, req.Signed, req.Sticky)
+		c.JSON(200, response.Success(ConnectTicketResponse{
+			Ticket:    ticket,
+			ExpiresAt: expiresAt.Unix(),
+		}))
+	}
+}
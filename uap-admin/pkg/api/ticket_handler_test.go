@@ -0,0 +1,89 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestConnectTicket(t *testing.T) {
+	db := newTestDB(t)
+	node := models.Node{Address: "node.test:52222", Status: 1, PublicKey: newNodeKeyPEM(t)}
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := createUser(t, db, models.User{WalletPubKey: "aabb"})
+	fingerprint, _ := auth.KeyFingerprint(node.PublicKey)
+
+	claimsOf := func(req ConnectTicketRequest) jwt.MapClaims {
+		t.Helper()
+		_, resp := serve(t, HandleConnectTicket(db), "POST", user.UUID, req)
+		var ticket ConnectTicketResponse
+		decodeData(t, resp, &ticket)
+		token, err := jwt.Parse(ticket.Ticket, auth.Keyfunc)
+		if err != nil {
+			t.Fatalf("票据验签失败: %v", err)
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		exp, _ := claims.GetExpirationTime()
+		if exp == nil || exp.Unix() != ticket.ExpiresAt || time.Until(exp.Time) > auth.ConnectTicketTTL {
+			t.Fatalf("过期时间 %v，响应 %d", exp, ticket.ExpiresAt)
+		}
+		return claims
+	}
+
+	first := claimsOf(ConnectTicketRequest{Address: node.Address})
+	if first["typ"] != "connect" || first["uuid"] != user.UUID || first["nod"] != fingerprint {
+		t.Fatalf("票据声明 %v", first)
+	}
+	if _, ok := first["wpk"]; ok {
+		t.Fatal("未要求签名握手的票据不应带钱包公钥")
+	}
+
+	// 每张票据的 jti 不同，节点据此拒绝重放
+	second := claimsOf(ConnectTicketRequest{Address: node.Address})
+	if first["jti"] == "" || first["jti"] == second["jti"] {
+		t.Fatalf("票据 ID 重复: %v / %v", first["jti"], second["jti"])
+	}
+
+	if signed := claimsOf(ConnectTicketRequest{Address: node.Address, Signed: true}); signed["wpk"] != "aabb" {
+		t.Fatalf("签名握手票据的钱包公钥 %v", signed["wpk"])
+	}
+}
+
+func TestConnectTicketRejected(t *testing.T) {
+	db := newTestDB(t)
+	online := models.Node{Address: "online.test:52222", Status: 1, PublicKey: newNodeKeyPEM(t)}
+	draining := models.Node{Address: "draining.test:52222", Status: 1, Draining: true, PublicKey: newNodeKeyPEM(t)}
+	offline := models.Node{Address: "offline.test:52222", Status: 0, PublicKey: newNodeKeyPEM(t)}
+	for _, node := range []*models.Node{&online, &draining, &offline} {
+		if err := db.Create(node).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := createUser(t, db, models.User{})
+	exhausted := createUser(t, db, models.User{WalletPubKey: "exhausted", TrafficLimitBytes: 100, TrafficUsedBytes: 100})
+
+	cases := []struct {
+		name string
+		user string
+		req  ConnectTicketRequest
+		want response.Code
+	}{
+		{"维护中的节点", user.UUID, ConnectTicketRequest{Address: draining.Address}, response.CodeNodeNotFound},
+		{"下线的节点", user.UUID, ConnectTicketRequest{Address: offline.Address}, response.CodeNodeNotFound},
+		{"未知节点", user.UUID, ConnectTicketRequest{Address: "unknown:1"}, response.CodeNodeNotFound},
+		{"流量用尽", exhausted.UUID, ConnectTicketRequest{Address: online.Address}, response.CodeQuotaExceeded},
+		{"没有钱包的签名握手", user.UUID, ConnectTicketRequest{Address: online.Address, Signed: true}, response.CodeBadRequest},
+	}
+	for _, tc := range cases {
+		if _, resp := serve(t, HandleConnectTicket(db), "POST", tc.user, tc.req); resp.Code != int(tc.want) {
+			t.Errorf("%s: 响应码 %d，期望 %d", tc.name, resp.Code, tc.want)
+		}
+	}
+}
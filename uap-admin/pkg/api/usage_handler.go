@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"uap-admin/pkg/billing"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxUsageDays 用量历史最多查询天数
+const maxUsageDays = 365
+
+// UsageView 用量历史
+type UsageView struct {
+	PeriodStart       *time.Time           `json:"period_start"` // 当前计费周期开始时间
+	PeriodEnd         *time.Time           `json:"period_end"`   // 当前计费周期结束时间（下次重置）
+	TrafficLimitBytes int64                `json:"traffic_limit_bytes"`
+	TrafficUsedBytes  int64                `json:"traffic_used_bytes"`
+	Daily             []billing.DailyUsage `json:"daily"`   // 最近 N 天每日流量（UTC）
+	Periods           []models.UsagePeriod `json:"periods"` // 最近结束的计费周期（最多 12 个）
+}
+
+// GetMyUsage 获取当前用户的用量历史（需要 JWT 鉴权）
+// 查询参数 days: 每日流量的天数（默认 30，最多 365）
+func GetMyUsage(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 1 || days > maxUsageDays {
+			fail(c, response.CodeBadRequest, "参数错误: days 取值范围 1-365")
+			return
+		}
+
+		userUUID := c.GetString("user_uuid")
+		var user models.User
+		if err := db.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, response.CodeUserNotFound, "用户不存在")
+				return
+			}
+			log.Printf("❌ 查询用户失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		daily, err := billing.DailySeries(db, userUUID, days, time.Now())
+		if err != nil {
+			log.Printf("❌ 查询每日用量失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		var periods []models.UsagePeriod
+		if err := db.Where("user_uuid = ?", userUUID).
+			Order("period_start DESC").Limit(12).Find(&periods).Error; err != nil {
+			log.Printf("❌ 查询历史周期失败: %v", err)
+			fail(c, response.CodeDatabase, "数据库错误")
+			return
+		}
+
+		view := UsageView{
+			PeriodStart:       user.PeriodStart,
+			TrafficLimitBytes: user.TrafficLimitBytes,
+			TrafficUsedBytes:  user.TrafficUsedBytes,
+			Daily:             daily,
+			Periods:           periods,
+		}
+		if end, ok := billing.PeriodEnd(user); ok {
+			view.PeriodEnd = &end
+		}
+		c.JSON(200, response.Success(view))
+	}
+}
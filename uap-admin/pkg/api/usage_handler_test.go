@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+)
+
+func TestGetMyUsage(t *testing.T) {
+	db := newTestDB(t)
+	created := time.Now().UTC().AddDate(0, -1, 0).Add(-time.Hour)
+	user := createUser(t, db, models.User{TrafficLimitBytes: 1000, CreatedAt: created})
+	if _, err := addTrafficUsage(db, user.UUID, 120, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var view UsageView
+	_, resp := serveRequest(t, GetMyUsage(db), newRequest(t, "GET", "/?days=7", nil), user.UUID)
+	decodeData(t, resp, &view)
+	if len(view.Daily) != 7 || view.Daily[6].Bytes != 120 || view.TrafficUsedBytes != 120 {
+		t.Fatalf("用量历史 %+v", view)
+	}
+	// 当前周期的结束时间即下一个周期的开始时间
+	if view.PeriodStart == nil || view.PeriodEnd == nil || !view.PeriodEnd.After(*view.PeriodStart) {
+		t.Fatalf("当前周期 %v - %v", view.PeriodStart, view.PeriodEnd)
+	}
+
+	for _, query := range []string{"/?days=0", "/?days=366", "/?days=x"} {
+		if _, resp := serveRequest(t, GetMyUsage(db), newRequest(t, "GET", query, nil), user.UUID); resp.Code != int(response.CodeBadRequest) {
+			t.Errorf("%s: 响应码 %d", query, resp.Code)
+		}
+	}
+}
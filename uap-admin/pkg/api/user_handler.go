@@ -0,0 +1,46 @@
+package api
+
+import (
+	"log"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserListResponse 用户列表（按注册时间倒序的一页）
+type UserListResponse struct {
+	Users      []models.User `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"` // 下一页的 cursor 参数，没有下一页时省略
+}
+
+// GetUserList 分页查询用户（管理员接口）
+// 查询参数 limit（默认 50，最多 500）、cursor（上一页的 next_cursor）或 offset（小表兼容用法），见 pageParams
+func GetUserList(db *gorm.DB, adminSecrets []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !verifyAdminSecret(c.GetHeader("X-Admin-Secret"), adminSecrets) {
+			log.Printf("❌ 管理员密钥错误，拒绝查询用户")
+			fail(c, response.CodeForbidden, "forbidden")
+			return
+		}
+		page, ok := parsePage(c)
+		if !ok {
+			return
+		}
+
+		var users []models.User
+		if err := page.apply(db.Model(&models.User{}), "users").Find(&users).Error; err != nil {
+			log.Printf("查询用户失败: %v", err)
+			fail(c, response.CodeDatabase, "查询用户失败")
+			return
+		}
+		ids := make([]uint, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		n, next := page.trim(ids)
+		c.JSON(200, response.Success(UserListResponse{Users: users[:n], NextCursor: next}))
+	}
+}
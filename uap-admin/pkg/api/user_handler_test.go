@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+
+	"gorm.io/gorm"
+)
+
+// listUsers 以管理员身份请求一页用户，query 为查询字符串（不含 ?）
+func listUsers(t testing.TB, db *gorm.DB, query string) testResponse {
+	t.Helper()
+	req := newRequest(t, "GET", "/?"+query, nil)
+	req.Header.Set("X-Admin-Secret", "admin-secret")
+	_, resp := serveRequest(t, GetUserList(db, []string{"admin-secret"}), req, "")
+	return resp
+}
+
+// createUsers 依次创建 n 个用户（id 递增）
+func createUsers(t testing.TB, db *gorm.DB, n int) []models.User {
+	t.Helper()
+	users := make([]models.User, n)
+	for i := range users {
+		users[i] = createUser(t, db, models.User{WalletPubKey: fmt.Sprintf("wallet-%d", i)})
+	}
+	return users
+}
+
+// TestUserListCursor 游标分页在两次请求之间插入新用户时，后面的页既不重复也不遗漏
+func TestUserListCursor(t *testing.T) {
+	db := newTestDB(t)
+	existing := createUsers(t, db, 7)
+
+	seen := make(map[uint]bool)
+	cursor := ""
+	pages := 0
+	for {
+		query := "limit=3"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		var page UserListResponse
+		decodeData(t, listUsers(t, db, query), &page)
+		pages++
+		for i, u := range page.Users {
+			if seen[u.ID] {
+				t.Fatalf("第 %d 页重复返回用户 %d", pages, u.ID)
+			}
+			seen[u.ID] = true
+			if i > 0 && u.ID >= page.Users[i-1].ID {
+				t.Fatalf("第 %d 页未按 id 倒序: %d 在 %d 之后", pages, u.ID, page.Users[i-1].ID)
+			}
+		}
+		// 翻页期间注册的新用户排在第一页之前，不影响后面的页
+		createUser(t, db, models.User{WalletPubKey: fmt.Sprintf("late-%d", pages)})
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if pages != 3 || len(seen) != len(existing) {
+		t.Fatalf("%d 页共 %d 个用户，期望 3 页 %d 个", pages, len(seen), len(existing))
+	}
+	for _, u := range existing {
+		if !seen[u.ID] {
+			t.Fatalf("遗漏了用户 %d", u.ID)
+		}
+	}
+}
+
+// TestUserListOffset 不带游标时可用 offset 翻页（小表兼容用法）
+func TestUserListOffset(t *testing.T) {
+	db := newTestDB(t)
+	users := createUsers(t, db, 5)
+
+	var page UserListResponse
+	decodeData(t, listUsers(t, db, "limit=2&offset=2"), &page)
+	if len(page.Users) != 2 || page.Users[0].ID != users[2].ID || page.Users[1].ID != users[1].ID || page.NextCursor == "" {
+		t.Fatalf("offset 分页 %+v", page)
+	}
+	// 最后一页没有 next_cursor
+	var last UserListResponse
+	decodeData(t, listUsers(t, db, "limit=5"), &last)
+	if len(last.Users) != 5 || last.NextCursor != "" {
+		t.Fatalf("最后一页 %d 个用户，next_cursor %q", len(last.Users), last.NextCursor)
+	}
+}
+
+func TestUserListParams(t *testing.T) {
+	db := newTestDB(t)
+	for _, query := range []string{
+		"limit=0",
+		"limit=501",
+		"limit=abc",
+		"offset=-1",
+		"cursor=not-a-cursor",
+		"cursor=" + encodeCursor(3) + "&offset=1",
+	} {
+		if resp := listUsers(t, db, query); resp.Code != int(response.CodeBadRequest) {
+			t.Errorf("%s: 响应码 %d，期望参数错误", query, resp.Code)
+		}
+	}
+
+	req := newRequest(t, "GET", "/", nil)
+	if _, resp := serveRequest(t, GetUserList(db, []string{"admin-secret"}), req, ""); resp.Code != int(response.CodeForbidden) {
+		t.Fatalf("缺少管理员密钥: 响应码 %d", resp.Code)
+	}
+}
+
+func TestCursorEncoding(t *testing.T) {
+	if id, ok := decodeCursor(encodeCursor(42)); !ok || id != 42 {
+		t.Fatalf("游标往返 %d, %v", id, ok)
+	}
+	for _, cursor := range []string{"", "!!!", encodeCursor(0), "aWQ6eA"} { // "id:x"
+		if _, ok := decodeCursor(cursor); ok {
+			t.Errorf("无效游标 %q 被接受", cursor)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientVersionHeader 客户端在每个请求中携带的版本号请求头
+const ClientVersionHeader = "X-UAP-Client-Version"
+
+// VersionPolicy 客户端版本策略
+type VersionPolicy struct {
+	MinClientVersion version.Semver // 最低可用版本，低于该版本的请求返回 426
+	LatestVersion    version.Semver // 最新版本，用于提示可选升级
+	UpgradeURL       string         // 升级下载地址
+}
+
+// ClientVersionInfo 客户端版本信息响应
+type ClientVersionInfo struct {
+	MinClientVersion string `json:"min_client_version"`
+	LatestVersion    string `json:"latest_version"`
+	UpgradeURL       string `json:"upgrade_url"`
+	UpgradeRequired  bool   `json:"upgrade_required"` // 请求携带的版本低于最低要求
+	UpdateAvailable  bool   `json:"update_available"` // 请求携带的版本低于最新版本
+}
+
+// info 根据请求携带的版本号生成版本信息（未携带版本号时两个标志均为 false）
+func (p VersionPolicy) info(clientVersion string) ClientVersionInfo {
+	info := ClientVersionInfo{
+		MinClientVersion: p.MinClientVersion.String(),
+		LatestVersion:    p.LatestVersion.String(),
+		UpgradeURL:       p.UpgradeURL,
+	}
+	if clientVersion == "" {
+		return info
+	}
+
+	v, err := version.Parse(clientVersion)
+	if err != nil {
+		// 无法解析的版本号按过低处理，让客户端走升级流程
+		info.UpgradeRequired = true
+		info.UpdateAvailable = true
+		return info
+	}
+	info.UpgradeRequired = version.Compare(v, p.MinClientVersion) < 0
+	info.UpdateAvailable = version.Compare(v, p.LatestVersion) < 0
+	return info
+}
+
+// GetClientVersion 获取客户端版本要求（公开接口，不受版本门槛限制）
+func GetClientVersion(policy VersionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, response.Success(policy.info(c.GetHeader(ClientVersionHeader))))
+	}
+}
+
+// VersionGateMiddleware 客户端最低版本门槛
+// 携带的版本号低于最低要求时返回 426（错误码 42601），data 中附带升级信息，客户端据此展示升级页面
+// 未携带版本号的请求（旧版客户端、调试工具）直接放行
+func VersionGateMiddleware(policy VersionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientVersion := c.GetHeader(ClientVersionHeader)
+		if clientVersion == "" {
+			c.Next()
+			return
+		}
+
+		info := policy.info(clientVersion)
+		if info.UpgradeRequired {
+			log.Printf("[版本] 客户端版本过低: %s < %s, path=%s", clientVersion, info.MinClientVersion, c.Request.URL.Path)
+			msg := fmt.Sprintf("客户端版本过低，请升级到 %s 及以上", info.MinClientVersion)
+			c.JSON(response.CodeUpgradeRequired.Status(), response.ErrorWithData(response.CodeUpgradeRequired, msg, info))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testVersionPolicy 最低 1.2.0、最新 1.5.0
+func testVersionPolicy(t testing.TB) VersionPolicy {
+	t.Helper()
+	min, _ := version.Parse("1.2.0")
+	latest, _ := version.Parse("1.5.0")
+	return VersionPolicy{MinClientVersion: min, LatestVersion: latest, UpgradeURL: "https://example.com/download"}
+}
+
+func TestGetClientVersion(t *testing.T) {
+	handler := GetClientVersion(testVersionPolicy(t))
+	cases := []struct {
+		version           string
+		required, updates bool
+	}{
+		{"", false, false}, // 未携带版本号
+		{"1.1.9", true, true},
+		{"1.2.0-beta.1", true, true},
+		{"1.2.0", false, true},
+		{"1.5.0", false, false},
+		{"garbage", true, true}, // 无法解析按过低处理
+	}
+	for _, tc := range cases {
+		req := newRequest(t, "GET", "/", nil)
+		if tc.version != "" {
+			req.Header.Set(ClientVersionHeader, tc.version)
+		}
+		var info ClientVersionInfo
+		_, resp := serveRequest(t, handler, req, "")
+		decodeData(t, resp, &info)
+		if info.UpgradeRequired != tc.required || info.UpdateAvailable != tc.updates {
+			t.Errorf("版本 %q: %+v", tc.version, info)
+		}
+		if info.MinClientVersion != "1.2.0" || info.UpgradeURL == "" {
+			t.Errorf("版本信息 %+v", info)
+		}
+	}
+}
+
+func TestVersionGateMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(VersionGateMiddleware(testVersionPolicy(t)))
+	r.GET("/", func(c *gin.Context) { c.JSON(200, response.Success("ok")) })
+
+	for v, wantStatus := range map[string]int{"": 200, "1.2.0": 200, "1.1.0": 426} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if v != "" {
+			req.Header.Set(ClientVersionHeader, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != wantStatus {
+			t.Errorf("版本 %q: HTTP %d，期望 %d", v, w.Code, wantStatus)
+		}
+	}
+}
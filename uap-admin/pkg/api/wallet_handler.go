@@ -1,27 +1,59 @@
 package api
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"uap-admin/pkg/auth"
+	"uap-admin/pkg/database"
 	"uap-admin/pkg/models"
 	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// 钱包登录签名消息版本
+const (
+	WalletMessageV1 = 1 // uap-login:<timestamp>（旧格式，没有域隔离，签名可能被挪用到其他使用相同方案的服务）
+	WalletMessageV2 = 2 // uap-login|v2|<domain>|<timestamp>|<nonce>
+)
+
+// walletNonceTTL 已使用 nonce 的保留时间（覆盖时间戳前后各 5 分钟的窗口）
+const walletNonceTTL = 10 * time.Minute
+
+// walletNonceCache 已使用的 (公钥, nonce)，同一签名在时间窗口内不能重复登录
+var walletNonceCache sync.Map
+
+// WalletLoginPolicy 钱包登录签名消息策略
+type WalletLoginPolicy struct {
+	Domain    string // 服务身份，写入 v2 签名消息
+	RequireV2 bool   // 只接受 v2 消息（客户端全部升级后开启）
+}
+
+// WalletLoginParamsResponse 钱包登录签名参数
+type WalletLoginParamsResponse struct {
+	Version        int    `json:"version"`         // 应使用的消息版本
+	Domain         string `json:"domain"`          // 写入签名消息的服务身份
+	ServerTime     int64  `json:"server_time"`     // 服务端当前 Unix 时间（秒），客户端可据此校正时间戳
+	LegacyAccepted bool   `json:"legacy_accepted"` // 是否仍接受 v1 消息
+}
+
 // WalletLoginRequest 钱包登录请求
 type WalletLoginRequest struct {
-	PublicKey string `json:"public_key" binding:"required"` // Hex 编码的公钥
-	Signature string `json:"signature" binding:"required"`   // Hex 编码的签名
-	Timestamp int64  `json:"timestamp" binding:"required"`    // Unix 时间戳（秒）
+	PublicKey string `json:"public_key" binding:"required"`                       // Hex 编码的公钥
+	Signature string `json:"signature" binding:"required"`                        // Hex 编码的签名
+	Timestamp int64  `json:"timestamp" binding:"required"`                        // Unix 时间戳（秒）
+	Version   int    `json:"version" binding:"omitempty,oneof=1 2"`               // 签名消息版本，不传为 v1
+	Nonce     string `json:"nonce" binding:"omitempty,hexadecimal,min=16,max=64"` // v2 必填，客户端生成的随机 Hex 串
 }
 
 // WalletLoginResponse 钱包登录响应
@@ -30,53 +62,64 @@ type WalletLoginResponse struct {
 	UUID  string `json:"uuid"`  // 用户 UUID
 }
 
+// walletLoginMessage 构造钱包登录签名消息
+func walletLoginMessage(version int, domain string, timestamp int64, nonce string) string {
+	if version == WalletMessageV2 {
+		return fmt.Sprintf("uap-login|v2|%s|%d|%s", domain, timestamp, nonce)
+	}
+	return fmt.Sprintf("uap-login:%d", timestamp)
+}
+
+// GetWalletLoginParams 获取钱包登录签名参数（公开接口，无需鉴权）
+func GetWalletLoginParams(policy WalletLoginPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, response.Success(WalletLoginParamsResponse{
+			Version:        WalletMessageV2,
+			Domain:         policy.Domain,
+			ServerTime:     time.Now().Unix(),
+			LegacyAccepted: !policy.RequireV2,
+		}))
+	}
+}
+
 // HandleWalletLogin 处理钱包登录/注册
-func HandleWalletLogin(db *gorm.DB) gin.HandlerFunc {
+func HandleWalletLogin(db *gorm.DB, policy WalletLoginPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req WalletLoginRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, response.Error(400, fmt.Sprintf("参数错误: %v", err)))
+		if !bindJSON(c, &req) {
 			return
 		}
 
-		// 1. 解析公钥（Hex -> Bytes）
-		publicKeyBytes, err := hex.DecodeString(req.PublicKey)
-		if err != nil {
-			c.JSON(400, response.Error(400, "公钥格式错误（必须是 Hex 编码）"))
+		// 1. 防重放攻击：检查时间戳
+		if ok, timeDiff := checkTimestamp(req.Timestamp); !ok {
+			fail(c, response.CodeRequestExpired, fmt.Sprintf("请求已过期（时间差 %d 秒，最大允许 300 秒）", timeDiff))
 			return
 		}
 
-		// 验证公钥长度（Ed25519 公钥固定 32 字节）
-		if len(publicKeyBytes) != ed25519.PublicKeySize {
-			c.JSON(400, response.Error(400, fmt.Sprintf("公钥长度错误（期望 %d 字节，实际 %d 字节）", ed25519.PublicKeySize, len(publicKeyBytes))))
-			return
+		// 2. 消息版本：v2 带服务身份与 nonce，开启 RequireV2 后拒绝旧格式
+		msgVersion := req.Version
+		if msgVersion == 0 {
+			msgVersion = WalletMessageV1
 		}
-
-		// 2. 防重放攻击：检查时间戳
-		now := time.Now().Unix()
-		timeDiff := now - req.Timestamp
-		if timeDiff < 0 {
-			timeDiff = -timeDiff
+		if msgVersion == WalletMessageV1 && policy.RequireV2 {
+			fail(c, response.CodeMessageVersionUnsupported, "签名消息格式已停用，请升级客户端使用 v2 格式")
+			return
 		}
-		if timeDiff > 300 { // 5 分钟 = 300 秒
-			c.JSON(401, response.Error(401, fmt.Sprintf("请求已过期（时间差 %d 秒，最大允许 300 秒）", timeDiff)))
+		if msgVersion == WalletMessageV2 && req.Nonce == "" {
+			fail(c, response.CodeBadRequest, "v2 签名消息缺少 nonce")
 			return
 		}
 
-		// 3. 验签：验证签名是否合法
-		signatureBytes, err := hex.DecodeString(req.Signature)
-		if err != nil {
-			c.JSON(400, response.Error(400, "签名格式错误（必须是 Hex 编码）"))
+		// 3. 验签：服务端按自己的身份构造消息，为其他服务生成的签名无法通过
+		message := walletLoginMessage(msgVersion, policy.Domain, req.Timestamp, req.Nonce)
+		if code, msg := verifyWalletSignature(req.PublicKey, req.Signature, []byte(message)); code != 0 {
+			fail(c, code, msg)
 			return
 		}
-
-		// 构造签名消息：uap-login:timestamp
-		message := fmt.Sprintf("uap-login:%d", req.Timestamp)
-		messageBytes := []byte(message)
-
-		// 使用 Ed25519 验证签名
-		if !ed25519.Verify(publicKeyBytes, messageBytes, signatureBytes) {
-			c.JSON(401, response.Error(401, "签名验证失败"))
+		if msgVersion == WalletMessageV1 {
+			log.Printf("⚠️ 旧版钱包登录消息 (v1): pubkey=%s", utils.Fingerprint(req.PublicKey))
+		} else if _, used := walletNonceCache.LoadOrStore(req.PublicKey+"|"+req.Nonce, time.Now().Add(walletNonceTTL)); used {
+			fail(c, response.CodeNonceReused, "nonce 已使用，请重新签名")
 			return
 		}
 
@@ -84,7 +127,7 @@ func HandleWalletLogin(db *gorm.DB) gin.HandlerFunc {
 		publicKeyHex := req.PublicKey // 使用 Hex 字符串存储，便于查询
 		var user models.User
 
-		err = db.Where("wallet_pub_key = ?", publicKeyHex).First(&user).Error
+		err := db.Where("wallet_pub_key = ?", publicKeyHex).First(&user).Error
 		if err != nil {
 			// 判断错误类型
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -93,35 +136,35 @@ func HandleWalletLogin(db *gorm.DB) gin.HandlerFunc {
 				user = models.User{
 					UUID:          newUUID,
 					WalletPubKey:  publicKeyHex,
-					WalletPrivKey: "", // 私钥登录时，私钥在用户自己手里，不存储
+					WalletPrivKey: "",  // 私钥登录时，私钥在用户自己手里，不存储
 					Email:         nil, // 钱包登录不设置邮箱（nil 表示 NULL）
 					GoogleID:      nil, // 钱包登录不设置 Google ID（nil 表示 NULL）
 				}
 
-				if err := db.Create(&user).Error; err != nil {
+				if err := database.Retry(func() error { return db.Create(&user).Error }); err != nil {
 					log.Printf("❌ 创建用户失败: %v", err)
-					c.JSON(500, response.Error(500, "用户注册失败"))
+					fail(c, response.CodeDatabase, "用户注册失败")
 					return
 				}
 
 				// 使用友好的日志信息，避免 "record not found" 噪音
-				log.Printf("[INFO] 新用户注册: pubkey=%s, uuid=%s", publicKeyHex, newUUID)
+				log.Printf("[INFO] 新用户注册: pubkey=%s, uuid=%s", utils.Fingerprint(publicKeyHex), newUUID)
 			} else {
 				// 其他数据库错误（如连接断开等），返回 500
 				log.Printf("❌ 数据库查询错误: %v", err)
-				c.JSON(500, response.Error(500, "数据库错误"))
+				fail(c, response.CodeDatabase, "数据库错误")
 				return
 			}
 		} else {
 			// 用户已存在，正常登录
-			log.Printf("✅ 用户登录: UUID=%s, PublicKey=%s", user.UUID, publicKeyHex)
+			log.Printf("✅ 用户登录: UUID=%s, PublicKey=%s", user.UUID, utils.Fingerprint(publicKeyHex))
 		}
 
 		// 5. 生成 JWT Token
 		token, err := auth.GenerateToken(user.UUID)
 		if err != nil {
 			log.Printf("❌ JWT 生成失败: %v", err)
-			c.JSON(500, response.Error(500, "Token 生成失败"))
+			fail(c, response.CodeInternal, "Token 生成失败")
 			return
 		}
 
@@ -133,3 +176,58 @@ func HandleWalletLogin(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// RunWalletNonceCleaner 定期清理过期的已使用 nonce，直到 ctx 取消
+func RunWalletNonceCleaner(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			walletNonceCache.Range(func(key, value interface{}) bool {
+				if now.After(value.(time.Time)) {
+					walletNonceCache.Delete(key)
+				}
+				return true
+			})
+		}
+	}
+}
+
+// checkTimestamp 防重放攻击：检查时间戳是否在 5 分钟窗口内
+// 返回是否通过以及实际时间差（秒）
+func checkTimestamp(timestamp int64) (bool, int64) {
+	timeDiff := time.Now().Unix() - timestamp
+	if timeDiff < 0 {
+		timeDiff = -timeDiff
+	}
+	return timeDiff <= 300, timeDiff // 5 分钟 = 300 秒
+}
+
+// verifyWalletSignature 校验 Hex 编码的 Ed25519 公钥和签名
+// 校验通过返回 (0, "")，否则返回错误码和错误信息
+func verifyWalletSignature(publicKeyHex, signatureHex string, message []byte) (response.Code, string) {
+	// 解析公钥（Hex -> Bytes）
+	publicKeyBytes, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return response.CodeInvalidPublicKey, "公钥格式错误（必须是 Hex 编码）"
+	}
+
+	// 验证公钥长度（Ed25519 公钥固定 32 字节）
+	if len(publicKeyBytes) != ed25519.PublicKeySize {
+		return response.CodeInvalidPublicKey, fmt.Sprintf("公钥长度错误（期望 %d 字节，实际 %d 字节）", ed25519.PublicKeySize, len(publicKeyBytes))
+	}
+
+	signatureBytes, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return response.CodeInvalidSignature, "签名格式错误（必须是 Hex 编码）"
+	}
+
+	// 使用 Ed25519 验证签名
+	if !ed25519.Verify(publicKeyBytes, message, signatureBytes) {
+		return response.CodeSignatureMismatch, "签名验证失败"
+	}
+
+	return 0, ""
+}
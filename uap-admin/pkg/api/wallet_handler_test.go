@@ -0,0 +1,148 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/response"
+)
+
+// testWallet 测试钱包
+type testWallet struct {
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newTestWallet(t testing.TB) testWallet {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testWallet{pub: pub, priv: priv}
+}
+
+// login 按 version 格式对 domain 签名的登录请求
+func (w testWallet) login(version int, domain string, ts int64, nonce string) WalletLoginRequest {
+	message := walletLoginMessage(version, domain, ts, nonce)
+	return WalletLoginRequest{
+		PublicKey: hex.EncodeToString(w.pub),
+		Signature: hex.EncodeToString(ed25519.Sign(w.priv, []byte(message))),
+		Timestamp: ts,
+		Version:   version,
+		Nonce:     nonce,
+	}
+}
+
+func TestWalletLoginMessageFormat(t *testing.T) {
+	if got := walletLoginMessage(WalletMessageV2, "uap-admin", 1700000000, "00ff"); got != "uap-login|v2|uap-admin|1700000000|00ff" {
+		t.Fatalf("v2 消息 %q", got)
+	}
+	if got := walletLoginMessage(WalletMessageV1, "uap-admin", 1700000000, ""); got != "uap-login:1700000000" {
+		t.Fatalf("v1 消息 %q", got)
+	}
+}
+
+func TestWalletLoginV2(t *testing.T) {
+	db := newTestDB(t)
+	policy := WalletLoginPolicy{Domain: "uap-admin", RequireV2: true}
+	wallet := newTestWallet(t)
+	req := wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), newNonce(t))
+
+	var first WalletLoginResponse
+	_, resp := serve(t, HandleWalletLogin(db, policy), "POST", "", req)
+	decodeData(t, resp, &first)
+	if first.Token == "" || first.UUID == "" {
+		t.Fatalf("登录响应 %+v", first)
+	}
+
+	// 同一签名不能重复登录
+	if _, resp := serve(t, HandleWalletLogin(db, policy), "POST", "", req); resp.Code != int(response.CodeNonceReused) {
+		t.Fatalf("重放的签名: 响应码 %d", resp.Code)
+	}
+
+	// 新 nonce 登录回到同一账户
+	var second WalletLoginResponse
+	_, resp = serve(t, HandleWalletLogin(db, policy), "POST", "", wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), newNonce(t)))
+	decodeData(t, resp, &second)
+	if second.UUID != first.UUID {
+		t.Fatalf("同一钱包登录到了不同账户 %s / %s", first.UUID, second.UUID)
+	}
+}
+
+func TestWalletLoginRejectsLegacyWhenRequired(t *testing.T) {
+	db := newTestDB(t)
+	wallet := newTestWallet(t)
+	legacy := wallet.login(WalletMessageV1, "", time.Now().Unix(), "")
+	legacy.Version = 0 // 旧客户端不传版本
+
+	// 过渡期仍接受旧格式
+	_, resp := serve(t, HandleWalletLogin(db, WalletLoginPolicy{Domain: "uap-admin"}), "POST", "", legacy)
+	decodeData(t, resp, &WalletLoginResponse{})
+
+	// 要求 v2 后拒绝同一个旧格式签名
+	_, resp = serve(t, HandleWalletLogin(db, WalletLoginPolicy{Domain: "uap-admin", RequireV2: true}), "POST", "", legacy)
+	if resp.Code != int(response.CodeMessageVersionUnsupported) || resp.Error != "message_version_unsupported" {
+		t.Fatalf("要求 v2 后的旧格式签名: %d %s", resp.Code, resp.Error)
+	}
+}
+
+func TestWalletLoginDomainSeparation(t *testing.T) {
+	db := newTestDB(t)
+	policy := WalletLoginPolicy{Domain: "uap-admin", RequireV2: true}
+	wallet := newTestWallet(t)
+
+	// 为其他服务生成的签名不能用于本服务登录
+	req := wallet.login(WalletMessageV2, "other-service", time.Now().Unix(), newNonce(t))
+	if _, resp := serve(t, HandleWalletLogin(db, policy), "POST", "", req); resp.Code != int(response.CodeSignatureMismatch) {
+		t.Fatalf("其他服务的签名: 响应码 %d", resp.Code)
+	}
+
+	// 签名后篡改 nonce / 时间戳同样无法通过
+	req = wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), newNonce(t))
+	req.Nonce = newNonce(t)
+	if _, resp := serve(t, HandleWalletLogin(db, policy), "POST", "", req); resp.Code != int(response.CodeSignatureMismatch) {
+		t.Fatalf("篡改 nonce: 响应码 %d", resp.Code)
+	}
+}
+
+func TestWalletLoginRejectsBadRequests(t *testing.T) {
+	db := newTestDB(t)
+	policy := WalletLoginPolicy{Domain: "uap-admin"}
+	wallet := newTestWallet(t)
+
+	stale := wallet.login(WalletMessageV2, policy.Domain, time.Now().Add(-10*time.Minute).Unix(), newNonce(t))
+	noNonce := wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), "")
+	badKey := wallet.login(WalletMessageV2, policy.Domain, time.Now().Unix(), newNonce(t))
+	badKey.PublicKey = "abcd"
+
+	for name, tc := range map[string]struct {
+		req  WalletLoginRequest
+		want response.Code
+	}{
+		"时间戳过期":       {stale, response.CodeRequestExpired},
+		"v2 缺少 nonce": {noNonce, response.CodeBadRequest},
+		"公钥格式错误":      {badKey, response.CodeInvalidPublicKey},
+	} {
+		if _, resp := serve(t, HandleWalletLogin(db, policy), "POST", "", tc.req); resp.Code != int(tc.want) {
+			t.Errorf("%s: 响应码 %d，期望 %d", name, resp.Code, tc.want)
+		}
+	}
+}
+
+func TestGetWalletLoginParams(t *testing.T) {
+	for _, requireV2 := range []bool{false, true} {
+		var params WalletLoginParamsResponse
+		_, resp := serve(t, GetWalletLoginParams(WalletLoginPolicy{Domain: "uap-admin", RequireV2: requireV2}), "GET", "", nil)
+		decodeData(t, resp, &params)
+		if params.Version != WalletMessageV2 || params.Domain != "uap-admin" || params.LegacyAccepted == requireV2 {
+			t.Fatalf("RequireV2=%v 时的签名参数 %+v", requireV2, params)
+		}
+		if diff := time.Now().Unix() - params.ServerTime; diff < 0 || diff > 5 {
+			t.Fatalf("服务端时间 %d", params.ServerTime)
+		}
+	}
+}
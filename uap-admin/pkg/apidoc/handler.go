@@ -0,0 +1,44 @@
+package apidoc
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DocsPath Swagger UI 地址，OpenAPI JSON 位于 DocsPath + "/openapi.json"
+const DocsPath = "/api/docs"
+
+// swaggerUIVersion Swagger UI 静态资源版本（从 CDN 加载）
+const swaggerUIVersion = "5.17.14"
+
+// SpecHandler 返回 OpenAPI JSON（原样输出，不包统一响应格式，供 Swagger UI / 代码生成工具使用）
+func SpecHandler(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, doc)
+	}
+}
+
+// UIHandler 返回加载 specURL 的 Swagger UI 页面
+func UIHandler(specURL string) gin.HandlerFunc {
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>UAP Admin API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: %[2]q, dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`, swaggerUIVersion, specURL)
+
+	return func(c *gin.Context) {
+		c.Data(200, "text/html; charset=utf-8", []byte(page))
+	}
+}
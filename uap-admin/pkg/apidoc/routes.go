@@ -0,0 +1,257 @@
+package apidoc
+
+import (
+	"uap-admin/pkg/api"
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+)
+
+// Auth 接口鉴权方式
+type Auth int
+
+const (
+	AuthNone   Auth = iota // 公开接口
+	AuthBearer             // Authorization: Bearer <JWT>
+	AuthAdmin              // X-Admin-Secret
+)
+
+// Route 接口描述
+// Request / Response 直接使用 handler 中的结构体（零值），Schema 由反射生成，结构体改动后文档自动同步
+type Route struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Auth        Auth
+	VersionGate bool            // 注册在版本门槛之后（过低版本返回 426）
+	Params      []Parameter     // 查询参数 / 请求头
+	Request     interface{}     // 请求体，nil 表示无请求体
+	Response    interface{}     // 成功响应的 data
+	Raw         bool            // 成功响应直接返回 Response，不使用统一信封（如标准 JWKS 文档）
+	Cacheable   bool            // 返回 ETag / Cache-Control，If-None-Match 一致时返回 304
+	Errors      []response.Code // 接口自身的错误码（鉴权、参数解析、版本门槛、panic 的错误码自动补充）
+}
+
+// 接口分组
+const (
+	tagSystem = "系统"
+	tagAuth   = "登录"
+	tagClient = "客户端"
+	tagAdmin  = "管理员"
+	tagNode   = "节点"
+)
+
+// errorData 附带 data 的错误响应
+var errorData = map[response.Code]interface{}{
+	response.CodeUpgradeRequired: api.ClientVersionInfo{},
+}
+
+// Routes uap-admin 的全部接口（新增接口时同步添加，启动时 Check 会对比实际注册的路由）
+var Routes = []Route{
+	{
+		Method: "GET", Path: "/health", Tag: tagSystem, Summary: "健康检查",
+		Response: api.HealthResponse{},
+	},
+	{
+		Method: "GET", Path: "/api/v1/client/version", Tag: tagClient, Summary: "客户端版本要求（不受版本门槛限制）",
+		Params: []Parameter{{
+			Name: api.ClientVersionHeader, In: "header", Schema: &Schema{Type: "string"},
+			Description: "客户端版本号，携带时计算 upgrade_required / update_available",
+		}},
+		Response: api.ClientVersionInfo{},
+	},
+	{
+		Method: "GET", Path: "/api/v1/auth/wallet/params", Tag: tagAuth, Summary: "钱包登录签名参数",
+		VersionGate: true,
+		Response:    api.WalletLoginParamsResponse{},
+	},
+	{
+		Method: "POST", Path: "/api/v1/auth/wallet", Tag: tagAuth, Summary: "钱包登录/注册",
+		VersionGate: true,
+		Request:     api.WalletLoginRequest{},
+		Response:    api.WalletLoginResponse{},
+		Errors: []response.Code{response.CodeInvalidPublicKey, response.CodeInvalidSignature, response.CodeMessageVersionUnsupported,
+			response.CodeRequestExpired, response.CodeSignatureMismatch, response.CodeNonceReused, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/auth/email/code", Tag: tagAuth, Summary: "发送邮箱验证码",
+		VersionGate: true,
+		Request:     api.EmailCodeRequest{},
+		Response:    api.MessageResponse{},
+		Errors:      []response.Code{response.CodeInvalidEmail, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/auth/email/login", Tag: tagAuth, Summary: "邮箱登录/注册",
+		VersionGate: true,
+		Request:     api.EmailLoginRequest{},
+		Response:    api.EmailLoginResponse{},
+		Errors:      []response.Code{response.CodeInvalidEmail, response.CodeVerificationFailed, response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/client/nodes", Tag: tagClient, Summary: "在线节点列表",
+		Auth: AuthBearer, VersionGate: true,
+		Params: []Parameter{{
+			Name: "region", In: "query", Description: "只返回该地区的节点（与注册时的 region 完全一致，如 JP）",
+			Schema: &Schema{Type: "string"},
+		}, {
+			Name: "sticky", In: "query", Description: "粘性选路：账户的固定节点仍健康时排在首位并标记 pinned",
+			Schema: &Schema{Type: "boolean"},
+		}},
+		Response: []models.Node{},
+		Errors:   []response.Code{response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/nodes/latency", Tag: tagClient, Summary: "上报节点测速结果（聚合后参与节点质量评分）",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.NodeLatencyRequest{},
+		Response: api.NodeLatencyResponse{},
+		Errors:   []response.Code{response.CodeRateLimited, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/report", Tag: tagClient, Summary: "上报节点连接结果（聚合为连接成功率后参与节点质量评分）",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.ClientReportRequest{},
+		Response: api.ClientReportResponse{},
+		Errors:   []response.Code{response.CodeRateLimited, response.CodeDatabase},
+	},
+	{
+		Method: "DELETE", Path: "/api/v1/client/nodes/pin", Tag: tagClient, Summary: "清除固定节点（粘性选路的切换节点操作）",
+		Auth: AuthBearer, VersionGate: true,
+		Response: api.MessageResponse{},
+		Errors:   []response.Code{response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/link/email", Tag: tagClient, Summary: "绑定邮箱",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.LinkEmailRequest{},
+		Response: api.LinkEmailResponse{},
+		Errors: []response.Code{response.CodeInvalidEmail, response.CodeVerificationFailed, response.CodeUserNotFound,
+			response.CodeAlreadyLinked, response.CodeIdentityInUse, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/link/wallet", Tag: tagClient, Summary: "绑定钱包",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.LinkWalletRequest{},
+		Response: api.LinkWalletResponse{},
+		Errors: []response.Code{response.CodeInvalidPublicKey, response.CodeInvalidSignature, response.CodeRequestExpired,
+			response.CodeSignatureMismatch, response.CodeNonceReused, response.CodeUserNotFound, response.CodeAlreadyLinked,
+			response.CodeIdentityInUse, response.CodeCustodialWallet, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/ticket", Tag: tagClient, Summary: "换取短期连接票据",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.ConnectTicketRequest{},
+		Response: api.ConnectTicketResponse{},
+		Errors: []response.Code{response.CodeQuotaExceeded, response.CodeUserNotFound, response.CodeNodeNotFound,
+			response.CodeDatabase, response.CodeServerConfig},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/sign", Tag: tagClient, Summary: "托管钱包签名握手挑战",
+		Auth: AuthBearer, VersionGate: true,
+		Request:  api.ClientSignRequest{},
+		Response: api.ClientSignResponse{},
+		Errors: []response.Code{response.CodeRequestExpired, response.CodeRateLimited, response.CodeUserNotFound,
+			response.CodeSelfCustody, response.CodeDatabase, response.CodeServerConfig},
+	},
+	{
+		Method: "POST", Path: "/api/v1/client/wallet/rotate", Tag: tagClient, Summary: "轮换托管钱包密钥对",
+		Auth: AuthBearer, VersionGate: true,
+		Response: api.WalletRotateResponse{},
+		Errors: []response.Code{response.CodeUserNotFound, response.CodeSelfCustody, response.CodeDatabase,
+			response.CodeServerConfig, response.CodeInternal},
+	},
+	{
+		Method: "GET", Path: "/api/v1/client/sessions", Tag: tagClient, Summary: "当前账户的在线设备",
+		Auth: AuthBearer, VersionGate: true,
+		Response: []api.SessionView{},
+		Errors:   []response.Code{response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/client/status", Tag: tagClient, Summary: "账户状态与待推送通知（通知只返回一次）",
+		Auth: AuthBearer, VersionGate: true,
+		Response: api.ClientStatus{},
+		Errors:   []response.Code{response.CodeUserNotFound, response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/client/usage", Tag: tagClient, Summary: "用量历史",
+		Auth: AuthBearer, VersionGate: true,
+		Params: []Parameter{{
+			Name: "days", In: "query", Description: "每日流量的天数（默认 30）",
+			Schema: &Schema{Type: "integer", Minimum: float(1), Maximum: float(365)},
+		}},
+		Response: api.UsageView{},
+		Errors:   []response.Code{response.CodeBadRequest, response.CodeUserNotFound, response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/system/public-key", Tag: tagSystem, Summary: "系统公钥（当前签名密钥，验证 JWT / 连接票据）",
+		VersionGate: true, Cacheable: true,
+		Response: api.PublicKeyResponse{},
+		Errors:   []response.Code{response.CodeServerConfig},
+	},
+	{
+		Method: "GET", Path: "/api/v1/system/jwks", Tag: tagSystem, Summary: "JWKS 公钥集合（含轮换期间的旧公钥）",
+		VersionGate: true, Raw: true, Cacheable: true,
+		Response: auth.JWKS{},
+		Errors:   []response.Code{response.CodeServerConfig},
+	},
+	{
+		Method: "GET", Path: "/api/v1/system/info", Tag: tagSystem, Summary: "系统信息（版本、运行时长、签名密钥状态；设置 UAP_SYSTEM_INFO_PUBLIC=true 时无需鉴权）",
+		Auth: AuthAdmin, VersionGate: true,
+		Response: api.SystemInfoResponse{},
+	},
+	{
+		Method: "POST", Path: "/api/v1/admin/node/register", Tag: tagAdmin, Summary: "注册/更新节点",
+		Auth:     AuthAdmin,
+		Request:  api.NodeRegisterRequest{},
+		Response: api.MessageResponse{},
+		Errors:   []response.Code{response.CodeInvalidNodeKey, response.CodeDatabase},
+	},
+	{
+		Method: "DELETE", Path: "/api/v1/admin/node", Tag: tagAdmin, Summary: "删除节点",
+		Auth:     AuthAdmin,
+		Request:  api.NodeDeleteRequest{},
+		Response: api.MessageResponse{},
+		Errors:   []response.Code{response.CodeNodeNotFound, response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/admin/sessions", Tag: tagAdmin, Summary: "全部在线会话",
+		Auth:     AuthAdmin,
+		Response: []api.SessionView{},
+		Errors:   []response.Code{response.CodeDatabase},
+	},
+	{
+		Method: "GET", Path: "/api/v1/admin/users", Tag: tagAdmin, Summary: "用户列表（按注册时间倒序，游标分页）",
+		Auth: AuthAdmin,
+		Params: []Parameter{{
+			Name: "limit", In: "query", Description: "每页条数（默认 50）",
+			Schema: &Schema{Type: "integer", Minimum: float(1), Maximum: float(500)},
+		}, {
+			Name: "cursor", In: "query", Description: "上一页返回的 next_cursor；翻页期间新注册的用户不会造成重复或遗漏",
+			Schema: &Schema{Type: "string"},
+		}, {
+			Name: "offset", In: "query", Description: "跳过的条数（不能与 cursor 同时使用，只适合小表：翻页期间有新用户时可能重复）",
+			Schema: &Schema{Type: "integer", Minimum: float(0)},
+		}},
+		Response: api.UserListResponse{},
+		Errors:   []response.Code{response.CodeBadRequest, response.CodeDatabase},
+	},
+	{
+		Method: "PUT", Path: "/api/v1/admin/user/quota", Tag: tagAdmin, Summary: "设置用户流量配额",
+		Auth:     AuthAdmin,
+		Request:  api.SetQuotaRequest{},
+		Response: api.SetQuotaResponse{},
+		Errors:   []response.Code{response.CodeUserNotFound, response.CodeDatabase},
+	},
+	{
+		Method: "POST", Path: "/api/v1/node/report", Tag: tagNode, Summary: "节点上报活跃会话（由 uap-server 定期调用）",
+		Auth:     AuthAdmin,
+		Request:  api.NodeReportRequest{},
+		Response: api.NodeReportResponse{},
+		Errors:   []response.Code{response.CodeInvalidNodeKey, response.CodeNodeNotFound, response.CodeDatabase},
+	},
+}
+
+func float(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,207 @@
+package apidoc
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// direction 结构体在接口中的用途，决定字段是否必填
+type direction int
+
+const (
+	inbound  direction = iota // 请求体：binding:"required" 的字段必填
+	outbound                  // 响应体：没有 omitempty 的字段总会出现
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder 由 Go 类型反射生成 Schema，字段名与 encoding/json 一致（取 json tag）
+// 具名结构体注册到 components.schemas 并以 $ref 引用，请求/响应结构体改动后文档自动同步
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type // 组件名 -> Go 类型（用于检测不同包的同名类型）
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		schemas: make(map[string]*Schema),
+		types:   make(map[string]reflect.Type),
+	}
+}
+
+// schemaOf 生成类型 t 的 Schema
+func (b *schemaBuilder) schemaOf(t reflect.Type, dir direction) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schemaOf(t.Elem(), dir)
+		if s.Ref != "" {
+			// OpenAPI 3.0 中 $ref 不能与其他字段并列，可空引用需包一层 allOf
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int64", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"} // []byte 编码为 Base64
+		}
+		// nil 切片编码为 null
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem(), dir), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem(), dir)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem(), dir), Nullable: true}
+	case reflect.Interface:
+		return &Schema{} // 任意 JSON 值
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t, dir)
+		}
+		return b.ref(t, dir)
+	}
+	panic(fmt.Sprintf("apidoc: 不支持的字段类型 %s", t))
+}
+
+// ref 注册具名结构体并返回引用
+func (b *schemaBuilder) ref(t reflect.Type, dir direction) *Schema {
+	name := t.Name()
+	if other, ok := b.types[name]; ok && other != t {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	if _, ok := b.types[name]; !ok {
+		b.types[name] = t
+		b.schemas[name] = b.structSchema(t, dir)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema 生成结构体的 object Schema
+func (b *schemaBuilder) structSchema(t reflect.Type, dir direction) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	b.addFields(s, t, dir)
+	return s
+}
+
+// addFields 按 encoding/json 的规则收集字段：跳过 json:"-" 与未导出字段，展开匿名嵌入的结构体
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type, dir direction) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft, dir)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := b.schemaOf(f.Type, dir)
+		rules := f.Tag.Get("binding")
+		applyBinding(fs, rules)
+		s.Properties[name] = fs
+
+		required := hasItem(rules, "required")
+		if dir == outbound {
+			required = !hasItem(opts, "omitempty")
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyBinding 将 gin binding 校验规则映射到 Schema（email / hexadecimal / min / max / gte / lte / oneof）
+func applyBinding(s *Schema, rules string) {
+	if rules == "" || s.Ref != "" {
+		return
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "email":
+			s.Format = "email"
+		case "hexadecimal":
+			s.Pattern = "^[0-9a-fA-F]+$"
+		case "min", "gte", "max", "lte":
+			if s.Type == "string" {
+				// 字符串的 min / max 校验的是长度
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					continue
+				}
+				if key == "min" || key == "gte" {
+					s.MinLength = &n
+				} else {
+					s.MaxLength = &n
+				}
+				continue
+			}
+			if s.Type != "integer" && s.Type != "number" {
+				continue
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			if key == "min" || key == "gte" {
+				s.Minimum = &n
+			} else {
+				s.Maximum = &n
+			}
+		case "oneof":
+			for _, v := range strings.Fields(value) {
+				if n, err := strconv.Atoi(v); err == nil && s.Type == "integer" {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, v)
+				}
+			}
+		}
+	}
+}
+
+// hasItem 逗号分隔的列表中是否包含 item（binding 规则 / json tag 选项）
+func hasItem(list, item string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package apidoc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"uap-admin/pkg/api"
+	"uap-admin/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build 由接口描述生成 OpenAPI 文档
+// 成功响应为 {"code":200,"data":<Response>}，错误响应按 HTTP 状态码分组并列出可能的错误码
+func Build(routes []Route) *Document {
+	b := newSchemaBuilder()
+	envelope := b.schemaOf(reflect.TypeOf(response.Response{}), outbound)
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "UAP Admin API",
+			Version:     "v1",
+			Description: catalogDescription(),
+		},
+		Paths: make(map[string]map[string]*Operation),
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearerAuth":  {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "登录接口返回的 JWT"},
+				"adminSecret": {Type: "apiKey", In: "header", Name: "X-Admin-Secret", Description: "管理员密钥（UAP_ADMIN_SECRET）"},
+			},
+		},
+	}
+
+	for _, r := range routes {
+		op := &Operation{
+			Tags:       []string{r.Tag},
+			Summary:    r.Summary,
+			Parameters: append([]Parameter(nil), r.Params...),
+			Responses:  make(map[string]*Response),
+		}
+		switch r.Auth {
+		case AuthBearer:
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		case AuthAdmin:
+			op.Security = []map[string][]string{{"adminSecret": {}}}
+		}
+		if r.VersionGate {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: api.ClientVersionHeader, In: "header", Schema: &Schema{Type: "string"},
+				Description: "客户端版本号，低于最低要求时返回 426（不携带则不检查）",
+			})
+		}
+		if r.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(b.schemaOf(reflect.TypeOf(r.Request), inbound)),
+			}
+		}
+
+		if r.Raw {
+			op.Responses["200"] = &Response{
+				Description: "成功",
+				Content:     jsonContent(b.schemaOf(reflect.TypeOf(r.Response), outbound)),
+			}
+		} else {
+			data := &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{"data": b.schemaOf(reflect.TypeOf(r.Response), outbound)},
+				Required:   []string{"data"},
+			}
+			op.Responses["200"] = &Response{
+				Description: "成功",
+				Content:     jsonContent(&Schema{AllOf: []*Schema{envelope, data}}),
+			}
+		}
+		if r.Cacheable {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: "If-None-Match", In: "header", Schema: &Schema{Type: "string"},
+				Description: "上次响应的 ETag，内容未变化时返回 304",
+			})
+			op.Responses["304"] = &Response{Description: "内容未变化（If-None-Match 与当前 ETag 一致）"}
+		}
+		for status, codes := range groupByStatus(routeErrors(r)) {
+			op.Responses[strconv.Itoa(status)] = errorResponse(b, envelope, codes)
+		}
+
+		if doc.Paths[r.Path] == nil {
+			doc.Paths[r.Path] = make(map[string]*Operation)
+		}
+		doc.Paths[r.Path][strings.ToLower(r.Method)] = op
+	}
+
+	doc.Components.Schemas = b.schemas
+	return doc
+}
+
+// routeErrors 接口可能返回的全部错误码（接口自身的 + 通用的）
+func routeErrors(r Route) []response.Code {
+	codes := append([]response.Code{response.CodeInternal}, r.Errors...)
+	if r.Request != nil {
+		codes = append(codes, response.CodeBadRequest, response.CodeBodyTooLarge)
+	}
+	switch r.Auth {
+	case AuthBearer:
+		codes = append(codes, response.CodeTokenMissing, response.CodeTokenExpired, response.CodeTokenInvalid, response.CodeServerConfig)
+	case AuthAdmin:
+		codes = append(codes, response.CodeForbidden)
+	}
+	if r.VersionGate {
+		codes = append(codes, response.CodeUpgradeRequired)
+	}
+	return codes
+}
+
+// groupByStatus 按 HTTP 状态码分组（组内去重、升序）
+func groupByStatus(codes []response.Code) map[int][]response.Code {
+	groups := make(map[int][]response.Code)
+	seen := make(map[response.Code]bool)
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		groups[code.Status()] = append(groups[code.Status()], code)
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i] < group[j] })
+	}
+	return groups
+}
+
+// errorResponse 错误响应：统一信封，code / error 限定为该状态码下可能出现的值
+func errorResponse(b *schemaBuilder, envelope *Schema, codes []response.Code) *Response {
+	names := make([]string, len(codes))
+	codeEnum := make([]interface{}, len(codes))
+	nameEnum := make([]interface{}, len(codes))
+	for i, code := range codes {
+		names[i] = code.Name()
+		codeEnum[i] = int(code)
+		nameEnum[i] = code.Name()
+	}
+
+	detail := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":  {Type: "integer", Enum: codeEnum},
+			"error": {Type: "string", Enum: nameEnum},
+		},
+		Required: []string{"error", "msg"},
+	}
+	for _, code := range codes {
+		if data, ok := errorData[code]; ok {
+			detail.Properties["data"] = b.schemaOf(reflect.TypeOf(data), outbound)
+		}
+	}
+
+	return &Response{
+		Description: strings.Join(names, " / "),
+		Content:     jsonContent(&Schema{AllOf: []*Schema{envelope, detail}}),
+	}
+}
+
+// catalogDescription 文档首页说明：响应格式与错误码目录
+func catalogDescription() string {
+	var sb strings.Builder
+	sb.WriteString("成功响应为 `{\"code\":200,\"data\":...}`；错误响应为 `{\"code\":40102,\"error\":\"token_expired\",\"msg\":\"...\"}`，")
+	sb.WriteString("HTTP 状态码等于 `code / 100`，客户端应按 `error` 处理。\n\n")
+	sb.WriteString("| code | error |\n|------|-------|\n")
+	for _, code := range response.Codes() {
+		fmt.Fprintf(&sb, "| %d | `%s` |\n", code, code.Name())
+	}
+	return sb.String()
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// Check 对比接口描述与实际注册的路由，返回未写入文档或已不存在的接口
+func Check(routes []Route, registered gin.RoutesInfo) []string {
+	documented := make(map[string]bool)
+	for _, r := range routes {
+		documented[r.Method+" "+r.Path] = true
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, ri := range registered {
+		if strings.HasPrefix(ri.Path, DocsPath) {
+			continue
+		}
+		key := ri.Method + " " + ri.Path
+		seen[key] = true
+		if !documented[key] {
+			problems = append(problems, "接口未写入文档: "+key)
+		}
+	}
+	for _, r := range routes {
+		if key := r.Method + " " + r.Path; !seen[key] {
+			problems = append(problems, "文档中的接口未注册: "+key)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,299 @@
+package apidoc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/response"
+)
+
+// validator 按文档中的 Schema 校验 JSON 值（只实现本项目生成的 Schema 子集）
+type validator struct {
+	doc  *Document
+	errs []string
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+// resolve 展开 $ref
+func (v *validator) resolve(s *Schema) *Schema {
+	for s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		target, ok := v.doc.Components.Schemas[name]
+		if !ok {
+			panic("未定义的组件 " + s.Ref)
+		}
+		s = target
+	}
+	return s
+}
+
+// properties allOf 合并后的全部字段（用于发现 Schema 中没有的字段）
+func (v *validator) properties(s *Schema, into map[string]bool) {
+	s = v.resolve(s)
+	for name := range s.Properties {
+		into[name] = true
+	}
+	for _, sub := range s.AllOf {
+		v.properties(sub, into)
+	}
+}
+
+// validate 校验 value；partOf 为 true 时 s 是 allOf 的一部分，多余字段由外层检查
+func (v *validator) validate(path string, s *Schema, value interface{}, partOf bool) {
+	s = v.resolve(s)
+	if value == nil {
+		if !s.Nullable && (s.Type != "" || len(s.AllOf) > 0) {
+			v.fail(path, "不允许 null")
+		}
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.validate(path, sub, value, true)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(value)
+		}
+		if !found {
+			v.fail(path, "%v 不在枚举 %v 中", value, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.fail(path, "期望 boolean，实际 %T", value)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			v.fail(path, "期望 integer，实际 %v", value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			v.fail(path, "期望 number，实际 %T", value)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.fail(path, "期望 string，实际 %T", value)
+			return
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				v.fail(path, "不是 date-time: %q", str)
+			}
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+				v.fail(path, "不是 Base64: %q", str)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.fail(path, "期望 array，实际 %T", value)
+			return
+		}
+		for i, item := range items {
+			v.validate(path+"["+strconv.Itoa(i)+"]", s.Items, item, false)
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			v.fail(path, "期望 object，实际 %T", value)
+			return
+		}
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "缺少必填字段 %q", name)
+		}
+	}
+	for name, field := range obj {
+		if ps, ok := s.Properties[name]; ok {
+			v.validate(path+"."+name, ps, field, false)
+		} else if s.AdditionalProperties != nil {
+			v.validate(path+"."+name, s.AdditionalProperties, field, false)
+		}
+	}
+	if partOf || s.AdditionalProperties != nil || (s.Type != "object" && len(s.AllOf) == 0) {
+		return
+	}
+	known := make(map[string]bool)
+	v.properties(s, known)
+	for name := range obj {
+		if !known[name] {
+			v.fail(path, "字段 %q 不在 Schema 中", name)
+		}
+	}
+}
+
+// roundTrip 把 value 编码为 JSON 后按 s 校验
+func roundTrip(t *testing.T, doc *Document, name string, s *Schema, value interface{}) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	v := &validator{doc: doc}
+	v.validate("$", s, decoded, false)
+	for _, e := range v.errs {
+		t.Errorf("%s %s", name, e)
+	}
+}
+
+// filled 构造所有字段都有值的 t（指针、切片、map 均非空），用于覆盖 omitempty 之外的字段
+func filled(t reflect.Type, depth int) reflect.Value {
+	v := reflect.New(t).Elem()
+	if depth > 5 {
+		return v
+	}
+	if t == timeType {
+		v.Set(reflect.ValueOf(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+		return v
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(filled(t.Elem(), depth+1))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(t, 1, 1))
+		v.Index(0).Set(filled(t.Elem(), depth+1))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(filled(t.Elem(), depth+1))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		v.SetMapIndex(filled(t.Key(), depth+1), filled(t.Elem(), depth+1))
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			v.Set(reflect.ValueOf("x"))
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				v.Field(i).Set(filled(t.Field(i).Type, depth+1))
+			}
+		}
+	}
+	return v
+}
+
+// samples 同一 DTO 的零值与填满的值（零值覆盖 omitempty 字段缺省、nil 切片编码为 null 的情况）
+func samples(dto interface{}) map[string]interface{} {
+	t := reflect.TypeOf(dto)
+	return map[string]interface{}{
+		"零值": reflect.Zero(t).Interface(),
+		"填满": filled(t, 0).Interface(),
+	}
+}
+
+func TestSpecRoundTripsDTOs(t *testing.T) {
+	doc := Build(Routes)
+
+	for _, r := range Routes {
+		op := doc.Paths[r.Path][strings.ToLower(r.Method)]
+		if op == nil {
+			t.Fatalf("%s %s 未生成文档", r.Method, r.Path)
+		}
+		name := r.Method + " " + r.Path
+
+		if r.Request != nil {
+			s := op.RequestBody.Content["application/json"].Schema
+			roundTrip(t, doc, name+" 请求", s, filled(reflect.TypeOf(r.Request), 0).Interface())
+		}
+
+		success := op.Responses["200"].Content["application/json"].Schema
+		for label, data := range samples(r.Response) {
+			var body interface{} = response.Success(data)
+			if r.Raw {
+				body = data
+			}
+			roundTrip(t, doc, name+" 成功响应（"+label+"）", success, body)
+		}
+
+		for _, code := range routeErrors(r) {
+			resp := op.Responses[strconv.Itoa(code.Status())]
+			if resp == nil {
+				t.Errorf("%s: 错误码 %d 没有对应的响应", name, code)
+				continue
+			}
+			body := response.Error(code, "msg")
+			if data, ok := errorData[code]; ok {
+				body = response.ErrorWithData(code, "msg", filled(reflect.TypeOf(data), 0).Interface())
+			}
+			roundTrip(t, doc, fmt.Sprintf("%s 错误 %d", name, code), resp.Content["application/json"].Schema, body)
+		}
+	}
+}
+
+func TestSpecRejectsDrift(t *testing.T) {
+	doc := Build(Routes)
+	var register *Route
+	for i := range Routes {
+		if Routes[i].Path == "/api/v1/admin/node/register" {
+			register = &Routes[i]
+		}
+	}
+	s := doc.Paths[register.Path]["post"].RequestBody.Content["application/json"].Schema
+
+	// 请求体多出 Schema 中没有的字段、字段类型不一致、缺少必填字段时校验失败
+	var body map[string]interface{}
+	data, _ := json.Marshal(filled(reflect.TypeOf(register.Request), 0).Interface())
+	json.Unmarshal(data, &body)
+	for name, mutate := range map[string]func(map[string]interface{}){
+		"多余字段": func(m map[string]interface{}) { m["renamed_field"] = "x" },
+		"类型不一致": func(m map[string]interface{}) {
+			for k, v := range m {
+				if _, ok := v.(string); ok {
+					m[k] = 1
+				}
+			}
+		},
+		"缺少必填字段": func(m map[string]interface{}) {
+			for _, k := range (&validator{doc: doc}).resolve(s).Required {
+				delete(m, k)
+			}
+		},
+	} {
+		m := make(map[string]interface{})
+		for k, v := range body {
+			m[k] = v
+		}
+		mutate(m)
+		val := &validator{doc: doc}
+		val.validate("$", s, m, false)
+		if len(val.errs) == 0 {
+			t.Errorf("%s: 校验未发现差异", name)
+		}
+	}
+}
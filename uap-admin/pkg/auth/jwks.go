@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK Ed25519 公钥的 JWK 表示（RFC 8037）
+type JWK struct {
+	Kty string `json:"kty"` // 固定为 "OKP"
+	Crv string `json:"crv"` // 固定为 "Ed25519"
+	X   string `json:"x"`   // 公钥（Base64URL，无填充）
+	Kid string `json:"kid"` // 密钥 ID（见 KeyID）
+	Alg string `json:"alg"` // 固定为 "EdDSA"
+	Use string `json:"use"` // 固定为 "sig"
+}
+
+// JWKS 公钥集合文档（/system/jwks 返回）
+type JWKS struct {
+	Keys []JWK `json:"keys"` // 第一个为当前签名密钥，其余为轮换期间仍然有效的旧公钥
+}
+
+// KeyID 计算公钥的 kid：JWK 指纹（RFC 7638，SHA-256，Base64URL 无填充）
+// 只依赖公钥本身，轮换前后各副本、各节点算出的 kid 一致
+func KeyID(pub ed25519.PublicKey) string {
+	// RFC 7638：必需成员按字典序排列、无空白
+	canonical := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(pub))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newJWK 构造公钥的 JWK
+func newJWK(pub ed25519.PublicKey) JWK {
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+		Kid: KeyID(pub),
+		Alg: jwt.SigningMethodEdDSA.Alg(),
+		Use: "sig",
+	}
+}
+
+// buildJWKS 生成 JWKS 文档及其 ETag（文档内容的 SHA-256，密钥不变时 ETag 不变）
+func buildJWKS(keys []ed25519.PublicKey) ([]byte, string, error) {
+	doc := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, pub := range keys {
+		doc.Keys = append(doc.Keys, newJWK(pub))
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	return data, `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// JWKSDocument 返回启动时生成的 JWKS 文档（JSON）和 ETag
+func JWKSDocument() ([]byte, string) {
+	return jwksDoc, jwksETag
+}
+
+// SigningKeyID 当前签名密钥的 kid（签发的 Token 头部携带）
+func SigningKeyID() string {
+	return signingKeyID
+}
+
+// Keyfunc jwt.Parse 的验签密钥回调：按 Token 头部的 kid 选择公钥
+// 未携带 kid 的 Token（支持密钥轮换之前签发）依次尝试所有有效公钥
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodEdDSA {
+		return nil, fmt.Errorf("unexpected signing method: %v (expected: %v)", token.Method.Alg(), jwt.SigningMethodEdDSA.Alg())
+	}
+	if len(verifyKeys) == 0 {
+		return nil, fmt.Errorf("签名密钥未初始化")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		set := jwt.VerificationKeySet{}
+		for _, pub := range verifyKeys {
+			set.Keys = append(set.Keys, pub)
+		}
+		return set, nil
+	}
+	pub, ok := verifyKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown kid")
+	}
+	return pub, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"uap-admin/pkg/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyID(t *testing.T) {
+	// RFC 8037 附录 A.3 的 JWK 指纹
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := KeyID(ed25519.PublicKey(x)); kid != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatalf("KeyID = %s", kid)
+	}
+}
+
+// decodeJWKS 解析 JWKSDocument 返回的文档
+func decodeJWKS(t *testing.T) (JWKS, string) {
+	t.Helper()
+	data, etag := JWKSDocument()
+	var doc JWKS
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc, etag
+}
+
+func TestJWKSDocumentRotation(t *testing.T) {
+	oldPEM, oldPub := newKeyPEM(t)
+	if err := Init(KeyConfig{PrivateKeyPEM: oldPEM}); err != nil {
+		t.Fatal(err)
+	}
+	doc, oldETag := decodeJWKS(t)
+	if len(doc.Keys) != 1 || doc.Keys[0].Kid != KeyID(oldPub) || SigningKeyID() != KeyID(oldPub) {
+		t.Fatalf("JWKS %+v", doc)
+	}
+	k := doc.Keys[0]
+	if k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != "EdDSA" || k.Use != "sig" || k.X != base64.RawURLEncoding.EncodeToString(oldPub) {
+		t.Fatalf("JWK 字段 %+v", k)
+	}
+
+	// 签发的 Token 头部携带当前 kid
+	token, err := GenerateToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != KeyID(oldPub) {
+		t.Fatalf("Token 头部 kid = %v: %v", parsed.Header["kid"], err)
+	}
+
+	// 轮换：新密钥在前，旧公钥继续发布；密钥变化时 ETag 随之变化
+	oldPubPEM, err := utils.EncodePublicKeyPEM(oldPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPEM, newPub := newKeyPEM(t)
+	if err := Init(KeyConfig{PrivateKeyPEM: newPEM, PreviousPublicKeysPEM: string(oldPubPEM)}); err != nil {
+		t.Fatal(err)
+	}
+	doc, rotatedETag := decodeJWKS(t)
+	if len(doc.Keys) != 2 || doc.Keys[0].Kid != KeyID(newPub) || doc.Keys[1].Kid != KeyID(oldPub) {
+		t.Fatalf("轮换期间的 JWKS %+v", doc)
+	}
+	if rotatedETag == oldETag {
+		t.Fatal("密钥变化后 ETag 未变化")
+	}
+
+	// 相同的密钥配置（如重启）得到相同的 ETag，节点缓存不失效
+	if err := Init(KeyConfig{PrivateKeyPEM: newPEM, PreviousPublicKeysPEM: string(oldPubPEM)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, etag := JWKSDocument(); etag != rotatedETag {
+		t.Fatalf("相同密钥的 ETag %s != %s", etag, rotatedETag)
+	}
+}
+
+func TestKeyfuncUnknownKid(t *testing.T) {
+	privPEM, _ := newKeyPEM(t)
+	if err := Init(KeyConfig{PrivateKeyPEM: privPEM}); err != nil {
+		t.Fatal(err)
+	}
+	strangerPEM, _ := newKeyPEM(t)
+	stranger, err := utils.ParsePrivateKeyPEM([]byte(strangerPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, kid := range map[string]string{"未知 kid": "unknown", "冒用当前 kid": SigningKeyID(), "无 kid": ""} {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"uuid": "user-1"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(stranger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verify(t, signed); err == nil {
+			t.Errorf("%s: 其他密钥签发的 Token 通过了校验", name)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/ed25519"
-	"crypto/x509"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"os"
@@ -14,59 +16,90 @@ import (
 )
 
 var (
-	privateKey ed25519.PrivateKey
-	publicKey  ed25519.PublicKey
+	privateKey   ed25519.PrivateKey
+	publicKey    ed25519.PublicKey
+	publicKeyPEM string
+	signingKeyID string                       // 当前签名密钥的 kid
+	verifyKeys   map[string]ed25519.PublicKey // kid -> 验签公钥（当前密钥 + 轮换期间的旧公钥）
+	jwksDoc      []byte                       // JWKS 文档（启动时生成）
+	jwksETag     string
 )
 
-// init 初始化函数，确保密钥存在并加载私钥
-func init() {
-	// 确保密钥对存在
-	if err := utils.EnsureKeys(); err != nil {
-		panic(fmt.Sprintf("初始化密钥失败: %v", err))
-	}
-
-	// 加载私钥
-	if err := loadPrivateKey(); err != nil {
-		panic(fmt.Sprintf("加载私钥失败: %v", err))
-	}
+// KeyConfig 签名密钥来源
+// PrivateKeyPEM 非空时直接使用，不读写任何密钥文件（适用于通过环境变量注入密钥、文件系统只读的容器）
+// 否则从 PrivateKeyPath 读取，密钥文件不存在时自动生成
+type KeyConfig struct {
+	PrivateKeyPEM  string // PEM 格式的 Ed25519 私钥（PKCS#8）
+	PrivateKeyPath string // 私钥文件路径
+	PublicKeyPath  string // 公钥文件路径（自动生成时写入，供部署节点时使用）
+
+	// PreviousPublicKeysPEM 轮换前的旧公钥（可拼接多个 PEM 块）
+	// 旧私钥签发的 Token 过期前仍然有效，并继续发布在 JWKS 中；旧 Token 全部过期后删除即可
+	PreviousPublicKeysPEM string
 }
 
-// loadPrivateKey 加载私钥文件
-func loadPrivateKey() error {
-	privateKeyPath := "private_key.pem"
-	privData, err := os.ReadFile(privateKeyPath)
-	if err != nil {
-		return fmt.Errorf("读取私钥文件失败: %w", err)
+// Init 加载签名密钥，必须在签发/校验 Token 之前调用
+func Init(cfg KeyConfig) error {
+	privPEM := []byte(cfg.PrivateKeyPEM)
+	if len(privPEM) == 0 {
+		// 确保密钥对存在
+		if err := utils.EnsureKeys(cfg.PrivateKeyPath, cfg.PublicKeyPath); err != nil {
+			return fmt.Errorf("初始化密钥失败: %w", err)
+		}
+		data, err := os.ReadFile(cfg.PrivateKeyPath)
+		if err != nil {
+			return fmt.Errorf("读取私钥文件失败: %w", err)
+		}
+		privPEM = data
 	}
 
-	block, _ := pem.Decode(privData)
-	if block == nil {
-		return fmt.Errorf("解析私钥 PEM 失败")
+	priv, err := utils.ParsePrivateKeyPEM(privPEM)
+	if err != nil {
+		return err
 	}
-
-	// 使用 x509.ParsePKCS8PrivateKey 解析私钥
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	pub := priv.Public().(ed25519.PublicKey)
+	pubPEM, err := utils.EncodePublicKeyPEM(pub)
 	if err != nil {
-		return fmt.Errorf("解析私钥失败: %w", err)
+		return err
 	}
 
-	// 转换为 ed25519.PrivateKey
-	priv, ok := key.(ed25519.PrivateKey)
-	if !ok {
-		return fmt.Errorf("私钥类型错误，期望 ed25519.PrivateKey")
+	keys := []ed25519.PublicKey{pub}
+	if cfg.PreviousPublicKeysPEM != "" {
+		previous, err := utils.ParsePublicKeysPEM([]byte(cfg.PreviousPublicKeysPEM))
+		if err != nil {
+			return fmt.Errorf("解析旧公钥失败: %w", err)
+		}
+		keys = append(keys, previous...)
+	}
+	verify := make(map[string]ed25519.PublicKey, len(keys))
+	for _, key := range keys {
+		verify[KeyID(key)] = key
+	}
+	doc, etag, err := buildJWKS(keys)
+	if err != nil {
+		return err
 	}
 
 	privateKey = priv
-	publicKey = priv.Public().(ed25519.PublicKey)
+	publicKey = pub
+	publicKeyPEM = string(pubPEM)
+	signingKeyID = KeyID(pub)
+	verifyKeys = verify
+	jwksDoc, jwksETag = doc, etag
 	return nil
 }
 
-// GetPublicKey 获取公钥用于 JWT 验证（别名函数）
+// PublicKeyPEM 获取 PEM 格式的公钥（节点部署与 /system/public-key 使用）
+func PublicKeyPEM() string {
+	return publicKeyPEM
+}
+
+// GetPublicKey 获取当前签名公钥（验签请使用 Keyfunc，轮换期间旧公钥同样有效）
 func GetPublicKey() ed25519.PublicKey {
 	return publicKey
 }
 
-// GetPublicKeyForVerification 获取公钥用于 JWT 验证
+// GetPublicKeyForVerification 获取当前签名公钥（同 GetPublicKey）
 func GetPublicKeyForVerification() ed25519.PublicKey {
 	return publicKey
 }
@@ -81,6 +114,7 @@ func GenerateToken(uuid string) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = signingKeyID
 
 	// 使用 Ed25519 私钥签名
 	tokenString, err := token.SignedString(privateKey)
@@ -90,3 +124,53 @@ func GenerateToken(uuid string) (string, error) {
 
 	return tokenString, nil
 }
+
+// ConnectTicketTTL 连接票据有效期
+const ConnectTicketTTL = 2 * time.Minute
+
+// GenerateConnectTicket 生成绑定到指定节点的短期连接票据
+// 票据是 typ=connect 的 JWT，同样使用 Ed25519 私钥签名，节点用同一把公钥验签
+// nodeFingerprint: 节点公钥指纹（见 KeyFingerprint），节点只接受绑定到自己的票据
+// jti: 随机票据 ID，节点据此拒绝被其他连接重放的票据
+// walletPubKey: 非空时写入 wpk，节点要求握手中附带该钱包对 "uap-connect:<jti>:<时间戳>" 的签名
+func GenerateConnectTicket(uuid, nodeFingerprint, walletPubKey string) (string, time.Time, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, fmt.Errorf("生成票据 ID 失败: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ConnectTicketTTL)
+	claims := jwt.MapClaims{
+		"typ":  "connect",
+		"uuid": uuid,
+		"nod":  nodeFingerprint,
+		"jti":  hex.EncodeToString(jti),
+		"iat":  now.Unix(),
+		"exp":  expiresAt.Unix(),
+	}
+	if walletPubKey != "" {
+		claims["wpk"] = walletPubKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = signingKeyID
+	ticket, err := token.SignedString(privateKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("签名票据失败: %w", err)
+	}
+
+	return ticket, expiresAt, nil
+}
+
+// KeyFingerprint 计算 PEM 公钥的指纹（DER 字节的 SHA-256，Hex 编码）
+// 只依赖 DER 内容，与 PEM 的换行、空白等格式差异无关
+func KeyFingerprint(publicKeyPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return "", fmt.Errorf("解析公钥 PEM 失败")
+	}
+
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
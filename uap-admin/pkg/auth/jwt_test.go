@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uap-admin/pkg/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newKeyPEM 随机生成 Ed25519 私钥 PEM
+func newKeyPEM(t *testing.T) (string, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := utils.EncodePrivateKeyPEM(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), pub
+}
+
+// verify 用 Keyfunc 校验 Token
+func verify(t *testing.T, token string) error {
+	t.Helper()
+	_, err := jwt.Parse(token, Keyfunc, jwt.WithValidMethods([]string{"EdDSA"}))
+	return err
+}
+
+func TestInitFromPEMWritesNoFiles(t *testing.T) {
+	dir := t.TempDir()
+	privPEM, pub := newKeyPEM(t)
+	err := Init(KeyConfig{
+		PrivateKeyPEM:  privPEM,
+		PrivateKeyPath: filepath.Join(dir, "private_key.pem"),
+		PublicKeyPath:  filepath.Join(dir, "public_key.pem"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("使用 PEM 密钥时写入了文件 %v", entries)
+	}
+	if !GetPublicKey().Equal(pub) {
+		t.Fatal("签名公钥与注入的私钥不匹配")
+	}
+
+	token, err := GenerateToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, token); err != nil {
+		t.Fatalf("新签发的 Token 校验失败: %v", err)
+	}
+}
+
+func TestInitGeneratesAndReusesKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := KeyConfig{
+		PrivateKeyPath: filepath.Join(dir, "private_key.pem"),
+		PublicKeyPath:  filepath.Join(dir, "public_key.pem"),
+	}
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	first := GetPublicKey()
+	if _, err := os.Stat(cfg.PublicKeyPath); err != nil {
+		t.Fatalf("未写出公钥文件: %v", err)
+	}
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !GetPublicKey().Equal(first) {
+		t.Fatal("重启后生成了新的密钥，应复用已有的密钥文件")
+	}
+}
+
+func TestInitRotationKeepsPreviousKeys(t *testing.T) {
+	oldPEM, oldPub := newKeyPEM(t)
+	if err := Init(KeyConfig{PrivateKeyPEM: oldPEM}); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := GenerateToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldPubPEM, err := utils.EncodePublicKeyPEM(oldPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPEM, _ := newKeyPEM(t)
+	if err := Init(KeyConfig{PrivateKeyPEM: newPEM, PreviousPublicKeysPEM: string(oldPubPEM)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, oldToken); err != nil {
+		t.Fatalf("轮换期间旧 Token 应仍然有效: %v", err)
+	}
+
+	// 旧公钥移出配置后旧 Token 失效
+	if err := Init(KeyConfig{PrivateKeyPEM: newPEM}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, oldToken); err == nil {
+		t.Fatal("旧公钥移除后旧 Token 仍然有效")
+	}
+
+	if err := Init(KeyConfig{PrivateKeyPEM: "not a pem"}); err == nil {
+		t.Fatal("无效的私钥 PEM 应返回错误")
+	}
+}
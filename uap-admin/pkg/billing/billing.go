@@ -0,0 +1,88 @@
+package billing
+
+import (
+	"time"
+
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dayFormat 每日账本的日期格式（UTC）
+const dayFormat = "2006-01-02"
+
+// RecordUsage 将流量增量计入用户当日账本
+func RecordUsage(tx *gorm.DB, userUUID string, delta int64, now time.Time) error {
+	if delta <= 0 {
+		return nil
+	}
+	entry := models.UsageLedger{
+		UserUUID: userUUID,
+		Day:      now.UTC().Format(dayFormat),
+		Bytes:    delta,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_uuid"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"bytes": gorm.Expr("usage_ledgers.bytes + excluded.bytes")}),
+	}).Create(&entry).Error
+}
+
+// DailyUsage 单日流量
+type DailyUsage struct {
+	Day   string `json:"day"` // YYYY-MM-DD (UTC)
+	Bytes int64  `json:"bytes"`
+}
+
+// DailySeries 返回用户最近 days 天（含今天）的每日流量，没有流量的日期补 0
+func DailySeries(db *gorm.DB, userUUID string, days int, now time.Time) ([]DailyUsage, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(days - 1))
+
+	var entries []models.UsageLedger
+	if err := db.Where("user_uuid = ? AND day >= ?", userUUID, first.Format(dayFormat)).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		byDay[e.Day] = e.Bytes
+	}
+
+	series := make([]DailyUsage, 0, days)
+	for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+		day := d.Format(dayFormat)
+		series = append(series, DailyUsage{Day: day, Bytes: byDay[day]})
+	}
+	return series, nil
+}
+
+// NextPeriodStart 计算下一个计费周期的开始时间：下一个自然月锚定日的同一时刻
+// 目标月份没有锚定日时取该月最后一天，之后的月份仍回到锚定日（锚定 31 日：1 月 31 日 -> 2 月 28/29 日 -> 3 月 31 日）
+func NextPeriodStart(start time.Time, anchorDay int) time.Time {
+	year, month, _ := start.Date()
+	hour, min, sec := start.Clock()
+	firstOfNext := time.Date(year, month+1, 1, hour, min, sec, start.Nanosecond(), start.Location())
+	day := anchorDay
+	if lastDay := firstOfNext.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfNext.Year(), firstOfNext.Month(), day, hour, min, sec, start.Nanosecond(), start.Location())
+}
+
+// AnchorDay 用户计费周期的锚定日（注册日，按当前周期起点的时区计算）
+// 锚定日由注册时间推出而不是取当前周期起点的日期：月末注册的用户经过短月后不会一直停留在 28 日
+func AnchorDay(user models.User) int {
+	if user.PeriodStart == nil {
+		return user.CreatedAt.Day()
+	}
+	return user.CreatedAt.In(user.PeriodStart.Location()).Day()
+}
+
+// PeriodEnd 用户当前计费周期的结束时间（即下一个周期的开始时间），没有计费周期时返回 false
+func PeriodEnd(user models.User) (time.Time, bool) {
+	if user.PeriodStart == nil {
+		return time.Time{}, false
+	}
+	return NextPeriodStart(*user.PeriodStart, AnchorDay(user)), true
+}
@@ -0,0 +1,104 @@
+package billing
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 在临时目录创建已迁移到最新结构的数据库
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// utc 构造 UTC 时间
+func utc(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestNextPeriodStart(t *testing.T) {
+	cases := []struct {
+		start  time.Time
+		anchor int
+		want   time.Time
+	}{
+		{utc(2026, 1, 15, 12), 15, utc(2026, 2, 15, 12)},
+		{utc(2026, 1, 31, 12), 31, utc(2026, 2, 28, 12)},
+		{utc(2028, 1, 31, 12), 31, utc(2028, 2, 29, 12)}, // 闰年
+		{utc(2026, 2, 28, 12), 31, utc(2026, 3, 31, 12)}, // 短月之后回到锚定日
+		{utc(2026, 3, 31, 12), 31, utc(2026, 4, 30, 12)},
+		{utc(2026, 4, 30, 12), 31, utc(2026, 5, 31, 12)},
+		{utc(2026, 2, 28, 12), 30, utc(2026, 3, 30, 12)},
+		{utc(2026, 12, 31, 12), 31, utc(2027, 1, 31, 12)}, // 跨年
+	}
+	for _, tc := range cases {
+		if got := NextPeriodStart(tc.start, tc.anchor); !got.Equal(tc.want) {
+			t.Errorf("NextPeriodStart(%v, %d) = %v，期望 %v", tc.start, tc.anchor, got, tc.want)
+		}
+	}
+}
+
+func TestPeriodsDoNotDrift(t *testing.T) {
+	// 连续滚动一年：每个周期都回到锚定日（或该月最后一天）
+	start := utc(2026, 1, 31, 12)
+	for i := 0; i < 12; i++ {
+		next := NextPeriodStart(start, 31)
+		lastDay := time.Date(next.Year(), next.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if next.Day() != lastDay {
+			t.Fatalf("第 %d 次滚动到 %v，期望该月最后一天", i+1, next)
+		}
+		start = next
+	}
+}
+
+func TestDailySeries(t *testing.T) {
+	db := newTestDB(t)
+	now := utc(2026, 3, 10, 12)
+	for _, u := range []struct {
+		at    time.Time
+		delta int64
+	}{
+		{now, 100},
+		{now.Add(-time.Hour), 50},
+		{now.AddDate(0, 0, -2), 30},
+		{now.AddDate(0, 0, -30), 999}, // 超出查询范围
+	} {
+		if err := RecordUsage(db, "user-1", u.delta, u.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	series, err := DailySeries(db, "user-1", 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DailyUsage{{"2026-03-08", 30}, {"2026-03-09", 0}, {"2026-03-10", 150}}
+	if len(series) != len(want) {
+		t.Fatalf("每日用量 %+v，期望 %+v", series, want)
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Fatalf("每日用量 %+v，期望 %+v", series, want)
+		}
+	}
+}
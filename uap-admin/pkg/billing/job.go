@@ -0,0 +1,79 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// periodJobName 计费周期滚动任务的租约名
+const periodJobName = "billing_period_roll"
+
+// AcquireLease 获取或续约任务租约，成功返回 true
+// 租约过期前只有持有者能续约；持有者宕机后，其他副本在租约过期后接管
+func AcquireLease(db *gorm.DB, name, holder string, ttl time.Duration, now time.Time) (bool, error) {
+	result := db.Model(&models.JobLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": now.Add(ttl)})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	// 租约不存在：并发创建时只有一个副本成功
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.JobLease{
+		Name:      name,
+		Holder:    holder,
+		ExpiresAt: now.Add(ttl),
+	})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RunPeriodJob 运行计费周期滚动任务（启动时执行一次，之后每 interval 执行一次），直到 ctx 取消
+// 多个 uap-admin 副本共用数据库时，通过租约保证同一时刻只有一个副本执行
+func RunPeriodJob(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	run := func() {
+		now := time.Now()
+		ok, err := AcquireLease(db, periodJobName, holder, 3*interval, now)
+		if err != nil {
+			log.Printf("❌ 获取计费任务租约失败: %v", err)
+			return
+		}
+		if !ok {
+			return // 其他副本正在执行
+		}
+
+		rolled, err := RollPeriods(db, now)
+		if err != nil {
+			log.Printf("❌ 计费周期滚动失败: %v", err)
+			return
+		}
+		if rolled > 0 {
+			log.Printf("📅 已滚动 %d 个用户的计费周期", rolled)
+		}
+	}
+
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireLease(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+
+	if ok, err := AcquireLease(db, "job", "a", time.Minute, now); err != nil || !ok {
+		t.Fatalf("首次获取租约: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := AcquireLease(db, "job", "b", time.Minute, now.Add(time.Second)); ok {
+		t.Fatal("租约未过期时其他副本不能获取")
+	}
+	if ok, _ := AcquireLease(db, "job", "a", time.Minute, now.Add(30*time.Second)); !ok {
+		t.Fatal("持有者应能续约")
+	}
+	// 持有者宕机，租约过期后由其他副本接管
+	if ok, _ := AcquireLease(db, "job", "b", time.Minute, now.Add(2*time.Minute)); !ok {
+		t.Fatal("租约过期后其他副本应能接管")
+	}
+	if ok, _ := AcquireLease(db, "job", "a", time.Minute, now.Add(2*time.Minute)); ok {
+		t.Fatal("接管后原持有者不能再续约")
+	}
+}
+
+func TestRunPeriodJobStops(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunPeriodJob(ctx, db, time.Hour)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ctx 取消后任务未退出")
+	}
+}
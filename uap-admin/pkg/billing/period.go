@@ -0,0 +1,95 @@
+package billing
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// RollPeriods 滚动所有已到期用户的计费周期，返回滚动的用户数
+func RollPeriods(db *gorm.DB, now time.Time) (int, error) {
+	// 旧用户没有计费周期起点：从注册时刻开始
+	if err := db.Model(&models.User{}).Where("period_start IS NULL").
+		Update("period_start", gorm.Expr("created_at")).Error; err != nil {
+		return 0, err
+	}
+
+	// 最短的计费周期是 28 天，先粗筛再逐个精确判断
+	var candidates []models.User
+	if err := db.Select("uuid").Where("period_start <= ?", now.AddDate(0, 0, -28)).
+		Find(&candidates).Error; err != nil {
+		return 0, err
+	}
+
+	rolled := 0
+	for _, c := range candidates {
+		ok, err := rollUserPeriod(db, c.UUID, now)
+		if err != nil {
+			log.Printf("❌ 计费周期滚动失败: UUID=%s, err=%v", c.UUID, err)
+			continue
+		}
+		if ok {
+			rolled++
+		}
+	}
+	return rolled, nil
+}
+
+// rollUserPeriod 结束用户当前计费周期：快照用量，扣减已用流量，清除预警记录
+// 扣减快照值而不是直接清零：快照之后才入账的并发上报流量会留在新周期，不会丢失
+// 通过 period_start < 新周期起点的条件更新保证同一周期只被滚动一次
+func rollUserPeriod(db *gorm.DB, userUUID string, now time.Time) (bool, error) {
+	rolled := false
+	err := database.Transaction(db, func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		end, ok := PeriodEnd(user)
+		if !ok || end.After(now) {
+			return nil // 尚未到期
+		}
+		start := *user.PeriodStart
+
+		// 服务停机跨越多个周期时直接滚动到当前周期，期间用量全部计入被关闭的周期，
+		// 快照的结束时间即新周期的开始时间，历史周期之间不留空档
+		anchor := AnchorDay(user)
+		newStart := end
+		for next := NextPeriodStart(newStart, anchor); !next.After(now); next = NextPeriodStart(newStart, anchor) {
+			newStart = next
+		}
+
+		used := user.TrafficUsedBytes
+		result := tx.Model(&models.User{}).
+			Where("uuid = ? AND period_start < ?", userUUID, newStart).
+			Updates(map[string]interface{}{
+				"traffic_used_bytes":   gorm.Expr("traffic_used_bytes - ?", used),
+				"period_start":         newStart,
+				"quota_warned_percent": 0,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // 已被其他副本滚动
+		}
+
+		rolled = true
+		return tx.Create(&models.UsagePeriod{
+			UserUUID:    userUUID,
+			PeriodStart: start,
+			PeriodEnd:   newStart,
+			UsedBytes:   used,
+			LimitBytes:  user.TrafficLimitBytes,
+		}).Error
+	})
+	return rolled, err
+}
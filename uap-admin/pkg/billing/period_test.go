@@ -0,0 +1,151 @@
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// createUser 创建在 createdAt 注册、已用 used 字节的用户
+func createUser(t testing.TB, db *gorm.DB, uuid string, createdAt time.Time, used int64) {
+	t.Helper()
+	user := models.User{UUID: uuid, WalletPubKey: "wallet-" + uuid, TrafficUsedBytes: used, CreatedAt: createdAt}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadUser 重新读取用户
+func loadUser(t testing.TB, db *gorm.DB, uuid string) models.User {
+	t.Helper()
+	var user models.User
+	if err := db.Where("uuid = ?", uuid).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// loadPeriods 用户的历史周期快照（按开始时间升序）
+func loadPeriods(t testing.TB, db *gorm.DB, uuid string) []models.UsagePeriod {
+	t.Helper()
+	var periods []models.UsagePeriod
+	if err := db.Where("user_uuid = ?", uuid).Order("period_start").Find(&periods).Error; err != nil {
+		t.Fatal(err)
+	}
+	return periods
+}
+
+// roll 在 now 执行一次滚动任务
+func roll(t testing.TB, db *gorm.DB, now time.Time) int {
+	t.Helper()
+	n, err := RollPeriods(db, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// checkContiguous 历史快照首尾相接，最后一个快照的结束时间即当前周期的开始时间
+func checkContiguous(t testing.TB, periods []models.UsagePeriod, current time.Time) {
+	t.Helper()
+	for i := 1; i < len(periods); i++ {
+		if !periods[i].PeriodStart.Equal(periods[i-1].PeriodEnd) {
+			t.Fatalf("快照 %d 结束于 %v，快照 %d 开始于 %v", i-1, periods[i-1].PeriodEnd, i, periods[i].PeriodStart)
+		}
+	}
+	if len(periods) > 0 && !periods[len(periods)-1].PeriodEnd.Equal(current) {
+		t.Fatalf("最后一个快照结束于 %v，当前周期开始于 %v", periods[len(periods)-1].PeriodEnd, current)
+	}
+}
+
+func TestRollPeriodAcrossShortMonth(t *testing.T) {
+	db := newTestDB(t)
+	createUser(t, db, "u", utc(2026, 1, 31, 12), 500)
+
+	// 边界前一刻不滚动
+	if n := roll(t, db, utc(2026, 2, 28, 12).Add(-time.Second)); n != 0 {
+		t.Fatalf("到期前滚动了 %d 个用户", n)
+	}
+	if n := roll(t, db, utc(2026, 2, 28, 12)); n != 1 {
+		t.Fatalf("到期时滚动了 %d 个用户", n)
+	}
+	user := loadUser(t, db, "u")
+	if !user.PeriodStart.Equal(utc(2026, 2, 28, 12)) || user.TrafficUsedBytes != 0 {
+		t.Fatalf("滚动后的周期 %v / 用量 %d", user.PeriodStart, user.TrafficUsedBytes)
+	}
+
+	// 短月之后回到锚定日：3 月 28 日不滚动，3 月 31 日滚动
+	if n := roll(t, db, utc(2026, 3, 28, 12)); n != 0 {
+		t.Fatal("锚定日在短月之后漂移到了 28 日")
+	}
+	if n := roll(t, db, utc(2026, 3, 31, 12)); n != 1 {
+		t.Fatal("3 月 31 日未滚动")
+	}
+
+	user = loadUser(t, db, "u")
+	periods := loadPeriods(t, db, "u")
+	if len(periods) != 2 || periods[0].UsedBytes != 500 || periods[1].UsedBytes != 0 {
+		t.Fatalf("历史快照 %+v", periods)
+	}
+	checkContiguous(t, periods, *user.PeriodStart)
+}
+
+func TestRollPeriodSkipsMultiplePeriods(t *testing.T) {
+	db := newTestDB(t)
+	createUser(t, db, "u", utc(2026, 1, 31, 12), 700)
+
+	// 服务停机到 5 月中旬：一次滚动到当前周期，停机期间的用量计入同一个快照
+	if n := roll(t, db, utc(2026, 5, 15, 0)); n != 1 {
+		t.Fatalf("滚动了 %d 个用户", n)
+	}
+	user := loadUser(t, db, "u")
+	if !user.PeriodStart.Equal(utc(2026, 4, 30, 12)) {
+		t.Fatalf("当前周期开始于 %v，期望 4 月 30 日", user.PeriodStart)
+	}
+	periods := loadPeriods(t, db, "u")
+	if len(periods) != 1 || !periods[0].PeriodStart.Equal(utc(2026, 1, 31, 12)) || periods[0].UsedBytes != 700 {
+		t.Fatalf("历史快照 %+v", periods)
+	}
+	checkContiguous(t, periods, *user.PeriodStart)
+
+	// 之后仍按锚定日滚动
+	if n := roll(t, db, utc(2026, 5, 31, 12)); n != 1 {
+		t.Fatal("5 月 31 日未滚动")
+	}
+	user = loadUser(t, db, "u")
+	checkContiguous(t, loadPeriods(t, db, "u"), *user.PeriodStart)
+}
+
+func TestRollPeriodOnce(t *testing.T) {
+	db := newTestDB(t)
+	createUser(t, db, "u", utc(2026, 1, 10, 0), 300)
+	if n := roll(t, db, utc(2026, 2, 10, 0)); n != 1 {
+		t.Fatal("到期未滚动")
+	}
+	// 同一周期不会被重复滚动
+	if n := roll(t, db, utc(2026, 2, 10, 1)); n != 0 {
+		t.Fatalf("同一周期被再次滚动 %d 次", n)
+	}
+	if periods := loadPeriods(t, db, "u"); len(periods) != 1 {
+		t.Fatalf("历史快照 %+v", periods)
+	}
+}
+
+func TestRollPeriodBackfillsLegacyUsers(t *testing.T) {
+	db := newTestDB(t)
+	createUser(t, db, "legacy", utc(2026, 1, 31, 12), 100)
+	if err := db.Model(&models.User{}).Where("uuid = ?", "legacy").Update("period_start", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := roll(t, db, utc(2026, 2, 28, 12)); n != 1 {
+		t.Fatalf("旧用户滚动了 %d 次", n)
+	}
+	user := loadUser(t, db, "legacy")
+	if !user.PeriodStart.Equal(utc(2026, 2, 28, 12)) {
+		t.Fatalf("旧用户的当前周期开始于 %v", user.PeriodStart)
+	}
+}
@@ -0,0 +1,88 @@
+package custody
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultMasterKeyFile 默认主密钥文件
+const DefaultMasterKeyFile = "wallet_master.key"
+
+// KeyringFromEnv 从环境变量加载主密钥集合
+// UAP_WALLET_MASTER_KEY: 当前主密钥（64 位 Hex）；未设置时读取 UAP_WALLET_MASTER_KEY_FILE（默认 wallet_master.key）
+// UAP_WALLET_MASTER_KEY_PREVIOUS / UAP_WALLET_MASTER_KEY_PREVIOUS_FILE: 轮换期间仍可解密的旧主密钥（可选）
+// generate 为 true 时主密钥文件不存在则自动生成（仅服务端首次启动使用，运维命令不会生成新密钥）
+func KeyringFromEnv(generate bool) (*Keyring, error) {
+	primary, err := keyFromEnv("UAP_WALLET_MASTER_KEY", "UAP_WALLET_MASTER_KEY_FILE", DefaultMasterKeyFile, generate)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := keyFromEnv("UAP_WALLET_MASTER_KEY_PREVIOUS", "UAP_WALLET_MASTER_KEY_PREVIOUS_FILE", "", false)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return NewKeyring(primary)
+	}
+	return NewKeyring(primary, previous)
+}
+
+// keyFromEnv 读取 Hex 编码的主密钥：环境变量优先，其次是文件；都未设置且没有默认文件时返回 nil
+func keyFromEnv(valueEnv, fileEnv, defaultFile string, generate bool) ([]byte, error) {
+	if raw := strings.TrimSpace(os.Getenv(valueEnv)); raw != "" {
+		key, err := decodeKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s 无效: %w", valueEnv, err)
+		}
+		return key, nil
+	}
+
+	path := strings.TrimSpace(os.Getenv(fileEnv))
+	if path == "" {
+		path = defaultFile
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && generate {
+		return generateKeyFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取钱包主密钥文件失败: %w", err)
+	}
+	key, err := decodeKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("钱包主密钥文件 %s 无效: %w", path, err)
+	}
+	return key, nil
+}
+
+// decodeKey 解码 Hex 主密钥
+func decodeKey(raw string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("必须是 Hex 编码: %w", err)
+	}
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("长度错误（期望 %d 字节，实际 %d 字节）", MasterKeySize, len(key))
+	}
+	return key, nil
+}
+
+// generateKeyFile 生成新的主密钥并保存（仅所有者可读）
+func generateKeyFile(path string) ([]byte, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("生成钱包主密钥失败: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("写入钱包主密钥文件失败: %w", err)
+	}
+	fmt.Printf("✅ 钱包主密钥已生成: %s（请妥善备份，丢失后托管钱包私钥无法解密）\n", path)
+	return key, nil
+}
@@ -0,0 +1,262 @@
+package custody
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"uap-admin/pkg/models"
+)
+
+// 托管钱包私钥的信封加密
+// 每个用户生成独立的数据密钥 (DEK) 加密私钥，DEK 再由主密钥加密后与密文一起存入 wallet_priv_key：
+//
+//	enc:v1:<主密钥 ID>:<Base64(加密后的 DEK)>:<Base64(加密后的私钥)>
+//
+// 两层均为 AES-256-GCM（随机 12 字节 nonce 前置），附加数据绑定用户 UUID，密文不能挪到其他用户行使用
+// 轮换主密钥只需重新加密 DEK，私钥密文保持不变
+
+// MasterKeySize 主密钥长度（AES-256）
+const MasterKeySize = 32
+
+// encPrefix 已加密字段的前缀（旧数据为 128 位 Hex 明文）
+const encPrefix = "enc:v1:"
+
+// ErrUnknownKey 密文使用的主密钥不在当前密钥集合中
+var ErrUnknownKey = errors.New("未知的钱包主密钥")
+
+// masterKey 主密钥
+type masterKey struct {
+	id   string // SHA-256 前 8 字节的 Hex，写入密文用于轮换时识别
+	aead cipher.AEAD
+}
+
+// Keyring 主密钥集合：primary 加密新的数据密钥，其余密钥只用于解密（轮换期间）
+type Keyring struct {
+	primary *masterKey
+	keys    map[string]*masterKey
+}
+
+// NewKeyring 创建主密钥集合，previous 为轮换前的旧主密钥
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*masterKey)}
+	for i, raw := range append([][]byte{primary}, previous...) {
+		mk, err := newMasterKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			k.primary = mk
+		}
+		if _, ok := k.keys[mk.id]; !ok {
+			k.keys[mk.id] = mk
+		}
+	}
+	return k, nil
+}
+
+// newMasterKey 校验主密钥长度并计算 ID
+func newMasterKey(raw []byte) (*masterKey, error) {
+	if len(raw) != MasterKeySize {
+		return nil, fmt.Errorf("钱包主密钥长度错误（期望 %d 字节，实际 %d 字节）", MasterKeySize, len(raw))
+	}
+	aead, err := newGCM(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// PrimaryID 当前主密钥 ID
+func (k *Keyring) PrimaryID() string {
+	return k.primary.id
+}
+
+// Seal 加密托管私钥，返回写入 wallet_priv_key 的字符串
+func (k *Keyring) Seal(userUUID string, plaintext []byte) (string, error) {
+	dek := make([]byte, MasterKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("生成数据密钥失败: %w", err)
+	}
+	dekAEAD, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dekAEAD, plaintext, dataAAD(userUUID))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.primary.aead, dek, dekAAD(userUUID))
+	if err != nil {
+		return "", err
+	}
+	return format(k.primary.id, wrapped, ciphertext), nil
+}
+
+// Open 解密托管私钥；未加密的旧数据按 Hex 明文解码
+func (k *Keyring) Open(userUUID, stored string) ([]byte, error) {
+	if !IsEncrypted(stored) {
+		return hex.DecodeString(stored)
+	}
+	kid, wrapped, ciphertext, err := parse(stored)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := k.unwrap(userUUID, kid, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	dekAEAD, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(dekAEAD, ciphertext, dataAAD(userUUID))
+	if err != nil {
+		return nil, fmt.Errorf("解密钱包私钥失败: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap 用当前主密钥重新加密数据密钥（私钥密文不变）
+// 已由当前主密钥加密时原样返回，changed 为 false
+func (k *Keyring) Rewrap(userUUID, stored string) (rewrapped string, changed bool, err error) {
+	if !IsEncrypted(stored) {
+		return "", false, fmt.Errorf("钱包私钥尚未加密")
+	}
+	kid, wrapped, ciphertext, err := parse(stored)
+	if err != nil {
+		return "", false, err
+	}
+	if kid == k.primary.id {
+		return stored, false, nil
+	}
+	dek, err := k.unwrap(userUUID, kid, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	wrapped, err = seal(k.primary.aead, dek, dekAAD(userUUID))
+	if err != nil {
+		return "", false, err
+	}
+	return format(k.primary.id, wrapped, ciphertext), true, nil
+}
+
+// unwrap 用密文记录的主密钥解密数据密钥
+func (k *Keyring) unwrap(userUUID, kid string, wrapped []byte) ([]byte, error) {
+	mk, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	dek, err := open(mk.aead, wrapped, dekAAD(userUUID))
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %w", err)
+	}
+	return dek, nil
+}
+
+// IsEncrypted wallet_priv_key 是否已加密
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, encPrefix)
+}
+
+// KeyID 密文使用的主密钥 ID（未加密时为空）
+func KeyID(stored string) string {
+	if !IsEncrypted(stored) {
+		return ""
+	}
+	kid, _, _ := strings.Cut(strings.TrimPrefix(stored, encPrefix), ":")
+	return kid
+}
+
+// dataAAD / dekAAD 两层加密的附加数据（绑定用户 UUID）
+func dataAAD(userUUID string) []byte { return []byte("uap-wallet-key|" + userUUID) }
+func dekAAD(userUUID string) []byte  { return []byte("uap-wallet-dek|" + userUUID) }
+
+// newGCM 创建 AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密并把 nonce 前置到密文
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成 nonce 失败: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open 解密 nonce 前置的密文
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("密文过短")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+// format 拼接存储格式
+func format(kid string, wrapped, ciphertext []byte) string {
+	return encPrefix + kid + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+// parse 解析存储格式
+func parse(stored string) (kid string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(stored, encPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("钱包私钥密文格式错误")
+	}
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("钱包私钥密文格式错误: %w", err)
+	}
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("钱包私钥密文格式错误: %w", err)
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
+
+// defaultKeyring 服务启动时加载的主密钥集合
+var defaultKeyring *Keyring
+
+// Init 设置服务使用的主密钥集合，必须在创建托管钱包之前调用
+func Init(k *Keyring) {
+	defaultKeyring = k
+}
+
+// SealPrivateKey 加密新建托管钱包的私钥
+func SealPrivateKey(userUUID string, priv ed25519.PrivateKey) (string, error) {
+	if defaultKeyring == nil {
+		return "", errors.New("钱包主密钥未初始化")
+	}
+	return defaultKeyring.Seal(userUUID, priv)
+}
+
+// PrivateKey 读取用户的托管钱包私钥（自托管钱包返回 nil）
+func PrivateKey(u *models.User) (ed25519.PrivateKey, error) {
+	if u.WalletPrivKey == "" {
+		return nil, nil
+	}
+	if defaultKeyring == nil {
+		return nil, errors.New("钱包主密钥未初始化")
+	}
+	raw, err := defaultKeyring.Open(u.UUID, u.WalletPrivKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("钱包私钥长度错误（期望 %d 字节，实际 %d 字节）", ed25519.PrivateKeySize, len(raw))
+	}
+	return ed25519.PrivateKey(raw), nil
+}
@@ -0,0 +1,175 @@
+package custody
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"uap-admin/pkg/models"
+)
+
+// newMasterKeyBytes 随机主密钥
+func newMasterKeyBytes(t testing.TB) []byte {
+	t.Helper()
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newKeyring 创建主密钥集合
+func newKeyring(t testing.TB, primary []byte, previous ...[]byte) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(primary, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := newKeyring(t, newMasterKeyBytes(t))
+	secret := []byte("wallet private key")
+
+	stored, err := k.Seal("user-1", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(stored) || KeyID(stored) != k.PrimaryID() || strings.Contains(stored, hex.EncodeToString(secret)) {
+		t.Fatalf("密文格式 %q", stored)
+	}
+	got, err := k.Open("user-1", stored)
+	if err != nil || string(got) != string(secret) {
+		t.Fatalf("解密结果 %q, %v", got, err)
+	}
+
+	// 同一明文每次加密结果不同（独立的数据密钥与 nonce）
+	again, _ := k.Seal("user-1", secret)
+	if again == stored {
+		t.Fatal("两次加密得到相同的密文")
+	}
+}
+
+func TestOpenRejectsMisuse(t *testing.T) {
+	k := newKeyring(t, newMasterKeyBytes(t))
+	stored, err := k.Seal("user-1", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 密文绑定用户：挪到其他用户行无法解密
+	if _, err := k.Open("user-2", stored); err == nil {
+		t.Fatal("其他用户的密文解密成功")
+	}
+	// 篡改密文
+	tampered := stored[:len(stored)-2] + "AA"
+	if tampered == stored {
+		tampered = stored[:len(stored)-2] + "BB"
+	}
+	if _, err := k.Open("user-1", tampered); err == nil {
+		t.Fatal("篡改后的密文解密成功")
+	}
+	// 其他主密钥
+	other := newKeyring(t, newMasterKeyBytes(t))
+	if _, err := other.Open("user-1", stored); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("未知主密钥: %v", err)
+	}
+	if _, err := k.Open("user-1", encPrefix+"broken"); err == nil {
+		t.Fatal("格式错误的密文解密成功")
+	}
+	if _, err := NewKeyring(make([]byte, 16)); err == nil {
+		t.Fatal("长度错误的主密钥应被拒绝")
+	}
+}
+
+func TestOpenLegacyPlaintext(t *testing.T) {
+	k := newKeyring(t, newMasterKeyBytes(t))
+	got, err := k.Open("user-1", "00ff")
+	if err != nil || hex.EncodeToString(got) != "00ff" {
+		t.Fatalf("明文旧数据: %x, %v", got, err)
+	}
+	if _, _, err := k.Rewrap("user-1", "00ff"); err == nil {
+		t.Fatal("明文数据不能直接轮换")
+	}
+}
+
+func TestDecryptAfterRotate(t *testing.T) {
+	oldKey, newKey := newMasterKeyBytes(t), newMasterKeyBytes(t)
+	old := newKeyring(t, oldKey)
+	stored, err := old.Seal("user-1", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换期间：新主密钥为 primary，旧主密钥仍可解密
+	rotating := newKeyring(t, newKey, oldKey)
+	if got, err := rotating.Open("user-1", stored); err != nil || string(got) != "secret" {
+		t.Fatalf("轮换期间解密: %q, %v", got, err)
+	}
+	rewrapped, changed, err := rotating.Rewrap("user-1", stored)
+	if err != nil || !changed || KeyID(rewrapped) != rotating.PrimaryID() {
+		t.Fatalf("重新加密: changed=%v kid=%s err=%v", changed, KeyID(rewrapped), err)
+	}
+	// 私钥密文不变，只替换数据密钥的加密
+	if stored[strings.LastIndex(stored, ":"):] != rewrapped[strings.LastIndex(rewrapped, ":"):] {
+		t.Fatal("轮换改变了私钥密文")
+	}
+	if _, changed, _ := rotating.Rewrap("user-1", rewrapped); changed {
+		t.Fatal("已使用当前主密钥的密文被重复轮换")
+	}
+
+	// 移除旧主密钥后：轮换过的可以解密，未轮换的不行
+	rotated := newKeyring(t, newKey)
+	if got, err := rotated.Open("user-1", rewrapped); err != nil || string(got) != "secret" {
+		t.Fatalf("轮换后解密: %q, %v", got, err)
+	}
+	if _, err := rotated.Open("user-1", stored); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("旧主密钥移除后解密未轮换的密文: %v", err)
+	}
+}
+
+func TestPrivateKey(t *testing.T) {
+	defer Init(defaultKeyring)
+	Init(newKeyring(t, newMasterKeyBytes(t)))
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealPrivateKey("user-1", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := PrivateKey(&models.User{UUID: "user-1", WalletPrivKey: sealed})
+	if err != nil || !got.Equal(priv) {
+		t.Fatalf("托管私钥: %v", err)
+	}
+	if got, err := PrivateKey(&models.User{UUID: "user-1"}); got != nil || err != nil {
+		t.Fatalf("自托管钱包应返回 nil: %v, %v", got, err)
+	}
+	if _, err := PrivateKey(&models.User{UUID: "user-1", WalletPrivKey: hex.EncodeToString(priv[:10])}); err == nil {
+		t.Fatal("长度错误的私钥应返回错误")
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	primary, previous := newMasterKeyBytes(t), newMasterKeyBytes(t)
+	t.Setenv("UAP_WALLET_MASTER_KEY", hex.EncodeToString(primary))
+	t.Setenv("UAP_WALLET_MASTER_KEY_PREVIOUS", hex.EncodeToString(previous))
+	k, err := KeyringFromEnv(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.PrimaryID() != newKeyring(t, primary).PrimaryID() || len(k.keys) != 2 {
+		t.Fatalf("主密钥集合 primary=%s keys=%d", k.PrimaryID(), len(k.keys))
+	}
+
+	t.Setenv("UAP_WALLET_MASTER_KEY", "xyz")
+	if _, err := KeyringFromEnv(false); err == nil {
+		t.Fatal("无效的主密钥应返回错误")
+	}
+}
@@ -0,0 +1,89 @@
+package custody
+
+import (
+	"fmt"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// migrateBatchSize 批量处理托管钱包时每批读取的用户数
+const migrateBatchSize = 200
+
+// PlaintextCount 仍以明文存储托管私钥的用户数（包括已软删除的用户）
+func PlaintextCount(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Unscoped().Model(&models.User{}).
+		Where("wallet_priv_key <> '' AND wallet_priv_key NOT LIKE ?", encPrefix+"%").
+		Count(&count).Error
+	return count, err
+}
+
+// KeyStats 托管私钥按主密钥 ID 统计的行数（明文行的 ID 为空）
+func KeyStats(db *gorm.DB) (map[string]int, error) {
+	var values []string
+	if err := db.Unscoped().Model(&models.User{}).Where("wallet_priv_key <> ''").
+		Pluck("wallet_priv_key", &values).Error; err != nil {
+		return nil, err
+	}
+	stats := make(map[string]int)
+	for _, v := range values {
+		stats[KeyID(v)]++
+	}
+	return stats, nil
+}
+
+// EncryptPlaintext 用当前主密钥加密所有明文托管私钥，返回处理的行数
+func EncryptPlaintext(db *gorm.DB, k *Keyring) (int, error) {
+	return updateEach(db, func(u *models.User) (string, bool, error) {
+		if IsEncrypted(u.WalletPrivKey) {
+			return "", false, nil
+		}
+		raw, err := k.Open(u.UUID, u.WalletPrivKey)
+		if err != nil {
+			return "", false, err
+		}
+		sealed, err := k.Seal(u.UUID, raw)
+		return sealed, err == nil, err
+	})
+}
+
+// Rewrap 用当前主密钥重新加密所有旧主密钥下的数据密钥，返回处理的行数
+func Rewrap(db *gorm.DB, k *Keyring) (int, error) {
+	return updateEach(db, func(u *models.User) (string, bool, error) {
+		if !IsEncrypted(u.WalletPrivKey) {
+			return "", false, nil
+		}
+		return k.Rewrap(u.UUID, u.WalletPrivKey)
+	})
+}
+
+// updateEach 逐行转换托管私钥，每批一个事务；遇到错误时停止（已提交的批次保留，可重复执行）
+func updateEach(db *gorm.DB, convert func(u *models.User) (string, bool, error)) (int, error) {
+	updated := 0
+	var users []models.User
+	result := db.Unscoped().Select("id", "uuid", "wallet_priv_key").
+		Where("wallet_priv_key <> ''").
+		FindInBatches(&users, migrateBatchSize, func(*gorm.DB, int) error {
+			return database.Transaction(db, func(tx *gorm.DB) error {
+				for i := range users {
+					value, changed, err := convert(&users[i])
+					if err != nil {
+						return fmt.Errorf("用户 %s: %w", users[i].UUID, err)
+					}
+					if !changed {
+						continue
+					}
+					if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", users[i].ID).
+						UpdateColumn("wallet_priv_key", value).Error; err != nil {
+						return err
+					}
+					updated++
+				}
+				return nil
+			})
+		})
+	return updated, result.Error
+}
@@ -0,0 +1,128 @@
+package custody
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 在临时目录创建已迁移到最新结构的数据库
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createLegacyUsers 创建 n 个以 Hex 明文存储托管私钥的用户，返回 UUID -> 私钥
+func createLegacyUsers(t testing.TB, db *gorm.DB, n int) map[string]ed25519.PrivateKey {
+	t.Helper()
+	keys := make(map[string]ed25519.PrivateKey)
+	for i := 0; i < n; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := models.User{
+			UUID:          "user-" + strconv.Itoa(i),
+			WalletPubKey:  hex.EncodeToString(pub),
+			WalletPrivKey: hex.EncodeToString(priv),
+		}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		keys[user.UUID] = priv
+	}
+	return keys
+}
+
+// checkDecrypts 每个用户的托管私钥都能用 k 解密为原始私钥
+func checkDecrypts(t testing.TB, db *gorm.DB, k *Keyring, keys map[string]ed25519.PrivateKey) {
+	t.Helper()
+	var users []models.User
+	if err := db.Unscoped().Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		want, ok := keys[u.UUID]
+		if !ok {
+			continue
+		}
+		raw, err := k.Open(u.UUID, u.WalletPrivKey)
+		if err != nil || !ed25519.PrivateKey(raw).Equal(want) {
+			t.Fatalf("用户 %s 的私钥: %v", u.UUID, err)
+		}
+	}
+}
+
+func TestEncryptPlaintextThenRotate(t *testing.T) {
+	db := newTestDB(t)
+	keys := createLegacyUsers(t, db, migrateBatchSize+5) // 跨越两个批次
+	// 已软删除的用户同样需要加密
+	if err := db.Where("uuid = ?", "user-0").Delete(&models.User{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 自托管钱包（没有私钥）不受影响
+	selfCustody := models.User{UUID: "self", WalletPubKey: "self-pub"}
+	if err := db.Create(&selfCustody).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := newMasterKeyBytes(t)
+	old := newKeyring(t, oldKey)
+	n, err := EncryptPlaintext(db, old)
+	if err != nil || n != len(keys) {
+		t.Fatalf("加密了 %d 行: %v", n, err)
+	}
+	if count, _ := PlaintextCount(db); count != 0 {
+		t.Fatalf("加密后仍有 %d 行明文", count)
+	}
+	if n, _ := EncryptPlaintext(db, old); n != 0 {
+		t.Fatalf("重复执行又加密了 %d 行", n)
+	}
+	checkDecrypts(t, db, old, keys)
+
+	// 轮换主密钥：重新加密数据密钥后，只用新主密钥即可解密
+	newKey := newMasterKeyBytes(t)
+	rotating := newKeyring(t, newKey, oldKey)
+	if n, err := Rewrap(db, rotating); err != nil || n != len(keys) {
+		t.Fatalf("轮换了 %d 行: %v", n, err)
+	}
+	stats, err := KeyStats(db)
+	if err != nil || len(stats) != 1 || stats[rotating.PrimaryID()] != len(keys) {
+		t.Fatalf("轮换后的主密钥分布 %v, %v", stats, err)
+	}
+	checkDecrypts(t, db, newKeyring(t, newKey), keys)
+}
+
+func TestRewrapStopsOnUnknownKey(t *testing.T) {
+	db := newTestDB(t)
+	createLegacyUsers(t, db, 2)
+	if _, err := EncryptPlaintext(db, newKeyring(t, newMasterKeyBytes(t))); err != nil {
+		t.Fatal(err)
+	}
+	// 新主密钥集合中没有加密时使用的主密钥：报错且不修改数据
+	if _, err := Rewrap(db, newKeyring(t, newMasterKeyBytes(t))); err == nil {
+		t.Fatal("缺少旧主密钥时轮换应失败")
+	}
+}
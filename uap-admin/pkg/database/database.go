@@ -0,0 +1,63 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// busyTimeoutMs SQLite 等待写锁的最长时间（毫秒）
+const busyTimeoutMs = 5000
+
+// 锁冲突重试参数
+const (
+	maxRetries   = 5
+	retryBackoff = 20 * time.Millisecond
+)
+
+// Open 打开 SQLite 数据库
+// WAL 模式下读写互不阻塞；busy_timeout 让写锁冲突时在驱动内等待而不是立即报错；
+// _txlock=immediate 让事务在 BEGIN 时就获取写锁，避免读事务升级为写事务时的死锁（此时 busy_timeout 不生效）
+func Open(path string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		path, busyTimeoutMs)
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+}
+
+// IsBusy 判断是否为 SQLite 锁冲突错误（SQLITE_BUSY / SQLITE_LOCKED）
+func IsBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := strings.ToLower(err.Error())
+	return strings.Contains(errStr, "database is locked") ||
+		strings.Contains(errStr, "sqlite_busy") ||
+		strings.Contains(errStr, "database table is locked")
+}
+
+// Retry 执行 fn，遇到锁冲突时带随机抖动指数退避重试（最多 maxRetries 次）
+// fn 必须可以安全地重复执行（通常是一个完整的事务）
+func Retry(fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if err = fn(); !IsBusy(err) {
+			return err
+		}
+		if attempt < maxRetries {
+			backoff := retryBackoff << attempt
+			time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff))))
+		}
+	}
+	return err
+}
+
+// Transaction 执行事务，锁冲突时整体重试
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return Retry(func() error {
+		return db.Transaction(fn)
+	})
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testRow 测试用的表
+type testRow struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"uniqueIndex"`
+	Count int
+}
+
+// openTestDB 在临时目录打开数据库并建好测试表
+func openTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if err := db.AutoMigrate(&testRow{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestIsBusy(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"database is locked (5) (SQLITE_BUSY)": true,
+		"SQLITE_BUSY":                          true,
+		"database table is locked":             true,
+		"UNIQUE constraint failed":             false,
+	} {
+		if got := IsBusy(errors.New(msg)); got != want {
+			t.Errorf("IsBusy(%q) = %v，期望 %v", msg, got, want)
+		}
+	}
+	if IsBusy(nil) {
+		t.Error("IsBusy(nil) 应为 false")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	busy := errors.New("database is locked")
+
+	calls := 0
+	err := Retry(func() error {
+		calls++
+		if calls < 3 {
+			return busy
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("锁冲突后重试: calls=%d err=%v", calls, err)
+	}
+
+	calls = 0
+	other := errors.New("constraint failed")
+	if err := Retry(func() error { calls++; return other }); err != other || calls != 1 {
+		t.Fatalf("非锁冲突错误不应重试: calls=%d err=%v", calls, err)
+	}
+
+	calls = 0
+	if err := Retry(func() error { calls++; return busy }); err != busy || calls != maxRetries+1 {
+		t.Fatalf("持续锁冲突: calls=%d err=%v", calls, err)
+	}
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.Create(&testRow{Name: "counter"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 读后写的事务并发执行：immediate 事务 + 重试保证不丢更新、不报锁冲突
+	const workers, rounds = 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				errs <- Transaction(db, func(tx *gorm.DB) error {
+					var row testRow
+					if err := tx.Where("name = ?", "counter").First(&row).Error; err != nil {
+						return err
+					}
+					return tx.Model(&row).Update("count", row.Count+1).Error
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var row testRow
+	db.Where("name = ?", "counter").First(&row)
+	if row.Count != workers*rounds {
+		t.Fatalf("计数 %d，期望 %d", row.Count, workers*rounds)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration 一次版本化的结构变更
+// 版本号只能递增追加，已发布的迁移不可修改；Up 在事务中执行，应能在任意旧版本的结构上安全运行
+// （例如先用 tx.Migrator().HasColumn 检查，AutoMigrate 不会做的删列、改类型在这里显式完成）
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+// TableName 指定表名
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrate 初始化或升级数据库结构，返回本次执行的迁移数
+// 全新数据库：AutoMigrate 按当前模型建表，所有迁移直接记为已执行；
+// 已有数据库：按版本号顺序执行尚未执行的迁移，每个迁移与其记录在同一事务中提交，重复执行或多个副本同时启动时不会重复迁移
+func Migrate(db *gorm.DB, models []interface{}, migrations []Migration) (int, error) {
+	for i := range migrations {
+		if migrations[i].Version <= 0 || (i > 0 && migrations[i].Version <= migrations[i-1].Version) {
+			return 0, fmt.Errorf("迁移版本号必须为正数且严格递增: %d (%s)", migrations[i].Version, migrations[i].Name)
+		}
+	}
+
+	migrator := db.Migrator()
+	fresh := !migrator.HasTable(&SchemaMigration{})
+	for _, model := range models {
+		if migrator.HasTable(model) {
+			fresh = false
+			break
+		}
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return 0, err
+	}
+
+	if fresh {
+		if err := db.AutoMigrate(models...); err != nil {
+			return 0, err
+		}
+		if len(migrations) == 0 {
+			return 0, nil
+		}
+		now := time.Now()
+		records := make([]SchemaMigration, 0, len(migrations))
+		for _, m := range migrations {
+			records = append(records, SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: now})
+		}
+		if err := Retry(func() error {
+			return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+		}); err != nil {
+			return 0, err
+		}
+		log.Printf("✅ 新建数据库结构（迁移版本 %d）", migrations[len(migrations)-1].Version)
+		return 0, nil
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		ran := false
+		err := Transaction(db, func(tx *gorm.DB) error {
+			ran = false
+			var count int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("迁移 %d (%s) 失败: %w", m.Version, m.Name, err)
+		}
+		if ran {
+			applied++
+			log.Printf("✅ 已执行数据库迁移 %d: %s", m.Version, m.Name)
+		}
+	}
+	return applied, nil
+}
+
+// SchemaVersion 已执行的最高迁移版本（没有记录时为 0）
+func SchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
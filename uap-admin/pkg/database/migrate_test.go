@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// countingMigrations 版本为 versions 的迁移，每次执行时在 testRow 中记一次（Name 为 "m<版本>"）
+func countingMigrations(versions ...int) []Migration {
+	var migrations []Migration
+	for _, v := range versions {
+		name := fmt.Sprintf("m%d", v)
+		migrations = append(migrations, Migration{Version: v, Name: name, Up: func(tx *gorm.DB) error {
+			return tx.Create(&testRow{Name: name, Count: 1}).Error
+		}})
+	}
+	return migrations
+}
+
+// ranCount 迁移 name 被执行的次数
+func ranCount(t *testing.T, db *gorm.DB, name string) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(&testRow{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMigrateFresh(t *testing.T) {
+	db := openTestDB(t)
+	// testRow 已存在：已有数据库；这里换一个不存在的模型模拟全新数据库
+	type freshRow struct {
+		ID   uint
+		Note string
+	}
+	applied, err := Migrate(db, []interface{}{&freshRow{}}, countingMigrations(1, 2))
+	if err != nil || applied != 0 {
+		t.Fatalf("全新数据库执行了 %d 个迁移: %v", applied, err)
+	}
+	// 全新数据库直接建成最新结构，迁移只记录不执行
+	if !db.Migrator().HasTable(&freshRow{}) || ranCount(t, db, "m1")+ranCount(t, db, "m2") != 0 {
+		t.Fatal("全新数据库未建表或执行了迁移")
+	}
+	if version, err := SchemaVersion(db); err != nil || version != 2 {
+		t.Fatalf("迁移版本 %d: %v", version, err)
+	}
+}
+
+func TestMigrateAppliesPendingOnce(t *testing.T) {
+	db := openTestDB(t)
+	models := []interface{}{&testRow{}}
+
+	applied, err := Migrate(db, models, countingMigrations(1, 2))
+	if err != nil || applied != 2 {
+		t.Fatalf("已有数据库执行了 %d 个迁移: %v", applied, err)
+	}
+	// 重复执行是空操作
+	if applied, err := Migrate(db, models, countingMigrations(1, 2)); err != nil || applied != 0 {
+		t.Fatalf("重复执行了 %d 个迁移: %v", applied, err)
+	}
+	// 追加的迁移只执行一次
+	if applied, err := Migrate(db, models, countingMigrations(1, 2, 5)); err != nil || applied != 1 {
+		t.Fatalf("追加迁移后执行了 %d 个: %v", applied, err)
+	}
+	for _, name := range []string{"m1", "m2", "m5"} {
+		if n := ranCount(t, db, name); n != 1 {
+			t.Errorf("迁移 %s 执行了 %d 次", name, n)
+		}
+	}
+	if version, _ := SchemaVersion(db); version != 5 {
+		t.Fatalf("迁移版本 %d", version)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	models := []interface{}{&testRow{}}
+	failing := errors.New("迁移失败")
+	broken := append(countingMigrations(1), Migration{Version: 2, Name: "broken", Up: func(tx *gorm.DB) error {
+		tx.Create(&testRow{Name: "partial"})
+		return failing
+	}})
+
+	applied, err := Migrate(db, models, broken)
+	if !errors.Is(err, failing) || applied != 1 {
+		t.Fatalf("返回 %d, %v", applied, err)
+	}
+	// 失败的迁移与其记录一起回滚，之前的迁移保持已执行
+	if ranCount(t, db, "partial") != 0 {
+		t.Fatal("失败的迁移未回滚")
+	}
+	if version, _ := SchemaVersion(db); version != 1 {
+		t.Fatalf("迁移版本 %d，期望 1", version)
+	}
+
+	// 修复后重新执行只补上失败的迁移
+	if applied, err := Migrate(db, models, countingMigrations(1, 2)); err != nil || applied != 1 {
+		t.Fatalf("修复后执行了 %d 个迁移: %v", applied, err)
+	}
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	models := []interface{}{&testRow{}}
+	var calls atomic.Int32
+	migrations := []Migration{{Version: 1, Name: "once", Up: func(tx *gorm.DB) error {
+		calls.Add(1)
+		return nil
+	}}}
+
+	// 多个副本同时启动时每个迁移只执行一次
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Migrate(db, models, migrations); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("迁移执行了 %d 次", calls.Load())
+	}
+}
+
+func TestMigrateRejectsBadVersions(t *testing.T) {
+	db := openTestDB(t)
+	for name, versions := range map[string][]int{
+		"非正数": {0, 1},
+		"重复":  {1, 1},
+		"未递增": {2, 1},
+	} {
+		if _, err := Migrate(db, []interface{}{&testRow{}}, countingMigrations(versions...)); err == nil {
+			t.Errorf("%s的版本号应返回错误", name)
+		}
+	}
+}
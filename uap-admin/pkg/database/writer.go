@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// writeJob 一次写入请求
+type writeJob struct {
+	fn   func(tx *gorm.DB) error
+	done chan error
+}
+
+// Writer 单写协程：高频写入（节点上报等）排队后合并到同一个事务中批量提交
+// 每个写入请求在独立的 SAVEPOINT 中执行，单个请求失败只回滚自己，不影响同批其他请求
+type Writer struct {
+	db       *gorm.DB
+	jobs     chan writeJob
+	maxBatch int
+}
+
+// NewWriter 创建单写协程（需调用 Run 启动）
+// queueSize: 排队上限（队列满时 Submit 阻塞，形成背压）
+// maxBatch: 每个事务最多合并的写入请求数
+func NewWriter(db *gorm.DB, queueSize, maxBatch int) *Writer {
+	return &Writer{
+		db:       db,
+		jobs:     make(chan writeJob, queueSize),
+		maxBatch: maxBatch,
+	}
+}
+
+// Submit 提交一次写入并等待提交结果
+// fn 可能因锁冲突随整批重试而被执行多次，必须只通过 tx 读写数据库
+func (w *Writer) Submit(fn func(tx *gorm.DB) error) error {
+	done := make(chan error, 1)
+	w.jobs <- writeJob{fn: fn, done: done}
+	return <-done
+}
+
+// Run 依次取出排队的写入请求，尽量多地合并到同一批，直到 ctx 取消
+// 退出前会把已排队的写入全部提交（调用方应先停止接收新请求）
+func (w *Writer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for w.flush() {
+			}
+			return
+		case job := <-w.jobs:
+			w.run(w.collect(job))
+		}
+	}
+}
+
+// flush 提交一批已排队的写入，队列为空时返回 false
+func (w *Writer) flush() bool {
+	select {
+	case job := <-w.jobs:
+		w.run(w.collect(job))
+		return true
+	default:
+		return false
+	}
+}
+
+// collect 以 first 开头，尽量多地合并已排队的写入请求
+func (w *Writer) collect(first writeJob) []writeJob {
+	batch := []writeJob{first}
+	for len(batch) < w.maxBatch {
+		select {
+		case next := <-w.jobs:
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// run 在一个事务中执行一批写入请求
+func (w *Writer) run(batch []writeJob) {
+	errs := make([]error, len(batch))
+	err := Transaction(w.db, func(tx *gorm.DB) error {
+		for i, job := range batch {
+			savepoint := fmt.Sprintf("job%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			errs[i] = job.fn(tx)
+			if errs[i] == nil {
+				continue
+			}
+			if IsBusy(errs[i]) {
+				return errs[i] // 锁冲突：整批重试
+			}
+			if err := tx.RollbackTo(savepoint).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for i, job := range batch {
+		if err != nil {
+			job.done <- err
+		} else {
+			job.done <- errs[i]
+		}
+	}
+}
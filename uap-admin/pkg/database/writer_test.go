@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// startWriter 启动单写协程，测试结束时停止
+func startWriter(t testing.TB, db *gorm.DB, queueSize, maxBatch int) *Writer {
+	t.Helper()
+	w := NewWriter(db, queueSize, maxBatch)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return w
+}
+
+// waitQueued 等待 n 个写入请求进入队列
+func waitQueued(t testing.TB, w *Writer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(w.jobs) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("排队的写入请求 %d 个，期望 %d", len(w.jobs), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriterCommitsAll(t *testing.T) {
+	db := openTestDB(t)
+	w := startWriter(t, db, 16, 8)
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := w.Submit(func(tx *gorm.DB) error {
+				return tx.Create(&testRow{Name: fmt.Sprintf("row-%d", i)}).Error
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var count int64
+	db.Model(&testRow{}).Count(&count)
+	if count != n {
+		t.Fatalf("写入 %d 行，期望 %d", count, n)
+	}
+}
+
+func TestWriterIsolatesFailedJob(t *testing.T) {
+	db := openTestDB(t)
+	w := NewWriter(db, 8, 8)
+	if err := db.Create(&testRow{Name: "taken"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 三个请求合并在同一批：中间的请求先写入一行再违反唯一约束，只回滚它自己
+	results := make([]chan error, 3)
+	jobs := []func(tx *gorm.DB) error{
+		func(tx *gorm.DB) error { return tx.Create(&testRow{Name: "a"}).Error },
+		func(tx *gorm.DB) error {
+			if err := tx.Create(&testRow{Name: "partial"}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&testRow{Name: "taken"}).Error
+		},
+		func(tx *gorm.DB) error { return tx.Create(&testRow{Name: "b"}).Error },
+	}
+	for i, fn := range jobs {
+		results[i] = make(chan error, 1)
+		go func(i int, fn func(tx *gorm.DB) error) { results[i] <- w.Submit(fn) }(i, fn)
+	}
+	waitQueued(t, w, len(jobs)) // 全部请求排队后再启动，保证合并为一批
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	for i, want := range []bool{true, false, true} {
+		if err := <-results[i]; (err == nil) != want {
+			t.Fatalf("请求 %d: err=%v", i, err)
+		}
+	}
+	var names []string
+	db.Model(&testRow{}).Order("name").Pluck("name", &names)
+	if fmt.Sprint(names) != "[a b taken]" {
+		t.Fatalf("提交的行 %v，期望 [a b taken]", names)
+	}
+}
+
+func TestWriterFlushesOnShutdown(t *testing.T) {
+	db := openTestDB(t)
+	w := NewWriter(db, 8, 2)
+
+	results := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			results <- w.Submit(func(tx *gorm.DB) error {
+				return tx.Create(&testRow{Name: fmt.Sprintf("row-%d", i)}).Error
+			})
+		}(i)
+	}
+	waitQueued(t, w, 5)
+
+	// 已取消的 ctx：Run 只提交已排队的写入后退出
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+	for i := 0; i < 5; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
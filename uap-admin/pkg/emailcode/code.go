@@ -0,0 +1,60 @@
+package emailcode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// 验证码字符集
+const (
+	AlphabetDigits = "0123456789"
+	// AlphabetAlnum 大写字母与数字，去掉容易混淆的 0 / O、1 / I / L
+	AlphabetAlnum = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+)
+
+// 验证码长度范围
+const (
+	MinCodeLength = 6
+	MaxCodeLength = 16
+)
+
+// CodeFormat 验证码格式（长度与字符集）
+type CodeFormat struct {
+	Length   int
+	Alphabet string
+}
+
+// DefaultCodeFormat 默认 6 位数字（便于手机输入）
+var DefaultCodeFormat = CodeFormat{Length: 6, Alphabet: AlphabetDigits}
+
+// Validate 校验验证码格式
+func (f CodeFormat) Validate() error {
+	if f.Length < MinCodeLength || f.Length > MaxCodeLength {
+		return fmt.Errorf("验证码长度需在 %d-%d 之间: %d", MinCodeLength, MaxCodeLength, f.Length)
+	}
+	if f.Alphabet != AlphabetDigits && f.Alphabet != AlphabetAlnum {
+		return fmt.Errorf("未知的验证码字符集: %q", f.Alphabet)
+	}
+	return nil
+}
+
+// Generate 使用 crypto/rand 生成验证码（每位在字符集中均匀选取）
+func (f CodeFormat) Generate() (string, error) {
+	max := big.NewInt(int64(len(f.Alphabet)))
+	code := make([]byte, f.Length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("生成验证码失败: %w", err)
+		}
+		code[i] = f.Alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NormalizeCode 规范化用户输入的验证码（去掉首尾空白，字母统一为大写）
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
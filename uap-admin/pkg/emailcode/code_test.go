@@ -0,0 +1,110 @@
+package emailcode
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// withRandReader 测试期间替换 crypto/rand 的随机源
+func withRandReader(t *testing.T, r io.Reader) {
+	old := rand.Reader
+	rand.Reader = r
+	t.Cleanup(func() { rand.Reader = old })
+}
+
+// failingReader 读取总是失败的随机源
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("entropy exhausted") }
+
+func TestCodeFormatValidate(t *testing.T) {
+	for _, ok := range []CodeFormat{
+		DefaultCodeFormat,
+		{Length: MinCodeLength, Alphabet: AlphabetAlnum},
+		{Length: MaxCodeLength, Alphabet: AlphabetDigits},
+	} {
+		if err := ok.Validate(); err != nil {
+			t.Errorf("%+v: %v", ok, err)
+		}
+	}
+	for _, bad := range []CodeFormat{
+		{Length: MinCodeLength - 1, Alphabet: AlphabetDigits},
+		{Length: MaxCodeLength + 1, Alphabet: AlphabetAlnum},
+		{Length: 8, Alphabet: "abc"},
+		{Length: 8},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%+v 应返回错误", bad)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for _, f := range []CodeFormat{DefaultCodeFormat, {Length: 8, Alphabet: AlphabetAlnum}, {Length: MaxCodeLength, Alphabet: AlphabetAlnum}} {
+		seen := make(map[rune]bool)
+		codes := make(map[string]bool)
+		for i := 0; i < 500; i++ {
+			code, err := f.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(code) != f.Length {
+				t.Fatalf("验证码 %q 长度 %d，期望 %d", code, len(code), f.Length)
+			}
+			for _, c := range code {
+				if !strings.ContainsRune(f.Alphabet, c) {
+					t.Fatalf("验证码 %q 含字符集外的字符 %q", code, c)
+				}
+				seen[c] = true
+			}
+			codes[code] = true
+		}
+		// 每个字符都可能出现，验证码不重复（6 位数字 500 个验证码重复的概率约 12%，只要求绝大多数不同）
+		if len(seen) != len(f.Alphabet) {
+			t.Errorf("%d 位验证码只出现了 %d / %d 个字符", f.Length, len(seen), len(f.Alphabet))
+		}
+		if len(codes) < 495 {
+			t.Errorf("%d 位验证码 500 个中只有 %d 个不同", f.Length, len(codes))
+		}
+	}
+	// 默认格式：6 位数字
+	if DefaultCodeFormat.Length != 6 || DefaultCodeFormat.Alphabet != AlphabetDigits {
+		t.Fatalf("默认格式 %+v", DefaultCodeFormat)
+	}
+	// 字符集不含容易混淆的字符
+	if strings.ContainsAny(AlphabetAlnum, "01OIL") {
+		t.Fatalf("字符集 %q 含易混淆字符", AlphabetAlnum)
+	}
+}
+
+func TestGenerateUsesCryptoRand(t *testing.T) {
+	// 随机数取自 crypto/rand：替换其随机源后结果随之确定
+	withRandReader(t, bytes.NewReader(make([]byte, 1024)))
+	code, err := CodeFormat{Length: 8, Alphabet: AlphabetAlnum}.Generate()
+	if err != nil || code != strings.Repeat(AlphabetAlnum[:1], 8) {
+		t.Fatalf("全零随机源生成 %q: %v", code, err)
+	}
+
+	// 随机源不可用时返回错误，而不是退回到可预测的随机数
+	withRandReader(t, failingReader{})
+	if code, err := DefaultCodeFormat.Generate(); err == nil {
+		t.Fatalf("随机源失败时生成了 %q", code)
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	for in, want := range map[string]string{
+		"123456":      "123456",
+		" 123456\n":   "123456",
+		"abcd2345":    "ABCD2345",
+		"\tAbCd2345 ": "ABCD2345",
+	} {
+		if got := NormalizeCode(in); got != want {
+			t.Errorf("NormalizeCode(%q) = %q，期望 %q", in, got, want)
+		}
+	}
+}
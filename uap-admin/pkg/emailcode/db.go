@@ -0,0 +1,83 @@
+package emailcode
+
+import (
+	"errors"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore 数据库存储（email_codes 表），管理后台重启后已发送的验证码仍然有效
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore 创建数据库存储（需要先迁移 models.EmailCode）
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Save 见 Store
+func (s *DBStore) Save(email, code string, expiresAt time.Time) error {
+	row := models.EmailCode{
+		Email:     email,
+		CodeHash:  HashCode(email, code),
+		ExpiresAt: expiresAt,
+	}
+	return database.Retry(func() error {
+		return s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "email"}},
+			DoUpdates: clause.AssignmentColumns([]string{"code_hash", "expires_at", "attempts", "created_at"}),
+		}).Create(&row).Error
+	})
+}
+
+// Consume 见 Store
+// 读取、计数和删除在同一事务中完成，并发提交同一验证码只有一个请求成功
+func (s *DBStore) Consume(email, code string, now time.Time) error {
+	var result error
+	err := database.Transaction(s.db, func(tx *gorm.DB) error {
+		result = nil
+		var row models.EmailCode
+		if err := tx.Where("email = ?", email).First(&row).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				result = ErrNotFound
+				return nil
+			}
+			return err
+		}
+
+		if now.After(row.ExpiresAt) {
+			result = ErrNotFound
+			return tx.Delete(&row).Error
+		}
+		if !hashEqual(row.CodeHash, HashCode(email, code)) {
+			if row.Attempts+1 >= MaxAttempts {
+				result = ErrTooManyAttempts
+				return tx.Delete(&row).Error
+			}
+			result = ErrMismatch
+			return tx.Model(&row).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		return tx.Delete(&row).Error
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// DeleteExpired 见 Store
+func (s *DBStore) DeleteExpired(now time.Time) (int64, error) {
+	var n int64
+	err := database.Retry(func() error {
+		res := s.db.Where("expires_at < ?", now).Delete(&models.EmailCode{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
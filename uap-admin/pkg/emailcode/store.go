@@ -0,0 +1,125 @@
+package emailcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// MaxAttempts 单个验证码允许的错误次数，达到后验证码作废
+const MaxAttempts = 5
+
+// 校验失败的原因（存储本身出错时返回其他错误）
+var (
+	ErrNotFound        = errors.New("验证码不存在或已过期")
+	ErrMismatch        = errors.New("验证码错误")
+	ErrTooManyAttempts = errors.New("验证码错误次数过多，请重新获取")
+)
+
+// Store 邮箱验证码存储
+// 每个邮箱只保留最近一次发送的验证码；过期在读取时判断，DeleteExpired 只负责回收空间
+type Store interface {
+	// Save 保存验证码（覆盖该邮箱之前的验证码并重置错误次数）
+	Save(email, code string, expiresAt time.Time) error
+	// Consume 校验验证码，通过后删除（一次性）；错误次数达到 MaxAttempts 后删除
+	Consume(email, code string, now time.Time) error
+	// DeleteExpired 删除已过期的验证码，返回删除数量
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// HashCode 验证码哈希（绑定邮箱，存储中不保存明文）
+func HashCode(email, code string) string {
+	sum := sha256.Sum256([]byte("uap-email-code|" + email + "|" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashEqual 常量时间比较哈希
+func hashEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// RunCleaner 定期删除过期验证码，直到 ctx 取消
+func RunCleaner(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := store.DeleteExpired(now); err != nil {
+				log.Printf("⚠️ 清理过期验证码失败: %v", err)
+			}
+		}
+	}
+}
+
+// memoryEntry 内存存储的验证码
+type memoryEntry struct {
+	hash      string
+	expiresAt time.Time
+	attempts  int
+}
+
+// MemoryStore 内存存储（进程重启后未使用的验证码全部失效，适合开发环境）
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Save 见 Store
+func (s *MemoryStore) Save(email, code string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[email] = &memoryEntry{hash: HashCode(email, code), expiresAt: expiresAt}
+	return nil
+}
+
+// Consume 见 Store
+func (s *MemoryStore) Consume(email, code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[email]
+	if !ok {
+		return ErrNotFound
+	}
+	if now.After(entry.expiresAt) {
+		delete(s.entries, email)
+		return ErrNotFound
+	}
+	if !hashEqual(entry.hash, HashCode(email, code)) {
+		entry.attempts++
+		if entry.attempts >= MaxAttempts {
+			delete(s.entries, email)
+			return ErrTooManyAttempts
+		}
+		return ErrMismatch
+	}
+	delete(s.entries, email)
+	return nil
+}
+
+// DeleteExpired 见 Store
+func (s *MemoryStore) DeleteExpired(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for email, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, email)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,180 @@
+package emailcode
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 打开（不存在时创建）path 处已迁移的数据库，测试结束时关闭
+func openTestDB(t testing.TB, path string) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	return db
+}
+
+// closeDB 关闭数据库连接（重复关闭无影响）
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// stores 两种存储实现，用同一组用例测试
+func stores(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"db":     NewDBStore(openTestDB(t, filepath.Join(t.TempDir(), "test.db"))),
+	}
+}
+
+func TestStoreConsume(t *testing.T) {
+	now := time.Now()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Save("a@uap.test", "123456", now.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			// 验证码绑定邮箱
+			if err := store.Consume("b@uap.test", "123456", now); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("其他邮箱校验返回 %v", err)
+			}
+			if err := store.Consume("a@uap.test", "123456", now); err != nil {
+				t.Fatal(err)
+			}
+			// 一次性：通过后删除
+			if err := store.Consume("a@uap.test", "123456", now); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("重复使用返回 %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	now := time.Now()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Save("a@uap.test", "123456", now.Add(time.Minute))
+			store.Save("b@uap.test", "654321", now.Add(time.Hour))
+
+			// 过期在读取时判断，不依赖清理任务
+			if err := store.Consume("a@uap.test", "123456", now.Add(2*time.Minute)); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("过期验证码返回 %v", err)
+			}
+			store.Save("a@uap.test", "123456", now.Add(time.Minute))
+			if n, err := store.DeleteExpired(now.Add(2 * time.Minute)); err != nil || n != 1 {
+				t.Fatalf("删除了 %d 个过期验证码: %v", n, err)
+			}
+			if err := store.Consume("b@uap.test", "654321", now.Add(2*time.Minute)); err != nil {
+				t.Fatalf("未过期的验证码被删除: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreAttempts(t *testing.T) {
+	now := time.Now()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Save("a@uap.test", "123456", now.Add(time.Minute))
+			for i := 1; i < MaxAttempts; i++ {
+				if err := store.Consume("a@uap.test", "000000", now); !errors.Is(err, ErrMismatch) {
+					t.Fatalf("第 %d 次错误返回 %v", i, err)
+				}
+			}
+			if err := store.Consume("a@uap.test", "000000", now); !errors.Is(err, ErrTooManyAttempts) {
+				t.Fatalf("错误次数达到上限返回 %v", err)
+			}
+			// 达到上限后验证码作废，正确的验证码也不再通过
+			if err := store.Consume("a@uap.test", "123456", now); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("作废的验证码返回 %v", err)
+			}
+
+			// 重新发送覆盖旧验证码并重置错误次数
+			store.Save("a@uap.test", "111111", now.Add(time.Minute))
+			store.Consume("a@uap.test", "000000", now)
+			store.Save("a@uap.test", "222222", now.Add(time.Minute))
+			for i := 1; i < MaxAttempts; i++ {
+				store.Consume("a@uap.test", "000000", now)
+			}
+			if err := store.Consume("a@uap.test", "111111", now); !errors.Is(err, ErrTooManyAttempts) {
+				t.Fatalf("旧验证码返回 %v", err)
+			}
+		})
+	}
+}
+
+func TestDBStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	now := time.Now()
+
+	db := openTestDB(t, path)
+	if err := NewDBStore(db).Save("a@uap.test", "123456", now.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	NewDBStore(db).Consume("a@uap.test", "000000", now)
+
+	// 只存哈希
+	var row models.EmailCode
+	if err := db.Where("email = ?", "a@uap.test").First(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.CodeHash != HashCode("a@uap.test", "123456") || row.Attempts != 1 {
+		t.Fatalf("存储的验证码 %+v", row)
+	}
+	closeDB(db)
+
+	// 重启后（重新打开数据库）之前发送的验证码仍然有效，错误次数保留
+	store := NewDBStore(openTestDB(t, path))
+	for i := 2; i < MaxAttempts; i++ {
+		store.Consume("a@uap.test", "000000", now)
+	}
+	if err := store.Consume("a@uap.test", "123456", now.Add(time.Minute)); err != nil {
+		t.Fatalf("重启后校验验证码失败: %v", err)
+	}
+}
+
+func TestDBStoreConsumeOnce(t *testing.T) {
+	store := NewDBStore(openTestDB(t, filepath.Join(t.TempDir(), "test.db")))
+	now := time.Now()
+	store.Save("a@uap.test", "123456", now.Add(time.Minute))
+
+	// 并发提交同一验证码只有一个请求成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Consume("a@uap.test", "123456", now)
+			if err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrNotFound) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Fatalf("%d 个请求校验成功", ok)
+	}
+}
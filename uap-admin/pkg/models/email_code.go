@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// EmailCode 邮箱验证码（每个邮箱只保留最近一次发送的验证码，只存哈希）
+type EmailCode struct {
+	ID        uint      `gorm:"primaryKey"`
+	Email     string    `gorm:"uniqueIndex;not null"`
+	CodeHash  string    `gorm:"not null"`       // 见 emailcode.HashCode
+	ExpiresAt time.Time `gorm:"index;not null"` // 过期后读取时视为不存在，由清理任务删除
+	Attempts  int       `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// TableName 指定表名
+func (EmailCode) TableName() string {
+	return "email_codes"
+}
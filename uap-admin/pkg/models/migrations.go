@@ -0,0 +1,93 @@
+package models
+
+import (
+	"log"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+// All 全部模型（全新数据库按当前定义建表）
+func All() []interface{} {
+	return []interface{}{&User{}, &Node{}, &Session{}, &Notification{},
+		&UsageLedger{}, &UsagePeriod{}, &JobLease{}, &EmailCode{}}
+}
+
+// Migrations 数据库结构迁移，按版本号递增追加，已发布的迁移不可修改
+// 修改模型后必须追加对应的迁移：全新数据库由 AutoMigrate 直接建成最新结构，已有数据库只执行这里的迁移
+var Migrations = []database.Migration{
+	{
+		// 引入迁移机制之前的数据库都由 AutoMigrate 维护，先补齐到当前结构
+		Version: 1, Name: "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(All()...)
+		},
+	},
+	{
+		Version: 2, Name: "node_draining",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&Node{}, "Draining") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&Node{}, "Draining")
+		},
+	},
+	{
+		Version: 3, Name: "node_public_key_normalize",
+		Up: normalizeNodePublicKeys,
+	},
+	{
+		Version: 4, Name: "node_client_connect",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"ClientConnectRate", "ClientConnectAt"} {
+				if tx.Migrator().HasColumn(&Node{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&Node{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// normalizeNodePublicKeys 把已有节点的公钥改写为规范化的 PEM（注册接口此后按规范化公钥去重）
+// 无法解析的公钥保持原样；规范化后与其他节点重复的只记录日志、保持原样，由管理员删除多余的节点
+func normalizeNodePublicKeys(tx *gorm.DB) error {
+	var nodes []Node
+	if err := tx.Select("id", "address", "public_key").Order("id").Find(&nodes).Error; err != nil {
+		return err
+	}
+	// 已是规范格式的公钥先占位，改写其他节点时不会与之冲突
+	owner := make(map[string]uint, len(nodes)) // 规范化公钥 -> 使用该公钥的节点
+	keys := make([]string, len(nodes))
+	for i, n := range nodes {
+		key, err := utils.NormalizePublicKeyPEM(n.PublicKey)
+		if err != nil {
+			log.Printf("⚠️  节点 %d (%s) 的公钥无法解析，保持原样: %v", n.ID, n.Address, err)
+			continue
+		}
+		keys[i] = key
+		if key == n.PublicKey {
+			owner[key] = n.ID
+		}
+	}
+	for i, n := range nodes {
+		key := keys[i]
+		if key == "" || key == n.PublicKey {
+			continue
+		}
+		if id, ok := owner[key]; ok {
+			log.Printf("⚠️  节点 %d (%s) 与节点 %d 的公钥相同（仅格式不同），保持原样，请删除多余的节点", n.ID, n.Address, id)
+			continue
+		}
+		owner[key] = n.ID
+		if err := tx.Model(&Node{}).Where("id = ?", n.ID).Update("public_key", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
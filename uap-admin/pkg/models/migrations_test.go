@@ -0,0 +1,135 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/utils"
+
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestMigrationsUpgradeLegacySchema(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// 引入迁移机制之前由 AutoMigrate 维护的节点表：没有后来追加的列，公钥是 Windows 换行的 PEM
+	if err := db.Exec(`CREATE TABLE nodes (
+		id integer PRIMARY KEY AUTOINCREMENT, name text, address text, public_key text,
+		region text, is_vip numeric, status integer, weight integer DEFAULT 100)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := utils.EncodePublicKeyPEM(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf := strings.ReplaceAll(string(pem), "\n", "\r\n")
+	if err := db.Exec(`INSERT INTO nodes (name, address, public_key, status) VALUES (?, ?, ?, 1)`, "legacy", "legacy:443", crlf).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := database.Migrate(db, All(), Migrations)
+	if err != nil || applied != len(Migrations) {
+		t.Fatalf("执行了 %d 个迁移: %v", applied, err)
+	}
+	for _, column := range []string{"Draining", "Score", "ClientConnectRate", "ClientConnectAt"} {
+		if !db.Migrator().HasColumn(&Node{}, column) {
+			t.Errorf("迁移后缺少列 %s", column)
+		}
+	}
+	var node Node
+	if err := db.First(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	if node.PublicKey != string(pem) || node.Score != MaxNodeScore {
+		t.Fatalf("迁移后的节点 %+v", node)
+	}
+
+	// 重复执行是空操作
+	if applied, err := database.Migrate(db, All(), Migrations); err != nil || applied != 0 {
+		t.Fatalf("重复执行了 %d 个迁移: %v", applied, err)
+	}
+	if version, _ := database.SchemaVersion(db); version != Migrations[len(Migrations)-1].Version {
+		t.Fatalf("迁移版本 %d", version)
+	}
+}
+
+// TestNormalizeNodePublicKeys 规范化已有节点的公钥：与已是规范格式的节点重复的保持原样，无法解析的保持原样
+func TestNormalizeNodePublicKeys(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "nodes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if _, err := database.Migrate(db, All(), Migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	newKey := func() string {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pem, err := utils.EncodePublicKeyPEM(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem)
+	}
+	shared, other := newKey(), newKey()
+	crlf := func(key string) string { return strings.ReplaceAll(key, "\n", "\r\n") }
+	nodes := []Node{
+		{Name: "dup-first", PublicKey: crlf(shared)}, // 较早登记但格式不规范
+		{Name: "canonical", PublicKey: shared},
+		{Name: "other", PublicKey: crlf(other)},
+		{Name: "garbage", PublicKey: "not a key"},
+	}
+	for i := range nodes {
+		nodes[i].Address = nodes[i].Name + ":443"
+		if err := db.Create(&nodes[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := normalizeNodePublicKeys(db); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{crlf(shared), shared, other, "not a key"} {
+		var got Node
+		if err := db.First(&got, nodes[i].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.PublicKey != want {
+			t.Errorf("节点 %s 的公钥 %q，期望 %q", got.Name, got.PublicKey, want)
+		}
+	}
+}
@@ -1,14 +1,46 @@
 package models
 
+import "time"
+
+// 选路权重范围：客户端在延迟相近（容差内）的节点中优先选择权重高的
+const (
+	DefaultNodeWeight = 100
+	MinNodeWeight     = 1
+	MaxNodeWeight     = 1000
+)
+
+// MaxNodeScore 节点质量评分上限（没有任何评分数据的节点为满分）
+const MaxNodeScore = 100
+
 // Node 节点模型
+// 客户端按 status（及 region）查询在线节点，由 (status, region) 复合索引覆盖；
+// 签发连接票据按 address + status 查找，由 (address, status) 复合索引覆盖
 type Node struct {
 	ID        uint   `gorm:"primaryKey" json:"id"`
-	Name      string `json:"name"`                          // 节点名称 (e.g. "🇺🇸 美国高速-01")
-	Address   string `json:"address"`                       // 域名:端口 (e.g. "uaptest.org:52222")
-	PublicKey string `gorm:"uniqueIndex" json:"public_key"` // 该节点的 Ed25519 公钥 (用于客户端验签，唯一)
-	Region    string `json:"region"`                        // 地区 (US, JP, HK)
-	IsVIP     bool   `json:"is_vip"`                        // 是否 VIP 节点
-	Status    int    `json:"status"`                        // 1:在线, 0:下线
+	Name      string `json:"name"`                                                                                             // 节点名称 (e.g. "🇺🇸 美国高速-01")
+	Address   string `gorm:"index:idx_nodes_address_status,priority:1" json:"address"`                                         // 域名:端口 (e.g. "uaptest.org:52222")
+	PublicKey string `gorm:"uniqueIndex" json:"public_key"`                                                                    // 该节点的 Ed25519 公钥 (用于客户端验签，唯一)
+	Region    string `gorm:"index:idx_nodes_status_region,priority:2" json:"region"`                                           // 地区 (US, JP, HK)
+	IsVIP     bool   `json:"is_vip"`                                                                                           // 是否 VIP 节点
+	Status    int    `gorm:"index:idx_nodes_status_region,priority:1;index:idx_nodes_address_status,priority:2" json:"status"` // 1:在线, 0:下线
+	Weight    int    `gorm:"default:100" json:"weight"`                                                                        // 选路权重 (1-1000，默认 100，越大越优先)
+	Score     int    `gorm:"default:100" json:"score"`                                                                         // 质量评分 (0-100，由健康检查任务定期计算，越大越好)
+	Pinned    bool   `gorm:"-" json:"pinned,omitempty"`                                                                        // 当前用户的固定节点（粘性选路时下发，不落库）
+
+	LastReportAt *time.Time `json:"-"`                               // 最后一次上报时间（NULL 表示从未上报，不参与健康检查）
+	Draining     bool       `gorm:"not null;default:false" json:"-"` // 维护模式（由节点上报）：排空期间不下发给客户端、不签发连接票据
+
+	// 质量评分的输入指标
+	Capacity        int        `json:"-"` // 承载能力（并发连接数，注册时设置；0 表示负载不参与评分）
+	ActiveConns     int        `json:"-"` // 最近一次上报的活跃连接数
+	ProbeLatencyMs  float64    `json:"-"` // 健康检查拨测延迟（毫秒，成功拨测的指数移动平均）
+	ProbeSuccess    float64    `json:"-"` // 健康检查拨测成功率（0-1，指数移动平均）
+	ProbedAt        *time.Time `json:"-"` // 最近一次拨测时间（NULL 表示尚未拨测）
+	ClientLatencyMs float64    `json:"-"` // 客户端上报的测速延迟（毫秒，指数移动平均，测速失败按超时计入）
+	ClientReportAt  *time.Time `json:"-"` // 最近一次客户端上报时间（NULL 表示没有客户端上报）
+
+	ClientConnectRate float64    `json:"-"` // 客户端上报的连接成功率（0-1，指数移动平均）
+	ClientConnectAt   *time.Time `json:"-"` // 最近一次客户端连接上报时间（NULL 表示没有连接上报）
 }
 
 // TableName 指定表名
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Notification 待推送给客户端的通知（客户端轮询 /client/status 时取走，只投递一次）
+type Notification struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserUUID    string     `gorm:"index;not null" json:"-"` // 接收用户
+	Kind        string     `gorm:"not null" json:"kind"`    // 通知类型 (e.g. "quota_warning")
+	Percent     int        `json:"percent,omitempty"`       // 用量预警阈值（quota_warning）
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `gorm:"index" json:"-"` // 投递时间（NULL 表示待投递）
+}
+
+// TableName 指定表名
+func (Notification) TableName() string {
+	return "notifications"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session 活跃会话（由节点定期上报，用于"在线设备"展示）
+type Session struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	SessionID   string    `gorm:"uniqueIndex:idx_node_session;not null" json:"session_id"` // 节点生成的会话 ID（每条 QUIC 连接一个）
+	NodeID      uint      `gorm:"uniqueIndex:idx_node_session;not null" json:"node_id"`    // 上报节点
+	UserUUID    string    `gorm:"index;not null" json:"user_uuid"`                         // 会话所属用户
+	ClientAddr  string    `json:"client_addr"`                                             // 客户端地址 (IP:Port)
+	ConnectedAt time.Time `json:"connected_at"`                                            // 连接建立时间
+	BytesUp     int64     `json:"bytes_up"`                                                // 上行字节数（客户端 -> 目标）
+	BytesDown   int64     `json:"bytes_down"`                                              // 下行字节数（目标 -> 客户端）
+	LastSeenAt  time.Time `gorm:"index" json:"last_seen_at"`                               // 最后一次出现在节点上报中的时间
+}
+
+// TableName 指定表名
+func (Session) TableName() string {
+	return "sessions"
+}
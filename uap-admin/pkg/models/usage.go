@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// UsageLedger 用户每日流量（由节点会话上报的增量累加，按 UTC 日期）
+type UsageLedger struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	UserUUID string `gorm:"uniqueIndex:idx_usage_user_day;not null" json:"-"`
+	Day      string `gorm:"uniqueIndex:idx_usage_user_day;not null" json:"day"` // YYYY-MM-DD (UTC)
+	Bytes    int64  `gorm:"not null;default:0" json:"bytes"`
+}
+
+// TableName 指定表名
+func (UsageLedger) TableName() string {
+	return "usage_ledgers"
+}
+
+// UsagePeriod 已结束计费周期的用量快照
+type UsagePeriod struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	UserUUID    string    `gorm:"index;not null" json:"-"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	UsedBytes   int64     `json:"used_bytes"`
+	LimitBytes  int64     `json:"limit_bytes"` // 周期结束时的流量上限（0 表示不限）
+}
+
+// TableName 指定表名
+func (UsagePeriod) TableName() string {
+	return "usage_periods"
+}
+
+// JobLease 定时任务租约（多副本部署时保证同一时刻只有一个副本执行）
+type JobLease struct {
+	Name      string    `gorm:"primaryKey"`
+	Holder    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// TableName 指定表名
+func (JobLease) TableName() string {
+	return "job_leases"
+}
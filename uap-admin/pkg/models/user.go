@@ -8,15 +8,26 @@ import (
 
 // User 用户模型
 type User struct {
-	ID            uint      `gorm:"primarykey" json:"id"`
-	UUID          string    `gorm:"uniqueIndex;not null" json:"uuid"`           // 用户唯一标识
-	WalletPubKey  string    `gorm:"uniqueIndex" json:"wallet_pub_key"`          // 钱包公钥（Ed25519，Hex 编码）
-	WalletPrivKey string    `gorm:"column:wallet_priv_key" json:"-"`            // 钱包私钥（Ed25519，Hex 编码，托管钱包使用，不返回给客户端）
-	Email         *string   `gorm:"uniqueIndex" json:"email"`                   // 邮箱（指针类型，允许 NULL）
-	GoogleID      *string   `gorm:"uniqueIndex" json:"google_id"`               // Google OAuth ID（指针类型，允许 NULL）
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint    `gorm:"primarykey" json:"id"`
+	UUID          string  `gorm:"uniqueIndex;not null" json:"uuid"`  // 用户唯一标识
+	WalletPubKey  string  `gorm:"uniqueIndex" json:"wallet_pub_key"` // 钱包公钥（Ed25519，Hex 编码）
+	WalletPrivKey string  `gorm:"column:wallet_priv_key" json:"-"`   // 托管钱包私钥（信封加密后的密文，通过 custody.PrivateKey 读取，不返回给客户端）
+	Email         *string `gorm:"uniqueIndex" json:"email"`          // 邮箱（指针类型，允许 NULL）
+	GoogleID      *string `gorm:"uniqueIndex" json:"google_id"`      // Google OAuth ID（指针类型，允许 NULL）
+
+	// 流量配额（按计费周期统计，用量由节点会话上报累加）
+	TrafficLimitBytes  int64      `gorm:"not null;default:0" json:"traffic_limit_bytes"` // 每个计费周期的流量上限（0 表示不限）
+	TrafficUsedBytes   int64      `gorm:"not null;default:0" json:"traffic_used_bytes"`  // 当前计费周期已用流量
+	QuotaWarnedPercent int        `gorm:"not null;default:0" json:"-"`                   // 当前计费周期已发出的最高用量预警阈值（周期重置时清零）
+	PeriodStart        *time.Time `json:"period_start"`                                  // 当前计费周期开始时间（每月在注册日的同一时刻滚动）
+
+	// 粘性选路：客户端开启后固定从同一节点出口，节点不健康或用户主动切换时清除
+	PinnedNodeID *uint      `json:"-"` // 固定节点（最近一次开启粘性选路时签发票据的节点）
+	PinnedAt     *time.Time `json:"-"` // 固定时间
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName 指定表名
@@ -24,3 +35,14 @@ func (User) TableName() string {
 	return "users"
 }
 
+// BeforeCreate 新用户的计费周期从注册时刻开始（与 created_at 为同一时刻，计费周期的锚定日由注册时间推出）
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	if u.PeriodStart == nil {
+		start := u.CreatedAt
+		u.PeriodStart = &start
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package nodehealth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"uap-admin/pkg/billing"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+// jobName 节点健康检查任务的租约名
+const jobName = "node_health_check"
+
+// MarkStale 把超过 offlineAfter 未上报的在线节点标记为下线，返回本次被标记的节点
+// 从未上报过的节点（未配置 -admin-url）不参与检查；节点再次上报时由上报接口恢复为在线
+func MarkStale(db *gorm.DB, now time.Time, offlineAfter time.Duration) ([]models.Node, error) {
+	cutoff := now.Add(-offlineAfter)
+	var stale []models.Node
+	if err := db.Where("status = ? AND last_report_at < ?", 1, cutoff).Find(&stale).Error; err != nil {
+		return nil, err
+	}
+
+	var marked []models.Node
+	for _, node := range stale {
+		var affected int64
+		err := database.Retry(func() error {
+			// 条件更新：查询之后节点恰好上报时不会被误标记
+			result := db.Model(&models.Node{}).
+				Where("id = ? AND status = ? AND last_report_at < ?", node.ID, 1, cutoff).
+				Update("status", 0)
+			affected = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return marked, err
+		}
+		if affected == 1 {
+			marked = append(marked, node)
+		}
+	}
+	return marked, nil
+}
+
+// RunChecker 定期拨测节点并更新质量评分、检查节点心跳（节点上报），直到 ctx 取消
+// 启动后先等待 offlineAfter 再开始检查心跳：管理后台停机期间节点上报失败，刚启动时所有节点的上报时间都已过期
+// 多个 uap-admin 副本共用数据库时，通过租约保证同一时刻只有一个副本执行
+func RunChecker(ctx context.Context, db *gorm.DB, interval, offlineAfter time.Duration, weights ScoreWeights) {
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	started := time.Now()
+
+	run := func(now time.Time) {
+		ok, err := billing.AcquireLease(db, jobName, holder, 3*interval, now)
+		if err != nil {
+			log.Printf("❌ 获取健康检查任务租约失败: %v", err)
+			return
+		}
+		if !ok {
+			return // 其他副本正在执行
+		}
+
+		if err := UpdateScores(db, now, weights, ProbeTCP); err != nil {
+			log.Printf("❌ 节点质量评分失败: %v", err)
+		}
+		if now.Sub(started) < offlineAfter {
+			return
+		}
+
+		marked, err := MarkStale(db, now, offlineAfter)
+		if err != nil {
+			log.Printf("❌ 节点健康检查失败: %v", err)
+		}
+		for _, node := range marked {
+			log.Printf("🔴 节点超时未上报，已标记下线: %s (%s)", node.Name, node.Address)
+			notify.Emit(notify.Event{
+				Kind: notify.KindNodeDown, Subject: node.Address, Time: now,
+				Message: fmt.Sprintf("节点 %s (%s) 超过 %v 未上报，已标记下线", node.Name, node.Address, offlineAfter),
+			})
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			run(now)
+		}
+	}
+}
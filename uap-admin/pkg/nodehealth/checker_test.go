@@ -0,0 +1,88 @@
+package nodehealth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 在临时目录创建已迁移到最新结构的数据库
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createNode 创建节点，reportedAt 为 nil 表示从未上报
+func createNode(t testing.TB, db *gorm.DB, name string, status int, reportedAt *time.Time) models.Node {
+	t.Helper()
+	node := models.Node{Name: name, Address: name + ":443", PublicKey: "key-" + name, Status: status, LastReportAt: reportedAt}
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+// loadNode 重新读取节点
+func loadNode(t testing.TB, db *gorm.DB, id uint) models.Node {
+	t.Helper()
+	var node models.Node
+	if err := db.First(&node, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+// nodeStatus 重新读取节点状态
+func nodeStatus(t testing.TB, db *gorm.DB, id uint) int {
+	t.Helper()
+	return loadNode(t, db, id).Status
+}
+
+func TestMarkStale(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	stale := now.Add(-10 * time.Minute)
+	fresh := now.Add(-time.Minute)
+
+	staleNode := createNode(t, db, "stale", 1, &stale)
+	freshNode := createNode(t, db, "fresh", 1, &fresh)
+	neverNode := createNode(t, db, "never", 1, nil)        // 未配置 -admin-url 的节点不参与检查
+	offlineNode := createNode(t, db, "offline", 0, &stale) // 已下线的节点不重复标记
+
+	marked, err := MarkStale(db, now, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 1 || marked[0].ID != staleNode.ID {
+		t.Fatalf("标记下线的节点 %+v，期望只有 stale", marked)
+	}
+	for id, want := range map[uint]int{staleNode.ID: 0, freshNode.ID: 1, neverNode.ID: 1, offlineNode.ID: 0} {
+		if got := nodeStatus(t, db, id); got != want {
+			t.Errorf("节点 %d 状态 %d，期望 %d", id, got, want)
+		}
+	}
+
+	// 已标记的节点不会在下一轮再次返回（不重复告警）
+	if marked, err := MarkStale(db, now.Add(time.Minute), 5*time.Minute); err != nil || len(marked) != 0 {
+		t.Fatalf("第二轮标记了 %+v: %v", marked, err)
+	}
+}
@@ -0,0 +1,105 @@
+package nodehealth
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// 健康检查拨测参数
+const (
+	probeTimeout     = 2 * time.Second // 与客户端测速超时一致
+	probeConcurrency = 20
+	probeEWMAAlpha   = 0.2 // 指数移动平均的平滑系数：一次拨测失败使成功率下降 20%
+)
+
+// ProbeFunc 拨测节点地址，返回延迟
+type ProbeFunc func(addr string) (time.Duration, error)
+
+// ProbeTCP 对节点的 TCP 测速端口（与 QUIC 同端口）做一次 TCP 握手，与客户端测速方式一致
+func ProbeTCP(addr string) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	conn.Close()
+	return latency, nil
+}
+
+// probeResult 单个节点的拨测结果
+type probeResult struct {
+	latency time.Duration
+	ok      bool
+}
+
+// probeAll 并发拨测所有节点（最多 probeConcurrency 个同时进行），结果与 nodes 一一对应
+func probeAll(nodes []models.Node, probe ProbeFunc) []probeResult {
+	results := make([]probeResult, len(nodes))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			latency, err := probe(nodes[i].Address)
+			results[i] = probeResult{latency: latency, ok: err == nil}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// ewma 指数移动平均（首个样本直接作为初始值）
+func ewma(prev, sample float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return prev*(1-probeEWMAAlpha) + sample*probeEWMAAlpha
+}
+
+// UpdateScores 拨测所有节点，更新拨测指标并重新计算质量评分
+// 客户端延迟与负载由上报接口写入，这里只读取；只更新拨测与评分列，不覆盖并发写入的其他列
+func UpdateScores(db *gorm.DB, now time.Time, weights ScoreWeights, probe ProbeFunc) error {
+	var nodes []models.Node
+	if err := db.Find(&nodes).Error; err != nil {
+		return err
+	}
+
+	for i, result := range probeAll(nodes, probe) {
+		node := nodes[i]
+		first := node.ProbedAt == nil
+		success := 0.0
+		if result.ok {
+			success = 1
+			// 延迟只统计成功的拨测；此前从未成功过时以本次为初始值
+			ms := float64(result.latency) / float64(time.Millisecond)
+			node.ProbeLatencyMs = ewma(node.ProbeLatencyMs, ms, node.ProbeLatencyMs == 0)
+		}
+		node.ProbeSuccess = ewma(node.ProbeSuccess, success, first)
+		node.ProbedAt = &now
+		node.Score = Score(ScoreInputOf(node), weights)
+
+		if err := database.Retry(func() error {
+			return db.Model(&models.Node{}).Where("id = ?", node.ID).Updates(map[string]interface{}{
+				"probe_latency_ms": node.ProbeLatencyMs,
+				"probe_success":    node.ProbeSuccess,
+				"probed_at":        now,
+				"score":            node.Score,
+			}).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
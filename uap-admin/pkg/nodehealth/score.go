@@ -0,0 +1,140 @@
+package nodehealth
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"uap-admin/pkg/models"
+)
+
+// 延迟评分区间：不超过 goodLatencyMs 记满分，达到 badLatencyMs 记零分，中间线性下降
+const (
+	goodLatencyMs = 50
+	badLatencyMs  = 1000
+)
+
+// ScoreWeights 各项指标在质量评分中的权重（只比较相对大小，0 表示该项不参与评分）
+type ScoreWeights struct {
+	ProbeLatency  float64 // 健康检查拨测延迟
+	ProbeSuccess  float64 // 健康检查拨测成功率
+	ClientLatency float64 // 客户端上报的测速延迟
+	ClientConnect float64 // 客户端上报的连接成功率
+	Load          float64 // 负载（活跃连接数 / 承载能力）
+}
+
+// DefaultScoreWeights 默认权重：可达性（拨测与客户端实际连接）最重要，其次是用户实际感受到的延迟和负载
+var DefaultScoreWeights = ScoreWeights{ProbeLatency: 1, ProbeSuccess: 3, ClientLatency: 2, ClientConnect: 3, Load: 2}
+
+// ScoreInput 计算质量评分所需的指标
+type ScoreInput struct {
+	Probed         bool    // 是否拨测过（否则拨测延迟与成功率不参与评分）
+	ProbeLatencyMs float64 // 拨测延迟（毫秒）；从未拨测成功时为 0，只按成功率评分
+	ProbeSuccess   float64 // 拨测成功率（0-1）
+
+	ClientReported  bool    // 是否有客户端上报（否则客户端延迟不参与评分）
+	ClientLatencyMs float64 // 客户端上报的测速延迟（毫秒）
+
+	ClientConnected   bool    // 是否有客户端连接上报（否则连接成功率不参与评分）
+	ClientConnectRate float64 // 客户端上报的连接成功率（0-1）
+
+	ActiveConns int // 活跃连接数
+	Capacity    int // 承载能力（<= 0 表示未配置，负载不参与评分）
+}
+
+// ScoreInputOf 从节点记录中取出评分指标
+func ScoreInputOf(node models.Node) ScoreInput {
+	return ScoreInput{
+		Probed:            node.ProbedAt != nil,
+		ProbeLatencyMs:    node.ProbeLatencyMs,
+		ProbeSuccess:      node.ProbeSuccess,
+		ClientReported:    node.ClientReportAt != nil,
+		ClientLatencyMs:   node.ClientLatencyMs,
+		ClientConnected:   node.ClientConnectAt != nil,
+		ClientConnectRate: node.ClientConnectRate,
+		ActiveConns:       node.ActiveConns,
+		Capacity:          node.Capacity,
+	}
+}
+
+// Score 计算节点质量评分 (0-100)：各项指标折算为 0-1 后按权重加权平均
+// 没有数据的指标不参与加权，所有指标都没有数据时返回满分（新节点不因缺少数据而被降权）
+func Score(in ScoreInput, w ScoreWeights) int {
+	var sum, total float64
+	add := func(weight, value float64) {
+		if weight <= 0 {
+			return
+		}
+		sum += weight * value
+		total += weight
+	}
+
+	if in.Probed {
+		// 从未拨测成功时没有延迟数据，由成功率体现
+		if in.ProbeLatencyMs > 0 {
+			add(w.ProbeLatency, latencyFactor(in.ProbeLatencyMs))
+		}
+		add(w.ProbeSuccess, clamp01(in.ProbeSuccess))
+	}
+	if in.ClientReported {
+		add(w.ClientLatency, latencyFactor(in.ClientLatencyMs))
+	}
+	if in.ClientConnected {
+		add(w.ClientConnect, clamp01(in.ClientConnectRate))
+	}
+	if in.Capacity > 0 {
+		add(w.Load, 1-clamp01(float64(in.ActiveConns)/float64(in.Capacity)))
+	}
+
+	if total == 0 {
+		return models.MaxNodeScore
+	}
+	return int(math.Round(models.MaxNodeScore * sum / total))
+}
+
+// latencyFactor 把延迟折算为 0-1
+func latencyFactor(ms float64) float64 {
+	return 1 - clamp01((ms-goodLatencyMs)/(badLatencyMs-goodLatencyMs))
+}
+
+// clamp01 把 v 限制在 [0, 1]
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// ParseScoreWeights 解析权重配置，格式为逗号分隔的 key=value（如 "probe_success=3,load=0"）
+// key 为 probe_latency / probe_success / client_latency / client_connect / load，未出现的 key 使用默认权重
+func ParseScoreWeights(raw string) (ScoreWeights, error) {
+	w := DefaultScoreWeights
+	fields := map[string]*float64{
+		"probe_latency":  &w.ProbeLatency,
+		"probe_success":  &w.ProbeSuccess,
+		"client_latency": &w.ClientLatency,
+		"client_connect": &w.ClientConnect,
+		"load":           &w.Load,
+	}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return w, fmt.Errorf("格式错误: %q（应为 key=value）", item)
+		}
+		field, ok := fields[strings.TrimSpace(key)]
+		if !ok {
+			return w, fmt.Errorf("未知指标: %q", key)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return w, fmt.Errorf("权重无效: %q", item)
+		}
+		*field = v
+	}
+	if w.ProbeLatency+w.ProbeSuccess+w.ClientLatency+w.ClientConnect+w.Load == 0 {
+		return w, fmt.Errorf("权重不能全部为 0")
+	}
+	return w, nil
+}
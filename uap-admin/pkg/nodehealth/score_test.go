@@ -0,0 +1,144 @@
+package nodehealth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScoreScenarios(t *testing.T) {
+	healthy := ScoreInput{
+		Probed: true, ProbeLatencyMs: 40, ProbeSuccess: 1,
+		ClientReported: true, ClientLatencyMs: 45,
+		ClientConnected: true, ClientConnectRate: 1,
+		ActiveConns: 10, Capacity: 1000,
+	}
+	cases := []struct {
+		name     string
+		in       ScoreInput
+		min, max int
+	}{
+		{"没有任何数据的新节点", ScoreInput{}, 100, 100},
+		{"健康且空闲", healthy, 99, 100},
+		{"拨测全部失败", ScoreInput{Probed: true, ProbeSuccess: 0}, 0, 0},
+		{"丢包：拨测成功率 50%", ScoreInput{Probed: true, ProbeLatencyMs: 40, ProbeSuccess: 0.5}, 60, 65},
+		{"客户端延迟 1 秒以上", ScoreInput{ClientReported: true, ClientLatencyMs: 1500}, 0, 0},
+		{"延迟在区间中点", ScoreInput{ClientReported: true, ClientLatencyMs: (goodLatencyMs + badLatencyMs) / 2}, 50, 50},
+		{"客户端连接全部失败", ScoreInput{ClientConnected: true, ClientConnectRate: 0}, 0, 0},
+		{"从管理后台可达、客户端连接一半失败", ScoreInput{
+			Probed: true, ProbeLatencyMs: 40, ProbeSuccess: 1,
+			ClientConnected: true, ClientConnectRate: 0.5,
+		}, 78, 79},
+		{"满载", ScoreInput{ActiveConns: 2000, Capacity: 1000}, 0, 0},
+		{"未配置承载能力时负载不参与", ScoreInput{ActiveConns: 5000}, 100, 100},
+		{"半载、其余健康", ScoreInput{
+			Probed: true, ProbeLatencyMs: 40, ProbeSuccess: 1,
+			ClientReported: true, ClientLatencyMs: 40,
+			ActiveConns: 500, Capacity: 1000,
+		}, 85, 88},
+	}
+	for _, tc := range cases {
+		if got := Score(tc.in, DefaultScoreWeights); got < tc.min || got > tc.max {
+			t.Errorf("%s: 评分 %d，期望 %d-%d", tc.name, got, tc.min, tc.max)
+		}
+	}
+
+	// 丢包、高负载的节点排在健康节点之后
+	lossy := healthy
+	lossy.ProbeSuccess = 0.6
+	busy := healthy
+	busy.ActiveConns = 900
+	for name, in := range map[string]ScoreInput{"丢包": lossy, "高负载": busy} {
+		if Score(in, DefaultScoreWeights) >= Score(healthy, DefaultScoreWeights) {
+			t.Errorf("%s 节点的评分不低于健康节点", name)
+		}
+	}
+}
+
+func TestScoreWeights(t *testing.T) {
+	busy := ScoreInput{Probed: true, ProbeLatencyMs: 40, ProbeSuccess: 1, ActiveConns: 1000, Capacity: 1000}
+	if got := Score(busy, DefaultScoreWeights); got >= 100 {
+		t.Fatalf("满载节点默认评分 %d", got)
+	}
+	// 负载权重为 0 时不参与评分
+	w := DefaultScoreWeights
+	w.Load = 0
+	if got := Score(busy, w); got != 100 {
+		t.Fatalf("负载权重为 0 时评分 %d", got)
+	}
+}
+
+func TestParseScoreWeights(t *testing.T) {
+	w, err := ParseScoreWeights("")
+	if err != nil || w != DefaultScoreWeights {
+		t.Fatalf("空配置: %+v %v", w, err)
+	}
+	w, err = ParseScoreWeights(" probe_success = 5 , load=0,client_connect=1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultScoreWeights
+	want.ProbeSuccess, want.Load, want.ClientConnect = 5, 0, 1.5
+	if w != want {
+		t.Fatalf("解析结果 %+v，期望 %+v", w, want)
+	}
+
+	for _, raw := range []string{
+		"load",
+		"latency=1",
+		"load=-1",
+		"load=abc",
+		"load=NaN",
+		"probe_latency=0,probe_success=0,client_latency=0,client_connect=0,load=0",
+	} {
+		if _, err := ParseScoreWeights(raw); err == nil {
+			t.Errorf("ParseScoreWeights(%q) 应返回错误", raw)
+		}
+	}
+}
+
+func TestUpdateScores(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	up := createNode(t, db, "up", 1, nil)
+	down := createNode(t, db, "down", 1, nil)
+
+	latency := 40 * time.Millisecond
+	probe := func(addr string) (time.Duration, error) {
+		if addr == down.Address {
+			return 0, errors.New("connection refused")
+		}
+		return latency, nil
+	}
+	if err := UpdateScores(db, now, DefaultScoreWeights, probe); err != nil {
+		t.Fatal(err)
+	}
+
+	got := loadNode(t, db, up.ID)
+	if got.ProbeSuccess != 1 || got.ProbeLatencyMs != 40 || got.ProbedAt == nil || got.Score != 100 {
+		t.Fatalf("可达节点 %+v", got)
+	}
+	got = loadNode(t, db, down.ID)
+	if got.ProbeSuccess != 0 || got.ProbeLatencyMs != 0 || got.Score != 0 {
+		t.Fatalf("不可达节点 %+v", got)
+	}
+
+	// 指数移动平均：一次拨测失败只使成功率下降 probeEWMAAlpha，延迟只统计成功的拨测
+	probe2 := func(addr string) (time.Duration, error) {
+		if addr == up.Address {
+			return 0, errors.New("timeout")
+		}
+		return 140 * time.Millisecond, nil
+	}
+	if err := UpdateScores(db, now.Add(time.Minute), DefaultScoreWeights, probe2); err != nil {
+		t.Fatal(err)
+	}
+	got = loadNode(t, db, up.ID)
+	if got.ProbeSuccess != 1-probeEWMAAlpha || got.ProbeLatencyMs != 40 {
+		t.Fatalf("一次失败后 %+v", got)
+	}
+	got = loadNode(t, db, down.ID)
+	if got.ProbeLatencyMs != 140 || got.ProbeSuccess != probeEWMAAlpha {
+		t.Fatalf("首次成功后 %+v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// kindLabels 事件类型的中文标题（Telegram 消息使用）
+var kindLabels = map[Kind]string{
+	KindNodeDown:       "🔴 节点下线",
+	KindNodeUp:         "🟢 节点恢复",
+	KindProbeDetected:  "🕵️ 疑似主动探测",
+	KindQuotaExhausted: "📉 流量用尽",
+
+	KindNodeMisconfigured: "🛠️ 节点配置异常",
+}
+
+// Webhook 通用 Webhook 渠道：POST JSON 格式的 Event，2xx 视为成功
+type Webhook struct {
+	URL    string
+	Client *http.Client // 为空时使用 http.DefaultClient（超时由 ctx 控制）
+}
+
+// Notify 见 Notifier
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, body)
+}
+
+// Telegram Telegram Bot 渠道（sendMessage 接口）
+type Telegram struct {
+	BotToken string
+	ChatID   string
+	APIBase  string       // 为空时使用 https://api.telegram.org
+	Client   *http.Client // 为空时使用 http.DefaultClient（超时由 ctx 控制）
+}
+
+// Notify 见 Notifier
+func (t *Telegram) Notify(ctx context.Context, e Event) error {
+	label := kindLabels[e.Kind]
+	if label == "" {
+		label = string(e.Kind)
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.ChatID,
+		"text":    fmt.Sprintf("%s\n%s\n%s", label, e.Message, e.Time.Format("2006-01-02 15:04:05 MST")),
+	})
+	if err != nil {
+		return err
+	}
+
+	base := t.APIBase
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+	return post(ctx, t.Client, base+"/bot"+t.BotToken+"/sendMessage", body)
+}
+
+// post 发送 JSON 请求，非 2xx 响应返回错误
+// 返回的错误不包含请求地址（Bot Token、Webhook 地址中的密钥不会写入日志）
+func post(ctx context.Context, client *http.Client, endpoint string, body []byte) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("告警渠道地址无效")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("返回错误状态码: %d, 响应: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// Recorder 只记录事件的渠道，用于测试断言和本地调试
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Notify 见 Notifier
+func (r *Recorder) Notify(_ context.Context, e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+// Events 返回已记录事件的副本
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
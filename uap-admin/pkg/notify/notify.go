@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Kind 运维告警事件类型
+type Kind string
+
+const (
+	KindNodeDown       Kind = "node_down"       // 节点超时未上报，已标记下线
+	KindNodeUp         Kind = "node_up"         // 已下线的节点恢复上报
+	KindProbeDetected  Kind = "probe_detected"  // 节点一个上报周期内的鉴权失败（伪装响应）次数达到阈值
+	KindQuotaExhausted Kind = "quota_exhausted" // 用户本计费周期流量用尽
+
+	KindNodeMisconfigured Kind = "node_misconfigured" // 客户端报告节点握手失败（证书校验 / ALPN），节点配置可能有误
+)
+
+// Event 运维告警事件
+type Event struct {
+	Kind    Kind      `json:"kind"`
+	Subject string    `json:"subject"` // 事件对象（节点地址 / 用户 UUID），与 Kind 一起作为去重键
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier 告警渠道
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// 分发参数
+const (
+	queueSize     = 256              // 待发送事件上限，渠道长时间不可用时丢弃新事件
+	notifyTimeout = 10 * time.Second // 单个渠道发送一条事件的最长时间
+)
+
+// Dispatcher 告警分发：去重后异步发送到所有渠道，调用方不会被渠道的网络请求阻塞
+// 同一 Kind + Subject 在 cooldown 内只发送一次（例如节点反复超时不会每个检查周期都告警）
+type Dispatcher struct {
+	notifiers []Notifier
+	cooldown  time.Duration
+	queue     chan Event
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// NewDispatcher 创建告警分发器（需要运行 Run 才会实际发送）
+func NewDispatcher(cooldown time.Duration, notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+		cooldown:  cooldown,
+		queue:     make(chan Event, queueSize),
+		lastSent:  make(map[string]time.Time),
+	}
+}
+
+// Emit 提交事件，被去重或队列已满时返回 false
+func (d *Dispatcher) Emit(e Event) bool {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	key := string(e.Kind) + "|" + e.Subject
+
+	d.mu.Lock()
+	if last, ok := d.lastSent[key]; ok && e.Time.Sub(last) < d.cooldown {
+		d.mu.Unlock()
+		return false
+	}
+	d.lastSent[key] = e.Time
+	d.mu.Unlock()
+
+	select {
+	case d.queue <- e:
+		return true
+	default:
+		log.Printf("⚠️ 告警队列已满，丢弃事件: %s %s", e.Kind, e.Subject)
+		return false
+	}
+}
+
+// Run 发送排队的事件并定期清理去重记录，直到 ctx 取消（已排队的事件会先发送完）
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cooldown)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-d.queue:
+			d.send(e)
+		case now := <-ticker.C:
+			d.prune(now)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-d.queue:
+					d.send(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send 把事件发送到所有渠道（单个渠道失败不影响其他渠道）
+func (d *Dispatcher) send(e Event) {
+	log.Printf("🔔 [告警] %s %s: %s", e.Kind, e.Subject, e.Message)
+	for _, n := range d.notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := n.Notify(ctx, e); err != nil {
+			log.Printf("⚠️ 告警发送失败 (%T): %v", n, err)
+		}
+		cancel()
+	}
+}
+
+// prune 删除已过冷却期的去重记录
+func (d *Dispatcher) prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, last := range d.lastSent {
+		if now.Sub(last) >= d.cooldown {
+			delete(d.lastSent, key)
+		}
+	}
+}
+
+// defaultDispatcher 服务启动时配置的告警分发器（未配置告警渠道时为 nil）
+var defaultDispatcher *Dispatcher
+
+// Init 设置服务使用的告警分发器
+func Init(d *Dispatcher) {
+	defaultDispatcher = d
+}
+
+// Emit 通过默认分发器提交事件（未配置告警渠道时忽略）
+func Emit(e Event) {
+	if defaultDispatcher != nil {
+		defaultDispatcher.Emit(e)
+	}
+}
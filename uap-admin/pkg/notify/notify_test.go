@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// failing 总是发送失败的渠道
+type failing struct{}
+
+func (failing) Notify(context.Context, Event) error { return errors.New("渠道不可用") }
+
+// runDispatcher 运行 d，返回停止并等待队列发送完毕的函数
+func runDispatcher(d *Dispatcher) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestDispatcherCooldown(t *testing.T) {
+	rec := &Recorder{}
+	d := NewDispatcher(time.Minute, rec)
+	now := time.Now()
+
+	if !d.Emit(Event{Kind: KindNodeDown, Subject: "a:443", Time: now}) {
+		t.Fatal("第一次告警被丢弃")
+	}
+	// 同一 Kind + Subject 在冷却期内只发送一次，不同对象或类型不受影响
+	if d.Emit(Event{Kind: KindNodeDown, Subject: "a:443", Time: now.Add(30 * time.Second)}) {
+		t.Fatal("冷却期内重复告警")
+	}
+	if !d.Emit(Event{Kind: KindNodeDown, Subject: "b:443", Time: now}) {
+		t.Fatal("其他节点的告警被去重")
+	}
+	if !d.Emit(Event{Kind: KindNodeUp, Subject: "a:443", Time: now}) {
+		t.Fatal("其他类型的告警被去重")
+	}
+	if !d.Emit(Event{Kind: KindNodeDown, Subject: "a:443", Time: now.Add(time.Minute)}) {
+		t.Fatal("冷却期过后告警被丢弃")
+	}
+
+	// 停止时已排队的事件先发送完
+	runDispatcher(d)()
+	if events := rec.Events(); len(events) != 4 {
+		t.Fatalf("发送了 %d 条告警: %+v", len(events), events)
+	}
+
+	d.prune(now.Add(3 * time.Minute))
+	if len(d.lastSent) != 0 {
+		t.Fatalf("冷却期过后去重记录未清理: %v", d.lastSent)
+	}
+}
+
+func TestDispatcherFailingChannel(t *testing.T) {
+	rec := &Recorder{}
+	d := NewDispatcher(time.Minute, failing{}, rec)
+	d.Emit(Event{Kind: KindQuotaExhausted, Subject: "user-1"})
+	runDispatcher(d)()
+	// 单个渠道失败不影响其他渠道；未指定时间的事件使用提交时间
+	events := rec.Events()
+	if len(events) != 1 || events[0].Time.IsZero() {
+		t.Fatalf("其他渠道收到 %+v", events)
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	d := NewDispatcher(time.Minute, &Recorder{})
+	// 未运行 Run：队列满后丢弃新事件，Emit 不阻塞
+	for i := 0; i < queueSize; i++ {
+		if !d.Emit(Event{Kind: KindNodeDown, Subject: strings.Repeat("x", i+1)}) {
+			t.Fatalf("队列未满时第 %d 条告警被丢弃", i+1)
+		}
+	}
+	if d.Emit(Event{Kind: KindNodeDown, Subject: "overflow"}) {
+		t.Fatal("队列已满时告警未被丢弃")
+	}
+}
+
+func TestEmitWithoutDispatcher(t *testing.T) {
+	Init(nil)
+	Emit(Event{Kind: KindNodeDown, Subject: "a:443"}) // 未配置告警渠道时忽略
+
+	rec := &Recorder{}
+	d := NewDispatcher(time.Minute, rec)
+	Init(d)
+	t.Cleanup(func() { Init(nil) })
+	Emit(Event{Kind: KindNodeDown, Subject: "a:443"})
+	runDispatcher(d)()
+	if len(rec.Events()) != 1 {
+		t.Fatalf("默认分发器收到 %d 条告警", len(rec.Events()))
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&e) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	e := Event{Kind: KindProbeDetected, Subject: "a:443", Message: "探测", Time: time.Now().UTC().Truncate(time.Second)}
+	if err := (&Webhook{URL: srv.URL + "/hook"}).Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != e {
+		t.Fatalf("Webhook 收到 %+v，期望 %+v", got, e)
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	var path string
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	tg := &Telegram{BotToken: "123:secret", ChatID: "-100", APIBase: srv.URL}
+	if err := tg.Notify(context.Background(), Event{Kind: KindNodeDown, Message: "节点下线", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:secret/sendMessage" || body["chat_id"] != "-100" {
+		t.Fatalf("请求 %s %v", path, body)
+	}
+	if !strings.HasPrefix(body["text"], kindLabels[KindNodeDown]+"\n节点下线\n") {
+		t.Fatalf("消息内容 %q", body["text"])
+	}
+}
+
+func TestPostErrorsHideEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"ok":false}`))
+	}))
+	defer srv.Close()
+
+	// 非 2xx 响应与网络错误都不把地址（Bot Token / Webhook 密钥）带进错误信息
+	tg := &Telegram{BotToken: "123:secret", ChatID: "1", APIBase: srv.URL}
+	err := tg.Notify(context.Background(), Event{Kind: KindNodeDown})
+	if err == nil || !strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("错误状态码返回 %v", err)
+	}
+
+	srv.Close()
+	err = (&Webhook{URL: srv.URL + "/hook?key=secret"}).Notify(context.Background(), Event{Kind: KindNodeDown})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("网络错误返回 %v", err)
+	}
+}
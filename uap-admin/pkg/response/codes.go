@@ -0,0 +1,111 @@
+package response
+
+import "sort"
+
+// Code 业务错误码：5 位整数，前 3 位为 HTTP 状态码，后 2 位为细分原因
+// 错误码与字符串标识一经发布不再修改含义，客户端可据此做错误处理
+type Code int
+
+const (
+	CodeBadRequest                Code = 40000 // 请求参数错误
+	CodeInvalidEmail              Code = 40001 // 邮箱格式错误
+	CodeInvalidPublicKey          Code = 40002 // 钱包公钥格式错误
+	CodeInvalidSignature          Code = 40003 // 签名格式错误
+	CodeMessageVersionUnsupported Code = 40004 // 签名消息格式已停用
+	CodeInvalidNodeKey            Code = 40005 // 节点公钥格式错误
+
+	CodeTokenMissing       Code = 40101 // 缺少 Authorization
+	CodeTokenExpired       Code = 40102 // JWT 已过期，需重新登录
+	CodeTokenInvalid       Code = 40103 // JWT 无效（格式、签名、Claims 错误）
+	CodeRequestExpired     Code = 40104 // 签名时间戳超出允许窗口
+	CodeSignatureMismatch  Code = 40105 // 钱包签名校验失败
+	CodeVerificationFailed Code = 40106 // 邮箱验证码错误或已过期
+	CodeNonceReused        Code = 40107 // 签名 nonce 已使用
+
+	CodeQuotaExceeded Code = 40201 // 本计费周期流量已用尽
+
+	CodeForbidden Code = 40301 // 管理员密钥错误
+
+	CodeNotFound     Code = 40400 // 接口不存在
+	CodeUserNotFound Code = 40401 // 用户不存在
+	CodeNodeNotFound Code = 40402 // 节点不存在或已下线
+
+	CodeAlreadyLinked   Code = 40901 // 当前账户已绑定同类身份
+	CodeIdentityInUse   Code = 40902 // 邮箱/钱包已属于其他账户
+	CodeSelfCustody     Code = 40903 // 自托管钱包，服务端不持有私钥
+	CodeCustodialWallet Code = 40904 // 托管钱包，替换前需要确认
+
+	CodeBodyTooLarge Code = 41301 // 请求体过大
+
+	CodeUpgradeRequired Code = 42601 // 客户端版本过低
+
+	CodeRateLimited Code = 42901 // 请求过于频繁
+
+	CodeInternal     Code = 50000 // 服务器内部错误
+	CodeDatabase     Code = 50001 // 数据库错误
+	CodeServerConfig Code = 50002 // 服务器配置错误（密钥等）
+)
+
+// codeNames 错误码的字符串标识
+var codeNames = map[Code]string{
+	CodeBadRequest:                "bad_request",
+	CodeInvalidEmail:              "invalid_email",
+	CodeInvalidPublicKey:          "invalid_public_key",
+	CodeInvalidSignature:          "invalid_signature",
+	CodeMessageVersionUnsupported: "message_version_unsupported",
+	CodeInvalidNodeKey:            "invalid_node_key",
+
+	CodeTokenMissing:       "token_missing",
+	CodeTokenExpired:       "token_expired",
+	CodeTokenInvalid:       "token_invalid",
+	CodeRequestExpired:     "request_expired",
+	CodeSignatureMismatch:  "signature_mismatch",
+	CodeVerificationFailed: "verification_failed",
+	CodeNonceReused:        "nonce_reused",
+
+	CodeQuotaExceeded: "quota_exceeded",
+
+	CodeForbidden: "forbidden",
+
+	CodeNotFound:     "not_found",
+	CodeUserNotFound: "user_not_found",
+	CodeNodeNotFound: "node_not_found",
+
+	CodeAlreadyLinked:   "already_linked",
+	CodeIdentityInUse:   "identity_in_use",
+	CodeSelfCustody:     "self_custody",
+	CodeCustodialWallet: "custodial_wallet",
+
+	CodeBodyTooLarge: "body_too_large",
+
+	CodeUpgradeRequired: "upgrade_required",
+
+	CodeRateLimited: "rate_limited",
+
+	CodeInternal:     "internal_error",
+	CodeDatabase:     "database_error",
+	CodeServerConfig: "server_misconfigured",
+}
+
+// Name 错误码的字符串标识
+func (c Code) Name() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return "unknown_error"
+}
+
+// Status 错误码对应的 HTTP 状态码
+func (c Code) Status() int {
+	return int(c) / 100
+}
+
+// Codes 目录中的全部错误码（升序）
+func Codes() []Code {
+	codes := make([]Code, 0, len(codeNames))
+	for code := range codeNames {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
@@ -0,0 +1,23 @@
+package response
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestErrorCodeCatalog(t *testing.T) {
+	names := make(map[string]Code)
+	for _, code := range Codes() {
+		if code.Status() < 400 || code.Status() > 599 || http.StatusText(code.Status()) == "" {
+			t.Errorf("错误码 %d 对应的 HTTP 状态码 %d 无效", code, code.Status())
+		}
+		name := code.Name()
+		if prev, ok := names[name]; ok {
+			t.Errorf("错误码 %d 与 %d 使用相同的标识 %q", code, prev, name)
+		}
+		names[name] = code
+	}
+	if Code(99999).Name() != "unknown_error" {
+		t.Error("目录外的错误码应返回 unknown_error")
+	}
+}
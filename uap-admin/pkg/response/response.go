@@ -1,10 +1,13 @@
 package response
 
 // Response 统一响应格式
+// 成功: {"code":200,"data":...}
+// 失败: {"code":40102,"error":"token_expired","msg":"Token 已过期"}，错误码见 codes.go
 type Response struct {
-	Code int         `json:"code"`
-	Data interface{} `json:"data,omitempty"`
-	Msg  string      `json:"msg,omitempty"`
+	Code  int         `json:"code"`
+	Error string      `json:"error,omitempty"` // 错误标识（仅失败时）
+	Data  interface{} `json:"data,omitempty"`
+	Msg   string      `json:"msg,omitempty"`
 }
 
 // Success 成功响应
@@ -17,11 +20,18 @@ func Success(data interface{}) Response {
 }
 
 // Error 错误响应
-func Error(code int, msg string) Response {
+func Error(code Code, msg string) Response {
 	return Response{
-		Code: code,
-		Data: nil,
-		Msg:  msg,
+		Code:  int(code),
+		Error: code.Name(),
+		Data:  nil,
+		Msg:   msg,
 	}
 }
 
+// ErrorWithData 附带数据的错误响应（如版本过低时附带升级信息）
+func ErrorWithData(code Code, msg string, data interface{}) Response {
+	resp := Error(code, msg)
+	resp.Data = data
+	return resp
+}
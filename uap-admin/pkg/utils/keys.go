@@ -7,21 +7,31 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
 )
 
-// EnsureKeys 确保 Ed25519 密钥对存在
-// 如果不存在，自动生成并保存为 PEM 文件
-func EnsureKeys() error {
-	privateKeyPath := "private_key.pem"
-	publicKeyPath := "public_key.pem"
+// EnsureKeys 确保 Ed25519 密钥对文件存在
+// 私钥不存在时自动生成密钥对并保存为 PEM 文件；私钥存在但公钥缺失时由私钥补写公钥（不会替换已有私钥）
+func EnsureKeys(privateKeyPath, publicKeyPath string) error {
+	if _, err := os.Stat(privateKeyPath); err == nil {
+		if _, err := os.Stat(publicKeyPath); err == nil {
+			// 密钥文件已存在，无需生成
+			fmt.Println("✅ 密钥对文件已存在")
+			return nil
+		}
 
-	// 检查密钥文件是否已存在
-	_, privExists := os.Stat(privateKeyPath)
-	_, pubExists := os.Stat(publicKeyPath)
-
-	if privExists == nil && pubExists == nil {
-		// 密钥文件已存在，无需生成
-		fmt.Println("✅ 密钥对文件已存在")
+		privData, err := os.ReadFile(privateKeyPath)
+		if err != nil {
+			return fmt.Errorf("读取私钥文件失败: %w", err)
+		}
+		priv, err := ParsePrivateKeyPEM(privData)
+		if err != nil {
+			return err
+		}
+		if err := writePublicKey(publicKeyPath, priv.Public().(ed25519.PublicKey)); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已由私钥补写公钥: %s\n", publicKeyPath)
 		return nil
 	}
 
@@ -32,48 +42,113 @@ func EnsureKeys() error {
 		return fmt.Errorf("生成密钥对失败: %w", err)
 	}
 
-	// 使用 x509.MarshalPKCS8PrivateKey 编码私钥
-	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	privPEM, err := EncodePrivateKeyPEM(priv)
 	if err != nil {
-		return fmt.Errorf("编码私钥失败: %w", err)
+		return err
 	}
+	if err := os.WriteFile(privateKeyPath, privPEM, 0600); err != nil {
+		return fmt.Errorf("写入私钥文件失败: %w", err)
+	}
+	fmt.Printf("✅ 私钥已保存到: %s\n", privateKeyPath)
 
-	// 保存私钥为 PEM 文件
-	privBlock := &pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: privBytes,
+	if err := writePublicKey(publicKeyPath, pub); err != nil {
+		return err
 	}
-	privFile, err := os.Create(privateKeyPath)
+	fmt.Printf("✅ 公钥已保存到: %s\n", publicKeyPath)
+	return nil
+}
+
+// writePublicKey 将公钥保存为 PEM 文件
+func writePublicKey(path string, pub ed25519.PublicKey) error {
+	pubPEM, err := EncodePublicKeyPEM(pub)
 	if err != nil {
-		return fmt.Errorf("创建私钥文件失败: %w", err)
+		return err
 	}
-	defer privFile.Close()
-	if err := pem.Encode(privFile, privBlock); err != nil {
-		return fmt.Errorf("写入私钥文件失败: %w", err)
+	if err := os.WriteFile(path, pubPEM, 0644); err != nil {
+		return fmt.Errorf("写入公钥文件失败: %w", err)
 	}
-	fmt.Printf("✅ 私钥已保存到: %s\n", privateKeyPath)
+	return nil
+}
 
-	// 使用 x509.MarshalPKIXPublicKey 编码公钥
-	pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+// ParsePrivateKeyPEM 解析 PEM 格式（PKCS#8）的 Ed25519 私钥
+func ParsePrivateKeyPEM(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("解析私钥 PEM 失败")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
-		return fmt.Errorf("编码公钥失败: %w", err)
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
-	// 保存公钥为 PEM 文件
-	pubBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: pubBytes,
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("私钥类型错误，期望 ed25519.PrivateKey")
 	}
-	pubFile, err := os.Create(publicKeyPath)
+	return priv, nil
+}
+
+// EncodePrivateKeyPEM 将私钥编码为 PEM（PKCS#8）
+func EncodePrivateKeyPEM(priv ed25519.PrivateKey) ([]byte, error) {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
 	if err != nil {
-		return fmt.Errorf("创建公钥文件失败: %w", err)
+		return nil, fmt.Errorf("编码私钥失败: %w", err)
 	}
-	defer pubFile.Close()
-	if err := pem.Encode(pubFile, pubBlock); err != nil {
-		return fmt.Errorf("写入公钥文件失败: %w", err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}), nil
+}
+
+// EncodePublicKeyPEM 将公钥编码为 PEM（PKIX）
+func EncodePublicKeyPEM(pub ed25519.PublicKey) ([]byte, error) {
+	pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("编码公钥失败: %w", err)
 	}
-	fmt.Printf("✅ 公钥已保存到: %s\n", publicKeyPath)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}), nil
+}
 
-	return nil
+// ParsePublicKeysPEM 解析一个或多个 PEM 格式（PKIX）的 Ed25519 公钥（多个 PEM 块直接拼接）
+func ParsePublicKeysPEM(data []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析公钥失败: %w", err)
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("公钥类型错误，期望 ed25519.PublicKey")
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("解析公钥 PEM 失败")
+	}
+	return keys, nil
 }
 
+// NormalizePublicKeyPEM 校验并规范化单个 Ed25519 公钥 PEM：解析后按 PKIX 重新编码，
+// 同一把公钥无论换行符（\r\n、字面量 \n）、首尾空白、PEM 头部或 Base64 折行如何都得到相同的字符串
+func NormalizePublicKeyPEM(data string) (string, error) {
+	data = strings.TrimSpace(data)
+	if !strings.Contains(data, "\n") {
+		data = strings.ReplaceAll(data, `\n`, "\n")
+	}
+	keys, err := ParsePublicKeysPEM([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	if len(keys) != 1 {
+		return "", fmt.Errorf("只能包含一个公钥，实际 %d 个", len(keys))
+	}
+	normalized, err := EncodePublicKeyPEM(keys[0])
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+// newPublicKeyPEM 生成一把 Ed25519 公钥的规范 PEM
+func newPublicKeyPEM(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodePublicKeyPEM(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNormalizePublicKeyPEM(t *testing.T) {
+	canonical := newPublicKeyPEM(t)
+	lines := strings.Split(strings.TrimSpace(canonical), "\n")
+	body := lines[1]
+
+	for name, variant := range map[string]string{
+		"规范格式":       canonical,
+		"Windows 换行": strings.ReplaceAll(canonical, "\n", "\r\n"),
+		"首尾空白":       "  \n\t" + canonical + "\n\n  ",
+		"没有结尾换行":     strings.TrimSuffix(canonical, "\n"),
+		"字面量 \\n":    strings.ReplaceAll(strings.TrimSpace(canonical), "\n", `\n`),
+		"Base64 折行":  lines[0] + "\n" + body[:20] + "\n" + body[20:] + "\n" + lines[2] + "\n",
+		"带 PEM 头部":   lines[0] + "\nComment: node-1\n\n" + body + "\n" + lines[2] + "\n",
+	} {
+		got, err := NormalizePublicKeyPEM(variant)
+		if err != nil || got != canonical {
+			t.Errorf("%s: %q, %v，期望规范格式", name, got, err)
+		}
+	}
+
+	// 不同的公钥规范化后仍不同
+	if other, _ := NormalizePublicKeyPEM(newPublicKeyPEM(t)); other == canonical {
+		t.Fatal("不同公钥规范化后相同")
+	}
+}
+
+func TestNormalizePublicKeyPEMInvalid(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := EncodePrivateKeyPEM(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{
+		"空":         "",
+		"不是 PEM":    "not a key",
+		"Base64 损坏": "-----BEGIN PUBLIC KEY-----\n!!!!\n-----END PUBLIC KEY-----\n",
+		"ECDSA 公钥":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecDER})),
+		"私钥":        string(privPEM),
+		"两个公钥":      newPublicKeyPEM(t) + newPublicKeyPEM(t),
+	} {
+		if got, err := NormalizePublicKeyPEM(data); err == nil {
+			t.Errorf("%s: 规范化为 %q，期望错误", name, got)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Fingerprint 敏感值（Token、验证码、密钥、公钥等）写入日志时的替代：SHA-256 的前 8 个十六进制字符，
+// 同一个值的多条日志可以互相对应，而日志本身不泄露原文；空值返回 "-"
+func Fingerprint(secret string) string {
+	if secret == "" {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])[:8]
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("") != "-" {
+		t.Fatalf("空值的指纹 %q", Fingerprint(""))
+	}
+	a, b := Fingerprint("secret-a"), Fingerprint("secret-b")
+	if a == b || a != Fingerprint("secret-a") || !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+8 {
+		t.Fatalf("指纹 %s / %s", a, b)
+	}
+	if strings.Contains(a, "secret") {
+		t.Fatalf("指纹包含原文: %s", a)
+	}
+}
@@ -0,0 +1,63 @@
+package version
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	cases := map[string]Semver{
+		"1.2.3":              {1, 2, 3, ""},
+		"v1.2.3":             {1, 2, 3, ""},
+		" 1.2 ":              {1, 2, 0, ""},
+		"2":                  {2, 0, 0, ""},
+		"1.0.0-beta.1":       {1, 0, 0, "beta.1"},
+		"1.0.0-rc.1+build.5": {1, 0, 0, "rc.1"},
+		"1.0.0+build":        {1, 0, 0, ""},
+	}
+	for s, want := range cases {
+		got, err := Parse(s)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %+v, %v，期望 %+v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "1.2.3.4", "1.x", "1.-2", "1.0.0-", "a.b.c"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) 应返回错误", s)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// 按 semver 规定的优先级从低到高排列
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := Parse(ordered[i])
+			b, _ := Parse(ordered[j])
+			want := sign(i - j)
+			if got := Compare(a, b); got != want {
+				t.Errorf("Compare(%s, %s) = %d，期望 %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, s := range []string{"1.2.3", "1.0.0-beta.1"} {
+		v, _ := Parse(s)
+		if v.String() != s {
+			t.Errorf("%q 格式化为 %q", s, v.String())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Manager 后台协程生命周期管理
+// 所有后台任务通过 Go 注册，关闭时统一取消 context 并等待退出，避免写库写到一半被杀掉
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager 创建后台协程管理器
+func NewManager() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Go 启动一个后台任务
+// fn 必须在 ctx 取消后尽快返回（当前正在进行的写入可以先完成）
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		fn(m.ctx)
+		log.Printf("🛑 后台任务已退出: %s", name)
+	}()
+}
+
+// Shutdown 通知所有后台任务退出并等待，超时返回 false
+func (m *Manager) Shutdown(timeout time.Duration) bool {
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestShutdownWaitsForWorkers(t *testing.T) {
+	m := NewManager()
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		m.Go("worker", func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond) // 退出前完成当前的写入
+			finished.Add(1)
+		})
+	}
+
+	if !m.Shutdown(5 * time.Second) {
+		t.Fatal("后台任务未在超时内退出")
+	}
+	if n := finished.Load(); n != 3 {
+		t.Fatalf("Shutdown 返回时只有 %d 个任务完成", n)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	m := NewManager()
+	release := make(chan struct{})
+	defer close(release)
+	m.Go("stuck", func(ctx context.Context) {
+		<-release // 不响应 ctx 取消
+	})
+
+	start := time.Now()
+	if m.Shutdown(100 * time.Millisecond) {
+		t.Fatal("任务未退出时应返回 false")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("超时后等待了 %v", elapsed)
+	}
+}
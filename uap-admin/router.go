@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"uap-admin/pkg/api"
+	"uap-admin/pkg/apidoc"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/emailcode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// routerConfig 注册路由所需的依赖与配置（由 main 从环境变量加载）
+type routerConfig struct {
+	db               *gorm.DB
+	reportWriter     *database.Writer
+	emailCodes       emailcode.Store
+	emailCodeFormat  emailcode.CodeFormat
+	emailCodeLog     bool
+	adminSecrets     []string
+	build            api.BuildInfo
+	startedAt        time.Time
+	systemInfoPublic bool
+	versionPolicy    api.VersionPolicy
+	walletPolicy     api.WalletLoginPolicy
+	probeThreshold   int64
+	apiDocs          bool // 在 apidoc.DocsPath 提供 OpenAPI 文档与 Swagger UI
+}
+
+// newRouter 初始化 Gin 路由
+func newRouter(cfg routerConfig) *gin.Engine {
+	// 使用统一响应格式的 Recovery 替代 gin.Default 自带的（panic 时返回空 500）
+	r := gin.New()
+	r.Use(gin.Logger(), api.Recovery())
+	r.NoRoute(api.NotFound())
+	// 全局限制请求体大小，防止超大请求体占用服务器资源
+	r.Use(api.BodyLimitMiddleware(api.MaxBodyBytes))
+
+	// 健康检查路由
+	r.GET("/health", api.Health())
+
+	// API 路由组
+	apiV1 := r.Group("/api/v1")
+	{
+		// 客户端版本要求（公开接口，注册在版本门槛之前，过低版本也能获取升级信息）
+		apiV1.GET("/client/version", api.GetClientVersion(cfg.versionPolicy))
+		// 之后注册的接口：携带版本号且低于最低要求的客户端请求返回 426
+		apiV1.Use(api.VersionGateMiddleware(cfg.versionPolicy))
+
+		authGroup := apiV1.Group("/auth")
+		{
+			// 钱包登录签名参数（公开接口，无需 JWT）
+			authGroup.GET("/wallet/params", api.GetWalletLoginParams(cfg.walletPolicy))
+			// 钱包登录/注册（公开接口，无需 JWT）
+			authGroup.POST("/wallet", api.HandleWalletLogin(cfg.db, cfg.walletPolicy))
+			// 邮箱验证码发送（公开接口，无需 JWT）
+			authGroup.POST("/email/code", api.HandleEmailCode(cfg.emailCodes, cfg.emailCodeFormat, cfg.emailCodeLog))
+			// 邮箱登录/注册（公开接口，无需 JWT）
+			authGroup.POST("/email/login", api.HandleEmailLogin(cfg.db, cfg.emailCodes))
+		}
+
+		clientGroup := apiV1.Group("/client")
+		{
+			// 获取节点列表（需要 JWT 鉴权）
+			clientGroup.GET("/nodes", api.AuthMiddleware(), api.GetNodeList(cfg.db))
+			// 上报节点测速结果（需要 JWT 鉴权，按账户限流），参与节点质量评分
+			clientGroup.POST("/nodes/latency", api.AuthMiddleware(), api.HandleNodeLatency(cfg.reportWriter))
+			// 上报节点连接结果（需要 JWT 鉴权，按账户与节点限流），参与节点质量评分
+			clientGroup.POST("/report", api.AuthMiddleware(), api.HandleClientReport(cfg.reportWriter))
+			// 清除固定节点（需要 JWT 鉴权），粘性选路下 App 的"切换节点"操作
+			clientGroup.DELETE("/nodes/pin", api.AuthMiddleware(), api.HandleClearNodePin(cfg.db))
+			// 绑定邮箱（需要 JWT 鉴权 + 邮箱验证码）
+			clientGroup.POST("/link/email", api.AuthMiddleware(), api.HandleLinkEmail(cfg.db, cfg.emailCodes))
+			// 绑定钱包（需要 JWT 鉴权 + 钱包签名）
+			clientGroup.POST("/link/wallet", api.AuthMiddleware(), api.HandleLinkWallet(cfg.db, cfg.walletPolicy))
+			// 换取短期连接票据（需要 JWT 鉴权）
+			clientGroup.POST("/ticket", api.AuthMiddleware(), api.HandleConnectTicket(cfg.db))
+			// 托管钱包签名握手挑战（需要 JWT 鉴权，按账户限流）
+			clientGroup.POST("/sign", api.AuthMiddleware(), api.HandleClientSign(cfg.db))
+			// 轮换托管钱包密钥对（需要 JWT 鉴权），旧公钥随之作废
+			clientGroup.POST("/wallet/rotate", api.AuthMiddleware(), api.HandleWalletRotate(cfg.db))
+			// 在线设备列表（需要 JWT 鉴权）
+			clientGroup.GET("/sessions", api.AuthMiddleware(), api.GetMySessions(cfg.db))
+			// 账户状态与待推送通知（需要 JWT 鉴权，客户端定期轮询）
+			clientGroup.GET("/status", api.AuthMiddleware(), api.GetClientStatus(cfg.db))
+			// 用量历史（需要 JWT 鉴权）
+			clientGroup.GET("/usage", api.AuthMiddleware(), api.GetMyUsage(cfg.db))
+		}
+
+		systemGroup := apiV1.Group("/system")
+		{
+			// 获取系统公钥（公开接口，无需鉴权）
+			systemGroup.GET("/public-key", api.GetPublicKey())
+			// JWKS 公钥集合（公开接口，节点据此验签，支持密钥轮换）
+			systemGroup.GET("/jwks", api.GetJWKS())
+			// 系统信息：版本、运行时长、签名密钥状态（默认需要管理员密钥，UAP_SYSTEM_INFO_PUBLIC=true 时公开）
+			systemGroup.GET("/info", api.GetSystemInfo(cfg.build, cfg.startedAt, cfg.systemInfoPublic, cfg.adminSecrets))
+		}
+	}
+
+	// 管理员接口：节点注册（简单的管理员密钥鉴权）
+	r.POST("/api/v1/admin/node/register", api.HandleNodeRegister(cfg.db, cfg.adminSecrets))
+	// 管理员接口：节点删除（简单的管理员密钥鉴权）
+	r.DELETE("/api/v1/admin/node", api.HandleDeleteNode(cfg.db, cfg.adminSecrets))
+	// 管理员接口：全部在线会话
+	r.GET("/api/v1/admin/sessions", api.GetAllSessions(cfg.db, cfg.adminSecrets))
+	// 管理员接口：用户列表（游标分页）
+	r.GET("/api/v1/admin/users", api.GetUserList(cfg.db, cfg.adminSecrets))
+	// 管理员接口：设置用户流量配额
+	r.PUT("/api/v1/admin/user/quota", api.HandleSetQuota(cfg.db, cfg.adminSecrets))
+	// 节点接口：定期上报活跃会话（管理员密钥鉴权）
+	r.POST("/api/v1/node/report", api.HandleNodeReport(cfg.db, cfg.reportWriter, cfg.adminSecrets, cfg.probeThreshold))
+
+	// 接口文档与实际注册的路由对比（新增/删除接口时需同步修改 pkg/apidoc/routes.go）
+	for _, problem := range apidoc.Check(apidoc.Routes, r.Routes()) {
+		log.Printf("⚠️  %s", problem)
+	}
+	if cfg.apiDocs {
+		doc := apidoc.Build(apidoc.Routes)
+		r.GET(apidoc.DocsPath, apidoc.UIHandler(apidoc.DocsPath+"/openapi.json"))
+		r.GET(apidoc.DocsPath+"/openapi.json", apidoc.SpecHandler(doc))
+		log.Printf("📖 接口文档: %s", apidoc.DocsPath)
+	}
+
+	return r
+}
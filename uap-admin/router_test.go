@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-admin/pkg/api"
+	"uap-admin/pkg/apidoc"
+	"uap-admin/pkg/auth"
+	"uap-admin/pkg/database"
+	"uap-admin/pkg/emailcode"
+	"uap-admin/pkg/models"
+	"uap-admin/pkg/response"
+	"uap-admin/pkg/utils"
+	"uap-admin/pkg/version"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	privPEM, err := utils.EncodePrivateKeyPEM(priv)
+	if err != nil {
+		panic(err)
+	}
+	if err := auth.Init(auth.KeyConfig{PrivateKeyPEM: string(privPEM)}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestDB 在临时目录创建已迁移到最新结构的数据库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := database.Migrate(db, models.All(), models.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTestRouter 使用 db 初始化完整路由
+func newTestRouter(t *testing.T, db *gorm.DB) *gin.Engine {
+	t.Helper()
+	writer := database.NewWriter(db, writerQueueSize, writerMaxBatch)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		writer.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return newRouter(routerConfig{
+		db:              db,
+		reportWriter:    writer,
+		emailCodes:      emailcode.NewMemoryStore(),
+		emailCodeFormat: emailcode.DefaultCodeFormat,
+		adminSecrets:    []string{"admin-secret"},
+		startedAt:       time.Now(),
+		versionPolicy: api.VersionPolicy{
+			MinClientVersion: version.Semver{Major: 1},
+			LatestVersion:    version.Semver{Major: 1, Minor: 2},
+		},
+		walletPolicy:   api.WalletLoginPolicy{Domain: defaultWalletLoginDomain},
+		probeThreshold: defaultProbeThreshold,
+	})
+}
+
+// checkEnvelope 校验错误响应符合统一信封：code 属于错误码目录且与 HTTP 状态码、错误标识一致
+// 成功响应不检查（如 JWKS 按标准格式直接返回）
+func checkEnvelope(t *testing.T, name string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code < 400 {
+		return
+	}
+	var resp struct {
+		Code  *int   `json:"code"`
+		Error string `json:"error"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code == nil {
+		t.Errorf("%s: 响应不是统一信封 (HTTP %d): %s", name, w.Code, w.Body.String())
+		return
+	}
+
+	code := response.Code(*resp.Code)
+	inCatalog := false
+	for _, c := range response.Codes() {
+		inCatalog = inCatalog || c == code
+	}
+	switch {
+	case !inCatalog:
+		t.Errorf("%s: 错误码 %d 不在错误码目录中", name, code)
+	case code.Status() != w.Code:
+		t.Errorf("%s: 错误码 %d 与 HTTP 状态码 %d 不一致", name, code, w.Code)
+	case resp.Error != code.Name():
+		t.Errorf("%s: 错误码 %d 的标识为 %q，期望 %q", name, code, resp.Error, code.Name())
+	case resp.Msg == "":
+		t.Errorf("%s: 错误响应缺少 msg", name)
+	}
+}
+
+func TestRoutesErrorEnvelope(t *testing.T) {
+	r := newTestRouter(t, newTestDB(t))
+	token, err := auth.GenerateToken("no-such-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个接口依次用以下无效输入调用
+	cases := []struct {
+		name   string
+		header map[string]string
+		body   string
+	}{
+		{"匿名", nil, ""},
+		{"无效 JSON", map[string]string{"Authorization": "Bearer " + token, "X-Admin-Secret": "admin-secret"}, "{"},
+		{"错误字段类型", map[string]string{"Authorization": "Bearer " + token, "X-Admin-Secret": "admin-secret"}, `{"uuid":1,"email":2,"public_key":3}`},
+		{"无效 token", map[string]string{"Authorization": "Bearer invalid", "X-Admin-Secret": "wrong"}, "{}"},
+		{"版本过低", map[string]string{api.ClientVersionHeader: "0.9.0"}, "{}"},
+	}
+
+	routes := r.Routes()
+	if len(routes) == 0 {
+		t.Fatal("没有注册任何路由")
+	}
+	for _, route := range routes {
+		for _, tc := range cases {
+			req := httptest.NewRequest(route.Method, route.Path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			checkEnvelope(t, route.Method+" "+route.Path+" ("+tc.name+")", w)
+		}
+	}
+
+	// 不存在的接口与超大请求体同样返回统一信封
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/v1/no-such-route", nil),
+		httptest.NewRequest("POST", "/api/v1/auth/wallet", strings.NewReader(strings.Repeat("x", int(api.MaxBodyBytes)+1))),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code < 400 {
+			t.Errorf("%s %s: HTTP %d，期望错误响应", req.Method, req.URL.Path, w.Code)
+		}
+		checkEnvelope(t, req.Method+" "+req.URL.Path, w)
+	}
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	r := newTestRouter(t, newTestDB(t))
+	for _, problem := range apidoc.Check(apidoc.Routes, r.Routes()) {
+		t.Error(problem)
+	}
+}
+
+func TestSystemInfoRoute(t *testing.T) {
+	r := newTestRouter(t, newTestDB(t))
+	for _, tc := range []struct {
+		secret string
+		status int
+	}{
+		{"admin-secret", 200},
+		{"", 403}, // 默认需要管理员密钥
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/system/info", nil)
+		if tc.secret != "" {
+			req.Header.Set("X-Admin-Secret", tc.secret)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		checkEnvelope(t, "系统信息", w)
+		if w.Code != tc.status {
+			t.Fatalf("管理员密钥 %q 返回 %d，期望 %d: %s", tc.secret, w.Code, tc.status, w.Body.String())
+		}
+		if tc.status == 200 && !strings.Contains(w.Body.String(), `"go_version"`) {
+			t.Fatalf("系统信息 %s", w.Body.String())
+		}
+	}
+}
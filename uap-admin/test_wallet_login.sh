@@ -9,6 +9,10 @@ echo ""
 # 服务端地址
 API_URL="https://admin.uap.io/api/v1/auth/wallet"
 
+# 获取签名参数（服务身份 domain 需写入签名消息）
+DOMAIN=$(curl -s "$API_URL/params" | sed -n 's/.*"domain":"\([^"]*\)".*/\1/p')
+echo "🏷️  服务身份: $DOMAIN"
+
 # 生成测试密钥对（使用 Go 脚本）
 cat > /tmp/gen_key.go << 'EOF'
 package main
@@ -18,6 +22,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"os"
 	"time"
 )
 
@@ -25,11 +30,14 @@ func main() {
 	// 生成密钥对
 	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
 	
-	// 生成时间戳
+	// 生成时间戳与随机 nonce
 	timestamp := time.Now().Unix()
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
 	
-	// 构造签名消息
-	message := fmt.Sprintf("uap-login:%d", timestamp)
+	// 构造 v2 签名消息: uap-login|v2|<domain>|<timestamp>|<nonce>
+	message := fmt.Sprintf("uap-login|v2|%s|%d|%s", os.Args[1], timestamp, nonce)
 	messageBytes := []byte(message)
 	
 	// 签名
@@ -39,14 +47,16 @@ func main() {
 	fmt.Printf(`{
   "public_key": "%s",
   "signature": "%s",
-  "timestamp": %d
+  "timestamp": %d,
+  "version": 2,
+  "nonce": "%s"
 }
-`, hex.EncodeToString(pub), hex.EncodeToString(signature), timestamp)
+`, hex.EncodeToString(pub), hex.EncodeToString(signature), timestamp, nonce)
 }
 EOF
 
 # 生成测试数据
-TEST_DATA=$(go run /tmp/gen_key.go)
+TEST_DATA=$(go run /tmp/gen_key.go "$DOMAIN")
 
 echo "📝 测试数据："
 echo "$TEST_DATA" | jq . 2>/dev/null || echo "$TEST_DATA"
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckRules -check-rules 的退出码：有跳过的行为 1，文件无法读取为 2
+func TestCheckRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, rules string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	for _, tc := range []struct {
+		name, rules string
+		code        int
+	}{
+		{"clean.txt", "example.com\nnetflix.com,tag=bulk\n", 0},
+		{"fixed.txt", "https://example.com/\nexample.com:443\n", 0}, // 纠正与重复只提示
+		{"skipped.txt", "example.com\nbad domain.com\n", 1},
+	} {
+		if code := checkRules(write(tc.name, tc.rules)); code != tc.code {
+			t.Errorf("%s 的退出码 %d，期望 %d", tc.name, code, tc.code)
+		}
+	}
+	if code := checkRules(filepath.Join(dir, "missing.txt")); code != 2 {
+		t.Fatalf("文件不存在时退出码 %d，期望 2", code)
+	}
+}
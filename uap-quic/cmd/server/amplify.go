@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// amplificationPorts 已知的 UDP 放大攻击端口：小请求换大响应，正常翻墙流量几乎用不到
+// 默认拒绝，确有需要（如经隧道做 NTP 校时）时通过 -udp-allow-ports 放行
+var amplificationPorts = map[int]string{
+	17:    "QOTD",
+	19:    "CharGen",
+	123:   "NTP",
+	161:   "SNMP",
+	389:   "CLDAP",
+	1900:  "SSDP",
+	3702:  "WS-Discovery",
+	11211: "memcached",
+}
+
+// 响应/请求字节比检查参数
+const (
+	// ampMinReplyBytes 目标的累计回包达到该字节数后才检查比值（少量 DNSSEC 等大响应不会误判）
+	ampMinReplyBytes = 64 * 1024
+	// ampMaxFlows 单个 UDP 关联跟踪的目标数上限，超出时清空未封禁的记录
+	ampMaxFlows = 4096
+)
+
+// ampPolicy 放大防护策略（启动时由命令行参数设置，之后只读）
+var ampPolicy = &amplificationPolicy{blockedPorts: amplificationPorts, maxRatio: 20}
+
+// udpAmpBlocked 累计因放大防护被拒绝的 UDP 包数（所有连接共享）
+var udpAmpBlocked atomic.Int64
+
+// amplificationPolicy 出站 UDP 放大防护策略
+type amplificationPolicy struct {
+	blockedPorts map[int]string // 拒绝的目标端口 -> 协议名
+	maxRatio     float64        // 单个目标允许的回包/请求字节比（<= 0 表示不检查）
+}
+
+// newAmplificationPolicy 由放行端口列表（逗号分隔）与字节比上限创建策略
+// allow 为 "all" 时不拒绝任何端口
+func newAmplificationPolicy(allow string, maxRatio float64) (*amplificationPolicy, error) {
+	p := &amplificationPolicy{blockedPorts: make(map[int]string), maxRatio: maxRatio}
+	if strings.TrimSpace(allow) == "all" {
+		return p, nil
+	}
+	for port, name := range amplificationPorts {
+		p.blockedPorts[port] = name
+	}
+	for _, item := range strings.Split(allow, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := strconv.Atoi(item)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("端口格式错误: %q", item)
+		}
+		delete(p.blockedPorts, port)
+	}
+	return p, nil
+}
+
+// String 拒绝的端口列表（日志使用）
+func (p *amplificationPolicy) String() string {
+	if len(p.blockedPorts) == 0 {
+		return "无"
+	}
+	ports := make([]int, 0, len(p.blockedPorts))
+	for port := range p.blockedPorts {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	items := make([]string, len(ports))
+	for i, port := range ports {
+		items[i] = fmt.Sprintf("%d/%s", port, p.blockedPorts[port])
+	}
+	return strings.Join(items, ", ")
+}
+
+// ampGuard 单个 UDP 关联的放大防护：按目标统计请求与回包字节数，回包远大于请求的目标被封禁
+type ampGuard struct {
+	tag    string // 日志前缀
+	policy *amplificationPolicy
+
+	mu         sync.Mutex
+	flows      map[string]*ampFlow // 目标地址 -> 统计
+	portLogged bool                // 本关联是否已记录过端口拒绝日志
+}
+
+// ampFlow 单个目标的字节统计
+type ampFlow struct {
+	sent, recv int64
+	blocked    bool
+}
+
+// newAmpGuard 为一个 UDP 关联创建放大防护
+func newAmpGuard(tag string) *ampGuard {
+	return &ampGuard{tag: tag, policy: ampPolicy, flows: make(map[string]*ampFlow)}
+}
+
+// allowSend 判断发往 addr 的 n 字节载荷是否放行，并计入该目标的请求字节数
+func (g *ampGuard) allowSend(addr *net.UDPAddr, n int) bool {
+	if name, ok := g.policy.blockedPorts[addr.Port]; ok {
+		total := udpAmpBlocked.Add(1)
+		g.mu.Lock()
+		first := !g.portLogged
+		g.portLogged = true
+		g.mu.Unlock()
+		if first {
+			log.Printf("🛡️ %s 拒绝发往放大攻击端口的 UDP 包: %s (%s)，之后同一关联只计数（累计拒绝 %d 个）", g.tag, addr, name, total)
+		}
+		return false
+	}
+	if g.policy.maxRatio <= 0 {
+		return true
+	}
+
+	key := addr.String()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	flow, ok := g.flows[key]
+	if !ok {
+		if len(g.flows) >= ampMaxFlows {
+			for k, f := range g.flows {
+				if !f.blocked {
+					delete(g.flows, k)
+				}
+			}
+		}
+		flow = &ampFlow{}
+		g.flows[key] = flow
+	}
+	if flow.blocked {
+		udpAmpBlocked.Add(1)
+		return false
+	}
+	flow.sent += int64(n)
+	return true
+}
+
+// allowReply 计入来自 addr 的 n 字节回包，返回是否转发给客户端
+// 回包累计超过 ampMinReplyBytes 且超过请求字节数的 maxRatio 倍时封禁该目标（之后的请求与回包都丢弃）
+func (g *ampGuard) allowReply(addr *net.UDPAddr, n int) bool {
+	if g.policy.maxRatio <= 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	flow, ok := g.flows[addr.String()]
+	if !ok {
+		// 客户端没有发过请求的来源（端口复用或 NAT 回包），不参与比值统计
+		return true
+	}
+	if flow.blocked {
+		return false
+	}
+	flow.recv += int64(n)
+	if flow.recv >= ampMinReplyBytes && float64(flow.recv) > float64(flow.sent)*g.policy.maxRatio {
+		flow.blocked = true
+		total := udpAmpBlocked.Add(1)
+		log.Printf("🛡️ %s 目标 %s 的回包/请求字节比过高 (%d / %d 字节，上限 %.0f 倍)，疑似放大攻击，封禁该目标（累计拒绝 %d 个）",
+			g.tag, addr, flow.recv, flow.sent, g.policy.maxRatio, total)
+		return false
+	}
+	return true
+}
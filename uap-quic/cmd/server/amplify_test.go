@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testAmpGuard 使用策略 p 的放大防护（不修改全局策略：测试节点的处理协程可能同时读取）
+func testAmpGuard(p *amplificationPolicy) *ampGuard {
+	return &ampGuard{tag: "[test]", policy: p, flows: make(map[string]*ampFlow)}
+}
+
+// startUDPAmplifier 本机 port 端口（0 为随机端口）的 UDP 服务，对每个请求回复 factor 倍长度的数据
+func startUDPAmplifier(t *testing.T, port, factor int) *net.UDPAddr {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Skipf("无法监听 UDP 端口 %d: %v", port, err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteToUDP(bytes.Repeat(buf[:n], factor), addr)
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+func TestNewAmplificationPolicy(t *testing.T) {
+	p, err := newAmplificationPolicy("", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range []int{17, 19, 123, 161, 389, 1900, 3702, 11211} {
+		if _, ok := p.blockedPorts[port]; !ok {
+			t.Errorf("默认未拒绝端口 %d", port)
+		}
+	}
+	if _, ok := p.blockedPorts[53]; ok {
+		t.Error("默认拒绝了 DNS 端口")
+	}
+
+	p, err = newAmplificationPolicy(" 123, 1900 ,", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.blockedPorts[123]; ok || len(p.blockedPorts) != len(amplificationPorts)-2 {
+		t.Fatalf("放行 123,1900 后拒绝 %s", p)
+	}
+	// 放行列表不修改默认端口表
+	if _, ok := amplificationPorts[123]; !ok {
+		t.Fatal("放行端口修改了默认端口表")
+	}
+
+	if p, err := newAmplificationPolicy("all", 0); err != nil || p.String() != "无" {
+		t.Fatalf("all 返回 %v %v", p, err)
+	}
+	for _, allow := range []string{"ntp", "0", "70000"} {
+		if _, err := newAmplificationPolicy(allow, 20); err == nil {
+			t.Errorf("放行端口 %q 应返回错误", allow)
+		}
+	}
+}
+
+func TestAmpGuardRatio(t *testing.T) {
+	g := testAmpGuard(&amplificationPolicy{blockedPorts: map[int]string{123: "NTP"}, maxRatio: 20})
+	target := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53}
+	before := udpAmpBlocked.Load()
+
+	if g.allowSend(&net.UDPAddr{IP: target.IP, Port: 123}, 48) {
+		t.Fatal("发往 NTP 端口的包被放行")
+	}
+
+	// 比值以内的大响应（如 DNSSEC）不封禁；累计回包达到阈值之前不检查比值
+	if !g.allowSend(target, 100) || !g.allowReply(target, ampMinReplyBytes-1) {
+		t.Fatal("未达阈值的回包被拒绝")
+	}
+	normal := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 53}
+	for i := 0; i < 200; i++ {
+		if !g.allowSend(normal, 40) || !g.allowReply(normal, 500) {
+			t.Fatalf("正常 DNS 查询第 %d 次被拒绝", i)
+		}
+	}
+
+	// 超过阈值且比值过高：封禁该目标，之后的请求与回包都丢弃
+	if g.allowReply(target, 2) {
+		t.Fatal("回包/请求字节比过高时未封禁")
+	}
+	if g.allowSend(target, 100) || g.allowReply(target, 10) {
+		t.Fatal("封禁后的目标仍被放行")
+	}
+	// 客户端没有发过请求的来源不参与统计
+	if !g.allowReply(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 3), Port: 53}, ampMinReplyBytes*2) {
+		t.Fatal("未请求过的来源被拒绝")
+	}
+	if got := udpAmpBlocked.Load() - before; got != 3 {
+		t.Fatalf("拒绝计数增加了 %d，期望 3", got)
+	}
+
+	// 比值上限为 0 时不检查
+	g = testAmpGuard(&amplificationPolicy{maxRatio: 0})
+	if !g.allowSend(target, 1) || !g.allowReply(target, ampMinReplyBytes*100) {
+		t.Fatal("不检查比值时拒绝了回包")
+	}
+}
+
+func TestUDPAmplificationOverTunnel(t *testing.T) {
+	// 使用默认策略：memcached 端口默认拒绝，回包为请求 4 倍的目标（正常 DNS 一类）在比值以内
+	normal := startUDPAmplifier(t, 0, 4)
+	blocked := startUDPAmplifier(t, 11211, 4)
+	node := startTestNode(t)
+
+	t.Run("Datagram", func(t *testing.T) {
+		port := freePort(t)
+		client := node.newClientOnPort(t, port)
+		go client.Start("")
+		app, header := socksUDPApp(t, port, normal)
+		// 同一关联发往拒绝端口
+		blockedHeader := binary.BigEndian.AppendUint16(append([]byte{}, header[:8]...), uint16(blocked.Port))
+
+		for i := 0; i < 3; i++ {
+			if _, err := app.Write(append(append([]byte{}, header...), "query"...)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 2048)
+			app.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, err := app.Read(buf)
+			if err != nil || n != len(header)+20 {
+				t.Fatalf("正常目标的回包 %d 字节: %v", n, err)
+			}
+		}
+
+		before := udpAmpBlocked.Load()
+		app.Write(append(append([]byte{}, blockedHeader...), "query"...))
+		buf := make([]byte, 2048)
+		app.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		if _, err := app.Read(buf); err == nil {
+			t.Fatal("发往拒绝端口的包收到了回包")
+		}
+		if udpAmpBlocked.Load() == before {
+			t.Fatal("拒绝未计数")
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		client := node.connect(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn, err := client.DialUDP(ctx, normal.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("query"))
+		if n, err := conn.Read(make([]byte, 2048)); err != nil || n != 20 {
+			t.Fatalf("正常目标的回包 %d 字节: %v", n, err)
+		}
+
+		conn, err = client.DialUDP(ctx, net.JoinHostPort("127.0.0.1", strconv.Itoa(blocked.Port)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(300 * time.Millisecond))
+		conn.Write([]byte("query"))
+		if _, err := conn.Read(make([]byte, 2048)); err == nil {
+			t.Fatal("发往拒绝端口的包收到了回包")
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/config"
+	"uap-quic/pkg/psk"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quic-go/quic-go"
+)
+
+func TestReadAuthLine(t *testing.T) {
+	cases := map[string]string{
+		"token\n":         "token",
+		"token\r\n":       "token",
+		"  token \t\r\n":  "token",
+		"\n":              "",
+		"a b:c\n":         "a b:c", // 签名握手的凭证中间有空格
+		"token\nnext":     "token",
+		"token\r\r\nnext": "token\r",
+	}
+	for input, want := range cases {
+		r := strings.NewReader(input)
+		got, err := readAuthLine(r)
+		if err != nil || got != want {
+			t.Errorf("readAuthLine(%q) = %q, %v，期望 %q", input, got, err, want)
+		}
+		// 不多读换行之后的数据（地址帧紧跟在鉴权行后面）
+		if rest, _ := io.ReadAll(r); strings.Contains(input, "next") && string(rest) != "next" {
+			t.Errorf("readAuthLine(%q) 多读了数据，剩余 %q", input, rest)
+		}
+	}
+
+	// 没有换行就结束
+	if _, err := readAuthLine(strings.NewReader("token")); !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		t.Errorf("没有换行返回 %v", err)
+	}
+
+	// 恰好 maxAuthLineLen 字节的凭证可以读取，再长一个字节即拒绝，且读满上限后不再继续读取
+	exact := strings.Repeat("a", maxAuthLineLen)
+	if got, err := readAuthLine(strings.NewReader(exact + "\n")); err != nil || got != exact {
+		t.Errorf("最大长度的鉴权行: %v", err)
+	}
+	long := bytes.NewReader([]byte(strings.Repeat("a", maxAuthLineLen+100) + "\n"))
+	if _, err := readAuthLine(long); !errors.Is(err, errAuthLineTooLong) {
+		t.Errorf("超长的鉴权行返回 %v", err)
+	}
+	if read := maxAuthLineLen + 101 - long.Len(); read != maxAuthLineLen+1 {
+		t.Errorf("超长的鉴权行读取了 %d 字节，期望 %d", read, maxAuthLineLen+1)
+	}
+}
+
+func TestAuthLineCRLF(t *testing.T) {
+	conn := startTestNode(t).dialRaw(t)
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	stream.Write([]byte(" " + testJWTToken + " \r\n"))
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
+		t.Fatalf("CRLF 结尾的鉴权行未通过: %v %v", status, err)
+	}
+}
+
+func TestAuthLineTooLongGetsDecoy(t *testing.T) {
+	conn := startTestNode(t).dialRaw(t)
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	probes := probeCount.Load()
+
+	// 不带换行持续发送：节点读满上限后进入伪装模式，不等换行
+	go func() {
+		chunk := bytes.Repeat([]byte(testJWTToken), 16)
+		for i := 0; i < 64; i++ {
+			if _, err := stream.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	reply := make([]byte, len("HTTP/1.1"))
+	if _, err := io.ReadFull(stream, reply); err != nil {
+		t.Fatalf("读取回复失败: %v", err)
+	}
+	if string(reply) != "HTTP/1.1" {
+		t.Fatalf("回复 %q，期望伪装的网页报错", reply)
+	}
+	if probeCount.Load() <= probes {
+		t.Fatal("超长的鉴权行未计为探测")
+	}
+}
+
+// sendFailingAuthLine 在新流上发送不能通过鉴权的一行，等到节点打出鉴权失败的日志（不等伪装回复）
+func sendFailingAuthLine(t *testing.T, conn quic.Connection, logs *lockedBuffer, line string) {
+	t.Helper()
+	before := strings.Count(logs.String(), "[鉴权]")
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write([]byte(line + "\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(logs.String(), "[鉴权]") == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("节点未记录鉴权失败: %q", line)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stream.CancelRead(0)
+	stream.Close()
+}
+
+// TestAuthFailureLogsRedacted 各种鉴权失败的日志只有凭证的指纹，不含 Token、签名或 PSK 原文
+func TestAuthFailureLogsRedacted(t *testing.T) {
+	noUUID, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).SignedString(testJWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := signTestToken("test-user", -time.Hour)
+	forged := testJWTToken[:strings.LastIndex(testJWTToken, ".")+1] + "Zm9yZ2VkLXNpZ25hdHVyZS1mb3ItcmVkYWN0aW9u"
+	garbage := "not-a-jwt-but-still-a-secret-0123456789"
+	secrets := []string{noUUID, expired, forged, garbage, testJWTToken}
+
+	assertRedacted := func(t *testing.T, out string) {
+		t.Helper()
+		for _, secret := range secrets {
+			// 签名段是凭证中不可伪造的部分，单独检查
+			if sig := secret[strings.LastIndex(secret, ".")+1:]; strings.Contains(out, secret) || len(sig) >= 16 && strings.Contains(out, sig) {
+				t.Fatalf("日志包含凭证原文 %.20q...:\n%s", secret, out)
+			}
+		}
+	}
+
+	t.Run("JWT", func(t *testing.T) {
+		logs := captureLogs(t)
+		old := requireTicket
+		requireTicket = true // 长期 JWT 也走拒绝路径
+		t.Cleanup(func() { requireTicket = old })
+		conn := startTestNode(t).dialRaw(t)
+		for _, line := range []string{garbage, expired, forged, noUUID, testJWTToken} {
+			sendFailingAuthLine(t, conn, logs, line)
+		}
+		out := logs.String()
+		assertRedacted(t, out)
+		for _, token := range []string{expired, noUUID, testJWTToken} {
+			if !strings.Contains(out, config.Fingerprint(token)) {
+				t.Fatalf("日志中没有凭证指纹 %s:\n%s", config.Fingerprint(token), out)
+			}
+		}
+	})
+
+	t.Run("PSK", func(t *testing.T) {
+		logs := captureLogs(t)
+		withPSK(t, "node-psk-secret-value")
+		conn := startTestNode(t).dialRaw(t)
+		sealed := psk.Seal("wrong-psk-secret-value", testJWTToken)
+		sendFailingAuthLine(t, conn, logs, sealed)
+		out := logs.String()
+		assertRedacted(t, out)
+		for _, secret := range []string{"node-psk-secret-value", "wrong-psk-secret-value", sealed} {
+			if strings.Contains(out, secret) {
+				t.Fatalf("日志包含 PSK 或鉴权行原文:\n%s", out)
+			}
+		}
+		if !strings.Contains(out, config.Fingerprint(sealed)) {
+			t.Fatalf("日志中没有鉴权行指纹:\n%s", out)
+		}
+	})
+}
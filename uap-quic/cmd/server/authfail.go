@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 鉴权失败统计的限制
+const (
+	authFailMaxSources = 10000 // 最多跟踪的来源 IP 数（超出时不再跟踪新的来源，只计入总数）
+	authFailTopSources = 10    // 健康检查接口输出的失败最多的来源数
+)
+
+// authFailures 按来源 IP 统计的鉴权失败（-auth-fail-*）
+var authFailures *authFailTable
+
+// authFailTable 按来源 IP 统计窗口内的鉴权失败次数，用于发现爆破 / 扫描
+// threshold > 0 时窗口内失败达到阈值的来源被临时封禁，封禁期内新连接在接受时直接拒绝（单个探测仍走伪装流程）
+type authFailTable struct {
+	window    time.Duration
+	threshold int           // <= 0 表示只统计不封禁
+	banFor    time.Duration // 封禁时长
+
+	mu      sync.Mutex
+	sources map[string]*authFailSource
+
+	total    atomic.Int64 // 累计鉴权失败次数
+	bans     atomic.Int64 // 累计封禁次数
+	rejected atomic.Int64 // 封禁期内拒绝的连接数
+}
+
+// authFailSource 单个来源 IP 的失败记录
+type authFailSource struct {
+	start       time.Time // 当前窗口的开始时间（窗口内第一次失败）
+	count       int       // 当前窗口内的失败次数
+	last        time.Time // 最近一次失败
+	bannedUntil time.Time
+}
+
+// newAuthFailTable window 为统计窗口，threshold 为封禁阈值（<= 0 不封禁），banFor 为封禁时长
+func newAuthFailTable(window time.Duration, threshold int, banFor time.Duration) (*authFailTable, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("鉴权失败统计窗口必须大于 0")
+	}
+	if threshold > 0 && banFor <= 0 {
+		return nil, fmt.Errorf("启用封禁时封禁时长必须大于 0")
+	}
+	t := &authFailTable{
+		window:    window,
+		threshold: threshold,
+		banFor:    banFor,
+		sources:   make(map[string]*authFailSource),
+	}
+	go t.sweepLoop()
+	return t, nil
+}
+
+// record 记录来自 ip 的一次鉴权失败，返回当前窗口内的失败次数，以及该来源是否因此刚被封禁
+func (t *authFailTable) record(ip string, now time.Time) (int, bool) {
+	t.total.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sources[ip]
+	if !ok {
+		if len(t.sources) >= authFailMaxSources {
+			return 1, false
+		}
+		s = &authFailSource{start: now}
+		t.sources[ip] = s
+	}
+	if now.Sub(s.start) > t.window {
+		s.start, s.count = now, 0
+	}
+	s.count++
+	s.last = now
+
+	if t.threshold <= 0 || s.count < t.threshold || now.Before(s.bannedUntil) {
+		return s.count, false
+	}
+	s.bannedUntil = now.Add(t.banFor)
+	t.bans.Add(1)
+	return s.count, true
+}
+
+// banned 判断来自 ip 的新连接是否处于封禁期（封禁期内的拒绝计入统计）
+func (t *authFailTable) banned(ip string, now time.Time) bool {
+	if t.threshold <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	s, ok := t.sources[ip]
+	banned := ok && now.Before(s.bannedUntil)
+	t.mu.Unlock()
+	if banned {
+		t.rejected.Add(1)
+	}
+	return banned
+}
+
+// sweepLoop 删除窗口已过且不在封禁期内的来源
+func (t *authFailTable) sweepLoop() {
+	ticker := time.NewTicker(limiterSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		t.mu.Lock()
+		for ip, s := range t.sources {
+			if now.Sub(s.last) > t.window && !now.Before(s.bannedUntil) {
+				delete(t.sources, ip)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// authFailStats 鉴权失败统计（健康检查接口输出）
+type authFailStats struct {
+	Total    int64            `json:"total"`    // 累计鉴权失败次数
+	Sources  int              `json:"sources"`  // 窗口内有失败记录的来源 IP 数
+	Banned   int              `json:"banned"`   // 封禁中的来源 IP 数
+	Bans     int64            `json:"bans"`     // 累计封禁次数
+	Rejected int64            `json:"rejected"` // 封禁期内拒绝的连接数
+	Top      []authFailSample `json:"top,omitempty"`
+}
+
+// authFailSample 单个来源的失败统计
+type authFailSample struct {
+	IP          string `json:"ip"`
+	Failures    int    `json:"failures"`               // 当前窗口内的失败次数
+	LastFailure int64  `json:"last_failure"`           // 最近一次失败（Unix 秒）
+	BannedUntil int64  `json:"banned_until,omitempty"` // 封禁到期时间（Unix 秒，未封禁时省略）
+}
+
+// stats 鉴权失败统计，Top 为窗口内失败最多的来源（未启用时返回 nil）
+func (t *authFailTable) stats(now time.Time) *authFailStats {
+	if t == nil {
+		return nil
+	}
+	st := &authFailStats{
+		Total:    t.total.Load(),
+		Bans:     t.bans.Load(),
+		Rejected: t.rejected.Load(),
+	}
+
+	t.mu.Lock()
+	for ip, s := range t.sources {
+		banned := now.Before(s.bannedUntil)
+		if banned {
+			st.Banned++
+		}
+		if now.Sub(s.last) > t.window && !banned {
+			continue // 等待清理
+		}
+		st.Sources++
+		sample := authFailSample{IP: ip, Failures: s.count, LastFailure: s.last.Unix()}
+		if banned {
+			sample.BannedUntil = s.bannedUntil.Unix()
+		}
+		st.Top = append(st.Top, sample)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(st.Top, func(i, j int) bool {
+		if st.Top[i].Failures != st.Top[j].Failures {
+			return st.Top[i].Failures > st.Top[j].Failures
+		}
+		return st.Top[i].IP < st.Top[j].IP
+	})
+	if len(st.Top) > authFailTopSources {
+		st.Top = st.Top[:authFailTopSources]
+	}
+	return st
+}
+
+// recordAuthFailure 记录一次鉴权失败（handleInvalidToken 调用），来源刚被封禁时打日志
+func recordAuthFailure(ip string) {
+	if authFailures == nil {
+		return
+	}
+	if count, banned := authFailures.record(ip, time.Now()); banned {
+		log.Printf("🚫 [鉴权] 来源 %s 在 %v 内鉴权失败 %d 次，临时封禁 %v", ip, authFailures.window, count, authFailures.banFor)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+
+	"github.com/quic-go/quic-go"
+)
+
+// withAuthFailures 测试期间启用鉴权失败统计（须在 startTestNode 之前调用）
+func withAuthFailures(t *testing.T, window time.Duration, threshold int, banFor time.Duration) *authFailTable {
+	t.Helper()
+	table, err := newAuthFailTable(window, threshold, banFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authFailures = table
+	t.Cleanup(func() { authFailures = nil })
+	return table
+}
+
+// sendBadToken 新建一条连接发送错误的鉴权行，节点记下失败后断开（不等伪装回复）
+func sendBadToken(t *testing.T, addr string, table *authFailTable) {
+	t.Helper()
+	before := table.stats(time.Now()).Total
+	conn, err := dialNode(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write([]byte("bad-token\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for table.stats(time.Now()).Total == before {
+		if time.Now().After(deadline) {
+			t.Fatal("节点未记录鉴权失败")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dialNode 直接建立 QUIC 连接（被拒绝时返回错误，不结束测试）
+func dialNode(addr string) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return quic.DialAddr(ctx, addr, &tls.Config{
+		ServerName: core.ServerName,
+		NextProtos: []string{serverALPN()},
+	}, testQUICConfig())
+}
+
+// TestAuthFailBan 同一来源连续鉴权失败达到阈值后被临时封禁，封禁期内的新连接在握手前被拒绝
+func TestAuthFailBan(t *testing.T) {
+	logs := captureLogs(t)
+	table := withAuthFailures(t, time.Minute, 3, time.Minute)
+	quicConfig := testQUICConfig()
+	quicConfig.GetConfigForClient = admitConnection(newIPRateLimiter(1000, 1000), quicConfig)
+	node := startTestNodeWithConfig(t, quicConfig)
+
+	for i := 1; i <= 2; i++ {
+		sendBadToken(t, node.addr, table)
+		if s := table.stats(time.Now()); s.Total != int64(i) || s.Sources != 1 || s.Top[0].Failures != i || s.Banned != 0 {
+			t.Fatalf("第 %d 次失败后的统计 %+v", i, s)
+		}
+	}
+	// 未达阈值时仍可连接
+	conn, err := dialNode(node.addr)
+	if err != nil {
+		t.Fatalf("未达阈值的来源被拒绝: %v", err)
+	}
+	conn.CloseWithError(0, "")
+
+	sendBadToken(t, node.addr, table)
+	s := table.stats(time.Now())
+	if s.Banned != 1 || s.Bans != 1 || s.Top[0].IP != "127.0.0.1" || s.Top[0].BannedUntil == 0 {
+		t.Fatalf("达到阈值后的统计 %+v", s)
+	}
+	if !strings.Contains(logs.String(), "临时封禁") {
+		t.Fatal("封禁时未打日志")
+	}
+
+	var transportErr *quic.TransportError
+	if _, err := dialNode(node.addr); !errors.As(err, &transportErr) || transportErr.ErrorCode != quic.ConnectionRefused {
+		t.Fatalf("封禁中的来源应在握手前被拒绝，实际 %v", err)
+	}
+	if s := table.stats(time.Now()); s.Rejected != 1 {
+		t.Fatalf("封禁期内拒绝数 %d", s.Rejected)
+	}
+}
+
+func TestAuthFailTable(t *testing.T) {
+	table, err := newAuthFailTable(time.Minute, 3, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	// 窗口内累计，窗口过后重新计数
+	for i := 1; i <= 2; i++ {
+		if count, banned := table.record("203.0.113.1", now); count != i || banned {
+			t.Fatalf("第 %d 次失败: %d, %v", i, count, banned)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if count, _ := table.record("203.0.113.1", now); count != 1 {
+		t.Fatalf("窗口过后失败次数 %d，期望重新计数", count)
+	}
+
+	// 达到阈值时封禁，封禁期内再失败不重复封禁
+	table.record("203.0.113.1", now)
+	if count, banned := table.record("203.0.113.1", now); count != 3 || !banned {
+		t.Fatalf("达到阈值: %d, %v", count, banned)
+	}
+	if _, banned := table.record("203.0.113.1", now); banned {
+		t.Fatal("封禁期内重复封禁")
+	}
+	if !table.banned("203.0.113.1", now.Add(time.Minute)) || table.banned("203.0.113.2", now) {
+		t.Fatal("封禁判断错误")
+	}
+	// 封禁到期后放行
+	if table.banned("203.0.113.1", now.Add(10*time.Minute)) {
+		t.Fatal("封禁到期后仍被拒绝")
+	}
+	if s := table.stats(now); s.Total != 6 || s.Bans != 1 || s.Rejected != 1 || s.Banned != 1 {
+		t.Fatalf("统计 %+v", s)
+	}
+
+	// 只统计不封禁
+	counting, err := newAuthFailTable(time.Minute, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, banned := counting.record("203.0.113.1", now); banned {
+			t.Fatal("未启用封禁时封禁了来源")
+		}
+	}
+	if counting.banned("203.0.113.1", now) {
+		t.Fatal("未启用封禁时拒绝了连接")
+	}
+
+	for _, tc := range []struct {
+		window    time.Duration
+		threshold int
+		banFor    time.Duration
+	}{{0, 0, 0}, {time.Minute, 3, 0}} {
+		if _, err := newAuthFailTable(tc.window, tc.threshold, tc.banFor); err == nil {
+			t.Errorf("%+v 未报错", tc)
+		}
+	}
+}
+
+// TestAuthFailStatsTop Top 按失败次数降序、同次数按 IP 排列，最多 authFailTopSources 个；窗口已过的来源不计入
+func TestAuthFailStatsTop(t *testing.T) {
+	if (*authFailTable)(nil).stats(time.Now()) != nil {
+		t.Fatal("未启用时有统计")
+	}
+	table, _ := newAuthFailTable(time.Minute, 0, 0)
+	now := time.Unix(1700000000, 0)
+	table.record("198.51.100.1", now.Add(-2*time.Minute)) // 窗口已过，等待清理
+	for i := 0; i < authFailTopSources+2; i++ {
+		ip := fmt.Sprintf("203.0.113.%d", i+1)
+		for n := 0; n <= i%3; n++ {
+			table.record(ip, now)
+		}
+	}
+
+	s := table.stats(now)
+	if s.Sources != authFailTopSources+2 || len(s.Top) != authFailTopSources {
+		t.Fatalf("来源数 %d，Top %d", s.Sources, len(s.Top))
+	}
+	for i := 1; i < len(s.Top); i++ {
+		prev, cur := s.Top[i-1], s.Top[i]
+		if prev.Failures < cur.Failures || (prev.Failures == cur.Failures && prev.IP > cur.IP) {
+			t.Fatalf("Top 顺序 %+v", s.Top)
+		}
+	}
+	if s.Top[0].Failures != 3 || s.Top[0].IP != "203.0.113.12" {
+		t.Fatalf("失败最多的来源 %+v", s.Top[0])
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// buildClientCLI 编译命令行客户端 (cmd/client)，返回可执行文件路径
+func buildClientCLI(t *testing.T) string {
+	t.Helper()
+	return buildBinary(t, "../client", "uap-client")
+}
+
+// buildBinary 编译 pkg（相对于本目录）为 name，返回可执行文件路径；short 模式或没有 go 命令时跳过
+func buildBinary(t *testing.T, pkg, name string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skipf("short 模式跳过编译 %s", name)
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("没有 go 命令，跳过")
+	}
+	bin := filepath.Join(t.TempDir(), name)
+	if out, err := exec.Command(goBin, "build", "-o", bin, pkg).CombinedOutput(); err != nil {
+		t.Fatalf("编译 %s 失败: %v\n%s", name, err, out)
+	}
+	return bin
+}
+
+// TestClientCLITunnel 命令行客户端经 core.Client 建立隧道，SOCKS5 连接按全局模式经节点转发
+// 使用信任模式：命令行客户端内置的 Token 不是测试节点签发的，也无法访问管理后台换取票据
+func TestClientCLITunnel(t *testing.T) {
+	bin := buildClientCLI(t)
+	withTrusted(t, true)
+	node := startTestNode(t)
+	echoAddr := startEchoServer(t)
+	_, echoPort, _ := net.SplitHostPort(echoAddr)
+	targetPort, _ := strconv.Atoi(echoPort)
+
+	// 本机地址任何模式下都直连：用 hosts 覆盖把测试域名指向回显服务，分流按域名走代理
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hosts"), []byte("127.0.0.1 echo.uap.test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	socksPort := freePort(t)
+	var logs lockedBuffer
+	cmd := exec.Command(bin, "-trusted", "-server", node.addr, "-port", strconv.Itoa(socksPort),
+		"-mode", "global", "-whitelist", "missing.txt", "-rules-cache", "", "-hosts", "hosts")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "UAP_PSK=", "UAP_WALLET_KEY=")
+	cmd.Stdout, cmd.Stderr = &logs, &logs
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+		if t.Failed() {
+			t.Logf("命令行客户端日志:\n%s", logs.String())
+		}
+	})
+
+	conn := socksConnect(t, socksPort, "echo.uap.test", targetPort)
+	msg := []byte("cli tunnel")
+	conn.Write(msg)
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || !bytes.Equal(buf, msg) {
+		t.Fatalf("经命令行客户端回显 %q: %v", buf, err)
+	}
+
+	select {
+	case err := <-exited:
+		t.Fatalf("命令行客户端提前退出: %v", err)
+	default:
+	}
+	// 日志由客户端进程异步写出
+	deadline := time.Now().Add(3 * time.Second)
+	for out := logs.String(); !strings.Contains(out, "隧道验证通过") || !strings.Contains(out, "🚀 代理: echo.uap.test"); out = logs.String() {
+		if time.Now().After(deadline) {
+			t.Fatalf("日志中没有隧道验证或代理记录")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// lockedBuffer 可并发读写的 bytes.Buffer：子进程输出写入的同时测试读取日志
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// compressionEnabled 是否允许客户端协商压缩 TCP 流
+var compressionEnabled bool
+
+// 能力位（opHello 中双方交换）
+const (
+	capCompress byte = 0x01 // 支持压缩的 TCP 转发 (opTCPDeflate)
+	capTargetV1 byte = 0x02 // 支持结构化转发目标 (opTCPConnect，协议版本 1)
+	capWarmup   byte = 0x04 // 支持预热请求 (opWarmup)
+
+	capUDPUnreachable byte = 0x08 // 客户端能识别 UDP 不可达信令（见 udpunreach.go），服务端开启 -udp-unreachable 时回复该位
+)
+
+// handleHello 处理能力协商指令（客户端每条 QUIC 连接协商一次）
+// 请求: 客户端能力位 (1 字节)
+// 响应: 0x00 + 服务端能力位 (1 字节)；旧版服务端不认识该指令，回复 0x01，客户端按无扩展能力处理
+// 协商结果记录在连接状态中（服务端据此决定是否发送客户端不认识的数据包）
+func handleHello(stream quic.Stream, state *connState) {
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	caps := make([]byte, 1)
+	if _, err := io.ReadFull(stream, caps); err != nil {
+		log.Printf("[Hello] 读取能力位失败: %v", err)
+		return
+	}
+
+	serverCaps := capTargetV1 | capWarmup
+	if compressionEnabled {
+		serverCaps |= capCompress
+	}
+	if udpUnreachable {
+		serverCaps |= capUDPUnreachable
+	}
+	state.caps.Store(uint32(serverCaps & caps[0]))
+	stream.Write([]byte{0x00, serverCaps & caps[0]})
+}
+
+// handleCompressedTCP 处理压缩的 TCP 转发指令
+// 请求: 地址长度 (1 字节) + 目标地址；响应与普通 TCP 转发相同 (0x00 成功 / 0x01 失败)，之后双向传输压缩帧
+func handleCompressedTCP(stream quic.Stream, state *connState, sl streamLog) {
+	if !compressionEnabled {
+		log.Printf("[QUIC TCP] 压缩未启用，拒绝压缩转发请求")
+		stream.Write([]byte{0x01}) // 失败信号
+		return
+	}
+
+	lengthBuf := make([]byte, 1)
+	if _, err := io.ReadFull(stream, lengthBuf); err != nil {
+		log.Printf("读取地址长度失败: %v", err)
+		return
+	}
+	handleTCPv0(stream, state, sl, int(lengthBuf[0]), true)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withCompression 测试期间设置节点是否允许压缩
+func withCompression(t *testing.T, enabled bool) {
+	old := compressionEnabled
+	compressionEnabled = enabled
+	t.Cleanup(func() { compressionEnabled = old })
+}
+
+// testHTML 可压缩的网页文本
+func testHTML(size int) []byte {
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "<li class=\"entry\"><a href=\"/page/%d\">条目 %d</a></li>\n", i, i)
+	}
+	return []byte(b.String()[:size])
+}
+
+func TestCompressionInterop(t *testing.T) {
+	payload := testHTML(256 * 1024)
+	for _, tc := range []struct {
+		server, client bool
+	}{
+		{true, true},
+		{true, false},
+		{false, true}, // 节点未开启：客户端按未压缩转发
+		{false, false},
+	} {
+		t.Run(fmt.Sprintf("节点=%v/客户端=%v", tc.server, tc.client), func(t *testing.T) {
+			withCompression(t, tc.server)
+			client := startTestNode(t).connect(t)
+			client.SetCompression(tc.client)
+			echoAddr := startEchoServer(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			conn, err := client.DialTCP(ctx, echoAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			go conn.Write(payload)
+			reply := make([]byte, len(payload))
+			if _, err := io.ReadFull(conn, reply); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reply, payload) {
+				t.Fatal("回显数据不一致")
+			}
+
+			stats := client.GetStats(0)
+			if compressed := tc.server && tc.client; compressed != (stats.CompressedRaw > 0) {
+				t.Fatalf("压缩统计 %d/%d，期望压缩=%v", stats.CompressedRaw, stats.CompressedWire, compressed)
+			}
+			// 网页文本经压缩后流量至少减半
+			if stats.CompressedRaw > 0 && stats.CompressedWire*2 > stats.CompressedRaw {
+				t.Fatalf("HTML 压缩后 %d 字节，原始 %d 字节", stats.CompressedWire, stats.CompressedRaw)
+			}
+		})
+	}
+}
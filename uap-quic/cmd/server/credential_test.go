@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sessionsOn 节点 addr 上已鉴权的会话的用户
+func sessionsOn(addr string) map[string]bool {
+	users := make(map[string]bool)
+	activeSessions.Range(func(_, value interface{}) bool {
+		state := value.(*connState)
+		if state.conn.LocalAddr().String() == addr {
+			users[state.user()] = true
+		}
+		return true
+	})
+	return users
+}
+
+// waitSession 等待节点 addr 上出现 user 的会话
+func waitSession(t *testing.T, addr, user string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !sessionsOn(addr)[user] {
+		if time.Now().After(deadline) {
+			t.Fatalf("节点 %s 上没有用户 %s 的会话: %v", addr, user, sessionsOn(addr))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClientSetToken(t *testing.T) {
+	node := startTestNode(t)
+	client := node.connect(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tunnel, err := client.DialTCP(ctx, startEchoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	echoOnce(t, tunnel, "before")
+	waitSession(t, node.addr, "test-user")
+
+	// 新凭证立即建立新连接，之后的请求走新连接
+	token := signTestToken("rotated-user", time.Hour)
+	if err := client.SetToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if client.Token() != token {
+		t.Fatal("Token() 未返回新 token")
+	}
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatal(err)
+	}
+	waitSession(t, node.addr, "rotated-user")
+
+	// 旧连接退役前，其上进行中的流照常转发
+	echoOnce(t, tunnel, "after")
+	if !sessionsOn(node.addr)["test-user"] {
+		t.Fatal("旧连接在退役前被关闭")
+	}
+	if err := client.SetToken(""); err == nil {
+		t.Fatal("空 token 更新成功")
+	}
+}
+
+func TestClientSetServer(t *testing.T) {
+	from, to := startTestNode(t), startTestNode(t)
+	client := from.connect(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tunnel, err := client.DialTCP(ctx, startEchoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	echoOnce(t, tunnel, "before")
+
+	if err := client.SetServer(to.addr); err != nil {
+		t.Fatal(err)
+	}
+	if client.ServerAddr() != to.addr {
+		t.Fatalf("当前节点 %s，期望 %s", client.ServerAddr(), to.addr)
+	}
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatal(err)
+	}
+	waitSession(t, to.addr, "test-user")
+	echoOnce(t, tunnel, "after")
+
+	// 地址无效时不切换；切换到当前节点不重建连接
+	if err := client.SetServer("no-port"); err == nil || client.ServerAddr() != to.addr {
+		t.Fatalf("无效的节点地址: %v", err)
+	}
+	before := sessionIDs()
+	if err := client.SetServer(to.addr); err != nil || replaced(before, sessionIDs()) != 0 {
+		t.Fatalf("切换到当前节点: %v", err)
+	}
+}
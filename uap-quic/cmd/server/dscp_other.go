@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// setDSCP 当前平台不支持设置 DSCP
+func setDSCP(conn syscall.Conn, dscp int) error {
+	return fmt.Errorf("当前平台 (%s) 不支持设置 DSCP", runtime.GOOS)
+}
@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setDSCP 设置 Socket 发出的包的 DSCP（IPv4 的 TOS / IPv6 的 Traffic Class 高 6 位）
+// 双栈 Socket 两个选项都设置；任一设置成功即可
+func setDSCP(conn syscall.Conn, dscp int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var v4Err, v6Err error
+	if err := raw.Control(func(fd uintptr) {
+		v4Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2)
+		v6Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2)
+	}); err != nil {
+		return err
+	}
+	if v4Err != nil && v6Err != nil {
+		return errors.Join(v4Err, v6Err)
+	}
+	return nil
+}
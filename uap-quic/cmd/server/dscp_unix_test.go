@@ -0,0 +1,82 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"uap-quic/pkg/target"
+)
+
+// socketTOS Socket 的 IPv4 TOS 字节
+func socketTOS(t *testing.T, conn syscall.Conn) int {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tos int
+	var sockErr error
+	raw.Control(func(fd uintptr) {
+		tos, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+	})
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return tos
+}
+
+func TestGameDSCPTCP(t *testing.T) {
+	withQoS(t, 0, 46)
+	for _, flags := range []target.Flags{0, target.FlagGame} {
+		conn, err := net.Dial("tcp", startEchoServer(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		applyTCPClass(flags, conn, conn, conn)
+		want := 0
+		if flags == target.FlagGame {
+			want = 46 << 2
+		}
+		if tos := socketTOS(t, conn.(*net.TCPConn)); tos != want {
+			t.Errorf("标志 %#x 的目标连接 TOS %#x，期望 %#x", flags, tos, want)
+		}
+	}
+}
+
+func TestGameDSCPUDP(t *testing.T) {
+	withQoS(t, 0, 46)
+	echo := startUDPEcho(t).LocalAddr().(*net.UDPAddr)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newUDPEgress(conn, nil, func(c *net.UDPConn) { c.ReadFromUDP(make([]byte, 64)) })
+	defer func() {
+		e.Close()
+		e.Wait()
+	}()
+
+	// 游戏流量使用同一源地址上带 DSCP 标记的 Socket（首次使用时创建），其他流量使用默认出口
+	for _, flags := range []target.Flags{0, target.FlagGame, target.FlagGame, target.FlagBulk} {
+		if _, err := e.WriteToUDP([]byte("ping"), echo, flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.mu.Lock()
+	game, ok := e.routed["127.0.0.1/game"]
+	n := len(e.routed)
+	e.mu.Unlock()
+	if !ok || n != 1 {
+		t.Fatalf("游戏流量出口 %v（共 %d 个策略 Socket）", ok, n)
+	}
+	if tos := socketTOS(t, game); tos != 46<<2 {
+		t.Fatalf("游戏流量出口 TOS %#x", tos)
+	}
+	if tos := socketTOS(t, conn); tos != 0 {
+		t.Fatalf("默认出口 TOS %#x", tos)
+	}
+}
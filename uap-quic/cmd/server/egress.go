@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"uap-quic/pkg/target"
+)
+
+// 出口 IP 选择策略
+const (
+	egressRoundRobin = "round-robin" // 每个出站连接依次轮换
+	egressHash       = "hash"        // 按目标主机固定（同一网站始终使用同一出口，避免会话中途换 IP）
+)
+
+// egress 出口 IP 池（nil 表示使用系统默认出口）
+var egress *egressPool
+
+// egressPool 出口 IP 池：每个出站连接绑定其中一个源地址，避免单个出口 IP 被目标网站限速或封禁
+type egressPool struct {
+	strategy string
+	v4, v6   []net.IP
+	next     atomic.Uint64 // 轮换计数
+}
+
+// newEgressPool 解析逗号分隔的出口 IP 列表，每个地址都必须是本机地址；列表为空时返回 nil
+func newEgressPool(list, strategy string) (*egressPool, error) {
+	if strategy != egressRoundRobin && strategy != egressHash {
+		return nil, fmt.Errorf("未知的出口 IP 策略: %q（可选 %s / %s）", strategy, egressRoundRobin, egressHash)
+	}
+
+	p := &egressPool{strategy: strategy}
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+
+		ip := net.ParseIP(item)
+		if ip == nil {
+			return nil, fmt.Errorf("出口 IP 格式错误: %q", item)
+		}
+		// 能绑定才说明是本机地址（配置错误时启动即失败，而不是每次拨号失败）
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+		if err != nil {
+			return nil, fmt.Errorf("出口 IP %s 不可用: %w", item, err)
+		}
+		conn.Close()
+
+		if ip4 := ip.To4(); ip4 != nil {
+			p.v4 = append(p.v4, ip4)
+		} else {
+			p.v6 = append(p.v6, ip)
+		}
+	}
+	if len(p.v4)+len(p.v6) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// String 出口 IP 列表（日志使用）
+func (p *egressPool) String() string {
+	var ips []string
+	for _, ip := range append(append([]net.IP{}, p.v4...), p.v6...) {
+		ips = append(ips, ip.String())
+	}
+	return strings.Join(ips, ", ")
+}
+
+// pick 从 ips 中选择出口：round-robin 依次轮换，hash 按 key 固定
+func (p *egressPool) pick(ips []net.IP, key string) net.IP {
+	if p.strategy == egressHash {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return ips[h.Sum32()%uint32(len(ips))]
+	}
+	return ips[(p.next.Add(1)-1)%uint64(len(ips))]
+}
+
+// dialTarget 连接 TCP 目标 (host:port)：命中路由策略时绑定策略的源地址，否则配置了出口 IP 池时绑定池中的源地址
+// flags 中的地址族偏好只影响域名目标：先连接偏好的地址族，失败再试另一个
+func dialTarget(addr string, flags target.Flags) (net.Conn, error) {
+	if routes != nil {
+		if conn, routed, err := routes.dialTCP(addr, flags); routed {
+			return conn, err
+		}
+	}
+	return dialDefault(addr, flags)
+}
+
+// dialDefault 不经路由策略连接 TCP 目标（出口 IP 池或系统默认出口）
+func dialDefault(addr string, flags target.Flags) (net.Conn, error) {
+	if egress != nil {
+		return egress.dialTCP(addr, flags)
+	}
+	dialer := upstreamDialer(nil, addr)
+	networks := preferredNetworks(flags)
+	if networks == nil {
+		return dialer.Dial("tcp", addr)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && net.ParseIP(host) != nil {
+		return dialer.Dial("tcp", addr)
+	}
+	conn, err := dialer.Dial(networks[0], addr)
+	if err != nil {
+		conn, err = dialer.Dial(networks[1], addr)
+	}
+	return conn, err
+}
+
+// dialStatus 连接目标失败时回复给客户端的状态：目标拒绝连接、超时或网络不可达时分别回复，其他原因（如域名解析失败）为 StatusFailed
+func dialStatus(err error) byte {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return target.StatusRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return target.StatusUnreachable
+	}
+	return target.StatusFailed
+}
+
+// preferredNetworks 地址族偏好对应的拨号顺序，没有偏好时返回 nil
+func preferredNetworks(flags target.Flags) []string {
+	switch {
+	case flags&target.FlagPreferIPv4 != 0:
+		return []string{"tcp4", "tcp6"}
+	case flags&target.FlagPreferIPv6 != 0:
+		return []string{"tcp6", "tcp4"}
+	}
+	return nil
+}
+
+// dialTCP 按目标的地址族选择出口 IP 拨号
+// 目标是域名时先用 IPv4 出口（偏好 IPv6 时先用 IPv6），失败且池中有另一地址族的出口时再试
+func (p *egressPool) dialTCP(addr string, flags target.Flags) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	type family struct {
+		network string
+		ips     []net.IP
+	}
+	var families []family
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil {
+		families = append(families, family{"tcp4", p.v4})
+	}
+	if ip == nil || ip.To4() == nil {
+		families = append(families, family{"tcp6", p.v6})
+	}
+	if ip == nil && flags&target.FlagPreferIPv6 != 0 {
+		families[0], families[1] = families[1], families[0]
+	}
+
+	var lastErr error
+	for _, f := range families {
+		if len(f.ips) == 0 {
+			continue
+		}
+		conn, err := upstreamDialer(p.pick(f.ips, host), addr).Dial(f.network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("出口 IP 池中没有与目标地址族相同的地址")
+	}
+	return nil, lastErr
+}
+
+// listenEgressUDP 创建 UDP 关联的出口，并为每个出口 Socket 启动回包读取流程 read
+// 默认 Socket 在配置了出口 IP 池时绑定池中的一个地址（key 为 hash 策略的固定依据）：池中有 IPv4 地址时使用 IPv4（该关联无法访问 IPv6 目标），否则使用 IPv6
+// 发往命中路由策略的目标时另建绑定策略源地址的 Socket；user 为关联所属的用户（出口租约按用户认领）
+func listenEgressUDP(key string, user func() string, read func(*net.UDPConn)) (*udpEgress, error) {
+	var conn *net.UDPConn
+	var err error
+	switch {
+	case egress == nil:
+		conn, err = listenExitUDP("udp", nil)
+	case len(egress.v4) > 0:
+		conn, err = listenExitUDP("udp4", &net.UDPAddr{IP: egress.pick(egress.v4, key)})
+	default:
+		conn, err = listenExitUDP("udp6", &net.UDPAddr{IP: egress.pick(egress.v6, key)})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newUDPEgress(conn, user, read), nil
+}
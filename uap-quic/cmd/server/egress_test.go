@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// withEgress 测试期间使用 ips（逗号分隔）作为出口 IP 池
+func withEgress(t *testing.T, ips, strategy string) *egressPool {
+	t.Helper()
+	pool, err := newEgressPool(ips, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := egress
+	egress = pool
+	t.Cleanup(func() { egress = old })
+	return pool
+}
+
+// startSourceServer 把每个连接的源 IP 回复给对方
+func startSourceServer(t *testing.T) string {
+	t.Helper()
+	return startSourceServerOn(t, "127.0.0.1")
+}
+
+// startSourceServerOn 在本机地址 ip 上启动 startSourceServer 的服务
+func startSourceServerOn(t *testing.T, ip string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(conn, "%s\n", conn.RemoteAddr().(*net.TCPAddr).IP)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// tunneledSource 经隧道连接 addr，返回目标看到的源 IP
+func tunneledSource(t *testing.T, client *core.Client, addr string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := client.DialTCP(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line[:len(line)-1]
+}
+
+func TestNewEgressPool(t *testing.T) {
+	pool, err := newEgressPool(" 127.0.0.2, 127.0.0.3,127.0.0.2,", egressRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.String() != "127.0.0.2, 127.0.0.3" {
+		t.Fatalf("出口 IP 池 %s", pool)
+	}
+	if pool, err := newEgressPool(" , ", egressHash); pool != nil || err != nil {
+		t.Fatalf("空列表返回 %v, %v", pool, err)
+	}
+
+	for _, tc := range []struct{ ips, strategy string }{
+		{"127.0.0.2", "random"},
+		{"not-an-ip", egressRoundRobin},
+		{"192.0.2.1", egressRoundRobin}, // 不是本机地址：启动即失败
+	} {
+		if _, err := newEgressPool(tc.ips, tc.strategy); err == nil {
+			t.Errorf("newEgressPool(%q, %q) 应返回错误", tc.ips, tc.strategy)
+		}
+	}
+}
+
+func TestEgressRoundRobin(t *testing.T) {
+	withEgress(t, "127.0.0.2,127.0.0.3,127.0.0.4", egressRoundRobin)
+	client := startTestNode(t).connect(t)
+	addr := startSourceServer(t)
+
+	// 同一目标的连续连接依次使用池中的每个出口
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, tunneledSource(t, client, addr))
+	}
+	if got[0] == got[1] || got[1] == got[2] || got[0] == got[2] || got[3] != got[0] {
+		t.Fatalf("轮换出口 %v", got)
+	}
+}
+
+func TestEgressHash(t *testing.T) {
+	pool := withEgress(t, "127.0.0.2,127.0.0.3,127.0.0.4", egressHash)
+	client := startTestNode(t).connect(t)
+	addr := startSourceServer(t)
+
+	// 同一目标主机始终使用同一出口
+	first := tunneledSource(t, client, addr)
+	for i := 0; i < 3; i++ {
+		if src := tunneledSource(t, client, addr); src != first {
+			t.Fatalf("hash 策略下出口从 %s 变为 %s", first, src)
+		}
+	}
+	if want := pool.pick(pool.v4, "127.0.0.1").String(); first != want {
+		t.Fatalf("出口 %s，期望 %s", first, want)
+	}
+
+	// 不同主机分散到不同出口
+	used := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		used[pool.pick(pool.v4, fmt.Sprintf("host-%d.example.com", i)).String()] = true
+	}
+	if len(used) != 3 {
+		t.Fatalf("64 个主机只使用了出口 %v", used)
+	}
+}
+
+func TestEgressUDP(t *testing.T) {
+	pool := withEgress(t, "127.0.0.2,127.0.0.3", egressRoundRobin)
+	var got []string
+	for i := 0; i < 2; i++ {
+		e, err := listenEgressUDP("key", func() string { return "" }, func(*net.UDPConn) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.LocalAddr().(*net.UDPAddr).IP.String())
+		e.Close()
+	}
+	if got[0] == got[1] {
+		t.Fatalf("UDP 关联未轮换出口: %v", got)
+	}
+
+	pool.strategy = egressHash
+	want := pool.pick(pool.v4, "key").String()
+	for i := 0; i < 2; i++ {
+		e, err := listenEgressUDP("key", func() string { return "" }, func(*net.UDPConn) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip := e.LocalAddr().(*net.UDPAddr).IP.String(); ip != want {
+			t.Fatalf("hash 策略下 UDP 出口 %s，期望 %s", ip, want)
+		}
+		e.Close()
+	}
+}
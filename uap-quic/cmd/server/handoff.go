@@ -0,0 +1,395 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 平滑升级（-soft-restart，仅 Linux）：替换二进制后向节点进程发送 SIGUSR2，节点启动新的二进制接管监听，
+// 自己停止接受新连接，通知已有连接换连，排空后退出；升级过程中已建立的隧道不会断开。
+//
+// QUIC 监听 socket 以 SO_REUSEPORT 创建，升级时旧进程在同一端口上再创建一个 socket 交给新进程（ExtraFiles），
+// 两个 socket 组成 reuseport 组，由内核按连接 ID 分流：每个进程的连接 ID 第一个字节是自己的代号，
+// 组上挂载的分流程序（见 handoff_linux.go）把旧进程代号的包交给旧 socket，其余（包括新连接的 Initial 包）交给新 socket。
+// 两个进程不读同一个 socket，不需要在进程间转发数据包，quic-go 的批量收发与 GSO 照常使用。
+// 测速 TCP 监听与健康检查监听直接继承同一个 socket（旧进程关闭自己的副本后不再接受连接）
+var softRestart bool
+
+// handoffEnv 传给新进程的交接信息：代号、旧进程 PID 与继承的文件描述符（新进程读取后清除）
+// 格式: gen=<代号>,ppid=<PID>,udp=<fd>,ready=<fd>[,tcp=<fd>][,health=<fd>]
+const handoffEnv = "UAP_HANDOFF"
+
+// handoffReadyTimeout 等待新进程开始监听的最长时间（超时则终止新进程，旧进程照常服务）
+const handoffReadyTimeout = 30 * time.Second
+
+// cidLen 开启平滑升级时节点连接 ID 的长度：小于客户端首个 Initial 包的目标连接 ID（至少 8 字节），分流程序据此识别新连接
+const cidLen = 6
+
+// cidGeneration 本进程的代号（连接 ID 的第一个字节）：首次启动时随机，之后每次升级加 1
+var cidGeneration byte
+
+// cidGenerator 生成以进程代号开头的连接 ID
+type cidGenerator struct {
+	gen byte
+}
+
+func (g cidGenerator) GenerateConnectionID() (quic.ConnectionID, error) {
+	b := make([]byte, cidLen)
+	if _, err := rand.Read(b[1:]); err != nil {
+		return quic.ConnectionID{}, err
+	}
+	b[0] = g.gen
+	return quic.ConnectionIDFromBytes(b), nil
+}
+
+func (g cidGenerator) ConnectionIDLen() int {
+	return cidLen
+}
+
+// inherited 从旧进程继承的监听（不是经平滑升级启动时为 nil）
+type inherited struct {
+	ppid   int          // 旧进程 PID（旧进程排空期间是本进程的父进程）
+	udp    *net.UDPConn // QUIC 监听 socket（旧进程新建，与旧进程的 socket 同属一个 reuseport 组）
+	tcp    net.Listener // 测速 TCP 监听（可能为空）
+	health net.Listener // 健康检查监听（可能为空）
+	ready  *os.File     // 开始监听后写入一个字节通知旧进程
+}
+
+// handoffFrom 本进程经平滑升级启动时继承的监听
+var handoffFrom *inherited
+
+// nodeListeners 本进程持有的监听，升级时交给新进程，之后旧进程关闭自己的副本
+var nodeListeners struct {
+	mu     sync.Mutex
+	quic   *quic.Listener
+	udp    *net.UDPConn
+	tcp    net.Listener
+	health net.Listener
+}
+
+// upgrading 正在升级（同一时间只处理一个 SIGUSR2）
+var upgrading atomic.Bool
+
+// handedOff 已交接给新进程：旧进程的接受循环据此退出并排空
+var handedOff = make(chan struct{})
+
+// configureSoftRestart 按启动参数开启平滑升级，读取旧进程交接的监听；当前平台不支持时只记录日志
+func configureSoftRestart(enabled bool) error {
+	spec := os.Getenv(handoffEnv)
+	os.Unsetenv(handoffEnv)
+	if !enabled {
+		if spec != "" {
+			return fmt.Errorf("由平滑升级启动，但新的启动参数没有开启 -soft-restart")
+		}
+		return nil
+	}
+	if err := checkSoftRestart(); err != nil {
+		log.Printf("⚠️ 平滑升级不可用: %v", err)
+		return nil
+	}
+	softRestart = true
+	if spec == "" {
+		var b [1]byte
+		rand.Read(b[:])
+		cidGeneration = b[0]
+		log.Printf("✅ 平滑升级: 收到 SIGUSR2 时启动新的二进制接管监听（进程代号 %d）", cidGeneration)
+		return nil
+	}
+
+	from, gen, err := parseHandoff(spec)
+	if err != nil {
+		return fmt.Errorf("读取交接信息失败: %w", err)
+	}
+	handoffFrom, cidGeneration = from, gen
+	log.Printf("✅ 平滑升级: 已继承旧进程 %d 的监听（进程代号 %d）", from.ppid, cidGeneration)
+	return nil
+}
+
+// parseHandoff 解析交接信息并打开继承的文件描述符
+func parseHandoff(spec string) (*inherited, byte, error) {
+	fields := make(map[string]int)
+	for _, kv := range strings.Split(spec, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		n, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			return nil, 0, fmt.Errorf("格式错误: %q", kv)
+		}
+		fields[k] = n
+	}
+	gen, ok := fields["gen"]
+	if !ok || gen < 0 || gen > 255 {
+		return nil, 0, fmt.Errorf("缺少进程代号")
+	}
+	if _, ok := fields["udp"]; !ok {
+		return nil, 0, fmt.Errorf("缺少 QUIC 监听 socket")
+	}
+	if _, ok := fields["ready"]; !ok {
+		return nil, 0, fmt.Errorf("缺少就绪通知管道")
+	}
+
+	from := &inherited{ppid: fields["ppid"], ready: os.NewFile(uintptr(fields["ready"]), "handoff-ready")}
+	pc, err := inheritFile(fields["udp"], "handoff-udp", net.FilePacketConn)
+	if err != nil {
+		return nil, 0, err
+	}
+	udp, ok := pc.(*net.UDPConn)
+	if !ok {
+		return nil, 0, fmt.Errorf("继承的 QUIC 监听不是 UDP socket")
+	}
+	from.udp = udp
+	if fd, ok := fields["tcp"]; ok {
+		if from.tcp, err = inheritFile(fd, "handoff-tcp", net.FileListener); err != nil {
+			return nil, 0, err
+		}
+	}
+	if fd, ok := fields["health"]; ok {
+		if from.health, err = inheritFile(fd, "handoff-health", net.FileListener); err != nil {
+			return nil, 0, err
+		}
+	}
+	return from, byte(gen), nil
+}
+
+// inheritFile 把继承的文件描述符转换为监听（转换时复制一份，原描述符随后关闭）
+func inheritFile[T any](fd int, name string, conv func(*os.File) (T, error)) (T, error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	return conv(f)
+}
+
+// listenNode 创建节点的 QUIC 监听：经平滑升级启动时使用继承的 socket；开启平滑升级时以 SO_REUSEPORT 创建，
+// 连接 ID 以进程代号开头；否则与 listenQUIC 相同
+func listenNode(addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Listener, error) {
+	if !softRestart {
+		listener, conn, err := listenQUIC(addr, tlsConfig, quicConfig)
+		if err == nil {
+			setNodeListener(func() { nodeListeners.quic, nodeListeners.udp = listener, conn })
+		}
+		return listener, err
+	}
+
+	conn := (*net.UDPConn)(nil)
+	if handoffFrom != nil {
+		conn = handoffFrom.udp
+	} else {
+		// 先按普通方式绑定一次：端口已被占用时照常报错（否则 SO_REUSEPORT 会让误启动的第二个节点悄悄分走流量）
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		probe, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		probe.Close()
+		if conn, err = listenReusePort(addr); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := serveQUIC(conn, cidGenerator{gen: cidGeneration}, tlsConfig, quicConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	setNodeListener(func() { nodeListeners.quic, nodeListeners.udp = listener, conn })
+	return listener, nil
+}
+
+// listenNodeTCP 创建与 QUIC 同端口的测速 TCP 监听（经平滑升级启动时使用继承的监听）
+func listenNodeTCP(addr string) (net.Listener, error) {
+	ln := net.Listener(nil)
+	if handoffFrom != nil && handoffFrom.tcp != nil {
+		ln = handoffFrom.tcp
+	} else {
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	setNodeListener(func() { nodeListeners.tcp = ln })
+	return ln, nil
+}
+
+// listenHealth 创建健康检查监听（经平滑升级启动时使用继承的监听）
+func listenHealth(addr string) (net.Listener, error) {
+	ln := net.Listener(nil)
+	if handoffFrom != nil && handoffFrom.health != nil {
+		ln = handoffFrom.health
+	} else {
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	setNodeListener(func() { nodeListeners.health = ln })
+	return ln, nil
+}
+
+// setNodeListener 在锁内记录监听
+func setNodeListener(set func()) {
+	nodeListeners.mu.Lock()
+	defer nodeListeners.mu.Unlock()
+	set()
+}
+
+// handoffReady 新进程开始接受连接后通知旧进程（不是经平滑升级启动时什么都不做）
+func handoffReady() {
+	if handoffFrom == nil || handoffFrom.ready == nil {
+		return
+	}
+	handoffFrom.ready.Write([]byte{1})
+	handoffFrom.ready.Close()
+	handoffFrom.ready = nil
+}
+
+// upgrade 启动新的二进制并交接监听，新进程开始接受连接后返回；失败时终止新进程，本进程照常服务
+func upgrade() error {
+	if handoffFrom != nil && os.Getppid() == handoffFrom.ppid {
+		// 分流程序只区分组内的两个 socket，上一个旧进程退出前不能再加入第三个
+		return fmt.Errorf("上一次升级的旧进程 %d 仍在排空，等它退出后再升级", handoffFrom.ppid)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	nodeListeners.mu.Lock()
+	udp, tcp, health := nodeListeners.udp, nodeListeners.tcp, nodeListeners.health
+	nodeListeners.mu.Unlock()
+	if udp == nil {
+		return fmt.Errorf("QUIC 监听尚未建立")
+	}
+
+	// 先挂载分流程序再加入新 socket：组内只有本进程的 socket 时程序选中的序号无效，内核按哈希交给本进程
+	if err := attachSteering(udp, cidGeneration); err != nil {
+		return fmt.Errorf("挂载分流程序失败: %w", err)
+	}
+	sibling, err := listenReusePort(udp.LocalAddr().String())
+	if err != nil {
+		return fmt.Errorf("创建新进程的监听 socket 失败: %w", err)
+	}
+	defer sibling.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+	defer readyW.Close()
+
+	// ExtraFiles 中的第 i 个文件在新进程中的描述符为 3+i
+	var files []*os.File
+	var spec []string
+	addFile := func(name string, f *os.File) {
+		spec = append(spec, fmt.Sprintf("%s=%d", name, 3+len(files)))
+		files = append(files, f)
+	}
+	defer func() {
+		for _, f := range files {
+			if f != readyW {
+				f.Close()
+			}
+		}
+	}()
+	f, err := sibling.File()
+	if err != nil {
+		return err
+	}
+	addFile("udp", f)
+	addFile("ready", readyW)
+	for _, l := range []struct {
+		name string
+		ln   net.Listener
+	}{{"tcp", tcp}, {"health", health}} {
+		if ln, ok := l.ln.(*net.TCPListener); ok {
+			f, err := ln.File()
+			if err != nil {
+				return err
+			}
+			addFile(l.name, f)
+		}
+	}
+
+	nextGen := cidGeneration + 1
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=gen=%d,ppid=%d,%s", handoffEnv, nextGen, os.Getpid(), strings.Join(spec, ",")))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动新进程失败: %w", err)
+	}
+	readyW.Close() // 新进程退出时读到 EOF
+	go cmd.Wait()  // 新进程先于本进程退出时回收
+
+	readyR.SetReadDeadline(time.Now().Add(handoffReadyTimeout))
+	if _, err := readyR.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("新进程 %d 在 %v 内没有开始监听", cmd.Process.Pid, handoffReadyTimeout)
+		}
+		return fmt.Errorf("新进程 %d 启动失败（见上方日志）", cmd.Process.Pid)
+	}
+	log.Printf("✅ 平滑升级: 新进程 %d（代号 %d）已开始接受连接", cmd.Process.Pid, nextGen)
+	return nil
+}
+
+// handOff 交接完成后停止接受新连接：关闭本进程的 QUIC 监听与 TCP 监听副本（socket 仍由新进程持有）
+func handOff() {
+	nodeListeners.mu.Lock()
+	defer nodeListeners.mu.Unlock()
+	close(handedOff)
+	if nodeListeners.quic != nil {
+		nodeListeners.quic.Close()
+	}
+	if nodeListeners.tcp != nil {
+		nodeListeners.tcp.Close()
+	}
+	if nodeListeners.health != nil {
+		nodeListeners.health.Close()
+	}
+}
+
+// handleUpgradeSignal 处理一次 SIGUSR2
+func handleUpgradeSignal() {
+	if !upgrading.CompareAndSwap(false, true) {
+		log.Printf("⚠️ 平滑升级正在进行，忽略本次信号")
+		return
+	}
+	log.Printf("🔄 收到 SIGUSR2，开始平滑升级")
+	if err := upgrade(); err != nil {
+		log.Printf("❌ 平滑升级失败，继续由本进程服务: %v", err)
+		upgrading.Store(false)
+		return
+	}
+	handOff()
+}
+
+// drainAfterHandOff 交接后排空：通知已有连接换连（新连接由新进程接受），所有连接结束或排空超时后返回
+// active 返回本进程仍在处理的连接数（包括尚未鉴权的）
+func drainAfterHandOff(active func() int64) {
+	log.Printf("🚧 已交接给新进程，停止接受新连接，排空 %d 条连接（排空超时 %v）", active(), connDrainTimeout)
+	// 排空期间才完成鉴权的连接也要通知，每轮检查时重新通知（drainConnection 对同一连接只执行一次）
+	deadline := time.Now().Add(connDrainTimeout + 5*time.Second)
+	for active() > 0 && time.Now().Before(deadline) {
+		drainSessions()
+		time.Sleep(drainPollInterval)
+	}
+	if n := active(); n > 0 {
+		log.Printf("⚠️ 排空超时，仍有 %d 条连接，旧进程退出", n)
+		return
+	}
+	log.Printf("✅ 旧进程已排空，退出")
+}
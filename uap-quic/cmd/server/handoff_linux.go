@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// soReusePort SO_REUSEPORT（syscall 包没有定义）：同一端口上的多个 socket 组成 reuseport 组
+const soReusePort = 15
+
+// soAttachReusePortCBPF SO_ATTACH_REUSEPORT_CBPF（Linux 4.5+）：为 reuseport 组挂载选择 socket 的 cBPF 程序，返回值为组内序号
+const soAttachReusePortCBPF = 51
+
+// checkSoftRestart Linux 支持平滑升级
+func checkSoftRestart() error {
+	return nil
+}
+
+// listenReusePort 以 SO_REUSEPORT 在 addr 上创建 UDP socket
+func listenReusePort(addr string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+		}); err != nil {
+			return err
+		}
+		return serr
+	}}
+	pc, err := lc.ListenPacket(context.Background(), "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return pc.(*net.UDPConn), nil
+}
+
+// attachSteering 为 conn 所在的 reuseport 组挂载分流程序：目标连接 ID 以 gen 开头的包交给组内序号 0（conn，组内最早的 socket），
+// 其余交给序号 1（随后加入的新进程 socket）；序号无效（组内只有一个 socket）时内核按哈希选择
+// UDP 的 reuseport 程序从 UDP 载荷开始读取：长包头的目标连接 ID 长度在第 5 字节、内容从第 6 字节开始，短包头从第 1 字节开始
+func attachSteering(conn *net.UDPConn, gen byte) error {
+	const (
+		ldb  = syscall.BPF_LD | syscall.BPF_B | syscall.BPF_ABS
+		jeq  = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jset = syscall.BPF_JMP | syscall.BPF_JSET | syscall.BPF_K
+		ret  = syscall.BPF_RET | syscall.BPF_K
+	)
+	g := uint32(gen)
+	prog := []syscall.SockFilter{
+		{Code: ldb, K: 0},
+		{Code: jset, Jt: 2, Jf: 0, K: 0x80}, // 长包头
+		{Code: ldb, K: 1},
+		{Code: jeq, Jt: 4, Jf: 5, K: g},
+		{Code: ldb, K: 5},
+		{Code: jeq, Jt: 0, Jf: 3, K: cidLen}, // 长度不同：客户端选择的连接 ID（新连接）
+		{Code: ldb, K: 6},
+		{Code: jeq, Jt: 0, Jf: 1, K: g},
+		{Code: ret, K: 0},
+		{Code: ret, K: 1},
+	}
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, syscall.SOL_SOCKET, soAttachReusePortCBPF,
+			uintptr(unsafe.Pointer(&fprog)), unsafe.Sizeof(fprog), 0)
+		if errno != 0 {
+			serr = os.NewSyscallError("setsockopt", errno)
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// watchUpgradeSignal 收到 SIGUSR2 时平滑升级
+func watchUpgradeSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	go func() {
+		for range ch {
+			handleUpgradeSignal()
+		}
+	}()
+}
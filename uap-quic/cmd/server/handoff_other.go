@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// checkSoftRestart 其他平台没有可按连接 ID 分流的 reuseport 组
+func checkSoftRestart() error {
+	return fmt.Errorf("当前平台 (%s) 不支持", runtime.GOOS)
+}
+
+// listenReusePort 不支持的平台不会调用（softRestart 始终为 false）
+func listenReusePort(addr string) (*net.UDPConn, error) {
+	return nil, fmt.Errorf("当前平台 (%s) 不支持", runtime.GOOS)
+}
+
+// attachSteering 不支持的平台不会调用
+func attachSteering(conn *net.UDPConn, gen byte) error {
+	return fmt.Errorf("当前平台 (%s) 不支持", runtime.GOOS)
+}
+
+// watchUpgradeSignal 不支持的平台不会调用
+func watchUpgradeSignal() {}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// handoffTestEnv 平滑升级测试中，upgrade 重新执行的测试二进制据此进入新进程模式（值为测试证书与密钥所在目录）
+const handoffTestEnv = "UAP_HANDOFF_TEST"
+
+// runHandoffChild 平滑升级测试的新进程：继承旧进程交接的监听后照常接受连接，直到被测试终止
+func runHandoffChild(dir string) {
+	fail := func(err error) {
+		os.Stderr.WriteString("handoff child: " + err.Error() + "\n")
+		os.Exit(2)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		fail(err)
+	}
+	pub, err := os.ReadFile(filepath.Join(dir, "jwt.pub"))
+	if err != nil {
+		fail(err)
+	}
+	jwtKeys = newJWTKeySet("", ed25519.PublicKey(pub))
+	if err := configureSoftRestart(true); err != nil {
+		fail(err)
+	}
+	listener, err := listenNode("", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{serverALPN()}}, testQUICConfig())
+	if err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "child.pid"), []byte(strconv.Itoa(os.Getpid())), 0o600); err != nil {
+		fail(err)
+	}
+	handoffReady()
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			os.Exit(0)
+		}
+		go handleConnection(conn)
+	}
+}
+
+// writeHandoffKeys 把测试节点的证书、私钥与 JWT 公钥写入临时目录，供新进程读取
+func writeHandoffKeys(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	key, err := x509.MarshalPKCS8PrivateKey(testCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"cert.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert.Certificate[0]}),
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}),
+		"jwt.pub":  testJWTKey.Public().(ed25519.PublicKey),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// withSoftRestart 测试期间开启平滑升级，结束时恢复交接状态（须在启动节点之前调用）
+func withSoftRestart(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		softRestart, cidGeneration, handoffFrom = false, 0, nil
+		nodeListeners.quic, nodeListeners.udp, nodeListeners.tcp, nodeListeners.health = nil, nil, nil, nil
+		handedOff = make(chan struct{})
+		upgrading.Store(false)
+	})
+	if err := configureSoftRestart(true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startHandoffNode 以 listenNode 启动旧进程的节点，返回地址与接受的连接数
+func startHandoffNode(t *testing.T) (*testNode, *atomic.Int64) {
+	t.Helper()
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{testCert}, NextProtos: []string{serverALPN()}}
+	listener, err := listenNode("127.0.0.1:0", tlsConfig, testQUICConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := new(atomic.Int64)
+	var handlers sync.WaitGroup
+	handlers.Add(1)
+	go func() {
+		defer handlers.Done()
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				handleConnection(conn)
+			}()
+		}
+	}()
+	udp := nodeListeners.udp
+	t.Cleanup(func() {
+		listener.Close()
+		udp.Close()
+		handlers.Wait()
+	})
+	return &testNode{listener: listener, udpConn: udp, addr: listener.Addr().String()}, accepted
+}
+
+// stopHandoffChild 终止 upgrade 启动的新进程并等待它被回收
+func stopHandoffChild(t *testing.T, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Errorf("读取新进程 PID: %v", err)
+		return
+	}
+	pid, _ := strconv.Atoi(string(data))
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return
+	}
+	p.Kill()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if p.Signal(syscall.Signal(0)) != nil {
+			return
+		}
+	}
+	t.Errorf("新进程 %d 未退出", pid)
+}
+
+// startSlowServer 本机慢速下载服务：每个连接每隔 interval 写一块 chunk 大小的数据，共 n 块
+func startSlowServer(t *testing.T, chunk, n int, interval time.Duration) (string, [32]byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	block := func(i int) []byte { return bytes.Repeat([]byte{byte('a' + i%26)}, chunk) }
+	want := sha256.New()
+	for i := 0; i < n; i++ {
+		want.Write(block(i))
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for i := 0; i < n; i++ {
+					if _, err := conn.Write(block(i)); err != nil {
+						return
+					}
+					time.Sleep(interval)
+				}
+			}()
+		}
+	}()
+	var sum [32]byte
+	copy(sum[:], want.Sum(nil))
+	return ln.Addr().String(), sum
+}
+
+// TestSoftRestartHandoff 升级期间进行中的下载不中断：旧进程交接监听后继续服务已有连接并排空，新连接由新进程接受
+func TestSoftRestartHandoff(t *testing.T) {
+	if err := checkSoftRestart(); err != nil {
+		t.Skip(err)
+	}
+	if testing.Short() {
+		t.Skip("启动新进程")
+	}
+	logs := captureLogs(t)
+	dir := writeHandoffKeys(t)
+	t.Setenv(handoffTestEnv, dir)
+	withSoftRestart(t)
+	withLifetime(t, 0, 10*time.Second) // 排空时等待进行中的下载
+	node, accepted := startHandoffNode(t)
+	slow, want := startSlowServer(t, 4096, 40, 50*time.Millisecond)
+
+	// 升级前开始一次约 2s 的下载
+	a := node.connect(t)
+	conn, err := a.DialTCP(context.Background(), slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+	if _, err := io.ReadFull(conn, make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		n   int64
+		sum [32]byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		h := sha256.New()
+		h.Write(bytes.Repeat([]byte{'a'}, 4096))
+		n, err := io.Copy(h, conn)
+		var sum [32]byte
+		copy(sum[:], h.Sum(nil))
+		done <- result{n + 4096, sum, err}
+	}()
+
+	if err := upgrade(); err != nil {
+		t.Fatalf("升级失败: %v", err)
+	}
+	t.Cleanup(func() { stopHandoffChild(t, dir) })
+	handOff()
+	drainSessions()
+
+	// 新连接由新进程接受
+	b := node.connect(t)
+	if _, err := tcpEcho(b); err != nil {
+		t.Fatalf("升级后新连接的 TCP 回显: %v", err)
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("交接后旧进程仍在接受新连接（共 %d 条）", n)
+	}
+
+	r := <-done
+	if r.err != nil || r.n != 40*4096 || r.sum != want {
+		t.Fatalf("跨升级的下载 %d 字节（期望 %d）, %v, 内容一致 %v", r.n, 40*4096, r.err, r.sum == want)
+	}
+	// 旧连接排空后客户端换连到新进程
+	if _, err := tcpEcho(a); err != nil {
+		t.Fatalf("换连后的 TCP 回显: %v", err)
+	}
+	if accepted.Load() != 1 {
+		t.Fatal("换连落到了旧进程")
+	}
+	if !strings.Contains(logs.String(), "已开始接受连接") {
+		t.Fatalf("没有升级日志:\n%s", logs)
+	}
+}
+
+func TestParseHandoff(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"gen=1,udp=3",           // 缺少就绪通知管道
+		"gen=1,ready=4",         // 缺少 QUIC 监听
+		"udp=3,ready=4",         // 缺少进程代号
+		"gen=256,udp=3,ready=4", // 代号超出一个字节
+		"gen=1,udp=x,ready=4",
+		"gen=1;udp=3",
+	} {
+		if _, _, err := parseHandoff(spec); err == nil {
+			t.Errorf("交接信息 %q 未报错", spec)
+		}
+	}
+
+	// 由平滑升级启动但新的启动参数没有开启 -soft-restart
+	t.Setenv(handoffEnv, "gen=1,ppid=1,udp=3,ready=4")
+	if err := configureSoftRestart(false); err == nil {
+		t.Fatal("未开启 -soft-restart 时接受了交接")
+	}
+	if os.Getenv(handoffEnv) != "" {
+		t.Fatal("交接信息未清除")
+	}
+}
+
+// TestCIDGenerator 连接 ID 以进程代号开头，长度小于客户端首个 Initial 包的目标连接 ID
+func TestCIDGenerator(t *testing.T) {
+	g := cidGenerator{gen: 0x5a}
+	if g.ConnectionIDLen() != cidLen || cidLen >= 8 {
+		t.Fatalf("连接 ID 长度 %d", g.ConnectionIDLen())
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := g.GenerateConnectionID()
+		if err != nil || id.Len() != cidLen || id.Bytes()[0] != 0x5a {
+			t.Fatalf("连接 ID %x: %v", id.Bytes(), err)
+		}
+		seen[string(id.Bytes())] = true
+	}
+	if len(seen) < 99 {
+		t.Fatalf("100 个连接 ID 中只有 %d 个不同", len(seen))
+	}
+}
+
+// startProbe 以无效凭证开流，等节点进入伪装延迟（2-5 秒）后返回流
+func startProbe(t *testing.T, node *testNode) quic.Stream {
+	t.Helper()
+	stream, err := node.dialRaw(t).OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	probes := probeCount.Load()
+	stream.Write([]byte("not-a-token\n"))
+	for deadline := time.Now().Add(5 * time.Second); probeCount.Load() == probes; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("节点未进入伪装模式")
+		}
+	}
+	time.Sleep(100 * time.Millisecond) // 计数后才开始延迟
+	return stream
+}
+
+// expectProbeEnded 伪装延迟被打断：节点不回复伪装内容，随即关闭流
+func expectProbeEnded(t *testing.T, stream quic.Stream) {
+	t.Helper()
+	start := time.Now()
+	reply, err := io.ReadAll(stream)
+	if err != nil || len(reply) != 0 {
+		t.Fatalf("探测流收到 %q, %v，期望直接结束", reply, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("伪装延迟 %v 后才结束", elapsed)
+	}
+}
+
+// TestDecoyDelayHandOff 交接给新进程时，伪装延迟中的探测流立即结束，不拖延排空
+func TestDecoyDelayHandOff(t *testing.T) {
+	t.Cleanup(func() { handedOff = make(chan struct{}) }) // 在节点关闭之后恢复
+	stream := startProbe(t, startTestNode(t))
+	handOff()
+	expectProbeEnded(t, stream)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// healthResponse 健康检查响应
+type healthResponse struct {
+	Status        string `json:"status"`         // "ok"，维护模式下为 "draining"（HTTP 503）
+	Sessions      int    `json:"sessions"`       // 已鉴权的活跃连接数
+	UptimeSeconds int64  `json:"uptime_seconds"` // 已运行秒数
+	CertNotAfter  int64  `json:"cert_not_after"` // 证书过期时间（Unix 秒）
+	Trusted       bool   `json:"trusted"`        // 是否为信任模式
+
+	UpstreamPool *poolStats  `json:"upstream_pool,omitempty"` // 上游连接复用统计（未启用时省略）
+	UDPLeases    *leaseStats `json:"udp_leases,omitempty"`    // UDP 出口端口租约统计（未启用时省略）
+
+	AuthFailures *authFailStats `json:"auth_failures,omitempty"` // 按来源 IP 的鉴权失败统计与封禁
+}
+
+// serveHealth 在 ln 上提供 HTTP 健康检查 GET /health（供负载均衡 / 监控探测，只应监听内网或本机地址）
+// 以及按用户开关详细日志的调试接口 /debug/verbose、维护模式开关 /maintenance（配置了 adminSecret 时需要 X-Admin-Secret）
+func serveHealth(ln net.Listener, adminSecret string, startedAt, certNotAfter time.Time) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		status := "ok"
+		w.Header().Set("Content-Type", "application/json")
+		if maintenance.enabled.Load() {
+			// 负载均衡据此停止把新连接调度到本节点
+			status = "draining"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(healthResponse{
+			Status:        status,
+			Sessions:      sessionCount(),
+			UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+			CertNotAfter:  certNotAfter.Unix(),
+			Trusted:       trustedMode,
+			UpstreamPool:  upstreamPool.stats(),
+			UDPLeases:     udpLeases.stats(),
+			AuthFailures:  authFailures.stats(time.Now()),
+		})
+	})
+	mux.HandleFunc("/debug/verbose", handleVerbose(adminSecret))
+	mux.HandleFunc("/maintenance", handleMaintenance(adminSecret))
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	log.Printf("✅ 健康检查: http://%s/health", ln.Addr())
+	// 平滑升级交接后旧进程关闭监听，返回 net.ErrClosed
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("⚠️ 健康检查监听失败: %v", err)
+	}
+}
+
+// handleVerbose 用户详细日志开关
+//
+//	GET    /debug/verbose                     列出开启了详细日志的用户
+//	POST   /debug/verbose?uuid=xxx&ttl=10m    开启（ttl 默认 30m，到期自动关闭）
+//	DELETE /debug/verbose?uuid=xxx            关闭
+func handleVerbose(adminSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminSecret(w, r, adminSecret) {
+			return
+		}
+
+		uuid := r.URL.Query().Get("uuid")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if uuid == "" {
+				http.Error(w, "missing uuid", http.StatusBadRequest)
+				return
+			}
+			ttl := defaultVerboseTTL
+			if v := r.URL.Query().Get("ttl"); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					http.Error(w, "invalid ttl", http.StatusBadRequest)
+					return
+				}
+				ttl = d
+			}
+			expiresAt := verboseUsers.enable(uuid, ttl)
+			log.Printf("🔍 已开启用户 [%s] 的详细日志，%s 自动关闭", uuid, expiresAt.Format("2006-01-02 15:04:05"))
+		case http.MethodDelete:
+			if uuid == "" {
+				http.Error(w, "missing uuid", http.StatusBadRequest)
+				return
+			}
+			if verboseUsers.disable(uuid) {
+				log.Printf("🔍 已关闭用户 [%s] 的详细日志", uuid)
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(verboseUsers.list())
+	}
+}
+
+// checkAdminSecret 校验 X-Admin-Secret（未配置 adminSecret 时放行），失败时返回 403
+func checkAdminSecret(w http.ResponseWriter, r *http.Request, adminSecret string) bool {
+	if adminSecret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Secret")), []byte(adminSecret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/router"
+)
+
+// socksConnect 通过本机 SOCKS5 端口以域名 (ATYP=0x03) 发起 CONNECT，返回建立后的连接
+func socksConnect(t *testing.T, port int, domain string, targetPort int) net.Conn {
+	t.Helper()
+	var conn net.Conn
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	conn.Write([]byte{0x05, 0x01, 0x00})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || method[1] != 0x00 {
+		t.Fatalf("SOCKS5 协商失败: %v %x", err, method)
+	}
+	req := append([]byte{0x05, 0x01, 0x00, 0x03, byte(len(domain))}, domain...)
+	conn.Write(binary.BigEndian.AppendUint16(req, uint16(targetPort)))
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0x00 {
+		t.Fatalf("CONNECT %s 失败: %v %x", domain, err, reply)
+	}
+	return conn
+}
+
+func TestHostsOverride(t *testing.T) {
+	node := startTestNode(t)
+	_, echoPort, _ := net.SplitHostPort(startEchoServer(t))
+	port, _ := strconv.Atoi(echoPort)
+	hosts, err := router.ParseHosts("127.0.0.1 staging.uap.test\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不存在的域名只有经覆盖才能连上：隧道内由节点拨号、直连由客户端拨号，都使用覆盖 IP
+	for _, mode := range []string{core.ModeGlobal, core.ModeSmart} {
+		t.Run(mode, func(t *testing.T) {
+			socksPort := freePort(t)
+			client := node.newClientOnPort(t, socksPort)
+			if err := client.SetMode(mode); err != nil {
+				t.Fatal(err)
+			}
+			client.SetHosts(hosts)
+			go client.Start("")
+
+			conn := socksConnect(t, socksPort, "staging.uap.test", port)
+			msg := []byte("hosts override")
+			conn.Write(msg)
+			buf := make([]byte, len(msg))
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != string(msg) {
+				t.Fatalf("回显 %q: %v", buf, err)
+			}
+
+			stats := client.GetStats(0)
+			if mode == core.ModeGlobal && stats.Proxy != 1 || mode == core.ModeSmart && stats.Direct != 1 {
+				t.Fatalf("%s 模式的分流统计 proxy=%d direct=%d", mode, stats.Proxy, stats.Direct)
+			}
+		})
+	}
+}
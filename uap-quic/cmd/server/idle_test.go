@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// blackholeRelay 客户端与节点之间的 UDP 中继，开启 blackhole 后两个方向的包都被丢弃（模拟路径中断）
+type blackholeRelay struct {
+	addr      string
+	blackhole atomic.Bool
+}
+
+// startBlackholeRelay 启动转发到 upstream 的中继（只服务一个客户端），测试结束时关闭
+func startBlackholeRelay(t *testing.T, upstream string) *blackholeRelay {
+	t.Helper()
+	upAddr, err := net.ResolveUDPAddr("udp", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := net.DialUDP("udp", nil, upAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		front.Close()
+		back.Close()
+	})
+
+	r := &blackholeRelay{addr: front.LocalAddr().String()}
+	var client atomic.Pointer[net.UDPAddr]
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := front.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			client.Store(from)
+			if !r.blackhole.Load() {
+				back.Write(buf[:n])
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := back.Read(buf)
+			if err != nil {
+				return
+			}
+			if to := client.Load(); to != nil && !r.blackhole.Load() {
+				front.WriteToUDP(buf[:n], to)
+			}
+		}
+	}()
+	return r
+}
+
+// TestIdleTimeoutBlackhole 路径中断后客户端在空闲超时加一个保活间隔内判定连接断开
+func TestIdleTimeoutBlackhole(t *testing.T) {
+	if testing.Short() {
+		t.Skip("等待空闲超时耗时")
+	}
+	node := startTestNode(t)
+	relay := startBlackholeRelay(t, node.addr)
+
+	client := core.NewClient(relay.addr, testJWTToken, 0, core.ModeGlobal)
+	client.SetPSK(preSharedKey)
+	client.SetTrusted(trustedMode)
+	t.Cleanup(client.Stop)
+	idle := core.MinIdleTimeout
+	client.SetIdleTimeout(idle)
+	disconnected := make(chan struct{}, 1)
+	client.SetEventHandler(func(e core.Event) {
+		if e.Kind == core.EventDisconnected {
+			select {
+			case disconnected <- struct{}{}:
+			default:
+			}
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保活包让空闲的连接保持存活
+	time.Sleep(core.KeepAlivePeriod(idle) + time.Second)
+	select {
+	case <-disconnected:
+		t.Fatal("空闲但路径正常的连接被判定断开")
+	default:
+	}
+
+	relay.blackhole.Store(true)
+	start := time.Now()
+	bound := idle + core.KeepAlivePeriod(idle)
+	select {
+	case <-disconnected:
+	case <-time.After(bound + 2*time.Second):
+		t.Fatalf("路径中断 %v 后仍未判定断开（空闲超时 %v）", time.Since(start), idle)
+	}
+	// 最后一次收到节点的包不早于中断前一个保活间隔
+	if elapsed := time.Since(start); elapsed < idle-core.KeepAlivePeriod(idle) || elapsed > bound+time.Second {
+		t.Fatalf("路径中断 %v 后判定断开，期望 %v 左右（空闲超时 %v）", elapsed, bound, idle)
+	}
+}
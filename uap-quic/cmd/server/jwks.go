@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKS 拉取参数
+const (
+	jwksMinRefreshInterval = 10 * time.Second // 遇到未知 kid 时重新拉取的最小间隔（伪造 kid 的请求不会反复触发拉取）
+	jwksFetchTimeout       = 5 * time.Second
+	jwksMaxBodySize        = 64 * 1024
+)
+
+// jwtKeys JWT / 连接票据的验签公钥集合
+var jwtKeys *jwtKeySet
+
+// jwk JWKS 中的单个公钥（与 uap-admin 的 auth.JWK 一致）
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+}
+
+// jwtKeySet 验签公钥集合
+// 配置了 JWKS 地址时以 uap-admin 发布的 JWKS 为准：定期刷新（带 If-None-Match），遇到未知 kid 立即刷新一次；
+// 本地公钥文件只在 JWKS 首次拉取成功之前使用，密钥轮换完成后旧公钥从 JWKS 移除即失效
+type jwtKeySet struct {
+	url    string // 为空表示只使用本地公钥
+	client *http.Client
+
+	mu       sync.RWMutex
+	keys     map[string]ed25519.PublicKey // kid -> 公钥（JWKS）
+	loaded   bool                         // JWKS 已成功拉取过
+	fallback map[string]ed25519.PublicKey // 本地公钥文件（kid 按 JWK 指纹计算）
+	etag     string
+
+	fetchMu      sync.Mutex
+	lastOnDemand time.Time // 上次因未知 kid 触发的拉取（定期刷新不占用该限额）
+}
+
+// newJWTKeySet 创建验签公钥集合，fallback 为本地公钥（可为 nil）
+func newJWTKeySet(url string, fallback ed25519.PublicKey) *jwtKeySet {
+	s := &jwtKeySet{
+		url:      url,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+		fallback: make(map[string]ed25519.PublicKey),
+	}
+	if fallback != nil {
+		s.fallback[jwkThumbprint(fallback)] = fallback
+	}
+	return s
+}
+
+// jwkThumbprint 公钥的 JWK 指纹（RFC 7638），与 uap-admin 的 auth.KeyID 一致
+func jwkThumbprint(pub ed25519.PublicKey) string {
+	canonical := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(pub))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// active 当前生效的公钥（JWKS 拉取成功后只用 JWKS）
+// 调用方需持有 mu 读锁
+func (s *jwtKeySet) active() map[string]ed25519.PublicKey {
+	if s.loaded {
+		return s.keys
+	}
+	return s.fallback
+}
+
+// lookup 按 kid 查找公钥
+func (s *jwtKeySet) lookup(kid string) (ed25519.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pub, ok := s.active()[kid]
+	return pub, ok
+}
+
+// all 当前生效的全部公钥
+func (s *jwtKeySet) all() []ed25519.PublicKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []ed25519.PublicKey
+	for _, pub := range s.active() {
+		keys = append(keys, pub)
+	}
+	return keys
+}
+
+// keyfunc jwt.Parse 的验签密钥回调：按 Token 头部的 kid 选择公钥，未知 kid 时刷新一次 JWKS 再查
+// 未携带 kid 的 Token（旧版 uap-admin 签发）依次尝试所有公钥
+func (s *jwtKeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	// 验证签名算法必须是 EdDSA (Ed25519)
+	if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		keys := s.all()
+		if len(keys) == 0 {
+			return nil, errors.New("没有可用的验签公钥")
+		}
+		set := jwt.VerificationKeySet{}
+		for _, pub := range keys {
+			set.Keys = append(set.Keys, pub)
+		}
+		return set, nil
+	}
+
+	if pub, ok := s.lookup(kid); ok {
+		return pub, nil
+	}
+	// 可能是 uap-admin 刚轮换了签名密钥
+	if s.url != "" {
+		// 被限流跳过时也重新查一次：并发等待的请求可能刚由其他请求拉取到新密钥
+		s.refreshOnDemand()
+		if pub, ok := s.lookup(kid); ok {
+			return pub, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown kid: %s", kid)
+}
+
+// refresh 立即拉取 JWKS，返回是否成功（并发调用串行执行）
+func (s *jwtKeySet) refresh() bool {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	return s.fetchLogged()
+}
+
+// refreshOnDemand 遇到未知 kid 时拉取 JWKS，距上次按需拉取不足 jwksMinRefreshInterval 时跳过
+// 并发调用只有一个真正发起请求，其余等待它完成后跳过
+func (s *jwtKeySet) refreshOnDemand() {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	if !s.lastOnDemand.IsZero() && time.Since(s.lastOnDemand) < jwksMinRefreshInterval {
+		return
+	}
+	s.lastOnDemand = time.Now()
+	s.fetchLogged()
+}
+
+// fetchLogged 拉取 JWKS，失败时记录日志（调用方需持有 fetchMu）
+func (s *jwtKeySet) fetchLogged() bool {
+	if err := s.fetch(); err != nil {
+		log.Printf("⚠️ 拉取 JWKS 失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// fetch 拉取 JWKS（内容未变化时服务端返回 304）
+func (s *jwtKeySet) fetch() error {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	if s.loaded && s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.RUnlock()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxBodySize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("uap-admin 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	keys, err := parseJWKS(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	changed := !s.loaded || !sameKids(s.keys, keys)
+	s.keys, s.loaded, s.etag = keys, true, resp.Header.Get("ETag")
+	s.mu.Unlock()
+	if changed {
+		log.Printf("✅ 已更新 JWKS 验签公钥: %s", strings.Join(sortedKids(keys), ", "))
+	}
+	return nil
+}
+
+// refreshLoop 定期刷新 JWKS；尚未拉取成功时按最小间隔重试
+func (s *jwtKeySet) refreshLoop(interval time.Duration) {
+	for {
+		s.mu.RLock()
+		wait := interval
+		if !s.loaded {
+			wait = jwksMinRefreshInterval
+		}
+		s.mu.RUnlock()
+
+		time.Sleep(wait)
+		s.refresh()
+	}
+}
+
+// parseJWKS 解析 JWKS 文档中的 Ed25519 公钥（忽略其他类型的密钥），至少需要一个有效公钥
+func parseJWKS(data []byte) (map[string]ed25519.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析 JWKS 失败: %w", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Kty != "OKP" || k.Crv != "Ed25519" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+		pub := ed25519.PublicKey(x)
+		kid := k.Kid
+		if kid == "" {
+			kid = jwkThumbprint(pub)
+		}
+		keys[kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS 中没有有效的 Ed25519 公钥")
+	}
+	return keys, nil
+}
+
+// sameKids 两个公钥集合的 kid 是否相同
+func sameKids(a, b map[string]ed25519.PublicKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for kid := range a {
+		if _, ok := b[kid]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKids 排序后的 kid 列表（日志使用，只显示前 8 个字符）
+func sortedKids(keys map[string]ed25519.PublicKey) []string {
+	kids := make([]string, 0, len(keys))
+	for kid := range keys {
+		if len(kid) > 8 {
+			kid = kid[:8] + "..."
+		}
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksServer 模拟 uap-admin 的 /system/jwks：支持 ETag，记录请求次数
+type jwksServer struct {
+	*httptest.Server
+	requests    atomic.Int32
+	notModified atomic.Int32
+
+	mu   sync.Mutex
+	keys []ed25519.PublicKey
+}
+
+func startJWKSServer(t *testing.T, keys ...ed25519.PublicKey) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		doc := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for _, pub := range s.keys {
+			doc.Keys = append(doc.Keys, jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub), Kid: jwkThumbprint(pub)})
+		}
+		s.mu.Unlock()
+		data, _ := json.Marshal(doc)
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// setKeys 轮换发布的公钥
+func (s *jwksServer) setKeys(keys ...ed25519.PublicKey) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+// newSigningKey 随机生成签名密钥
+func newSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+// signWithKid 用 priv 签发 Token，kid 为空时不带 kid
+func signWithKid(t *testing.T, priv ed25519.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"uuid": "user-1"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// verifyWith 用 keys 校验 Token
+func verifyWith(keys *jwtKeySet, token string) error {
+	_, err := jwt.Parse(token, keys.keyfunc)
+	return err
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldPub, oldPriv := newSigningKey(t)
+	newPub, newPriv := newSigningKey(t)
+	srv := startJWKSServer(t, oldPub)
+	keys := newJWTKeySet(srv.URL, nil)
+	if !keys.refresh() {
+		t.Fatal("首次拉取 JWKS 失败")
+	}
+
+	oldToken := signWithKid(t, oldPriv, jwkThumbprint(oldPub))
+	if err := verifyWith(keys, oldToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// uap-admin 轮换密钥：新 kid 的 Token 到达时立即刷新，旧 Token 在轮换期间仍然有效
+	srv.setKeys(newPub, oldPub)
+	before := srv.requests.Load()
+	if err := verifyWith(keys, signWithKid(t, newPriv, jwkThumbprint(newPub))); err != nil {
+		t.Fatalf("新密钥的 Token 未触发刷新: %v", err)
+	}
+	if srv.requests.Load() != before+1 {
+		t.Fatalf("未知 kid 触发了 %d 次拉取", srv.requests.Load()-before)
+	}
+	if err := verifyWith(keys, oldToken); err != nil {
+		t.Fatalf("轮换期间旧 Token 失效: %v", err)
+	}
+	// 未携带 kid 的 Token 依次尝试所有公钥
+	if err := verifyWith(keys, signWithKid(t, oldPriv, "")); err != nil {
+		t.Fatalf("无 kid 的 Token: %v", err)
+	}
+
+	// 旧公钥从 JWKS 移除后，定期刷新使旧 Token 失效
+	srv.setKeys(newPub)
+	if !keys.refresh() {
+		t.Fatal("刷新 JWKS 失败")
+	}
+	if err := verifyWith(keys, oldToken); err == nil {
+		t.Fatal("旧公钥移除后旧 Token 仍然有效")
+	}
+}
+
+func TestJWKSNotModified(t *testing.T) {
+	pub, priv := newSigningKey(t)
+	srv := startJWKSServer(t, pub)
+	keys := newJWTKeySet(srv.URL, nil)
+	for i := 0; i < 3; i++ {
+		if !keys.refresh() {
+			t.Fatal("拉取 JWKS 失败")
+		}
+	}
+	// 内容未变化时带 If-None-Match 刷新，304 保留已有公钥
+	if srv.notModified.Load() != 2 {
+		t.Fatalf("304 响应 %d 次，期望 2", srv.notModified.Load())
+	}
+	if err := verifyWith(keys, signWithKid(t, priv, jwkThumbprint(pub))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSUnknownKidRateLimited(t *testing.T) {
+	pub, _ := newSigningKey(t)
+	_, stranger := newSigningKey(t)
+	srv := startJWKSServer(t, pub)
+	keys := newJWTKeySet(srv.URL, nil)
+	keys.refresh()
+
+	// 伪造 kid 的请求不会反复触发拉取
+	before := srv.requests.Load()
+	for i := 0; i < 5; i++ {
+		if err := verifyWith(keys, signWithKid(t, stranger, "forged")); err == nil {
+			t.Fatal("伪造 kid 的 Token 通过了校验")
+		}
+	}
+	if n := srv.requests.Load() - before; n != 1 {
+		t.Fatalf("未知 kid 触发了 %d 次拉取，期望 1", n)
+	}
+}
+
+func TestJWKSFallbackKey(t *testing.T) {
+	localPub, localPriv := newSigningKey(t)
+	adminPub, adminPriv := newSigningKey(t)
+	localToken := signWithKid(t, localPriv, jwkThumbprint(localPub))
+
+	// JWKS 不可用时使用本地公钥
+	srv := startJWKSServer(t, adminPub)
+	srv.Close()
+	keys := newJWTKeySet(srv.URL, localPub)
+	if keys.refresh() {
+		t.Fatal("已关闭的 JWKS 地址拉取成功")
+	}
+	if err := verifyWith(keys, localToken); err != nil {
+		t.Fatalf("首次拉取成功前本地公钥无效: %v", err)
+	}
+
+	// JWKS 拉取成功后以 JWKS 为准，本地公钥不再有效
+	srv = startJWKSServer(t, adminPub)
+	keys.url = srv.URL
+	if !keys.refresh() {
+		t.Fatal("拉取 JWKS 失败")
+	}
+	if err := verifyWith(keys, signWithKid(t, adminPriv, jwkThumbprint(adminPub))); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyWith(keys, localToken); err == nil {
+		t.Fatal("JWKS 生效后本地公钥仍然有效")
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	pub, _ := newSigningKey(t)
+	x := base64.RawURLEncoding.EncodeToString(pub)
+	cases := map[string]bool{
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"` + x + `","kid":"k1"}]}`:                                   true,
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"` + x + `"}]}`:                                              true, // 缺少 kid 时按指纹计算
+		`{"keys":[{"kty":"RSA","n":"abc","e":"AQAB"},{"kty":"OKP","crv":"Ed25519","x":"` + x + `","kid":"k"}]}`: true, // 忽略其他类型的密钥
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"c2hvcnQ"}]}`:                                                false,
+		`{"keys":[]}`: false,
+		`not json`:    false,
+	}
+	for doc, ok := range cases {
+		keys, err := parseJWKS([]byte(doc))
+		if (err == nil) != ok {
+			t.Errorf("parseJWKS(%s) = %v", doc, err)
+		}
+		if ok && len(keys) != 1 {
+			t.Errorf("parseJWKS(%s) 解析出 %d 个公钥", doc, len(keys))
+		}
+	}
+	if keys, _ := parseJWKS([]byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"` + x + `"}]}`)); keys[jwkThumbprint(pub)] == nil {
+		t.Error("缺少 kid 的公钥未按指纹索引")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// errCodeReconnect 连接达到最长时长后关闭使用的关闭码（HTTP/3 的 H3_NO_ERROR，与 h3 伪装保持一致）
+// 客户端收到后立即重连（可能连到 DNS 轮换后的其他节点），不等断线检测
+const errCodeReconnect = 0x100
+
+// goAwayMsg 换连通知：节点在单向流上发送该字节，客户端收到后建立新连接，新流改走新连接
+const goAwayMsg = 0x01
+
+// lifetimeJitter 最长时长的随机浮动比例，避免节点重启后同时建立的连接在同一时刻一起换连
+const lifetimeJitter = 0.1
+
+// drainPollInterval 排空期间检查进行中的流的间隔
+const drainPollInterval = 500 * time.Millisecond
+
+var (
+	maxConnLifetime  time.Duration // 连接最长时长（0 表示不限制）
+	connDrainTimeout time.Duration // 换连通知后等待进行中的流结束的最长时间（最长时长与维护模式排空共用）
+)
+
+// enforceLifetime 连接达到最长时长后通知客户端换连，等进行中的流结束（或排空超时）后以 errCodeReconnect 关闭
+// 旧版客户端不认识换连通知，排空期间照常在旧连接上开流，关闭后由断线重连接管
+func enforceLifetime(conn quic.Connection, state *connState) {
+	lifetime := time.Duration(float64(maxConnLifetime) * (1 - lifetimeJitter + 2*lifetimeJitter*rand.Float64()))
+	timer := time.NewTimer(lifetime)
+	defer timer.Stop()
+	select {
+	case <-conn.Context().Done():
+		return
+	case <-timer.C:
+	}
+
+	log.Printf("[连接] %s 已连接 %v，达到最长时长，通知客户端换连", conn.RemoteAddr(), time.Since(state.connectedAt).Round(time.Second))
+	drainConnection(conn, state)
+}
+
+// drainConnection 通知客户端换连，等进行中的流结束（或排空超时）后以 errCodeReconnect 关闭
+// 同一条连接只排空一次（达到最长时长与维护模式排空可能同时触发）
+// 没有进行中的流时也至少等一个检查间隔：客户端收到通知、建立新连接之前仍会在旧连接上开流，立即关闭会让这些流失败
+func drainConnection(conn quic.Connection, state *connState) {
+	if !state.draining.CompareAndSwap(false, true) {
+		return
+	}
+	if stream, err := conn.OpenUniStream(); err == nil {
+		stream.Write([]byte{goAwayMsg})
+		stream.Close()
+	}
+
+	deadline := time.Now().Add(connDrainTimeout)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		if state.streams.Load() == 0 || !time.Now().Before(deadline) {
+			break
+		}
+	}
+	if n := state.streams.Load(); n > 0 {
+		log.Printf("[连接] %s 排空超时，仍有 %d 条流进行中，强制关闭", conn.RemoteAddr(), n)
+	} else {
+		log.Printf("[连接] %s 已排空，关闭连接", conn.RemoteAddr())
+	}
+	conn.CloseWithError(errCodeReconnect, "")
+}
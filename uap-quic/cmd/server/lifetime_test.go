@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+
+	"github.com/quic-go/quic-go"
+)
+
+// withLifetime 测试期间设置连接最长时长与排空超时（需在启动测试节点之前调用）
+func withLifetime(t *testing.T, lifetime, drain time.Duration) {
+	oldLifetime, oldDrain := maxConnLifetime, connDrainTimeout
+	maxConnLifetime, connDrainTimeout = lifetime, drain
+	t.Cleanup(func() { maxConnLifetime, connDrainTimeout = oldLifetime, oldDrain })
+}
+
+// expectGoAway 等待节点在 conn 上发出换连通知
+func expectGoAway(t *testing.T, conn quic.Connection, within time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), within)
+	defer cancel()
+	stream, err := conn.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("未收到换连通知: %v", err)
+	}
+	msg := make([]byte, 1)
+	if _, err := io.ReadFull(stream, msg); err != nil || msg[0] != goAwayMsg {
+		t.Fatalf("换连通知 %x: %v", msg, err)
+	}
+}
+
+// expectReconnectClose 等待节点以 errCodeReconnect 关闭 conn，返回等待的时长
+func expectReconnectClose(t *testing.T, conn quic.Connection, within time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(within):
+		t.Fatalf("%v 内连接未关闭", within)
+	}
+	var appErr *quic.ApplicationError
+	if err := context.Cause(conn.Context()); !errors.As(err, &appErr) || !appErr.Remote || appErr.ErrorCode != errCodeReconnect {
+		t.Fatalf("连接关闭原因 %v，期望节点以 0x%x 关闭", err, errCodeReconnect)
+	}
+	return time.Since(start)
+}
+
+// openEchoStream 在 conn 上开一条经节点转发到回显服务的流（进行中的流）
+func openEchoStream(t *testing.T, conn quic.Connection) quic.Stream {
+	t.Helper()
+	stream := openAuthedStream(t, conn)
+	req, _ := target.AppendV0(nil, startEchoServer(t))
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != target.StatusOK {
+		t.Fatalf("转发请求回复 %v: %v", status, err)
+	}
+	return stream
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	withLifetime(t, 200*time.Millisecond, 5*time.Second)
+	conn := startTestNode(t).dialRaw(t)
+	start := time.Now()
+
+	// 没有进行中的流：通知换连后等一个检查间隔（留给客户端换连）即以换连关闭码关闭
+	expectGoAway(t, conn, 3*time.Second)
+	expectReconnectClose(t, conn, 3*time.Second)
+	// 最长时长在 ±10% 内随机
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond+drainPollInterval || elapsed > 3*time.Second {
+		t.Fatalf("连接在 %v 后关闭，期望约 %v", elapsed, 200*time.Millisecond+drainPollInterval)
+	}
+}
+
+func TestMaxConnLifetimeDrainsStreams(t *testing.T) {
+	withLifetime(t, 200*time.Millisecond, 10*time.Second)
+	conn := startTestNode(t).dialRaw(t)
+	stream := openEchoStream(t, conn)
+
+	expectGoAway(t, conn, 3*time.Second)
+	// 进行中的流在排空期间照常转发，连接保持打开
+	time.Sleep(2 * drainPollInterval)
+	echoOnce(t, stream, "draining")
+	if conn.Context().Err() != nil {
+		t.Fatal("排空期间关闭了有进行中的流的连接")
+	}
+
+	// 流结束后在一个检查间隔内关闭
+	stream.Close()
+	stream.CancelRead(0)
+	if waited := expectReconnectClose(t, conn, 5*time.Second); waited > 3*drainPollInterval {
+		t.Fatalf("流结束 %v 后才关闭连接", waited)
+	}
+}
+
+func TestMaxConnLifetimeDrainTimeout(t *testing.T) {
+	withLifetime(t, 200*time.Millisecond, time.Second)
+	conn := startTestNode(t).dialRaw(t)
+	stream := openEchoStream(t, conn)
+	defer stream.Close()
+
+	// 流一直不结束：排空超时后强制关闭
+	expectGoAway(t, conn, 3*time.Second)
+	if waited := expectReconnectClose(t, conn, 5*time.Second); waited < 500*time.Millisecond {
+		t.Fatalf("排空超时之前（%v）关闭了连接", waited)
+	}
+}
+
+func TestMaxConnLifetimeClientHandover(t *testing.T) {
+	withLifetime(t, 300*time.Millisecond, 5*time.Second)
+	client := startTestNode(t).connect(t)
+
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatal(err)
+	}
+	before := sessionIDs()
+	// 客户端收到换连通知后建立新连接，旧连接排空后关闭；换连期间与之后转发照常
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := tcpEcho(client); err != nil {
+			t.Fatalf("换连期间回显失败: %v", err)
+		}
+		if replaced(before, sessionIDs()) > 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("客户端未换连")
+}
+
+// sessionIDs 当前已鉴权的会话
+func sessionIDs() map[string]bool {
+	ids := make(map[string]bool)
+	activeSessions.Range(func(key, _ interface{}) bool {
+		ids[key.(string)] = true
+		return true
+	})
+	return ids
+}
+
+// replaced now 中不在 before 里的会话数
+func replaced(before, now map[string]bool) int {
+	n := 0
+	for id := range now {
+		if !before[id] {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// errCodeExcessiveLoad 拒绝超限连接时使用的关闭码（HTTP/3 的 H3_EXCESSIVE_LOAD，与 h3 伪装保持一致）
+const errCodeExcessiveLoad = 0x107
+
+// limiterSweepInterval 清理空闲 IP 令牌桶的间隔
+const limiterSweepInterval = time.Minute
+
+// ipRateLimiter 按来源 IP 限制新建连接速率（令牌桶）
+type ipRateLimiter struct {
+	rate  float64 // 每秒补充的令牌数（<= 0 表示不限制）
+	burst float64 // 桶容量（允许的突发连接数）
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket 单个 IP 的令牌桶
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time
+	throttled bool // 当前是否处于限流中（只在刚开始限流时打一次日志）
+}
+
+// newIPRateLimiter 创建限流器，并在后台定期清理空闲的令牌桶
+func newIPRateLimiter(rate float64, burst int) *ipRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &ipRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	if rate > 0 {
+		go l.sweepLoop()
+	}
+	return l
+}
+
+// allow 判断来自 ip 的新连接是否放行
+// 第二个返回值表示该 IP 是否刚刚进入限流状态（用于抑制重复日志）
+func (l *ipRateLimiter) allow(ip string, now time.Time) (bool, bool) {
+	if l.rate <= 0 {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.throttled = false
+		return true, false
+	}
+	first := !b.throttled
+	b.throttled = true
+	return false, first
+}
+
+// sweepLoop 删除已经补满的令牌桶（该 IP 近期没有新连接）
+func (l *ipRateLimiter) sweepLoop() {
+	ticker := time.NewTicker(limiterSweepInterval)
+	defer ticker.Stop()
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for now := range ticker.C {
+		l.mu.Lock()
+		for ip, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// errConnRejected 握手前拒绝的连接（quic-go 以 CONNECTION_REFUSED 回复其 Initial 包）
+var errConnRejected = errors.New("连接未通过准入")
+
+// admitConnection 握手之前的连接准入（quic.Config.GetConfigForClient）
+// 封禁中的来源与新建连接过快的来源在收到第一个 Initial 包时就被拒绝，不为其做 TLS 握手、不分配连接状态；
+// 全局并发上限要在连接结束时释放名额，仍在 Accept 之后检查
+func admitConnection(limiter *ipRateLimiter, config *quic.Config) func(*quic.ClientHelloInfo) (*quic.Config, error) {
+	return func(info *quic.ClientHelloInfo) (*quic.Config, error) {
+		ip := remoteIP(info.RemoteAddr)
+		now := time.Now()
+
+		// 鉴权失败过多而封禁中的来源（封禁时已打日志）
+		if authFailures != nil && authFailures.banned(ip, now) {
+			return nil, errConnRejected
+		}
+
+		// 单 IP 新建连接速率限制
+		if ok, first := limiter.allow(ip, now); !ok {
+			if first {
+				log.Printf("⚠️ [限流] 来源 %s 新建连接过快，拒绝后续连接", ip)
+			}
+			return nil, errConnRejected
+		}
+		return config, nil
+	}
+}
+
+// connLimiter 全局并发连接数上限
+type connLimiter struct {
+	max       int64 // <= 0 表示不限制
+	active    atomic.Int64
+	saturated atomic.Bool // 是否已达上限（只在刚达到上限时打一次日志）
+}
+
+// acquire 占用一个连接名额，超出上限返回 false
+// 第二个返回值表示是否刚刚达到上限
+func (l *connLimiter) acquire() (bool, bool) {
+	n := l.active.Add(1)
+	if l.max > 0 && n > l.max {
+		l.active.Add(-1)
+		return false, l.saturated.CompareAndSwap(false, true)
+	}
+	return true, false
+}
+
+// release 释放连接名额
+func (l *connLimiter) release() {
+	l.active.Add(-1)
+	l.saturated.Store(false)
+}
+
+// remoteIP 提取连接的来源 IP（不含端口）
+func remoteIP(addr net.Addr) string {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestIPRateLimiterRefill(t *testing.T) {
+	l := &ipRateLimiter{rate: 2, burst: 3, buckets: make(map[string]*tokenBucket)}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("1.1.1.1", now); !ok {
+			t.Fatalf("突发内第 %d 个连接被拒绝", i+1)
+		}
+	}
+	ok, first := l.allow("1.1.1.1", now)
+	if ok || !first {
+		t.Fatalf("超出突发: ok=%v first=%v", ok, first)
+	}
+	if _, first := l.allow("1.1.1.1", now); first {
+		t.Fatal("持续限流时不应重复报告刚进入限流")
+	}
+	if ok, _ := l.allow("2.2.2.2", now); !ok {
+		t.Fatal("其他来源不受影响")
+	}
+	// 0.5 秒补充 1 个令牌
+	if ok, _ := l.allow("1.1.1.1", now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("补充令牌后仍被拒绝")
+	}
+}
+
+func TestIPRateLimiterHammer(t *testing.T) {
+	const burst, workers, perWorker = 20, 32, 50
+	l := &ipRateLimiter{rate: 1e-9, burst: burst, buckets: make(map[string]*tokenBucket)}
+	now := time.Now()
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+
+	// 同一时刻来自同一批来源的大量并发连接：每个来源放行的数量恰好等于突发上限
+	allowed := make([]atomic.Int64, len(ips))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				idx := (w + i) % len(ips)
+				if ok, _ := l.allow(ips[idx], now); ok {
+					allowed[idx].Add(1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i, ip := range ips {
+		if n := allowed[i].Load(); n != burst {
+			t.Errorf("来源 %s 放行 %d 个连接，期望 %d", ip, n, burst)
+		}
+	}
+}
+
+func TestConnLimiterHammer(t *testing.T) {
+	const max, workers = 8, 64
+	l := &connLimiter{max: max}
+
+	var inUse, peak atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if ok, _ := l.acquire(); !ok {
+					continue
+				}
+				n := inUse.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				inUse.Add(-1)
+				l.release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > max {
+		t.Fatalf("并发连接峰值 %d 超过上限 %d", p, max)
+	}
+	if n := l.active.Load(); n != 0 {
+		t.Fatalf("全部释放后仍占用 %d 个名额", n)
+	}
+}
+
+func TestAdmissionBeforeHandshake(t *testing.T) {
+	quicConfig := testQUICConfig()
+	quicConfig.GetConfigForClient = admitConnection(newIPRateLimiter(0.001, 2), quicConfig)
+	node := startTestNodeWithConfig(t, quicConfig)
+
+	dial := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := quic.DialAddr(ctx, node.addr, &tls.Config{
+			ServerName: core.ServerName,
+			NextProtos: []string{serverALPN()},
+		}, nil)
+		if err == nil {
+			conn.CloseWithError(0, "")
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := dial(); err != nil {
+			t.Fatalf("突发内第 %d 个连接: %v", i+1, err)
+		}
+	}
+	// 超限的连接不做 TLS 握手，quic-go 直接以 CONNECTION_REFUSED 回复 Initial 包
+	var transportErr *quic.TransportError
+	err := dial()
+	if !errors.As(err, &transportErr) || transportErr.ErrorCode != quic.ConnectionRefused {
+		t.Fatalf("超限的连接应在握手前被拒绝，实际 %v", err)
+	}
+}
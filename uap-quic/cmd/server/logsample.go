@@ -0,0 +1,111 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// logSampleRate 流生命周期日志的采样率：每 N 条流记录 1 条（1 表示全部记录）
+// 开启了详细日志的用户（见 verboseUsers）不受采样影响，其连接上的流与 UDP 数据包全部记录
+var logSampleRate = 1
+
+// defaultVerboseTTL 开启用户详细日志时未指定时长的默认值（到期自动关闭，避免忘记关闭）
+const defaultVerboseTTL = 30 * time.Minute
+
+// streamLog 单条流的日志开关：流开始时确定一次，之后不再变化
+// 同一条流的建立与关闭日志要么都记录、要么都不记录（运行中开关用户详细日志只影响之后的流）
+type streamLog bool
+
+// newStreamLog 确定流的日志开关：用户开启了详细日志时记录，否则按 (会话, 流 ID) 哈希采样
+// 采样结果只取决于会话与流 ID，同一条流多次判断结果相同
+func newStreamLog(state *connState, streamID int64) streamLog {
+	return streamLog(state.verbose() || sampleStream(state.sessionID, streamID, logSampleRate))
+}
+
+// sampleStream 流是否被采样：rate <= 1 时全部采样，否则约每 rate 条流采样 1 条
+// 使用哈希而不是流 ID 取模：客户端流 ID 以 4 递增，取模会让部分采样率永远选不中或全部选中
+func sampleStream(sessionID string, streamID int64, rate int) bool {
+	if rate <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	h.Write([]byte(strconv.FormatInt(streamID, 10)))
+	return h.Sum32()%uint32(rate) == 0
+}
+
+// Printf 流被采样时记录日志
+func (l streamLog) Printf(format string, args ...interface{}) {
+	if l {
+		log.Printf(format, args...)
+	}
+}
+
+// verboseSet 开启了详细日志的用户（uuid → 到期时间），运行时通过调试接口增删
+type verboseSet struct {
+	mu    sync.Mutex
+	users map[string]time.Time
+}
+
+// verboseUsers 开启了详细日志的用户
+var verboseUsers = &verboseSet{users: make(map[string]time.Time)}
+
+// enable 开启用户的详细日志，ttl 后自动关闭
+func (s *verboseSet) enable(uuid string, ttl time.Duration) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt := time.Now().Add(ttl)
+	s.users[uuid] = expiresAt
+	return expiresAt
+}
+
+// disable 关闭用户的详细日志，用户原本未开启时返回 false
+func (s *verboseSet) disable(uuid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[uuid]
+	delete(s.users, uuid)
+	return ok
+}
+
+// enabled 用户是否开启了详细日志（到期的条目在此时删除）
+func (s *verboseSet) enabled(uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.users[uuid]
+	if ok && time.Now().After(expiresAt) {
+		delete(s.users, uuid)
+		return false
+	}
+	return ok
+}
+
+// verboseUser 调试接口返回的单个用户
+type verboseUser struct {
+	UUID      string `json:"uuid"`
+	ExpiresAt int64  `json:"expires_at"` // Unix 秒
+}
+
+// list 当前开启了详细日志的用户（按 uuid 排序）
+func (s *verboseSet) list() []verboseUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	users := []verboseUser{}
+	for uuid, expiresAt := range s.users {
+		if now.After(expiresAt) {
+			delete(s.users, uuid)
+			continue
+		}
+		users = append(users, verboseUser{UUID: uuid, ExpiresAt: expiresAt.Unix()})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UUID < users[j].UUID })
+	return users
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// withLogSample 测试期间设置流日志采样率（需在启动测试节点之前调用），并清空用户详细日志开关
+func withLogSample(t *testing.T, rate int) {
+	old := logSampleRate
+	logSampleRate = rate
+	t.Cleanup(func() {
+		logSampleRate = old
+		verboseUsers = &verboseSet{users: make(map[string]time.Time)}
+	})
+}
+
+// captureLogs 测试期间把日志写入缓冲区
+func captureLogs(t *testing.T) *lockedBuffer {
+	logs := &lockedBuffer{}
+	old := log.Writer()
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(old) })
+	return logs
+}
+
+var (
+	streamOpenRe  = regexp.MustCompile(`新流已建立: StreamID=(\d+)`)
+	streamCloseRe = regexp.MustCompile(`流已关闭: StreamID=(\d+)`)
+)
+
+// loggedStreams 日志中记录了建立与关闭的流 ID
+func loggedStreams(out string) (opened, closed map[string]bool) {
+	opened, closed = make(map[string]bool), make(map[string]bool)
+	for _, m := range streamOpenRe.FindAllStringSubmatch(out, -1) {
+		opened[m[1]] = true
+	}
+	for _, m := range streamCloseRe.FindAllStringSubmatch(out, -1) {
+		closed[m[1]] = true
+	}
+	return opened, closed
+}
+
+// openStreams 在 conn 上开 n 条鉴权后即结束的流，等待各流的日志写完，返回记录了建立与关闭的流 ID
+func openStreams(t *testing.T, conn quic.Connection, logs *lockedBuffer, n int) (opened, closed map[string]bool) {
+	t.Helper()
+	logs.Reset()
+	for i := 0; i < n; i++ {
+		openAuthedStream(t, conn).Close()
+	}
+	// 流结束后节点异步记录关闭日志：等到建立过的流都记录了关闭
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		opened, closed = loggedStreams(logs.String())
+		if len(closed) >= len(opened) || time.Now().After(deadline) {
+			return opened, closed
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSampleStream(t *testing.T) {
+	for _, rate := range []int{-1, 0, 1} {
+		if !sampleStream("session", 4, rate) {
+			t.Fatalf("采样率 %d 时未全部记录", rate)
+		}
+	}
+	for _, rate := range []int{2, 4, 10} {
+		n, sampled := 4000, 0
+		for i := 0; i < n; i++ {
+			// 客户端双向流 ID 以 4 递增
+			id := int64(i * 4)
+			got := sampleStream("session", id, rate)
+			if got != sampleStream("session", id, rate) {
+				t.Fatalf("流 %d 两次采样结果不同", id)
+			}
+			if got {
+				sampled++
+			}
+		}
+		if want := n / rate; sampled < want*3/4 || sampled > want*5/4 {
+			t.Errorf("采样率 %d 下 %d 条流采样了 %d 条，期望约 %d 条", rate, n, sampled, want)
+		}
+	}
+	// 不同会话的同一流 ID 独立采样
+	differ := false
+	for i := 0; i < 100 && !differ; i++ {
+		differ = sampleStream("a", int64(i*4), 2) != sampleStream("b", int64(i*4), 2)
+	}
+	if !differ {
+		t.Fatal("不同会话的采样结果完全相同")
+	}
+}
+
+func TestStreamLogSampling(t *testing.T) {
+	withLogSample(t, 4)
+	logs := captureLogs(t)
+	node := startTestNode(t)
+
+	// 采样：同一条流的建立与关闭日志要么都记录、要么都不记录
+	opened, closed := openStreams(t, node.dialRaw(t), logs, 40)
+	if len(opened) == 0 || len(opened) == 40 {
+		t.Fatalf("采样率 4 下 40 条流记录了 %d 条", len(opened))
+	}
+	for id := range opened {
+		if !closed[id] {
+			t.Errorf("流 %s 记录了建立但没有记录关闭", id)
+		}
+	}
+	for id := range closed {
+		if !opened[id] {
+			t.Errorf("流 %s 记录了关闭但没有记录建立", id)
+		}
+	}
+
+	// 开启详细日志的用户之后的流全部记录
+	verboseUsers.enable("test-user", time.Minute)
+	opened, closed = openStreams(t, node.dialRaw(t), logs, 10)
+	if len(opened) != 10 || len(closed) != 10 {
+		t.Fatalf("详细日志下 10 条流记录了建立 %d 条、关闭 %d 条", len(opened), len(closed))
+	}
+}
+
+func TestVerboseEndpoint(t *testing.T) {
+	withLogSample(t, 4)
+	srv := httptest.NewServer(handleVerbose("secret"))
+	defer srv.Close()
+
+	do := func(method, query, secret string) (int, []verboseUser) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+query, nil)
+		if secret != "" {
+			req.Header.Set("X-Admin-Secret", secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var users []verboseUser
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, users
+	}
+
+	if status, _ := do(http.MethodGet, "", ""); status != http.StatusForbidden {
+		t.Fatalf("未带管理员密钥返回 %d", status)
+	}
+	if status, _ := do(http.MethodGet, "", "wrong"); status != http.StatusForbidden {
+		t.Fatalf("管理员密钥错误返回 %d", status)
+	}
+	for _, q := range []string{"", "?uuid=u1&ttl=abc", "?uuid=u1&ttl=-1m"} {
+		if status, _ := do(http.MethodPost, q, "secret"); status != http.StatusBadRequest {
+			t.Errorf("POST %q 返回 %d", q, status)
+		}
+	}
+	if status, _ := do(http.MethodPut, "?uuid=u1", "secret"); status != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT 返回 %d", status)
+	}
+
+	before := time.Now()
+	status, users := do(http.MethodPost, "?uuid=u2&ttl=10m", "secret")
+	if status != http.StatusOK || len(users) != 1 || users[0].UUID != "u2" || users[0].ExpiresAt < before.Add(10*time.Minute).Unix() {
+		t.Fatalf("开启详细日志 %d %+v", status, users)
+	}
+	// 未指定时长时使用默认时长，列表按 uuid 排序
+	if _, users := do(http.MethodPost, "?uuid=u1", "secret"); len(users) != 2 || users[0].UUID != "u1" || users[0].ExpiresAt < before.Add(defaultVerboseTTL).Unix() {
+		t.Fatalf("开启详细日志 %+v", users)
+	}
+	if !verboseUsers.enabled("u1") || verboseUsers.enabled("u3") || verboseUsers.enabled("") {
+		t.Fatal("详细日志开关状态错误")
+	}
+	if _, users := do(http.MethodDelete, "?uuid=u1", "secret"); len(users) != 1 || users[0].UUID != "u2" {
+		t.Fatalf("关闭详细日志后 %+v", users)
+	}
+	if verboseUsers.enabled("u1") {
+		t.Fatal("关闭后仍开启详细日志")
+	}
+
+	// 到期自动关闭
+	verboseUsers.enable("u3", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if verboseUsers.enabled("u3") {
+		t.Fatal("到期后仍开启详细日志")
+	}
+	if _, users := do(http.MethodGet, "", "secret"); len(users) != 1 || users[0].UUID != "u2" {
+		t.Fatalf("列表中包含到期或已关闭的用户 %+v", users)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -16,12 +18,20 @@ import (
 	"sync"
 	"time"
 
+	"uap-quic/pkg/compress"
+	"uap-quic/pkg/config"
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/psk"
+	"uap-quic/pkg/relay"
+	"uap-quic/pkg/target"
+	"uap-quic/pkg/window"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/quic-go/quic-go"
 )
 
-// jwtPublicKey 用于验证 JWT Token 的公钥
-var jwtPublicKey interface{}
+// preSharedKey 预共享密钥（为空表示不启用），鉴权行必须以 PSK 证明开头
+var preSharedKey string
 
 // bufPool 全局缓冲池，用于复用传输缓冲区（32KB 是 iOS 网络传输的黄金尺寸）
 var bufPool = sync.Pool{
@@ -41,11 +51,74 @@ func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
 }
 
 func main() {
+	startedAt := time.Now()
+
 	// 解析命令行参数
 	certFile := flag.String("cert", "", "TLS 证书文件路径（必需）")
 	keyFile := flag.String("key", "", "TLS 私钥文件路径（必需）")
+	nodeKeyFile := flag.String("node-key", "public_key.pem", "节点公钥文件路径（需与在 uap-admin 注册的公钥一致，用于校验连接票据绑定）")
+	flag.BoolVar(&requireTicket, "require-ticket", false, "只接受短期连接票据，拒绝直接出示的长期 JWT")
+	flag.BoolVar(&compressionEnabled, "compress", true, "允许客户端协商压缩 TCP 流（会增加 CPU 占用，false 时客户端按未压缩处理）")
+	adminURL := flag.String("admin-url", "", "uap-admin 地址，用于定期上报活跃会话 (e.g. https://admin.uap.io)，为空则不上报")
+	jwksURL := flag.String("jwks-url", "", "JWT 验签公钥集合 (JWKS) 地址，为空时使用 <admin-url>/api/v1/system/jwks（都为空则只使用本地 public_key.pem）")
+	jwksRefresh := flag.Duration("jwks-refresh", 5*time.Minute, "JWKS 刷新间隔（遇到未知 kid 时会立即刷新）")
+	adminSecret := flag.String("admin-secret", os.Getenv("UAP_ADMIN_SECRET"), "uap-admin 管理员密钥（默认读取环境变量 UAP_ADMIN_SECRET）")
+	reportInterval := flag.Duration("report-interval", 60*time.Second, "会话上报间隔")
+	maxConns := flag.Int("max-conns", 10000, "全局并发连接数上限（0 表示不限制）")
+	connRate := flag.Float64("conn-rate", 5, "单个来源 IP 每秒允许新建的连接数（0 表示不限制）")
+	connBurst := flag.Int("conn-burst", 20, "单个来源 IP 允许的突发连接数")
+	authFailWindow := flag.Duration("auth-fail-window", 10*time.Minute, "按来源 IP 统计鉴权失败次数的时间窗口（统计见健康检查接口 auth_failures）")
+	authFailBan := flag.Int("auth-fail-ban", 0, "来源 IP 在统计窗口内鉴权失败达到该次数后临时封禁，封禁期内新连接直接拒绝；0 表示只统计不封禁")
+	authFailBanTime := flag.Duration("auth-fail-ban-time", 30*time.Minute, "鉴权失败过多的来源 IP 的封禁时长")
+	egressIPs := flag.String("egress-ips", "", "出口 IP 池（逗号分隔的本机地址），出站连接轮流绑定其中的源地址，为空使用系统默认出口")
+	egressStrategy := flag.String("egress-strategy", egressRoundRobin, "出口 IP 选择策略: round-robin（每个连接轮换）或 hash（按目标主机固定）")
+	egressRoutes := flag.String("egress-routes", "", "出口路由策略文件（每行 \"目标网段 出口源地址\"），命中的目标绑定该源地址出站，优先于出口 IP 池；为空不启用")
+	udpAllowPorts := flag.String("udp-allow-ports", "", "放行的 UDP 放大攻击端口（逗号分隔，如 123 允许经隧道校时；all 表示不拒绝任何端口），默认拒绝 QOTD/CharGen/NTP/SNMP/CLDAP/SSDP/WS-Discovery/memcached")
+	udpUnreach := flag.Bool("udp-unreachable", false, "把 UDP 目标返回的 ICMP 不可达转告客户端（仅 Linux）：发往 53 端口的查询回复 SERVFAIL，其他端口向新版客户端发送不可达信令，应用立即失败而不是等到超时")
+	softRestartFlag := flag.Bool("soft-restart", false, "平滑升级（仅 Linux）：收到 SIGUSR2 时启动新的二进制接管监听，旧进程排空已有连接后退出，升级期间隧道不中断")
+	udpAmpRatio := flag.Float64("udp-amp-ratio", 20, "单个 UDP 目标允许的回包/请求字节比，超出时封禁该目标（0 表示不检查）")
+	streamWindowInit := flag.Int("stream-window-init", 0, "QUIC 单流初始接收窗口 (KB)，0 表示默认 2048")
+	streamWindowMax := flag.Int("stream-window-max", 0, "QUIC 单流最大接收窗口 (KB)，0 表示默认 6144；决定客户端上行的单流吞吐上限（约为 窗口 / RTT）")
+	connWindowInit := flag.Int("conn-window-init", 0, "QUIC 连接初始接收窗口 (KB)，0 表示默认 6144")
+	connWindowMax := flag.Int("conn-window-max", 0, "QUIC 连接最大接收窗口 (KB)，0 表示默认 15360（每条连接最多占用的接收缓冲）")
+	idleTimeout := flag.Duration("idle-timeout", core.DefaultIdleTimeout, "QUIC 连接的空闲超时：期间没有收到客户端任何包即判定连接已断开（两端取较小值，保活间隔为其 1/3、最长 10s），最小 5s")
+	flag.StringVar(&preSharedKey, "psk", os.Getenv("UAP_PSK"), "预共享密钥（可选，默认读取环境变量 UAP_PSK），设置后客户端必须使用相同 PSK，否则即使 Token 有效也进入伪装模式")
+	flag.BoolVar(&trustedMode, "trusted", false, "信任模式：跳过 Token 鉴权与防探测伪装（只用于可信内网，客户端需同样开启 -trusted；-listen 必须是内网 / VPN 地址）")
+	listenAddr := flag.String("listen", "0.0.0.0:52222", "监听地址（QUIC 与测速 TCP 使用同一端口）")
+	trustedOverride := flag.Bool("i-know-what-im-doing", false, "允许信任模式监听非内网地址（包括 0.0.0.0），任何能访问该端口的人都能使用代理")
+	flag.DurationVar(&maxConnLifetime, "max-conn-lifetime", 0, "连接最长时长（如 6h，实际在 ±10% 内随机），到期后通知客户端换连，用于滚动均衡各节点负载；0 表示不限制")
+	flag.DurationVar(&connDrainTimeout, "conn-drain-timeout", 30*time.Second, "达到最长时长后等待进行中的流结束的最长时间，超时强制关闭")
+	bulkRate := flag.Float64("bulk-rate", 0, "规则标记为大流量 (tag=bulk) 的 TCP 转发共用的限速 (Mbit/s，上下行合计)，0 表示不限速")
+	priority := flag.Bool("stream-priority", false, "下行流优先级：同一连接上交互流量优先于大流量（tag=bulk 或下行超过 -bulk-after 的流），大流量分片写入并在交互流量待发送时短暂让路")
+	priorityAfter := flag.Int("bulk-after", 1024, "开启 -stream-priority 时，未标记的流下行超过多少 KB 后按大流量处理，0 表示只按 tag=bulk 区分")
+	dscp := flag.Int("game-dscp", 46, "规则标记为游戏流量 (tag=game) 的 UDP 出口与 TCP 目标连接使用的 DSCP 值（默认 46 即 EF），0 表示不标记")
+	poolPorts := flag.String("upstream-pool-ports", "", "复用上游 TCP 连接的目标端口（逗号分隔，如 80,8080，只应填明文 HTTP 端口）：同一用户到同一目标的 HTTP/1.x 连接在请求边界结束后保留，之后的流直接复用；为空不启用")
+	poolIdle := flag.Duration("upstream-pool-idle", 30*time.Second, "复用池中空闲上游连接的保留时长")
+	udpLease := flag.Duration("udp-lease", 0, "UDP 出口端口租约：关联结束后保留其出口 socket 的时长（如 2m），同一用户重连后发往同一目标时沿用原来的外部端口，游戏短暂断线不会被当作新玩家；0 表示不启用")
+	udpLeaseMax := flag.Int("udp-lease-max", 1024, "保留中的 UDP 出口 socket 上限（超出时关闭最早的，每个用户最多 8 个）")
+	tfo := flag.Bool("tcp-fastopen", false, "连接 TCP 目标时启用 TCP Fast Open（仅 Linux）：目标返回过 cookie 后第一段数据随 SYN 发出，短连接省一个往返；部分中间设备会丢弃带数据的 SYN，默认关闭")
+	udpRcvBuf := flag.Int("udp-rcvbuf", 0, "QUIC 监听 socket 的接收缓冲区 (KB, SO_RCVBUF)，0 表示系统默认（quic-go 会尝试调到 2048）；高吞吐时调大可减少丢包重传，超过 net.core.rmem_max 的部分需要 CAP_NET_ADMIN")
+	udpSndBuf := flag.Int("udp-sndbuf", 0, "QUIC 监听 socket 的发送缓冲区 (KB, SO_SNDBUF)，0 表示系统默认")
+	egressRcvBuf := flag.Int("egress-udp-rcvbuf", 0, "每个 UDP 关联出口 socket 的接收缓冲区 (KB)，0 表示系统默认（每条连接一个，注意内存占用）")
+	egressSndBuf := flag.Int("egress-udp-sndbuf", 0, "每个 UDP 关联出口 socket 的发送缓冲区 (KB)，0 表示系统默认")
+	healthAddr := flag.String("health-addr", "", "HTTP 健康检查监听地址 (e.g. 127.0.0.1:9090，提供 GET /health、/debug/verbose 与维护模式开关 /maintenance)，为空不启用")
+	flag.IntVar(&logSampleRate, "log-sample", 1, "流建立 / 关闭日志的采样率：每 N 条流记录 1 条（1 表示全部记录）；错误日志与开启了详细日志的用户不受影响")
+	selftestMode := flag.Bool("selftest", false, "自检：在本机临时端口启动节点并用进程内客户端连接自己，完成一次 TCP 与 UDP 回显后退出（失败时退出码非 0）")
+	selftestToken := flag.String("selftest-token", "", "自检使用的 Token 文件（用户 JWT，启用 -require-ticket 时为本节点的连接票据），信任模式不需要")
+	printConfigOnly := flag.Bool("print-config", false, "输出合并后的生效配置 (JSON，含每项的来源 flag/env/file/default，密钥只输出指纹) 后退出")
 	flag.Parse()
 
+	if *printConfigOnly {
+		if err := printConfig(*keyFile); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return
+	}
+
+	if err := checkTrustedMode(*listenAddr, *trustedOverride); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
 	// 强制检查证书和私钥参数
 	if *certFile == "" || *keyFile == "" {
 		log.Fatal("❌ 错误: 必须提供 -cert 和 -key 参数")
@@ -59,67 +132,212 @@ func main() {
 
 	// 成功加载证书后，打印日志
 	log.Printf("✅ 成功加载 TLS 证书: %s", *certFile)
+	leafCert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		log.Fatalf("❌ 解析 TLS 证书失败: %v", err)
+	}
+
+	if trustedMode {
+		log.Printf("⚠️ 信任模式：不校验 Token、不启用防探测伪装，任何能访问本节点端口的人都能使用代理，只应部署在可信内网")
+	}
 
-	// 加载 JWT 公钥
+	// 加载 JWT 验签公钥：配置了 JWKS 时以 uap-admin 发布的 JWKS 为准，本地公钥文件只在首次拉取成功前使用
+	// 信任模式不校验 Token，不需要公钥
+	jwksSource := *jwksURL
+	if jwksSource == "" && *adminURL != "" {
+		jwksSource = strings.TrimRight(*adminURL, "/") + "/api/v1/system/jwks"
+	}
 	publicKeyPath := "public_key.pem"
-	publicKeyData, err := os.ReadFile(publicKeyPath)
+	var fallbackKey ed25519.PublicKey
+	if publicKeyData, err := os.ReadFile(publicKeyPath); err == nil {
+		key, err := jwt.ParseEdPublicKeyFromPEM(publicKeyData)
+		if err != nil {
+			log.Fatalf("❌ 解析公钥失败: %v", err)
+		}
+		fallbackKey = key.(ed25519.PublicKey)
+		log.Printf("✅ 成功加载 JWT 公钥: %s", publicKeyPath)
+	} else if jwksSource == "" && !trustedMode {
+		log.Fatalf("❌ 读取公钥文件失败: %v (请检查文件路径: %s，或通过 -admin-url / -jwks-url 使用 JWKS)", err, publicKeyPath)
+	}
+	jwtKeys = newJWTKeySet(jwksSource, fallbackKey)
+	if jwksSource != "" {
+		if jwtKeys.refresh() {
+			log.Printf("✅ JWT 验签使用 JWKS: %s (每 %v 刷新)", jwksSource, *jwksRefresh)
+		} else if fallbackKey != nil {
+			log.Printf("⚠️ 首次拉取 JWKS 失败，暂时使用本地公钥 %s，后台重试", publicKeyPath)
+		} else {
+			log.Printf("⚠️ 首次拉取 JWKS 失败且没有本地公钥，JWT 验证暂不可用，后台重试")
+		}
+		go jwtKeys.refreshLoop(*jwksRefresh)
+	}
+
+	// 加载节点公钥指纹（用于校验连接票据的节点绑定）
+	nodePublicKeyPEM, nodeFingerprint, err = loadNodeKey(*nodeKeyFile)
 	if err != nil {
-		log.Fatalf("❌ 读取公钥文件失败: %v (请检查文件路径: %s)", err, publicKeyPath)
+		if requireTicket {
+			log.Fatalf("❌ 读取节点公钥失败: %v (启用 -require-ticket 时必须提供 -node-key)", err)
+		}
+		log.Printf("⚠️ 读取节点公钥失败: %v (连接票据将被拒绝，仅支持 JWT 鉴权)", err)
+	} else {
+		log.Printf("✅ 成功加载节点公钥: %s (指纹 %s...)", *nodeKeyFile, nodeFingerprint[:16])
+		go seenTickets.sweepLoop()
 	}
-	jwtPublicKey, err = jwt.ParseEdPublicKeyFromPEM(publicKeyData)
+
+	// 出口 IP 池
+	egress, err = newEgressPool(*egressIPs, *egressStrategy)
 	if err != nil {
-		log.Fatalf("❌ 解析公钥失败: %v", err)
+		log.Fatalf("❌ 出口 IP 配置错误: %v", err)
+	}
+	if egress != nil {
+		log.Printf("✅ 出口 IP 池: %s (策略 %s)", egress, egress.strategy)
+	}
+	if *egressRoutes != "" {
+		routes, err = loadRouteTable(*egressRoutes)
+		if err != nil {
+			log.Fatalf("❌ 出口路由策略配置错误: %v", err)
+		}
+		if routes != nil {
+			log.Printf("✅ 出口路由策略: %s", routes)
+		}
+	}
+
+	// 流量类型策略
+	if err := configureQoS(*bulkRate, *dscp, *priority, *priorityAfter); err != nil {
+		log.Fatalf("❌ 流量类型策略配置错误: %v", err)
+	}
+
+	// 连接目标的 TCP Fast Open
+	configureTFO(*tfo)
+
+	// UDP 目标不可达转告
+	configureUDPUnreachable(*udpUnreach)
+
+	// 平滑升级
+	if err := configureSoftRestart(*softRestartFlag); err != nil {
+		log.Fatalf("❌ 平滑升级: %v", err)
+	}
+
+	// 上游连接复用
+	upstreamPool, err = newConnPool(*poolPorts, *poolIdle)
+	if err != nil {
+		log.Fatalf("❌ 上游连接复用配置错误: %v", err)
+	}
+	if upstreamPool != nil {
+		log.Printf("✅ 上游连接复用: 端口 %s (空闲保留 %v)", upstreamPool, *poolIdle)
+	}
+
+	// UDP 出口端口租约
+	udpLeases, err = newLeaseTable(*udpLease, *udpLeaseMax)
+	if err != nil {
+		log.Fatalf("❌ UDP 出口租约配置错误: %v", err)
+	}
+	if udpLeases != nil {
+		log.Printf("✅ UDP 出口端口租约: 保留 %v (最多 %d 个)", *udpLease, *udpLeaseMax)
+	}
+
+	// 鉴权失败统计与临时封禁
+	authFailures, err = newAuthFailTable(*authFailWindow, *authFailBan, *authFailBanTime)
+	if err != nil {
+		log.Fatalf("❌ 鉴权失败封禁配置错误: %v", err)
+	}
+	if *authFailBan > 0 {
+		log.Printf("✅ 鉴权失败封禁: %v 内失败 %d 次的来源 IP 封禁 %v", *authFailWindow, *authFailBan, *authFailBanTime)
+	}
+
+	// UDP socket 缓冲区
+	configureSocketBuffers(*udpRcvBuf, *udpSndBuf, *egressRcvBuf, *egressSndBuf)
+
+	// UDP 放大防护
+	ampPolicy, err = newAmplificationPolicy(*udpAllowPorts, *udpAmpRatio)
+	if err != nil {
+		log.Fatalf("❌ UDP 放行端口配置错误: %v", err)
+	}
+	log.Printf("✅ UDP 放大防护: 拒绝端口 %s，回包/请求字节比上限 %.0f", ampPolicy, ampPolicy.maxRatio)
+
+	// 定期向 uap-admin 上报活跃会话（自检不上报）
+	if *adminURL != "" && !*selftestMode {
+		if nodePublicKeyPEM == "" {
+			log.Printf("⚠️ 未加载节点公钥，无法向 uap-admin 上报会话")
+		} else {
+			go reportLoop(*adminURL, *adminSecret, *reportInterval)
+		}
 	}
-	log.Printf("✅ 成功加载 JWT 公钥: %s", publicKeyPath)
 
 	// 配置 TLS（伪装成标准的 HTTP/3 流量）
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{tlsCert},
-		NextProtos:   []string{"h3"}, // h3 是国际标准的 HTTP/3 协议代号
+		NextProtos:   []string{serverALPN()}, // 普通模式为 h3，信任模式见 trustedALPN
 	}
 
 	// 配置 QUIC（启用数据报以支持 UDP 转发，并配置 Keep-Alive）
+	if *idleTimeout < core.MinIdleTimeout {
+		log.Fatalf("❌ -idle-timeout 不能小于 %v", core.MinIdleTimeout)
+	}
 	quicConfig := &quic.Config{
 		EnableDatagrams: true,
-		MaxIdleTimeout:  time.Hour * 24 * 365, // 允许连接闲置 1 年
-		KeepAlivePeriod: 10 * time.Second,
+		// 空闲超时：客户端所在路径中断后及时释放连接与会话（保活包让正常的空闲连接保持存活）
+		MaxIdleTimeout:  *idleTimeout,
+		KeepAlivePeriod: core.KeepAlivePeriod(*idleTimeout),
 		// 1. 恢复 MTU 探测 (iperf 证明大包能过，开启它能提速)
 		DisablePathMTUDiscovery: false,
 		// 2. 并发流适中 (既不拥堵也不受限)
 		MaxIncomingStreams:    5000,
 		MaxIncomingUniStreams: 5000,
-		// 3. 黄金窗口参数 (Sweet Spot)
-		// 针对跨国高延迟 + 轻微丢包环境的最优解
-		InitialStreamReceiveWindow:     1024 * 1024 * 2,  // 2MB 起步
-		MaxStreamReceiveWindow:         1024 * 1024 * 6,  // 单流最大 6MB (足够跑满 100M+)
-		InitialConnectionReceiveWindow: 1024 * 1024 * 6,  // 连接起步 6MB
-		MaxConnectionReceiveWindow:     1024 * 1024 * 15, // 连接最大 15MB
+	}
+	// 3. 接收窗口（默认为黄金窗口参数：针对跨国高延迟 + 轻微丢包环境的最优解）
+	windows := window.FromKB(*streamWindowInit, *streamWindowMax, *connWindowInit, *connWindowMax)
+	if err := windows.Validate(); err != nil {
+		log.Fatalf("❌ 接收窗口配置无效: %v", err)
+	}
+	windows.Apply(quicConfig)
+	log.Printf("✅ QUIC 接收窗口: %s", windows)
+	if maxConnLifetime > 0 {
+		log.Printf("✅ 连接最长时长: %v (排空超时 %v)", maxConnLifetime, connDrainTimeout)
 	}
 
-	// 启动 TCP 监听（用于测速和伪装）
-	go func() {
-		// 使用与 QUIC 相同的端口
-		tcpLn, err := net.Listen("tcp", "0.0.0.0:52222")
-		if err != nil {
-			log.Printf("⚠️ TCP 监听失败: %v", err)
-			return
+	if *selftestMode {
+		os.Exit(runSelftest(tlsCert, tlsConfig, quicConfig, *selftestToken))
+	}
+
+	if *healthAddr != "" {
+		if healthLn, err := listenHealth(*healthAddr); err != nil {
+			log.Printf("⚠️ 健康检查监听失败: %v", err)
+		} else {
+			go serveHealth(healthLn, *adminSecret, startedAt, leafCert.NotAfter)
 		}
-		defer tcpLn.Close()
-		log.Println("✅ TCP 监听已启动 (用于测速)")
+	}
 
-		for {
-			conn, err := tcpLn.Accept()
-			if err != nil {
-				continue
+	// 启动 TCP 监听（用于测速和伪装），使用与 QUIC 相同的端口
+	if tcpLn, err := listenNodeTCP(*listenAddr); err != nil {
+		log.Printf("⚠️ TCP 监听失败: %v", err)
+	} else {
+		go func() {
+			defer tcpLn.Close()
+			log.Println("✅ TCP 监听已启动 (用于测速)")
+
+			for {
+				conn, err := tcpLn.Accept()
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					continue
+				}
+				// 收到连接直接关闭即可（完成握手即视为测速成功）
+				conn.Close()
 			}
-			// 收到连接直接关闭即可（完成握手即视为测速成功）
-			conn.Close()
-		}
-	}()
+		}()
+	}
+
+	// 连接准入：封禁来源与单 IP 新建速率在握手之前检查，全局并发上限在 Accept 之后检查（均在任何鉴权/伪装逻辑之前）
+	rateLimiter := newIPRateLimiter(*connRate, *connBurst)
+	quicConfig.GetConfigForClient = admitConnection(rateLimiter, quicConfig)
+	concurrency := &connLimiter{max: int64(*maxConns)}
+	log.Printf("✅ 连接准入: 单 IP %.1f 个/秒 (突发 %d)，全局并发上限 %d", *connRate, *connBurst, *maxConns)
 
 	// 监听地址
-	addr := "0.0.0.0:52222"
-	listener, err := quic.ListenAddr(addr, tlsConfig, quicConfig)
+	addr := *listenAddr
+	listener, err := listenNode(addr, tlsConfig, quicConfig)
 	if err != nil {
 		log.Fatalf("监听失败: %v", err)
 	}
@@ -127,25 +345,67 @@ func main() {
 
 	log.Printf("QUIC 服务端已启动，监听地址: %s", addr)
 
+	// 平滑升级：通知旧进程已开始接受连接，并开始等待下一次 SIGUSR2
+	handoffReady()
+	if softRestart {
+		watchUpgradeSignal()
+	}
+
 	// 循环接受连接
 	for {
 		conn, err := listener.Accept(context.Background())
 		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				select {
+				case <-handedOff:
+					drainAfterHandOff(concurrency.active.Load)
+					return
+				default:
+				}
+			}
 			log.Printf("接受连接失败: %v", err)
 			continue
 		}
 
+		if refuseInMaintenance(conn) {
+			continue
+		}
+
+		// 全局并发连接上限
+		if ok, first := concurrency.acquire(); !ok {
+			if first {
+				log.Printf("⚠️ [限流] 并发连接数已达上限 %d，拒绝新连接", *maxConns)
+			}
+			conn.CloseWithError(errCodeExcessiveLoad, "")
+			continue
+		}
+
 		log.Printf("新连接已建立: %s", conn.RemoteAddr())
 
 		// 为每个连接启动一个 goroutine 处理
-		go handleConnection(conn)
+		go func() {
+			defer concurrency.release()
+			handleConnection(conn)
+		}()
 	}
 }
 
 func handleConnection(conn quic.Connection) {
 	defer conn.CloseWithError(0, "连接关闭")
 
+	// 连接级状态（鉴权 + 会话统计）
+	state := newConnState(conn)
+	defer state.close()
+
 	var wg sync.WaitGroup
+	if maxConnLifetime > 0 {
+		// 随连接关闭退出，连接处理结束前一并等待
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enforceLifetime(conn, state)
+		}()
+	}
 	wg.Add(2)
 
 	// Goroutine 1: 处理 QUIC Stream（TCP 连接）
@@ -159,10 +419,8 @@ func handleConnection(conn quic.Connection) {
 				return
 			}
 
-			log.Printf("新流已建立: StreamID=%d", stream.StreamID())
-
 			// 为每个流启动一个 goroutine 处理
-			go handleStream(stream)
+			go handleStream(stream, state)
 		}
 	}()
 
@@ -170,7 +428,7 @@ func handleConnection(conn quic.Connection) {
 	// 这个函数内部会创建 UDP Socket 并启动两个子循环：接收循环和发送循环
 	go func() {
 		defer wg.Done()
-		handleDatagrams(conn)
+		handleDatagrams(conn, state)
 	}()
 
 	// 等待所有 goroutine 完成
@@ -178,15 +436,25 @@ func handleConnection(conn quic.Connection) {
 	log.Printf("[QUIC] 连接 %s 已关闭", conn.RemoteAddr())
 }
 
-func handleStream(stream quic.Stream) {
+func handleStream(stream quic.Stream, state *connState) {
 	defer stream.Close()
+	state.streams.Add(1)
+	defer state.streams.Add(-1)
 
-	// 鉴权：在 AcceptStream 后，先读取 Token
-	if !verifyToken(stream) {
+	// 鉴权：在 AcceptStream 后，先读取 Token（信任模式跳过，流上直接是地址帧）
+	if !trustedMode && !verifyToken(stream, state) {
 		// 验证失败，不继续处理
 		return
 	}
 
+	// 鉴权后才知道用户，此时确定本条流的日志开关（建立与关闭日志成对记录）
+	sl := newStreamLog(state, int64(stream.StreamID()))
+	start := time.Now()
+	sl.Printf("新流已建立: StreamID=%d", stream.StreamID())
+	defer func() {
+		sl.Printf("流已关闭: StreamID=%d (%v)", stream.StreamID(), time.Since(start).Round(time.Millisecond))
+	}()
+
 	// 协议解析：读取 1 个字节（长度 N）
 	lengthBuf := make([]byte, 1)
 	_, err := io.ReadFull(stream, lengthBuf)
@@ -196,32 +464,72 @@ func handleStream(stream quic.Stream) {
 	}
 
 	addressLen := int(lengthBuf[0])
-	if addressLen <= 0 || addressLen > 255 {
-		log.Printf("无效的地址长度: %d", addressLen)
+	if addressLen == 0 {
+		// 长度为 0 表示控制指令，后面紧跟 1 字节指令码
+		handleControl(stream, state, sl)
+		return
+	}
+	handleTCPv0(stream, state, sl, addressLen, false)
+}
+
+// handleTCPv0 处理版本 0 的 TCP 转发请求：读取 "host:port" 字符串后转发
+// addressLen: 已读取的地址长度；compressed 为 true 时流上的数据使用压缩帧（见 pkg/compress）
+func handleTCPv0(stream quic.Stream, state *connState, sl streamLog, addressLen int, compressed bool) {
+	targetAddress, err := target.ReadV0(stream, addressLen)
+	if err != nil {
+		log.Printf("读取目标地址失败: %v", err)
 		stream.Write([]byte{0x01}) // 失败信号
 		return
 	}
+	handleTCP(stream, state, sl, targetAddress, compressed, 0)
+}
 
-	// 读取 N 个字节（目标地址字符串）
-	addressBuf := make([]byte, addressLen)
-	_, err = io.ReadFull(stream, addressBuf)
+// handleTargetTCP 处理版本 1 的 TCP 转发请求 (opTCPConnect)
+// 请求: 结构化目标（地址类型 + 地址 + 端口 + 标志，见 pkg/target）；响应与版本 0 相同
+func handleTargetTCP(stream quic.Stream, state *connState, sl streamLog) {
+	t, err := target.Read(stream)
 	if err != nil {
 		log.Printf("读取目标地址失败: %v", err)
 		stream.Write([]byte{0x01}) // 失败信号
 		return
 	}
+	compressed := t.Flags&target.FlagCompress != 0
+	if compressed && !compressionEnabled {
+		log.Printf("[QUIC TCP] 压缩未启用，拒绝压缩转发请求")
+		stream.Write([]byte{0x01}) // 失败信号
+		return
+	}
+	handleTCP(stream, state, sl, t.String(), compressed, t.Flags)
+}
 
-	targetAddress := string(addressBuf)
-	log.Printf("[QUIC TCP] 请求连接: %s", targetAddress)
+// handleTCP 连接目标地址并双向转发
+// compressed 为 true 时流上的数据使用压缩帧（见 pkg/compress）；flags 为版本 1 请求携带的标志（版本 0 为 0）
+func handleTCP(stream quic.Stream, state *connState, sl streamLog, targetAddress string, compressed bool, flags target.Flags) {
+	if class := trafficClass(flags); class != "" {
+		sl.Printf("[QUIC TCP] 请求连接: %s (%s)", targetAddress, class)
+	} else {
+		sl.Printf("[QUIC TCP] 请求连接: %s", targetAddress)
+	}
 
-	// 连接目标：使用 net.Dial("tcp", target_address) 连接目标网站
-	targetConn, err := net.Dial("tcp", targetAddress)
+	// 连接目标（配置了出口 IP 池时绑定池中的源地址；明文 HTTP 端口优先复用同一用户的空闲连接，见 upstreampool.go）
+	poolKey := upstreamPool.poolKey(state, targetAddress, flags)
+	targetConn, dialTime, reused, err := dialPooled(poolKey, targetAddress, flags)
 	if err != nil {
 		log.Printf("连接目标失败 %s: %v", targetAddress, err)
-		stream.Write([]byte{0x01}) // 失败信号
+		stream.Write([]byte{dialStatus(err)}) // 失败信号（区分拒绝连接与不可达，客户端据此暂停重试）
 		return
 	}
-	defer targetConn.Close()
+	if reused {
+		sl.Printf("[QUIC TCP] 复用上游连接: %s", targetAddress)
+	}
+	keep := false // 连接放回复用池时不关闭
+	defer func() {
+		if keep {
+			upstreamPool.put(poolKey, targetConn, dialTime)
+		} else {
+			targetConn.Close()
+		}
+	}()
 
 	// 连接成功，向流写入 0x00 (成功信号)
 	_, err = stream.Write([]byte{0x00})
@@ -230,106 +538,246 @@ func handleStream(stream quic.Stream) {
 		return
 	}
 
-	// 双向转发：使用缓冲池复用的 copyBuffer
+	// 双向转发：使用缓冲池复用的 copyBuffer（流量按压缩前的字节数统计）
+	// 下行按流优先级写入（见 qos.go）
+	var src io.Reader = stream
+	var dst io.Writer = priorityWriter(state, stream, flags)
+	if compressed {
+		src = compress.NewReader(stream)
+		dst = compress.NewWriter(dst)
+	}
+	// 按流量类型应用策略（大流量限速、游戏流量 DSCP，见 qos.go）
+	up, down := applyTCPClass(flags, targetConn, targetConn, dst)
+	if poolKey != "" {
+		r := &pooledRelay{targetConn: targetConn}
+		keep = r.relay(src, countingWriter{up, &state.bytesUp}, countingWriter{down, &state.bytesDown})
+		if keep {
+			r.wg.Wait() // 两个方向都在报文边界结束，连接放回连接池，不打断
+		} else {
+			relay.Stop(r.wg.Wait, stream, targetConn)
+		}
+		sl.Printf("[QUIC TCP] 连接 %s 已关闭", targetAddress)
+		return
+	}
 	errChan := make(chan error, 2)
 
 	// 从 QUIC 流复制到目标连接
 	go func() {
-		_, err := copyBuffer(targetConn, stream)
+		_, err := copyBuffer(countingWriter{up, &state.bytesUp}, src)
 		errChan <- err
 	}()
 
 	// 从目标连接复制到 QUIC 流
 	go func() {
-		_, err := copyBuffer(stream, targetConn)
+		_, err := copyBuffer(countingWriter{down, &state.bytesDown}, targetConn)
 		errChan <- err
 	}()
 
-	// 等待任一方向完成
+	// 等待任一方向完成，再打断另一方向并等它退出（见 relay.Stop）
 	<-errChan
-	log.Printf("[QUIC TCP] 连接 %s 已关闭", targetAddress)
+	relay.Stop(func() { <-errChan }, stream, targetConn)
+	sl.Printf("[QUIC TCP] 连接 %s 已关闭", targetAddress)
 }
 
-// verifyToken 验证客户端 JWT Token
+// 流控制指令码（地址长度字节为 0 时读取）
+const (
+	opSpeedTest  byte = 0x01 // 隧道内测速
+	opUDPStream  byte = 0x02 // UDP over Stream（Datagram 不可用时的回退通道）
+	opPing       byte = 0x03 // 隧道验证（回显 nonce）
+	opHello      byte = 0x04 // 能力协商
+	opTCPDeflate byte = 0x05 // 压缩的 TCP 转发
+	opTCPConnect byte = 0x06 // TCP 转发（版本 1：结构化目标，见 pkg/target）
+	opWarmup     byte = 0x07 // 预热请求
+)
+
+// handleControl 处理流控制指令
+func handleControl(stream quic.Stream, state *connState, sl streamLog) {
+	opBuf := make([]byte, 1)
+	if _, err := io.ReadFull(stream, opBuf); err != nil {
+		log.Printf("读取控制指令失败: %v", err)
+		return
+	}
+
+	switch opBuf[0] {
+	case opSpeedTest:
+		handleSpeedTest(stream)
+	case opUDPStream:
+		handleUDPStream(stream, state, sl)
+	case opPing:
+		handlePing(stream)
+	case opHello:
+		handleHello(stream, state)
+	case opTCPDeflate:
+		handleCompressedTCP(stream, state, sl)
+	case opTCPConnect:
+		handleTargetTCP(stream, state, sl)
+	case opWarmup:
+		handleWarmup(stream, state)
+	default:
+		log.Printf("未知的控制指令: 0x%02x", opBuf[0])
+		stream.Write([]byte{0x01}) // 失败信号
+	}
+}
+
+// pingNonceSize 隧道验证 nonce 长度
+const pingNonceSize = 8
+
+// handlePing 处理隧道验证指令
+// 请求: nonce (8 字节)
+// 响应: 0x00 + 原样回显 nonce
+func handlePing(stream quic.Stream) {
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	nonce := make([]byte, pingNonceSize)
+	if _, err := io.ReadFull(stream, nonce); err != nil {
+		log.Printf("[Ping] 读取 nonce 失败: %v", err)
+		return
+	}
+	stream.Write(append([]byte{0x00}, nonce...))
+}
+
+// maxAuthLineLen 鉴权行最大长度（不含换行符），票据 + 签名握手 + PSK 证明也远小于该值
+const maxAuthLineLen = 4096
+
+// errAuthLineTooLong 超过 maxAuthLineLen 仍未读到换行
+var errAuthLineTooLong = errors.New("鉴权行超过最大长度")
+
+// readAuthLine 读取鉴权行，格式为 "<凭证>\n"（兼容 "\r\n"），凭证前后的空格和制表符被忽略
+// 逐字节读取，不会多读换行之后的数据；读满 maxAuthLineLen 仍没有换行时立即返回错误，不再继续读取
+func readAuthLine(r io.Reader) (string, error) {
+	line := make([]byte, 0, 512)
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.Trim(strings.TrimSuffix(string(line), "\r"), " \t"), nil
+		}
+		if len(line) == maxAuthLineLen {
+			return "", errAuthLineTooLong
+		}
+		line = append(line, b[0])
+	}
+}
+
+// verifyToken 验证客户端 JWT Token 或连接票据
 // 如果 Token 验证成功：回复 0x00，继续后续逻辑
 // 如果 Token 验证失败：延迟后回复随机 HTML，伪装成网页服务器
-func verifyToken(stream quic.Stream) bool {
+func verifyToken(stream quic.Stream, state *connState) bool {
 	// 设置读取超时
 	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
 
-	// 读取 Token（字符串 + 换行符）
-	reader := bufio.NewReader(stream)
-	tokenString, err := reader.ReadString('\n')
+	// 读取鉴权行（长度有上限，防止不带换行的超长数据占用内存）
+	tokenString, err := readAuthLine(stream)
 	if err != nil {
-		// 读取失败，可能是探测
+		// 读取失败或超长，可能是探测
 		log.Printf("[鉴权] 读取 Token 失败: %v", err)
-		handleInvalidToken(stream)
+		handleInvalidToken(stream, state)
 		return false
 	}
 
-	// 去除换行符
-	tokenString = strings.TrimSpace(tokenString)
+	// 启用 PSK 时先校验鉴权行开头的 PSK 证明，不匹配直接进入伪装模式
+	// 鉴权行中的凭证不写入日志，只记录指纹（config.Fingerprint）
+	if preSharedKey != "" {
+		authLine := tokenString
+		var ok bool
+		if tokenString, ok = psk.Open(preSharedKey, tokenString); !ok {
+			log.Printf("[鉴权] PSK 校验失败 (鉴权行 %s)", config.Fingerprint(authLine))
+			handleInvalidToken(stream, state)
+			return false
+		}
+	}
+
+	// 本连接已验证过的票据：直接放行（票据过期后同一连接上的新流仍可使用）
+	if userUUID, ok := state.acceptedTicket(tokenString); ok {
+		return sendAuthOK(stream, state, userUUID)
+	}
+
+	// 签名握手时鉴权行为 "<票据> <时间戳>:<钱包签名>"
+	jwtString, proof, _ := strings.Cut(tokenString, " ")
 
 	// 解析并验证 JWT Token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名算法必须是 EdDSA (Ed25519)
-		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtPublicKey, nil
-	})
+	token, err := jwt.Parse(jwtString, jwtKeys.keyfunc)
 
 	if err != nil {
 		// JWT 验证失败
-		log.Printf("[鉴权] JWT 验证失败: %v", err)
-		handleInvalidToken(stream)
+		log.Printf("[鉴权] JWT %s 验证失败: %v", config.Fingerprint(jwtString), err)
+		handleInvalidToken(stream, state)
 		return false
 	}
 
 	if !token.Valid {
 		// Token 无效
-		log.Printf("[鉴权] JWT Token 无效")
-		handleInvalidToken(stream)
+		log.Printf("[鉴权] JWT %s 无效", config.Fingerprint(jwtString))
+		handleInvalidToken(stream, state)
 		return false
 	}
 
 	// 提取用户 UUID
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		log.Printf("[鉴权] 无法解析 JWT Claims")
-		handleInvalidToken(stream)
+		log.Printf("[鉴权] 无法解析 JWT %s 的 Claims", config.Fingerprint(jwtString))
+		handleInvalidToken(stream, state)
 		return false
 	}
 
 	userUUID, ok := claims["uuid"].(string)
 	if !ok {
-		log.Printf("[鉴权] JWT Claims 中缺少 uuid 字段")
-		handleInvalidToken(stream)
+		log.Printf("[鉴权] JWT %s 的 Claims 中缺少 uuid 字段", config.Fingerprint(jwtString))
+		handleInvalidToken(stream, state)
+		return false
+	}
+
+	// 连接票据：校验节点绑定和一次性；长期 JWT：仅在未启用 -require-ticket 时接受
+	if typ, _ := claims["typ"].(string); typ == "connect" {
+		if err := verifyTicketClaims(claims, proof, state); err != nil {
+			log.Printf("[鉴权] 连接票据 %s 无效: %v", config.Fingerprint(jwtString), err)
+			handleInvalidToken(stream, state)
+			return false
+		}
+		state.acceptTicket(tokenString)
+	} else if requireTicket {
+		log.Printf("[鉴权] 已启用 -require-ticket，拒绝长期 JWT %s", config.Fingerprint(jwtString))
+		handleInvalidToken(stream, state)
 		return false
 	}
 
-	// 验证成功：回复 0x00，继续后续逻辑
+	return sendAuthOK(stream, state, userUUID)
+}
+
+// sendAuthOK 验证成功：记录会话用户，回复 0x00，继续后续逻辑
+func sendAuthOK(stream quic.Stream, state *connState, userUUID string) bool {
+	first := state.authenticated(userUUID)
+
 	stream.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	_, err = stream.Write([]byte{0x00})
+	_, err := stream.Write([]byte{0x00})
 	if err != nil {
 		log.Printf("[鉴权] 发送验证成功信号失败: %v", err)
 		return false
 	}
-	log.Printf("[鉴权] 用户 [%s] 连接成功", userUUID)
+	// 鉴权阶段的读写超时到此为止，否则长连接（TCP 转发 / UDP 流）会在 5 秒后被中断
+	stream.SetDeadline(time.Time{})
+	if first {
+		log.Printf("[鉴权] 用户 [%s] 连接成功", userUUID) // 同一连接上之后的流不再重复记录
+	}
 	return true
 }
 
 // handleInvalidToken 处理无效 Token（防探测）
 // 不要立即断开！使用随机延迟后回复随机 HTML，伪装成网页服务器
-func handleInvalidToken(stream quic.Stream) {
+func handleInvalidToken(stream quic.Stream, state *connState) {
 	// 关键点 (防探测)：如果 Token 不匹配，或者数据格式不对：
 	// 不要立即断开！(立即断开也是特征)
 	// 甚至不要回复错误！
-	// 而是使用 time.Sleep 随机延迟几秒，然后回复一段随机的 HTML 代码（伪装成网页服务器报错），最后关闭连接
+	// 而是随机延迟几秒，然后回复一段随机的 HTML 代码（伪装成网页服务器报错），最后关闭连接
+	probeCount.Add(1) // 随会话上报发送给 uap-admin，短时间内大量失败时告警
+	recordAuthFailure(remoteIP(state.conn.RemoteAddr()))
 
-	// 随机延迟 2-5 秒
+	// 随机延迟 2-5 秒；平滑升级交接或开始排空后不再拖延，直接结束，排空不必等探测者
 	delay := time.Duration(2+rand.Intn(3)) * time.Second
-	time.Sleep(delay)
+	if !decoyDelay(stream, delay) {
+		return
+	}
 
 	// 回复随机的 HTML 代码（伪装成网页服务器报错）
 	htmlResponses := []string{
@@ -343,44 +791,128 @@ func handleInvalidToken(stream quic.Stream) {
 	stream.SetWriteDeadline(time.Now().Add(5 * time.Second))
 	stream.Write([]byte(response))
 
-	// 最后关闭连接
-	time.Sleep(100 * time.Millisecond)
+	// 稍等回复发出后关闭连接（同样可被交接与排空打断）
+	decoyDelay(stream, 100*time.Millisecond)
+}
+
+// decoyDelay 伪装回复前后的延迟：等待 d，期间流已结束（对端断开）、开始排空（维护模式或交接后，见 drainSessions）
+// 或本进程已交接给新进程时提前返回 false
+func decoyDelay(stream quic.Stream, d time.Duration) bool {
+	drain := drainStarted()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stream.Context().Done():
+		return false
+	case <-drain:
+		return false
+	case <-handedOff:
+		return false
+	}
 }
 
 // handleDatagrams 处理来自客户端的 QUIC Datagram（UDP 数据包）
 // 这个函数包含两个循环：
 // 1. 接收循环：从 QUIC 接收 Datagram，解析 SOCKS5 头部，转发到目标服务器
 // 2. 发送循环：从 UDP Socket 接收回包，封装 SOCKS5 头部，发送回客户端
-func handleDatagrams(conn quic.Connection) {
+func handleDatagrams(conn quic.Connection, state *connState) {
 	log.Printf("[UDP] 启动 Datagram 处理")
 
-	// 创建 UDP 出口：在 handleDatagrams 开始时，创建一个 net.ListenUDP("udp", nil)，这是该用户的专用出口
-	udpConn, err := net.ListenUDP("udp", nil)
+	guard := newAmpGuard("[UDP]")
+
+	// 转告目标返回的 ICMP 不可达（见 udpunreach.go）
+	sendUnreachable := func(udpConn *net.UDPConn) {
+		for _, reply := range unreachableReplies(udpConn, state) {
+			conn.SendDatagram(reply)
+		}
+	}
+
+	// 接收流程 (Target -> Server -> Client)：每个 UDP 出口 Socket 一个 goroutine 负责读取回包
+	readReplies := func(udpConn *net.UDPConn) {
+		log.Printf("[UDP] 启动接收流程 (Target -> Server -> Client): %s", udpConn.LocalAddr())
+
+		buffer := make([]byte, 65535)
+		for {
+			// 循环读取 UDP Socket
+			n, sourceAddr, err := udpConn.ReadFromUDP(buffer)
+			if err != nil {
+				if isUnreachable(err) {
+					sendUnreachable(udpConn)
+					continue
+				}
+				// 如果 UDP Socket 关闭（或转入出口租约），退出循环
+				if err == io.EOF || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
+					return
+				}
+				log.Printf("[UDP] 读取 UDP 数据失败: %v", err)
+				continue
+			}
+
+			if n > 0 {
+				data := buffer[:n]
+				if state.verbose() {
+					log.Printf("[UDP] 收到来自 %s 的回包，长度: %d", sourceAddr, n)
+				}
+				if !guard.allowReply(sourceAddr, n) {
+					continue
+				}
+
+				// 封装 SOCKS5 头部（关键）
+				// 为了简化，可以硬编码 ATYP=0x01, IP=0.0.0.0, Port=0
+				// 或者正确填入源地址
+				socks5Packet := buildSOCKS5UDPHeader(sourceAddr, data)
+
+				if state.verbose() {
+					log.Printf("[UDP] 构建 SOCKS5 数据包，总长度: %d", len(socks5Packet))
+				}
+
+				// 调用 conn.SendDatagram 发回给客户端
+				err = conn.SendDatagram(socks5Packet)
+				if err != nil {
+					log.Printf("[UDP] 发送 Datagram 到客户端失败: %v", err)
+					continue
+				}
+
+				state.bytesDown.Add(int64(n))
+				if state.verbose() {
+					log.Printf("[UDP] 已转发回包给客户端")
+				}
+			}
+		}
+	}
+
+	// 创建 UDP 出口：在 handleDatagrams 开始时创建，这是该连接的专用出口（出口 IP 池按客户端 IP 选择源地址）
+	udpConn, err := listenEgressUDP(remoteIP(conn.RemoteAddr()), state.user, readReplies)
 	if err != nil {
 		log.Printf("[UDP] 创建 UDP Socket 失败: %v", err)
 		return
 	}
 	defer udpConn.Close()
+	udpConn.unreachable = sendUnreachable
 
 	log.Printf("[UDP] 已创建 UDP 出口: %s", udpConn.LocalAddr())
 
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(1)
 
 	// 发送流程 (Client -> Server -> Target)：循环读取 sess.ReceiveDatagram
 	go func() {
 		defer wg.Done()
+		// 连接关闭后关闭 UDP 出口，让接收流程的 ReadFromUDP 返回
+		defer udpConn.Close()
 		log.Printf("[UDP] 启动发送流程 (Client -> Server -> Target)")
 
 		for {
 			// 循环调用 conn.ReceiveDatagram()
 			data, err := conn.ReceiveDatagram(context.Background())
 			if err != nil {
-				log.Printf("[UDP] 接收 Datagram 失败: %v", err)
-				// 如果连接关闭，退出循环
-				if err == io.EOF || err == context.Canceled {
+				// 如果连接关闭，退出循环（否则 handleConnection 无法返回，会话不会注销）
+				if err == io.EOF || err == context.Canceled || conn.Context().Err() != nil {
 					return
 				}
+				log.Printf("[UDP] 接收 Datagram 失败: %v", err)
 				continue
 			}
 
@@ -388,71 +920,47 @@ func handleDatagrams(conn quic.Connection) {
 				continue
 			}
 
-			log.Printf("[UDP] 收到 Datagram，长度: %d", len(data))
+			if state.verbose() {
+				log.Printf("[UDP] 收到 Datagram，长度: %d", len(data))
+			}
 
 			// 解析 SOCKS5 头部（关键）
 			// SOCKS5 UDP 数据包格式: RSV(2) + FRAG(1) + ATYP(1) + DST.ADDR(variable) + DST.PORT(2) + DATA(variable)
 			targetAddr, payload, err := parseSOCKS5UDPHeader(data)
 			if err != nil {
-				log.Printf("[UDP] 解析 SOCKS5 头部失败: %v", err)
+				var resolveErr *resolveError
+				if !errors.As(err, &resolveErr) {
+					log.Printf("[UDP] 解析 SOCKS5 头部失败: %v", err)
+					continue
+				}
+				if reply := handleResolveFailure("[UDP]", resolveErr); reply != nil {
+					conn.SendDatagram(reply)
+				}
 				continue
 			}
 
-			// 日志：打印 [UDP] 转发 N 字节到 目标地址
-			log.Printf("[UDP] 转发 %d 字节到 %s", len(payload), targetAddr)
-
-			// 使用刚才创建的 UDP Socket，只把 payload 发送给目标地址
-			_, err = udpConn.WriteToUDP(payload, targetAddr)
-			if err != nil {
-				log.Printf("[UDP] 发送 UDP 数据包失败: %v", err)
+			if !guard.allowSend(targetAddr, len(payload)) {
 				continue
 			}
-		}
-	}()
 
-	// 接收流程 (Target -> Server -> Client)：启动一个 goroutine 负责读取回包
-	go func() {
-		defer wg.Done()
-		log.Printf("[UDP] 启动接收流程 (Target -> Server -> Client)")
+			// 日志：打印 [UDP] 转发 N 字节到 目标地址
+			if state.verbose() {
+				log.Printf("[UDP] 转发 %d 字节到 %s", len(payload), targetAddr)
+			}
 
-		buffer := make([]byte, 65535)
-		for {
-			// 循环读取 UDP Socket
-			n, sourceAddr, err := udpConn.ReadFromUDP(buffer)
+			// 使用刚才创建的 UDP Socket，只把 payload 发送给目标地址
+			n, err := udpConn.WriteToUDP(payload, targetAddr, target.Flags(data[0]))
 			if err != nil {
-				log.Printf("[UDP] 读取 UDP 数据失败: %v", err)
-				// 如果 UDP Socket 关闭，退出循环
-				if err == io.EOF {
-					return
-				}
+				log.Printf("[UDP] 发送 UDP 数据包失败: %v", err)
 				continue
 			}
-
-			if n > 0 {
-				data := buffer[:n]
-				log.Printf("[UDP] 收到来自 %s 的回包，长度: %d", sourceAddr, n)
-
-				// 封装 SOCKS5 头部（关键）
-				// 为了简化，可以硬编码 ATYP=0x01, IP=0.0.0.0, Port=0
-				// 或者正确填入源地址
-				socks5Packet := buildSOCKS5UDPHeader(sourceAddr, data)
-
-				log.Printf("[UDP] 构建 SOCKS5 数据包，总长度: %d", len(socks5Packet))
-
-				// 调用 conn.SendDatagram 发回给客户端
-				err = conn.SendDatagram(socks5Packet)
-				if err != nil {
-					log.Printf("[UDP] 发送 Datagram 到客户端失败: %v", err)
-					continue
-				}
-
-				log.Printf("[UDP] 已转发回包给客户端")
-			}
+			state.bytesUp.Add(int64(n))
 		}
 	}()
 
-	// 等待两个循环完成
+	// 等待发送流程与所有接收流程完成
 	wg.Wait()
+	udpConn.Wait()
 	log.Printf("[UDP] Datagram 处理已停止")
 }
 
@@ -502,11 +1010,20 @@ func parseSOCKS5UDPHeader(data []byte) (*net.UDPAddr, []byte, error) {
 			return nil, nil, fmt.Errorf("Domain 数据包太短，需要至少 %d 字节，实际: %d", 7+domainLen, len(data))
 		}
 		domain := string(data[5 : 5+domainLen])
+		if err := target.CheckHost(domain); err != nil {
+			return nil, nil, err
+		}
 		port := binary.BigEndian.Uint16(data[5+domainLen : 7+domainLen])
 		// 解析域名
 		ip, err := net.ResolveIPAddr("ip", domain)
 		if err != nil {
-			return nil, nil, fmt.Errorf("解析域名失败 %s: %v", domain, err)
+			return nil, nil, &resolveError{
+				domain: domain,
+				port:   port,
+				header: data[:7+domainLen],
+				query:  data[7+domainLen:],
+				err:    err,
+			}
 		}
 		targetAddr = &net.UDPAddr{IP: ip.IP, Port: int(port)}
 		dataStart = 7 + domainLen
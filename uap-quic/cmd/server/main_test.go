@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quic-go/quic-go"
+)
+
+// 测试节点使用的证书与鉴权密钥（TestMain 中生成）
+var (
+	testCert     tls.Certificate
+	testJWTKey   ed25519.PrivateKey
+	testJWTToken string // 用户 test-user 的 JWT
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	if dir := os.Getenv(handoffTestEnv); dir != "" && os.Getenv(handoffEnv) != "" {
+		runHandoffChild(dir) // 平滑升级测试启动的新进程（见 handoff_test.go）
+	}
+
+	dir, err := os.MkdirTemp("", "uap-server-test")
+	if err != nil {
+		panic(err)
+	}
+	// 客户端按系统根证书校验节点证书：把测试证书作为唯一的根证书（必须在第一次校验证书之前设置）
+	var certPEM []byte
+	testCert, certPEM = generateTestCert()
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		panic(err)
+	}
+	os.Setenv("SSL_CERT_FILE", certFile)
+	os.Setenv("SSL_CERT_DIR", dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	testJWTKey = priv
+	jwtKeys = newJWTKeySet("", pub)
+	testJWTToken = signTestToken("test-user", time.Hour)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// generateTestCert 生成包含 core.ServerName 的自签名证书
+func generateTestCert() (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: core.ServerName},
+		DNSNames:              []string{core.ServerName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// signTestToken 用测试密钥为 userUUID 签发 JWT
+func signTestToken(userUUID string, ttl time.Duration) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"uuid": userUUID,
+		"exp":  time.Now().Add(ttl).Unix(),
+	})
+	s, err := token.SignedString(testJWTKey)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// testNode 进程内的测试节点（与自检相同的方式：本机临时端口 + handleConnection）
+type testNode struct {
+	listener *quic.Listener
+	udpConn  *net.UDPConn
+	addr     string
+}
+
+// testQUICConfig 测试节点的 QUIC 配置
+func testQUICConfig() *quic.Config {
+	return &quic.Config{
+		EnableDatagrams:       true,
+		MaxIdleTimeout:        30 * time.Second,
+		KeepAlivePeriod:       core.KeepAlivePeriod(30 * time.Second),
+		MaxIncomingStreams:    5000,
+		MaxIncomingUniStreams: 5000,
+	}
+}
+
+// startTestNode 在本机临时端口启动节点，测试结束时关闭
+func startTestNode(t testing.TB) *testNode {
+	t.Helper()
+	return startTestNodeWithConfig(t, testQUICConfig())
+}
+
+// startTestNodeWithConfig 使用指定的 QUIC 配置启动测试节点
+func startTestNodeWithConfig(t testing.TB, quicConfig *quic.Config) *testNode {
+	t.Helper()
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{testCert}, NextProtos: []string{serverALPN()}}
+	listener, udpConn, err := listenQUIC("127.0.0.1:0", tlsConfig, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &testNode{listener: listener, udpConn: udpConn, addr: listener.Addr().String()}
+	// 关闭时等待连接处理结束，之后测试恢复的全局配置不会与节点的处理流程并发访问
+	var handlers sync.WaitGroup
+	handlers.Add(1)
+	go func() {
+		defer handlers.Done()
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			if refuseInMaintenance(conn) { // 与 main 的接受循环一致
+				continue
+			}
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				handleConnection(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		udpConn.Close() // 关闭底层 Socket，已建立的连接随之关闭
+		handlers.Wait()
+	})
+	return n
+}
+
+// newClient 创建连接到节点的客户端（未连接），测试结束时停止
+func (n *testNode) newClient(t testing.TB) *core.Client {
+	t.Helper()
+	return n.newClientOnPort(t, 0)
+}
+
+// newClientOnPort 创建 SOCKS5 监听在本机 port 端口的客户端（Start 后生效）
+func (n *testNode) newClientOnPort(t testing.TB, port int) *core.Client {
+	t.Helper()
+	client := core.NewClient(n.addr, testJWTToken, port, core.ModeGlobal)
+	client.SetPSK(preSharedKey)
+	client.SetTrusted(trustedMode)
+	t.Cleanup(client.Stop)
+	return client
+}
+
+// connect 创建客户端并完成握手与鉴权
+func (n *testNode) connect(t testing.TB) *core.Client {
+	t.Helper()
+	client := n.newClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("连接测试节点失败: %v", err)
+	}
+	return client
+}
+
+// dialRaw 不经过 core 客户端直接与节点握手，用于构造非常规的鉴权行
+func (n *testNode) dialRaw(t testing.TB) quic.Connection {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, n.addr, &tls.Config{
+		ServerName: core.ServerName,
+		NextProtos: []string{serverALPN()},
+		MinVersion: tls.VersionTLS13,
+	}, testQUICConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseWithError(0, "") })
+	return conn
+}
+
+// openAuthedStream 在 dialRaw 建立的连接上开流并用测试 JWT 完成鉴权
+func openAuthedStream(t testing.TB, conn quic.Connection) quic.Stream {
+	t.Helper()
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := stream.Write([]byte(testJWTToken + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
+		t.Fatalf("鉴权失败: %v %v", status, err)
+	}
+	return stream
+}
+
+// startEchoServer 本机 TCP 回显服务，返回地址
+func startEchoServer(t testing.TB) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestNodeEcho(t *testing.T) {
+	client := startTestNode(t).connect(t)
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatalf("TCP 回显: %v", err)
+	}
+	if _, err := udpEcho(client); err != nil {
+		t.Fatalf("UDP 回显: %v", err)
+	}
+}
+
+func TestConnectAuthRejected(t *testing.T) {
+	n := startTestNode(t)
+	client := core.NewClient(n.addr, signTestToken("test-user", -time.Minute), 0, core.ModeGlobal)
+	client.SetPSK(preSharedKey)
+	client.SetTrusted(trustedMode)
+	t.Cleanup(client.Stop)
+
+	// 过期 token：握手成功但节点拒绝鉴权（进入伪装模式），Connect 返回 ErrAuthRejected 而不是超时
+	ctx, cancel := context.WithTimeout(context.Background(), core.DefaultVerifyTimeout)
+	defer cancel()
+	if err := client.Connect(ctx); !errors.Is(err, core.ErrAuthRejected) {
+		t.Fatalf("鉴权被拒时返回 %v", err)
+	}
+	if f := client.NodeFailure(n.addr); f == nil || f.Reason != core.NodeFailAuth {
+		t.Fatalf("鉴权被拒的节点失败记录 %+v", f)
+	}
+}
+
+// TestNodeFailureRecovered 信任模式不一致时记录 alpn，改正后连接并鉴权成功即清除记录
+func TestNodeFailureRecovered(t *testing.T) {
+	n := startTestNode(t)
+	client := n.newClient(t)
+	client.SetTrusted(!trustedMode)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err == nil {
+		t.Fatal("信任模式不一致时连接成功")
+	}
+	if f := client.NodeFailure(n.addr); f == nil || f.Reason != core.NodeFailALPN {
+		t.Fatalf("信任模式不一致的节点失败记录 %+v", f)
+	}
+
+	client.SetTrusted(trustedMode)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if f := client.NodeFailure(n.addr); f != nil || len(client.GetStats(0).NodeFailures) != 0 {
+		t.Fatalf("恢复后仍有节点失败记录 %+v", f)
+	}
+}
+
+// TestHandshakeTime 握手耗时在连接成功后记录（鉴权被拒也记录：客户端上报给管理后台的是节点可达性），之前为 0
+func TestHandshakeTime(t *testing.T) {
+	n := startTestNode(t)
+	client := n.newClient(t)
+	if d := client.HandshakeTime(); d != 0 {
+		t.Fatalf("连接前握手耗时 %v", d)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := client.HandshakeTime(); d <= 0 || d > time.Since(start) {
+		t.Fatalf("握手耗时 %v（连接共耗时 %v）", d, time.Since(start))
+	}
+
+	rejected := core.NewClient(n.addr, signTestToken("test-user", -time.Minute), 0, core.ModeGlobal)
+	rejected.SetPSK(preSharedKey)
+	rejected.SetTrusted(trustedMode)
+	t.Cleanup(rejected.Stop)
+	if err := rejected.Connect(ctx); !errors.Is(err, core.ErrAuthRejected) {
+		t.Fatalf("鉴权被拒时返回 %v", err)
+	}
+	if rejected.HandshakeTime() <= 0 {
+		t.Fatal("鉴权被拒时没有记录握手耗时")
+	}
+}
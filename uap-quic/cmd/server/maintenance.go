@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// maintenance 维护模式（滚动发布时排空节点）：拒绝新连接，已有连接照常转发
+var maintenance struct {
+	enabled atomic.Bool
+	since   atomic.Int64 // 进入维护模式的时间（Unix 秒）
+}
+
+// maintenanceStatus 维护模式接口的响应
+type maintenanceStatus struct {
+	Maintenance bool  `json:"maintenance"`
+	Since       int64 `json:"since,omitempty"` // 进入维护模式的时间（Unix 秒）
+	Sessions    int   `json:"sessions"`        // 仍在转发的已鉴权连接数，降到 0 后可以安全停止进程
+}
+
+// setMaintenance 开启/关闭维护模式，状态变化时立即向 uap-admin 上报（节点列表不再下发该节点）
+// drain 为 true 时同时通知已有连接换连（与达到最长时长相同的排空流程），否则等客户端自行断开
+func setMaintenance(enabled, drain bool) {
+	if maintenance.enabled.Swap(enabled) != enabled {
+		if enabled {
+			maintenance.since.Store(time.Now().Unix())
+			log.Printf("🚧 已进入维护模式：拒绝新连接，已有 %d 条连接继续转发", sessionCount())
+		} else {
+			maintenance.since.Store(0)
+			log.Printf("✅ 已退出维护模式，恢复接受新连接")
+		}
+		triggerReport()
+	}
+	if enabled && drain {
+		n := drainSessions()
+		log.Printf("🚧 维护模式：通知 %d 条连接换连（排空超时 %v）", n, connDrainTimeout)
+	}
+}
+
+// refuseInMaintenance 维护模式下拒绝新连接（已有连接不受影响），返回是否已拒绝
+func refuseInMaintenance(conn quic.Connection) bool {
+	if !maintenance.enabled.Load() {
+		return false
+	}
+	conn.CloseWithError(errCodeExcessiveLoad, "")
+	return true
+}
+
+// drainSignal 每次排空开始时关闭并换新，伪装延迟中的探测流（见 decoyDelay）据此提前结束
+var drainSignal = struct {
+	mu sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// drainStarted 下一次排空开始时关闭的通道
+func drainStarted() <-chan struct{} {
+	drainSignal.mu.Lock()
+	defer drainSignal.mu.Unlock()
+	return drainSignal.ch
+}
+
+// drainSessions 通知所有已鉴权的连接换连（drainConnection 对同一连接只执行一次），返回连接数
+// 同时结束所有伪装延迟，探测者不会拖住排空
+func drainSessions() int {
+	drainSignal.mu.Lock()
+	close(drainSignal.ch)
+	drainSignal.ch = make(chan struct{})
+	drainSignal.mu.Unlock()
+
+	n := 0
+	activeSessions.Range(func(_, value interface{}) bool {
+		state := value.(*connState)
+		go drainConnection(state.conn, state)
+		n++
+		return true
+	})
+	return n
+}
+
+// sessionCount 已鉴权的活跃连接数
+func sessionCount() int {
+	sessions := 0
+	activeSessions.Range(func(_, _ interface{}) bool {
+		sessions++
+		return true
+	})
+	return sessions
+}
+
+// handleMaintenance 维护模式开关
+//
+//	GET    /maintenance            查询状态
+//	POST   /maintenance?drain=1    开启（drain=1 时同时通知已有连接换连）
+//	DELETE /maintenance            关闭
+func handleMaintenance(adminSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdminSecret(w, r, adminSecret) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			drain := r.URL.Query().Get("drain")
+			setMaintenance(true, drain == "1" || drain == "true")
+		case http.MethodDelete:
+			setMaintenance(false, false)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(maintenanceStatus{
+			Maintenance: maintenance.enabled.Load(),
+			Since:       maintenance.since.Load(),
+			Sessions:    sessionCount(),
+		})
+	}
+}
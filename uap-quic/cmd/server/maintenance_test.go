@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// withMaintenance 测试结束时退出维护模式（需在启动测试节点之前调用）
+func withMaintenance(t *testing.T) {
+	t.Cleanup(func() { setMaintenance(false, false) })
+}
+
+// expectRefused 等待节点以 errCodeExcessiveLoad 关闭新连接
+func expectRefused(t *testing.T, conn quic.Connection) {
+	t.Helper()
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("维护模式下新连接未被拒绝")
+	}
+	var appErr *quic.ApplicationError
+	if err := context.Cause(conn.Context()); !errors.As(err, &appErr) || !appErr.Remote || appErr.ErrorCode != errCodeExcessiveLoad {
+		t.Fatalf("连接关闭原因 %v，期望节点以 0x%x 关闭", err, errCodeExcessiveLoad)
+	}
+}
+
+func TestMaintenanceRefusesNewConnections(t *testing.T) {
+	withMaintenance(t)
+	node := startTestNode(t)
+	client := node.connect(t)
+	stream := openEchoStream(t, node.dialRaw(t))
+	defer stream.Close()
+
+	setMaintenance(true, false)
+	expectRefused(t, node.dialRaw(t))
+
+	// 已有连接照常转发：进行中的流与新开的流
+	echoOnce(t, stream, "maintenance")
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatalf("维护模式下已有连接回显失败: %v", err)
+	}
+
+	// 退出维护模式后恢复接受新连接
+	setMaintenance(false, false)
+	echoOnce(t, openEchoStream(t, node.dialRaw(t)), "resumed")
+}
+
+func TestMaintenanceDrain(t *testing.T) {
+	withLifetime(t, 0, 5*time.Second)
+	withMaintenance(t)
+	conn := startTestNode(t).dialRaw(t)
+	stream := openEchoStream(t, conn)
+
+	// drain=1：已鉴权的连接收到换连通知，进行中的流在排空期间照常转发
+	setMaintenance(true, true)
+	expectGoAway(t, conn, 3*time.Second)
+	echoOnce(t, stream, "draining")
+
+	// 再次开启不重复排空同一连接；流结束后以换连关闭码关闭
+	setMaintenance(true, true)
+	stream.Close()
+	stream.CancelRead(0)
+	expectReconnectClose(t, conn, 5*time.Second)
+}
+
+func TestMaintenanceEndpoint(t *testing.T) {
+	withMaintenance(t)
+	srv := httptest.NewServer(handleMaintenance("secret"))
+	defer srv.Close()
+
+	do := func(method, query, secret string) (int, maintenanceStatus) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+query, nil)
+		if secret != "" {
+			req.Header.Set("X-Admin-Secret", secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var status maintenanceStatus
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, status
+	}
+
+	if code, _ := do(http.MethodPost, "", "wrong"); code != http.StatusForbidden || maintenance.enabled.Load() {
+		t.Fatalf("管理员密钥错误返回 %d", code)
+	}
+	if code, _ := do(http.MethodPut, "", "secret"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT 返回 %d", code)
+	}
+	if _, status := do(http.MethodGet, "", "secret"); status.Maintenance || status.Since != 0 {
+		t.Fatalf("初始状态 %+v", status)
+	}
+
+	before := time.Now().Unix()
+	if _, status := do(http.MethodPost, "", "secret"); !status.Maintenance || status.Since < before {
+		t.Fatalf("开启后 %+v", status)
+	}
+	if _, status := do(http.MethodGet, "", "secret"); !status.Maintenance {
+		t.Fatalf("开启后查询 %+v", status)
+	}
+	if _, status := do(http.MethodDelete, "", "secret"); status.Maintenance || status.Since != 0 {
+		t.Fatalf("关闭后 %+v", status)
+	}
+}
+
+func TestMaintenanceHealthAndReport(t *testing.T) {
+	withMaintenance(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveHealth(ln, "", time.Now(), time.Now().Add(time.Hour))
+	defer ln.Close()
+
+	health := func() (int, string) {
+		t.Helper()
+		resp, err := http.Get("http://" + ln.Addr().String() + "/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var h healthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, h.Status
+	}
+
+	// 启用上报时，状态切换立即触发一次上报
+	reportEnabled.Store(true)
+	t.Cleanup(func() {
+		reportEnabled.Store(false)
+		select {
+		case <-reportNow:
+		default:
+		}
+	})
+
+	if code, status := health(); code != http.StatusOK || status != "ok" || buildReport(nil, 0).Draining {
+		t.Fatalf("正常状态 %d %s", code, status)
+	}
+	setMaintenance(true, false)
+	if code, status := health(); code != http.StatusServiceUnavailable || status != "draining" || !buildReport(nil, 0).Draining {
+		t.Fatalf("维护模式 %d %s", code, status)
+	}
+	select {
+	case <-reportNow:
+	default:
+		t.Fatal("进入维护模式时未触发上报")
+	}
+	// 状态未变化时不重复上报
+	setMaintenance(true, false)
+	select {
+	case <-reportNow:
+		t.Fatal("状态未变化时触发了上报")
+	default:
+	}
+	setMaintenance(false, false)
+	if code, status := health(); code != http.StatusOK || status != "ok" {
+		t.Fatalf("退出维护模式后 %d %s", code, status)
+	}
+	select {
+	case <-reportNow:
+	default:
+		t.Fatal("退出维护模式时未触发上报")
+	}
+}
+
+// TestDecoyDelayMaintenanceDrain 维护模式排空时，伪装延迟中的探测流立即结束；未排空时照常延迟
+func TestDecoyDelayMaintenanceDrain(t *testing.T) {
+	withMaintenance(t)
+	node := startTestNode(t)
+	stream := startProbe(t, node)
+	setMaintenance(true, false)
+	stream.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := stream.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("未排空时伪装延迟被打断: %d, %v", n, err)
+	}
+	stream.SetReadDeadline(time.Now().Add(10 * time.Second))
+	setMaintenance(true, true)
+	expectProbeEnded(t, stream)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/target"
+)
+
+// timeoutError 超时的 net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDialStatus(t *testing.T) {
+	_, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", freePort(t)))
+	for name, tc := range map[string]struct {
+		err  error
+		want byte
+	}{
+		"拒绝连接":  {err, target.StatusRefused},
+		"主机不可达": {&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, target.StatusUnreachable},
+		"网络不可达": {&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, target.StatusUnreachable},
+		"超时":    {&net.OpError{Op: "dial", Err: timeoutError{}}, target.StatusUnreachable},
+		"域名解析":  {&net.DNSError{Err: "no such host", Name: "missing.invalid", IsNotFound: true}, target.StatusFailed},
+		"其他":    {errors.New("boom"), target.StatusFailed},
+	} {
+		if got := dialStatus(tc.err); got != tc.want {
+			t.Errorf("%s (%v): 状态 0x%02x，期望 0x%02x", name, tc.err, got, tc.want)
+		}
+	}
+}
+
+// TestTargetCooldown 节点报告目标拒绝连接后，客户端在冷却期内直接失败，目标恢复后第一次成功即清除
+func TestTargetCooldown(t *testing.T) {
+	client := startTestNode(t).connect(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	dial := func() (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return client.DialTCP(ctx, addr)
+	}
+
+	if _, err := dial(); !errors.Is(err, core.ErrTargetUnreachable) || strings.Contains(err.Error(), "冷却中") {
+		t.Fatalf("第一次连接: %v，期望节点报告连接失败", err)
+	}
+	failing := client.GetStats(0).FailingTargets
+	if len(failing) != 1 || failing[0].Target != addr || failing[0].Reason != core.PenaltyRefused || failing[0].Failures != 1 {
+		t.Fatalf("冷却目标 %+v", failing)
+	}
+
+	// 冷却期内在本地失败，不发出请求
+	if _, err := dial(); !errors.Is(err, core.ErrTargetUnreachable) || !strings.Contains(err.Error(), "冷却中") {
+		t.Fatalf("冷却期内连接: %v", err)
+	}
+	if failing := client.GetStats(0).FailingTargets; failing[0].Suppressed != 1 || failing[0].Failures != 1 {
+		t.Fatalf("冷却期内的请求被发往节点 %+v", failing)
+	}
+
+	// 目标恢复，冷却结束后的第一次成功清除冷却
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("端口已被占用: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	time.Sleep(time.Until(failing[0].Until))
+	conn, err := dial()
+	if err != nil {
+		t.Fatalf("冷却结束后连接: %v", err)
+	}
+	defer conn.Close()
+	echoOnce(t, conn, "recovered")
+	if failing := client.GetStats(0).FailingTargets; len(failing) != 0 {
+		t.Fatalf("成功后仍在冷却 %+v", failing)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"uap-quic/pkg/config"
+)
+
+// printConfig 输出合并后的生效配置 (JSON)：每个参数的取值与来源，管理员密钥、PSK 与 TLS 私钥只输出指纹
+// 只读取参数与私钥文件，不加载证书、不监听端口
+func printConfig(keyFile string) error {
+	entries := config.FromFlags(flag.CommandLine, config.Spec{
+		Env:     map[string]string{"admin-secret": "UAP_ADMIN_SECRET", "psk": "UAP_PSK"},
+		Secrets: []string{"admin-secret", "psk"},
+	})
+	delete(entries, "print-config")
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("读取 TLS 私钥失败: %w", err)
+		}
+		entries["tls-key"] = config.Secret(string(data), config.SourceFile)
+	}
+
+	out, err := config.Marshal("uap-server", entries)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/psk"
+)
+
+// withPSK 测试期间为节点设置预共享密钥
+func withPSK(t *testing.T, key string) {
+	old := preSharedKey
+	preSharedKey = key
+	t.Cleanup(func() { preSharedKey = old })
+}
+
+func TestPSKHandshake(t *testing.T) {
+	withPSK(t, "test-psk")
+	client := startTestNode(t).connect(t) // newClient 使用与节点相同的 PSK
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatalf("TCP 回显: %v", err)
+	}
+}
+
+func TestPSKMismatchGetsDecoy(t *testing.T) {
+	withPSK(t, "test-psk")
+	conn := startTestNode(t).dialRaw(t)
+
+	// 有效的 Token，但没有 PSK 证明或使用了错误的 PSK：进入伪装模式，回复网页报错而不是鉴权结果
+	lines := map[string]string{
+		"没有 PSK 证明": testJWTToken,
+		"错误的 PSK":   psk.Seal("wrong-psk", testJWTToken),
+	}
+	errs := make(chan error, len(lines))
+	for name, line := range lines {
+		go func(name, line string) {
+			stream, err := conn.OpenStreamSync(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			stream.SetDeadline(time.Now().Add(10 * time.Second))
+			stream.Write([]byte(line + "\n"))
+			reply := make([]byte, len("HTTP/1.1"))
+			if _, err := io.ReadFull(stream, reply); err != nil {
+				t.Errorf("%s: 读取回复失败: %v", name, err)
+			} else if string(reply) != "HTTP/1.1" {
+				t.Errorf("%s: 回复 %q，期望伪装的网页报错", name, reply)
+			}
+			errs <- nil
+		}(name, line)
+	}
+	for range lines {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
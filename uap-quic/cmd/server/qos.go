@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"uap-quic/pkg/prio"
+	"uap-quic/pkg/target"
+)
+
+// 按流量类型应用的策略（客户端按规则标签在转发请求中携带 FlagBulk / FlagGame，见 pkg/router 的 ParseRule）：
+//   - 大流量 TCP 转发共用一个限速器（-bulk-rate），避免下载挤占同一节点上其他用户的交互流量
+//   - 游戏流量的 UDP 出口与 TCP 目标连接带 DSCP 标记（-game-dscp），不经过大流量限速；
+//     发往客户端方向的节奏由 QUIC 的拥塞控制决定，不另做整形
+//   - 开启 -stream-priority 后，同一条 QUIC 连接上发往客户端的交互流量优先于大流量（见 pkg/prio），
+//     未标记的流下行超过 -bulk-after 后按大流量处理
+var (
+	bulkLimiter    *byteLimiter // 大流量限速器（nil 表示不限速）
+	gameDSCP       int          // 游戏流量的 DSCP 值（0 表示不标记）
+	streamPriority bool         // 下行流优先级
+	bulkAfter      int64        // 未标记的流降为大流量的下行字节数（0 表示不降级）
+)
+
+// maxDSCP DSCP 字段为 6 位
+const maxDSCP = 63
+
+// bulkBurst 大流量限速器的突发量（秒），限速开始前允许的最大积累
+const bulkBurst = 0.1
+
+// minBulkBurstBytes 突发量的下限，至少能放行一次完整的缓冲区写入
+const minBulkBurstBytes = 64 << 10
+
+// configureQoS 按启动参数配置流量类型策略：bulkRate 为大流量总速率 (Mbit/s，0 表示不限速)，dscp 为游戏流量的 DSCP 值，
+// priority 开启下行流优先级，afterKB 为未标记的流降为大流量的下行 KB 数（0 表示不降级）
+func configureQoS(bulkRate float64, dscp int, priority bool, afterKB int) error {
+	if bulkRate < 0 {
+		return fmt.Errorf("大流量限速无效: %v", bulkRate)
+	}
+	if dscp < 0 || dscp > maxDSCP {
+		return fmt.Errorf("DSCP 无效: %d（应为 0-%d）", dscp, maxDSCP)
+	}
+	if afterKB < 0 {
+		return fmt.Errorf("大流量降级阈值无效: %d", afterKB)
+	}
+	if bulkRate > 0 {
+		bulkLimiter = newByteLimiter(bulkRate * 1e6 / 8)
+		log.Printf("✅ 大流量 (tag=bulk) 限速: 共 %.1f Mbit/s", bulkRate)
+	}
+	gameDSCP = dscp
+	if dscp > 0 {
+		log.Printf("✅ 游戏流量 (tag=game) DSCP 标记: %d", dscp)
+	}
+	streamPriority = priority
+	bulkAfter = int64(afterKB) << 10
+	if priority {
+		if bulkAfter > 0 {
+			log.Printf("✅ 下行流优先级: 交互流量优先，单条流超过 %dKB 后按大流量处理", afterKB)
+		} else {
+			log.Printf("✅ 下行流优先级: 交互流量优先（只按 tag=bulk 区分大流量）")
+		}
+	}
+	return nil
+}
+
+// priorityWriter 按转发标志包装写往客户端的方向（未开启 -stream-priority 时原样返回）
+func priorityWriter(state *connState, w io.Writer, flags target.Flags) io.Writer {
+	class := prio.Interactive
+	switch {
+	case flags&target.FlagGame != 0:
+		class = prio.Realtime
+	case flags&target.FlagBulk != 0:
+		class = prio.Bulk
+	}
+	return state.prio.Writer(w, class, bulkAfter)
+}
+
+// trafficClass 转发标志对应的流量类型（日志使用）
+func trafficClass(flags target.Flags) string {
+	switch {
+	case flags&target.FlagGame != 0:
+		return "游戏"
+	case flags&target.FlagBulk != 0:
+		return "大流量"
+	}
+	return ""
+}
+
+// byteLimiter 按字节限速的令牌桶，多个连接共用时按请求顺序排队
+// 令牌可以透支：每次写入先扣除，再等待透支部分补回，大块写入也不会被饿死
+type byteLimiter struct {
+	rate  float64 // 每秒补充的字节数
+	burst float64 // 桶容量（字节）
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newByteLimiter 创建限速器，rate 为每秒字节数
+func newByteLimiter(rate float64) *byteLimiter {
+	burst := rate * bulkBurst
+	if burst < minBulkBurstBytes {
+		burst = minBulkBurstBytes
+	}
+	return &byteLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait 扣除 n 字节的令牌，令牌不足时等待补回
+func (l *byteLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttledWriter 写入前经过限速器的 Writer
+type throttledWriter struct {
+	w io.Writer
+	l *byteLimiter
+}
+
+func (tw throttledWriter) Write(p []byte) (int, error) {
+	tw.l.wait(len(p))
+	return tw.w.Write(p)
+}
+
+// applyTCPClass 按流量类型处理 TCP 转发：游戏流量给目标连接设置 DSCP，大流量的两个方向都经过限速器
+// 返回包装后的上行（写往目标）与下行（写往客户端）Writer
+func applyTCPClass(flags target.Flags, targetConn net.Conn, up, down io.Writer) (io.Writer, io.Writer) {
+	switch {
+	case flags&target.FlagGame != 0:
+		if sc, ok := targetConn.(syscall.Conn); ok && gameDSCP > 0 {
+			if err := setDSCP(sc, gameDSCP); err != nil {
+				log.Printf("[QoS] 设置 DSCP 失败 %s: %v", targetConn.RemoteAddr(), err)
+			}
+		}
+	case flags&target.FlagBulk != 0:
+		if bulkLimiter != nil {
+			up = throttledWriter{up, bulkLimiter}
+			down = throttledWriter{down, bulkLimiter}
+		}
+	}
+	return up, down
+}
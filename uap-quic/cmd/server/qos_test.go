@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/prio"
+	"uap-quic/pkg/router"
+	"uap-quic/pkg/target"
+)
+
+// withQoS 测试期间按启动参数配置流量类型策略（需在启动测试节点之前调用）
+func withQoS(t *testing.T, bulkRate float64, dscp int) {
+	t.Helper()
+	oldLimiter, oldDSCP, oldPriority, oldAfter := bulkLimiter, gameDSCP, streamPriority, bulkAfter
+	t.Cleanup(func() { bulkLimiter, gameDSCP, streamPriority, bulkAfter = oldLimiter, oldDSCP, oldPriority, oldAfter })
+	bulkLimiter = nil
+	if err := configureQoS(bulkRate, dscp, false, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigureQoS(t *testing.T) {
+	for _, tc := range []struct {
+		rate  float64
+		dscp  int
+		after int
+	}{
+		{-1, 0, 0},
+		{0, -1, 0},
+		{0, maxDSCP + 1, 0},
+		{0, 0, -1},
+	} {
+		if err := configureQoS(tc.rate, tc.dscp, false, tc.after); err == nil {
+			t.Errorf("configureQoS(%v, %d, %d) 未返回错误", tc.rate, tc.dscp, tc.after)
+		}
+	}
+
+	withQoS(t, 8, 46)
+	if bulkLimiter == nil || bulkLimiter.rate != 1e6 || gameDSCP != 46 {
+		t.Fatalf("限速 %+v，DSCP %d", bulkLimiter, gameDSCP)
+	}
+	// 不配置时不限速、不标记
+	withQoS(t, 0, 0)
+	if bulkLimiter != nil || gameDSCP != 0 {
+		t.Fatal("默认配置启用了流量类型策略")
+	}
+}
+
+// TestStreamPriorityConfig -stream-priority 为每条连接建立调度器，下行按转发标志分类；未开启时原样写入
+func TestStreamPriorityConfig(t *testing.T) {
+	withQoS(t, 0, 0)
+	var buf bytes.Buffer
+	if state := newConnState(nil); state.prio != nil || priorityWriter(state, &buf, target.FlagBulk) != io.Writer(&buf) {
+		t.Fatal("未开启 -stream-priority 时包装了下行")
+	}
+
+	if err := configureQoS(0, 0, true, 64); err != nil {
+		t.Fatal(err)
+	}
+	if !streamPriority || bulkAfter != 64<<10 {
+		t.Fatalf("下行流优先级 %v，降级阈值 %d", streamPriority, bulkAfter)
+	}
+	state := newConnState(nil)
+	if state.prio == nil {
+		t.Fatal("开启后连接没有调度器")
+	}
+	w := priorityWriter(state, &buf, target.FlagBulk)
+	if w == io.Writer(&buf) {
+		t.Fatal("开启后未包装下行")
+	}
+	data := make([]byte, 3*prio.BulkChunk)
+	if n, err := w.Write(data); n != len(data) || err != nil || buf.Len() != len(data) {
+		t.Fatalf("写入 %d, %v，缓冲 %d 字节", n, err, buf.Len())
+	}
+	// 未标记的流超过阈值后降为大流量
+	down := priorityWriter(state, io.Discard, 0)
+	down.Write(make([]byte, 64<<10))
+	down.Write(make([]byte, 1))
+	if s := state.prio.Stats(); s.Demoted != 1 {
+		t.Fatalf("调度统计 %+v", s)
+	}
+}
+
+func TestByteLimiter(t *testing.T) {
+	// 突发量不小于 minBulkBurstBytes：一次缓冲区写入不需要等待
+	l := newByteLimiter(1 << 20)
+	start := time.Now()
+	l.wait(minBulkBurstBytes)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("突发量内的写入等待了 %v", elapsed)
+	}
+
+	// 令牌用完后按速率等待；大块写入先透支再等待补回，不会被饿死
+	start = time.Now()
+	l.wait(256 << 10)
+	l.wait(64 << 10)
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("透支 320KB（1MB/s）等待了 %v，期望约 312ms", elapsed)
+	}
+}
+
+func TestApplyTCPClass(t *testing.T) {
+	withQoS(t, 8, 0)
+	var up, down bytes.Buffer
+	for _, tc := range []struct {
+		flags     target.Flags
+		throttled bool
+	}{
+		{0, false},
+		{target.FlagBulk, true},
+		{target.FlagGame, false},
+		{target.FlagBulk | target.FlagCompress, true},
+	} {
+		u, d := applyTCPClass(tc.flags, nil, &up, &down)
+		_, upThrottled := u.(throttledWriter)
+		_, downThrottled := d.(throttledWriter)
+		if upThrottled != tc.throttled || downThrottled != tc.throttled {
+			t.Errorf("标志 %#x: 上行限速 %v、下行限速 %v，期望 %v", tc.flags, upThrottled, downThrottled, tc.throttled)
+		}
+	}
+	if trafficClass(target.FlagBulk) != "大流量" || trafficClass(target.FlagGame) != "游戏" || trafficClass(target.FlagCompress) != "" {
+		t.Fatal("流量类型的日志名称错误")
+	}
+}
+
+func TestBulkTagThrottled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("限速传输耗时")
+	}
+	const (
+		rate = 2.0       // Mbit/s，即 250KB/s
+		size = 256 << 10 // 每个方向传输的字节数
+	)
+	withQoS(t, rate, 0)
+	node := startTestNode(t)
+	_, echoPort, _ := net.SplitHostPort(startEchoServer(t))
+	port, _ := strconv.Atoi(echoPort)
+	hosts, err := router.ParseHosts("127.0.0.1 bulk.uap.test plain.uap.test\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 规则给 bulk.uap.test 打上 bulk 标签，客户端随转发请求告知节点
+	socksPort := freePort(t)
+	client := node.newClientOnPort(t, socksPort)
+	if err := client.SetMode(core.ModeSmart); err != nil {
+		t.Fatal(err)
+	}
+	client.SetHosts(hosts)
+	client.SetRules("PROXY,bulk.uap.test,tag=bulk\nplain.uap.test\n")
+	go client.Start("")
+
+	transfer := func(domain string) time.Duration {
+		t.Helper()
+		conn := socksConnect(t, socksPort, domain, port)
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+		data := bytes.Repeat([]byte{0x5A}, size)
+		start := time.Now()
+		go conn.Write(data)
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(conn, buf); err != nil || !bytes.Equal(buf, data) {
+			t.Fatalf("经 %s 回显: %v", domain, err)
+		}
+		return time.Since(start)
+	}
+
+	// 大流量的上下行共用限速器：2×256KB 扣除突发量后按 250KB/s 至少需要约 1.8s
+	plain := transfer("plain.uap.test")
+	bulk := transfer("bulk.uap.test")
+	t.Logf("未标记 %v，大流量 %v", plain, bulk)
+	if bulk < 1200*time.Millisecond {
+		t.Fatalf("大流量传输 %v，未被限速", bulk)
+	}
+	if plain > bulk/3 {
+		t.Fatalf("未标记的传输 %v 被限速（大流量 %v）", plain, bulk)
+	}
+	if stats := client.GetStats(0); stats.Proxy != 2 {
+		t.Fatalf("代理计数 %d，期望 2", stats.Proxy)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startCountingEcho 本机 TCP 回显服务，返回地址与已结束（节点关闭了目标连接）的连接数
+func startCountingEcho(t *testing.T) (string, *atomic.Int64) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed := new(atomic.Int64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer closed.Add(1)
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String(), closed
+}
+
+// TestRelayRapidReconnect 经节点快速建立与断开大量 TCP 转发（含写到一半断开）：每条连接回显的数据完整，
+// 客户端断开后节点打断另一方向、归还缓冲区并关闭目标连接（配合 -race 运行）
+func TestRelayRapidReconnect(t *testing.T) {
+	client := startTestNode(t).connect(t)
+	target, closed := startCountingEcho(t)
+
+	const workers, rounds = 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < rounds; i++ {
+				if err := func() error {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					conn, err := client.DialTCP(ctx, target)
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+					conn.SetDeadline(time.Now().Add(10 * time.Second))
+					// 超过一个缓冲区（32KB），每条连接的内容不同
+					payload := make([]byte, 40*1024+rng.Intn(64*1024))
+					rng.Read(payload)
+					if i%3 == 2 {
+						_, err := conn.Write(payload[:len(payload)/2])
+						return err
+					}
+					go conn.Write(payload)
+					got := make([]byte, len(payload))
+					if _, err := io.ReadFull(conn, got); err != nil {
+						return err
+					}
+					if !bytes.Equal(got, payload) {
+						return fmt.Errorf("回显的 %d 字节与写入的不一致", len(payload))
+					}
+					return nil
+				}(); err != nil {
+					errs <- fmt.Errorf("协程 %d 第 %d 次: %w", w, i, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for closed.Load() < workers*rounds {
+		if time.Now().After(deadline) {
+			t.Fatalf("客户端断开后节点只关闭了 %d/%d 条目标连接", closed.Load(), workers*rounds)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
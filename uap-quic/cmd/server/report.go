@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessionReport 上报的单个会话（与 uap-admin 的 api.SessionReport 一致）
+type sessionReport struct {
+	SessionID   string `json:"session_id"`
+	UserUUID    string `json:"user_uuid"`
+	ClientAddr  string `json:"client_addr"`
+	ConnectedAt int64  `json:"connected_at"`
+	BytesUp     int64  `json:"bytes_up"`
+	BytesDown   int64  `json:"bytes_down"`
+	Closed      bool   `json:"closed"` // 两次上报之间关闭的连接（最终流量）
+}
+
+// nodeReport 节点定期上报（与 uap-admin 的 api.NodeReportRequest 一致）
+type nodeReport struct {
+	PublicKey string          `json:"public_key"`
+	Sessions  []sessionReport `json:"sessions"`
+	Probes    int64           `json:"probes"`   // 上次上报以来鉴权失败（进入伪装模式）的次数，由 uap-admin 判断是否告警
+	Draining  bool            `json:"draining"` // 维护模式：uap-admin 不再把本节点下发给客户端
+}
+
+// maxClosedSessions 待上报的已关闭会话上限（uap-admin 长时间不可达时丢弃最旧的）
+const maxClosedSessions = 10000
+
+var (
+	reportEnabled atomic.Bool
+	probeCount    atomic.Int64 // 上次上报以来鉴权失败的次数
+
+	// reportNow 立即上报（维护模式切换时），不等下一个上报周期
+	reportNow = make(chan struct{}, 1)
+
+	closedMu       sync.Mutex
+	closedSessions []sessionReport // 两次上报之间关闭的会话（最终流量），下一次上报时带上
+)
+
+// queueClosedSession 记录已关闭会话的最终流量，等待下一次上报
+func queueClosedSession(report sessionReport) {
+	if !reportEnabled.Load() {
+		return
+	}
+	closedMu.Lock()
+	defer closedMu.Unlock()
+	closedSessions = append(closedSessions, report)
+	if n := len(closedSessions) - maxClosedSessions; n > 0 {
+		closedSessions = closedSessions[n:]
+	}
+}
+
+// takeClosedSessions 取出所有待上报的已关闭会话
+func takeClosedSessions() []sessionReport {
+	closedMu.Lock()
+	defer closedMu.Unlock()
+	taken := closedSessions
+	closedSessions = nil
+	return taken
+}
+
+// requeueClosedSessions 上报失败时放回已关闭会话，下次重试
+func requeueClosedSessions(reports []sessionReport) {
+	closedMu.Lock()
+	defer closedMu.Unlock()
+	closedSessions = append(reports, closedSessions...)
+	if n := len(closedSessions) - maxClosedSessions; n > 0 {
+		closedSessions = closedSessions[n:]
+	}
+}
+
+// reportLoop 定期向 uap-admin 上报活跃会话（同时充当节点心跳）
+func reportLoop(adminURL, adminSecret string, interval time.Duration) {
+	endpoint := strings.TrimRight(adminURL, "/") + "/api/v1/node/report"
+	log.Printf("✅ 会话上报已启用: %s (间隔 %v)", endpoint, interval)
+	reportEnabled.Store(true)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-reportNow:
+		}
+		closed := takeClosedSessions()
+		probes := probeCount.Swap(0)
+		if err := sendReport(endpoint, adminSecret, buildReport(closed, probes)); err != nil {
+			log.Printf("[上报] 会话上报失败: %v", err)
+			requeueClosedSessions(closed)
+			probeCount.Add(probes)
+		}
+	}
+}
+
+// triggerReport 请求立即上报一次（未启用上报时忽略）
+func triggerReport() {
+	if !reportEnabled.Load() {
+		return
+	}
+	select {
+	case reportNow <- struct{}{}:
+	default:
+	}
+}
+
+// buildReport 汇总当前活跃会话、已关闭会话和鉴权失败次数
+func buildReport(closed []sessionReport, probes int64) nodeReport {
+	report := nodeReport{PublicKey: nodePublicKeyPEM, Sessions: []sessionReport{}, Probes: probes, Draining: maintenance.enabled.Load()}
+	activeSessions.Range(func(_, value interface{}) bool {
+		report.Sessions = append(report.Sessions, value.(*connState).snapshot(false))
+		return true
+	})
+	report.Sessions = append(report.Sessions, closed...)
+	return report
+}
+
+// sendReport 发送上报请求
+func sendReport(endpoint, adminSecret string, report nodeReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Secret", adminSecret)
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uap-admin 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// routeLookupTimeout 路由策略匹配前解析域名目标的超时
+const routeLookupTimeout = 10 * time.Second
+
+// routes 出口路由策略（nil 表示不启用，全部按出口 IP 池 / 系统路由）
+var routes *routeTable
+
+// routeTable 出口路由策略：目标网段 → 出口源地址，应用层的策略路由（不需要在系统上配置 ip rule）
+// 命中策略的目标绑定该源地址出站，优先于出口 IP 池；未命中的目标按出口 IP 池或系统默认路由
+type routeTable struct {
+	rules []routeRule // 按前缀长度降序（最长前缀匹配）
+}
+
+// routeRule 一条路由策略
+type routeRule struct {
+	dst *net.IPNet
+	src net.IP
+}
+
+// loadRouteTable 加载路由策略文件，每行 "目标网段 出口源地址"，# 之后为注释
+// 出口源地址必须是本机地址且与目标网段地址族相同，同一网段不能重复；文件没有策略时返回 nil
+func loadRouteTable(filename string) (*routeTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开路由策略文件失败: %v", err)
+	}
+	defer f.Close()
+
+	t := &routeTable{}
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("路由策略第 %d 行格式错误: %q（应为 \"目标网段 出口源地址\"）", lineNum, scanner.Text())
+		}
+
+		_, dst, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			// 单个 IP 视为 /32 或 /128
+			ip := net.ParseIP(fields[0])
+			if ip == nil {
+				return nil, fmt.Errorf("路由策略第 %d 行目标网段格式错误: %q", lineNum, fields[0])
+			}
+			dst = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(normalizeIP(ip))*8, len(normalizeIP(ip))*8)}
+		}
+		dst.IP = normalizeIP(dst.IP)
+		if prev, ok := seen[dst.String()]; ok {
+			return nil, fmt.Errorf("路由策略第 %d 行目标网段 %s 与第 %d 行重复", lineNum, dst, prev)
+		}
+		seen[dst.String()] = lineNum
+
+		src := net.ParseIP(fields[1])
+		if src == nil {
+			return nil, fmt.Errorf("路由策略第 %d 行出口源地址格式错误: %q", lineNum, fields[1])
+		}
+		src = normalizeIP(src)
+		if len(src) != len(dst.IP) {
+			return nil, fmt.Errorf("路由策略第 %d 行出口源地址 %s 与目标网段 %s 的地址族不同", lineNum, src, dst)
+		}
+		// 能绑定才说明是本机地址（配置错误时启动即失败，而不是每次拨号失败）
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: src})
+		if err != nil {
+			return nil, fmt.Errorf("路由策略第 %d 行出口源地址 %s 不可用: %w", lineNum, src, err)
+		}
+		conn.Close()
+
+		t.rules = append(t.rules, routeRule{dst: dst, src: src})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取路由策略文件失败: %v", err)
+	}
+	if len(t.rules) == 0 {
+		return nil, nil
+	}
+	slices.SortStableFunc(t.rules, func(a, b routeRule) int {
+		la, _ := a.dst.Mask.Size()
+		lb, _ := b.dst.Mask.Size()
+		return lb - la
+	})
+	return t, nil
+}
+
+// normalizeIP IPv4（含 IPv4 映射的 IPv6 地址）统一为 4 字节
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// String 路由策略列表（日志使用）
+func (t *routeTable) String() string {
+	var items []string
+	for _, r := range t.rules {
+		items = append(items, r.dst.String()+" → "+r.src.String())
+	}
+	return strings.Join(items, ", ")
+}
+
+// match 返回目标 IP 命中的出口源地址，未命中返回 nil
+func (t *routeTable) match(ip net.IP) net.IP {
+	if t == nil {
+		return nil
+	}
+	ip = normalizeIP(ip)
+	for _, r := range t.rules {
+		if len(r.dst.IP) == len(ip) && r.dst.Contains(ip) {
+			return r.src
+		}
+	}
+	return nil
+}
+
+// dialTCP 按路由策略连接 TCP 目标，返回的 bool 表示目标是否命中策略（未命中时由调用方按默认方式连接）
+// 域名目标先解析，任一地址命中策略时按解析顺序（有地址族偏好时偏好的在前）逐个尝试：命中的地址绑定策略源地址，其余按默认方式
+func (t *routeTable) dialTCP(addr string, flags target.Flags) (net.Conn, bool, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		src := t.match(ip)
+		if src == nil {
+			return nil, false, nil
+		}
+		conn, err := dialFrom(src, addr)
+		return conn, true, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), routeLookupTimeout)
+	defer cancel()
+	ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || !slices.ContainsFunc(ipAddrs, func(a net.IPAddr) bool { return t.match(a.IP) != nil }) {
+		return nil, false, nil
+	}
+	if flags&(target.FlagPreferIPv4|target.FlagPreferIPv6) != 0 {
+		v4First := flags&target.FlagPreferIPv4 != 0
+		slices.SortStableFunc(ipAddrs, func(a, b net.IPAddr) int {
+			return familyRank(a.IP, v4First) - familyRank(b.IP, v4First)
+		})
+	}
+
+	var lastErr error
+	for _, a := range ipAddrs {
+		ipAddr := net.JoinHostPort(a.IP.String(), port)
+		var conn net.Conn
+		if src := t.match(a.IP); src != nil {
+			conn, err = dialFrom(src, ipAddr)
+		} else {
+			conn, err = dialDefault(ipAddr, 0)
+		}
+		if err == nil {
+			return conn, true, nil
+		}
+		lastErr = err
+	}
+	return nil, true, lastErr
+}
+
+// familyRank 按地址族偏好排序的序号（偏好的地址族为 0）
+func familyRank(ip net.IP, v4First bool) int {
+	if (ip.To4() != nil) == v4First {
+		return 0
+	}
+	return 1
+}
+
+// dialFrom 绑定源地址连接 TCP 目标
+func dialFrom(src net.IP, addr string) (net.Conn, error) {
+	return upstreamDialer(src, addr).Dial("tcp", addr)
+}
+
+// udpEgress UDP 关联的出口：默认 Socket（出口 IP 池或系统默认）加上路由策略与游戏流量的 Socket
+// 发往命中策略的目标时使用绑定策略源地址的 Socket，游戏流量使用带 DSCP 标记的 Socket（均在首次使用时创建），
+// 每个 Socket 各有一个回包读取流程；启用出口租约时（见 udplease.go）关联结束后保留发过包的 Socket
+type udpEgress struct {
+	*net.UDPConn // 默认出口（认领租约时在发送流程中替换）
+
+	read    func(*net.UDPConn) // 回包读取流程（Socket 关闭或读截止时间到期后返回）
+	readers sync.WaitGroup
+	user    func() string // 关联所属的用户（未启用出口租约时为 nil）
+
+	unreachable func(*net.UDPConn) // 转告 Socket 错误队列中的 ICMP 不可达（开启 -udp-unreachable 时由关联设置，见 udpunreach.go）
+
+	mu          sync.Mutex
+	routed      map[string]*net.UDPConn           // 源地址（游戏流量加 "/game" 后缀）→ Socket
+	targets     map[*net.UDPConn][]netip.AddrPort // 各 Socket 发往过的目标（启用出口租约时记录）
+	defaultUsed bool                              // 默认出口已发出过包（之后不再认领租约）
+	closed      bool
+}
+
+// newUDPEgress 包装默认出口并启动其回包读取流程；user 为关联所属的用户（启用出口租约时使用）
+func newUDPEgress(conn *net.UDPConn, user func() string, read func(*net.UDPConn)) *udpEgress {
+	e := &udpEgress{UDPConn: conn, read: read, routed: make(map[string]*net.UDPConn)}
+	if udpLeases != nil {
+		e.user, e.targets = user, make(map[*net.UDPConn][]netip.AddrPort)
+	}
+	e.start(conn)
+	return e
+}
+
+// start 为 Socket 启动回包读取流程
+func (e *udpEgress) start(conn *net.UDPConn) {
+	e.readers.Add(1)
+	go func() {
+		defer e.readers.Done()
+		e.read(conn)
+	}()
+}
+
+// WriteToUDP 发送到目标：命中路由策略时使用绑定策略源地址的 Socket；flags 为包头携带的流量类型标志
+func (e *udpEgress) WriteToUDP(b []byte, addr *net.UDPAddr, flags target.Flags) (int, error) {
+	conn, err := e.connFor(addr, flags&target.FlagGame != 0 && gameDSCP > 0)
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.WriteToUDP(b, addr)
+	if isUnreachable(err) && e.unreachable != nil {
+		// 错误属于之前发出的包（内核在下一次读写时报告），本次的包没有发出：转告后重发一次
+		e.unreachable(conn)
+		n, err = conn.WriteToUDP(b, addr)
+	}
+	return n, err
+}
+
+// connFor 选择发往 addr 的 Socket；game 为 true 时使用同一源地址上带 DSCP 标记的 Socket
+// 启用出口租约时新用到的 Socket 优先认领该用户发往 addr 的租约
+func (e *udpEgress) connFor(addr *net.UDPAddr, game bool) (*net.UDPConn, error) {
+	src := routes.match(addr.IP)
+	if src == nil && !game {
+		if e.user == nil {
+			return e.UDPConn, nil
+		}
+		target := leaseTarget(addr)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.claimDefaultLocked(target)
+		e.trackLocked(e.UDPConn, target)
+		return e.UDPConn, nil
+	}
+	if src == nil {
+		src = e.UDPConn.LocalAddr().(*net.UDPAddr).IP
+	}
+	key := src.String()
+	if game {
+		key += "/game"
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, net.ErrClosed
+	}
+	var target netip.AddrPort
+	if e.user != nil {
+		target = leaseTarget(addr)
+	}
+	if conn, ok := e.routed[key]; ok {
+		if e.user != nil {
+			e.trackLocked(conn, target)
+		}
+		return conn, nil
+	}
+	if e.user != nil {
+		if conn := udpLeases.take(e.user(), key, target); conn != nil {
+			log.Printf("[UDP] 认领出口租约: %s → %s", conn.LocalAddr(), target)
+			e.routed[key] = conn
+			e.trackLocked(conn, target)
+			e.start(conn)
+			return conn, nil
+		}
+	}
+	conn, err := listenExitUDP("udp", &net.UDPAddr{IP: src})
+	if err != nil {
+		return nil, err
+	}
+	if e.user != nil {
+		e.trackLocked(conn, target)
+	}
+	if game {
+		if err := setDSCP(conn, gameDSCP); err != nil {
+			log.Printf("[QoS] 设置 DSCP 失败 %s: %v", conn.LocalAddr(), err)
+		}
+		log.Printf("[UDP] 游戏流量出口: %s (DSCP %d)", conn.LocalAddr(), gameDSCP)
+	} else {
+		log.Printf("[UDP] 路由策略出口: %s", conn.LocalAddr())
+	}
+	e.routed[key] = conn
+	e.start(conn)
+	return conn, nil
+}
+
+// Close 关闭所有 Socket（回包读取流程随之退出）；启用出口租约时发过包的 Socket 转入租约表，不关闭（可重复调用）
+func (e *udpEgress) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	conns := make(map[string]*net.UDPConn, len(e.routed)+1)
+	for key, conn := range e.routed {
+		conns[key] = conn
+	}
+	conns[""] = e.UDPConn
+	if e.user != nil {
+		for _, conn := range e.releaseLocked(conns) {
+			conn.Close()
+		}
+		return nil
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// Wait 等待所有回包读取流程退出（在 Close 之后调用）
+func (e *udpEgress) Wait() {
+	e.readers.Wait()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// writeRouteFile 把 text 写入临时的路由策略文件，返回路径
+func writeRouteFile(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.txt")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withRoutes 测试期间使用 text 描述的出口路由策略
+func withRoutes(t *testing.T, text string) *routeTable {
+	t.Helper()
+	table, err := loadRouteTable(writeRouteFile(t, text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := routes
+	routes = table
+	t.Cleanup(func() { routes = old })
+	return table
+}
+
+func TestLoadRouteTable(t *testing.T) {
+	table, err := loadRouteTable(writeRouteFile(t, `
+# 测试环境
+127.0.0.0/8     127.0.0.2
+127.0.0.6       127.0.0.3   # 单个 IP 视为 /32
+127.0.0.0/24    127.0.0.4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按前缀长度从长到短匹配
+	if table.String() != "127.0.0.6/32 → 127.0.0.3, 127.0.0.0/24 → 127.0.0.4, 127.0.0.0/8 → 127.0.0.2" {
+		t.Fatalf("路由策略 %s", table)
+	}
+	for ip, want := range map[string]string{
+		"127.0.0.6":        "127.0.0.3",
+		"::ffff:127.0.0.6": "127.0.0.3", // IPv4 映射地址按 IPv4 匹配
+		"127.0.0.9":        "127.0.0.4",
+		"127.1.0.1":        "127.0.0.2",
+		"10.0.0.1":         "<nil>",
+		"::1":              "<nil>",
+	} {
+		if got := table.match(net.ParseIP(ip)).String(); got != want {
+			t.Errorf("match(%s) = %s，期望 %s", ip, got, want)
+		}
+	}
+	var none *routeTable
+	if none.match(net.ParseIP("127.0.0.1")) != nil {
+		t.Fatal("未启用路由策略时命中了策略")
+	}
+
+	if table, err := loadRouteTable(writeRouteFile(t, "# 只有注释\n\n")); table != nil || err != nil {
+		t.Fatalf("没有策略时返回 %v, %v", table, err)
+	}
+	if _, err := loadRouteTable(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+	for _, text := range []string{
+		"127.0.0.0/8",                                  // 缺少出口源地址
+		"127.0.0.0/8 127.0.0.2 extra",                  // 多余的字段
+		"not-a-cidr 127.0.0.2",                         // 目标网段格式错误
+		"127.0.0.0/8 not-an-ip",                        // 出口源地址格式错误
+		"127.0.0.0/8 192.0.2.1",                        // 不是本机地址：启动即失败
+		"::1/128 127.0.0.2",                            // 地址族不同
+		"127.0.0.0/8 127.0.0.2\n127.0.0.1/8 127.0.0.3", // 网段重复（规范化后相同）
+	} {
+		if _, err := loadRouteTable(writeRouteFile(t, text)); err == nil {
+			t.Errorf("路由策略 %q 应返回错误", text)
+		}
+	}
+}
+
+func TestRouteTableTCP(t *testing.T) {
+	// 出口 IP 池作为未命中策略时的默认方式，命中策略的目标优先使用策略的源地址
+	withEgress(t, "127.0.0.2", egressRoundRobin)
+	withRoutes(t, "127.0.0.6 127.0.0.5\n")
+	client := startTestNode(t).connect(t)
+
+	if src := tunneledSource(t, client, startSourceServerOn(t, "127.0.0.6")); src != "127.0.0.5" {
+		t.Fatalf("命中策略的目标出口 %s，期望 127.0.0.5", src)
+	}
+	if src := tunneledSource(t, client, startSourceServerOn(t, "127.0.0.7")); src != "127.0.0.2" {
+		t.Fatalf("未命中策略的目标出口 %s，期望出口 IP 池的 127.0.0.2", src)
+	}
+}
+
+func TestRouteTableDomain(t *testing.T) {
+	table := withRoutes(t, "127.0.0.1 127.0.0.5\n")
+	addr := startSourceServer(t)
+	_, port, _ := net.SplitHostPort(addr)
+
+	// 域名目标解析后按地址匹配策略
+	conn, routed, err := table.dialTCP(net.JoinHostPort("localhost", port), target.FlagPreferIPv4)
+	if err != nil || !routed {
+		t.Fatalf("localhost 未命中策略: %v %v", routed, err)
+	}
+	defer conn.Close()
+	if src := conn.LocalAddr().(*net.TCPAddr).IP.String(); src != "127.0.0.5" {
+		t.Fatalf("域名目标出口 %s，期望 127.0.0.5", src)
+	}
+	// 未命中策略时交由调用方按默认方式连接
+	if _, routed, _ := table.dialTCP("127.0.0.7:1", 0); routed {
+		t.Fatal("未命中策略的目标被认为命中")
+	}
+}
+
+func TestRouteTableUDP(t *testing.T) {
+	withRoutes(t, "127.0.0.6 127.0.0.5\n")
+	sources := make(chan string, 4)
+	listen := func(ip string) *net.UDPAddr {
+		pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		go func() {
+			buf := make([]byte, 64)
+			for {
+				_, from, err := pc.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				sources <- from.IP.String()
+			}
+		}()
+		return pc.LocalAddr().(*net.UDPAddr)
+	}
+	routed, unrouted := listen("127.0.0.6"), listen("127.0.0.7")
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newUDPEgress(conn, nil, func(c *net.UDPConn) { c.ReadFromUDP(make([]byte, 64)) })
+	defer func() {
+		e.Close()
+		e.Wait()
+	}()
+
+	for _, tc := range []struct {
+		addr *net.UDPAddr
+		want string
+	}{
+		{routed, "127.0.0.5"},
+		{unrouted, "127.0.0.1"},
+		{routed, "127.0.0.5"}, // 复用已创建的策略 Socket
+	} {
+		if _, err := e.WriteToUDP([]byte("ping"), tc.addr, 0); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case src := <-sources:
+			if src != tc.want {
+				t.Fatalf("发往 %s 的出口 %s，期望 %s", tc.addr, src, tc.want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s 未收到数据包", tc.addr)
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.routed) != 1 || !strings.HasPrefix(e.routed["127.0.0.5"].LocalAddr().String(), "127.0.0.5:") {
+		t.Fatalf("策略 Socket %v", e.routed)
+	}
+}
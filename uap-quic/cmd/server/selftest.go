@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/sockbuf"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quic-go/quic-go"
+)
+
+// 自检参数
+const (
+	selftestStepTimeout = 10 * time.Second    // 单个步骤的超时（需大于鉴权失败时 2-5 秒的伪装延迟）
+	selftestCertWarn    = 14 * 24 * time.Hour // 证书剩余有效期低于该值时提示续期
+)
+
+// selftest 自检：用部署的证书与配置在本机临时端口启动节点，用进程内客户端连接自己，
+// 依次完成握手鉴权、一次 TCP 回显、一次 UDP 回显；结果输出到标准输出（可直接贴到 issue），日志仍输出到标准错误
+type selftest struct {
+	tlsCert    tls.Certificate
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	tokenFile  string
+
+	step    int
+	steps   int
+	authLog *lastLineWriter
+}
+
+// runSelftest 执行自检，返回进程退出码（全部通过为 0）
+func runSelftest(tlsCert tls.Certificate, tlsConfig *tls.Config, quicConfig *quic.Config, tokenFile string) int {
+	t := &selftest{tlsCert: tlsCert, tlsConfig: tlsConfig, quicConfig: quicConfig, tokenFile: tokenFile, steps: 6}
+	// 鉴权失败时节点只回复伪装响应，具体原因在节点日志中，记下最后一条鉴权日志用于报告
+	t.authLog = &lastLineWriter{out: os.Stderr, prefix: "[鉴权]"}
+	log.SetOutput(t.authLog)
+	defer log.SetOutput(os.Stderr)
+
+	fmt.Printf("UAP 节点自检 (%s %s/%s, %s)\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, time.Now().UTC().Format(time.RFC3339))
+	fmt.Printf("配置: 信任模式 %v, PSK %v, 只接受连接票据 %v, 压缩 %v\n", trustedMode, preSharedKey != "", requireTicket, compressionEnabled)
+
+	if !t.run("证书", t.checkCert) {
+		return 1
+	}
+	var token string
+	if !t.run("Token", func() (string, error) {
+		var err error
+		token, err = t.loadToken()
+		if err != nil || trustedMode {
+			return "跳过（信任模式不鉴权）", err
+		}
+		return t.checkToken(token)
+	}) {
+		return 1
+	}
+
+	var listener *quic.Listener
+	var udpConn *net.UDPConn
+	if !t.run("监听", func() (string, error) {
+		var err error
+		listener, udpConn, err = listenQUIC("127.0.0.1:0", t.tlsConfig, t.quicConfig)
+		if err != nil {
+			return "", fmt.Errorf("在本机临时端口监听 UDP 失败: %w", err)
+		}
+		go func() {
+			for {
+				conn, err := listener.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				go handleConnection(conn)
+			}
+		}()
+		return listener.Addr().String() + " (UDP), " + socketBufferDetail(udpConn), nil
+	}) {
+		return 1
+	}
+	defer udpConn.Close()
+	defer listener.Close()
+
+	client := core.NewClient(listener.Addr().String(), token, 0, "global")
+	client.SetPSK(preSharedKey)
+	client.SetTrusted(trustedMode)
+	defer client.Stop()
+
+	ok := t.run("握手与鉴权", func() (string, error) { return t.connect(client) }) &&
+		t.run("TCP 回显", func() (string, error) { return tcpEcho(client) }) &&
+		t.run("UDP 回显", func() (string, error) { return udpEcho(client) })
+	if !ok {
+		return 1
+	}
+	fmt.Println("结果: ✅ 全部通过")
+	return 0
+}
+
+// run 执行一个步骤并输出结果，失败时输出失败的步骤
+func (t *selftest) run(name string, fn func() (string, error)) bool {
+	t.step++
+	start := time.Now()
+	detail, err := fn()
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		fmt.Printf("[%d/%d] %s: ❌ %v\n", t.step, t.steps, name, err)
+		fmt.Printf("结果: ❌ 失败（第 %d 步 %s）\n", t.step, name)
+		return false
+	}
+	fmt.Printf("[%d/%d] %s: ✅ %s (%v)\n", t.step, t.steps, name, detail, elapsed)
+	return true
+}
+
+// checkCert 检查证书有效期，并按客户端的方式（系统根证书 + 固定的服务端域名）校验证书链
+func (t *selftest) checkCert() (string, error) {
+	leaf, err := x509.ParseCertificate(t.tlsCert.Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("解析证书失败: %w", err)
+	}
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return "", fmt.Errorf("证书尚未生效（生效时间 %s），请检查本机时钟", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return "", fmt.Errorf("证书已于 %s 过期", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, der := range t.tlsCert.Certificate[1:] {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return "", fmt.Errorf("解析中间证书失败: %w", err)
+		}
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: core.ServerName, Intermediates: intermediates}); err != nil {
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) && len(t.tlsCert.Certificate) == 1 {
+			return "", fmt.Errorf("证书链校验失败: %w（证书文件只有一张证书，缺少中间证书？自签证书需设置 SSL_CERT_FILE）", err)
+		}
+		return "", fmt.Errorf("证书链校验失败: %w", err)
+	}
+
+	detail := fmt.Sprintf("%s, 签发者 %s, 有效期至 %s", core.ServerName, leaf.Issuer.CommonName, leaf.NotAfter.UTC().Format("2006-01-02"))
+	if remaining := leaf.NotAfter.Sub(now); remaining < selftestCertWarn {
+		detail += fmt.Sprintf("（⚠️ 剩余 %d 天，请尽快续期）", int(remaining.Hours()/24))
+	}
+	return detail, nil
+}
+
+// socketBufferDetail QUIC socket 实际的收发缓冲区（quic-go 已尝试调大之后）
+// 接收缓冲区被内核限制在请求的大小（未设置 -udp-rcvbuf 时为 quic-go 期望的 sockbuf.Recommended）以下、且低于 sockbuf.Recommended 时提示
+func socketBufferDetail(conn *net.UDPConn) string {
+	granted, err := sockbuf.Read(conn)
+	if err != nil {
+		return fmt.Sprintf("缓冲区大小未知 (%v)", err)
+	}
+	detail := fmt.Sprintf("缓冲区 接收 %dKB / 发送 %dKB", granted.Recv>>10, granted.Send>>10)
+	wanted := quicBuffers.Recv
+	if wanted == 0 {
+		wanted = sockbuf.Recommended
+	}
+	if granted.Recv < wanted && granted.Recv < sockbuf.Recommended {
+		detail += fmt.Sprintf("（⚠️ 接收缓冲区被内核限制在 %dKB（请求 %dKB），低于 %dKB，高吞吐时容易丢包重传：调大 net.core.rmem_max 或以 CAP_NET_ADMIN 运行）",
+			granted.Recv>>10, wanted>>10, sockbuf.Recommended>>10)
+	}
+	return detail
+}
+
+// loadToken 读取 Token 文件（信任模式不需要）
+func (t *selftest) loadToken() (string, error) {
+	if trustedMode {
+		return "", nil
+	}
+	if t.tokenFile == "" {
+		return "", errors.New("未指定 -selftest-token（自检需要一个有效的用户 JWT 或本节点的连接票据）")
+	}
+	data, err := os.ReadFile(t.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("读取 Token 文件失败: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("Token 文件 %s 为空", t.tokenFile)
+	}
+	return token, nil
+}
+
+// checkToken 用节点的验签公钥预先校验 Token，给出比伪装响应更明确的失败原因
+func (t *selftest) checkToken(token string) (string, error) {
+	parsed, err := jwt.Parse(token, jwtKeys.keyfunc)
+	if err != nil {
+		return "", fmt.Errorf("Token 校验失败: %w", err)
+	}
+	claims, _ := parsed.Claims.(jwt.MapClaims)
+	userUUID, _ := claims["uuid"].(string)
+	if userUUID == "" {
+		return "", errors.New("Token 缺少 uuid 字段")
+	}
+	typ, _ := claims["typ"].(string)
+	if typ != "connect" && requireTicket {
+		return "", errors.New("已启用 -require-ticket，节点只接受连接票据，请在 Token 文件中提供本节点的连接票据")
+	}
+
+	kind := "长期 JWT"
+	if typ == "connect" {
+		kind = "连接票据"
+	}
+	detail := fmt.Sprintf("%s, 用户 %s", kind, userUUID)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		detail += ", 过期时间 " + exp.UTC().Format(time.RFC3339)
+	}
+	return detail, nil
+}
+
+// connect 握手并验证隧道，失败时区分常见原因
+func (t *selftest) connect(client *core.Client) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), selftestStepTimeout)
+	defer cancel()
+	err := client.Connect(ctx)
+	if err == nil {
+		return "QUIC 握手、鉴权与回显指令正常", nil
+	}
+
+	var handshakeTimeout *quic.HandshakeTimeoutError
+	var idleTimeout *quic.IdleTimeoutError
+	switch {
+	case errors.As(err, &handshakeTimeout), errors.As(err, &idleTimeout):
+		return "", fmt.Errorf("QUIC 握手超时: %w（本机 UDP 可能被防火墙拦截，请检查 iptables / nftables 规则）", err)
+	case errors.Is(err, core.ErrAuthRejected):
+		if reason := t.authLog.last(); reason != "" {
+			return "", fmt.Errorf("节点拒绝鉴权: %s", reason)
+		}
+		return "", fmt.Errorf("节点拒绝鉴权: %w", err)
+	}
+	return "", err
+}
+
+// tcpEcho 经隧道连接本机的 TCP 回显服务，验证 TCP 转发
+func tcpEcho(client *core.Client) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("启动 TCP 回显服务失败: %w", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), selftestStepTimeout)
+	defer cancel()
+	conn, err := client.DialTCP(ctx, ln.Addr().String())
+	if err != nil {
+		return "", fmt.Errorf("经隧道连接 %s 失败: %w（检查 -egress-ips / -egress-routes 是否允许连接本机地址）", ln.Addr(), err)
+	}
+	defer conn.Close()
+	return echo(conn, ln.Addr().String(), 16*1024)
+}
+
+// udpEcho 经隧道向本机的 UDP 回显服务发送一个报文，验证 UDP 转发
+func udpEcho(client *core.Client) (string, error) {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return "", fmt.Errorf("启动 UDP 回显服务失败: %w", err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), selftestStepTimeout)
+	defer cancel()
+	conn, err := client.DialUDP(ctx, pc.LocalAddr().String())
+	if err != nil {
+		return "", fmt.Errorf("经隧道建立 UDP 关联失败: %w", err)
+	}
+	defer conn.Close()
+	return echo(conn, pc.LocalAddr().String(), 512)
+}
+
+// echo 写入 size 字节随机数据并读回比较
+func echo(conn net.Conn, target string, size int) (string, error) {
+	conn.SetDeadline(time.Now().Add(selftestStepTimeout))
+	payload := make([]byte, size)
+	rand.Read(payload)
+	if _, err := conn.Write(payload); err != nil {
+		return "", fmt.Errorf("向 %s 发送数据失败: %w", target, err)
+	}
+	reply := make([]byte, size)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", fmt.Errorf("等待 %s 回显超时（%v）", target, selftestStepTimeout)
+		}
+		return "", fmt.Errorf("读取 %s 回显失败: %w", target, err)
+	}
+	if !bytes.Equal(reply, payload) {
+		return "", fmt.Errorf("%s 回显数据不一致", target)
+	}
+	return fmt.Sprintf("%s, %d 字节", target, size), nil
+}
+
+// lastLineWriter 日志输出包装：原样写出，同时记下最后一条以 prefix 开头的日志内容
+type lastLineWriter struct {
+	out    io.Writer
+	prefix string
+
+	mu   sync.Mutex
+	line string
+}
+
+func (w *lastLineWriter) Write(p []byte) (int, error) {
+	if i := bytes.Index(p, []byte(w.prefix)); i >= 0 {
+		w.mu.Lock()
+		w.line = strings.TrimSpace(string(p[i+len(w.prefix):]))
+		w.mu.Unlock()
+	}
+	return w.out.Write(p)
+}
+
+// last 最后一条匹配的日志内容（没有时为空）
+func (w *lastLineWriter) last() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.line
+}
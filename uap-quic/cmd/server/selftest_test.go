@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runSelftestOutput 用 cert 与 Token 文件执行自检，返回退出码与标准输出
+func runSelftestOutput(t *testing.T, cert tls.Certificate, tokenFile string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, logOut := os.Stdout, log.Writer()
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(logOut) // runSelftest 结束时把日志恢复到标准错误
+	}()
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{serverALPN()}}
+	code := runSelftest(cert, tlsConfig, testQUICConfig(), tokenFile)
+	w.Close()
+	return code, string(<-done)
+}
+
+// writeTokenFile 把 token 写入临时文件，返回路径
+func writeTokenFile(t *testing.T, token string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSelftest(t *testing.T) {
+	code, out := runSelftestOutput(t, testCert, writeTokenFile(t, testJWTToken))
+	if code != 0 || !strings.Contains(out, "全部通过") {
+		t.Fatalf("自检退出码 %d:\n%s", code, out)
+	}
+	for _, step := range []string{"[1/6] 证书: ✅", "[2/6] Token: ✅ 长期 JWT, 用户 test-user", "[3/6] 监听: ✅", "[4/6] 握手与鉴权: ✅", "[5/6] TCP 回显: ✅", "[6/6] UDP 回显: ✅"} {
+		if !strings.Contains(out, step) {
+			t.Errorf("输出缺少 %q:\n%s", step, out)
+		}
+	}
+}
+
+func TestSelftestTrusted(t *testing.T) {
+	withTrusted(t, true)
+	// 信任模式不需要 Token 文件
+	code, out := runSelftestOutput(t, testCert, "")
+	if code != 0 || !strings.Contains(out, "Token: ✅ 跳过") {
+		t.Fatalf("自检退出码 %d:\n%s", code, out)
+	}
+}
+
+func TestSelftestFailures(t *testing.T) {
+	untrusted, _ := generateTestCert() // 不在 SSL_CERT_FILE 中的自签证书
+	cases := []struct {
+		name      string
+		cert      tls.Certificate
+		tokenFile string
+		want      string
+	}{
+		{"证书链", untrusted, writeTokenFile(t, testJWTToken), "[1/6] 证书: ❌ 证书链校验失败"},
+		{"未指定 Token", testCert, "", "[2/6] Token: ❌ 未指定 -selftest-token"},
+		{"Token 文件不存在", testCert, filepath.Join(t.TempDir(), "missing"), "[2/6] Token: ❌ 读取 Token 文件失败"},
+		{"Token 文件为空", testCert, writeTokenFile(t, ""), "[2/6] Token: ❌ Token 文件"},
+		{"Token 过期", testCert, writeTokenFile(t, signTestToken("test-user", -time.Minute)), "[2/6] Token: ❌ Token 校验失败"},
+		{"Token 缺少 uuid", testCert, writeTokenFile(t, signTestToken("", time.Hour)), "[2/6] Token: ❌ Token 缺少 uuid 字段"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, out := runSelftestOutput(t, tc.cert, tc.tokenFile)
+			// 失败时退出码非零，并指出失败的步骤与原因
+			if code == 0 || !strings.Contains(out, tc.want) || !strings.Contains(out, "结果: ❌ 失败") {
+				t.Fatalf("自检退出码 %d，期望输出 %q:\n%s", code, tc.want, out)
+			}
+		})
+	}
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	certNotAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	go serveHealth(ln, "secret", time.Now().Add(-time.Minute), certNotAfter)
+	base := "http://" + ln.Addr().String()
+
+	get := func() (int, healthResponse) {
+		t.Helper()
+		resp, err := http.Get(base + "/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var h healthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, h
+	}
+
+	status, h := get()
+	if status != http.StatusOK || h.Status != "ok" || h.UptimeSeconds < 60 || h.CertNotAfter != certNotAfter.Unix() {
+		t.Fatalf("健康检查 %d %+v", status, h)
+	}
+	// 维护模式下回复 503，负载均衡据此停止调度新连接
+	maintenance.enabled.Store(true)
+	t.Cleanup(func() { maintenance.enabled.Store(false) })
+	if status, h := get(); status != http.StatusServiceUnavailable || h.Status != "draining" {
+		t.Fatalf("维护模式下的健康检查 %d %+v", status, h)
+	}
+
+	resp, err := http.Post(base+"/health", "text/plain", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /health 返回 %d", resp.StatusCode)
+	}
+	// 调试接口需要管理员密钥
+	resp, err = http.Get(base + "/debug/verbose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("未带管理员密钥的调试接口返回 %d", resp.StatusCode)
+	}
+}
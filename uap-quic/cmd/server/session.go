@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"uap-quic/pkg/prio"
+
+	"github.com/quic-go/quic-go"
+)
+
+// connState 单条 QUIC 连接的状态（鉴权 + 会话统计）
+// 连接票据只在第一次出示时完整校验（签名/节点/过期/一次性），之后同一连接上的流出示同一票据直接放行
+type connState struct {
+	conn        quic.Connection
+	sessionID   string
+	connectedAt time.Time
+
+	mu       sync.Mutex
+	ticket   string // 本连接已验证通过的票据
+	userUUID string // 首次鉴权成功后确定
+
+	bytesUp   atomic.Int64 // 客户端 -> 目标
+	bytesDown atomic.Int64 // 目标 -> 客户端
+
+	streams  atomic.Int64 // 进行中的流（达到最长时长后等待其结束再关闭连接）
+	draining atomic.Bool  // 已通知客户端换连，正在排空
+
+	lastWarmup atomic.Int64 // 最近一次预热请求的时间（UnixNano，见 warmup.go）
+
+	caps atomic.Uint32 // 与客户端协商的能力位（见 compress.go，未协商时为 0）
+
+	prio *prio.Scheduler // 下行流优先级（未开启 -stream-priority 时为 nil，见 qos.go）
+}
+
+// activeSessions 已鉴权的活跃连接（sessionID -> *connState），用于向 uap-admin 上报
+var activeSessions sync.Map
+
+// newConnState 为新连接创建状态
+func newConnState(conn quic.Connection) *connState {
+	id := make([]byte, 8)
+	rand.Read(id)
+	s := &connState{
+		conn:        conn,
+		sessionID:   hex.EncodeToString(id),
+		connectedAt: time.Now(),
+	}
+	if streamPriority {
+		s.prio = prio.NewScheduler()
+	}
+	return s
+}
+
+// acceptedTicket 返回本连接已验证过的票据对应的用户（未验证过返回 false）
+func (s *connState) acceptedTicket(ticket string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ticket != "" && s.ticket == ticket {
+		return s.userUUID, true
+	}
+	return "", false
+}
+
+// acceptTicket 记录本连接验证通过的票据
+func (s *connState) acceptTicket(ticket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticket = ticket
+}
+
+// authenticated 记录鉴权成功的用户，首次鉴权时登记为活跃会话并返回 true
+func (s *connState) authenticated(userUUID string) bool {
+	s.mu.Lock()
+	first := s.userUUID == ""
+	s.userUUID = userUUID
+	s.mu.Unlock()
+
+	if first {
+		activeSessions.Store(s.sessionID, s)
+	}
+	return first
+}
+
+// user 返回本连接鉴权的用户（未鉴权为空）
+func (s *connState) user() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userUUID
+}
+
+// verbose 本连接的用户是否开启了详细日志；未启用采样（-log-sample 1）时同样返回 true
+// 用于逐个 UDP 数据包的日志：只在排查单个用户时记录
+func (s *connState) verbose() bool {
+	return logSampleRate <= 1 || verboseUsers.enabled(s.user())
+}
+
+// close 连接关闭时注销会话，最终流量留到下一次上报入账
+func (s *connState) close() {
+	if _, ok := activeSessions.LoadAndDelete(s.sessionID); ok {
+		queueClosedSession(s.snapshot(true))
+	}
+}
+
+// snapshot 生成会话的上报快照
+func (s *connState) snapshot(closed bool) sessionReport {
+	return sessionReport{
+		SessionID:   s.sessionID,
+		UserUUID:    s.user(),
+		ClientAddr:  s.conn.RemoteAddr().String(),
+		ConnectedAt: s.connectedAt.Unix(),
+		BytesUp:     s.bytesUp.Load(),
+		BytesDown:   s.bytesDown.Load(),
+		Closed:      closed,
+	}
+}
+
+// countingWriter 统计写入字节数的 Writer（实时累加，便于定期上报长连接流量）
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"sync"
+
+	"uap-quic/pkg/sockbuf"
+
+	"github.com/quic-go/quic-go"
+)
+
+// UDP socket 缓冲区（-udp-rcvbuf / -udp-sndbuf 用于 QUIC 监听 socket，-egress-udp-* 用于每个 UDP 关联的出口 socket），为 0 的项保持系统默认
+// 高吞吐时内核默认的接收缓冲区（Linux net.core.rmem_default）容易被打满丢包，表现为 QUIC 重传增多
+var (
+	quicBuffers   sockbuf.Config
+	egressBuffers sockbuf.Config
+)
+
+// egressClampOnce 出口 socket 的缓冲区被内核截断时只记录一次日志（每个 UDP 关联都会新建出口 socket）
+var egressClampOnce sync.Once
+
+// listenQUIC 在 addr 上创建 UDP socket，按 quicBuffers 设置缓冲区后在其上监听 QUIC
+// socket 由调用方创建并持有：关闭监听后需要再关闭返回的 socket
+func listenQUIC(addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Listener, *net.UDPConn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, err := serveQUIC(conn, nil, tlsConfig, quicConfig)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return listener, conn, nil
+}
+
+// serveQUIC 按 quicBuffers 设置 conn 的缓冲区后在其上监听 QUIC；ids 非 nil 时由它生成连接 ID（平滑升级，见 handoff.go）
+func serveQUIC(conn *net.UDPConn, ids quic.ConnectionIDGenerator, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Listener, error) {
+	if !quicBuffers.IsZero() {
+		res, err := sockbuf.Apply(conn, quicBuffers)
+		switch {
+		case err != nil:
+			log.Printf("⚠️ QUIC socket 缓冲区已设置，但无法读取实际大小: %v", err)
+		case res.Clamped():
+			log.Printf("⚠️ QUIC socket 缓冲区被内核截断 (请求/实际): %s，请调大 net.core.rmem_max / wmem_max 或以 CAP_NET_ADMIN 运行", res)
+		default:
+			log.Printf("✅ QUIC socket 缓冲区 (请求/实际): %s", res)
+		}
+	}
+	tr := &quic.Transport{Conn: conn, ConnectionIDGenerator: ids}
+	return tr.Listen(tlsConfig, quicConfig)
+}
+
+// listenExitUDP 创建 UDP 关联的出口 socket，按 egressBuffers 设置缓冲区；开启 -udp-unreachable 时接收 ICMP 错误
+func listenExitUDP(network string, laddr *net.UDPAddr) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	if udpUnreachable {
+		if err := enableRecvErr(conn); err != nil {
+			log.Printf("⚠️ UDP 出口 socket 开启 ICMP 错误接收失败 %s: %v", conn.LocalAddr(), err)
+		}
+	}
+	if egressBuffers.IsZero() {
+		return conn, nil
+	}
+	if res, err := sockbuf.Apply(conn, egressBuffers); err == nil && res.Clamped() {
+		egressClampOnce.Do(func() {
+			log.Printf("⚠️ UDP 出口 socket 缓冲区被内核截断 (请求/实际): %s，请调大 net.core.rmem_max / wmem_max 或以 CAP_NET_ADMIN 运行", res)
+		})
+	}
+	return conn, nil
+}
+
+// configureSocketBuffers 按启动参数 (KB) 设置 QUIC 与出口 socket 的缓冲区
+func configureSocketBuffers(quicRecvKB, quicSendKB, egressRecvKB, egressSendKB int) {
+	quicBuffers = sockbuf.FromKB(quicRecvKB, quicSendKB)
+	egressBuffers = sockbuf.FromKB(egressRecvKB, egressSendKB)
+	if !egressBuffers.IsZero() {
+		log.Printf("✅ UDP 出口 socket 缓冲区: 接收 %dKB, 发送 %dKB（0 为系统默认）", egressBuffers.Recv>>10, egressBuffers.Send>>10)
+	}
+}
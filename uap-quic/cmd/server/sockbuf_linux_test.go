@@ -0,0 +1,71 @@
+//go:build linux
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"uap-quic/pkg/sockbuf"
+)
+
+// withSocketBuffers 测试期间按启动参数 (KB) 设置 socket 缓冲区
+func withSocketBuffers(t *testing.T, quicRecvKB, quicSendKB, egressRecvKB, egressSendKB int) {
+	oldQUIC, oldEgress := quicBuffers, egressBuffers
+	t.Cleanup(func() { quicBuffers, egressBuffers = oldQUIC, oldEgress })
+	configureSocketBuffers(quicRecvKB, quicSendKB, egressRecvKB, egressSendKB)
+}
+
+func TestSocketBuffers(t *testing.T) {
+	logs := captureLogs(t)
+	// 低于 sockbuf.Recommended 的接收缓冲区会被 quic-go 自行调大，这里请求更大的值
+	withSocketBuffers(t, 3072, 3072, 384, 128)
+
+	listener, conn, err := listenQUIC("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{testCert}, NextProtos: []string{serverALPN()}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer listener.Close()
+	if strings.Contains(logs.String(), "被内核截断") {
+		t.Skipf("内核上限低于请求且没有 CAP_NET_ADMIN:\n%s", logs)
+	}
+	if got, err := sockbuf.Read(conn); err != nil || got != (sockbuf.Config{Recv: 3 << 20, Send: 3 << 20}) {
+		t.Fatalf("QUIC socket 缓冲区 %+v, %v", got, err)
+	}
+	// 记录请求与实际授予的大小
+	if !strings.Contains(logs.String(), "QUIC socket 缓冲区 (请求/实际): 接收 3072/3072KB, 发送 3072/3072KB") {
+		t.Fatalf("日志中没有缓冲区大小:\n%s", logs)
+	}
+
+	exit, err := listenExitUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exit.Close()
+	if got, err := sockbuf.Read(exit); err != nil || got != (sockbuf.Config{Recv: 384 << 10, Send: 128 << 10}) {
+		t.Fatalf("出口 socket 缓冲区 %+v, %v", got, err)
+	}
+}
+
+func TestSocketBufferDetail(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadBuffer(64 << 10)
+
+	// 未设置 -udp-rcvbuf：低于 quic-go 期望的大小时提示
+	withSocketBuffers(t, 0, 0, 0, 0)
+	if detail := socketBufferDetail(conn); !strings.Contains(detail, "接收 64KB") || !strings.Contains(detail, "⚠️ 接收缓冲区被内核限制在 64KB（请求 2048KB）") {
+		t.Fatalf("自检输出 %q", detail)
+	}
+	// 按请求的大小授予时不提示
+	withSocketBuffers(t, 64, 0, 0, 0)
+	if detail := socketBufferDetail(conn); strings.Contains(detail, "⚠️") {
+		t.Fatalf("自检输出 %q", detail)
+	}
+}
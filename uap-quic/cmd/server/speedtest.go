@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"log"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 测速限制（防止被滥用为放大器）
+const (
+	speedTestMaxBytes = 64 * 1024 * 1024 // 单次上传/下载最多 64MB
+	speedTestTimeout  = 30 * time.Second // 单次测速最长 30 秒
+)
+
+// speedTestBlock 测速下行使用的随机数据块（启动时生成一次，重复发送）
+var speedTestBlock = func() []byte {
+	block := make([]byte, 32*1024)
+	rand.Read(block)
+	return block
+}()
+
+// handleSpeedTest 处理测速指令（服务端作为 sink/source）
+// 请求: 下行字节数 (4 字节, 大端)
+// 响应: 0x00 接受 / 0x01 拒绝（超出上限）
+// 之后客户端上传任意数据并关闭写方向，服务端丢弃并回复实际收到的字节数 (8 字节, 大端)，
+// 随后发送指定字节数的随机数据并关闭流
+func handleSpeedTest(stream quic.Stream) {
+	stream.SetDeadline(time.Now().Add(speedTestTimeout))
+
+	sizeBuf := make([]byte, 4)
+	if _, err := io.ReadFull(stream, sizeBuf); err != nil {
+		log.Printf("[测速] 读取下行字节数失败: %v", err)
+		return
+	}
+	downloadBytes := int64(binary.BigEndian.Uint32(sizeBuf))
+	if downloadBytes > speedTestMaxBytes {
+		log.Printf("[测速] 下行字节数超出上限: %d", downloadBytes)
+		stream.Write([]byte{0x01})
+		return
+	}
+	if _, err := stream.Write([]byte{0x00}); err != nil {
+		return
+	}
+
+	// 上行：丢弃客户端数据直到 EOF（最多 speedTestMaxBytes）
+	received, err := copyBuffer(io.Discard, io.LimitReader(stream, speedTestMaxBytes+1))
+	if err != nil {
+		log.Printf("[测速] 上行中断: %v", err)
+		return
+	}
+	if received > speedTestMaxBytes {
+		log.Printf("[测速] 上行超出上限，终止测速")
+		stream.CancelRead(0)
+		return
+	}
+
+	ack := make([]byte, 8)
+	binary.BigEndian.PutUint64(ack, uint64(received))
+	if _, err := stream.Write(ack); err != nil {
+		return
+	}
+
+	// 下行：发送随机数据
+	var sent int64
+	for sent < downloadBytes {
+		chunk := speedTestBlock
+		if remain := downloadBytes - sent; remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		n, err := stream.Write(chunk)
+		sent += int64(n)
+		if err != nil {
+			log.Printf("[测速] 下行中断: %v", err)
+			return
+		}
+	}
+
+	log.Printf("[测速] 完成: 上行 %d 字节, 下行 %d 字节", received, sent)
+}
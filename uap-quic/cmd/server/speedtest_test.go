@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestSpeedTest(t *testing.T) {
+	client := startTestNode(t).connect(t)
+
+	res, err := client.SpeedTest(1<<20, 3<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UploadBytes != 1<<20 || res.DownloadBytes != 3<<20 {
+		t.Fatalf("上行 %d / 下行 %d 字节，期望 %d / %d", res.UploadBytes, res.DownloadBytes, 1<<20, 3<<20)
+	}
+	if res.UploadMbps <= 0 || res.DownloadMbps <= 0 {
+		t.Fatalf("吞吐量 %+v", res)
+	}
+
+	// 只测下行
+	res, err = client.SpeedTest(0, 64*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UploadBytes != 0 || res.DownloadBytes != 64*1024 {
+		t.Fatalf("上行 %d / 下行 %d 字节", res.UploadBytes, res.DownloadBytes)
+	}
+}
+
+func TestSpeedTestRejectsOversizedDownload(t *testing.T) {
+	node := startTestNode(t)
+	stream := openAuthedStream(t, node.dialRaw(t))
+
+	req := []byte{0x00, 0x01, 0, 0, 0, 0} // 控制指令：测速
+	binary.BigEndian.PutUint32(req[2:], speedTestMaxBytes+1)
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		t.Fatal(err)
+	}
+	if status[0] != 0x01 {
+		t.Fatalf("超出上限的下行请求回复 0x%02x，期望拒绝 0x01", status[0])
+	}
+}
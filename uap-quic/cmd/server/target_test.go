@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// startEchoServer6 本机 IPv6 回环上的 TCP 回显服务，返回端口；不支持 IPv6 时跳过
+func startEchoServer6(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("不支持 IPv6 回环: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+// echoOnce 写入 msg 并读回同样长度的数据
+func echoOnce(t *testing.T, conn io.ReadWriter, msg string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != msg {
+		t.Fatalf("回显 %q: %v", reply, err)
+	}
+}
+
+func TestIPv6LiteralTarget(t *testing.T) {
+	port := startEchoServer6(t)
+	client := startTestNode(t).connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 版本 1 按 IPv6 类型编码，节点不需要再解析 "host:port" 中的方括号
+	conn, err := client.DialTCP(ctx, net.JoinHostPort("::1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	echoOnce(t, conn, "v6 literal")
+
+	// 缺少方括号的 IPv6 字面量在客户端即被拒绝
+	if _, err := client.DialTCP(ctx, "::1:"+port); err == nil {
+		t.Fatal("缺少方括号的 IPv6 字面量被接受")
+	}
+}
+
+func TestLegacyV0Target(t *testing.T) {
+	port := startEchoServer6(t)
+	node := startTestNode(t)
+
+	// 未协商能力的旧版客户端：鉴权后在同一条流上发送版本 0 请求
+	stream := openAuthedStream(t, node.dialRaw(t))
+	req, err := target.AppendV0(nil, net.JoinHostPort("::1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != target.StatusOK {
+		t.Fatalf("版本 0 请求回复 %v: %v", status, err)
+	}
+	echoOnce(t, stream, "v0 literal")
+
+	// 版本 0 的地址同样须能按 Parse 解析
+	stream = openAuthedStream(t, node.dialRaw(t))
+	if _, err := stream.Write(append([]byte{byte(len("::1:" + port))}, "::1:"+port...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != target.StatusFailed {
+		t.Fatalf("缺少方括号的版本 0 地址回复 %v: %v", status, err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"net"
+)
+
+// tcpFastOpen 连接 TCP 目标时启用 TCP Fast Open（-tcp-fastopen）
+// 目标之前返回过 TFO cookie 时，第一段数据（如 TLS ClientHello）随 SYN 一起发出，短连接省去一个往返；
+// 没有 cookie 的目标照常三次握手（同时申请 cookie），平台或内核不支持时退回普通连接
+// 代价：有 cookie 时 connect 被推迟到第一次写入，目标拒绝连接等错误不再在拨号时返回，而是在转发中表现为连接断开
+var tcpFastOpen bool
+
+// serverFirstPorts 目标先发言的协议（FTP / SMTP / POP3 / IMAP / MySQL 等）：客户端不先写入时推迟的 SYN 永远不会发出，这些端口不启用 TFO
+var serverFirstPorts = map[string]bool{
+	"21": true, "25": true, "110": true, "143": true, "587": true, "3306": true,
+}
+
+// configureTFO 按启动参数开启 TCP Fast Open，当前平台或内核不支持时只记录日志（照常使用普通连接）
+func configureTFO(enabled bool) {
+	if !enabled {
+		return
+	}
+	if err := checkTFO(); err != nil {
+		log.Printf("⚠️ TCP Fast Open 不可用，使用普通连接: %v", err)
+		return
+	}
+	tcpFastOpen = true
+	log.Printf("✅ 连接目标启用 TCP Fast Open（跳过目标先发言的端口）")
+}
+
+// upstreamDialer 连接 TCP 目标 addr 的 Dialer：src 非空时绑定该源地址；开启了 TFO 且目标端口不是目标先发言的协议时启用 TFO
+func upstreamDialer(src net.IP, addr string) *net.Dialer {
+	d := &net.Dialer{}
+	if src != nil {
+		d.LocalAddr = &net.TCPAddr{IP: src}
+	}
+	if tcpFastOpen {
+		if _, port, err := net.SplitHostPort(addr); err == nil && !serverFirstPorts[port] {
+			d.Control = controlTFO
+		}
+	}
+	return d
+}
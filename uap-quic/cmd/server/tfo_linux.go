@@ -0,0 +1,40 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// tcpFastOpenConnect TCP_FASTOPEN_CONNECT（Linux 4.11+）：connect 推迟到第一次写入，有 cookie 时数据随 SYN 发出
+const tcpFastOpenConnect = 30
+
+// tfoSysctl 客户端 TFO 开关（第 1 位为主动连接方启用，内核默认开启）
+var tfoSysctl = "/proc/sys/net/ipv4/tcp_fastopen"
+
+// checkTFO 检查内核是否允许主动连接使用 TFO
+func checkTFO() error {
+	data, err := os.ReadFile(tfoSysctl)
+	if err != nil {
+		return err
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("无法解析 %s: %v", tfoSysctl, err)
+	}
+	if v&1 == 0 {
+		return fmt.Errorf("%s = %d，未开启主动连接的 TFO（需设置第 1 位，如 sysctl -w net.ipv4.tcp_fastopen=1）", tfoSysctl, v)
+	}
+	return nil
+}
+
+// controlTFO 在 connect 前开启 TCP_FASTOPEN_CONNECT；内核不支持该选项时忽略，按普通连接拨号
+func controlTFO(network, address string, c syscall.RawConn) error {
+	return c.Control(func(fd uintptr) {
+		syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// checkTFO 当前平台的 Dialer 无法在拨号时携带数据（如 macOS 需要 connectx），不支持 TFO
+func checkTFO() error {
+	return fmt.Errorf("当前平台 (%s) 不支持", runtime.GOOS)
+}
+
+// controlTFO 不支持 TFO 的平台不会调用（tcpFastOpen 始终为 false）
+func controlTFO(network, address string, c syscall.RawConn) error {
+	return nil
+}
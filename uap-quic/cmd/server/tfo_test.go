@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+
+	"uap-quic/pkg/config"
+)
+
+// withTFO 按启动参数 enabled 配置 TCP Fast Open，返回是否实际启用；测试结束时关闭
+func withTFO(t *testing.T, enabled bool) bool {
+	t.Helper()
+	t.Cleanup(func() { tcpFastOpen = false })
+	configureTFO(enabled)
+	return tcpFastOpen
+}
+
+// TestTFOFlag 节点进程默认不启用 TFO，-tcp-fastopen 开启
+func TestTFOFlag(t *testing.T) {
+	bin := buildBinary(t, ".", "uap-server")
+	for _, tc := range []struct {
+		args   []string
+		value  bool
+		source string
+	}{
+		{nil, false, config.SourceDefault},
+		{[]string{"-tcp-fastopen"}, true, config.SourceFlag},
+	} {
+		cmd := exec.Command(bin, append([]string{"-print-config"}, tc.args...)...)
+		cmd.Env = append(os.Environ(), "UAP_PSK=", "UAP_ADMIN_SECRET=")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		var dump struct {
+			Config map[string]config.Entry `json:"config"`
+		}
+		if err := json.Unmarshal(out, &dump); err != nil {
+			t.Fatalf("%v: %v\n%s", tc.args, err, out)
+		}
+		if e := dump.Config["tcp-fastopen"]; e.Value != tc.value || e.Source != tc.source {
+			t.Fatalf("%v: tcp-fastopen = %+v，期望 %v 来自 %s", tc.args, e, tc.value, tc.source)
+		}
+	}
+}
+
+func TestConfigureTFO(t *testing.T) {
+	if tcpFastOpen || upstreamDialer(nil, "example.com:443").Control != nil {
+		t.Fatal("默认启用了 TFO")
+	}
+	if withTFO(t, false) {
+		t.Fatal("参数关闭时启用了 TFO")
+	}
+
+	// 平台或内核不支持时退回普通连接
+	if enabled := withTFO(t, true); enabled != (checkTFO() == nil) {
+		t.Fatalf("启用 %v，平台检查 %v", enabled, checkTFO())
+	}
+	if !tcpFastOpen {
+		if upstreamDialer(nil, "example.com:443").Control != nil {
+			t.Fatal("TFO 不可用时仍设置了 Control")
+		}
+		t.Skipf("TFO 不可用: %v", checkTFO())
+	}
+
+	for addr, want := range map[string]bool{
+		"example.com:443":  true,
+		"10.0.0.1:8080":    true,
+		"[2001:db8::1]:80": true,
+		// 目标先发言的协议不启用，推迟的 SYN 不会发出
+		"mail.example.com:25": false,
+		"10.0.0.1:3306":       false,
+		"no-port":             false,
+	} {
+		if got := upstreamDialer(nil, addr).Control != nil; got != want {
+			t.Errorf("%s 启用 TFO = %v，期望 %v", addr, got, want)
+		}
+	}
+}
+
+// TestTFOThroughNode 启用 TFO 后经节点转发 TCP 照常工作（首次连接没有 cookie，按普通握手进行）
+func TestTFOThroughNode(t *testing.T) {
+	if !withTFO(t, true) {
+		t.Skipf("TFO 不可用: %v", checkTFO())
+	}
+	client := startTestNode(t).connect(t)
+	for i := 0; i < 3; i++ {
+		if _, err := tcpEcho(client); err != nil {
+			t.Fatalf("第 %d 次回显: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// requireTicket 为 true 时只接受连接票据，拒绝直接出示的长期 JWT
+var requireTicket bool
+
+// nodeFingerprint 本节点公钥指纹，连接票据必须绑定到该指纹
+var nodeFingerprint string
+
+// nodePublicKeyPEM 本节点公钥（规范化 PEM），向 uap-admin 上报时用于识别节点
+var nodePublicKeyPEM string
+
+// ticketSeenSet 已使用票据集合（内存），防止票据被其他连接重放
+type ticketSeenSet struct {
+	mu      sync.Mutex
+	entries map[string]ticketSeenEntry
+}
+
+type ticketSeenEntry struct {
+	owner     *connState
+	expiresAt time.Time
+}
+
+// seenTickets 全局已使用票据集合
+var seenTickets = &ticketSeenSet{entries: make(map[string]ticketSeenEntry)}
+
+// ticketSweepInterval 清理过期票据的间隔（票据有效期只有几分钟，过期的条目最多多保留一个间隔）
+const ticketSweepInterval = 30 * time.Second
+
+// claim 为连接占用票据 ID，若已被其他连接占用且未过期返回 false
+func (t *ticketSeenSet) claim(jti string, owner *connState, expiresAt time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry, ok := t.entries[jti]; ok && entry.owner != owner && time.Now().Before(entry.expiresAt) {
+		return false
+	}
+	t.entries[jti] = ticketSeenEntry{owner: owner, expiresAt: expiresAt}
+	return true
+}
+
+// sweep 删除 now 时已过期的条目（过期的票据 jwt.Parse 已经拒绝，不需要再记住）
+func (t *ticketSeenSet) sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, entry := range t.entries {
+		if now.After(entry.expiresAt) {
+			delete(t.entries, id)
+		}
+	}
+}
+
+// sweepLoop 定期清理过期条目（claim 不遍历集合，票据多时握手不会变慢）
+func (t *ticketSeenSet) sweepLoop() {
+	ticker := time.NewTicker(ticketSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		t.sweep(now)
+	}
+}
+
+// loadNodeKey 读取节点公钥，返回规范化的 PEM 和指纹
+// 指纹为 DER 字节的 SHA-256（与 uap-admin 的 auth.KeyFingerprint 一致）
+func loadNodeKey(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", "", fmt.Errorf("解析节点公钥 PEM 失败")
+	}
+
+	sum := sha256.Sum256(block.Bytes)
+	return string(pem.EncodeToMemory(block)), hex.EncodeToString(sum[:]), nil
+}
+
+// walletProofWindow 签名握手时间戳允许的偏差（秒，与 uap-admin 托管签名接口一致）
+const walletProofWindow = 60
+
+// verifyTicketClaims 校验连接票据的节点绑定和一次性
+// 签名与过期时间已由 jwt.Parse 校验；proof 为鉴权行中票据之后的签名握手部分（可为空）
+func verifyTicketClaims(claims jwt.MapClaims, proof string, state *connState) error {
+	if nodeFingerprint == "" {
+		return fmt.Errorf("节点未配置公钥，无法校验票据绑定")
+	}
+
+	nod, _ := claims["nod"].(string)
+	if nod != nodeFingerprint {
+		return fmt.Errorf("票据未绑定到本节点")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("票据缺少 jti")
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return fmt.Errorf("票据缺少过期时间")
+	}
+
+	if err := verifyWalletProof(claims, jti, proof); err != nil {
+		return err
+	}
+
+	if !seenTickets.claim(jti, state, exp.Time) {
+		return fmt.Errorf("票据已被其他连接使用")
+	}
+	return nil
+}
+
+// verifyWalletProof 票据带钱包公钥 (wpk) 时校验签名握手
+// proof 格式为 "<Unix 秒>:<签名 Hex>"，签名消息为 uap-connect:<jti>:<Unix 秒>，证明出示票据的一方持有账户钱包私钥
+func verifyWalletProof(claims jwt.MapClaims, jti, proof string) error {
+	wpk, _ := claims["wpk"].(string)
+	if wpk == "" {
+		return nil
+	}
+	publicKey, err := hex.DecodeString(wpk)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("票据中的钱包公钥无效")
+	}
+
+	tsPart, sigPart, ok := strings.Cut(proof, ":")
+	if !ok {
+		return fmt.Errorf("票据要求签名握手，但鉴权行缺少钱包签名")
+	}
+	timestamp, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return fmt.Errorf("签名握手时间戳格式错误")
+	}
+	if diff := time.Now().Unix() - timestamp; diff > walletProofWindow || diff < -walletProofWindow {
+		return fmt.Errorf("签名握手时间戳超出窗口 (偏差 %d 秒)", diff)
+	}
+	signature, err := hex.DecodeString(sigPart)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("签名握手签名格式错误")
+	}
+
+	message := "uap-connect:" + jti + ":" + tsPart
+	if !ed25519.Verify(publicKey, []byte(message), signature) {
+		return fmt.Errorf("签名握手校验失败")
+	}
+	return nil
+}
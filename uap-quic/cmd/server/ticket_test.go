@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// withNodeFingerprint 测试期间设置本节点指纹
+func withNodeFingerprint(t *testing.T, fingerprint string) {
+	old := nodeFingerprint
+	nodeFingerprint = fingerprint
+	t.Cleanup(func() { nodeFingerprint = old })
+}
+
+// ticketClaims 绑定到 fingerprint 的票据声明
+func ticketClaims(fingerprint, jti string, exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{"uuid": "user-1", "nod": fingerprint, "jti": jti, "exp": float64(exp.Unix())} // 与 jwt.Parse 解析出的 JSON 数字类型一致
+}
+
+func TestTicketReplayRejected(t *testing.T) {
+	withNodeFingerprint(t, "node-fp")
+	claims := ticketClaims("node-fp", "replay-"+t.Name(), time.Now().Add(time.Minute))
+	first, second := &connState{}, &connState{}
+
+	if err := verifyTicketClaims(claims, "", first); err != nil {
+		t.Fatalf("第一次出示票据: %v", err)
+	}
+	// 同一连接上的后续流重复出示同一票据
+	if err := verifyTicketClaims(claims, "", first); err != nil {
+		t.Fatalf("同一连接再次出示票据: %v", err)
+	}
+	// 其他连接重放
+	if err := verifyTicketClaims(claims, "", second); err == nil {
+		t.Fatal("其他连接重放票据应被拒绝")
+	}
+}
+
+func TestTicketBinding(t *testing.T) {
+	withNodeFingerprint(t, "node-fp")
+	exp := time.Now().Add(time.Minute)
+
+	if err := verifyTicketClaims(ticketClaims("other-node", "bind-1", exp), "", &connState{}); err == nil {
+		t.Fatal("绑定到其他节点的票据应被拒绝")
+	}
+	if err := verifyTicketClaims(ticketClaims("node-fp", "", exp), "", &connState{}); err == nil {
+		t.Fatal("缺少 jti 的票据应被拒绝")
+	}
+	claims := ticketClaims("node-fp", "bind-2", exp)
+	delete(claims, "exp")
+	if err := verifyTicketClaims(claims, "", &connState{}); err == nil {
+		t.Fatal("缺少过期时间的票据应被拒绝")
+	}
+
+	withNodeFingerprint(t, "")
+	if err := verifyTicketClaims(ticketClaims("", "bind-3", exp), "", &connState{}); err == nil {
+		t.Fatal("节点未配置公钥时应拒绝票据")
+	}
+}
+
+func TestTicketSeenSetSweep(t *testing.T) {
+	set := &ticketSeenSet{entries: make(map[string]ticketSeenEntry)}
+	now := time.Now()
+	owner, other := &connState{}, &connState{}
+
+	set.claim("expired", owner, now.Add(-time.Second))
+	set.claim("live", owner, now.Add(time.Minute))
+
+	// 已过期的条目在清理之前也不再阻止其他连接
+	if !set.claim("expired", other, now.Add(time.Minute)) {
+		t.Fatal("已过期的票据 ID 不应阻止其他连接")
+	}
+	set.claim("stale", owner, now.Add(-time.Second))
+
+	set.sweep(now)
+	if _, ok := set.entries["stale"]; ok {
+		t.Fatal("清理后仍保留过期条目")
+	}
+	if _, ok := set.entries["live"]; !ok {
+		t.Fatal("清理删除了未过期的条目")
+	}
+	if set.claim("live", other, now.Add(time.Minute)) {
+		t.Fatal("清理后未过期的票据仍应被占用")
+	}
+}
+
+func TestTicketWalletProof(t *testing.T) {
+	withNodeFingerprint(t, "node-fp")
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	jti := "proof-" + t.Name()
+	claims := ticketClaims("node-fp", jti, time.Now().Add(time.Minute))
+	claims["wpk"] = hex.EncodeToString(pub)
+
+	ts := time.Now().Unix()
+	sign := func(msg string) string {
+		return fmt.Sprintf("%d:%s", ts, hex.EncodeToString(ed25519.Sign(priv, []byte(msg))))
+	}
+
+	if err := verifyTicketClaims(claims, "", &connState{}); err == nil {
+		t.Fatal("缺少签名握手应被拒绝")
+	}
+	if err := verifyTicketClaims(claims, sign(fmt.Sprintf("uap-connect:other:%d", ts)), &connState{}); err == nil {
+		t.Fatal("为其他票据生成的签名应被拒绝")
+	}
+	stale := fmt.Sprintf("%d:%s", ts-2*walletProofWindow, hex.EncodeToString(ed25519.Sign(priv, []byte(fmt.Sprintf("uap-connect:%s:%d", jti, ts-2*walletProofWindow)))))
+	if err := verifyTicketClaims(claims, stale, &connState{}); err == nil {
+		t.Fatal("超出时间窗口的签名应被拒绝")
+	}
+	if err := verifyTicketClaims(claims, sign(fmt.Sprintf("uap-connect:%s:%d", jti, ts)), &connState{}); err != nil {
+		t.Fatalf("有效的签名握手: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// trustedMode 信任模式（-trusted）：可信内网部署时跳过流上的 Token 鉴权与防探测伪装，流一打开就是地址帧
+// 任何能访问节点端口的人都能使用代理，客户端必须同样开启
+var trustedMode bool
+
+// trustedALPN 信任模式的 ALPN（与客户端一致）
+// 与普通模式的 h3 不同：只有一端开启信任模式时 TLS 握手直接失败，不会把鉴权行当作地址帧，也不会在公网节点上绕过鉴权
+const trustedALPN = "uap-trusted"
+
+// cgnatNet 运营商级 NAT 地址段 100.64.0.0/10（Tailscale 等 VPN 也使用该地址段）
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// checkTrustedMode 校验信任模式与鉴权相关参数是否冲突，以及监听地址是否为内网 / VPN 地址
+// 监听公网地址或全部地址（0.0.0.0 / ::）时拒绝启动，除非 override（-i-know-what-im-doing）
+func checkTrustedMode(listenAddr string, override bool) error {
+	if !trustedMode {
+		return nil
+	}
+	if preSharedKey != "" {
+		return errors.New("信任模式不校验鉴权行，不能同时设置 -psk")
+	}
+	if requireTicket {
+		return errors.New("信任模式不校验鉴权行，不能同时启用 -require-ticket")
+	}
+
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return fmt.Errorf("监听地址格式错误: %v", err)
+	}
+	host, _, _ = strings.Cut(host, "%") // 链路本地地址带 zone（fe80::1%eth0）
+	if ip := net.ParseIP(host); ip != nil && privateAddr(ip) {
+		return nil
+	}
+	if !override {
+		return fmt.Errorf("信任模式只能监听内网 / VPN 地址，-listen %s 不是（请改为内网网卡地址；确需在其他地址开启时加上 -i-know-what-im-doing）", listenAddr)
+	}
+	log.Printf("⚠️ 信任模式监听在非内网地址 %s（-i-know-what-im-doing），请确认只有可信设备能访问该端口", listenAddr)
+	return nil
+}
+
+// privateAddr 是否为内网 / VPN 地址：回环、私有地址（含 IPv6 ULA）、链路本地、100.64.0.0/10
+func privateAddr(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || cgnatNet.Contains(ip)
+}
+
+// serverALPN 节点使用的 ALPN
+func serverALPN() string {
+	if trustedMode {
+		return trustedALPN
+	}
+	return "h3" // h3 是国际标准的 HTTP/3 协议代号
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/target"
+)
+
+// withTrusted 测试期间设置节点是否为信任模式（需在启动测试节点之前调用）
+func withTrusted(t *testing.T, enabled bool) {
+	old := trustedMode
+	trustedMode = enabled
+	t.Cleanup(func() { trustedMode = old })
+}
+
+func TestTrustedMode(t *testing.T) {
+	withTrusted(t, true)
+	node := startTestNode(t)
+
+	// 信任模式的客户端不需要 Token
+	client := core.NewClient(node.addr, "", 0, core.ModeGlobal)
+	client.SetTrusted(true)
+	t.Cleanup(client.Stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tcpEcho(client); err != nil {
+		t.Fatalf("TCP 回显: %v", err)
+	}
+
+	// 流一打开就是地址帧，没有鉴权行与鉴权回复
+	stream, err := node.dialRaw(t).OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(10 * time.Second))
+	req, _ := target.AppendV0(nil, startEchoServer(t))
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != target.StatusOK {
+		t.Fatalf("地址帧回复 %v: %v", status, err)
+	}
+	echoOnce(t, stream, "trusted")
+}
+
+func TestTrustedModeMismatch(t *testing.T) {
+	for _, serverTrusted := range []bool{true, false} {
+		t.Run(map[bool]string{true: "节点开启", false: "客户端开启"}[serverTrusted], func(t *testing.T) {
+			withTrusted(t, serverTrusted)
+			node := startTestNode(t)
+			client := core.NewClient(node.addr, testJWTToken, 0, core.ModeGlobal)
+			client.SetPSK(preSharedKey)
+			client.SetTrusted(!serverTrusted)
+			t.Cleanup(client.Stop)
+
+			// 只有一端开启时 TLS 握手失败，不会把鉴权行当作地址帧
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := client.Connect(ctx)
+			if err == nil {
+				t.Fatal("信任模式不一致时连接成功")
+			}
+			if !strings.Contains(err.Error(), "-trusted") {
+				t.Fatalf("错误未提示信任模式不一致: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckTrustedMode(t *testing.T) {
+	withTrusted(t, false)
+	if err := checkTrustedMode("0.0.0.0:443", false); err != nil {
+		t.Fatalf("未开启信任模式时返回 %v", err)
+	}
+
+	withTrusted(t, true)
+	for _, addr := range []string{"127.0.0.1:443", "10.0.0.1:443", "192.168.1.1:443", "100.64.1.1:443", "[fd00::1]:443", "[fe80::1%eth0]:443"} {
+		if err := checkTrustedMode(addr, false); err != nil {
+			t.Errorf("内网地址 %s 返回 %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"0.0.0.0:443", "[::]:443", ":443", "203.0.113.1:443", "bad"} {
+		if err := checkTrustedMode(addr, false); err == nil {
+			t.Errorf("监听 %s 时应拒绝启动", addr)
+		}
+	}
+	if err := checkTrustedMode("0.0.0.0:443", true); err != nil {
+		t.Fatalf("-i-know-what-im-doing 时返回 %v", err)
+	}
+
+	// 信任模式不校验鉴权行，与 PSK、票据冲突
+	oldPSK, oldTicket := preSharedKey, requireTicket
+	t.Cleanup(func() { preSharedKey, requireTicket = oldPSK, oldTicket })
+	preSharedKey = "secret"
+	if err := checkTrustedMode("127.0.0.1:443", false); err == nil {
+		t.Fatal("同时设置 -psk 时应拒绝启动")
+	}
+	preSharedKey, requireTicket = "", true
+	if err := checkTrustedMode("127.0.0.1:443", false); err == nil {
+		t.Fatal("同时启用 -require-ticket 时应拒绝启动")
+	}
+}
+
+// writeTestCertFiles 把测试证书与私钥写入临时目录，返回证书与私钥文件路径
+func writeTestCertFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalECPrivateKey(testCert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestTrustedModeGuardRails 节点进程按启动参数拒绝或允许信任模式（以自检模式运行，通过后即退出）
+func TestTrustedModeGuardRails(t *testing.T) {
+	bin := buildBinary(t, ".", "uap-server")
+	certFile, keyFile := writeTestCertFiles(t)
+
+	cases := []struct {
+		name string
+		args []string
+		ok   bool
+		want string
+	}{
+		{"内网地址", []string{"-listen", "127.0.0.1:52222"}, true, "全部通过"},
+		{"全部地址", []string{"-listen", "0.0.0.0:52222"}, false, "信任模式只能监听内网 / VPN 地址"},
+		{"公网地址", []string{"-listen", "203.0.113.1:52222"}, false, "信任模式只能监听内网 / VPN 地址"},
+		{"确认后允许全部地址", []string{"-listen", "0.0.0.0:52222", "-i-know-what-im-doing"}, true, "信任模式监听在非内网地址"},
+		{"与 PSK 冲突", []string{"-listen", "127.0.0.1:52222", "-psk", "secret"}, false, "不能同时设置 -psk"},
+		{"与票据冲突", []string{"-listen", "127.0.0.1:52222", "-require-ticket"}, false, "不能同时启用 -require-ticket"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{"-trusted", "-selftest", "-cert", certFile, "-key", keyFile}, tc.args...)
+			cmd := exec.Command(bin, args...)
+			cmd.Dir = t.TempDir()
+			cmd.Env = append(os.Environ(), "UAP_PSK=")
+			out, err := cmd.CombinedOutput()
+			if (err == nil) != tc.ok || !strings.Contains(string(out), tc.want) {
+				t.Fatalf("退出 %v，期望成功=%v 且输出包含 %q:\n%s", err, tc.ok, tc.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resolveLogInterval UDP 域名解析失败日志的最小间隔（期间的失败只计数，下次打印时汇总）
+const resolveLogInterval = 10 * time.Second
+
+// udpResolveFailures 累计的 UDP 目标域名解析失败次数（所有连接共享）
+var udpResolveFailures atomic.Int64
+
+// resolveLog 解析失败日志限流
+var resolveLog struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int64
+}
+
+// resolveError UDP 目标域名解析失败（SOCKS5 ATYP=0x03）
+type resolveError struct {
+	domain string
+	port   uint16
+	header []byte // 原始 SOCKS5 UDP 头部（RSV + FRAG + ATYP + DST.ADDR + DST.PORT），回包时原样使用
+	query  []byte // 原始载荷
+	err    error
+}
+
+func (e *resolveError) Error() string {
+	return fmt.Sprintf("解析域名失败 %s: %v", e.domain, e.err)
+}
+
+func (e *resolveError) Unwrap() error {
+	return e.err
+}
+
+// handleResolveFailure 记录一次 UDP 域名解析失败（计数 + 限流日志）
+// 目标为 53 端口时返回 SOCKS5 封装的 SERVFAIL 回包，让应用立即失败而不是等待超时；其他情况返回 nil
+func handleResolveFailure(tag string, e *resolveError) []byte {
+	total := udpResolveFailures.Add(1)
+
+	now := time.Now()
+	resolveLog.mu.Lock()
+	if now.Sub(resolveLog.last) >= resolveLogInterval {
+		suppressed := resolveLog.suppressed
+		resolveLog.last = now
+		resolveLog.suppressed = 0
+		resolveLog.mu.Unlock()
+		log.Printf("⚠️ %s %v（累计 %d 次，上次日志后另有 %d 次未打印）", tag, e, total, suppressed)
+	} else {
+		resolveLog.suppressed++
+		resolveLog.mu.Unlock()
+	}
+
+	if e.port != 53 {
+		return nil
+	}
+	reply := dnsServfail(e.query)
+	if reply == nil {
+		return nil
+	}
+	return append(append([]byte(nil), e.header...), reply...)
+}
+
+// dnsServfail 根据 DNS 查询构造 SERVFAIL 响应（保留 ID、RD 与问题段）
+// 载荷不是 DNS 查询时返回 nil
+func dnsServfail(query []byte) []byte {
+	const headerLen = 12
+	if len(query) < headerLen || query[2]&0x80 != 0 { // 太短或本身是响应
+		return nil
+	}
+
+	// 问题段结束位置；解析失败时只回复头部
+	qdcount := binary.BigEndian.Uint16(query[4:6])
+	end, ok := skipQuestions(query, headerLen, int(qdcount))
+	if !ok {
+		end, qdcount = headerLen, 0
+	}
+
+	reply := make([]byte, end)
+	copy(reply, query[:end])
+	reply[2] = 0x80 | query[2]&0x79 // QR=1，保留 Opcode 与 RD，清除 AA / TC
+	reply[3] = 0x80 | 0x02          // RA=1，RCODE=2 (SERVFAIL)
+	binary.BigEndian.PutUint16(reply[4:6], qdcount)
+	binary.BigEndian.PutUint16(reply[6:8], 0)   // ANCOUNT
+	binary.BigEndian.PutUint16(reply[8:10], 0)  // NSCOUNT
+	binary.BigEndian.PutUint16(reply[10:12], 0) // ARCOUNT（丢弃 EDNS OPT 等附加记录）
+	return reply
+}
+
+// skipQuestions 跳过 count 个问题（QNAME + QTYPE + QCLASS），返回问题段结束的偏移
+func skipQuestions(msg []byte, off, count int) (int, bool) {
+	for i := 0; i < count; i++ {
+		for {
+			if off >= len(msg) {
+				return 0, false
+			}
+			n := int(msg[off])
+			if n == 0 {
+				off++
+				break
+			}
+			if n&0xC0 == 0xC0 { // 压缩指针（2 字节），名字到此结束
+				off += 2
+				break
+			}
+			off += 1 + n
+		}
+		off += 4
+		if off > len(msg) {
+			return 0, false
+		}
+	}
+	return off, true
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// unresolvableDomain 保留的 .invalid 顶级域名，解析总是失败
+const unresolvableDomain = "uap-test.invalid"
+
+// dnsQuery 构造查询 name 的 A 记录的 DNS 报文
+func dnsQuery(id uint16, name string) []byte {
+	q := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range bytes.Split([]byte(name), []byte(".")) {
+		q = append(append(q, byte(len(label))), label...)
+	}
+	return append(q, 0, 0, 1, 0, 1)
+}
+
+// checkServfail 校验 reply 是对 query 的 SERVFAIL 应答（ID 与问题段不变）
+func checkServfail(t *testing.T, query, reply []byte) {
+	t.Helper()
+	if len(reply) != len(query) || !bytes.Equal(reply[:2], query[:2]) || !bytes.Equal(reply[12:], query[12:]) {
+		t.Fatalf("SERVFAIL 应答与查询不匹配: %x / %x", reply, query)
+	}
+	if reply[2]&0x80 == 0 || reply[3]&0x0F != 2 {
+		t.Fatalf("不是 SERVFAIL 应答: flags=%x %x", reply[2], reply[3])
+	}
+}
+
+// domainHeader SOCKS5 UDP 请求头（ATYP=0x03）
+func domainHeader(domain string, port uint16) []byte {
+	h := []byte{0, 0, 0, 0x03, byte(len(domain))}
+	h = append(h, domain...)
+	return binary.BigEndian.AppendUint16(h, port)
+}
+
+func TestResolveFailureCountsAndServfail(t *testing.T) {
+	query := dnsQuery(0xBEEF, "example.com")
+
+	before := udpResolveFailures.Load()
+	header := domainHeader(unresolvableDomain, 53)
+	_, _, err := parseSOCKS5UDPHeader(append(append([]byte(nil), header...), query...))
+	resolveErr, ok := err.(*resolveError)
+	if !ok {
+		t.Fatalf("期望 resolveError，实际 %v", err)
+	}
+	reply := handleResolveFailure("[test]", resolveErr)
+	if got := udpResolveFailures.Load() - before; got != 1 {
+		t.Fatalf("解析失败计数增加了 %d", got)
+	}
+	if !bytes.Equal(reply[:len(header)], header) {
+		t.Fatalf("回包头部 %x，期望原样使用请求头部 %x", reply[:len(header)], header)
+	}
+	checkServfail(t, query, reply[len(header):])
+
+	// 非 53 端口只计数，不回包
+	_, _, err = parseSOCKS5UDPHeader(append(domainHeader(unresolvableDomain, 443), "data"...))
+	if reply := handleResolveFailure("[test]", err.(*resolveError)); reply != nil {
+		t.Fatalf("非 DNS 目标不应回包: %x", reply)
+	}
+	if got := udpResolveFailures.Load() - before; got != 2 {
+		t.Fatalf("解析失败计数增加了 %d，期望 2", got)
+	}
+}
+
+func TestDNSServfailIgnoresNonQueries(t *testing.T) {
+	query := dnsQuery(1, "example.com")
+	response := append([]byte(nil), query...)
+	response[2] |= 0x80
+	for name, payload := range map[string][]byte{"过短": query[:5], "已是响应": response} {
+		if reply := dnsServfail(payload); reply != nil {
+			t.Errorf("%s: 不应构造 SERVFAIL: %x", name, reply)
+		}
+	}
+
+	// EDNS 附加记录被丢弃，问题段无法解析时只回复头部
+	withOPT := append(append([]byte(nil), query...), 0, 0, 41, 0x10, 0, 0, 0, 0, 0, 0, 0)
+	withOPT[11] = 1
+	if reply := dnsServfail(withOPT); len(reply) != len(query) || reply[11] != 0 {
+		t.Errorf("带 OPT 的查询应答 %x", reply)
+	}
+	broken := append([]byte(nil), query[:14]...)
+	if reply := dnsServfail(broken); len(reply) != 12 || reply[5] != 0 {
+		t.Errorf("问题段损坏的应答 %x", reply)
+	}
+}
+
+func TestResolveFailureServfailOverTunnel(t *testing.T) {
+	node := startTestNode(t)
+	query := dnsQuery(0x1234, "example.com")
+
+	t.Run("stream", func(t *testing.T) {
+		client := node.connect(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := client.DialUDP(ctx, net.JoinHostPort(unresolvableDomain, "53"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(query); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 512)
+		n, err := conn.Read(reply)
+		if err != nil {
+			t.Fatalf("未收到 SERVFAIL: %v", err)
+		}
+		checkServfail(t, query, reply[:n])
+	})
+
+	t.Run("datagram", func(t *testing.T) {
+		port := freePort(t)
+		client := node.newClientOnPort(t, port)
+		go client.Start("")
+		_, relayAddr := socksUDPAssociate(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		relayAddr.IP = net.IPv4(127, 0, 0, 1)
+		app, err := net.DialUDP("udp", nil, relayAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		header := domainHeader(unresolvableDomain, 53)
+		if _, err := app.Write(append(append([]byte(nil), header...), query...)); err != nil {
+			t.Fatal(err)
+		}
+		app.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reply := make([]byte, 512)
+		n, err := app.Read(reply)
+		if err != nil {
+			t.Fatalf("未收到 SERVFAIL: %v", err)
+		}
+		if n < len(header) {
+			t.Fatalf("回包过短: %x", reply[:n])
+		}
+		checkServfail(t, query, reply[len(header):n])
+	})
+}
+
+// TestUDPHeaderRejectsBadDomain 空域名、含空白或控制字符的域名在解析之前拒绝，不发出 DNS 查询也不计入解析失败
+func TestUDPHeaderRejectsBadDomain(t *testing.T) {
+	before := udpResolveFailures.Load()
+	if _, _, err := parseSOCKS5UDPHeader(append(domainHeader("", 53), "data"...)); err == nil {
+		t.Error("空域名被接受")
+	}
+	for _, domain := range []string{" ", "bad host", "a\x00b", "a\r\nb", "[::1]"} {
+		_, _, err := parseSOCKS5UDPHeader(append(domainHeader(domain, 53), "data"...))
+		if !errors.Is(err, target.ErrBadAddress) {
+			t.Errorf("域名 %q 返回 %v，期望 ErrBadAddress", domain, err)
+		}
+	}
+	if got := udpResolveFailures.Load() - before; got != 0 {
+		t.Fatalf("非法域名计入了 %d 次解析失败", got)
+	}
+}
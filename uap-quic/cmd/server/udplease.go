@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDP 出口租约的限制
+const (
+	leaseMaxPerUser = 8 // 每个用户最多保留的租约（超出时淘汰该用户最早的租约）
+	leaseTargets    = 8 // 每个出口 socket 记录的目标数，租约可按其中任一目标认领
+)
+
+// udpLeases UDP 出口 socket 租约（-udp-lease，nil 表示不启用）
+var udpLeases *leaseTable
+
+// leaseTable UDP 关联结束后保留其出口 socket：同一用户在保留期内重新建立的关联发往同一目标时认领该 socket，
+// 目标看到的外部端口保持不变（类似 full-cone NAT 的映射保持），游戏短暂断线重连后不会被服务器当作新玩家
+// 保留期内没有人读取 socket，目标发来的包留在内核缓冲区中，认领后照常转发
+type leaseTable struct {
+	grace time.Duration
+	max   int
+
+	mu    sync.Mutex
+	byKey map[string]*udpLease // 用户|出口|目标 → 租约
+	all   []*udpLease          // 按放入顺序（最早的在前）
+
+	leased    atomic.Int64 // 放入的租约数
+	reclaimed atomic.Int64 // 被认领的租约数
+	expired   atomic.Int64 // 保留期满关闭的租约数
+	evicted   atomic.Int64 // 超出上限被淘汰的租约数
+}
+
+// udpLease 一个保留中的出口 socket
+type udpLease struct {
+	conn  *net.UDPConn
+	user  string
+	keys  []string
+	timer *time.Timer
+}
+
+// newLeaseTable grace 为保留时长（<= 0 时返回 nil），max 为全部租约的上限
+func newLeaseTable(grace time.Duration, max int) (*leaseTable, error) {
+	if grace <= 0 {
+		return nil, nil
+	}
+	if max <= 0 {
+		return nil, fmt.Errorf("UDP 出口租约上限必须大于 0")
+	}
+	return &leaseTable{grace: grace, max: max, byKey: make(map[string]*udpLease)}, nil
+}
+
+// leaseKey 租约的键：出口 socket 按用户、socket 类别（默认出口为空，路由策略 / 游戏流量出口为其源地址键）与目标区分
+func leaseKey(user, socket string, target netip.AddrPort) string {
+	return user + "|" + socket + "|" + target.String()
+}
+
+// put 保留关联结束时的出口 socket，按发往过的每个目标登记；不能保留（用户未知、没有发过包）时返回 false，由调用方关闭
+// 同一用户的旧租约与新租约有相同目标时，旧租约被淘汰
+func (t *leaseTable) put(user, socket string, conn *net.UDPConn, targets []netip.AddrPort) bool {
+	if user == "" || len(targets) == 0 {
+		return false
+	}
+	l := &udpLease{conn: conn, user: user}
+	for _, target := range targets {
+		l.keys = append(l.keys, leaseKey(user, socket, target))
+	}
+
+	t.mu.Lock()
+	var evicted []*udpLease
+	for _, key := range l.keys {
+		if old, ok := t.byKey[key]; ok {
+			t.removeLocked(old)
+			evicted = append(evicted, old)
+		}
+	}
+	userLeases := 0
+	for _, old := range t.all {
+		if old.user == user {
+			userLeases++
+		}
+	}
+	for i := 0; i < len(t.all) && userLeases >= leaseMaxPerUser; {
+		if old := t.all[i]; old.user == user {
+			t.removeLocked(old)
+			evicted = append(evicted, old)
+			userLeases--
+			continue
+		}
+		i++
+	}
+	for len(t.all) >= t.max {
+		old := t.all[0]
+		t.removeLocked(old)
+		evicted = append(evicted, old)
+	}
+	for _, key := range l.keys {
+		t.byKey[key] = l
+	}
+	t.all = append(t.all, l)
+	l.timer = time.AfterFunc(t.grace, func() { t.expire(l) })
+	t.mu.Unlock()
+
+	for _, old := range evicted {
+		old.timer.Stop()
+		old.conn.Close()
+	}
+	t.evicted.Add(int64(len(evicted)))
+	t.leased.Add(1)
+	return true
+}
+
+// take 认领用户发往 target 的出口 socket（没有时返回 nil）
+func (t *leaseTable) take(user, socket string, target netip.AddrPort) *net.UDPConn {
+	if user == "" {
+		return nil
+	}
+	t.mu.Lock()
+	l, ok := t.byKey[leaseKey(user, socket, target)]
+	if ok {
+		t.removeLocked(l)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	l.timer.Stop()
+	l.conn.SetReadDeadline(time.Time{})
+	t.reclaimed.Add(1)
+	return l.conn
+}
+
+// expire 保留期满：租约仍未被认领时关闭 socket
+func (t *leaseTable) expire(l *udpLease) {
+	t.mu.Lock()
+	removed := t.removeLocked(l)
+	t.mu.Unlock()
+	if removed {
+		l.conn.Close()
+		t.expired.Add(1)
+	}
+}
+
+// removeLocked 移除租约的所有键，返回是否仍在表中（持有 mu 时调用）
+func (t *leaseTable) removeLocked(l *udpLease) bool {
+	for i, cur := range t.all {
+		if cur == l {
+			t.all = append(t.all[:i], t.all[i+1:]...)
+			for _, key := range l.keys {
+				if t.byKey[key] == l {
+					delete(t.byKey, key)
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// leaseStats UDP 出口租约统计（健康检查接口输出）
+type leaseStats struct {
+	Active    int   `json:"active"`    // 保留中的 socket 数
+	Leased    int64 `json:"leased"`    // 关联结束后保留的 socket 数
+	Reclaimed int64 `json:"reclaimed"` // 重新建立的关联认领了保留的 socket 的次数
+	Expired   int64 `json:"expired"`   // 保留期满未被认领而关闭的 socket 数
+	Evicted   int64 `json:"evicted"`   // 超出上限被提前关闭的 socket 数
+}
+
+// stats 租约统计（未启用时返回 nil）
+func (t *leaseTable) stats() *leaseStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	active := len(t.all)
+	t.mu.Unlock()
+	return &leaseStats{
+		Active:    active,
+		Leased:    t.leased.Load(),
+		Reclaimed: t.reclaimed.Load(),
+		Expired:   t.expired.Load(),
+		Evicted:   t.evicted.Load(),
+	}
+}
+
+// leaseTarget 出口 socket 的目标（IPv4 映射的 IPv6 地址统一为 IPv4）
+func leaseTarget(addr *net.UDPAddr) netip.AddrPort {
+	ap := addr.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// trackLocked 记录 socket 发往的目标（最多 leaseTargets 个，持有 e.mu 时调用）
+func (e *udpEgress) trackLocked(conn *net.UDPConn, target netip.AddrPort) {
+	targets := e.targets[conn]
+	if len(targets) >= leaseTargets {
+		return
+	}
+	for _, t := range targets {
+		if t == target {
+			return
+		}
+	}
+	e.targets[conn] = append(targets, target)
+}
+
+// claimDefaultLocked 认领该用户发往 target 的租约替换关联新建的默认出口（持有 e.mu 时调用）
+// 只在确定用户后的第一个包时认领一次：Datagram 本身不携带鉴权，连接上的流鉴权之前用户未知，此前的包仍从新建的出口发出
+func (e *udpEgress) claimDefaultLocked(target netip.AddrPort) {
+	if e.defaultUsed {
+		return
+	}
+	user := e.user()
+	if user == "" {
+		return
+	}
+	e.defaultUsed = true
+	conn := udpLeases.take(user, "", target)
+	if conn == nil {
+		return
+	}
+	fresh := e.UDPConn
+	e.UDPConn = conn
+	delete(e.targets, fresh)
+	fresh.Close()
+	e.start(conn)
+	log.Printf("[UDP] 认领出口租约: %s → %s (替换 %s)", conn.LocalAddr(), target, fresh.LocalAddr())
+}
+
+// releaseLocked 关联结束时保留发过包的出口 socket：先打断回包读取流程，读取流程全部退出后放入租约表（持有 e.mu 时调用）
+// 返回不能保留、由调用方直接关闭的 socket
+func (e *udpEgress) releaseLocked(conns map[string]*net.UDPConn) []*net.UDPConn {
+	user := e.user()
+	var keep []string
+	var closeNow []*net.UDPConn
+	for socket, conn := range conns {
+		if user == "" || len(e.targets[conn]) == 0 {
+			closeNow = append(closeNow, conn)
+			continue
+		}
+		conn.SetReadDeadline(time.Unix(1, 0))
+		keep = append(keep, socket)
+	}
+	if len(keep) == 0 {
+		return closeNow
+	}
+	targets := e.targets
+	go func() {
+		e.readers.Wait()
+		for _, socket := range keep {
+			conn := conns[socket]
+			if !udpLeases.put(user, socket, conn, targets[conn]) {
+				conn.Close()
+			}
+		}
+	}()
+	return closeNow
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// withUDPLeases 测试期间启用 UDP 出口租约（须在 startTestNode 之前调用）
+func withUDPLeases(t *testing.T, grace time.Duration, max int) *leaseTable {
+	t.Helper()
+	table, err := newLeaseTable(grace, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpLeases = table
+	t.Cleanup(func() { udpLeases = nil })
+	return table
+}
+
+// newLeaseConn 本机 UDP socket，测试结束时关闭
+func newLeaseConn(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// leaseClosed socket 是否已被租约表关闭
+func leaseClosed(conn *net.UDPConn) bool {
+	return conn.SetReadDeadline(time.Time{}) != nil
+}
+
+// gameTarget 测试用的目标地址
+func gameTarget(port int) netip.AddrPort {
+	return netip.AddrPortFrom(netip.MustParseAddr("192.0.2.1"), uint16(port))
+}
+
+// startGameServer 本机 UDP 游戏服务：回显每个包，并把包的来源端口（节点的外部端口）发到返回的通道
+func startGameServer(t *testing.T) (string, chan int) {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	ports := make(chan int, 16)
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case ports <- addr.Port:
+			default:
+			}
+			pc.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return pc.LocalAddr().String(), ports
+}
+
+// gameExitPort 客户端经隧道向游戏服务发一个包，返回游戏服务看到的外部端口（关闭关联后返回）
+func gameExitPort(t *testing.T, client *core.Client, addr string, ports chan int) int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.DialUDP(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("join")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 64)); err != nil {
+		t.Fatalf("未收到游戏服务的回包: %v", err)
+	}
+	return <-ports
+}
+
+// waitLeases 等待租约统计满足 ok（关联结束后 socket 在回包读取流程退出后才异步放入租约表）
+func waitLeases(t *testing.T, table *leaseTable, ok func(*leaseStats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(table.stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("租约统计 %+v", table.stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// leasesActive 保留中的租约数为 n
+func leasesActive(n int) func(*leaseStats) bool {
+	return func(s *leaseStats) bool { return s.Active == n }
+}
+
+// TestUDPLeaseReconnect 客户端断线重连后发往同一游戏服务，游戏服务看到的外部端口不变
+func TestUDPLeaseReconnect(t *testing.T) {
+	table := withUDPLeases(t, time.Minute, 16)
+	node := startTestNode(t)
+	game, ports := startGameServer(t)
+
+	first := node.connect(t)
+	port := gameExitPort(t, first, game, ports)
+	first.Stop() // 断线
+	waitLeases(t, table, leasesActive(1))
+
+	second := node.connect(t)
+	if got := gameExitPort(t, second, game, ports); got != port {
+		t.Fatalf("重连后外部端口 %d，期望沿用 %d", got, port)
+	}
+	if s := table.stats(); s.Reclaimed != 1 {
+		t.Fatalf("租约统计 %+v", s)
+	}
+
+	// 同一关联内再次发包仍使用认领的 socket；关联结束后再次放回
+	if got := gameExitPort(t, second, game, ports); got != port {
+		t.Fatalf("第二次关联外部端口 %d，期望 %d", got, port)
+	}
+	waitLeases(t, table, func(s *leaseStats) bool { return s.Leased == 3 && s.Reclaimed == 2 && s.Active == 1 })
+}
+
+// TestUDPLeaseOtherUser 其他用户不能认领租约，新建自己的出口
+func TestUDPLeaseOtherUser(t *testing.T) {
+	table := withUDPLeases(t, time.Minute, 16)
+	node := startTestNode(t)
+	game, ports := startGameServer(t)
+
+	port := gameExitPort(t, node.connect(t), game, ports)
+	waitLeases(t, table, leasesActive(1))
+
+	other := core.NewClient(node.addr, signTestToken("other-user", time.Hour), 0, core.ModeGlobal)
+	other.SetPSK(preSharedKey)
+	other.SetTrusted(trustedMode)
+	t.Cleanup(other.Stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := other.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := gameExitPort(t, other, game, ports); got == port {
+		t.Fatalf("其他用户沿用了外部端口 %d", got)
+	}
+	waitLeases(t, table, leasesActive(2))
+	if s := table.stats(); s.Reclaimed != 0 {
+		t.Fatalf("租约被其他用户认领: %+v", s)
+	}
+}
+
+func TestLeaseTable(t *testing.T) {
+	if table, err := newLeaseTable(0, 10); table != nil || err != nil {
+		t.Fatalf("未启用: %v, %v", table, err)
+	}
+	if _, err := newLeaseTable(time.Minute, 0); err == nil {
+		t.Fatal("上限为 0 未报错")
+	}
+	if (*leaseTable)(nil).stats() != nil {
+		t.Fatal("未启用时有统计")
+	}
+
+	table, _ := newLeaseTable(time.Minute, 16)
+	conn := newLeaseConn(t)
+	// 用户未知、没有发过包的 socket 不保留
+	if table.put("", "", conn, []netip.AddrPort{gameTarget(1)}) || table.put("alice", "", conn, nil) {
+		t.Fatal("保留了不能认领的 socket")
+	}
+
+	// 按发往过的任一目标认领，不跨用户、不跨 socket 类别
+	if !table.put("alice", "", conn, []netip.AddrPort{gameTarget(1), gameTarget(2)}) {
+		t.Fatal("未保留 socket")
+	}
+	if table.take("bob", "", gameTarget(1)) != nil || table.take("alice", "203.0.113.1", gameTarget(1)) != nil || table.take("alice", "", gameTarget(3)) != nil {
+		t.Fatal("认领了不匹配的租约")
+	}
+	if got := table.take("alice", "", gameTarget(2)); got != conn || leaseClosed(conn) {
+		t.Fatal("未认领到租约")
+	}
+	if table.take("alice", "", gameTarget(1)) != nil {
+		t.Fatal("已认领的租约仍可按其他目标认领")
+	}
+
+	// 同一目标的新租约淘汰旧租约
+	old, fresh := newLeaseConn(t), newLeaseConn(t)
+	table.put("alice", "", old, []netip.AddrPort{gameTarget(5)})
+	table.put("alice", "", fresh, []netip.AddrPort{gameTarget(5)})
+	if !leaseClosed(old) || table.take("alice", "", gameTarget(5)) != fresh {
+		t.Fatal("同一目标的旧租约未被淘汰")
+	}
+	if s := table.stats(); s.Active != 0 || s.Leased != 3 || s.Reclaimed != 2 || s.Evicted != 1 {
+		t.Fatalf("租约统计 %+v", s)
+	}
+}
+
+func TestLeaseTableCaps(t *testing.T) {
+	// 每个用户最多 leaseMaxPerUser 个，超出时淘汰该用户最早的
+	table, _ := newLeaseTable(time.Minute, 100)
+	var conns []*net.UDPConn
+	for i := 0; i <= leaseMaxPerUser; i++ {
+		conn := newLeaseConn(t)
+		conns = append(conns, conn)
+		table.put("alice", "", conn, []netip.AddrPort{gameTarget(i + 1)})
+	}
+	table.put("bob", "", newLeaseConn(t), []netip.AddrPort{gameTarget(1)})
+	if s := table.stats(); s.Active != leaseMaxPerUser+1 || s.Evicted != 1 || !leaseClosed(conns[0]) || leaseClosed(conns[1]) {
+		t.Fatalf("用户上限: %+v", s)
+	}
+
+	// 全部租约的上限：淘汰最早的
+	table, _ = newLeaseTable(time.Minute, 2)
+	first := newLeaseConn(t)
+	table.put("alice", "", first, []netip.AddrPort{gameTarget(1)})
+	for _, user := range []string{"bob", "carol"} {
+		table.put(user, "", newLeaseConn(t), []netip.AddrPort{gameTarget(1)})
+	}
+	if s := table.stats(); s.Active != 2 || s.Evicted != 1 || !leaseClosed(first) || table.take("alice", "", gameTarget(1)) != nil {
+		t.Fatalf("总上限: %+v", s)
+	}
+}
+
+func TestLeaseTableExpiry(t *testing.T) {
+	table, _ := newLeaseTable(50*time.Millisecond, 16)
+	conn := newLeaseConn(t)
+	table.put("alice", "", conn, []netip.AddrPort{gameTarget(1)})
+	waitLeases(t, table, leasesActive(0))
+	if s := table.stats(); s.Expired != 1 || !leaseClosed(conn) {
+		t.Fatalf("保留期满: %+v", s)
+	}
+	if table.take("alice", "", gameTarget(1)) != nil {
+		t.Fatal("过期的租约仍可认领")
+	}
+}
+
+// TestLeaseTarget IPv4 映射的 IPv6 地址与 IPv4 地址是同一目标
+func TestLeaseTarget(t *testing.T) {
+	mapped := leaseTarget(&net.UDPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 27015})
+	plain := leaseTarget(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 27015})
+	if mapped != plain || leaseKey("u", "", mapped) != fmt.Sprintf("u||%s", plain) {
+		t.Fatalf("%v / %v", mapped, plain)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"uap-quic/pkg/target"
+	"uap-quic/pkg/udpstream"
+
+	"github.com/quic-go/quic-go"
+)
+
+// handleUDPStream 处理 UDP over Stream 指令（QUIC Datagram 不可用时的回退通道）
+// 响应: 0x00 接受；之后双向传输长度前缀帧 (2 字节长度, 大端 + SOCKS5 UDP 数据包)，格式与 Datagram 通道一致
+// 每条流使用独立的 UDP 出口，客户端关闭流即结束关联
+func handleUDPStream(stream quic.Stream, state *connState, sl streamLog) {
+	guard := newAmpGuard("[UDP Stream]")
+
+	// 回包与 SERVFAIL 应答都会写流，写入需加锁保证帧完整
+	var writeMu sync.Mutex
+	writeFrame := func(packet []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return udpstream.WriteFrame(stream, packet)
+	}
+
+	// 转告目标返回的 ICMP 不可达（见 udpunreach.go）
+	sendUnreachable := func(udpConn *net.UDPConn) {
+		for _, reply := range unreachableReplies(udpConn, state) {
+			writeFrame(reply)
+		}
+	}
+
+	// 接收流程 (Target -> Server -> Client)，每个 UDP 出口 Socket 一个
+	// 读取或写流失败后取消读方向，让发送流程的 ReadFrame 返回；Socket 关闭（或转入出口租约）时直接退出
+	readReplies := func(udpConn *net.UDPConn) {
+		buffer := make([]byte, udpstream.MaxFrameSize)
+		for {
+			n, sourceAddr, err := udpConn.ReadFromUDP(buffer)
+			if err != nil {
+				if isUnreachable(err) {
+					sendUnreachable(udpConn)
+					continue
+				}
+				if !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+					log.Printf("[UDP Stream] 读取 UDP 数据失败: %v", err)
+					stream.CancelRead(0)
+				}
+				return
+			}
+			if !guard.allowReply(sourceAddr, n) {
+				continue
+			}
+
+			if err := writeFrame(buildSOCKS5UDPHeader(sourceAddr, buffer[:n])); err != nil {
+				log.Printf("[UDP Stream] 回包写入流失败: %v", err)
+				stream.CancelRead(0)
+				return
+			}
+			state.bytesDown.Add(int64(n))
+		}
+	}
+
+	udpConn, err := listenEgressUDP(remoteIP(state.conn.RemoteAddr()), state.user, readReplies)
+	if err != nil {
+		log.Printf("[UDP Stream] 创建 UDP Socket 失败: %v", err)
+		stream.Write([]byte{0x01}) // 失败信号
+		return
+	}
+	defer udpConn.Close()
+	udpConn.unreachable = sendUnreachable
+
+	if _, err := stream.Write([]byte{0x00}); err != nil {
+		return
+	}
+	sl.Printf("[UDP Stream] 已创建 UDP 出口: %s", udpConn.LocalAddr())
+
+	// 发送流程 (Client -> Server -> Target)
+	buffer := make([]byte, udpstream.MaxFrameSize)
+	for {
+		data, err := udpstream.ReadFrame(stream, buffer)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[UDP Stream] 读取帧失败: %v", err)
+			}
+			break
+		}
+
+		targetAddr, payload, err := parseSOCKS5UDPHeader(data)
+		if err != nil {
+			var resolveErr *resolveError
+			if !errors.As(err, &resolveErr) {
+				log.Printf("[UDP Stream] 解析 SOCKS5 头部失败: %v", err)
+				continue
+			}
+			if reply := handleResolveFailure("[UDP Stream]", resolveErr); reply != nil {
+				writeFrame(reply)
+			}
+			continue
+		}
+
+		if !guard.allowSend(targetAddr, len(payload)) {
+			continue
+		}
+
+		n, err := udpConn.WriteToUDP(payload, targetAddr, target.Flags(data[0]))
+		if err != nil {
+			log.Printf("[UDP Stream] 发送 UDP 数据包失败: %v", err)
+			continue
+		}
+		state.bytesUp.Add(int64(n))
+	}
+
+	// 关闭 UDP 出口并等待接收流程退出，之后才能关闭流
+	udpConn.Close()
+	udpConn.Wait()
+	sl.Printf("[UDP Stream] 关联已结束")
+}
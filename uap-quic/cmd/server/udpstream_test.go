@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// freePort 分配一个当前空闲的本机 TCP 端口
+func freePort(t testing.TB) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// startUDPEcho 启动本机 UDP 回显服务，测试结束时关闭
+func startUDPEcho(t testing.TB) *net.UDPConn {
+	t.Helper()
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return pc
+}
+
+// socksUDPAssociate 通过本机 SOCKS5 端口发起 UDP ASSOCIATE，返回控制连接与中继地址
+func socksUDPAssociate(t testing.TB, socksAddr string) (net.Conn, *net.UDPAddr) {
+	t.Helper()
+	var ctrl net.Conn
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if ctrl, err = net.Dial("tcp", socksAddr); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ctrl.Close() })
+	ctrl.SetDeadline(time.Now().Add(10 * time.Second))
+
+	ctrl.Write([]byte{0x05, 0x01, 0x00})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(ctrl, method); err != nil || method[1] != 0x00 {
+		t.Fatalf("SOCKS5 协商失败: %v %x", err, method)
+	}
+	ctrl.Write([]byte{0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(ctrl, reply); err != nil || reply[1] != 0x00 || reply[3] != 0x01 {
+		t.Fatalf("UDP ASSOCIATE 失败: %v %x", err, reply)
+	}
+	ctrl.SetDeadline(time.Time{})
+	return ctrl, &net.UDPAddr{IP: net.IP(reply[4:8]), Port: int(binary.BigEndian.Uint16(reply[8:10]))}
+}
+
+func TestSOCKS5UDPOverStream(t *testing.T) {
+	node := startTestNode(t)
+	echoConn := startUDPEcho(t)
+	target := echoConn.LocalAddr().(*net.UDPAddr)
+
+	port := freePort(t)
+	client := node.newClientOnPort(t, port)
+	client.SetUDPOverStream(true)
+	go client.Start("")
+
+	_, relayAddr := socksUDPAssociate(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	relayAddr.IP = net.IPv4(127, 0, 0, 1)
+	app, err := net.DialUDP("udp", nil, relayAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	// SOCKS5 UDP 请求头：RSV(2) FRAG(1) ATYP(1) IPv4(4) PORT(2)
+	header := []byte{0, 0, 0, 0x01}
+	header = append(header, target.IP.To4()...)
+	header = binary.BigEndian.AppendUint16(header, uint16(target.Port))
+	buf := make([]byte, 2048)
+	for i := 0; i < 5; i++ {
+		payload := []byte("udp-over-stream-" + strconv.Itoa(i))
+		if _, err := app.Write(append(append([]byte{}, header...), payload...)); err != nil {
+			t.Fatal(err)
+		}
+		app.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := app.Read(buf)
+		if err != nil {
+			t.Fatalf("第 %d 个包未收到回显: %v", i, err)
+		}
+		if n < len(header) || !bytes.Equal(buf[len(header):n], payload) {
+			t.Fatalf("第 %d 个包回显不一致: %x", i, buf[:n])
+		}
+	}
+}
+
+func TestDialUDPOverStream(t *testing.T) {
+	node := startTestNode(t)
+	client := node.connect(t)
+	client.SetUDPOverStream(true)
+	if _, err := udpEcho(client); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSOCKS5UDPControlData(t *testing.T) {
+	node := startTestNode(t)
+	echoConn := startUDPEcho(t)
+	target := echoConn.LocalAddr().(*net.UDPAddr)
+
+	for _, overStream := range []bool{false, true} {
+		t.Run(map[bool]string{false: "Datagram", true: "Stream"}[overStream], func(t *testing.T) {
+			port := freePort(t)
+			client := node.newClientOnPort(t, port)
+			client.SetUDPOverStream(overStream)
+			go client.Start("")
+
+			ctrl, relayAddr := socksUDPAssociate(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			relayAddr.IP = net.IPv4(127, 0, 0, 1)
+			app, err := net.DialUDP("udp", nil, relayAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Close()
+			header := []byte{0, 0, 0, 0x01}
+			header = append(header, target.IP.To4()...)
+			header = binary.BigEndian.AppendUint16(header, uint16(target.Port))
+
+			// 应用在控制连接上发送的数据不结束关联
+			if _, err := ctrl.Write([]byte("keepalive")); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if !socksUDPRoundTrip(t, app, header, []byte("after-control-data"), 5*time.Second) {
+					t.Fatalf("控制连接收到数据后第 %d 个包未收到回显", i)
+				}
+			}
+
+			// 控制连接断开后关联结束
+			ctrl.Close()
+			time.Sleep(100 * time.Millisecond)
+			if socksUDPRoundTrip(t, app, header, []byte("after-close"), 300*time.Millisecond) {
+				t.Fatal("控制连接断开后关联仍在转发")
+			}
+		})
+	}
+}
+
+// socksUDPApp 发起 UDP ASSOCIATE 并返回连接到中继地址的应用 Socket，以及发往 target 的 SOCKS5 UDP 头部
+func socksUDPApp(t *testing.T, port int, target *net.UDPAddr) (*net.UDPConn, []byte) {
+	t.Helper()
+	_, relayAddr := socksUDPAssociate(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	relayAddr.IP = net.IPv4(127, 0, 0, 1)
+	app, err := net.DialUDP("udp", nil, relayAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Close() })
+
+	header := []byte{0, 0, 0, 0x01}
+	header = append(header, target.IP.To4()...)
+	header = binary.BigEndian.AppendUint16(header, uint16(target.Port))
+	return app, header
+}
+
+// socksUDPRoundTrip 发送 payload，返回是否在 wait 内收到一致的回显
+func socksUDPRoundTrip(t *testing.T, app *net.UDPConn, header, payload []byte, wait time.Duration) bool {
+	t.Helper()
+	if _, err := app.Write(append(append([]byte{}, header...), payload...)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	app.SetReadDeadline(time.Now().Add(wait))
+	n, err := app.Read(buf)
+	if err != nil {
+		return false
+	}
+	if n < len(header) || !bytes.Equal(buf[len(header):n], payload) {
+		t.Fatalf("回显不一致: %d 字节", n)
+	}
+	return true
+}
+
+func TestSOCKS5UDPOversize(t *testing.T) {
+	node := startTestNode(t)
+	echoConn := startUDPEcho(t)
+	target := echoConn.LocalAddr().(*net.UDPAddr)
+	small := []byte("small")
+	large := bytes.Repeat([]byte{0xab}, core.MaxDatagramUDPPayload+200)
+
+	t.Run("丢弃", func(t *testing.T) {
+		port := freePort(t)
+		client := node.newClientOnPort(t, port)
+		go client.Start("")
+		app, header := socksUDPApp(t, port, target)
+
+		if !socksUDPRoundTrip(t, app, header, small, 5*time.Second) {
+			t.Fatal("小包未收到回显")
+		}
+		if socksUDPRoundTrip(t, app, header, large, 300*time.Millisecond) {
+			t.Fatal("超出 Datagram 上限的包未被丢弃")
+		}
+		if dropped := client.GetStats(0).UDPOversizeDropped; dropped != 1 {
+			t.Fatalf("丢弃计数 %d", dropped)
+		}
+		// 丢包不影响之后的小包
+		if !socksUDPRoundTrip(t, app, header, small, 5*time.Second) {
+			t.Fatal("丢弃超限包后小包未收到回显")
+		}
+	})
+
+	t.Run("回退到 Stream", func(t *testing.T) {
+		port := freePort(t)
+		client := node.newClientOnPort(t, port)
+		client.SetUDPOversizeFallback(true)
+		go client.Start("")
+		app, header := socksUDPApp(t, port, target)
+
+		if !socksUDPRoundTrip(t, app, header, small, 5*time.Second) {
+			t.Fatal("小包未收到回显")
+		}
+		// 触发回退的包本身也要送达，之后的大小包都经 Stream 传输
+		for i, payload := range [][]byte{large, small, large} {
+			if !socksUDPRoundTrip(t, app, header, payload, 5*time.Second) {
+				t.Fatalf("回退后第 %d 个包未收到回显", i)
+			}
+		}
+		if dropped := client.GetStats(0).UDPOversizeDropped; dropped != 0 {
+			t.Fatalf("回退模式丢弃了 %d 个包", dropped)
+		}
+	})
+
+	t.Run("配置的上限", func(t *testing.T) {
+		port := freePort(t)
+		client := node.newClientOnPort(t, port)
+		client.SetMaxUDPPayload(len(small))
+		client.SetUDPOversizeFallback(true) // 配置的上限优先于回退
+		go client.Start("")
+		app, header := socksUDPApp(t, port, target)
+
+		if !socksUDPRoundTrip(t, app, header, small, 5*time.Second) {
+			t.Fatal("上限以内的包未收到回显")
+		}
+		if socksUDPRoundTrip(t, app, header, append(small, '!'), 300*time.Millisecond) {
+			t.Fatal("超出配置上限的包未被丢弃")
+		}
+		if stats := client.GetStats(0); stats.UDPOversizeDropped != 1 || stats.MaxUDPPayload != len(small) {
+			t.Fatalf("统计 丢弃 %d 上限 %d", stats.UDPOversizeDropped, stats.MaxUDPPayload)
+		}
+	})
+}
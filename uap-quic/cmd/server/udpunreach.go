@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+// udpUnreachable 把目标返回的 ICMP 不可达转告客户端（-udp-unreachable）
+// UDP 出口 Socket 没有 connect，内核默认不报告 ICMP 错误：WriteToUDP 在本地成功，包在目标处被丢弃，应用只能等到超时。
+// 开启后出口 Socket 设置 IP_RECVERR（仅 Linux），内核把 ICMP 错误连同原始目标与载荷放入错误队列：
+// 发往 53 端口的查询回复 SERVFAIL（所有客户端都能识别），其他目标在客户端协商了 capUDPUnreachable 时回复不可达信令包
+var udpUnreachable bool
+
+// udpReplyUnreachable 服务端发给客户端的不可达信令：SOCKS5 UDP 头部的 RSV 第一个字节，地址为不可达的目标，载荷为空
+// 只发给协商了 capUDPUnreachable 的客户端（旧版客户端会把它当作空回包交给应用）
+const udpReplyUnreachable byte = 0x01
+
+// udpUnreachableCount 累计收到的 ICMP 不可达次数（所有连接共享）
+var udpUnreachableCount atomic.Int64
+
+// unreachable 错误队列中的一条 ICMP 不可达
+type unreachable struct {
+	addr    *net.UDPAddr // 原始目标
+	payload []byte       // 原始载荷（ICMP 报文只带回开头一部分，可能被截断）
+	err     syscall.Errno
+}
+
+// configureUDPUnreachable 按启动参数开启 ICMP 不可达转告，当前平台不支持时只记录日志
+func configureUDPUnreachable(enabled bool) {
+	if !enabled {
+		return
+	}
+	if err := checkRecvErr(); err != nil {
+		log.Printf("⚠️ UDP 目标不可达转告不可用: %v", err)
+		return
+	}
+	udpUnreachable = true
+	log.Printf("✅ UDP 目标不可达转告: 53 端口回复 SERVFAIL，其他端口向新版客户端发送不可达信令")
+}
+
+// isUnreachable 读写出口 Socket 返回的错误是否来自 ICMP 不可达（错误队列中有待读取的条目）
+func isUnreachable(err error) bool {
+	// 先判断错误类型：Socket 关闭后读取流程退出时不访问开关
+	return (errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)) && udpUnreachable
+}
+
+// unreachableReplies 读出 Socket 错误队列中的 ICMP 不可达，构造发给客户端的 SOCKS5 UDP 数据包
+func unreachableReplies(conn *net.UDPConn, state *connState) [][]byte {
+	var replies [][]byte
+	for _, u := range readErrQueue(conn) {
+		udpUnreachableCount.Add(1)
+		if state.verbose() {
+			log.Printf("[UDP] 目标不可达 %s: %v", u.addr, u.err)
+		}
+		if u.addr.Port == 53 {
+			if reply := dnsServfail(u.payload); reply != nil {
+				replies = append(replies, buildSOCKS5UDPHeader(u.addr, reply))
+				continue
+			}
+		}
+		if state.caps.Load()&uint32(capUDPUnreachable) != 0 {
+			signal := buildSOCKS5UDPHeader(u.addr, nil)
+			signal[0] = udpReplyUnreachable
+			replies = append(replies, signal)
+		}
+	}
+	return replies
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// sock_extended_err 的来源（linux/errqueue.h）
+const (
+	soEEOriginICMP  = 2
+	soEEOriginICMP6 = 3
+)
+
+// checkRecvErr Linux 支持 IP_RECVERR
+func checkRecvErr() error {
+	return nil
+}
+
+// enableRecvErr 开启 IP_RECVERR / IPV6_RECVERR（双栈 Socket 两个都设置，IPv4 目标的错误按 IPv4 报告）
+func enableRecvErr(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var v4Err, v6Err error
+	if err := raw.Control(func(fd uintptr) {
+		v4Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
+		v6Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
+	}); err != nil {
+		return err
+	}
+	if v4Err != nil && v6Err != nil {
+		return v4Err
+	}
+	return nil
+}
+
+// readErrQueue 读出错误队列中的全部条目（不阻塞），只返回 ICMP 报告的不可达
+// 条目的地址是原始目标，数据是原始载荷（ICMP 报文带回的部分）
+func readErrQueue(conn *net.UDPConn) []unreachable {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var list []unreachable
+	buf := make([]byte, 1500)
+	oob := make([]byte, 512)
+	raw.Control(func(fd uintptr) {
+		for {
+			n, oobn, _, from, err := syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+			if err != nil {
+				return
+			}
+			addr := sockaddrUDP(from)
+			errno, ok := parseExtendedErr(oob[:oobn])
+			if addr == nil || !ok {
+				continue
+			}
+			list = append(list, unreachable{addr: addr, payload: append([]byte(nil), buf[:n]...), err: errno})
+		}
+	})
+	return list
+}
+
+// parseExtendedErr 从控制消息中取出 ICMP 报告的不可达错误（ECONNREFUSED / EHOSTUNREACH / ENETUNREACH）
+// 其他错误（如 PMTU 的 EMSGSIZE、本地产生的错误）返回 false
+func parseExtendedErr(oob []byte) (syscall.Errno, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, m := range msgs {
+		if !(m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_RECVERR) &&
+			!(m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_RECVERR) {
+			continue
+		}
+		// struct sock_extended_err: ee_errno (4) + ee_origin (1) + ee_type (1) + ee_code (1) + ...
+		if len(m.Data) < 8 {
+			continue
+		}
+		errno := syscall.Errno(binary.NativeEndian.Uint32(m.Data[:4]))
+		origin := m.Data[4]
+		if origin != soEEOriginICMP && origin != soEEOriginICMP6 {
+			continue
+		}
+		switch errno {
+		case syscall.ECONNREFUSED, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+			return errno, true
+		}
+	}
+	return 0, false
+}
+
+// sockaddrUDP 转换错误队列条目的目标地址
+func sockaddrUDP(sa syscall.Sockaddr) *net.UDPAddr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.UDPAddr{IP: net.IP(append([]byte(nil), sa.Addr[:]...)), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		ip := net.IP(append([]byte(nil), sa.Addr[:]...))
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return &net.UDPAddr{IP: ip, Port: sa.Port}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// withUDPUnreachable 测试期间按启动参数开启 -udp-unreachable（须在 startTestNode 之前调用）
+func withUDPUnreachable(t *testing.T) {
+	t.Helper()
+	old := udpUnreachable
+	t.Cleanup(func() { udpUnreachable = old })
+	configureUDPUnreachable(true)
+	if !udpUnreachable {
+		t.Fatal("未开启 UDP 目标不可达转告")
+	}
+}
+
+// closedUDPAddr 本机一个没有监听的 UDP 地址（发往它的包由内核回复 ICMP 端口不可达）
+func closedUDPAddr(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	conn := newLeaseConn(t)
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	conn.Close()
+	return addr
+}
+
+// closedDNSAddr 本机一个没有监听的 53 端口地址，53 端口被占用时跳过测试
+func closedDNSAddr(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 53}
+	conn, err := net.ListenUDP("udp", addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		t.Skipf("%s 已有监听", addr)
+	}
+	if err == nil {
+		conn.Close()
+	}
+	return addr
+}
+
+// dialUDPRead 经隧道向 addr 发一个包并读取回包（最多等待 wait）
+func dialUDPRead(t *testing.T, client *core.Client, addr string, payload []byte, wait time.Duration) ([]byte, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.DialUDP(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	return buf[:n], err
+}
+
+// TestUDPUnreachableFailsFast 目标端口未开放时 DialUDP 的连接立即读到 ErrUDPUnreachable，而不是等到超时
+func TestUDPUnreachableFailsFast(t *testing.T) {
+	withUDPUnreachable(t)
+	node := startTestNode(t)
+	target := closedUDPAddr(t).String()
+
+	for _, overStream := range []bool{false, true} {
+		t.Run(map[bool]string{false: "Datagram", true: "Stream"}[overStream], func(t *testing.T) {
+			client := node.connect(t)
+			client.SetUDPOverStream(overStream)
+			start := time.Now()
+			_, err := dialUDPRead(t, client, target, []byte("ping"), 5*time.Second)
+			if !errors.Is(err, core.ErrUDPUnreachable) || !errors.Is(err, syscall.ECONNREFUSED) {
+				t.Fatalf("读取返回 %v，期望 ErrUDPUnreachable", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("%v 后才报告不可达", elapsed)
+			}
+			if n := client.GetStats(0).UDPUnreachable; n != 1 {
+				t.Fatalf("不可达计数 %d", n)
+			}
+		})
+	}
+}
+
+// TestUDPUnreachableDisabled 未开启 -udp-unreachable 时保持原来的行为：应用等到超时
+func TestUDPUnreachableDisabled(t *testing.T) {
+	node := startTestNode(t)
+	_, err := dialUDPRead(t, node.connect(t), closedUDPAddr(t).String(), []byte("ping"), 300*time.Millisecond)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("读取返回 %v，期望超时", err)
+	}
+}
+
+// TestUDPUnreachableDNS 53 端口不可达时回复 SERVFAIL，所有客户端都能识别
+func TestUDPUnreachableDNS(t *testing.T) {
+	withUDPUnreachable(t)
+	node := startTestNode(t)
+	target := closedDNSAddr(t)
+
+	query := dnsQuery(0x4242, "example.com")
+	reply, err := dialUDPRead(t, node.connect(t), target.String(), query, 5*time.Second)
+	if err != nil {
+		t.Fatalf("未收到 SERVFAIL: %v", err)
+	}
+	checkServfail(t, query, reply)
+
+	// SOCKS5 关联同样收到 SERVFAIL
+	port := freePort(t)
+	client := node.newClientOnPort(t, port)
+	go client.Start("")
+	app, header := socksUDPApp(t, port, target)
+	app.Write(append(append([]byte{}, header...), query...))
+	app.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := app.Read(buf)
+	if err != nil || n < len(header) {
+		t.Fatalf("SOCKS5 关联未收到 SERVFAIL: %v", err)
+	}
+	checkServfail(t, query, buf[len(header):n])
+}
+
+// TestUDPUnreachableSOCKS5 SOCKS5 关联收到不可达信令时计数，不把空包交给应用
+func TestUDPUnreachableSOCKS5(t *testing.T) {
+	withUDPUnreachable(t)
+	node := startTestNode(t)
+	port := freePort(t)
+	client := node.newClientOnPort(t, port)
+	go client.Start("")
+
+	app, header := socksUDPApp(t, port, closedUDPAddr(t))
+	app.Write(append(append([]byte{}, header...), "ping"...))
+	deadline := time.Now().Add(5 * time.Second)
+	for client.GetStats(0).UDPUnreachable == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("未收到不可达信令")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	app.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := app.Read(make([]byte, 2048)); err == nil {
+		t.Fatalf("信令被转发给应用: %d 字节", n)
+	}
+}
+
+// TestUnreachableReplies 错误队列中的不可达按目标转成回包：信令只发给协商了 capUDPUnreachable 的客户端
+func TestUnreachableReplies(t *testing.T) {
+	withUDPUnreachable(t)
+	conn, err := listenExitUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	target := closedUDPAddr(t)
+
+	// unreachableAfter 发一个包并等待内核报告不可达
+	unreachableAfter := func() {
+		t.Helper()
+		conn.WriteToUDP([]byte("ping"), target)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadFromUDP(make([]byte, 64)); !isUnreachable(err) {
+			t.Fatalf("读取返回 %v，期望 ICMP 不可达", err)
+		}
+	}
+
+	state := newConnState(nil)
+	before := udpUnreachableCount.Load()
+	unreachableAfter()
+	if replies := unreachableReplies(conn, state); len(replies) != 0 {
+		t.Fatalf("未协商的客户端收到 %d 个信令", len(replies))
+	}
+	if udpUnreachableCount.Load() != before+1 {
+		t.Fatal("未统计不可达次数")
+	}
+
+	state.caps.Store(uint32(capUDPUnreachable))
+	unreachableAfter()
+	replies := unreachableReplies(conn, state)
+	if len(replies) != 1 || replies[0][0] != udpReplyUnreachable {
+		t.Fatalf("信令 %x", replies)
+	}
+	addr, payload, err := parseSOCKS5UDPHeader(replies[0])
+	if err != nil || addr.String() != target.String() || len(payload) != 0 {
+		t.Fatalf("信令的目标 %v、载荷 %d 字节: %v", addr, len(payload), err)
+	}
+	// 错误队列已读空
+	if replies := unreachableReplies(conn, state); len(replies) != 0 {
+		t.Fatalf("重复读到 %d 条不可达", len(replies))
+	}
+}
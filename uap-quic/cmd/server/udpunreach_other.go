@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// checkRecvErr 其他平台的未连接 UDP Socket 无法按目标取回 ICMP 错误
+func checkRecvErr() error {
+	return fmt.Errorf("当前平台 (%s) 不支持", runtime.GOOS)
+}
+
+// enableRecvErr 不支持的平台不会调用（udpUnreachable 始终为 false）
+func enableRecvErr(conn *net.UDPConn) error {
+	return nil
+}
+
+// readErrQueue 不支持的平台没有错误队列
+func readErrQueue(conn *net.UDPConn) []unreachable {
+	return nil
+}
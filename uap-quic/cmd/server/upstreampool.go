@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// 上游连接复用的限制
+const (
+	poolMaxIdlePerKey = 4               // 每个 (用户, 目标) 最多保留的空闲连接
+	poolMaxIdle       = 1024            // 全部空闲连接的上限
+	poolMaxHeader     = 64 * 1024       // 观察 HTTP 报文时单个报文头的上限，超出时按非 HTTP 流量处理
+	poolResponseWait  = 1 * time.Second // 目标发来数据后等待对应请求解析完成的最长时间，超时按非 HTTP 流量处理
+)
+
+// upstreamPool 上游 TCP 连接复用池（-upstream-pool-ports，nil 表示不启用）
+var upstreamPool *connPool
+
+// connPool 按 (用户, 目标, 转发标志) 保存空闲的上游连接，同一用户之后到同一目标的流直接复用，省去 TCP 握手
+// 只用于明文 HTTP 端口：流结束时恰好停在 HTTP/1.x 请求与响应的边界、双方都没有要求关闭连接时才放回池中；
+// 其余情况（非 HTTP 流量、Connection: close、协议升级、响应未读完）照常关闭，转发的字节不受影响
+// 不跨用户复用：NTLM 等按连接鉴权的协议会把鉴权状态留在连接上
+type connPool struct {
+	ports       map[string]bool
+	idleTimeout time.Duration
+
+	mu    sync.Mutex
+	idle  map[string][]*idleConn
+	total int
+
+	hits   atomic.Int64 // 复用空闲连接的次数
+	misses atomic.Int64 // 没有可用的空闲连接、新建连接的次数
+	saved  atomic.Int64 // 复用省下的建立连接时间（按该连接最初建立的耗时估算，纳秒）
+	stale  atomic.Int64 // 取出时发现已被目标关闭的空闲连接数
+}
+
+// idleConn 池中的空闲连接
+// 放回池中后由 watch 阻塞读取：目标关闭连接或发来数据时立即移出池；取出时设置过去的读截止时间打断读取
+type idleConn struct {
+	net.Conn
+	key      string
+	dialTime time.Duration // 最初建立连接的耗时
+	watched  chan error    // watch 读取结束的原因
+	timer    *time.Timer   // 空闲超时
+}
+
+// newConnPool 解析 -upstream-pool-ports（逗号分隔的端口），为空时返回 nil
+func newConnPool(ports string, idleTimeout time.Duration) (*connPool, error) {
+	p := &connPool{ports: make(map[string]bool), idleTimeout: idleTimeout, idle: make(map[string][]*idleConn)}
+	for _, item := range strings.Split(ports, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := net.LookupPort("tcp", item)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("上游连接复用端口无效: %q", item)
+		}
+		p.ports[fmt.Sprint(port)] = true
+	}
+	if len(p.ports) == 0 {
+		return nil, nil
+	}
+	if idleTimeout <= 0 {
+		return nil, fmt.Errorf("上游空闲连接超时必须大于 0")
+	}
+	return p, nil
+}
+
+// String 启用复用的端口（日志使用）
+func (p *connPool) String() string {
+	ports := make([]string, 0, len(p.ports))
+	for port := range p.ports {
+		ports = append(ports, port)
+	}
+	return strings.Join(ports, ", ")
+}
+
+// poolKey 目标 addr 可以复用连接时返回池的键，否则返回空字符串
+func (p *connPool) poolKey(state *connState, addr string, flags target.Flags) string {
+	if p == nil {
+		return ""
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || !p.ports[port] {
+		return ""
+	}
+	return fmt.Sprintf("%s|%s|%d", state.user(), addr, flags)
+}
+
+// get 取出一条仍然可用的空闲连接，没有时返回 nil
+func (p *connPool) get(key string) *idleConn {
+	for {
+		p.mu.Lock()
+		conns := p.idle[key]
+		if len(conns) == 0 {
+			p.mu.Unlock()
+			p.misses.Add(1)
+			return nil
+		}
+		// 取最近放回的连接（最不可能已被目标按空闲超时关闭）
+		ic := conns[len(conns)-1]
+		p.removeLocked(ic)
+		p.mu.Unlock()
+
+		ic.timer.Stop()
+		ic.SetReadDeadline(time.Unix(1, 0))
+		err := <-ic.watched
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			ic.SetReadDeadline(time.Time{})
+			p.hits.Add(1)
+			p.saved.Add(int64(ic.dialTime))
+			return ic
+		}
+		ic.Close()
+		p.stale.Add(1)
+	}
+}
+
+// put 把处于报文边界的连接放回池中（池已满时关闭）
+func (p *connPool) put(key string, conn net.Conn, dialTime time.Duration) {
+	ic := &idleConn{Conn: conn, key: key, dialTime: dialTime, watched: make(chan error, 1)}
+	p.mu.Lock()
+	if p.total >= poolMaxIdle || len(p.idle[key]) >= poolMaxIdlePerKey {
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.idle[key] = append(p.idle[key], ic)
+	p.total++
+	ic.timer = time.AfterFunc(p.idleTimeout, func() { p.evict(ic) })
+	p.mu.Unlock()
+	go p.watch(ic)
+}
+
+// watch 阻塞读取空闲连接：读取结束时仍在池中（目标关闭连接或发来了数据）就移出并关闭
+func (p *connPool) watch(ic *idleConn) {
+	var b [1]byte
+	_, err := ic.Read(b[:])
+	if err == nil {
+		err = errors.New("空闲连接收到数据")
+	}
+	ic.watched <- err
+	p.evict(ic)
+}
+
+// evict 空闲连接仍在池中时移出并关闭
+func (p *connPool) evict(ic *idleConn) {
+	p.mu.Lock()
+	removed := p.removeLocked(ic)
+	p.mu.Unlock()
+	if removed {
+		ic.timer.Stop()
+		ic.Close()
+	}
+}
+
+// removeLocked 从池中移除 ic，返回是否在池中（持有 mu 时调用）
+func (p *connPool) removeLocked(ic *idleConn) bool {
+	conns := p.idle[ic.key]
+	for i, c := range conns {
+		if c == ic {
+			conns = append(conns[:i], conns[i+1:]...)
+			if len(conns) == 0 {
+				delete(p.idle, ic.key)
+			} else {
+				p.idle[ic.key] = conns
+			}
+			p.total--
+			return true
+		}
+	}
+	return false
+}
+
+// dialPooled 连接 TCP 目标：key 非空时优先复用池中的空闲连接
+// 返回连接、该连接最初建立的耗时，以及是否为复用的连接
+func dialPooled(key, addr string, flags target.Flags) (net.Conn, time.Duration, bool, error) {
+	if key != "" {
+		if ic := upstreamPool.get(key); ic != nil {
+			return ic.Conn, ic.dialTime, true, nil
+		}
+	}
+	start := time.Now()
+	conn, err := dialTarget(addr, flags)
+	return conn, time.Since(start), false, err
+}
+
+// poolStats 上游连接复用统计（健康检查接口输出）
+type poolStats struct {
+	Idle    int   `json:"idle"`     // 当前空闲连接数
+	Hits    int64 `json:"hits"`     // 复用空闲连接的次数
+	Misses  int64 `json:"misses"`   // 新建连接的次数
+	Stale   int64 `json:"stale"`    // 取出时已被目标关闭的空闲连接数
+	SavedMs int64 `json:"saved_ms"` // 复用省下的建立连接时间（毫秒，按各连接最初建立的耗时估算）
+}
+
+// stats 统计快照
+func (p *connPool) stats() *poolStats {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	idle := p.total
+	p.mu.Unlock()
+	return &poolStats{
+		Idle:    idle,
+		Hits:    p.hits.Load(),
+		Misses:  p.misses.Load(),
+		Stale:   p.stale.Load(),
+		SavedMs: time.Duration(p.saved.Load()).Milliseconds(),
+	}
+}
+
+// pooledRelay 可复用连接上的双向转发：字节照常原样转发，同时按 HTTP/1.x 报文观察两个方向，
+// 客户端在报文边界结束流、所有响应都已完整送达且双方都没有要求关闭连接时，返回 true（连接可以放回池中）
+type pooledRelay struct {
+	targetConn net.Conn
+	reqs       chan *http.Request // 已转发的请求（按顺序与响应配对）
+	pending    atomic.Int32       // 已转发但响应未读完的请求数
+	clientDone atomic.Bool        // 客户端已在报文边界结束流
+	broken     atomic.Bool        // 出现了不能复用的情况（非 HTTP 流量、要求关闭、协议升级等）
+	wg         sync.WaitGroup     // 两个方向的转发协程（relay 返回时可能仍在运行，见 handleTCP）
+}
+
+// relay 转发直到任一方向结束，返回连接是否可以复用
+// src 为流上（已解压）的读取端，up / down 为写往目标与客户端的（已计数、限速）写端
+func (r *pooledRelay) relay(src io.Reader, up io.Writer, down io.Writer) bool {
+	r.reqs = make(chan *http.Request, 64)
+	reqDone := make(chan bool, 1)
+	respDone := make(chan bool, 1)
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		reqDone <- r.forwardRequests(src, up)
+	}()
+	go func() {
+		defer r.wg.Done()
+		respDone <- r.forwardResponses(down)
+	}()
+
+	select {
+	case clean := <-reqDone:
+		if !clean || r.broken.Load() || r.pending.Load() != 0 {
+			return false // 客户端中途断开，或还有响应没送达（与不复用时一样立即关闭）
+		}
+		// 响应方向此时阻塞在等待目标的下一段数据上，打断它
+		r.clientDone.Store(true)
+		r.targetConn.SetReadDeadline(time.Now())
+		clean = <-respDone
+		r.targetConn.SetReadDeadline(time.Time{})
+		return clean && !r.broken.Load()
+	case <-respDone:
+		return false
+	}
+}
+
+// forwardRequests 转发客户端到目标的数据并解析其中的请求；客户端恰好在请求边界结束流时返回 true
+func (r *pooledRelay) forwardRequests(src io.Reader, up io.Writer) bool {
+	defer close(r.reqs)
+	lr := &io.LimitedReader{R: io.TeeReader(src, up), N: math.MaxInt64}
+	br := bufio.NewReader(lr)
+	for !r.broken.Load() {
+		lr.N = poolMaxHeader
+		req, err := http.ReadRequest(br)
+		lr.N = math.MaxInt64
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			break
+		}
+		if req.Close || req.Method == http.MethodConnect || req.Header.Get("Upgrade") != "" {
+			r.broken.Store(true)
+		}
+		r.pending.Add(1)
+		select {
+		case r.reqs <- req:
+		default:
+			r.broken.Store(true) // 未配对的请求过多：不再复用（响应方向已退出时也不会阻塞在这里）
+		}
+		if err := drain(req.Body); err != nil {
+			return false
+		}
+	}
+	// 不再按 HTTP 解析，继续原样转发剩余的数据
+	r.broken.Store(true)
+	drain(br)
+	return false
+}
+
+// forwardResponses 转发目标到客户端的数据并按请求解析响应；客户端结束流后目标没有多余数据时返回 true
+func (r *pooledRelay) forwardResponses(down io.Writer) bool {
+	lr := &io.LimitedReader{R: io.TeeReader(r.targetConn, down), N: math.MaxInt64}
+	br := bufio.NewReader(lr)
+	for !r.broken.Load() {
+		// 目标发来数据（已原样转发给客户端）后再配对请求
+		if _, err := br.Peek(1); err != nil {
+			return r.clientDone.Load() && br.Buffered() == 0 && errors.Is(err, os.ErrDeadlineExceeded)
+		}
+		var req *http.Request
+		select {
+		case req = <-r.reqs:
+		case <-time.After(poolResponseWait):
+		}
+		if req == nil {
+			break // 没有对应请求的数据
+		}
+		if !r.readResponse(br, lr, req) {
+			break
+		}
+		r.pending.Add(-1)
+	}
+	r.broken.Store(true)
+	drain(br)
+	return false
+}
+
+// readResponse 读完 req 对应的响应（跳过 100 Continue 等中间响应），响应可以在连接上继续后续请求时返回 true
+func (r *pooledRelay) readResponse(br *bufio.Reader, lr *io.LimitedReader, req *http.Request) bool {
+	for {
+		lr.N = poolMaxHeader
+		resp, err := http.ReadResponse(br, req)
+		lr.N = math.MaxInt64
+		if err != nil {
+			return false
+		}
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			continue
+		}
+		if err := drain(resp.Body); err != nil {
+			return false
+		}
+		return !resp.Close && resp.StatusCode != http.StatusSwitchingProtocols
+	}
+}
+
+// drain 读完 r（数据在读取时经 TeeReader 原样转发），使用缓冲池的缓冲区
+func drain(r io.Reader) error {
+	buf := bufPool.Get().([]byte)
+	defer bufPool.Put(buf)
+	for {
+		if _, err := r.Read(buf); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
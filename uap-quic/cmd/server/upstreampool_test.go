@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+
+	"github.com/quic-go/quic-go"
+)
+
+// withUpstreamPool 测试期间对 addr 的端口启用上游连接复用（须在 startTestNode 之前调用）
+func withUpstreamPool(t testing.TB, addr string, idle time.Duration) *connPool {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(addr)
+	pool, err := newConnPool(port, idle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamPool = pool
+	t.Cleanup(func() { upstreamPool = nil })
+	return pool
+}
+
+// startHTTPUpstream 本机 HTTP/1.1 目标，返回地址与已接受的 TCP 连接数
+func startHTTPUpstream(t testing.TB) (string, *atomic.Int64) {
+	t.Helper()
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.URL.Path)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String(), &conns
+}
+
+// httpOverStream 在一条新流上经节点向 addr 发出一次 HTTP 请求，读完响应后在请求边界结束流
+func httpOverStream(t testing.TB, conn quic.Connection, addr, path string, header string) string {
+	t.Helper()
+	stream := openAuthedStream(t, conn)
+	req, _ := target.AppendV0(nil, addr)
+	req = append(req, fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", path, addr, header)...)
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(stream)
+	if status, err := br.ReadByte(); err != nil || status != 0x00 {
+		t.Fatalf("连接目标失败: 0x%02x %v", status, err)
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	io.Copy(io.Discard, br) // 等节点结束这条流
+	return string(body)
+}
+
+// waitIdle 等待池中的空闲连接数变为 n
+func waitIdle(t testing.TB, pool *connPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for pool.stats().Idle != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("空闲连接数 %d，期望 %d", pool.stats().Idle, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestUpstreamPoolReuse 同一用户先后两条流请求同一目标，共用一条上游连接
+func TestUpstreamPoolReuse(t *testing.T) {
+	addr, conns := startHTTPUpstream(t)
+	pool := withUpstreamPool(t, addr, time.Minute)
+	node := startTestNode(t)
+	conn := node.dialRaw(t)
+
+	if body := httpOverStream(t, conn, addr, "/first", ""); body != "hello /first" {
+		t.Fatalf("第一次响应 %q", body)
+	}
+	waitIdle(t, pool, 1)
+	// 另一条 QUIC 连接（同一用户）也可以复用
+	if body := httpOverStream(t, node.dialRaw(t), addr, "/second", ""); body != "hello /second" {
+		t.Fatalf("第二次响应 %q", body)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("目标收到 %d 条 TCP 连接，期望复用 1 条", n)
+	}
+	s := pool.stats()
+	if s.Hits != 1 || s.Misses != 1 || pool.saved.Load() <= 0 {
+		t.Fatalf("复用统计 %+v（省下 %v）", s, time.Duration(pool.saved.Load()))
+	}
+}
+
+// TestUpstreamPoolNotReused 要求关闭连接、不在复用端口上的流不放回池中
+func TestUpstreamPoolNotReused(t *testing.T) {
+	addr, conns := startHTTPUpstream(t)
+	pool := withUpstreamPool(t, addr, time.Minute)
+	node := startTestNode(t)
+	conn := node.dialRaw(t)
+
+	httpOverStream(t, conn, addr, "/", "Connection: close\r\n")
+	httpOverStream(t, conn, addr, "/", "")
+	if n := conns.Load(); n != 2 {
+		t.Fatalf("Connection: close 之后目标收到 %d 条连接，期望 2", n)
+	}
+
+	// 其他端口不经过复用池
+	other, otherConns := startHTTPUpstream(t)
+	httpOverStream(t, conn, other, "/", "")
+	httpOverStream(t, conn, other, "/", "")
+	if n := otherConns.Load(); n != 2 {
+		t.Fatalf("未启用复用的端口上目标收到 %d 条连接，期望 2", n)
+	}
+	if s := pool.stats(); s.Hits != 0 || s.Misses != 2 {
+		t.Fatalf("复用统计 %+v", s)
+	}
+}
+
+// TestUpstreamPoolIdleEviction 空闲超时的连接移出池并关闭，之后的流新建连接
+func TestUpstreamPoolIdleEviction(t *testing.T) {
+	addr, conns := startHTTPUpstream(t)
+	pool := withUpstreamPool(t, addr, 200*time.Millisecond)
+	node := startTestNode(t)
+	conn := node.dialRaw(t)
+
+	httpOverStream(t, conn, addr, "/", "")
+	waitIdle(t, pool, 1)
+	waitIdle(t, pool, 0)
+	httpOverStream(t, conn, addr, "/", "")
+	if n := conns.Load(); n != 2 {
+		t.Fatalf("空闲超时后目标收到 %d 条连接，期望 2", n)
+	}
+}
+
+func TestUpstreamPoolKey(t *testing.T) {
+	pool, err := newConnPool("80, http,8080", time.Minute)
+	if err != nil || pool.String() == "" || !pool.ports["80"] || !pool.ports["8080"] {
+		t.Fatalf("端口 %v, %v", pool, err)
+	}
+	alice, bob := &connState{userUUID: "alice"}, &connState{userUUID: "bob"}
+	key := pool.poolKey(alice, "example.com:80", 0)
+	// 不跨用户、不跨转发标志复用；其他端口不复用
+	if key == "" || key == pool.poolKey(bob, "example.com:80", 0) || key == pool.poolKey(alice, "example.com:80", target.FlagCompress) {
+		t.Fatalf("复用键 %q", key)
+	}
+	if pool.poolKey(alice, "example.com:443", 0) != "" || (*connPool)(nil).poolKey(alice, "example.com:80", 0) != "" {
+		t.Fatal("未启用复用的端口得到了复用键")
+	}
+
+	if pool, err := newConnPool("", time.Minute); pool != nil || err != nil {
+		t.Fatalf("空端口列表: %v, %v", pool, err)
+	}
+	for _, tc := range []struct {
+		ports string
+		idle  time.Duration
+	}{{"abc", time.Minute}, {"0", time.Minute}, {"80", 0}} {
+		if _, err := newConnPool(tc.ports, tc.idle); err == nil {
+			t.Errorf("%q / %v 未报错", tc.ports, tc.idle)
+		}
+	}
+}
+
+// BenchmarkUpstreamPool 同一目标上先后发出的短 HTTP 请求，复用与不复用上游连接对比
+// 节点与目标都在本机，省下的只是本机 TCP 握手；到远端热门站点时每次复用省下一个往返
+func BenchmarkUpstreamPool(b *testing.B) {
+	for _, pooled := range []bool{false, true} {
+		name := "direct"
+		if pooled {
+			name = "pooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			addr, conns := startHTTPUpstream(b)
+			if pooled {
+				withUpstreamPool(b, addr, time.Minute)
+			}
+			node := startTestNode(b)
+			conn := node.dialRaw(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if body := httpOverStream(b, conn, addr, "/", ""); !strings.HasPrefix(body, "hello") {
+					b.Fatalf("响应 %q", body)
+				}
+			}
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "dials/op")
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 预热请求限制：数据直接取自测速数据块，不额外生成；每条连接的预热请求之间至少间隔 warmupInterval
+const (
+	warmupInterval = 10 * time.Second
+	warmupTimeout  = 10 * time.Second
+)
+
+// handleWarmup 处理预热指令（客户端建立连接后模拟首次页面请求，避免握手后长时间静默）
+// 请求: 字节数 - 1 (2 字节, 大端，即最多 64KB)
+// 响应: 0x00 + 指定字节数的数据后关闭流 / 0x01 拒绝（距上次预热不足 warmupInterval）
+// 预热流量不计入会话流量，也不记录日志
+func handleWarmup(stream quic.Stream, state *connState) {
+	stream.SetDeadline(time.Now().Add(warmupTimeout))
+
+	sizeBuf := make([]byte, 2)
+	if _, err := io.ReadFull(stream, sizeBuf); err != nil {
+		return
+	}
+	size := int(binary.BigEndian.Uint16(sizeBuf)) + 1
+
+	now := time.Now().UnixNano()
+	last := state.lastWarmup.Load()
+	if now-last < int64(warmupInterval) || !state.lastWarmup.CompareAndSwap(last, now) {
+		stream.Write([]byte{0x01})
+		return
+	}
+	if _, err := stream.Write([]byte{0x00}); err != nil {
+		return
+	}
+	for size > 0 {
+		chunk := speedTestBlock[:min(size, len(speedTestBlock))]
+		n, err := stream.Write(chunk)
+		if err != nil {
+			return
+		}
+		size -= n
+	}
+}
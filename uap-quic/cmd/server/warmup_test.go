@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+
+	"github.com/quic-go/quic-go"
+)
+
+// requestWarmup 在 conn 上发出一次预热请求，返回状态与收到的数据量
+func requestWarmup(t *testing.T, conn quic.Connection, size int) (byte, int64) {
+	t.Helper()
+	stream := openAuthedStream(t, conn)
+	defer stream.Close()
+	req := []byte{0x00, opWarmup, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(size-1))
+	if _, err := stream.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(io.Discard, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status[0], n
+}
+
+// connStateOf 节点 addr 上 conn 对应的会话
+func connStateOf(t *testing.T, addr string) *connState {
+	t.Helper()
+	var found *connState
+	activeSessions.Range(func(_, value interface{}) bool {
+		if state := value.(*connState); state.conn.LocalAddr().String() == addr {
+			found = state
+		}
+		return found == nil
+	})
+	if found == nil {
+		t.Fatalf("节点 %s 上没有会话", addr)
+	}
+	return found
+}
+
+// TestWarmupEndpoint 节点按请求的字节数回复，每条连接限速，预热流量不计入会话流量
+func TestWarmupEndpoint(t *testing.T) {
+	node := startTestNode(t)
+	conn := node.dialRaw(t)
+
+	if status, n := requestWarmup(t, conn, 65536); status != 0x00 || n != 65536 {
+		t.Fatalf("预热响应 0x%02x，%d 字节", status, n)
+	}
+	// 同一连接 warmupInterval 内再次请求被拒绝
+	if status, n := requestWarmup(t, conn, 100); status != 0x01 || n != 0 {
+		t.Fatalf("频繁预热响应 0x%02x，%d 字节", status, n)
+	}
+	// 限速按连接计算
+	if status, n := requestWarmup(t, node.dialRaw(t), 100); status != 0x00 || n != 100 {
+		t.Fatalf("另一条连接的预热响应 0x%02x，%d 字节", status, n)
+	}
+
+	state := connStateOf(t, node.addr)
+	if up, down := state.bytesUp.Load(), state.bytesDown.Load(); up != 0 || down != 0 {
+		t.Fatalf("预热计入了会话流量: 上行 %d，下行 %d", up, down)
+	}
+}
+
+// TestClientWarmup 开启预热后客户端建立连接即发出一次预热请求，只计入预热统计
+func TestClientWarmup(t *testing.T) {
+	node := startTestNode(t)
+	client := node.newClient(t)
+	if err := client.SetWarmup(&core.WarmupConfig{MinBytes: 3000, MaxBytes: 3000, MaxDelay: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := client.GetStats(0)
+		if w := stats.Warmup; w != nil && w.Requests == 1 {
+			if w.Bytes != 3000 || w.Failures != 0 {
+				t.Fatalf("预热统计 %+v", w)
+			}
+			if stats.Proxy != 0 || stats.CompressedRaw != 0 {
+				t.Fatalf("预热计入了转发统计 %+v", stats)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("未完成预热请求: %+v", stats.Warmup)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 默认不预热
+	other := node.connect(t)
+	time.Sleep(100 * time.Millisecond)
+	if other.GetStats(0).Warmup != nil {
+		t.Fatal("未开启预热的客户端发出了预热请求")
+	}
+}
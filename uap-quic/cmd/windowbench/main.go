@@ -0,0 +1,384 @@
+// windowbench QUIC 接收窗口基准测试：在本机模拟一条限速、高延迟的链路，对比不同窗口配置的下载吞吐与交互延迟
+//
+// 链路由进程内的 UDP 中继模拟（固定 RTT + 限速 + 有限排队缓冲），服务端向客户端发送大文件，
+// 同时在另一条流上每 50ms 往返一次 1 字节（模拟交互流量），统计大文件期间的往返延迟
+//
+// 用法：go run ./cmd/windowbench -rtt 200ms -rate 40 -size 16
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"uap-quic/pkg/window"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaultProfiles 默认对比的窗口配置（KB：单流初始:单流最大:连接初始:连接最大）
+const defaultProfiles = "small=256:512:512:1024,medium=512:1536:1536:3072,default=2048:6144:6144:15360,large=8192:32768:16384:65536"
+
+// pingInterval 交互流量的往返间隔
+const pingInterval = 50 * time.Millisecond
+
+// profile 一组待测的窗口配置
+type profile struct {
+	name    string
+	windows window.Config
+}
+
+// result 单组配置的测试结果
+type result struct {
+	throughput float64 // Mbit/s
+	pingP50    time.Duration
+	pingMax    time.Duration
+}
+
+func main() {
+	rtt := flag.Duration("rtt", 200*time.Millisecond, "模拟链路的往返延迟")
+	rate := flag.Float64("rate", 40, "模拟链路的带宽 (Mbit/s，两个方向相同)")
+	buffer := flag.Int("buffer", 4096, "模拟链路每个方向的排队缓冲 (KB)，超出后丢包；缓冲越大，窗口过大时的排队延迟越明显")
+	size := flag.Int("size", 16, "每组配置下载的数据量 (MB)")
+	profiles := flag.String("profiles", defaultProfiles, "待测窗口配置（逗号分隔的 名称=单流初始:单流最大:连接初始:连接最大，单位 KB）")
+	flag.Parse()
+
+	list, err := parseProfiles(*profiles)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	bdp := *rate * 1e6 / 8 * rtt.Seconds()
+	log.Printf("🔧 模拟链路: RTT %v, 带宽 %.0f Mbit/s, 缓冲 %dKB, 带宽时延积 %.0fKB", *rtt, *rate, *buffer, bdp/1024)
+
+	results := make([]result, len(list))
+	for i, p := range list {
+		log.Printf("🚀 测试 %s (%s)...", p.name, p.windows)
+		r, err := run(p.windows, *rtt, *rate, *buffer<<10, int64(*size)<<20)
+		if err != nil {
+			log.Fatalf("❌ %s 测试失败: %v", p.name, err)
+		}
+		results[i] = r
+	}
+
+	fmt.Println()
+	fmt.Printf("%-10s %-34s %12s %12s %12s\n", "配置", "窗口 (KB)", "吞吐 Mbit/s", "交互 P50", "交互最大")
+	for i, p := range list {
+		r := results[i]
+		fmt.Printf("%-10s %-34s %12.1f %12v %12v\n", p.name, p.windows, r.throughput,
+			r.pingP50.Round(time.Millisecond), r.pingMax.Round(time.Millisecond))
+	}
+	fmt.Println()
+	fmt.Println("单流吞吐上限约为 单流最大窗口 / RTT；窗口超过 带宽时延积 + 缓冲 后吞吐不再提高，只增加排队延迟")
+}
+
+// parseProfiles 解析 -profiles
+func parseProfiles(s string) ([]profile, error) {
+	var list []profile
+	for _, item := range strings.Split(s, ",") {
+		name, sizes, ok := strings.Cut(strings.TrimSpace(item), "=")
+		parts := strings.Split(sizes, ":")
+		if !ok || len(parts) != 4 {
+			return nil, fmt.Errorf("窗口配置格式错误: %q（期望 名称=单流初始:单流最大:连接初始:连接最大）", item)
+		}
+		kb := make([]int, 4)
+		for i, p := range parts {
+			n, err := strconv.Atoi(p)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("窗口配置 %s 中的大小无效: %q", name, p)
+			}
+			kb[i] = n
+		}
+		w := window.FromKB(kb[0], kb[1], kb[2], kb[3])
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("窗口配置 %s: %w", name, err)
+		}
+		list = append(list, profile{name: name, windows: w})
+	}
+	return list, nil
+}
+
+// run 用一组窗口配置完成一次下载测试（两端使用相同的窗口）
+func run(w window.Config, rtt time.Duration, rateMbps float64, buffer int, size int64) (result, error) {
+	tlsConf, err := selfSignedTLS()
+	if err != nil {
+		return result{}, err
+	}
+	quicConf := &quic.Config{MaxIdleTimeout: 30 * time.Second}
+	w.Apply(quicConf)
+
+	ln, err := quic.ListenAddr("127.0.0.1:0", tlsConf, quicConf)
+	if err != nil {
+		return result{}, err
+	}
+	defer ln.Close()
+	go serve(ln, size)
+
+	link, err := newLink(ln.Addr().(*net.UDPAddr), rtt, rateMbps*1e6/8, buffer)
+	if err != nil {
+		return result{}, err
+	}
+	defer link.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, link.Addr().String(),
+		&tls.Config{InsecureSkipVerify: true, NextProtos: []string{"windowbench"}}, quicConf)
+	if err != nil {
+		return result{}, err
+	}
+	defer conn.CloseWithError(0, "")
+
+	bulk, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return result{}, err
+	}
+	ping, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return result{}, err
+	}
+	// 流的首字节告诉服务端用途：'b' 大文件，'p' 交互往返
+	if _, err := bulk.Write([]byte{'b'}); err != nil {
+		return result{}, err
+	}
+	if _, err := ping.Write([]byte{'p'}); err != nil {
+		return result{}, err
+	}
+
+	done := make(chan struct{})
+	var rtts []time.Duration
+	var pingWG sync.WaitGroup
+	pingWG.Add(1)
+	go func() {
+		defer pingWG.Done()
+		buf := make([]byte, 1)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(pingInterval):
+			}
+			start := time.Now()
+			if _, err := ping.Write(buf); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(ping, buf); err != nil {
+				return
+			}
+			rtts = append(rtts, time.Since(start))
+		}
+	}()
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, bulk)
+	elapsed := time.Since(start)
+	close(done)
+	ping.CancelRead(0)
+	pingWG.Wait()
+	if err != nil {
+		return result{}, err
+	}
+	if n != size {
+		return result{}, fmt.Errorf("只收到 %d / %d 字节", n, size)
+	}
+
+	r := result{throughput: float64(n) * 8 / elapsed.Seconds() / 1e6}
+	if len(rtts) > 0 {
+		sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+		r.pingP50 = rtts[len(rtts)/2]
+		r.pingMax = rtts[len(rtts)-1]
+	}
+	return r, nil
+}
+
+// serve 测试服务端：'b' 流发送 size 字节后关闭，'p' 流原样回显
+func serve(ln *quic.Listener, size int64) {
+	for {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				go func() {
+					kind := make([]byte, 1)
+					if _, err := io.ReadFull(stream, kind); err != nil {
+						return
+					}
+					if kind[0] == 'p' {
+						io.Copy(stream, stream)
+						return
+					}
+					io.CopyN(stream, zeroReader{}, size)
+					stream.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// zeroReader 无限的全零数据
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// selfSignedTLS 测试用的自签名证书
+func selfSignedTLS() (*tls.Config, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: priv}},
+		NextProtos:   []string{"windowbench"},
+	}, nil
+}
+
+// link 模拟链路：客户端发往中继的包转发给服务端，服务端的回包转发给客户端
+// 每个方向按带宽串行发送（排队超过缓冲时丢包），再加上单程延迟 rtt/2
+type link struct {
+	conn   *net.UDPConn
+	server *net.UDPAddr
+
+	mu     sync.Mutex
+	client *net.UDPAddr // 第一个发来数据的地址视为客户端
+
+	up, down *pipe
+}
+
+func newLink(server *net.UDPAddr, rtt time.Duration, bytesPerSec float64, buffer int) (*link, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	l := &link{conn: conn, server: server}
+	l.up = newPipe(rtt/2, bytesPerSec, buffer, func(p []byte) { conn.WriteToUDP(p, server) })
+	l.down = newPipe(rtt/2, bytesPerSec, buffer, func(p []byte) {
+		l.mu.Lock()
+		client := l.client
+		l.mu.Unlock()
+		if client != nil {
+			conn.WriteToUDP(p, client)
+		}
+	})
+	go l.loop()
+	return l, nil
+}
+
+func (l *link) Addr() net.Addr { return l.conn.LocalAddr() }
+
+func (l *link) Close() error {
+	l.up.close()
+	l.down.close()
+	return l.conn.Close()
+}
+
+func (l *link) loop() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		p := append([]byte(nil), buf[:n]...)
+		if from.IP.Equal(l.server.IP) && from.Port == l.server.Port {
+			l.down.send(p)
+			continue
+		}
+		l.mu.Lock()
+		if l.client == nil {
+			l.client = from
+		}
+		l.mu.Unlock()
+		l.up.send(p)
+	}
+}
+
+// pipe 链路的一个方向
+type pipe struct {
+	delay       time.Duration
+	bytesPerSec float64
+	buffer      int
+	deliver     func([]byte)
+
+	mu       sync.Mutex
+	nextFree time.Time // 链路空闲的时刻（之前排队的包发送完毕）
+	closed   bool
+	queue    chan packet
+}
+
+// packet 排队中的包
+type packet struct {
+	data []byte
+	at   time.Time // 到达对端的时刻
+}
+
+func newPipe(delay time.Duration, bytesPerSec float64, buffer int, deliver func([]byte)) *pipe {
+	p := &pipe{delay: delay, bytesPerSec: bytesPerSec, buffer: buffer, deliver: deliver, queue: make(chan packet, 65536)}
+	go p.loop()
+	return p
+}
+
+// send 按带宽排队，排队数据超过缓冲时丢弃
+func (p *pipe) send(data []byte) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	if p.nextFree.Before(now) {
+		p.nextFree = now
+	}
+	queued := p.nextFree.Sub(now).Seconds() * p.bytesPerSec
+	if int(queued)+len(data) > p.buffer {
+		return
+	}
+	p.nextFree = p.nextFree.Add(time.Duration(float64(len(data)) / p.bytesPerSec * float64(time.Second)))
+	select {
+	case p.queue <- packet{data: data, at: p.nextFree.Add(p.delay)}:
+	default:
+	}
+}
+
+// loop 按到达时刻依次投递（发送时刻单调递增，队列天然有序）
+func (p *pipe) loop() {
+	for pkt := range p.queue {
+		if d := time.Until(pkt.at); d > 0 {
+			time.Sleep(d)
+		}
+		p.deliver(pkt.data)
+	}
+}
+
+func (p *pipe) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	close(p.queue)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/window"
+)
+
+func TestParseProfiles(t *testing.T) {
+	list, err := parseProfiles(defaultProfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range list {
+		names = append(names, p.name)
+	}
+	if strings.Join(names, ",") != "small,medium,default,large" || list[2].windows != window.Default {
+		t.Fatalf("默认配置解析为 %v / %s", names, list[2].windows)
+	}
+
+	for _, s := range []string{
+		"small",                   // 缺少大小
+		"small=256:512:512",       // 只有三项
+		"small=256:512:x:1024",    // 非数字
+		"small=0:512:512:1024",    // 非正数
+		"small=32:512:512:1024",   // 小于 MinSize
+		"small=256:4096:512:1024", // 单流最大大于连接最大
+	} {
+		if _, err := parseProfiles(s); err == nil {
+			t.Errorf("parseProfiles(%q) 应返回错误", s)
+		}
+	}
+}
+
+// TestRunWindowLimitsThroughput 高延迟链路上小窗口限制吞吐（约为 窗口 / RTT），默认窗口能跑满链路带宽
+func TestRunWindowLimitsThroughput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short 模式跳过模拟链路测试")
+	}
+	const (
+		rtt  = 100 * time.Millisecond
+		rate = 40 // Mbit/s
+		size = 2 << 20
+	)
+	small, err := run(window.FromKB(64, 64, 64, 128), rtt, rate, 4<<20, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := run(window.Default, rtt, rate, 4<<20, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 64KB 窗口在 100ms RTT 下最多约 5 Mbit/s
+	if small.throughput > 8 {
+		t.Fatalf("64KB 窗口的吞吐 %.1f Mbit/s，超过 窗口 / RTT 的上限", small.throughput)
+	}
+	if large.throughput < 2*small.throughput {
+		t.Fatalf("默认窗口吞吐 %.1f Mbit/s，未明显高于 64KB 窗口的 %.1f Mbit/s", large.throughput, small.throughput)
+	}
+	t.Logf("64KB 窗口 %.1f Mbit/s，默认窗口 %.1f Mbit/s", small.throughput, large.throughput)
+}
+
+// BenchmarkWindows 各默认配置在模拟链路（100ms RTT、40 Mbit/s）上的吞吐与交互延迟
+// go test ./cmd/windowbench -run ^$ -bench Windows -benchtime 1x
+func BenchmarkWindows(b *testing.B) {
+	list, err := parseProfiles(defaultProfiles)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, p := range list {
+		b.Run(p.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				r, err := run(p.windows, 100*time.Millisecond, 40, 4<<20, 4<<20)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(r.throughput, "Mbit/s")
+				b.ReportMetric(float64(r.pingP50.Milliseconds()), "ping-p50-ms")
+			}
+		})
+	}
+}
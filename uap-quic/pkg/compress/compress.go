@@ -0,0 +1,231 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 压缩流帧格式：类型 (1 字节) + 长度 (2 字节, 大端) + 数据
+// 每帧独立压缩（不依赖前面的帧），发送方可以逐帧决定是否压缩，已压缩的内容原样发送
+const (
+	frameRaw     byte = 0x00 // 原始数据
+	frameDeflate byte = 0x01 // DEFLATE 压缩数据（完整的 DEFLATE 流）
+)
+
+// MaxChunkSize 单帧原始数据的最大长度，解压结果超过该长度视为错误（防止解压炸弹）
+const MaxChunkSize = 32 * 1024
+
+// 自适应参数
+const (
+	minCompressSize   = 256 // 小于该长度的数据直接发送，压缩收益抵不过开销
+	maxIncompressible = 8   // 连续多少帧压缩无收益后放弃压缩（媒体、已压缩的下载等）
+)
+
+// compressible 压缩结果至少比原始数据小 10% 才发送压缩帧
+func compressible(raw, compressed int) bool {
+	return compressed < raw-raw/10
+}
+
+// Writer 把写入的数据按帧压缩后写入下层流（单方向，调用方需保证只有一个写入者）
+type Writer struct {
+	w       io.Writer
+	fw      *flate.Writer
+	buf     bytes.Buffer
+	sniffed bool // 已检查第一帧
+	off     bool // 已放弃压缩
+	misses  int  // 连续压缩无收益的帧数
+
+	raw  int64 // 写入的原始字节数
+	wire int64 // 实际写入下层流的字节数（含帧头）
+}
+
+// NewWriter 创建压缩写入器
+func NewWriter(w io.Writer) *Writer {
+	fw, _ := flate.NewWriter(nil, flate.BestSpeed) // 级别合法时不会出错
+	return &Writer{w: w, fw: fw}
+}
+
+// Write 按 MaxChunkSize 分帧写入
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxChunkSize {
+			chunk = chunk[:MaxChunkSize]
+		}
+		if err := w.writeChunk(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// writeChunk 写入一帧：能压缩则发送压缩帧，否则发送原始帧
+func (w *Writer) writeChunk(chunk []byte) error {
+	if !w.sniffed {
+		w.sniffed = true
+		w.off = Incompressible(chunk)
+	}
+
+	frameType, payload := frameRaw, chunk
+	if !w.off && len(chunk) >= minCompressSize {
+		w.buf.Reset()
+		w.buf.Write([]byte{frameDeflate, 0, 0}) // 帧头占位
+		w.fw.Reset(&w.buf)
+		w.fw.Write(chunk)
+		w.fw.Close()
+		if compressed := w.buf.Len() - 3; compressible(len(chunk), compressed) {
+			frameType, payload = frameDeflate, w.buf.Bytes()[3:]
+			w.misses = 0
+		} else {
+			w.misses++
+			w.off = w.misses >= maxIncompressible
+		}
+	}
+
+	var frame []byte
+	if frameType == frameDeflate {
+		frame = w.buf.Bytes()
+	} else {
+		w.buf.Reset()
+		w.buf.Write([]byte{frameRaw, 0, 0})
+		w.buf.Write(chunk)
+		frame = w.buf.Bytes()
+	}
+	binary.BigEndian.PutUint16(frame[1:3], uint16(len(payload)))
+
+	if _, err := w.w.Write(frame); err != nil {
+		return err
+	}
+	w.raw += int64(len(chunk))
+	w.wire += int64(len(frame))
+	return nil
+}
+
+// Stats 写入的原始字节数与实际传输字节数
+func (w *Writer) Stats() (raw, wire int64) {
+	return w.raw, w.wire
+}
+
+// Reader 从下层流读取压缩帧并解压（单方向）
+type Reader struct {
+	r       io.Reader
+	fr      io.ReadCloser
+	payload []byte
+	out     []byte
+	pending []byte // 已解码、尚未被读取的数据
+
+	raw  int64 // 解码后的原始字节数
+	wire int64 // 从下层流读取的字节数（含帧头）
+}
+
+// NewReader 创建解压读取器
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:       r,
+		payload: make([]byte, 0xFFFF),
+		out:     make([]byte, MaxChunkSize+1),
+	}
+}
+
+// Read 读取解压后的数据
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if err := r.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// readFrame 读取并解码一帧
+func (r *Reader) readFrame() error {
+	var header [3]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return err
+	}
+	n := int(binary.BigEndian.Uint16(header[1:]))
+	payload := r.payload[:n]
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return unexpectedEOF(err)
+	}
+	r.wire += int64(3 + n)
+
+	switch header[0] {
+	case frameRaw:
+		if n > MaxChunkSize {
+			return fmt.Errorf("原始帧过大: %d 字节", n)
+		}
+		r.pending = payload
+	case frameDeflate:
+		src := bytes.NewReader(payload)
+		if r.fr == nil {
+			r.fr = flate.NewReader(src)
+		} else {
+			r.fr.(flate.Resetter).Reset(src, nil)
+		}
+		// 多读一个字节用于判断解压结果是否超过 MaxChunkSize
+		m, err := io.ReadFull(r.fr, r.out)
+		if err == nil {
+			return fmt.Errorf("压缩帧解压后超过 %d 字节", MaxChunkSize)
+		}
+		if err != io.ErrUnexpectedEOF && err != io.EOF {
+			return fmt.Errorf("解压失败: %w", err)
+		}
+		r.pending = r.out[:m]
+	default:
+		return fmt.Errorf("未知的帧类型: 0x%02x", header[0])
+	}
+	r.raw += int64(len(r.pending))
+	return nil
+}
+
+// Stats 解码后的原始字节数与实际传输字节数
+func (r *Reader) Stats() (raw, wire int64) {
+	return r.raw, r.wire
+}
+
+// unexpectedEOF 帧读到一半遇到 EOF 属于截断
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Incompressible 根据数据开头判断是否为已加密或已压缩的内容（TLS 记录、常见压缩与媒体格式）
+func Incompressible(p []byte) bool {
+	// TLS 记录：类型 0x14-0x17 + 版本 0x03 0x00-0x04
+	if len(p) >= 3 && p[0] >= 0x14 && p[0] <= 0x17 && p[1] == 0x03 && p[2] <= 0x04 {
+		return true
+	}
+	for _, magic := range incompressibleMagic {
+		if bytes.HasPrefix(p, magic) {
+			return true
+		}
+	}
+	// MP4 / MOV: 第 4-8 字节为 "ftyp"
+	return len(p) >= 8 && string(p[4:8]) == "ftyp"
+}
+
+// incompressibleMagic 已压缩格式的文件头
+var incompressibleMagic = [][]byte{
+	{0x1f, 0x8b},             // gzip
+	{0x28, 0xb5, 0x2f, 0xfd}, // zstd
+	{'P', 'K', 0x03, 0x04},   // zip
+	{0x89, 'P', 'N', 'G'},    // png
+	{0xff, 0xd8, 0xff},       // jpeg
+	{'G', 'I', 'F', '8'},     // gif
+	{'R', 'I', 'F', 'F'},     // webp / avi / wav
+	{0x1a, 0x45, 0xdf, 0xa3}, // webm / mkv
+	{'I', 'D', '3'},          // mp3
+	{'O', 'g', 'g', 'S'},     // ogg
+	{'7', 'z', 0xbc, 0xaf},   // 7z
+}
@@ -0,0 +1,206 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// sampleHTML 模拟常见网页：重复的标签结构与文本
+func sampleHTML(size int) []byte {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>UAP</title></head><body>\n")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "<div class=\"item\" id=\"item-%d\"><a href=\"/articles/%d\">文章标题 %d</a><p>这是一段摘要文本，用于测试压缩效果。</p></div>\n", i, i, i)
+	}
+	return []byte(b.String()[:size])
+}
+
+// randomBytes 不可压缩的随机数据
+func randomBytes(size int) []byte {
+	p := make([]byte, size)
+	rand.Read(p)
+	return p
+}
+
+// roundTrip 压缩写入后读回，返回读到的数据与写入端统计
+func roundTrip(t testing.TB, data []byte, writes int) ([]byte, int64, int64) {
+	t.Helper()
+	var wire bytes.Buffer
+	w := NewWriter(&wire)
+	step := (len(data) + writes - 1) / writes
+	for off := 0; off < len(data); off += step {
+		end := off + step
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, sent := w.Stats()
+	if sent != int64(wire.Len()) {
+		t.Fatalf("写入端统计 %d 字节，实际 %d 字节", sent, wire.Len())
+	}
+
+	r := NewReader(&wire)
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rRaw, rWire := r.Stats(); rRaw != raw || rWire != sent {
+		t.Fatalf("读取端统计 %d/%d，写入端 %d/%d", rRaw, rWire, raw, sent)
+	}
+	return got, raw, sent
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := map[string][]byte{
+		"HTML":      sampleHTML(200 * 1024),
+		"随机数据":      randomBytes(100 * 1024),
+		"小于压缩阈值":    []byte("hello"),
+		"跨多个帧的单次写入": sampleHTML(3*MaxChunkSize + 17),
+	}
+	for name, data := range cases {
+		for _, writes := range []int{1, 7} {
+			got, _, _ := roundTrip(t, data, writes)
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s（%d 次写入）: 读回的数据不一致", name, writes)
+			}
+		}
+	}
+}
+
+func TestHTMLSavings(t *testing.T) {
+	data := sampleHTML(256 * 1024)
+	_, raw, wire := roundTrip(t, data, 16)
+	// 网页文本至少节省一半流量
+	if wire*2 > raw {
+		t.Fatalf("HTML 压缩后 %d 字节，原始 %d 字节", wire, raw)
+	}
+	t.Logf("HTML: %d -> %d 字节（节省 %.1f%%）", raw, wire, 100*(1-float64(wire)/float64(raw)))
+}
+
+func TestIncompressibleFallback(t *testing.T) {
+	// 随机数据：每帧压缩无收益，帧头之外几乎没有额外开销
+	data := randomBytes(64 * MaxChunkSize)
+	_, raw, wire := roundTrip(t, data, 64)
+	if overhead := wire - raw; overhead > 64*3 {
+		t.Fatalf("不可压缩数据额外传输 %d 字节", overhead)
+	}
+
+	// 已识别的压缩格式从第一帧起不压缩
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(append([]byte{0x1f, 0x8b}, sampleHTML(4096)...))
+	if buf.Bytes()[0] != frameRaw {
+		t.Fatal("gzip 数据不应压缩")
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	yes := map[string][]byte{
+		"TLS 握手": {0x16, 0x03, 0x01, 0x02, 0x00},
+		"TLS 数据": {0x17, 0x03, 0x03, 0x00, 0x20},
+		"gzip":   {0x1f, 0x8b, 0x08},
+		"png":    {0x89, 'P', 'N', 'G', '\r', '\n'},
+		"jpeg":   {0xff, 0xd8, 0xff, 0xe0},
+		"mp4":    {0, 0, 0, 0x20, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm'},
+		"webm":   {0x1a, 0x45, 0xdf, 0xa3},
+		"zip":    {'P', 'K', 0x03, 0x04},
+	}
+	for name, p := range yes {
+		if !Incompressible(p) {
+			t.Errorf("%s 应识别为不可压缩", name)
+		}
+	}
+	no := map[string][]byte{
+		"HTTP 请求":  []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		"HTML":     sampleHTML(64),
+		"JSON":     []byte(`{"key":"value"}`),
+		"空":        nil,
+		"TLS 版本错误": {0x16, 0x05, 0x01},
+	}
+	for name, p := range no {
+		if Incompressible(p) {
+			t.Errorf("%s 不应识别为不可压缩", name)
+		}
+	}
+}
+
+// frame 构造一帧
+func frame(frameType byte, payload []byte) []byte {
+	header := []byte{frameType, 0, 0}
+	binary.BigEndian.PutUint16(header[1:], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReaderRejectsBadFrames(t *testing.T) {
+	// 解压炸弹：解压结果超过 MaxChunkSize
+	var bomb bytes.Buffer
+	fw, _ := flate.NewWriter(&bomb, flate.BestCompression)
+	fw.Write(make([]byte, MaxChunkSize+1))
+	fw.Close()
+
+	cases := map[string][]byte{
+		"解压后过大":  frame(frameDeflate, bomb.Bytes()),
+		"原始帧过大":  frame(frameRaw, make([]byte, MaxChunkSize+1)),
+		"未知帧类型":  frame(0x7f, []byte("x")),
+		"损坏的压缩帧": frame(frameDeflate, []byte{0xff, 0xff, 0xff}),
+	}
+	for name, data := range cases {
+		if _, err := io.ReadAll(NewReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+
+	// 帧截断
+	truncated := frame(frameRaw, []byte("hello"))[:5]
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(truncated))); err != io.ErrUnexpectedEOF {
+		t.Errorf("截断的帧返回 %v", err)
+	}
+}
+
+// BenchmarkWriteHTML 压缩 HTML 的吞吐与节省比例
+func BenchmarkWriteHTML(b *testing.B) {
+	data := sampleHTML(MaxChunkSize)
+	w := NewWriter(io.Discard)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(data)
+	}
+	raw, wire := w.Stats()
+	b.ReportMetric(100*(1-float64(wire)/float64(raw)), "%saved")
+}
+
+// BenchmarkWriteRandom 不可压缩数据（放弃压缩后）的写入开销
+func BenchmarkWriteRandom(b *testing.B) {
+	data := randomBytes(MaxChunkSize)
+	w := NewWriter(io.Discard)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(data)
+	}
+}
+
+// BenchmarkReadHTML 解压 HTML 的吞吐
+func BenchmarkReadHTML(b *testing.B) {
+	data := sampleHTML(MaxChunkSize)
+	var wire bytes.Buffer
+	NewWriter(&wire).Write(data)
+	encoded := wire.Bytes()
+	buf := make([]byte, MaxChunkSize)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewReader(bytes.NewReader(encoded))
+		io.ReadFull(r, buf)
+	}
+}
@@ -0,0 +1,109 @@
+// Package config 生效配置导出：合并命令行参数、环境变量与默认值，标注每个值的来源，敏感值替换为指纹（-print-config 使用）
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+)
+
+// 配置值的来源
+const (
+	SourceFlag    = "flag"    // 命令行参数
+	SourceEnv     = "env"     // 环境变量（参数未设置时作为默认值）
+	SourceFile    = "file"    // 从文件读取（如 TLS 私钥）
+	SourceDefault = "default" // 内置默认值
+	SourceAPI     = "api"     // SDK 通过 Set* 接口设置
+)
+
+// Unset 敏感值未设置时的显示值
+const Unset = "(unset)"
+
+// Entry 一项生效配置
+type Entry struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	Env    string      `json:"env,omitempty"`    // 对应的环境变量（如 UAP_PSK）
+	Secret bool        `json:"secret,omitempty"` // 值为指纹而非原文
+}
+
+// Spec 从命令行参数生成配置时的附加信息
+type Spec struct {
+	Env     map[string]string   // 参数名 → 环境变量名（参数默认值读取该环境变量）
+	Secrets []string            // 敏感参数名，值替换为指纹
+	Getenv  func(string) string // 读取环境变量，nil 时使用 os.Getenv
+}
+
+// Fingerprint 敏感值（Token、票据、PSK、密钥等）的指纹：sha256 的前 8 个十六进制字符（与 uap-admin 的 utils.Fingerprint 相同），
+// 生效配置与日志中同一个值的指纹一致，可以比对、关联而不泄露原文；空值为 Unset
+func Fingerprint(secret string) string {
+	if secret == "" {
+		return Unset
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// Secret 敏感值的配置项
+func Secret(secret, source string) Entry {
+	return Entry{Value: Fingerprint(secret), Source: source, Secret: true}
+}
+
+// FromFlags 按 fs 已解析的参数生成生效配置，每个参数一项（包括未设置、取默认值的参数）
+// 来源优先级：命令行显式设置 > 环境变量（非空）> 内置默认值；敏感参数的值替换为指纹
+func FromFlags(fs *flag.FlagSet, spec Spec) map[string]Entry {
+	getenv := spec.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	secrets := make(map[string]bool, len(spec.Secrets))
+	for _, name := range spec.Secrets {
+		secrets[name] = true
+	}
+	visited := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+
+	entries := make(map[string]Entry)
+	fs.VisitAll(func(f *flag.Flag) {
+		e := Entry{Source: SourceDefault, Env: spec.Env[f.Name]}
+		switch {
+		case visited[f.Name]:
+			e.Source = SourceFlag
+		case e.Env != "" && getenv(e.Env) != "":
+			e.Source = SourceEnv
+		}
+		if secrets[f.Name] {
+			e.Value, e.Secret = Fingerprint(f.Value.String()), true
+		} else {
+			e.Value = flagValue(f)
+		}
+		entries[f.Name] = e
+	})
+	return entries
+}
+
+// flagValue 参数的取值：基本类型保留 JSON 类型，时长等其他类型使用字符串形式
+func flagValue(f *flag.Flag) interface{} {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	switch v := getter.Get().(type) {
+	case bool, int, int64, uint, uint64, float64, string:
+		return v
+	case time.Duration:
+		return v.String()
+	}
+	return f.Value.String()
+}
+
+// Marshal 编码为缩进的 JSON：program 为程序名，config 中的键按名称排序，输出确定
+func Marshal(program string, entries map[string]Entry) ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Program string           `json:"program"`
+		Config  map[string]Entry `json:"config"`
+	}{program, entries}, "", "  ")
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFlagSet 与客户端 / 服务端相同的定义方式：环境变量作为参数的默认值
+func newFlagSet(env map[string]string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("psk", env["UAP_PSK"], "")
+	fs.String("server", "uaptest.org:52222", "")
+	fs.String("mode", env["UAP_MODE"], "")
+	fs.Int("port", 1080, "")
+	fs.Bool("compress", false, "")
+	fs.Float64("bulk-rate", 0, "")
+	fs.Duration("idle-timeout", 30*time.Second, "")
+	return fs
+}
+
+// entriesFor 按 args 与环境变量生成生效配置
+func entriesFor(t *testing.T, args []string, env map[string]string) map[string]Entry {
+	t.Helper()
+	fs := newFlagSet(env)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return FromFlags(fs, Spec{
+		Env:     map[string]string{"psk": "UAP_PSK", "mode": "UAP_MODE"},
+		Secrets: []string{"psk"},
+		Getenv:  func(name string) string { return env[name] },
+	})
+}
+
+func TestFromFlagsPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		value  interface{}
+		source string
+	}{
+		{"默认值", nil, nil, "", SourceDefault},
+		{"环境变量", nil, map[string]string{"UAP_MODE": "global"}, "global", SourceEnv},
+		{"空的环境变量视为未设置", nil, map[string]string{"UAP_MODE": ""}, "", SourceDefault},
+		{"参数", []string{"-mode", "smart"}, nil, "smart", SourceFlag},
+		{"参数优先于环境变量", []string{"-mode", "smart"}, map[string]string{"UAP_MODE": "global"}, "smart", SourceFlag},
+		{"显式设置为空也是参数", []string{"-mode="}, map[string]string{"UAP_MODE": "global"}, "", SourceFlag},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := entriesFor(t, tc.args, tc.env)["mode"]
+			if e.Value != tc.value || e.Source != tc.source || e.Env != "UAP_MODE" || e.Secret {
+				t.Fatalf("mode = %+v，期望 %q 来自 %s", e, tc.value, tc.source)
+			}
+		})
+	}
+}
+
+func TestFromFlagsSecrets(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		env    map[string]string
+		secret string
+		source string
+	}{
+		{nil, nil, "", SourceDefault},
+		{nil, map[string]string{"UAP_PSK": "env-key"}, "env-key", SourceEnv},
+		{[]string{"-psk", "flag-key"}, map[string]string{"UAP_PSK": "env-key"}, "flag-key", SourceFlag},
+	} {
+		e := entriesFor(t, tc.args, tc.env)["psk"]
+		if !e.Secret || e.Value != Fingerprint(tc.secret) || e.Source != tc.source {
+			t.Errorf("psk = %+v，期望 %s 的指纹来自 %s", e, tc.secret, tc.source)
+		}
+	}
+
+	// 输出中不出现原文
+	out, err := Marshal("test", entriesFor(t, []string{"-psk", "very-secret-key"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("very-secret-key")) {
+		t.Fatalf("输出包含敏感值原文: %s", out)
+	}
+}
+
+func TestFromFlagsValues(t *testing.T) {
+	entries := entriesFor(t, []string{"-port", "1090", "-compress", "-idle-timeout", "1m"}, nil)
+	if len(entries) != 7 {
+		t.Fatalf("配置 %d 项，期望每个参数一项", len(entries))
+	}
+	// 基本类型保留 JSON 类型，时长使用字符串形式
+	for name, want := range map[string]interface{}{
+		"port":         1090,
+		"compress":     true,
+		"bulk-rate":    0.0,
+		"idle-timeout": "1m0s",
+		"server":       "uaptest.org:52222",
+	} {
+		if got := entries[name].Value; got != want {
+			t.Errorf("%s = %#v，期望 %#v", name, got, want)
+		}
+	}
+	if entries["port"].Source != SourceFlag || entries["server"].Source != SourceDefault || entries["server"].Env != "" {
+		t.Fatalf("来源 %+v / %+v", entries["port"], entries["server"])
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("") != Unset {
+		t.Fatal("空值应为 Unset")
+	}
+	a, b := Fingerprint("secret-a"), Fingerprint("secret-b")
+	if a == b || a != Fingerprint("secret-a") || !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+8 {
+		t.Fatalf("指纹 %s / %s", a, b)
+	}
+	if e := Secret("key", SourceFile); !e.Secret || e.Value != Fingerprint("key") || e.Source != SourceFile {
+		t.Fatalf("Secret = %+v", e)
+	}
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	env := map[string]string{"UAP_PSK": "k", "UAP_MODE": "global"}
+	args := []string{"-port", "1090"}
+	first, err := Marshal("uap-test", entriesFor(t, args, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		out, _ := Marshal("uap-test", entriesFor(t, args, env))
+		if !bytes.Equal(out, first) {
+			t.Fatalf("输出不确定:\n%s\n%s", first, out)
+		}
+	}
+
+	var decoded struct {
+		Program string           `json:"program"`
+		Config  map[string]Entry `json:"config"`
+	}
+	if err := json.Unmarshal(first, &decoded); err != nil || decoded.Program != "uap-test" || decoded.Config["mode"].Source != SourceEnv {
+		t.Fatalf("解码 %+v: %v", decoded, err)
+	}
+	// 键按名称排序
+	if i, j := bytes.Index(first, []byte(`"bulk-rate"`)), bytes.Index(first, []byte(`"server"`)); i < 0 || i > j {
+		t.Fatalf("键未排序:\n%s", first)
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// activityQueueSize 待投递给活动回调的记录上限，回调处理过慢时丢弃最旧的记录
+const activityQueueSize = 256
+
+// Activity 一条 SOCKS5 TCP 连接的分流记录（最近活动，见 SetActivityLog）
+type Activity struct {
+	Time     time.Time `json:"time"`           // 连接开始时间
+	Host     string    `json:"host,omitempty"` // 目标主机（隐藏主机时为空）
+	Port     int       `json:"port"`           // 目标端口
+	Action   string    `json:"action"`         // proxy / direct / block
+	Reason   string    `json:"reason"`         // 见 RouteReason* 常量
+	Rule     string    `json:"rule,omitempty"` // 命中的规则（隐藏主机时为空）
+	Bytes    int64     `json:"bytes"`          // 连接关闭时的上下行字节数合计
+	Duration int64     `json:"duration_ms"`    // 连接持续时长（毫秒）
+}
+
+// activityLog 最近活动：固定容量的环形缓冲（满时覆盖最旧的记录）与待投递给回调的队列
+type activityLog struct {
+	mu        sync.Mutex
+	hideHosts bool
+	ring      []Activity // 容量为保留条数，next 为下一个写入位置
+	next      int
+	count     int
+	handler   func(Activity)
+	pending   []Activity    // 待投递的记录（最多 activityQueueSize 条，旧的在前）
+	wake      chan struct{} // 有新的待投递记录
+}
+
+// activityRecord 进行中的连接的活动记录
+type activityRecord struct {
+	Activity
+	started time.Time
+	bytes   atomic.Int64
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
+
+// SetActivityLog 设置最近活动的保留条数（<= 0 关闭并清空，默认关闭）
+// 开启后每条 SOCKS5 TCP 连接结束时记录目标、分流动作、命中的规则与字节数，供界面展示"最近活动"；
+// hideHosts 为 true 时不记录主机与规则（只保留端口、动作与字节数）。调整条数时保留最新的记录
+func (c *Client) SetActivityLog(size int, hideHosts bool) {
+	l := &c.activity
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hideHosts = hideHosts
+	if size <= 0 {
+		l.ring, l.next, l.count = nil, 0, 0
+		return
+	}
+	kept := l.recentLocked(size)
+	l.ring = make([]Activity, size)
+	l.next, l.count = 0, 0
+	for i := len(kept) - 1; i >= 0; i-- {
+		l.addLocked(kept[i])
+	}
+}
+
+// SetActivityHandler 设置活动回调（nil 取消），每条连接结束时投递一次（需先用 SetActivityLog 开启）
+// 回调在单独的 goroutine 中按发生顺序调用；短时间内连接过多、回调处理不过来时丢弃最旧的未投递记录，不会阻塞转发
+func (c *Client) SetActivityHandler(handler func(Activity)) {
+	l := &c.activity
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handler = handler
+	if handler == nil {
+		l.pending = nil
+		return
+	}
+	if l.wake == nil {
+		l.wake = make(chan struct{}, 1)
+		go c.dispatchActivity(l.wake)
+	}
+}
+
+// RecentActivity 最近活动（新的在前），limit <= 0 表示全部
+func (c *Client) RecentActivity(limit int) []Activity {
+	l := &c.activity
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.recentLocked(limit)
+}
+
+// dispatchActivity 依次把待投递的记录交给回调，直到客户端停止
+func (c *Client) dispatchActivity(wake <-chan struct{}) {
+	l := &c.activity
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-wake:
+		}
+		l.mu.Lock()
+		handler, pending := l.handler, l.pending
+		l.pending = nil
+		l.mu.Unlock()
+		for _, a := range pending {
+			if handler == nil || c.ctx.Err() != nil {
+				break
+			}
+			handler(a)
+		}
+	}
+}
+
+// startActivity 开始记录一条连接（未开启最近活动时返回 nil）
+func (c *Client) startActivity(targetAddr string, d RouteDecision) *activityRecord {
+	l := &c.activity
+	l.mu.Lock()
+	enabled, hide := l.ring != nil, l.hideHosts
+	l.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	r := &activityRecord{started: time.Now()}
+	r.Time, r.Action, r.Reason = r.started, d.Action, d.Reason
+	if _, port, err := net.SplitHostPort(targetAddr); err == nil {
+		r.Port, _ = strconv.Atoi(port)
+	}
+	if !hide {
+		r.Host = d.Host
+		r.Rule = d.Rule
+	}
+	return r
+}
+
+// endActivity 连接结束：写入环形缓冲并投递给回调（r 为 nil 时忽略）
+func (c *Client) endActivity(r *activityRecord) {
+	if r == nil {
+		return
+	}
+	a := r.Activity
+	a.Bytes = r.bytes.Load()
+	a.Duration = time.Since(r.started).Milliseconds()
+
+	l := &c.activity
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ring == nil {
+		return // 期间关闭了最近活动
+	}
+	if l.hideHosts {
+		a.Host, a.Rule = "", "" // 期间开启了隐藏主机
+	}
+	l.addLocked(a)
+	if l.handler == nil {
+		return
+	}
+	if len(l.pending) >= activityQueueSize {
+		l.pending = l.pending[1:]
+	}
+	l.pending = append(l.pending, a)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writer 统计写入 w 的字节数（r 为 nil 时原样返回 w，不影响直连的零拷贝）
+func (r *activityRecord) writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return countingWriter{w: w, n: &r.bytes}
+}
+
+// addLocked 写入一条记录，缓冲已满时覆盖最旧的（调用方持有 mu）
+func (l *activityLog) addLocked(a Activity) {
+	l.ring[l.next] = a
+	l.next = (l.next + 1) % len(l.ring)
+	if l.count < len(l.ring) {
+		l.count++
+	}
+}
+
+// recentLocked 最近的 limit 条记录，新的在前（调用方持有 mu）
+func (l *activityLog) recentLocked(limit int) []Activity {
+	n := l.count
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]Activity, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, l.ring[(l.next-i+len(l.ring))%len(l.ring)])
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// addActivity 模拟一条到 host:port 的连接结束
+func addActivity(c *Client, host string, port int) {
+	rec := c.startActivity(net.JoinHostPort(host, fmt.Sprint(port)), RouteDecision{Host: host, Action: RouteProxy, Reason: RouteReasonRule, Rule: host})
+	c.endActivity(rec)
+}
+
+// activityPorts 记录的端口（按 RecentActivity 的顺序）
+func activityPorts(list []Activity) []int {
+	ports := make([]int, len(list))
+	for i, a := range list {
+		ports[i] = a.Port
+	}
+	return ports
+}
+
+func TestActivityRing(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+
+	// 默认关闭：不记录，也不统计字节
+	if rec := c.startActivity("example.com:443", RouteDecision{}); rec != nil || len(c.RecentActivity(0)) != 0 {
+		t.Fatal("未开启时记录了活动")
+	}
+
+	// 满时覆盖最旧的记录，新的在前
+	c.SetActivityLog(3, false)
+	for port := 1; port <= 5; port++ {
+		addActivity(c, "example.com", port)
+	}
+	if got := activityPorts(c.RecentActivity(0)); fmt.Sprint(got) != "[5 4 3]" {
+		t.Fatalf("最近活动 %v", got)
+	}
+	if got := activityPorts(c.RecentActivity(2)); fmt.Sprint(got) != "[5 4]" {
+		t.Fatalf("limit 2 %v", got)
+	}
+
+	// 调整条数保留最新的记录
+	c.SetActivityLog(2, false)
+	if got := activityPorts(c.RecentActivity(0)); fmt.Sprint(got) != "[5 4]" {
+		t.Fatalf("缩小后 %v", got)
+	}
+	c.SetActivityLog(4, false)
+	addActivity(c, "example.com", 6)
+	if got := activityPorts(c.RecentActivity(0)); fmt.Sprint(got) != "[6 5 4]" {
+		t.Fatalf("扩大后 %v", got)
+	}
+
+	// 关闭时清空；进行中的连接结束时不再写入
+	rec := c.startActivity("example.com:7", RouteDecision{})
+	c.SetActivityLog(0, false)
+	c.endActivity(rec)
+	if len(c.RecentActivity(0)) != 0 {
+		t.Fatal("关闭后仍有记录")
+	}
+}
+
+func TestActivityHideHosts(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+	c.SetActivityLog(8, true)
+	addActivity(c, "www.youtube.com", 443)
+	if a := c.RecentActivity(0)[0]; a.Host != "" || a.Rule != "" || a.Port != 443 || a.Action != RouteProxy {
+		t.Fatalf("隐藏主机时的记录 %+v", a)
+	}
+
+	// 连接进行中开启隐藏：结束时同样不记录主机
+	c.SetActivityLog(8, false)
+	rec := c.startActivity("www.youtube.com:443", RouteDecision{Host: "www.youtube.com", Rule: "youtube.com"})
+	c.SetActivityLog(8, true)
+	c.endActivity(rec)
+	if a := c.RecentActivity(1)[0]; a.Host != "" || a.Rule != "" {
+		t.Fatalf("进行中开启隐藏后的记录 %+v", a)
+	}
+
+	c.SetActivityLog(8, false)
+	addActivity(c, "www.youtube.com", 443)
+	if a := c.RecentActivity(1)[0]; a.Host != "www.youtube.com" || a.Rule != "www.youtube.com" {
+		t.Fatalf("关闭隐藏后的记录 %+v", a)
+	}
+}
+
+// TestActivityHandlerDropOldest 回调处理不过来时丢弃最旧的未投递记录，不阻塞连接
+func TestActivityHandlerDropOldest(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+	c.SetActivityLog(8, false)
+
+	release := make(chan struct{})
+	got := make(chan Activity, 4*activityQueueSize)
+	c.SetActivityHandler(func(a Activity) {
+		<-release
+		got <- a
+	})
+	const total = 3 * activityQueueSize
+	done := make(chan struct{})
+	go func() {
+		for port := 1; port <= total; port++ {
+			addActivity(c, "example.com", port)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("回调阻塞时连接结束被阻塞")
+	}
+	close(release)
+
+	var ports []int
+drain:
+	for {
+		select {
+		case a := <-got:
+			ports = append(ports, a.Port)
+		case <-time.After(200 * time.Millisecond):
+			break drain
+		}
+	}
+	// 按发生顺序投递，最新的记录一定送达，总数不超过队列上限加上回调中正在处理的一条
+	if len(ports) == 0 || len(ports) > activityQueueSize+1 || ports[len(ports)-1] != total {
+		t.Fatalf("投递了 %d 条，最后一条 %v", len(ports), ports[len(ports)-1:])
+	}
+	for i := 1; i < len(ports); i++ {
+		if ports[i] <= ports[i-1] {
+			t.Fatalf("投递乱序: %d 在 %d 之后", ports[i], ports[i-1])
+		}
+	}
+}
+
+// TestActivityThroughSOCKS 经 SOCKS5 转发的连接结束时记录分流动作与上下行字节数
+func TestActivityThroughSOCKS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(conn, conn, 5) // 回显 5 字节后关闭，relay 随下行结束返回
+			}()
+		}
+	}()
+
+	c := newRoutingClient(t, ModeSmart, "example.com\n")
+	c.SetActivityLog(8, false)
+	app, local := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer local.Close()
+		c.handleTCPConnect(local, ln.Addr().String())
+	}()
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(app, reply); err != nil || reply[1] != 0x00 {
+		t.Fatalf("SOCKS5 回复 %v: %v", reply, err)
+	}
+	app.Write([]byte("hello"))
+	io.ReadFull(app, make([]byte, 5))
+	<-done
+	app.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	if a := c.RecentActivity(0); len(a) != 1 || a[0].Port != port || a[0].Action != RouteDirect || a[0].Reason != RouteReasonLocal || a[0].Bytes != 10 || a[0].Time.IsZero() {
+		t.Fatalf("最近活动 %+v", a)
+	}
+
+	// 被拒绝的连接同样记录
+	c.SetKillSwitch(true)
+	connectThrough(t, c, "www.example.com:443")
+	for deadline := time.Now().Add(3 * time.Second); len(c.RecentActivity(0)) < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond) // 回复后连接才结束
+	}
+	if a := c.RecentActivity(1)[0]; a.Host != "www.example.com" || a.Action != RouteBlock || a.Bytes != 0 {
+		t.Fatalf("kill switch 拒绝的连接 %+v", a)
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+// ErrZonedAddress 带 zone 的 IPv6 地址（如 fe80::1%eth0）只对本机网卡有意义，不能经隧道转发
+var ErrZonedAddress = errors.New("带 zone 的 IPv6 地址不能经隧道转发")
+
+// normalizeHost 规范化目标主机：去掉方括号，IP 字面量统一为标准写法（IPv4 映射地址还原为 IPv4，保留 zone），域名原样返回
+// 分流、hosts 覆盖与日志都使用规范化后的主机；序列化为 host:port 时由 net.JoinHostPort 为 IPv6 加方括号
+func normalizeHost(host string) string {
+	if len(host) >= 2 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// splitTarget 拆分 host:port，返回规范化的主机（不带方括号）与端口
+func splitTarget(target string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, fmt.Errorf("目标地址格式错误: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("端口无效: %s", portStr)
+	}
+	return normalizeHost(host), uint16(port), nil
+}
+
+// normalizeTarget 规范化 host:port（IPv6 带方括号）；带 zone 的地址返回 ErrZonedAddress
+func normalizeTarget(target string) (string, error) {
+	host, port, err := splitTarget(target)
+	if err != nil {
+		return "", err
+	}
+	if hasZone(host) {
+		return "", fmt.Errorf("%w: %s", ErrZonedAddress, host)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// hasZone 主机是否为带 zone 的 IPv6 地址（链路本地地址，只能直连）
+func hasZone(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Zone() != ""
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	for in, want := range map[string]string{
+		"[2001:DB8::1]":    "2001:db8::1",
+		"2001:db8:0:0::1":  "2001:db8::1",
+		"[::ffff:1.2.3.4]": "1.2.3.4", // IPv4 映射地址还原为 IPv4
+		"fe80::1%eth0":     "fe80::1%eth0",
+		"[fe80::1%eth0]":   "fe80::1%eth0",
+		"1.2.3.4":          "1.2.3.4",
+		"Example.com":      "Example.com", // 域名原样返回
+	} {
+		if got := normalizeHost(in); got != want {
+			t.Errorf("normalizeHost(%q) = %q，期望 %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeTarget(t *testing.T) {
+	for in, want := range map[string]string{
+		"[2001:DB8::1]:443":   "[2001:db8::1]:443",
+		"[::ffff:1.2.3.4]:80": "1.2.3.4:80",
+		"[::1]:53":            "[::1]:53",
+		"example.com:443":     "example.com:443",
+	} {
+		if got, err := normalizeTarget(in); err != nil || got != want {
+			t.Errorf("normalizeTarget(%q) = %q, %v，期望 %q", in, got, err, want)
+		}
+	}
+	if _, err := normalizeTarget("[fe80::1%eth0]:22"); !errors.Is(err, ErrZonedAddress) {
+		t.Errorf("带 zone 的地址返回 %v", err)
+	}
+	for _, bad := range []string{"::1:80", "2001:db8::1", "[::1]:65536", "host"} {
+		if _, err := normalizeTarget(bad); err == nil {
+			t.Errorf("normalizeTarget(%q) 应返回错误", bad)
+		}
+	}
+}
+
+func TestAppendSOCKS5AddrIPv6(t *testing.T) {
+	cases := []struct {
+		target string
+		want   []byte
+	}{
+		{"[2001:db8::1]:443", []byte{0x04, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x01, 0xbb}},
+		{"[::ffff:1.2.3.4]:53", []byte{0x01, 1, 2, 3, 4, 0, 53}},
+		{"a.b:80", []byte{0x03, 3, 'a', '.', 'b', 0, 80}},
+	}
+	for _, tc := range cases {
+		got, err := appendSOCKS5Addr(nil, tc.target)
+		if err != nil || !bytes.Equal(got, tc.want) {
+			t.Errorf("appendSOCKS5Addr(%q) = %x, %v，期望 %x", tc.target, got, err, tc.want)
+		}
+	}
+	if _, err := appendSOCKS5Addr(nil, "[fe80::1%eth0]:53"); !errors.Is(err, ErrZonedAddress) {
+		t.Errorf("带 zone 的地址返回 %v", err)
+	}
+}
+
+func TestParseAddressIPv6(t *testing.T) {
+	c := NewClient("", "", 0, ModeGlobal)
+	cases := []struct {
+		atyp byte
+		addr []byte
+		want string
+	}{
+		{0x04, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "[2001:db8::1]:443"},
+		// 部分应用把 IPv6 字面量（可能带方括号）按域名类型发送
+		{0x03, append([]byte{13}, "[2001:DB8::1]"...), "[2001:db8::1]:443"},
+		{0x03, append([]byte{11}, "2001:db8::1"...), "[2001:db8::1]:443"},
+		{0x03, append([]byte{12}, "fe80::1%eth0"...), "[fe80::1%eth0]:443"},
+	}
+	for _, tc := range cases {
+		got, err := c.parseAddress(bytes.NewReader(append(tc.addr, 0x01, 0xbb)), tc.atyp)
+		if err != nil || got != tc.want {
+			t.Errorf("parseAddress(0x%02x, %q) = %q, %v，期望 %q", tc.atyp, tc.addr, got, err, tc.want)
+		}
+	}
+	// 不是 IP 字面量的冒号仍按非法域名拒绝
+	if _, err := c.parseAddress(bytes.NewReader(append(append([]byte{3}, "a:b"...), 0x01, 0xbb)), 0x03); err == nil {
+		t.Error("含冒号的域名被接受")
+	}
+}
+
+func TestRouteIPv6Literal(t *testing.T) {
+	c := newRoutingClient(t, ModeSmart, "2001:db8::1\n")
+
+	// 分流按不带方括号的标准写法匹配规则
+	for _, host := range []string{"[2001:db8::1]", "[2001:DB8:0::1]:443", "2001:db8::1"} {
+		if d := c.TestRoute(host); d.Action != RouteProxy || d.Host != "2001:db8::1" || d.Rule != "2001:db8::1" {
+			t.Errorf("TestRoute(%q) = %+v", host, d)
+		}
+	}
+	// 回环地址与带 zone 的链路本地地址任何模式下都直连
+	g := newRoutingClient(t, ModeGlobal, "")
+	for _, host := range []string{"[::1]:443", "::ffff:127.0.0.1", "fe80::1%eth0", "[fe80::1%eth0]:22"} {
+		if d := g.TestRoute(host); d.Action != RouteDirect || d.Reason != RouteReasonLocal {
+			t.Errorf("TestRoute(%q) = %+v，期望直连", host, d)
+		}
+	}
+	if d := g.TestRoute("[2001:db8::2]:443"); d.Action != RouteProxy {
+		t.Errorf("全局模式下 IPv6 目标 %+v", d)
+	}
+
+	// 带 zone 的地址不能经隧道转发
+	if _, err := c.DialTCP(context.Background(), "[fe80::1%eth0]:22"); !errors.Is(err, ErrZonedAddress) {
+		t.Errorf("DialTCP 带 zone 的地址返回 %v", err)
+	}
+	if _, err := socks5UDPHeader("[fe80::1%eth0]:53"); !errors.Is(err, ErrZonedAddress) {
+		t.Errorf("UDP 头部带 zone 的地址返回 %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// APIError uap-admin 返回的业务错误
+// 错误码与标识与 uap-admin pkg/response/codes.go 的错误码目录一致（5 位错误码，前 3 位为 HTTP 状态码）
+type APIError struct {
+	Status int    // HTTP 状态码
+	Code   int    // 业务错误码（如 40102）
+	Name   string // 错误标识（如 "token_expired"）
+	Msg    string // 服务端错误信息
+}
+
+// 客户端需要区别处理的错误（可用 errors.Is 判断）
+var (
+	ErrTokenMissing    = &APIError{Name: "token_missing"}    // 未携带 token
+	ErrTokenExpired    = &APIError{Name: "token_expired"}    // 登录已过期，需重新登录
+	ErrTokenInvalid    = &APIError{Name: "token_invalid"}    // token 无效，需重新登录
+	ErrUserNotFound    = &APIError{Name: "user_not_found"}   // 账户不存在（已被删除）
+	ErrQuotaExceeded   = &APIError{Name: "quota_exceeded"}   // 本计费周期流量已用尽
+	ErrNodeNotFound    = &APIError{Name: "node_not_found"}   // 节点不存在或已下线
+	ErrUpgradeRequired = &APIError{Name: "upgrade_required"} // 客户端版本过低，需要升级
+	ErrSelfCustody     = &APIError{Name: "self_custody"}     // 自托管钱包，服务端无法代为签名，需设置本地私钥
+)
+
+// Error 以错误标识开头，便于宿主 App 在只拿到错误信息时识别（如 "token_expired: Token 已过期"）
+func (e *APIError) Error() string {
+	if e.Msg == "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Msg)
+}
+
+// Is 按错误标识比较，支持 errors.Is(err, core.ErrTokenExpired)
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Name == e.Name
+}
+
+// ParseAPIError 将 uap-admin 的错误响应（统一信封的 code / error / msg）转换为 *APIError
+// 旧版 uap-admin 不返回错误标识时按 HTTP 状态码推断
+func ParseAPIError(status, code int, name, msg string) *APIError {
+	if name == "" {
+		switch status {
+		case http.StatusUpgradeRequired:
+			name = ErrUpgradeRequired.Name
+		case http.StatusUnauthorized:
+			name = ErrTokenInvalid.Name
+		default:
+			name = fmt.Sprintf("http_%d", status)
+		}
+	}
+	return &APIError{Status: status, Code: code, Name: name, Msg: msg}
+}
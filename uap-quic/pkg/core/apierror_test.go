@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAPIError(t *testing.T) {
+	cases := []struct {
+		status, code int
+		name         string
+		want         *APIError
+	}{
+		{401, 40102, "token_expired", ErrTokenExpired},
+		{402, 40201, "quota_exceeded", ErrQuotaExceeded},
+		{404, 40401, "user_not_found", ErrUserNotFound},
+		// 旧版 uap-admin 不返回错误标识：按 HTTP 状态码推断
+		{426, 426, "", ErrUpgradeRequired},
+		{401, 401, "", ErrTokenInvalid},
+	}
+	for _, tc := range cases {
+		err := fmt.Errorf("接口: %w", ParseAPIError(tc.status, tc.code, tc.name, "msg"))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%d/%q: %v 应匹配 %s", tc.code, tc.name, err, tc.want.Name)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != tc.status || apiErr.Code != tc.code {
+			t.Errorf("%d/%q: 解析结果 %+v", tc.code, tc.name, apiErr)
+		}
+	}
+
+	if err := ParseAPIError(500, 500, "", ""); err.Name != "http_500" || errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("未知错误: %+v", err)
+	}
+	if got := ParseAPIError(401, 40102, "token_expired", "Token 已过期").Error(); got != "token_expired: Token 已过期" {
+		t.Fatalf("错误信息 %q", got)
+	}
+}
+
+func TestFetchStatusMapsErrorCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code":40102,"error":"token_expired","msg":"Token 已过期"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("127.0.0.1:1", "expired-token", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	c.SetStatusURL(srv.URL)
+	_, err := c.FetchStatus()
+	if !errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("期望 ErrTokenExpired，实际 %v", err)
+	}
+}
@@ -2,37 +2,138 @@ package core
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"uap-quic/pkg/prio"
+	"uap-quic/pkg/psk"
+	"uap-quic/pkg/relay"
 	"uap-quic/pkg/router"
+	"uap-quic/pkg/sockbuf"
+	"uap-quic/pkg/target"
+	"uap-quic/pkg/udpstream"
+	"uap-quic/pkg/window"
 
 	"github.com/quic-go/quic-go"
 )
 
+// streamOpenTimeout 打开 QUIC 流的最长等待时间
+// 当并发流达到服务端 MaxIncomingStreams 上限时，OpenStreamSync 会一直阻塞，这里给它一个上限
+var streamOpenTimeout = 5 * time.Second
+
+// ServerName 连接节点时校验证书使用的域名（节点证书必须包含该域名）
+const ServerName = "uaptest.org"
+
 // Client UAP 客户端核心
 type Client struct {
 	// QUIC 连接状态
 	quicConn     quic.Connection
 	quicConnLock sync.RWMutex
+	connToken    string // 当前连接使用的鉴权凭证（连接票据或 token）
+
+	// 节点地址解析（每次重连重新解析，见 resolve.go）
+	resolver Resolver
+	target   dialTarget
 
 	// 生命周期控制
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// 节点地址与用户 token（string，运行中可更换，见 SetServer / SetToken）
+	serverAddr atomic.Value
+	token      atomic.Value
+
 	// 配置
-	serverAddr  string
-	token       string
-	localPort   int
-	mode        string // "smart" 或 "global"
-	proxyRouter *router.Router
+	localPort     int
+	listenHost    string // SOCKS5 监听地址（默认 127.0.0.1，网关模式见 SetListenHost）
+	advertiseAddr string // UDP ASSOCIATE 回复中告知应用的地址（为空时自动，见 SetAdvertiseAddr）
+	proxyRouter   *router.Router
+	ticketURL     string      // 连接票据接口地址（为空时直接使用 token）
+	stickyNode    bool        // 申请票据时把账户固定到该节点（粘性选路）
+	statusURL     string      // 账户状态接口地址（为空时不轮询）
+	psk           string      // 预共享密钥（为空表示不启用）
+	trusted       bool        // 信任模式：流上不发送鉴权行（见 SetTrusted）
+	killSwitch    atomic.Bool // 隧道不可用时拒绝应走代理的连接（运行中可切换）
+
+	mode atomic.Value // 代理模式（string，"smart" 或 "global"，运行中可切换，见 SetMode）
+
+	hosts           atomic.Pointer[router.Hosts] // hosts 覆盖表（运行中可替换）
+	unmatchedPolicy atomic.Value                 // 智能模式下未命中规则的处理方式（string，见 SetUnmatchedPolicy）
+
+	udpOverStream atomic.Bool  // UDP 关联强制使用 Stream 传输（运行中可切换）
+	compression   atomic.Bool  // TCP 流压缩（运行中可切换）
+	preferFamily  atomic.Value // 域名目标的地址族偏好（string，见 SetPreferFamily）
+
+	connectTimeout atomic.Int64 // 等待服务端连接结果的时长（纳秒，0 表示默认，见 SetConnectTimeout）
+	idleTimeout    atomic.Int64 // QUIC 连接的空闲超时（纳秒，0 表示默认，见 SetIdleTimeout）
+	handshakeTime  atomic.Int64 // 最近一次建立 QUIC 连接的耗时（纳秒，0 表示尚未连接成功，见 HandshakeTime）
+
+	maxUDPPayload       atomic.Int64 // UDP 单包载荷上限（0 表示只受传输方式限制）
+	udpOversizeFallback atomic.Bool  // 超出 Datagram 上限时切换为 Stream 传输（否则丢弃）
+
+	udpMetrics  atomic.Bool     // UDP 会话统计开关（见 SetUDPMetrics）
+	udpSessions udpSessionTable // UDP 会话统计
+
+	activity activityLog // 最近活动（见 SetActivityLog）
+
+	nodeFailures nodeFailureTable // 各节点最近的连接失败（见 NodeFailures）
+
+	// 本地 DNS 服务（见 dnsserver.go）
+	dnsServer   atomic.Pointer[DNSServerConfig] // 为空表示不监听（见 SetDNSServer）
+	dnsCache    dnsCache
+	dnsCounters dnsCounters
+	fakeIP      atomic.Bool // 走代理的域名回复假 IP（tun 包模式，见 SetFakeIP）
+	fakeIPs     fakeIPPool
+
+	flowWindows atomic.Pointer[window.Config]  // QUIC 接收窗口（为空时使用 window.Default，见 SetFlowWindows）
+	warmup      atomic.Pointer[WarmupConfig]   // 建立连接后的预热请求（为空表示关闭，见 SetWarmup）
+	priority    atomic.Pointer[streamPriority] // 隧道内的流优先级（为空表示关闭，见 SetStreamPriority）
+
+	// 服务端能力（每条 QUIC 连接协商一次）
+	capsMu   sync.Mutex
+	capsConn quic.Connection
+	caps     byte
+
+	// 签名握手（票据绑定账户钱包公钥，握手时附带钱包签名）
+	signedAuth bool               // 是否启用签名握手
+	walletKey  ed25519.PrivateKey // 本地钱包私钥（优先使用）
+	signURL    string             // 托管签名接口地址（没有匹配的本地私钥时使用）
+
+	// 诊断抓取
+	qlogOpen  atomic.Pointer[func(odcid string) io.WriteCloser] // 为新建的 QUIC 连接记录 qlog（见 SetQlog）
+	rulesFile atomic.Value                                      // 当前加载的规则文件（string，Start 中设置，诊断时并发读取，见 loadedRulesFile）
+	rulesText string                                            // 内存中的规则文本（见 SetRules，设置后不读取规则文件）
+
+	// 远程规则列表（见 SetRulesURL）
+	rulesURL     string
+	rulesRefresh time.Duration
+	rulesCache   string
+	remoteRules  atomic.Pointer[rulesVersion] // 当前生效的远程规则（为空时使用本地规则文件）
+
+	// 在 VPN 内运行时把 QUIC socket 排除在 VPN 之外（见 SetSocketProtector）
+	socketProtector atomic.Pointer[func(fd int) error]
+	udpBuffers      atomic.Pointer[sockbuf.Config] // 连接节点的 UDP socket 缓冲区（为空时保持系统默认，见 SetUDPBuffers）
+
+	// 通知回调（账户状态轮询取回的通知）
+	onNotification func(Notification)
+
+	// 连接生命周期事件（见 events.go）
+	onEvent      atomic.Pointer[func(Event)]
+	events       chan Event  // 待投递的事件
+	eventsOnce   sync.Once   // 首次设置回调时启动投递 goroutine
+	lastConnAddr string      // 上一次连接成功的地址（持有 quicConnLock 时读写）
+	authRejected atomic.Bool // 最近一次鉴权被拒（auth_failed 只在首次被拒时触发）
 
 	// SOCKS5 监听器
 	listener     net.Listener
@@ -40,6 +141,60 @@ type Client struct {
 
 	// 缓冲池
 	bufPool sync.Pool
+
+	// 分流统计
+	proxyCount   atomic.Uint64
+	directCount  atomic.Uint64
+	blockedCount atomic.Uint64 // 被 kill switch 拒绝的连接数
+
+	unmatchedBlocked atomic.Uint64 // 未命中规则被策略拒绝的连接数
+
+	// 压缩统计
+	compressedRaw  atomic.Uint64
+	compressedWire atomic.Uint64
+
+	udpOversizeDropped atomic.Uint64 // 超出上限被丢弃的 UDP 包数
+	udpUnreachable     atomic.Uint64 // 收到的 UDP 目标不可达信令数
+
+	// 预热统计（不计入转发统计）
+	warmupRequests atomic.Uint64
+	warmupBytes    atomic.Uint64
+	warmupFailures atomic.Uint64
+
+	penalties penaltyTable // 连接失败的目标的冷却（见 penalty.go）
+}
+
+// Stats 客户端运行统计
+type Stats struct {
+	Mode     string           `json:"mode"`
+	Proxy    uint64           `json:"proxy"`     // 走代理的 TCP 连接数
+	Direct   uint64           `json:"direct"`    // 直连的 TCP 连接数
+	Blocked  uint64           `json:"blocked"`   // 隧道不可用时被 kill switch 拒绝的连接数
+	TopRules []router.RuleHit `json:"top_rules"` // 命中次数最多的规则
+
+	RuleCount    int    `json:"rule_count"`              // 当前生效的规则数
+	RulesVersion string `json:"rules_version,omitempty"` // 当前生效的规则版本（见 router.Router.Version），规则相同的客户端一致
+
+	UnmatchedBlocked uint64 `json:"unmatched_blocked"` // 智能模式下未命中规则、按 block 策略拒绝的连接数
+
+	CompressedRaw  uint64 `json:"compressed_raw"`  // 压缩流的原始字节数（上下行合计）
+	CompressedWire uint64 `json:"compressed_wire"` // 压缩流实际传输的字节数（含帧头）
+
+	UDPOversizeDropped uint64 `json:"udp_oversize_dropped"` // 超出载荷上限被丢弃的 UDP 包数
+	MaxUDPPayload      int    `json:"max_udp_payload"`      // 当前生效的 UDP 单包载荷上限（IPv4 目标，见 MaxUDPPayload）
+	UDPUnreachable     uint64 `json:"udp_unreachable"`      // 节点转告的 UDP 目标不可达次数（节点开启 -udp-unreachable 时）
+
+	UDPSessions []UDPSessionStats `json:"udp_sessions,omitempty"` // UDP 会话的包间隔、抖动与疑似重复包（开启 SetUDPMetrics 后）
+
+	FailingTargets []TargetPenalty `json:"failing_targets,omitempty"` // 最近拒绝连接或不可达、处于冷却中的目标
+
+	NodeFailures []NodeFailure `json:"node_failures,omitempty"` // 最近连接失败、尚未恢复的节点（握手失败或鉴权被拒的原因）
+
+	DNS *DNSStats `json:"dns,omitempty"` // 本地 DNS 服务（开启 SetDNSServer 或 SetFakeIP 后）
+
+	Warmup *WarmupStats `json:"warmup,omitempty"` // 建立连接后的预热请求（开启 SetWarmup 后）
+
+	Priority *prio.Stats `json:"priority,omitempty"` // 流优先级的降级与让路统计（开启 SetStreamPriority 后）
 }
 
 // NewClient 创建新的客户端实例
@@ -47,37 +202,70 @@ func NewClient(serverAddr, token string, localPort int, mode string) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	client := &Client{
-		serverAddr: serverAddr,
-		token:      token,
 		localPort:  localPort,
-		mode:       mode,
+		listenHost: DefaultListenHost,
 		ctx:        ctx,
 		cancel:     cancel,
+		events:     make(chan Event, eventQueueSize),
 		bufPool: sync.Pool{
 			New: func() interface{} {
 				return make([]byte, 32*1024) // 32KB
 			},
 		},
+		// 规则在 Start 中加载；路由器在此创建，Start 之前与加载期间的分流查询（如 TestRoute）按空规则处理
+		proxyRouter: router.NewRouter(),
 	}
+	client.serverAddr.Store(serverAddr)
+	client.token.Store(token)
+	client.mode.Store(mode)
 
 	return client
 }
 
-// copyBuffer 使用缓冲池进行数据复制
+// LocalPort 本地 SOCKS5 监听端口
+func (c *Client) LocalPort() int {
+	return c.localPort
+}
+
+// SetPSK 设置预共享密钥（需与服务端 -psk 一致，需在 Start 之前设置）
+// 启用后鉴权行以 PSK 证明开头，PSK 不匹配时服务端即使 token 有效也会进入伪装模式
+func (c *Client) SetPSK(key string) {
+	c.psk = key
+}
+
+// SetKillSwitch 开启/关闭 kill switch（可在运行中切换）
+// 开启后隧道断开或重连期间，应走代理的连接会被直接拒绝（SOCKS5 REP=0x02），保证不会从本机出口泄露真实 IP
+// 智能模式下按规则直连的目标不受影响
+func (c *Client) SetKillSwitch(enabled bool) {
+	c.killSwitch.Store(enabled)
+}
+
+// copyBuffer 使用缓冲池进行数据复制（缓冲区在复制结束前归调用的协程独占，结束时归还一次）
 func (c *Client) copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
 	buf := c.bufPool.Get().([]byte)
 	defer c.bufPool.Put(buf)
 	return io.CopyBuffer(dst, src, buf)
 }
 
+// relay 双向转发：上行（clientConn -> up）在后台协程中复制，下行（remote -> down）在当前协程中复制
+// 下行结束后打断上行并等待上行协程退出才返回（见 relay.Stop），上行的字节也在 endActivity 之前统计完
+func (c *Client) relay(clientConn, remote net.Conn, up, down io.Writer) {
+	upDone := make(chan struct{})
+	go func() {
+		defer close(upDone)
+		c.copyBuffer(up, clientConn)
+	}()
+	c.copyBuffer(down, remote)
+	relay.Stop(func() { <-upDone }, clientConn, remote)
+}
+
 // Start 启动客户端
+// whitelistFile 为本地规则文件（设置了 SetRules 时不读取）
 func (c *Client) Start(whitelistFile string) error {
-	// 1. 初始化路由
-	c.proxyRouter = router.NewRouter()
-	if err := c.proxyRouter.LoadRules(whitelistFile); err != nil {
-		log.Printf("⚠️ 路由规则加载失败: %v (默认空规则)", err)
-	} else {
-		log.Printf("✅ 路由器加载成功，规则数: %d", c.proxyRouter.GetRuleCount())
+	// 1. 加载路由规则
+	c.loadLocalRules(whitelistFile)
+	if c.rulesURL != "" {
+		c.startRemoteRules()
 	}
 
 	// 2. 初始化 QUIC 连接
@@ -85,21 +273,32 @@ func (c *Client) Start(whitelistFile string) error {
 		log.Printf("⚠️ 初始化连接失败 (后台重试): %v", err)
 	}
 	go c.monitorConnection()
+	if c.statusURL != "" {
+		go c.statusPollLoop()
+	}
 
 	// 3. 启动 SOCKS5 监听
-	socksAddr := fmt.Sprintf("127.0.0.1:%d", c.localPort)
+	socksAddr := net.JoinHostPort(c.listenHost, strconv.Itoa(c.localPort))
 	listener, err := net.Listen("tcp", socksAddr)
 	if err != nil {
 		return fmt.Errorf("SOCKS5 启动失败: %w", err)
 	}
+	if !net.ParseIP(c.listenHost).IsLoopback() {
+		log.Printf("⚠️ 网关模式：SOCKS5 代理对 %s 开放且不需要认证，请确认只有可信设备能访问该地址", c.listenHost)
+	}
 
 	c.listenerLock.Lock()
 	c.listener = listener
 	c.listenerLock.Unlock()
 
+	if err := c.startDNSServer(); err != nil {
+		listener.Close()
+		return err
+	}
+
 	log.Printf("🚀 SOCKS5 代理已就绪: %s", socksAddr)
-	log.Printf("🔗 目标服务器: %s", c.serverAddr)
-	log.Printf("当前运行模式: %s", c.mode)
+	log.Printf("🔗 目标服务器: %s", c.ServerAddr())
+	log.Printf("当前运行模式: %s", c.Mode())
 
 	// 4. 主循环：处理 SOCKS5 连接
 	// 使用 goroutine + channel 模式，以便能够响应 ctx.Done()
@@ -166,6 +365,44 @@ func (c *Client) Stop() {
 	log.Println("✅ 客户端已停止")
 }
 
+// GetStats 获取分流统计
+// topN: 返回命中次数最多的前 N 条规则（<= 0 表示全部）
+func (c *Client) GetStats(topN int) Stats {
+	stats := Stats{
+		Mode:    c.Mode(),
+		Proxy:   c.proxyCount.Load(),
+		Direct:  c.directCount.Load(),
+		Blocked: c.blockedCount.Load(),
+
+		UnmatchedBlocked: c.unmatchedBlocked.Load(),
+
+		CompressedRaw:  c.compressedRaw.Load(),
+		CompressedWire: c.compressedWire.Load(),
+
+		UDPOversizeDropped: c.udpOversizeDropped.Load(),
+		MaxUDPPayload:      c.MaxUDPPayload(),
+		UDPUnreachable:     c.udpUnreachable.Load(),
+
+		UDPSessions: c.udpSessionStats(),
+
+		FailingTargets: c.penalties.snapshot("", time.Now()),
+
+		NodeFailures: c.NodeFailures(),
+
+		DNS: c.dnsStats(),
+
+		Warmup: c.warmupStats(),
+
+		Priority: c.priorityStats(),
+	}
+	if c.proxyRouter != nil {
+		stats.TopRules = c.proxyRouter.TopRules(topN)
+		stats.RuleCount = c.proxyRouter.GetRuleCount()
+		stats.RulesVersion = c.proxyRouter.Version()
+	}
+	return stats
+}
+
 // ensureQuicConnection 确保连接可用
 func (c *Client) ensureQuicConnection() error {
 	c.quicConnLock.Lock()
@@ -184,39 +421,73 @@ func (c *Client) ensureQuicConnection() error {
 
 // reconnectQuic 建立连接 (核心)
 func (c *Client) reconnectQuic() error {
-	log.Printf("正在连接服务端: %s ...", c.serverAddr)
+	// 每次重连都重新解析节点域名，多条记录同时参与拨号竞速
+	addrs, err := c.dialCandidates()
+	if err != nil {
+		c.nodeFailed(err)
+		return err
+	}
+	if server := c.ServerAddr(); len(addrs) == 1 && addrs[0] == server {
+		log.Printf("正在连接服务端: %s ...", server)
+	} else {
+		log.Printf("正在连接服务端: %s (%s) ...", server, strings.Join(addrs, ", "))
+	}
 
 	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,            // 🔒 开启真证书验证
-		NextProtos:         []string{"h3"},   // 伪装 HTTP/3
-		ServerName:         "uaptest.org",    // 显式指定域名
-		MinVersion:         tls.VersionTLS13, // 强制 TLS 1.3
+		InsecureSkipVerify: false,              // 🔒 开启真证书验证
+		NextProtos:         []string{c.alpn()}, // 伪装 HTTP/3（信任模式见 SetTrusted）
+		ServerName:         ServerName,         // 显式指定域名
+		MinVersion:         tls.VersionTLS13,   // 强制 TLS 1.3
 	}
 
+	idle := c.IdleTimeout()
 	quicConfig := &quic.Config{
 		EnableDatagrams: true,
-		MaxIdleTimeout:  time.Hour * 24 * 365,
-		KeepAlivePeriod: 10 * time.Second,
+		// 0. 空闲超时：路径中断后 QUIC 自身及时判定断开，monitorConnection 据此重连（见 SetIdleTimeout）
+		MaxIdleTimeout:  idle,
+		KeepAlivePeriod: KeepAlivePeriod(idle),
 		// 1. 恢复 MTU 探测 (iperf 证明大包能过，开启它能提速)
 		DisablePathMTUDiscovery: false,
 		// 2. 并发流适中 (既不拥堵也不受限)
 		MaxIncomingStreams:    5000,
 		MaxIncomingUniStreams: 5000,
-		// 3. 黄金窗口参数 (Sweet Spot)
-		// 针对跨国高延迟 + 轻微丢包环境的最优解
-		InitialStreamReceiveWindow:     1024 * 1024 * 2,  // 2MB 起步
-		MaxStreamReceiveWindow:         1024 * 1024 * 6,  // 单流最大 6MB (足够跑满 100M+)
-		InitialConnectionReceiveWindow: 1024 * 1024 * 6,  // 连接起步 6MB
-		MaxConnectionReceiveWindow:     1024 * 1024 * 15, // 连接最大 15MB
+		// 3. 诊断抓取期间记录 qlog
+		Tracer: c.qlogTracer(),
+	}
+	// 4. 接收窗口（默认为黄金窗口参数，见 SetFlowWindows）
+	c.FlowWindows().Apply(quicConfig)
+
+	// 拨号前准备鉴权凭证（短期连接票据），信任模式不需要
+	if !c.trusted {
+		c.refreshConnToken()
 	}
 
-	conn, err := quic.DialAddr(c.ctx, c.serverAddr, tlsConfig, quicConfig)
+	dialStart := time.Now()
+	addr, conn, err := c.raceDial(addrs, tlsConfig, quicConfig)
+	c.dialFinished(addrs, addr, err)
 	if err != nil {
+		c.nodeFailed(err)
+		if trustedMismatch(err) {
+			return fmt.Errorf("%w（客户端与节点的信任模式不一致，两端需同时开启或关闭 -trusted）", err)
+		}
 		return err
 	}
 
 	c.quicConn = conn
-	log.Printf("✅ QUIC 隧道建立成功")
+	c.handshakeTime.Store(int64(time.Since(dialStart)))
+	if c.trusted {
+		c.nodeFailures.clear(c.ServerAddr()) // 信任模式不鉴权，握手成功即恢复
+	}
+	if len(addrs) > 1 {
+		log.Printf("✅ QUIC 隧道建立成功 (%s)", addr)
+	} else {
+		log.Printf("✅ QUIC 隧道建立成功")
+	}
+	c.connectedEvent(conn)
+	// 提前协商能力：同时在新连接上完成一次鉴权，节点据此确定 Datagram 上的 UDP 流量所属的用户（出口端口租约按用户认领）
+	go c.serverCaps(conn)
+	c.startWarmup(conn)
+	go c.watchGoAway(conn)
 	return nil
 }
 
@@ -225,6 +496,9 @@ func (c *Client) monitorConnection() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	attempt := 0      // 本轮断线后的重连次数（重连成功后清零）
+	var lastErr error // 上一次重连失败的原因
+
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -237,13 +511,22 @@ func (c *Client) monitorConnection() {
 			}
 			c.quicConnLock.RUnlock()
 
-			if needsReconnect {
+			// 退避期间跳过（节点地址解析结果变化时立即重连）
+			if needsReconnect && c.reconnectDue() {
 				c.quicConnLock.Lock()
 				// 双重检查 (Double-Checked Locking)
 				if c.quicConn == nil || c.quicConn.Context().Err() != nil {
 					log.Println("🔄 连接断开，正在重连...")
-					if err := c.reconnectQuic(); err != nil {
-						log.Printf("❌ 重连失败: %v", err)
+					attempt++
+					e := Event{Kind: EventReconnecting, Attempt: attempt}
+					if lastErr != nil {
+						e.Error = lastErr.Error()
+					}
+					c.emitEvent(e)
+					if lastErr = c.reconnectQuic(); lastErr != nil {
+						log.Printf("❌ 重连失败: %v", lastErr)
+					} else {
+						attempt = 0
 					}
 				}
 				c.quicConnLock.Unlock()
@@ -252,6 +535,12 @@ func (c *Client) monitorConnection() {
 	}
 }
 
+// tunnelUp 当前是否有可用的 QUIC 隧道
+func (c *Client) tunnelUp() bool {
+	conn := c.getQuicConnection()
+	return conn != nil && conn.Context().Err() == nil
+}
+
 // getQuicConnection 获取 QUIC 连接
 func (c *Client) getQuicConnection() quic.Connection {
 	c.quicConnLock.RLock()
@@ -259,23 +548,32 @@ func (c *Client) getQuicConnection() quic.Connection {
 	return c.quicConn
 }
 
+// socksHandshakeTimeout SOCKS5 握手须在此时间内完成（避免只发半个握手的连接长期占用 goroutine）
+var socksHandshakeTimeout = 10 * time.Second
+
+// socksHandshakeBudget SOCKS5 握手读取的字节数上限（最长的合法握手：2 + 255 个方法 + 4 + 1 + 255 字节域名 + 2）
+const socksHandshakeBudget = 2 + 255 + 4 + 1 + 255 + 2
+
 // handleSOCKS5Client 处理 SOCKS5 握手
 func (c *Client) handleSOCKS5Client(clientConn net.Conn) {
 	defer clientConn.Close()
 
+	clientConn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	hs := io.LimitReader(clientConn, socksHandshakeBudget)
+
 	// 协商版本
 	buf := make([]byte, 2)
-	if _, err := io.ReadFull(clientConn, buf); err != nil {
+	if _, err := io.ReadFull(hs, buf); err != nil {
 		return
 	}
-	if buf[0] != 0x05 {
+	if buf[0] != 0x05 || buf[1] == 0 {
 		return
 	}
 
 	// 读取方法
 	numMethods := int(buf[1])
 	methods := make([]byte, numMethods)
-	if _, err := io.ReadFull(clientConn, methods); err != nil {
+	if _, err := io.ReadFull(hs, methods); err != nil {
 		return
 	}
 
@@ -284,52 +582,73 @@ func (c *Client) handleSOCKS5Client(clientConn net.Conn) {
 
 	// 读取请求
 	head := make([]byte, 4)
-	if _, err := io.ReadFull(clientConn, head); err != nil {
+	if _, err := io.ReadFull(hs, head); err != nil {
+		return
+	}
+	if head[1] != 0x01 && head[1] != 0x03 {
+		clientConn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	targetAddr, err := c.parseAddress(hs, head[3])
+	if err != nil {
+		if errors.Is(err, target.ErrBadAddress) {
+			log.Printf("⚠️ SOCKS5 请求地址无效: %v", err)
+			clientConn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0}) // 0x08: 地址类型不支持
+		}
 		return
 	}
+	clientConn.SetDeadline(time.Time{})
 
 	switch head[1] {
 	case 0x01: // CONNECT
-		c.handleTCPConnect(clientConn, head[3])
+		c.handleTCPConnect(clientConn, targetAddr)
 	case 0x03: // UDP ASSOCIATE
-		c.handleUDPAssociate(clientConn, head[3])
-	default:
-		clientConn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		c.handleUDPAssociate(clientConn)
 	}
 }
 
-// parseAddress 读取目标地址
-func (c *Client) parseAddress(conn net.Conn, addrType byte) (string, error) {
+// parseAddress 读取目标地址；域名为空或含空白、控制字符时返回 target.ErrBadAddress
+func (c *Client) parseAddress(r io.Reader, addrType byte) (string, error) {
 	var host string
 	switch addrType {
 	case 0x01: // IPv4
 		ip := make([]byte, 4)
-		if _, err := io.ReadFull(conn, ip); err != nil {
+		if _, err := io.ReadFull(r, ip); err != nil {
 			return "", err
 		}
 		host = net.IP(ip).String()
 	case 0x03: // Domain
 		lenBuf := make([]byte, 1)
-		if _, err := io.ReadFull(conn, lenBuf); err != nil {
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
 			return "", err
 		}
+		if lenBuf[0] == 0 {
+			return "", fmt.Errorf("%w: 域名为空", target.ErrBadAddress)
+		}
 		domain := make([]byte, int(lenBuf[0]))
-		if _, err := io.ReadFull(conn, domain); err != nil {
+		if _, err := io.ReadFull(r, domain); err != nil {
 			return "", err
 		}
-		host = string(domain)
+		// 部分应用把 IP 字面量（可能带方括号）按域名类型发送，统一为标准写法
+		host = normalizeHost(string(domain))
+		// 带 zone 的 IPv6 地址只能直连（见 hasZone），不按域名校验
+		if !hasZone(host) {
+			if err := target.CheckHost(host); err != nil {
+				return "", err
+			}
+		}
 	case 0x04: // IPv6
 		ip := make([]byte, 16)
-		if _, err := io.ReadFull(conn, ip); err != nil {
+		if _, err := io.ReadFull(r, ip); err != nil {
 			return "", err
 		}
 		host = net.IP(ip).String()
 	default:
-		return "", fmt.Errorf("unknown address type")
+		return "", fmt.Errorf("%w: 未知地址类型 0x%02x", target.ErrBadAddress, addrType)
 	}
 
 	portBuf := make([]byte, 2)
-	if _, err := io.ReadFull(conn, portBuf); err != nil {
+	if _, err := io.ReadFull(r, portBuf); err != nil {
 		return "", err
 	}
 	port := binary.BigEndian.Uint16(portBuf)
@@ -338,84 +657,152 @@ func (c *Client) parseAddress(conn net.Conn, addrType byte) (string, error) {
 }
 
 // handleTCPConnect 处理 TCP 转发
-func (c *Client) handleTCPConnect(clientConn net.Conn, addrType byte) {
-	targetAddr, err := c.parseAddress(clientConn, addrType)
-	if err != nil {
-		return
-	}
-
+func (c *Client) handleTCPConnect(clientConn net.Conn, targetAddr string) {
+	// 本地 DNS 服务分配的假 IP 还原为域名，按域名分流（见 fakeip.go）
+	targetAddr = c.realTarget(targetAddr)
 	host, _, _ := net.SplitHostPort(targetAddr)
 
-	// 分流判断
-	shouldProxy := false
-	if c.mode == "global" {
-		// 全局模式：强制走代理 (除非是 localhost)
-		if host != "localhost" && host != "127.0.0.1" && host != "::1" {
-			shouldProxy = true
-		}
-	} else if c.proxyRouter != nil {
-		// 智能模式：查白名单
-		shouldProxy = c.proxyRouter.ShouldProxy(host)
+	// hosts 覆盖：分流仍按原域名判断，拨号（隧道内或直连）使用覆盖 IP
+	targetAddr, override := c.applyHosts(targetAddr)
+	label := host
+	if override != "" {
+		label = override
 	}
 
-	if shouldProxy {
-		log.Printf("[分流] 🚀 代理: %s", host)
-		c.proxyTCP(clientConn, targetAddr)
-	} else {
-		log.Printf("[分流] 🏠 直连: %s", host)
-		c.directTCP(clientConn, targetAddr)
+	// 分流判断（与 TestRoute 共用，见 route.go）
+	d := c.route(host, true)
+	rec := c.startActivity(targetAddr, d)
+	defer c.endActivity(rec)
+	switch {
+	case d.Reason == RouteReasonKillSwitch:
+		// Kill switch：隧道不可用时直接拒绝，不尝试任何其他出口
+		c.blockedCount.Add(1)
+		log.Printf("[分流] ⛔ 隧道不可用，kill switch 拒绝: %s", label)
+		clientConn.Write([]byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0}) // 0x02: 规则不允许
+	case d.Action == RouteBlock:
+		c.unmatchedBlocked.Add(1)
+		log.Printf("[分流] 🚫 未命中规则，按策略拒绝: %s", label)
+		clientConn.Write([]byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0}) // 0x02: 规则不允许
+	case d.Action == RouteProxy:
+		c.proxyCount.Add(1)
+		if d.Tag != "" {
+			log.Printf("[分流] 🚀 代理: %s (%s)", label, d.Tag)
+		} else {
+			log.Printf("[分流] 🚀 代理: %s", label)
+		}
+		c.proxyTCP(clientConn, targetAddr, tagFlags(d.Tag), rec)
+	default:
+		c.directCount.Add(1)
+		log.Printf("[分流] 🏠 直连: %s", label)
+		c.directTCP(clientConn, targetAddr, rec)
 	}
 }
 
-// proxyTCP 走 QUIC 隧道
-func (c *Client) proxyTCP(clientConn net.Conn, target string) {
-	conn := c.getQuicConnection()
-	if conn == nil {
-		clientConn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+// proxyTCP 走 QUIC 隧道，flags 为规则标签对应的流量类型标志；rec 不为空时统计转发的字节数
+func (c *Client) proxyTCP(clientConn net.Conn, target string, flags target.Flags, rec *activityRecord) {
+	flags = c.bulkPortFlags(target, flags)
+	tunnelConn, err := c.dialTCP(c.ctx, target, flags)
+	if err != nil {
+		rep := byte(0x01) // 开流 / 鉴权失败
+		var te *targetError
+		switch {
+		case errors.Is(err, ErrAuthRejected):
+			log.Printf("⛔ 鉴权被拒")
+		case errors.As(err, &te):
+			rep = te.socksRep() // 冷却中的目标回复与上次失败相同的回复码
+		case errors.Is(err, ErrNoTunnel):
+			rep = 0x04
+		case errors.Is(err, ErrConnectTimeout):
+			rep = 0x04
+			log.Printf("⏱️ %v", err)
+		}
+		clientConn.Write([]byte{0x05, rep, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		return
 	}
+	defer tunnelConn.Close()
 
-	stream, err := conn.OpenStreamSync(c.ctx)
-	if err != nil {
-		clientConn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
-		return
+	clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+
+	// 上行按流优先级写入隧道（见 priority.go）
+	c.relay(clientConn, tunnelConn, rec.writer(c.priorityWriter(tunnelConn, flags)), rec.writer(clientConn))
+}
+
+// openStream 打开一个新的 QUIC 流
+// 先尝试非阻塞的 OpenStream，若触达流数量上限则在 streamOpenTimeout 内排队等待，超时返回错误
+func (c *Client) openStream(conn quic.Connection) (quic.Stream, error) {
+	stream, err := conn.OpenStream()
+	if err == nil {
+		return stream, nil
 	}
-	defer stream.Close()
-	defer stream.CancelRead(0) // 立即释放读取相关资源，防止流变成僵尸
 
-	// 1. 鉴权
-	if _, err := stream.Write([]byte(c.token + "\n")); err != nil {
-		return
+	// 非流上限导致的错误（如连接已断开），直接返回
+	if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+		return nil, err
 	}
 
-	// 2. 验证
-	status := make([]byte, 1)
-	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
-		log.Printf("⛔ 鉴权被拒")
-		return
+	log.Printf("⚠️ 并发流已达上限，排队等待空闲流 (最长 %v)", streamOpenTimeout)
+	ctx, cancel := context.WithTimeout(c.ctx, streamOpenTimeout)
+	defer cancel()
+
+	stream, err = conn.OpenStreamSync(ctx)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("❌ 等待空闲流超时: 流数量压力过大，请考虑提高 MaxIncomingStreams 或增加连接")
+		}
+		return nil, err
 	}
+	return stream, nil
+}
 
-	// 3. 发送目标
-	addrBytes := []byte(target)
-	stream.Write([]byte{byte(len(addrBytes))})
-	stream.Write(addrBytes)
+// ErrAuthRejected 服务端拒绝了鉴权凭证（token / 连接票据无效或 PSK 不匹配，服务端进入伪装模式）
+var ErrAuthRejected = errors.New("鉴权被拒")
 
-	// 4. 等待连接
-	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
-		clientConn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
-		return
+// openAuthedStream 打开一个新流并完成鉴权
+func (c *Client) openAuthedStream(conn quic.Connection) (quic.Stream, error) {
+	stream, err := c.openStream(conn)
+	if err != nil {
+		return nil, err
 	}
+	if err := c.authenticate(stream); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
 
-	// 5. 成功
-	clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+// authenticate 在流上完成鉴权（发送 [PSK 证明 +] token + 换行，等待 0x00；信任模式不鉴权）
+// 服务端拒绝时不会回复 0x00，而是延迟 2-5 秒后返回伪装的 HTML
+func (c *Client) authenticate(stream quic.Stream) error {
+	if c.trusted {
+		return nil // 信任模式：节点不读取鉴权行，流上直接是地址帧
+	}
+	authLine := c.authToken()
+	if c.psk != "" {
+		authLine = psk.Seal(c.psk, authLine)
+	}
+	if _, err := stream.Write([]byte(authLine + "\n")); err != nil {
+		return err
+	}
 
-	// 6. 转发
-	go func() { c.copyBuffer(stream, clientConn) }()
-	c.copyBuffer(clientConn, stream)
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		if err == io.EOF {
+			c.authResult(ErrAuthRejected)
+			return ErrAuthRejected // 服务端未接受就关闭了流
+		}
+		return err
+	}
+	if status[0] != 0x00 {
+		c.authResult(ErrAuthRejected)
+		return ErrAuthRejected
+	}
+	c.authResult(nil)
+	return nil
 }
 
-// directTCP 直连
-func (c *Client) directTCP(clientConn net.Conn, target string) {
+// directTCP 直连；rec 不为空时统计转发的字节数
+func (c *Client) directTCP(clientConn net.Conn, target string, rec *activityRecord) {
 	targetConn, err := net.DialTimeout("tcp", target, 5*time.Second)
 	if err != nil {
 		clientConn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
@@ -425,30 +812,72 @@ func (c *Client) directTCP(clientConn net.Conn, target string) {
 
 	clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 
-	go func() { c.copyBuffer(targetConn, clientConn) }()
-	c.copyBuffer(clientConn, targetConn)
+	c.relay(clientConn, targetConn, rec.writer(targetConn), rec.writer(clientConn))
 }
 
-// handleUDPAssociate 处理 UDP 转发
-func (c *Client) handleUDPAssociate(clientConn net.Conn, addrType byte) {
-	c.parseAddress(clientConn, addrType) // 读掉头部
+// udpRebindTimeout UDP 关联等待隧道重连的最长时间（monitorConnection 每 5 秒检查一次）
+const udpRebindTimeout = 15 * time.Second
+
+// waitForNewConnection 等待一条不同于 old 且可用的新连接
+// 超时或 ctx 取消时返回 nil
+func (c *Client) waitForNewConnection(ctx context.Context, old quic.Connection, timeout time.Duration) quic.Connection {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-ticker.C:
+			conn := c.getQuicConnection()
+			if conn != nil && conn != old && conn.Context().Err() == nil {
+				return conn
+			}
+		}
+	}
+}
 
-	// 启动本地 UDP
-	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+// handleUDPAssociate 处理 UDP 转发（请求中的地址已由 handleSOCKS5Client 读取）
+func (c *Client) handleUDPAssociate(clientConn net.Conn) {
+	// 启动本地 UDP：监听在控制连接到达的地址上（网关模式下应用才能访问），回复中的 BND 为应用可达的地址
+	bindIP, replyHost := c.udpAssociateAddr(clientConn)
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: bindIP, Port: 0})
 	if err != nil {
+		log.Printf("[UDP] 开启 UDP 端口失败: %v", err)
+		clientConn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		return
 	}
 	defer udpConn.Close()
 
 	localPort := udpConn.LocalAddr().(*net.UDPAddr).Port
-	log.Printf("[UDP] 端口开启: %d", localPort)
+	bndAddr := net.JoinHostPort(replyHost, strconv.Itoa(localPort))
+	resp, err := appendSOCKS5Addr([]byte{0x05, 0x00, 0x00}, bndAddr)
+	if err != nil {
+		log.Printf("[UDP] 构造关联回复失败: %v", err)
+		clientConn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	log.Printf("[UDP] 端口开启: %s (BND %s)", udpConn.LocalAddr(), bndAddr)
+
+	// 关联建立时协商传输方式：Datagram 不可用或被强制时改用 Stream
+	// Stream 需在回复应用之前建好，避免应用随后立即发出的首包被丢弃
+	conn := c.getQuicConnection()
+	var stream quic.Stream
+	if conn != nil && c.useUDPStream(conn) {
+		if stream, err = c.openUDPStream(conn); err != nil {
+			log.Printf("[UDP] 建立 UDP 流失败: %v", err)
+			clientConn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+			return
+		}
+	}
 
 	// 回复 TCP
-	resp := []byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0}
-	binary.BigEndian.PutUint16(resp[8:], uint16(localPort))
 	clientConn.Write(resp)
 
-	conn := c.getQuicConnection()
 	if conn == nil {
 		return
 	}
@@ -456,13 +885,39 @@ func (c *Client) handleUDPAssociate(clientConn net.Conn, addrType byte) {
 	ctx, cancel := context.WithCancel(c.ctx)
 	defer cancel()
 
+	transport := UDPTransportDatagram
+	if stream != nil {
+		transport = UDPTransportStream
+	}
+	metrics := c.startUDPSession(localPort, "", transport)
+	defer c.endUDPSession(metrics)
+
+	if stream != nil {
+		log.Printf("[UDP] 关联 (端口 %d) 使用 Stream 传输", localPort)
+		go c.relayUDPStream(ctx, conn, stream, clientConn, udpConn, localPort, nil, metrics)
+		waitControlClose(clientConn, localPort)
+		return
+	}
+
 	var currentAddr atomic.Value
 
+	// Datagram 收发只在 dgCtx 内进行；超限包触发回退时取消 dgCtx，关联改由 Stream 传输
+	dgCtx, dgCancel := context.WithCancel(ctx)
+	defer dgCancel()
+	type oversizePacket struct {
+		data []byte
+		addr *net.UDPAddr
+	}
+	fallback := make(chan oversizePacket, 1)
+
 	// 1. Read Loop (App -> LocalUDP -> QUIC)
+	// 每个包都取当前连接发送，重连后自动走新连接
 	go func() {
-		buf := make([]byte, 2048)
+		buf := make([]byte, udpstream.MaxFrameSize) // 完整读入应用的包，超限判断才准确
+		tagger := c.newUDPTagger()
+		var logged bool
 		for {
-			if ctx.Err() != nil {
+			if dgCtx.Err() != nil {
 				return
 			}
 			udpConn.SetReadDeadline(time.Now().Add(5 * time.Second)) // 超时机制
@@ -476,34 +931,114 @@ func (c *Client) handleUDPAssociate(clientConn net.Conn, addrType byte) {
 				return
 			}
 
-			if n > 0 {
+			if n > 0 && udpFromApp(clientConn, addr) {
 				currentAddr.Store(addr)
-				conn.SendDatagram(buf[:n])
+				tagger.tag(buf[:n])
+				switch c.checkUDPPacket(buf[:n], true) {
+				case udpDrop:
+					c.dropUDPPacket(buf[:n], localPort, &logged)
+					continue
+				case udpFallback:
+					udpConn.SetReadDeadline(time.Time{})
+					fallback <- oversizePacket{data: append([]byte(nil), buf[:n]...), addr: addr}
+					return
+				}
+				if current := c.getQuicConnection(); current != nil {
+					metrics.observeUp(buf[:n])
+					current.SendDatagram(buf[:n])
+				}
 			}
 		}
 	}()
 
+	// 超限包回退：关联整体切换为 Stream 传输，先发出触发回退的包
+	go func() {
+		var pkt oversizePacket
+		select {
+		case <-ctx.Done():
+			return
+		case pkt = <-fallback:
+		}
+		dgCancel()
+		current := c.getQuicConnection()
+		if current == nil {
+			clientConn.Close()
+			return
+		}
+		stream, err := c.openUDPStream(current)
+		if err != nil {
+			log.Printf("[UDP] 超限包回退建流失败，关闭 UDP 关联 (端口 %d): %v", localPort, err)
+			clientConn.Close()
+			return
+		}
+		size := len(pkt.data)
+		if payload, ok := socks5UDPPayload(pkt.data); ok {
+			size = len(payload)
+		}
+		log.Printf("[UDP] 关联 (端口 %d) 出现载荷 %d 字节的包，超出 Datagram 上限，已切换为 Stream 传输", localPort, size)
+		metrics.setTransport(UDPTransportStream)
+		metrics.observeUp(pkt.data)
+		udpstream.WriteFrame(stream, pkt.data)
+		c.relayUDPStream(ctx, current, stream, clientConn, udpConn, localPort, pkt.addr, metrics)
+	}()
+
 	// 2. Write Loop (QUIC -> LocalUDP -> App)
+	// 连接断开时等待重连并重新绑定；重连超时则关闭控制连接，让应用重新发起 UDP 关联
 	go func() {
 		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				data, err := conn.ReceiveDatagram(ctx)
-				if err != nil {
+			data, err := conn.ReceiveDatagram(dgCtx)
+			if err != nil {
+				if dgCtx.Err() != nil {
 					return
 				}
 
-				if addr := currentAddr.Load(); addr != nil {
-					udpConn.WriteToUDP(data, addr.(*net.UDPAddr))
+				newConn := c.waitForNewConnection(dgCtx, conn, udpRebindTimeout)
+				if newConn == nil {
+					if dgCtx.Err() == nil {
+						log.Printf("[UDP] 隧道重连超时，关闭 UDP 关联 (端口 %d)，应用需重新关联", localPort)
+						clientConn.Close()
+					}
+					return
 				}
+				log.Printf("[UDP] 隧道已重连，UDP 关联 (端口 %d) 已重新绑定到新连接", localPort)
+				conn = newConn
+				continue
+			}
+
+			if c.udpUnreachableSignal(data) {
+				continue
+			}
+			metrics.observeDown(data)
+			if addr := currentAddr.Load(); addr != nil {
+				udpConn.WriteToUDP(data, addr.(*net.UDPAddr))
 			}
 		}
 	}()
 
 	// 3. TCP 保活监控
-	io.Copy(io.Discard, clientConn) // 阻塞等待 TCP 断开
+	waitControlClose(clientConn, localPort)
 	cancel()
 }
 
+// waitControlClose 阻塞等待 UDP 关联的控制连接断开（关联随之结束）
+// RFC 1928 规定关联期间控制连接不传输数据，只用来表示关联的生命周期；个别应用仍会在上面发送数据，
+// 这些数据无处可转发，读出后丢弃，但会记录日志（不静默吞掉），便于排查这类应用的异常
+func waitControlClose(clientConn net.Conn, localPort int) {
+	buf := make([]byte, 512)
+	var discarded int64
+	for {
+		n, err := clientConn.Read(buf)
+		if n > 0 {
+			if discarded == 0 {
+				log.Printf("⚠️ [UDP] 关联 (端口 %d) 的控制连接收到 %d 字节数据，SOCKS5 关联期间控制连接不传输数据，已忽略", localPort, n)
+			}
+			discarded += int64(n)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if discarded > 0 {
+		log.Printf("[UDP] 关联 (端口 %d) 结束，控制连接上共忽略 %d 字节数据", localPort, discarded)
+	}
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// testCertificate 生成包含 ServerName 的自签名证书
+func testCertificate(t testing.TB) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: ServerName},
+		DNSNames:     []string{ServerName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// testQUICPair 在本机建立一条 QUIC 连接，返回客户端与服务端两端
+func testQUICPair(t testing.TB, serverConfig *quic.Config) (quic.Connection, quic.Connection) {
+	t.Helper()
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		NextProtos:   []string{"h3"},
+	}, serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := quic.DialAddr(ctx, listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h3"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.CloseWithError(0, "") })
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.CloseWithError(0, "") })
+	return client, server
+}
+
+// setStreamOpenTimeout 测试期间替换等待空闲流的超时
+func setStreamOpenTimeout(t *testing.T, d time.Duration) {
+	old := streamOpenTimeout
+	streamOpenTimeout = d
+	t.Cleanup(func() { streamOpenTimeout = old })
+}
+
+func TestOpenStreamWaitsForFreeStream(t *testing.T) {
+	client, server := testQUICPair(t, &quic.Config{MaxIncomingStreams: 1})
+	c := NewClient("", "", 0, "global")
+	defer c.Stop()
+
+	first, err := c.openStream(client)
+	if err != nil {
+		t.Fatalf("第一个流: %v", err)
+	}
+	first.Write([]byte{0})
+
+	opened := make(chan error, 1)
+	go func() {
+		stream, err := c.openStream(client)
+		if err == nil {
+			stream.Close()
+		}
+		opened <- err
+	}()
+
+	select {
+	case err := <-opened:
+		t.Fatalf("流数量达到上限时不应立即打开新流: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 服务端读完并关闭第一个流后释放流额度，排队的 openStream 随之完成
+	peer, err := server.AcceptStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	io.Copy(io.Discard, peer)
+	peer.Close()
+	io.Copy(io.Discard, first)
+
+	select {
+	case err := <-opened:
+		if err != nil {
+			t.Fatalf("释放流额度后打开新流失败: %v", err)
+		}
+	case <-time.After(streamOpenTimeout):
+		t.Fatal("释放流额度后 openStream 仍在等待")
+	}
+}
+
+func TestOpenStreamTimeout(t *testing.T) {
+	setStreamOpenTimeout(t, 300*time.Millisecond)
+	client, _ := testQUICPair(t, &quic.Config{MaxIncomingStreams: 1})
+	c := NewClient("", "", 0, "global")
+	defer c.Stop()
+
+	if _, err := c.openStream(client); err != nil {
+		t.Fatalf("第一个流: %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.openStream(client)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("等待空闲流超时应返回 DeadlineExceeded，实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < streamOpenTimeout || elapsed > streamOpenTimeout+time.Second {
+		t.Fatalf("等待时长 %v，期望约 %v", elapsed, streamOpenTimeout)
+	}
+}
+
+func TestOpenStreamClosedConnection(t *testing.T) {
+	client, _ := testQUICPair(t, nil)
+	c := NewClient("", "", 0, "global")
+	defer c.Stop()
+
+	client.CloseWithError(0, "")
+	start := time.Now()
+	if _, err := c.openStream(client); err == nil {
+		t.Fatal("连接已关闭时 openStream 应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("连接已关闭时不应排队等待（耗时 %v）", elapsed)
+	}
+}
+
+// setQuicConnection 测试期间替换客户端当前的隧道连接
+func setQuicConnection(c *Client, conn quic.Connection) {
+	c.quicConnLock.Lock()
+	c.quicConn = conn
+	c.quicConnLock.Unlock()
+}
+
+func TestWaitForNewConnectionRebinds(t *testing.T) {
+	old, _ := testQUICPair(t, nil)
+	fresh, _ := testQUICPair(t, nil)
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	setQuicConnection(c, old)
+
+	// 旧连接断开后由重连逻辑换上新连接
+	go func() {
+		old.CloseWithError(0, "")
+		time.Sleep(300 * time.Millisecond)
+		setQuicConnection(c, fresh)
+	}()
+
+	if got := c.waitForNewConnection(context.Background(), old, 5*time.Second); got != fresh {
+		t.Fatalf("期望切换到新连接，得到 %v", got)
+	}
+}
+
+func TestWaitForNewConnectionIgnoresDeadConnection(t *testing.T) {
+	old, _ := testQUICPair(t, nil)
+	dead, _ := testQUICPair(t, nil)
+	dead.CloseWithError(0, "")
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+
+	// 仍是旧连接或已关闭的连接都不算重连成功
+	setQuicConnection(c, old)
+	if got := c.waitForNewConnection(context.Background(), old, 500*time.Millisecond); got != nil {
+		t.Fatalf("未重连时应超时返回 nil，得到 %v", got)
+	}
+	setQuicConnection(c, dead)
+	if got := c.waitForNewConnection(context.Background(), old, 500*time.Millisecond); got != nil {
+		t.Fatalf("新连接已关闭时应返回 nil，得到 %v", got)
+	}
+}
+
+func TestWaitForNewConnectionCancelled(t *testing.T) {
+	old, _ := testQUICPair(t, nil)
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	setQuicConnection(c, old)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if got := c.waitForNewConnection(ctx, old, time.Minute); got != nil {
+		t.Fatalf("取消后应返回 nil，得到 %v", got)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("取消后等待了 %v", elapsed)
+	}
+}
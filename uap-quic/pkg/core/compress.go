@@ -0,0 +1,81 @@
+package core
+
+import (
+	"io"
+	"log"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 能力位（opHello 中双方交换，与服务端一致）
+const (
+	capCompress byte = 0x01 // 支持压缩的 TCP 转发 (opTCPDeflate)
+	capTargetV1 byte = 0x02 // 支持结构化转发目标 (opTCPConnect，协议版本 1)
+	capWarmup   byte = 0x04 // 支持预热请求 (opWarmup)
+
+	capUDPUnreachable byte = 0x08 // 能识别 UDP 不可达信令（见 dial.go 的 udpReplyUnreachable）
+)
+
+// tlsPorts 常见 TLS 端口：流量已加密无法压缩，不协商压缩
+var tlsPorts = map[string]bool{"443": true, "465": true, "853": true, "993": true, "995": true, "8443": true}
+
+// SetCompression 开启/关闭 TCP 流压缩（需服务端支持，旧版服务端自动按未压缩处理）
+// 适合文本为主的流量和受限链路；会增加两端 CPU 占用，已加密/已压缩的内容会被识别并原样传输
+// 可在运行中切换，对之后新建的 TCP 连接生效
+func (c *Client) SetCompression(enabled bool) {
+	c.compression.Store(enabled)
+}
+
+// useCompression 决定新的 TCP 连接是否使用压缩转发
+func (c *Client) useCompression(conn quic.Connection, target string) bool {
+	if !c.compression.Load() {
+		return false
+	}
+	if _, port, err := net.SplitHostPort(target); err == nil && tlsPorts[port] {
+		return false
+	}
+	return c.serverCaps(conn)&capCompress != 0
+}
+
+// serverCaps 返回服务端在该连接上支持的能力（每条 QUIC 连接协商一次）
+// 旧版服务端不认识协商指令，按无扩展能力处理；网络错误时返回 0 且不缓存，下次重新协商
+func (c *Client) serverCaps(conn quic.Connection) byte {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.capsConn == conn {
+		return c.caps
+	}
+
+	stream, err := c.openAuthedStream(conn)
+	if err != nil {
+		return 0
+	}
+	defer stream.Close()
+	defer stream.CancelRead(0)
+
+	if _, err := stream.Write([]byte{0x00, opHello, capCompress | capTargetV1 | capWarmup | capUDPUnreachable}); err != nil {
+		return 0
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(stream, reply[:1]); err != nil {
+		return 0
+	}
+	var caps byte
+	if reply[0] == 0x00 {
+		if _, err := io.ReadFull(stream, reply[1:]); err != nil {
+			return 0
+		}
+		caps = reply[1]
+	}
+
+	c.capsConn, c.caps = conn, caps
+	log.Printf("🤝 服务端能力协商完成: 压缩=%v 结构化目标=%v 预热=%v UDP不可达转告=%v", caps&capCompress != 0, caps&capTargetV1 != 0, caps&capWarmup != 0, caps&capUDPUnreachable != 0)
+	return caps
+}
+
+// addCompressStats 累加压缩统计
+func (c *Client) addCompressStats(raw, wire int64) {
+	c.compressedRaw.Add(uint64(raw))
+	c.compressedWire.Add(uint64(wire))
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// connRetireTimeout 更换 token 或节点后，旧连接上进行中的流最多继续传输的时间，之后关闭旧连接
+const connRetireTimeout = 30 * time.Second
+
+// ServerAddr 当前的节点地址
+func (c *Client) ServerAddr() string {
+	addr, _ := c.serverAddr.Load().(string)
+	return addr
+}
+
+// Token 当前的用户 token（SetToken 更新后为新值）
+func (c *Client) Token() string {
+	return c.userToken()
+}
+
+// userToken 当前的用户 token
+func (c *Client) userToken() string {
+	token, _ := c.token.Load().(string)
+	return token
+}
+
+// SetToken 更新用户 token（如刷新令牌流程中轮换的 access token），运行中立即用新凭证重建 QUIC 连接
+// SOCKS5 监听、直连的连接不受影响；之后的新请求走新连接，旧连接上进行中的流最多继续 connRetireTimeout；
+// 新连接建立失败时返回错误并保留旧连接（断线后由重连守护使用新 token 重试）；未启动时只保存 token
+func (c *Client) SetToken(token string) error {
+	if token == "" {
+		return errors.New("token 不能为空")
+	}
+	c.token.Store(token)
+	return c.switchConnection("🔑 Token 已更新，使用新凭证重建连接", true)
+}
+
+// SetServer 切换节点地址 (host:port)，运行中立即连接新节点
+// SOCKS5 监听、直连的连接不受影响；之后的新请求走新节点，旧连接上进行中的流最多继续 connRetireTimeout；
+// 新节点连接失败时返回错误，旧连接同样退役，由重连守护按退避继续尝试新节点；未启动时只保存地址
+func (c *Client) SetServer(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("节点地址无效: %w", err)
+	}
+	if addr == c.ServerAddr() {
+		return nil
+	}
+
+	c.quicConnLock.Lock()
+	c.serverAddr.Store(addr)
+	// 清空旧节点的解析结果与退避，避免新节点解析失败时沿用旧节点的地址
+	c.target.mu.Lock()
+	c.target.addrs = nil
+	c.target.next = 0
+	c.target.failures = 0
+	c.target.retryAt = time.Time{}
+	c.target.mu.Unlock()
+	c.quicConnLock.Unlock()
+
+	return c.switchConnection(fmt.Sprintf("🔀 切换节点: %s", addr), false)
+}
+
+// switchConnection 运行中建立新连接替换当前连接，旧连接退役（见 retireConnection）
+// keepOnFailure 为 true 时新连接失败则继续使用旧连接；客户端未启动（没有连接）时不做任何事
+func (c *Client) switchConnection(reason string, keepOnFailure bool) error {
+	c.quicConnLock.Lock()
+	defer c.quicConnLock.Unlock()
+
+	old := c.quicConn
+	if old == nil || c.ctx.Err() != nil {
+		return nil
+	}
+	log.Println(reason)
+	if err := c.reconnectQuic(); err != nil {
+		if !keepOnFailure {
+			c.quicConn = nil
+			go c.retireConnection(old)
+		}
+		return err
+	}
+	go c.retireConnection(old)
+	return nil
+}
+
+// retireConnection 等旧连接上进行中的流继续传输 connRetireTimeout 后关闭它（客户端停止时立即关闭）
+// 旧连接关闭后，其上的 UDP 关联重新绑定到新连接
+func (c *Client) retireConnection(conn quic.Connection) {
+	timer := time.NewTimer(connRetireTimeout)
+	defer timer.Stop()
+	select {
+	case <-conn.Context().Done():
+		return
+	case <-c.ctx.Done():
+	case <-timer.C:
+	}
+	conn.CloseWithError(0, "connection replaced")
+}
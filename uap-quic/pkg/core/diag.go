@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"uap-quic/pkg/window"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/quic-go/quic-go/qlog"
+)
+
+// ConfigSnapshot 客户端当前配置（诊断包使用）：敏感值只记录是否设置，不记录内容
+type ConfigSnapshot struct {
+	Version    string `json:"version"`
+	ServerAddr string `json:"server_addr"`
+	LocalPort  int    `json:"local_port"`
+	ListenHost string `json:"listen_host"`
+	Advertise  string `json:"advertise_addr,omitempty"`
+	Mode       string `json:"mode"`
+	TunnelUp   bool   `json:"tunnel_up"`
+
+	TicketURL  string `json:"ticket_url,omitempty"`
+	StatusURL  string `json:"status_url,omitempty"`
+	SignURL    string `json:"sign_url,omitempty"`
+	StickyNode bool   `json:"sticky_node"`
+
+	TokenSet        bool `json:"token_set"`
+	PSKSet          bool `json:"psk_set"`
+	Trusted         bool `json:"trusted"`
+	SignedHandshake bool `json:"signed_handshake"`
+	WalletKeySet    bool `json:"wallet_key_set"`
+
+	KillSwitch          bool   `json:"kill_switch"`
+	Unmatched           string `json:"unmatched"`
+	UDPOverStream       bool   `json:"udp_over_stream"`
+	Compression         bool   `json:"compression"`
+	PreferFamily        string `json:"prefer_family"`
+	MaxUDPPayload       int    `json:"max_udp_payload"`
+	UDPOversizeFallback bool   `json:"udp_oversize_fallback"`
+	UDPMetrics          bool   `json:"udp_metrics"`
+	Hosts               int    `json:"hosts"` // hosts 覆盖条目数
+
+	FlowWindows window.Config `json:"flow_windows"` // QUIC 接收窗口（字节）
+	IdleTimeout string        `json:"idle_timeout"` // QUIC 连接的空闲超时
+
+	RulesFile    string `json:"rules_file,omitempty"`
+	RuleCount    int    `json:"rule_count"`
+	RulesVersion string `json:"rules_version,omitempty"` // 当前生效规则的版本（规范化规则的摘要，见 router.Router.Version）
+	RulesSHA256  string `json:"rules_sha256,omitempty"`  // 当前规则原文（规则文件、文本或远程列表）的摘要，读取失败时为空
+
+	RulesURL       string `json:"rules_url,omitempty"`
+	RulesSource    string `json:"rules_source"`               // file / inline / cache / remote
+	RulesUpdatedAt string `json:"rules_updated_at,omitempty"` // 远程规则的生效时间
+}
+
+// ConfigSnapshot 获取当前配置快照
+func (c *Client) ConfigSnapshot() ConfigSnapshot {
+	s := ConfigSnapshot{
+		Version:    Version,
+		ServerAddr: c.ServerAddr(),
+		LocalPort:  c.localPort,
+		ListenHost: c.listenHost,
+		Advertise:  c.advertiseAddr,
+		Mode:       c.Mode(),
+		TunnelUp:   c.tunnelUp(),
+
+		TicketURL:  c.ticketURL,
+		StatusURL:  c.statusURL,
+		SignURL:    c.signURL,
+		StickyNode: c.stickyNode,
+
+		TokenSet:        c.userToken() != "",
+		PSKSet:          c.psk != "",
+		Trusted:         c.trusted,
+		SignedHandshake: c.signedAuth,
+		WalletKeySet:    c.walletKey != nil,
+
+		KillSwitch:          c.killSwitch.Load(),
+		Unmatched:           c.unmatched(),
+		UDPOverStream:       c.udpOverStream.Load(),
+		Compression:         c.compression.Load(),
+		PreferFamily:        c.preferredFamily(),
+		MaxUDPPayload:       int(c.maxUDPPayload.Load()),
+		UDPOversizeFallback: c.udpOversizeFallback.Load(),
+		UDPMetrics:          c.udpMetrics.Load(),
+
+		FlowWindows: c.FlowWindows(),
+		IdleTimeout: c.IdleTimeout().String(),
+
+		RulesFile: c.loadedRulesFile(),
+	}
+	if hosts := c.hosts.Load(); hosts != nil {
+		s.Hosts = hosts.Len()
+	}
+	if c.proxyRouter != nil {
+		s.RuleCount = c.proxyRouter.GetRuleCount()
+		s.RulesVersion = c.proxyRouter.Version()
+	}
+	s.RulesURL, s.RulesSource = c.rulesURL, c.localRulesSource()
+	if v := c.remoteRules.Load(); v != nil {
+		s.RulesSource, s.RulesSHA256 = v.source, v.sha256
+		s.RulesUpdatedAt = v.updatedAt.Format(time.RFC3339)
+	} else if c.rulesText != "" {
+		s.RulesSHA256 = rulesSHA256([]byte(c.rulesText))
+	} else if data, err := os.ReadFile(s.RulesFile); err == nil && s.RulesFile != "" {
+		s.RulesSHA256 = rulesSHA256(data)
+	}
+	return s
+}
+
+// Secrets 客户端持有的敏感值（token、当前连接票据、PSK、钱包私钥），供诊断包脱敏
+func (c *Client) Secrets() []string {
+	secrets := []string{c.userToken(), c.psk}
+	c.quicConnLock.RLock()
+	secrets = append(secrets, c.connToken)
+	c.quicConnLock.RUnlock()
+	if c.walletKey != nil {
+		secrets = append(secrets, hex.EncodeToString(c.walletKey), hex.EncodeToString(c.walletKey.Seed()))
+	}
+	return secrets
+}
+
+// SetQlog 为之后建立的 QUIC 连接记录 qlog：每条连接调用一次 open 获取输出（odcid 为连接的原始目标连接 ID）
+// open 为 nil 时停止为新连接记录；已在记录的连接在输出返回写入错误后停止记录
+func (c *Client) SetQlog(open func(odcid string) io.WriteCloser) {
+	if open == nil {
+		c.qlogOpen.Store(nil)
+		return
+	}
+	c.qlogOpen.Store(&open)
+}
+
+// qlogTracer 当前的 qlog 记录（未开启时返回 nil，拨号时不记录）
+func (c *Client) qlogTracer() func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+	open := c.qlogOpen.Load()
+	if open == nil {
+		return nil
+	}
+	return func(_ context.Context, p logging.Perspective, odcid quic.ConnectionID) *logging.ConnectionTracer {
+		return qlog.NewConnectionTracer((*open)(odcid.String()), p, odcid)
+	}
+}
+
+// Reconnect 立即重建 QUIC 隧道（旧连接上进行中的 TCP / UDP 转发会中断）
+// 用于让诊断抓取包含完整的握手过程；重建失败时保留旧连接
+func (c *Client) Reconnect() error {
+	c.quicConnLock.Lock()
+	defer c.quicConnLock.Unlock()
+
+	old := c.quicConn
+	if err := c.reconnectQuic(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.CloseWithError(0, "reconnect")
+	}
+	return nil
+}
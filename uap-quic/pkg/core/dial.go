@@ -0,0 +1,382 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"uap-quic/pkg/compress"
+	"uap-quic/pkg/target"
+	"uap-quic/pkg/udpstream"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 拨号错误（可用 errors.Is 判断）
+var (
+	ErrNoTunnel          = errors.New("隧道不可用")       // 当前没有可用的 QUIC 连接
+	ErrTargetUnreachable = errors.New("服务端连接目标失败")   // 鉴权通过，但服务端无法连接目标地址（或目标处于失败冷却中）
+	ErrConnectTimeout    = errors.New("等待服务端连接结果超时") // 地址帧已发出，服务端在 SetConnectTimeout 的时间内没有回复连接结果
+
+	// ErrUDPUnreachable DialUDP 的连接读到节点转告的 ICMP 不可达（目标端口未开放或网络不可达），同时满足 errors.Is(err, syscall.ECONNREFUSED)
+	ErrUDPUnreachable = fmt.Errorf("UDP 目标不可达: %w", syscall.ECONNREFUSED)
+)
+
+// DefaultConnectTimeout 发出地址帧后等待服务端回复连接结果的默认时长
+// 服务端连接目标本身有超时，正常情况下远早于此回复；超过该时长通常是节点卡死或路径异常
+const DefaultConnectTimeout = 30 * time.Second
+
+// SetConnectTimeout 设置发出地址帧后等待服务端回复连接结果的时长，<= 0 恢复默认值 DefaultConnectTimeout
+// 超时后 SOCKS5 回复 0x04（主机不可达）并关闭连接，浏览器可立即报错或重试，而不是一直转圈；
+// 只约束等待连接结果这一步，不影响 QUIC 握手和流上的鉴权。可在运行中切换，对之后建立的连接生效
+func (c *Client) SetConnectTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	c.connectTimeout.Store(int64(d))
+}
+
+// ConnectTimeout 当前生效的连接结果等待时长
+func (c *Client) ConnectTimeout() time.Duration {
+	if d := time.Duration(c.connectTimeout.Load()); d > 0 {
+		return d
+	}
+	return DefaultConnectTimeout
+}
+
+// DialTCP 通过隧道建立到 target (host:port，IPv6 带方括号) 的 TCP 连接，供 tun 包模式等非 SOCKS5 接入使用
+// 不经过分流规则和 kill switch（由调用方决定哪些流量走隧道）；开启压缩时按 SetCompression 的规则协商
+// 带 zone 的 IPv6 地址返回 ErrZonedAddress；ctx 只控制建立连接的过程，连接建立后取消 ctx 不影响返回的连接
+func (c *Client) DialTCP(ctx context.Context, target string) (net.Conn, error) {
+	return c.dialTCP(ctx, target, 0)
+}
+
+// dialTCP 见 DialTCP；flags 为附加的转发标志（规则的流量类型标签），服务端不支持结构化目标时忽略
+func (c *Client) dialTCP(ctx context.Context, target string, flags target.Flags) (net.Conn, error) {
+	target, err := normalizeTarget(c.realTarget(target))
+	if err != nil {
+		return nil, err
+	}
+	if len(target) > 255 {
+		return nil, fmt.Errorf("目标地址长度无效: %q", target)
+	}
+	// 最近拒绝连接或不可达的目标在冷却期内直接失败，不开流（见 penalty.go）
+	if err := c.penalties.check(target, time.Now()); err != nil {
+		return nil, err
+	}
+	conn := c.getQuicConnection()
+	if conn == nil || conn.Context().Err() != nil {
+		return nil, ErrNoTunnel
+	}
+
+	stream, err := c.openAuthedStream(conn)
+	if err != nil {
+		return nil, err
+	}
+	// 建立过程中 ctx 取消时中断流上的读写
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelRead(0)
+		stream.CancelWrite(0)
+	})
+	fail := func(err error) (net.Conn, error) {
+		stop()
+		stream.CancelRead(0)
+		stream.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	// 发送目标，合并为一次写入
+	compressed := c.useCompression(conn, target)
+	req, err := c.tcpRequest(conn, target, compressed, flags)
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := stream.Write(req); err != nil {
+		return fail(err)
+	}
+
+	// 等待连接结果有单独的截止时间，服务端迟迟不回复时尽快让应用失败
+	stream.SetReadDeadline(time.Now().Add(c.ConnectTimeout()))
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = fmt.Errorf("%w: %s", ErrConnectTimeout, target)
+		}
+		return fail(err)
+	}
+	stream.SetReadDeadline(time.Time{})
+	c.recordTargetResult(target, status[0])
+	if status[0] != 0x00 {
+		return fail(&targetError{target: target, status: status[0]})
+	}
+	if !stop() {
+		// ctx 已取消，流已被中断
+		return fail(ctx.Err())
+	}
+
+	tc := &tunnelConn{Stream: stream, client: c, local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+	if compressed {
+		tc.cr = compress.NewReader(stream)
+		tc.cw = compress.NewWriter(stream)
+	}
+	return tc, nil
+}
+
+// tcpRequest 构造 TCP 转发请求
+// 服务端支持时使用版本 1 的结构化目标（携带压缩、地址族偏好、流量类型等标志），否则使用版本 0（协商了压缩时使用压缩转发指令）
+func (c *Client) tcpRequest(conn quic.Connection, addr string, compressed bool, flags target.Flags) ([]byte, error) {
+	if c.serverCaps(conn)&capTargetV1 != 0 {
+		t, err := target.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		t.Flags = flags | c.familyFlags()
+		if compressed {
+			t.Flags |= target.FlagCompress
+		}
+		return t.Append([]byte{0x00, opTCPConnect})
+	}
+
+	var req []byte
+	if compressed {
+		req = append(req, 0x00, opTCPDeflate)
+	}
+	return target.AppendV0(req, addr)
+}
+
+// tunnelConn 隧道内的 TCP 连接（一条已完成转发请求的 QUIC 流）
+type tunnelConn struct {
+	quic.Stream
+	client        *Client
+	local, remote net.Addr
+
+	// 压缩转发时的编解码器（未压缩时为 nil），统计按增量累加到客户端
+	cr                *compress.Reader
+	cw                *compress.Writer
+	readRaw, readWire int64 // 仅由读方向更新
+	sentRaw, sentWire int64 // 仅由写方向更新
+
+	closeOnce sync.Once
+}
+
+// Read 见 net.Conn
+func (t *tunnelConn) Read(p []byte) (int, error) {
+	if t.cr == nil {
+		return t.Stream.Read(p)
+	}
+	n, err := t.cr.Read(p)
+	raw, wire := t.cr.Stats()
+	t.client.addCompressStats(raw-t.readRaw, wire-t.readWire)
+	t.readRaw, t.readWire = raw, wire
+	return n, err
+}
+
+// Write 见 net.Conn
+func (t *tunnelConn) Write(p []byte) (int, error) {
+	if t.cw == nil {
+		return t.Stream.Write(p)
+	}
+	n, err := t.cw.Write(p)
+	raw, wire := t.cw.Stats()
+	t.client.addCompressStats(raw-t.sentRaw, wire-t.sentWire)
+	t.sentRaw, t.sentWire = raw, wire
+	return n, err
+}
+
+// Close 关闭连接（同时释放读方向，防止流变成僵尸）
+func (t *tunnelConn) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.Stream.CancelRead(0)
+		err = t.Stream.Close()
+	})
+	return err
+}
+
+// LocalAddr 返回隧道 QUIC 连接的本地地址
+func (t *tunnelConn) LocalAddr() net.Addr { return t.local }
+
+// RemoteAddr 返回隧道 QUIC 连接的服务端地址（不是目标地址）
+func (t *tunnelConn) RemoteAddr() net.Addr { return t.remote }
+
+// DialUDP 通过隧道建立发往 target (host:port) 的 UDP 关联，返回的连接每次 Write 发送一个报文、每次 Read 读取一个回包
+// 固定使用 UDP over Stream 传输（每个关联独立一条流，不与 SOCKS5 的 Datagram 关联抢收包）；隧道断开后连接失效，需重新拨号
+// 开启假 IP 时发往 53 端口的会话由本地 DNS 服务应答（见 SetFakeIP）
+func (c *Client) DialUDP(ctx context.Context, target string) (net.Conn, error) {
+	if c.fakeIP.Load() {
+		if _, port, _ := net.SplitHostPort(target); port == "53" {
+			return c.dialLocalDNS(), nil
+		}
+	}
+	target = c.realTarget(target)
+	header, err := socks5UDPHeader(target)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.getQuicConnection()
+	if conn == nil || conn.Context().Err() != nil {
+		return nil, ErrNoTunnel
+	}
+
+	type result struct {
+		stream quic.Stream
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stream, err := c.openUDPStream(conn)
+		done <- result{stream, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &udpTunnelConn{
+			tunnelConn: tunnelConn{Stream: r.stream, client: c, local: conn.LocalAddr(), remote: conn.RemoteAddr()},
+			header:     header,
+			metrics:    c.startUDPSession(0, target, UDPTransportStream),
+		}, nil
+	case <-ctx.Done():
+		// 建流完成后立即关闭，避免泄漏
+		go func() {
+			if r := <-done; r.err == nil {
+				r.stream.CancelRead(0)
+				r.stream.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// udpTunnelConn 隧道内的 UDP 关联（长度前缀帧 + SOCKS5 UDP 数据包）
+type udpTunnelConn struct {
+	tunnelConn
+	header  []byte      // 目标地址的 SOCKS5 UDP 头部
+	metrics *udpSession // 会话统计（未开启时为 nil）
+
+	readMu  sync.Mutex
+	readBuf []byte
+	writeMu sync.Mutex
+}
+
+// Read 读取一个回包的载荷（p 不足时截断）
+func (u *udpTunnelConn) Read(p []byte) (int, error) {
+	u.readMu.Lock()
+	defer u.readMu.Unlock()
+	if u.readBuf == nil {
+		u.readBuf = make([]byte, udpstream.MaxFrameSize)
+	}
+	for {
+		data, err := udpstream.ReadFrame(u.Stream, u.readBuf)
+		if err != nil {
+			return 0, err
+		}
+		if u.client.udpUnreachableSignal(data) {
+			return 0, ErrUDPUnreachable
+		}
+		if payload, ok := socks5UDPPayload(data); ok {
+			u.metrics.observeDown(data)
+			return copy(p, payload), nil
+		}
+	}
+}
+
+// Write 发送一个报文
+func (u *udpTunnelConn) Write(p []byte) (int, error) {
+	u.writeMu.Lock()
+	defer u.writeMu.Unlock()
+	packet := make([]byte, 0, len(u.header)+len(p))
+	packet = append(append(packet, u.header...), p...)
+	if err := udpstream.WriteFrame(u.Stream, packet); err != nil {
+		return 0, err
+	}
+	u.metrics.observeUp(packet)
+	return len(p), nil
+}
+
+// Close 关闭关联并结束会话统计
+func (u *udpTunnelConn) Close() error {
+	u.client.endUDPSession(u.metrics)
+	return u.tunnelConn.Close()
+}
+
+// socks5UDPHeader 构造目标地址的 SOCKS5 UDP 头部：RSV(2) + FRAG(1) + ATYP + 地址 + 端口
+func socks5UDPHeader(target string) ([]byte, error) {
+	return appendSOCKS5Addr([]byte{0x00, 0x00, 0x00}, target)
+}
+
+// appendSOCKS5Addr 追加 SOCKS5 地址：ATYP + 地址 + 端口（IPv4 / IPv6 / 域名）
+// IP 字面量按地址类型编码（不会被当作域名）；带 zone 的 IPv6 地址返回 ErrZonedAddress
+func appendSOCKS5Addr(b []byte, target string) ([]byte, error) {
+	host, port, err := splitTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if hasZone(host) {
+		return nil, fmt.Errorf("%w: %s", ErrZonedAddress, host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(append(b, 0x01), ip4...)
+		} else {
+			b = append(append(b, 0x04), ip.To16()...)
+		}
+	} else {
+		if len(host) == 0 || len(host) > 255 {
+			return nil, fmt.Errorf("域名长度无效: %q", host)
+		}
+		b = append(append(b, 0x03, byte(len(host))), host...)
+	}
+	return binary.BigEndian.AppendUint16(b, port), nil
+}
+
+// udpReplyUnreachable 节点转告 ICMP 不可达的信令包：RSV 第一个字节为该值，地址为不可达的目标，载荷为空
+// 只在协商了 capUDPUnreachable 后出现；53 端口的查询节点直接回复 SERVFAIL，不使用信令
+const udpReplyUnreachable byte = 0x01
+
+// udpUnreachableSignal 回包是否为不可达信令（是则计数，信令不转发给应用）
+func (c *Client) udpUnreachableSignal(packet []byte) bool {
+	if len(packet) == 0 || packet[0] != udpReplyUnreachable {
+		return false
+	}
+	c.udpUnreachable.Add(1)
+	return true
+}
+
+// socks5UDPPayload 去掉回包的 SOCKS5 UDP 头部，返回载荷
+func socks5UDPPayload(packet []byte) ([]byte, bool) {
+	if len(packet) < 4 {
+		return nil, false
+	}
+	var addrLen int
+	switch packet[3] {
+	case 0x01:
+		addrLen = 4
+	case 0x04:
+		addrLen = 16
+	case 0x03:
+		if len(packet) < 5 {
+			return nil, false
+		}
+		addrLen = 1 + int(packet[4])
+	default:
+		return nil, false
+	}
+	start := 4 + addrLen + 2
+	if len(packet) < start {
+		return nil, false
+	}
+	return packet[start:], true
+}
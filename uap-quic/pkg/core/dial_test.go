@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// serveStatusLater 在 server 上接受流：鉴权行回复 0x00，能力协商按旧版服务端回复不认识，
+// 地址帧读完后等待 delay 再回复连接成功并写入 "late"；delay < 0 时从不回复连接结果
+func serveStatusLater(t *testing.T, server quic.Connection, delay time.Duration) {
+	go func() {
+		for {
+			stream, err := server.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				r := bufio.NewReader(stream)
+				if _, err := r.ReadString('\n'); err != nil {
+					return
+				}
+				stream.Write([]byte{0x00})
+				first, err := r.ReadByte()
+				if err != nil {
+					return
+				}
+				if first == 0x00 { // 能力协商
+					stream.Write([]byte{0x01})
+					stream.Close()
+					return
+				}
+				if _, err := io.ReadFull(r, make([]byte, int(first))); err != nil {
+					return
+				}
+				if delay < 0 {
+					<-stream.Context().Done()
+					return
+				}
+				time.Sleep(delay)
+				stream.Write([]byte{0x00})
+				time.Sleep(delay)
+				stream.Write([]byte("late"))
+				stream.Close()
+			}()
+		}
+	}()
+}
+
+func TestConnectTimeoutSetting(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	if got := c.ConnectTimeout(); got != DefaultConnectTimeout {
+		t.Fatalf("默认 %v", got)
+	}
+	c.SetConnectTimeout(5 * time.Second)
+	if got := c.ConnectTimeout(); got != 5*time.Second {
+		t.Fatalf("设置后 %v", got)
+	}
+	// 0 与负数恢复默认
+	c.SetConnectTimeout(-time.Second)
+	if got := c.ConnectTimeout(); got != DefaultConnectTimeout {
+		t.Fatalf("设置负数后 %v", got)
+	}
+}
+
+// TestConnectTimeout 节点接受并通过鉴权但从不回复连接结果：在设置的时长内失败，SOCKS5 回复 0x04
+func TestConnectTimeout(t *testing.T) {
+	client, server := testQUICPair(t, nil)
+	serveStatusLater(t, server, -1)
+	c := newRoutingClient(t, ModeGlobal, "")
+	c.SetConnectTimeout(300 * time.Millisecond)
+	setQuicConnection(c, client)
+
+	start := time.Now()
+	_, err := c.DialTCP(context.Background(), "example.com:80")
+	if elapsed := time.Since(start); !errors.Is(err, ErrConnectTimeout) || elapsed < 300*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("%v 后返回 %v，期望 ErrConnectTimeout", elapsed, err)
+	}
+	// 超时不是鉴权失败，也不让目标进入冷却
+	if errors.Is(err, ErrAuthRejected) || len(c.penalties.snapshot("", time.Now())) != 0 {
+		t.Fatalf("超时被当作鉴权失败或目标失败: %v", err)
+	}
+
+	if rep := connectThrough(t, c, "example.com:80"); rep != 0x04 {
+		t.Fatalf("SOCKS5 回复 0x%02x，期望 0x04", rep)
+	}
+}
+
+// TestConnectTimeoutCleared 收到连接结果后清除截止时间，之后的数据晚于该时长到达也能读到
+func TestConnectTimeoutCleared(t *testing.T) {
+	client, server := testQUICPair(t, nil)
+	serveStatusLater(t, server, 200*time.Millisecond)
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	c.SetConnectTimeout(300 * time.Millisecond)
+	setQuicConnection(c, client)
+
+	conn, err := c.DialTCP(context.Background(), "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "late" {
+		t.Fatalf("读到 %q, %v", data, err)
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNS 缓存参数
+const (
+	dnsCacheSize   = 4096             // 最多缓存的应答数，满时先清理过期项，仍然满时随机淘汰一项
+	dnsCacheMaxTTL = 10 * time.Minute // 缓存时长上限（记录的 TTL 更长时也按此过期）
+	dnsNegativeTTL = 30 * time.Second // 没有记录的应答（NXDOMAIN / 空结果）且没有 SOA 时的缓存时长
+)
+
+// dnsCache 本地 DNS 服务的应答缓存与并发合并：相同问题的并发查询只向上游发出一次
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+	calls   map[string]*dnsCall
+}
+
+// dnsCacheEntry 缓存的应答（原始报文，取出时按已缓存的时长扣减 TTL）
+type dnsCacheEntry struct {
+	msg     []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// dnsCall 正在进行的上游查询
+type dnsCall struct {
+	done chan struct{}
+	msg  []byte
+	err  error
+}
+
+// get 取出未过期的应答及其已缓存的秒数
+func (d *dnsCache) get(key string, now time.Time) ([]byte, uint32, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	if !now.Before(e.expires) {
+		delete(d.entries, key)
+		return nil, 0, false
+	}
+	return e.msg, uint32(now.Sub(e.stored) / time.Second), true
+}
+
+// do 执行 key 对应的上游查询：已有相同查询在进行时等待其结果，不重复发出；可缓存的应答写入缓存
+// 返回的报文由所有等待者共享，不能修改
+func (d *dnsCache) do(key string, query func() ([]byte, error)) ([]byte, error) {
+	d.mu.Lock()
+	if call, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		<-call.done
+		return call.msg, call.err
+	}
+	if d.calls == nil {
+		d.calls = make(map[string]*dnsCall)
+	}
+	call := &dnsCall{done: make(chan struct{})}
+	d.calls[key] = call
+	d.mu.Unlock()
+
+	call.msg, call.err = query()
+
+	d.mu.Lock()
+	delete(d.calls, key)
+	if call.err == nil {
+		if ttl := dnsCacheTTL(call.msg); ttl > 0 {
+			d.storeLocked(key, call.msg, ttl)
+		}
+	}
+	d.mu.Unlock()
+	close(call.done)
+	return call.msg, call.err
+}
+
+// storeLocked 写入缓存（调用方持有 mu）
+func (d *dnsCache) storeLocked(key string, msg []byte, ttl time.Duration) {
+	if d.entries == nil {
+		d.entries = make(map[string]dnsCacheEntry)
+	}
+	now := time.Now()
+	if len(d.entries) >= dnsCacheSize {
+		for k, e := range d.entries {
+			if !now.Before(e.expires) {
+				delete(d.entries, k)
+			}
+		}
+		for k := range d.entries {
+			if len(d.entries) < dnsCacheSize {
+				break
+			}
+			delete(d.entries, k)
+		}
+	}
+	d.entries[key] = dnsCacheEntry{msg: msg, stored: now, expires: now.Add(ttl)}
+}
+
+// dnsCacheTTL 应答的缓存时长：取应答段与授权段记录 TTL 的最小值，不超过 dnsCacheMaxTTL
+// 只缓存成功与 NXDOMAIN 的完整应答；被截断、SERVFAIL 等应答返回 0
+func dnsCacheTTL(msg []byte) time.Duration {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Truncated || (h.RCode != dnsmessage.RCodeSuccess && h.RCode != dnsmessage.RCodeNameError) {
+		return 0
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0
+	}
+	ttl, records := dnsCacheMaxTTL, 0
+	sections := []struct {
+		header func() (dnsmessage.ResourceHeader, error)
+		skip   func() error
+	}{{p.AnswerHeader, p.SkipAnswer}, {p.AuthorityHeader, p.SkipAuthority}}
+	for _, sec := range sections {
+		for {
+			rh, err := sec.header()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return 0
+			}
+			records++
+			ttl = min(ttl, time.Duration(rh.TTL)*time.Second)
+			if err := sec.skip(); err != nil {
+				return 0
+			}
+		}
+	}
+	if records == 0 {
+		return dnsNegativeTTL
+	}
+	return ttl
+}
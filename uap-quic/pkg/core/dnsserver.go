@@ -0,0 +1,584 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSTunnelUpstream 走代理的域名在节点侧使用的 DNS 服务器（经隧道以 TCP 查询）
+const DefaultDNSTunnelUpstream = "8.8.8.8:53"
+
+// 本地 DNS 服务参数
+const (
+	dnsQueryTimeout = 5 * time.Second  // 单次上游查询（含 UDP 截断后的 TCP 重试）的最长时间
+	dnsTCPIdle      = 10 * time.Second // TCP 连接上两次查询之间的最长空闲
+	dnsMaxInFlight  = 256              // 同时处理的 UDP 查询上限，超出的查询被丢弃（由应用重试）
+	dnsMinUDPSize   = 512              // 没有 EDNS0 时 UDP 应答的大小上限 (RFC 1035)
+	dnsMaxUDPSize   = 4096             // EDNS0 通告的 UDP 应答大小按此封顶（避免 IP 分片）
+)
+
+// DNSServerConfig 本地 DNS 服务（把系统解析器指向客户端后，分流规则对所有应用生效）
+type DNSServerConfig struct {
+	Listen   string `json:"listen"`   // 监听地址 host:port（同时监听 UDP 与 TCP）
+	Upstream string `json:"upstream"` // 直连域名使用的上游 DNS（ip:port，为空时读取 /etc/resolv.conf 中第一个不是本服务的地址）
+	Tunnel   string `json:"tunnel"`   // 走代理的域名在节点侧使用的 DNS（ip:port，为空时为 DefaultDNSTunnelUpstream）
+}
+
+// WithDefaults 补全为空的项（Upstream 读取系统配置）
+func (d DNSServerConfig) WithDefaults() (DNSServerConfig, error) {
+	if d.Tunnel == "" {
+		d.Tunnel = DefaultDNSTunnelUpstream
+	}
+	if d.Upstream == "" {
+		upstream, err := systemNameserver(d.Listen)
+		if err != nil {
+			return d, err
+		}
+		d.Upstream = upstream
+	}
+	return d, nil
+}
+
+// Validate 校验地址格式
+func (d DNSServerConfig) Validate() error {
+	if _, _, err := net.SplitHostPort(d.Listen); err != nil {
+		return fmt.Errorf("DNS 监听地址无效 %q: %w", d.Listen, err)
+	}
+	for _, addr := range []string{d.Upstream, d.Tunnel} {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) == nil || port == "" {
+			return fmt.Errorf("DNS 服务器地址无效 %q（需要 IP:端口）", addr)
+		}
+	}
+	return nil
+}
+
+// systemNameserver 从 /etc/resolv.conf 读取第一个不是 listen 本身的 DNS 服务器（系统解析器改为指向本服务后不会绕回自己）
+func systemNameserver(listen string) (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("读取系统 DNS 配置失败，请指定上游 DNS: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" || net.ParseIP(fields[1]) == nil {
+			continue
+		}
+		addr := net.JoinHostPort(fields[1], "53")
+		if addr != listen {
+			return addr, nil
+		}
+	}
+	return "", errors.New("系统 DNS 配置中没有可用的服务器，请指定上游 DNS")
+}
+
+// SetDNSServer 开启本地 DNS 服务（nil 关闭，默认关闭），配置不合法时返回错误并保留当前设置；在 Start 之前调用
+// 查询按分流规则处理：走代理的域名经隧道在节点侧解析（得到离节点最近的地址，也不会被本地网络看到），
+// 直连的域名转发给上游 DNS，被策略拒绝的域名回复 REFUSED（kill switch 拒绝时回复 SERVFAIL）。
+// 支持 EDNS0，UDP 应答超出应用通告的大小时置 TC 位由应用改用 TCP；相同问题的并发查询合并为一次，应答按 TTL 缓存
+func (c *Client) SetDNSServer(cfg *DNSServerConfig) error {
+	if cfg == nil {
+		c.dnsServer.Store(nil)
+		return nil
+	}
+	d, err := cfg.WithDefaults()
+	if err != nil {
+		return err
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	c.dnsServer.Store(&d)
+	return nil
+}
+
+// DNSServer 当前的本地 DNS 服务配置（nil 表示关闭）
+func (c *Client) DNSServer() *DNSServerConfig {
+	if d := c.dnsServer.Load(); d != nil {
+		cfg := *d
+		return &cfg
+	}
+	return nil
+}
+
+// DNSStats 本地 DNS 服务统计
+type DNSStats struct {
+	Queries   uint64 `json:"queries"`    // 收到的查询数
+	Tunnel    uint64 `json:"tunnel"`     // 经隧道解析的查询数（含缓存命中）
+	Upstream  uint64 `json:"upstream"`   // 转发给上游 DNS 的查询数（含缓存命中）
+	FakeIP    uint64 `json:"fake_ip"`    // 回复假 IP 的查询数（tun 包模式）
+	CacheHits uint64 `json:"cache_hits"` // 缓存命中数
+	Failures  uint64 `json:"failures"`   // 上游查询失败（回复 SERVFAIL）的次数
+}
+
+// dnsCounters 本地 DNS 服务计数
+type dnsCounters struct {
+	queries, tunnel, upstream, fakeIP, cacheHits, failures atomic.Uint64
+}
+
+// dnsStats 本地 DNS 服务统计（没有开启本地 DNS 服务也没有开启假 IP 时为 nil）
+func (c *Client) dnsStats() *DNSStats {
+	if c.dnsServer.Load() == nil && !c.fakeIP.Load() {
+		return nil
+	}
+	n := &c.dnsCounters
+	return &DNSStats{
+		Queries:   n.queries.Load(),
+		Tunnel:    n.tunnel.Load(),
+		Upstream:  n.upstream.Load(),
+		FakeIP:    n.fakeIP.Load(),
+		CacheHits: n.cacheHits.Load(),
+		Failures:  n.failures.Load(),
+	}
+}
+
+// startDNSServer 按 SetDNSServer 的配置监听 UDP 与 TCP（未开启时直接返回），客户端停止时关闭
+func (c *Client) startDNSServer() error {
+	cfg := c.dnsServer.Load()
+	if cfg == nil {
+		return nil
+	}
+	pc, err := net.ListenPacket("udp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("DNS 服务启动失败: %w", err)
+	}
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("DNS 服务启动失败: %w", err)
+	}
+	go func() {
+		<-c.ctx.Done()
+		pc.Close()
+		ln.Close()
+	}()
+	go c.serveDNSPackets(pc)
+	go c.serveDNSStreams(ln)
+	log.Printf("🧭 本地 DNS 服务已就绪: %s（直连上游 %s，隧道内 %s）", cfg.Listen, cfg.Upstream, cfg.Tunnel)
+	return nil
+}
+
+// serveDNSPackets UDP 查询：每个查询在单独的 goroutine 中处理，同时处理的查询数有上限
+func (c *Client) serveDNSPackets(pc net.PacketConn) {
+	sem := make(chan struct{}, dnsMaxInFlight)
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				log.Printf("⚠️ DNS 服务 UDP 读取失败: %v", err)
+			}
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-sem }()
+			if reply := c.answerDNS(c.ctx, query, true); reply != nil {
+				pc.WriteTo(reply, addr)
+			}
+		}()
+	}
+}
+
+// serveDNSStreams TCP 查询（2 字节长度前缀，RFC 7766）：同一连接上的查询并发处理，应答按完成顺序写回
+func (c *Client) serveDNSStreams(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if c.ctx.Err() == nil {
+				log.Printf("⚠️ DNS 服务 TCP Accept 失败: %v", err)
+			}
+			return
+		}
+		go c.serveDNSConn(conn)
+	}
+}
+
+// serveDNSConn 处理一条 TCP 连接，空闲超过 dnsTCPIdle 后关闭
+func (c *Client) serveDNSConn(conn net.Conn) {
+	var pending sync.WaitGroup
+	defer func() {
+		pending.Wait()
+		conn.Close()
+	}()
+	var writeMu sync.Mutex
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(dnsTCPIdle))
+		query, err := readDNSFrame(r)
+		if err != nil {
+			return
+		}
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			reply := c.answerDNS(c.ctx, query, false)
+			if reply == nil {
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(dnsTCPIdle))
+			writeDNSFrame(conn, reply)
+		}()
+	}
+}
+
+// readDNSFrame 读取一个长度前缀的 DNS 报文
+func readDNSFrame(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeDNSFrame 写入一个长度前缀的 DNS 报文（合并为一次写入）
+func writeDNSFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	_, err := w.Write(frame)
+	return err
+}
+
+// dnsRequest 解析后的查询
+type dnsRequest struct {
+	header   dnsmessage.Header
+	question dnsmessage.Question
+	host     string // 规范化后的查询域名（用于分流判断）
+	edns     bool   // 查询带有 OPT 记录
+	udpSize  int    // 应用能接收的 UDP 应答大小
+	dnssecOK bool   // OPT 记录的 DO 位
+}
+
+// parseDNSRequest 解析查询；不是只有一个问题的标准查询时返回应回复的错误码
+func parseDNSRequest(raw []byte) (*dnsRequest, dnsmessage.RCode, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(raw)
+	if err != nil {
+		return nil, dnsmessage.RCodeFormatError, err
+	}
+	req := &dnsRequest{header: h, udpSize: dnsMinUDPSize}
+	if h.Response {
+		return nil, dnsmessage.RCodeFormatError, errors.New("不是查询")
+	}
+	questions, err := p.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		return req, dnsmessage.RCodeFormatError, errors.New("问题段无效")
+	}
+	req.question = questions[0]
+	if h.OpCode != 0 {
+		return req, dnsmessage.RCodeNotImplemented, errors.New("不支持的操作码")
+	}
+	req.host = normalizeHost(strings.ToLower(strings.TrimSuffix(req.question.Name.String(), ".")))
+	if err := p.SkipAllAnswers(); err != nil {
+		return req, dnsmessage.RCodeFormatError, err
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return req, dnsmessage.RCodeFormatError, err
+	}
+	for {
+		rh, err := p.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return req, dnsmessage.RCodeFormatError, err
+		}
+		if rh.Type == dnsmessage.TypeOPT {
+			req.edns = true
+			req.udpSize = min(max(int(rh.Class), dnsMinUDPSize), dnsMaxUDPSize)
+			req.dnssecOK = rh.DNSSECAllowed()
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return req, dnsmessage.RCodeFormatError, err
+		}
+	}
+	return req, dnsmessage.RCodeSuccess, nil
+}
+
+// answerDNS 处理一个查询，返回应答报文（无法回复时返回 nil）
+// viaUDP 为 true 时应答超出应用能接收的大小会被截断并置 TC 位
+func (c *Client) answerDNS(ctx context.Context, raw []byte, viaUDP bool) []byte {
+	c.dnsCounters.queries.Add(1)
+	req, rcode, err := parseDNSRequest(raw)
+	if req == nil {
+		return nil // 连头部都无法解析，或本身是应答
+	}
+	if err != nil {
+		return req.errorReply(rcode)
+	}
+
+	d := c.route(req.host, false)
+	fakeIP := c.fakeIP.Load()
+	switch {
+	case d.Reason == RouteReasonKillSwitch:
+		return req.errorReply(dnsmessage.RCodeServerFailure)
+	case d.Action == RouteBlock:
+		return req.errorReply(dnsmessage.RCodeRefused)
+	case d.Action == RouteProxy && fakeIP && req.question.Class == dnsmessage.ClassINET &&
+		(req.question.Type == dnsmessage.TypeA || req.question.Type == dnsmessage.TypeAAAA):
+		c.dnsCounters.fakeIP.Add(1)
+		return req.fakeReply(c.fakeIPs.assign(req.host).As4())
+	}
+
+	// 包模式下直连的查询也经隧道解析：本机发出的查询会重新进入 tun
+	via, exchange := "tunnel", c.exchangeTunnelDNS
+	if d.Action == RouteDirect && !fakeIP {
+		via, exchange = "upstream", c.exchangeUpstreamDNS
+	}
+	if via == "tunnel" {
+		c.dnsCounters.tunnel.Add(1)
+	} else {
+		c.dnsCounters.upstream.Add(1)
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%d|%t|%t", via, req.host, req.question.Type, req.question.Class, req.edns, req.dnssecOK)
+	msg, age, ok := c.dnsCache.get(key, time.Now())
+	if ok {
+		c.dnsCounters.cacheHits.Add(1)
+	} else {
+		msg, err = c.dnsCache.do(key, func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+			defer cancel()
+			return exchange(ctx, raw)
+		})
+		if err != nil {
+			c.dnsCounters.failures.Add(1)
+			return req.errorReply(dnsmessage.RCodeServerFailure)
+		}
+	}
+
+	maxSize := 0xFFFF
+	if viaUDP {
+		maxSize = req.udpSize
+	}
+	reply, err := req.finishReply(msg, age, maxSize)
+	if err != nil {
+		c.dnsCounters.failures.Add(1)
+		return req.errorReply(dnsmessage.RCodeServerFailure)
+	}
+	return reply
+}
+
+// replyHeader 应答头部（保留 ID、操作码与 RD）
+func (req *dnsRequest) replyHeader(rcode dnsmessage.RCode) dnsmessage.Header {
+	return dnsmessage.Header{
+		ID:                 req.header.ID,
+		Response:           true,
+		OpCode:             req.header.OpCode,
+		RecursionDesired:   req.header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	}
+}
+
+// opt 回显的 OPT 记录（查询没有 OPT 时为空）
+func (req *dnsRequest) opt() []dnsmessage.Resource {
+	if !req.edns {
+		return nil
+	}
+	var rh dnsmessage.ResourceHeader
+	rh.SetEDNS0(dnsMaxUDPSize, dnsmessage.RCodeSuccess, req.dnssecOK)
+	return []dnsmessage.Resource{{Header: rh, Body: &dnsmessage.OPTResource{}}}
+}
+
+// errorReply 只含问题段的错误应答
+func (req *dnsRequest) errorReply(rcode dnsmessage.RCode) []byte {
+	msg := dnsmessage.Message{Header: req.replyHeader(rcode), Additionals: req.opt()}
+	if req.question.Name.Length > 0 {
+		msg.Questions = []dnsmessage.Question{req.question}
+	}
+	reply, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return reply
+}
+
+// fakeReply 假 IP 应答：A 查询回复假 IP，AAAA 查询回复空结果
+func (req *dnsRequest) fakeReply(ip [4]byte) []byte {
+	msg := dnsmessage.Message{
+		Header:      req.replyHeader(dnsmessage.RCodeSuccess),
+		Questions:   []dnsmessage.Question{req.question},
+		Additionals: req.opt(),
+	}
+	if req.question.Type == dnsmessage.TypeA {
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: req.question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: fakeIPTTL},
+			Body:   &dnsmessage.AResource{A: ip},
+		}}
+	}
+	reply, err := msg.Pack()
+	if err != nil {
+		return req.errorReply(dnsmessage.RCodeServerFailure)
+	}
+	return reply
+}
+
+// finishReply 把上游应答（可能来自缓存或其他应用的相同查询）改写为对本查询的应答：
+// 换成本查询的 ID 与问题，按已缓存的秒数扣减 TTL，超出 maxSize 时只保留问题段与 OPT 并置 TC 位
+func (req *dnsRequest) finishReply(upstream []byte, age uint32, maxSize int) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(upstream); err != nil {
+		return nil, err
+	}
+	msg.ID = req.header.ID
+	msg.Questions = []dnsmessage.Question{req.question}
+	for _, rrs := range [][]dnsmessage.Resource{msg.Answers, msg.Authorities, msg.Additionals} {
+		for i := range rrs {
+			if rrs[i].Header.Type != dnsmessage.TypeOPT {
+				rrs[i].Header.TTL -= min(age, rrs[i].Header.TTL)
+			}
+		}
+	}
+	if !req.edns {
+		msg.Additionals = withoutOPT(msg.Additionals)
+	}
+	reply, err := msg.Pack()
+	if err != nil || len(reply) <= maxSize {
+		return reply, err
+	}
+	msg.Truncated = true
+	msg.Answers, msg.Authorities = nil, nil
+	msg.Additionals = req.opt()
+	return msg.Pack()
+}
+
+// withoutOPT 去掉 OPT 记录（查询没有 OPT 时应答也不能带，RFC 6891）
+func withoutOPT(rrs []dnsmessage.Resource) []dnsmessage.Resource {
+	out := rrs[:0]
+	for _, rr := range rrs {
+		if rr.Header.Type != dnsmessage.TypeOPT {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// exchangeUpstreamDNS 向直连上游发出查询：先用 UDP，应答被截断时改用 TCP 重试
+func (c *Client) exchangeUpstreamDNS(ctx context.Context, query []byte) ([]byte, error) {
+	cfg := c.dnsServer.Load()
+	if cfg == nil {
+		return nil, errors.New("没有配置上游 DNS")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// 忽略 ID 不匹配的报文（迟到的旧应答或伪造的应答）
+		if n < 12 || binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(query) {
+			continue
+		}
+		if buf[2]&0x02 == 0 { // TC 位
+			return append([]byte(nil), buf[:n]...), nil
+		}
+		break
+	}
+
+	tcp, err := dialer.DialContext(ctx, "tcp", cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer tcp.Close()
+	return exchangeDNSStream(ctx, tcp, query)
+}
+
+// exchangeTunnelDNS 经隧道以 TCP 向节点侧的 DNS 发出查询（TCP 不会截断，也不受 UDP 关联传输方式的限制）
+func (c *Client) exchangeTunnelDNS(ctx context.Context, query []byte) ([]byte, error) {
+	server := DefaultDNSTunnelUpstream
+	if cfg := c.dnsServer.Load(); cfg != nil {
+		server = cfg.Tunnel
+	}
+	conn, err := c.dialTCP(ctx, server, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return exchangeDNSStream(ctx, conn, query)
+}
+
+// exchangeDNSStream 在流式连接上发出一个查询并读取应答
+func exchangeDNSStream(ctx context.Context, conn net.Conn, query []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := writeDNSFrame(conn, query); err != nil {
+		return nil, err
+	}
+	reply, err := readDNSFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 12 || binary.BigEndian.Uint16(reply) != binary.BigEndian.Uint16(query) {
+		return nil, errors.New("DNS 应答与查询不匹配")
+	}
+	return reply, nil
+}
+
+// dialLocalDNS tun 包模式下发往 53 端口的 UDP 会话（开启假 IP 时）：由本地 DNS 服务应答，不经过节点
+// 返回的连接每次 Write 发送一个查询、每次 Read 读取一个应答，支持读写截止时间
+func (c *Client) dialLocalDNS() net.Conn {
+	app, local := net.Pipe()
+	go func() {
+		defer local.Close()
+		var writeMu sync.Mutex
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := local.Read(buf)
+			if err != nil {
+				return
+			}
+			query := append([]byte(nil), buf[:n]...)
+			go func() {
+				reply := c.answerDNS(c.ctx, query, false)
+				if reply == nil {
+					return
+				}
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				local.Write(reply)
+			}()
+		}
+	}()
+	return app
+}
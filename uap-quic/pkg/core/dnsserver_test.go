@@ -0,0 +1,385 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsUpstream 本机上游 DNS（UDP 与 TCP 同一端口）：big.cn. 回复 60 条 A 记录、huge.cn. 回复 300 条，其余 1 条；
+// 与不支持 EDNS0 的服务器一样，UDP 应答超过 512 字节时只回复问题段并置 TC 位
+type dnsUpstream struct {
+	addr  string
+	hits  atomic.Int32  // 收到的查询数（UDP 与 TCP 合计）
+	delay time.Duration // 每次应答前的等待
+}
+
+// upstreamUDPSize 上游 OPT 记录通告的 UDP 大小
+const upstreamUDPSize = 1400
+
+// startDNSUpstream 启动每次应答前等待 delay 的上游 DNS，测试结束时关闭
+func startDNSUpstream(t *testing.T, delay time.Duration) *dnsUpstream {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("上游 DNS 的 TCP 端口被占用: %v", err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+	u := &dnsUpstream{addr: pc.LocalAddr().String(), delay: delay}
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := append([]byte(nil), buf[:n]...)
+			go func() {
+				if reply := u.answer(query, dnsMinUDPSize); reply != nil {
+					pc.WriteTo(reply, addr)
+				}
+			}()
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				query, err := readDNSFrame(conn)
+				if err != nil {
+					return
+				}
+				if reply := u.answer(query, 0xFFFF); reply != nil {
+					writeDNSFrame(conn, reply)
+				}
+			}()
+		}
+	}()
+	return u
+}
+
+// answer 上游应答，超过 maxSize 时截断
+func (u *dnsUpstream) answer(query []byte, maxSize int) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	u.hits.Add(1)
+	time.Sleep(u.delay)
+	q := msg.Questions[0]
+	msg.Response, msg.RecursionAvailable = true, true
+	// 与真实服务器一样通告自己的 UDP 大小，而不是回显查询的 OPT
+	for i := range msg.Additionals {
+		if msg.Additionals[i].Header.Type == dnsmessage.TypeOPT {
+			msg.Additionals[i].Header.SetEDNS0(upstreamUDPSize, dnsmessage.RCodeSuccess, false)
+		}
+	}
+	n := map[string]int{"big.cn.": 60, "huge.cn.": 300}[q.Name.String()]
+	for i := 0; i < max(n, 1); i++ {
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   &dnsmessage.AResource{A: [4]byte{10, 0, byte(i >> 8), byte(i)}},
+		})
+	}
+	reply, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	if len(reply) > maxSize {
+		msg.Truncated, msg.Answers = true, nil
+		reply, _ = msg.Pack()
+	}
+	return reply
+}
+
+// buildDNSQuery A 记录查询，ednsSize > 0 时附带通告该 UDP 大小的 OPT 记录
+func buildDNSQuery(t *testing.T, id uint16, name string, ednsSize int) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	if ednsSize > 0 {
+		b.StartAdditionals()
+		var rh dnsmessage.ResourceHeader
+		rh.SetEDNS0(ednsSize, dnsmessage.RCodeSuccess, false)
+		b.OPTResource(rh, dnsmessage.OPTResource{})
+	}
+	query, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+// unpackDNS 解析应答
+func unpackDNS(t *testing.T, reply []byte) dnsmessage.Message {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		t.Fatalf("应答无法解析: %v", err)
+	}
+	return msg
+}
+
+// optSize 应答中 OPT 记录通告的 UDP 大小（没有 OPT 时为 0）
+func optSize(msg dnsmessage.Message) int {
+	for _, rr := range msg.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			return int(rr.Header.Class)
+		}
+	}
+	return 0
+}
+
+// newDNSServerClient 直连域名转发给 upstream 的智能模式客户端（规则为 google.com）
+func newDNSServerClient(t *testing.T, upstream string) *Client {
+	t.Helper()
+	c := newRoutingClient(t, ModeSmart, "google.com\n")
+	if err := c.SetDNSServer(&DNSServerConfig{Listen: "127.0.0.1:53", Upstream: upstream, Tunnel: "127.0.0.1:1"}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// serveLocalDNS 在本机临时端口提供本地 DNS 服务，返回 UDP 与 TCP 地址
+func serveLocalDNS(t *testing.T, c *Client) (string, string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+	go c.serveDNSPackets(pc)
+	go c.serveDNSStreams(ln)
+	return pc.LocalAddr().String(), ln.Addr().String()
+}
+
+// udpExchange 以 UDP 发出一个查询并读取应答
+func udpExchange(t *testing.T, addr string, query []byte) dnsmessage.Message {
+	t.Helper()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(query)
+	buf := make([]byte, 64*1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("UDP 查询: %v", err)
+	}
+	return unpackDNS(t, buf[:n])
+}
+
+// TestDNSServerSplit 按分流规则应答：直连域名转发上游并缓存，走代理的域名在包模式下回复假 IP，
+// 被拒绝的域名回复 REFUSED，kill switch 拒绝时回复 SERVFAIL
+func TestDNSServerSplit(t *testing.T) {
+	up := startDNSUpstream(t, 0)
+	c := newDNSServerClient(t, up.addr)
+
+	msg := unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 7, "baidu.cn.", 0), true))
+	if msg.ID != 7 || msg.RCode != dnsmessage.RCodeSuccess || len(msg.Answers) != 1 || optSize(msg) != 0 {
+		t.Fatalf("直连域名的应答 %+v", msg.Header)
+	}
+	// 大小写不同的相同问题命中缓存，应答的问题段与查询一致
+	msg = unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 8, "BAIDU.cn.", 0), true))
+	if msg.ID != 8 || msg.Questions[0].Name.String() != "BAIDU.cn." || len(msg.Answers) != 1 || msg.Answers[0].Header.TTL > 300 {
+		t.Fatalf("缓存命中的应答 %+v", msg)
+	}
+	if n := up.hits.Load(); n != 1 {
+		t.Fatalf("上游收到 %d 个查询，期望 1", n)
+	}
+	if st := c.GetStats(0).DNS; st == nil || st.Queries != 2 || st.Upstream != 2 || st.CacheHits != 1 || st.Tunnel != 0 {
+		t.Fatalf("DNS 统计 %+v", st)
+	}
+
+	// 隧道未连接时走代理的域名回复 SERVFAIL，不查询直连上游
+	if msg = unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 12, "www.google.com.", 0), true)); msg.RCode != dnsmessage.RCodeServerFailure {
+		t.Fatalf("隧道未连接时回复 %v", msg.RCode)
+	}
+	if up.hits.Load() != 1 {
+		t.Fatal("走代理的域名查询了直连上游")
+	}
+
+	// 包模式下走代理的域名回复假 IP（AAAA 回复空结果），不查询上游
+	c.SetFakeIP(true)
+	msg = unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 9, "www.google.com.", 1232), true))
+	if len(msg.Answers) != 1 || msg.Answers[0].Header.TTL != fakeIPTTL || optSize(msg) != dnsMaxUDPSize {
+		t.Fatalf("假 IP 应答 %+v", msg)
+	}
+	ip := netip.AddrFrom4(msg.Answers[0].Body.(*dnsmessage.AResource).A)
+	if host, ok := c.fakeIPs.lookup(ip); !ok || host != "www.google.com" {
+		t.Fatalf("假 IP %v 对应 %q", ip, host)
+	}
+	if up.hits.Load() != 1 || c.GetStats(0).DNS.FakeIP != 1 {
+		t.Fatalf("假 IP 查询了上游或未计数: %+v", c.GetStats(0).DNS)
+	}
+	// 发往 53 端口的 UDP 会话由本地 DNS 服务应答，同一域名分到同一个假 IP
+	conn, err := c.DialUDP(context.Background(), "10.0.0.1:53")
+	if err != nil {
+		t.Fatalf("假 IP 模式下拨号 53 端口: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(buildDNSQuery(t, 13, "www.google.com.", 0))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("本地 DNS 会话: %v", err)
+	}
+	if msg = unpackDNS(t, buf[:n]); msg.ID != 13 || len(msg.Answers) != 1 || netip.AddrFrom4(msg.Answers[0].Body.(*dnsmessage.AResource).A) != ip {
+		t.Fatalf("本地 DNS 会话的应答 %+v", msg)
+	}
+	c.SetFakeIP(false)
+
+	// kill switch 开启且隧道未连接时，走代理的域名回复 SERVFAIL
+	c.SetKillSwitch(true)
+	if msg = unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 10, "mail.google.com.", 0), true)); msg.RCode != dnsmessage.RCodeServerFailure {
+		t.Fatalf("kill switch 拒绝时回复 %v", msg.RCode)
+	}
+	// 未命中规则的域名按策略拒绝时回复 REFUSED
+	c.SetUnmatchedPolicy(UnmatchedBlock)
+	if msg = unpackDNS(t, c.answerDNS(c.ctx, buildDNSQuery(t, 11, "baidu.cn.", 0), true)); msg.RCode != dnsmessage.RCodeRefused || msg.ID != 11 {
+		t.Fatalf("策略拒绝时回复 %v", msg.RCode)
+	}
+}
+
+// TestDNSServerTruncation 应答超出应用通告的 UDP 大小时置 TC 位，应用改用 TCP 拿到完整应答；
+// 上游的 UDP 应答被截断时本地服务自动改用 TCP 向上游重试
+func TestDNSServerTruncation(t *testing.T) {
+	up := startDNSUpstream(t, 0)
+	c := newDNSServerClient(t, up.addr)
+	udpAddr, tcpAddr := serveLocalDNS(t, c)
+
+	// 没有 EDNS0：应答超过 512 字节，只有问题段
+	msg := udpExchange(t, udpAddr, buildDNSQuery(t, 21, "big.cn.", 0))
+	if !msg.Truncated || len(msg.Answers) != 0 || msg.ID != 21 || len(msg.Questions) != 1 {
+		t.Fatalf("截断的 UDP 应答 %+v", msg)
+	}
+	if n := up.hits.Load(); n != 2 {
+		t.Fatalf("上游收到 %d 个查询，期望 UDP 截断后以 TCP 重试", n)
+	}
+
+	// 应用改用 TCP：完整应答（缓存命中，不再查询上游）
+	conn, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	writeDNSFrame(conn, buildDNSQuery(t, 22, "big.cn.", 0))
+	reply, err := readDNSFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg = unpackDNS(t, reply); msg.Truncated || len(msg.Answers) != 60 || msg.ID != 22 {
+		t.Fatalf("TCP 应答 %+v，%d 条记录", msg.Header, len(msg.Answers))
+	}
+	if up.hits.Load() != 2 {
+		t.Fatal("TCP 查询未命中缓存")
+	}
+	// 同一条 TCP 连接可以继续查询
+	writeDNSFrame(conn, buildDNSQuery(t, 23, "small.cn.", 0))
+	if reply, err = readDNSFrame(r); err != nil || unpackDNS(t, reply).ID != 23 {
+		t.Fatalf("同一连接上的第二个查询: %v", err)
+	}
+
+	// 通告了足够大小的 EDNS0 查询经 UDP 直接拿到完整应答
+	msg = udpExchange(t, udpAddr, buildDNSQuery(t, 24, "big.cn.", 1232))
+	if msg.Truncated || len(msg.Answers) != 60 || optSize(msg) != upstreamUDPSize {
+		t.Fatalf("EDNS0 的 UDP 应答 %+v，%d 条记录", msg.Header, len(msg.Answers))
+	}
+}
+
+// TestDNSServerEDNSSize 应用通告的 UDP 大小按 [512, 4096] 封顶：更大的应答即使应用通告了 65535 也置 TC 位
+func TestDNSServerEDNSSize(t *testing.T) {
+	for ednsSize, want := range map[int]int{0: 512, 100: 512, 1232: 1232, 4096: 4096, 65535: dnsMaxUDPSize} {
+		req, rcode, err := parseDNSRequest(buildDNSQuery(t, 1, "example.com.", ednsSize))
+		if err != nil || rcode != dnsmessage.RCodeSuccess || req.udpSize != want || req.edns != (ednsSize > 0) {
+			t.Errorf("通告 %d 时 UDP 大小 %d（期望 %d）, %v", ednsSize, req.udpSize, want, err)
+		}
+	}
+
+	up := startDNSUpstream(t, 0)
+	c := newDNSServerClient(t, up.addr)
+	udpAddr, _ := serveLocalDNS(t, c)
+	query := buildDNSQuery(t, 31, "huge.cn.", 65535)
+	msg := udpExchange(t, udpAddr, query)
+	if !msg.Truncated || len(msg.Answers) != 0 || optSize(msg) != dnsMaxUDPSize {
+		t.Fatalf("超过 %d 字节的 UDP 应答 %+v", dnsMaxUDPSize, msg)
+	}
+	full := c.answerDNS(c.ctx, query, false)
+	if msg = unpackDNS(t, full); len(full) <= dnsMaxUDPSize || msg.Truncated || len(msg.Answers) != 300 {
+		t.Fatalf("TCP 应答 %d 字节，%d 条记录", len(full), len(msg.Answers))
+	}
+}
+
+// TestDNSServerConcurrent 相同问题的并发查询合并为一次上游查询，每个应用收到带自己 ID 的应答
+func TestDNSServerConcurrent(t *testing.T) {
+	up := startDNSUpstream(t, 100*time.Millisecond)
+	c := newDNSServerClient(t, up.addr)
+	udpAddr, _ := serveLocalDNS(t, c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(id uint16) {
+			defer wg.Done()
+			msg := udpExchange(t, udpAddr, buildDNSQuery(t, id, "many.cn.", 0))
+			if msg.ID != id || len(msg.Answers) != 1 {
+				t.Errorf("查询 %d 收到 ID %d、%d 条记录", id, msg.ID, len(msg.Answers))
+			}
+		}(uint16(100 + i))
+	}
+	wg.Wait()
+	if n := up.hits.Load(); n != 1 {
+		t.Fatalf("50 个并发查询向上游发出 %d 次", n)
+	}
+}
+
+func TestDNSServerMalformed(t *testing.T) {
+	c := newDNSServerClient(t, "127.0.0.1:1")
+	if reply := c.answerDNS(c.ctx, []byte{1, 2, 3}, true); reply != nil {
+		t.Fatalf("无法解析的查询得到应答 %x", reply)
+	}
+	response := buildDNSQuery(t, 41, "example.com.", 0)
+	response[2] |= 0x80
+	if reply := c.answerDNS(c.ctx, response, true); reply != nil {
+		t.Fatal("应答报文得到了应答")
+	}
+	notify := buildDNSQuery(t, 42, "example.com.", 0)
+	notify[2] |= 4 << 3 // NOTIFY
+	if msg := unpackDNS(t, c.answerDNS(c.ctx, notify, true)); msg.RCode != dnsmessage.RCodeNotImplemented || msg.ID != 42 {
+		t.Fatalf("不支持的操作码回复 %v", msg.RCode)
+	}
+}
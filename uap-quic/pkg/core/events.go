@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 连接生命周期事件类型
+const (
+	EventConnected    = "connected"     // QUIC 隧道建立成功（首次连接、重连、换连都会触发）
+	EventDisconnected = "disconnected"  // 当前隧道意外断开（主动换连、Stop 不触发）
+	EventReconnecting = "reconnecting"  // 断线重连守护开始一次重连尝试
+	EventNodeSwitched = "node_switched" // 新连接的节点与上一次连接的不同（SetServer、节点地址轮换）
+	EventAuthFailed   = "auth_failed"   // 节点拒绝了鉴权凭证（连续被拒只触发一次，鉴权成功后重新计）
+)
+
+// Event 连接生命周期事件
+type Event struct {
+	Kind    string    `json:"kind"`              // 见 Event* 常量
+	Time    time.Time `json:"time"`              // 事件发生时间
+	Server  string    `json:"server"`            // 节点地址（host:port）
+	Addr    string    `json:"addr,omitempty"`    // 实际连接的地址（ip:port）
+	From    string    `json:"from,omitempty"`    // 切换前的地址（node_switched）
+	Attempt int       `json:"attempt,omitempty"` // 本轮断线后的第几次重连尝试（reconnecting）
+	Error   string    `json:"error,omitempty"`   // 断开原因 / 上一次重连失败的原因 / 鉴权被拒的原因
+}
+
+// eventQueueSize 待投递事件的缓冲数，回调处理过慢导致缓冲满时丢弃新事件
+const eventQueueSize = 64
+
+// SetEventHandler 设置连接生命周期事件回调（nil 取消），可在运行中任意时刻设置
+// 事件按发生顺序在同一个 goroutine 中投递（不持有任何锁，回调中可以调用 Client 的方法），客户端停止后不再投递
+func (c *Client) SetEventHandler(handler func(Event)) {
+	if handler == nil {
+		c.onEvent.Store(nil)
+		return
+	}
+	c.onEvent.Store(&handler)
+	c.eventsOnce.Do(func() { go c.dispatchEvents() })
+}
+
+// dispatchEvents 依次把事件交给回调，直到客户端停止
+func (c *Client) dispatchEvents() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case e := <-c.events:
+			if handler := c.onEvent.Load(); handler != nil {
+				(*handler)(e)
+			}
+		}
+	}
+}
+
+// emitEvent 填写时间与节点地址后放入投递队列（没有设置回调时忽略）
+func (c *Client) emitEvent(e Event) {
+	if c.onEvent.Load() == nil {
+		return
+	}
+	e.Time = time.Now()
+	if e.Server == "" {
+		e.Server = c.ServerAddr()
+	}
+	select {
+	case c.events <- e:
+	default:
+		log.Printf("⚠️ 事件回调处理过慢，丢弃事件: %s", e.Kind)
+	}
+}
+
+// connectedEvent 新连接建立成功（调用方持有 quicConnLock）：与上一次连接的地址不同时先触发 node_switched
+func (c *Client) connectedEvent(conn quic.Connection) {
+	addr := conn.RemoteAddr().String()
+	if c.lastConnAddr != "" && c.lastConnAddr != addr {
+		c.emitEvent(Event{Kind: EventNodeSwitched, Addr: addr, From: c.lastConnAddr})
+	}
+	c.lastConnAddr = addr
+	c.emitEvent(Event{Kind: EventConnected, Addr: addr})
+}
+
+// disconnectedEvent conn 已断开：仍是当前连接时（没有被换连替换，客户端也没有停止）触发 disconnected
+func (c *Client) disconnectedEvent(conn quic.Connection) {
+	c.quicConnLock.RLock()
+	current := c.quicConn == conn
+	c.quicConnLock.RUnlock()
+	if !current || c.ctx.Err() != nil {
+		return
+	}
+	e := Event{Kind: EventDisconnected, Addr: conn.RemoteAddr().String()}
+	if cause := context.Cause(conn.Context()); cause != nil && !errors.Is(cause, context.Canceled) {
+		e.Error = cause.Error()
+	}
+	c.emitEvent(e)
+}
+
+// authResult 记录一次鉴权的结果：被拒时（此前未被拒）触发 auth_failed 并记入节点失败，成功时重置
+func (c *Client) authResult(err error) {
+	switch {
+	case err == nil:
+		c.authRejected.Store(false)
+		c.nodeFailures.clear(c.ServerAddr())
+	case errors.Is(err, ErrAuthRejected):
+		c.nodeFailed(err)
+		if c.authRejected.CompareAndSwap(false, true) {
+			c.emitEvent(Event{Kind: EventAuthFailed, Error: err.Error()})
+		}
+	}
+}
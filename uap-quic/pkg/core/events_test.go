@@ -0,0 +1,163 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordEvents 设置事件回调，返回收到的事件
+func recordEvents(c *Client) chan Event {
+	events := make(chan Event, eventQueueSize)
+	c.SetEventHandler(func(e Event) { events <- e })
+	return events
+}
+
+// expectEvent 等待下一个事件并检查类型
+func expectEvent(t *testing.T, events chan Event, kind string) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e.Kind != kind {
+			t.Fatalf("收到事件 %+v，期望 %s", e, kind)
+		}
+		if e.Time.IsZero() || e.Server == "" {
+			t.Fatalf("事件未填写时间与节点: %+v", e)
+		}
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatalf("未收到 %s 事件", kind)
+	}
+	return Event{}
+}
+
+// expectNoEvent 短时间内没有新事件
+func expectNoEvent(t *testing.T, events chan Event) {
+	t.Helper()
+	select {
+	case e := <-events:
+		t.Fatalf("多余的事件 %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestConnectionEvents(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	events := recordEvents(c)
+
+	first, firstServer := testQUICPair(t, nil)
+	c.quicConnLock.Lock()
+	c.quicConn = first
+	c.connectedEvent(first)
+	c.quicConnLock.Unlock()
+	if e := expectEvent(t, events, EventConnected); e.Addr != first.RemoteAddr().String() {
+		t.Fatalf("connected 的地址 %s", e.Addr)
+	}
+
+	// 模拟断线：节点关闭当前连接
+	go c.watchGoAway(first)
+	firstServer.CloseWithError(0x42, "node crashed")
+	if e := expectEvent(t, events, EventDisconnected); e.Error == "" || e.Addr != first.RemoteAddr().String() {
+		t.Fatalf("disconnected 未带原因与地址: %+v", e)
+	}
+
+	// 重连到另一个节点：先 node_switched 再 connected
+	second, _ := testQUICPair(t, nil)
+	c.quicConnLock.Lock()
+	c.quicConn = second
+	c.connectedEvent(second)
+	c.quicConnLock.Unlock()
+	if e := expectEvent(t, events, EventNodeSwitched); e.From != first.RemoteAddr().String() || e.Addr != second.RemoteAddr().String() {
+		t.Fatalf("node_switched %+v", e)
+	}
+	expectEvent(t, events, EventConnected)
+
+	// 已被替换的连接断开不触发 disconnected
+	third, _ := testQUICPair(t, nil)
+	setQuicConnection(c, third)
+	second.CloseWithError(0, "")
+	c.disconnectedEvent(second)
+	expectNoEvent(t, events)
+
+	// 客户端停止后断开不触发
+	c.Stop()
+	third.CloseWithError(0, "")
+	c.disconnectedEvent(third)
+	expectNoEvent(t, events)
+}
+
+func TestAuthFailedEventOnce(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	events := recordEvents(c)
+
+	// 连续被拒只触发一次，鉴权成功后重新计
+	c.authResult(ErrAuthRejected)
+	c.authResult(ErrAuthRejected)
+	if e := expectEvent(t, events, EventAuthFailed); e.Error != ErrAuthRejected.Error() {
+		t.Fatalf("auth_failed %+v", e)
+	}
+	expectNoEvent(t, events)
+	c.authResult(errors.New("stream reset")) // 其他错误不是鉴权被拒
+	c.authResult(nil)
+	c.authResult(ErrAuthRejected)
+	expectEvent(t, events, EventAuthFailed)
+}
+
+func TestEventHandler(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+
+	// 没有回调时不入队
+	c.emitEvent(Event{Kind: EventReconnecting})
+	if len(c.events) != 0 {
+		t.Fatal("没有回调时事件入队")
+	}
+
+	// 按发生顺序投递；回调阻塞时缓冲满后丢弃新事件，不阻塞调用方
+	release := make(chan struct{})
+	got := make(chan Event, 2*eventQueueSize)
+	c.SetEventHandler(func(e Event) {
+		<-release
+		got <- e
+	})
+	done := make(chan struct{})
+	go func() {
+		for i := 1; i <= 2*eventQueueSize; i++ {
+			c.emitEvent(Event{Kind: EventReconnecting, Attempt: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("回调阻塞时 emitEvent 被阻塞")
+	}
+	close(release)
+	last := 0
+drain:
+	for {
+		select {
+		case e := <-got:
+			if e.Attempt <= last {
+				t.Fatalf("事件乱序: %d 在 %d 之后", e.Attempt, last)
+			}
+			last = e.Attempt
+		case <-time.After(200 * time.Millisecond):
+			break drain
+		}
+	}
+	if last == 0 || last > eventQueueSize+1 {
+		t.Fatalf("最后投递的事件 %d，期望缓冲满后丢弃", last)
+	}
+
+	// 取消回调后不再投递
+	c.SetEventHandler(nil)
+	c.emitEvent(Event{Kind: EventReconnecting})
+	select {
+	case e := <-got:
+		t.Fatalf("取消回调后仍投递 %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
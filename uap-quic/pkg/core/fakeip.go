@@ -0,0 +1,92 @@
+package core
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// fakeIPRange 假 IP 地址段（RFC 2544 的基准测试保留段，不会出现在公网上）
+var fakeIPRange = netip.MustParsePrefix("198.18.0.0/15")
+
+// fakeIPTTL 假 IP 应答的 TTL（秒）：映射在地址段用完一轮之前一直有效，TTL 只需让系统尽快重新查询
+const fakeIPTTL = 1
+
+// fakeIPPool 假 IP 与域名的双向映射
+// 按顺序分配地址段内的地址，用完一轮后从头复用（覆盖最早分配的映射）
+type fakeIPPool struct {
+	mu     sync.Mutex
+	byHost map[string]netip.Addr
+	byIP   map[netip.Addr]string
+	next   netip.Addr // 下一个分配的地址（零值表示从地址段开头分配）
+}
+
+// assign 为 host 分配假 IP（已分配过的直接返回）
+func (p *fakeIPPool) assign(host string) netip.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ip, ok := p.byHost[host]; ok {
+		return ip
+	}
+	if p.byHost == nil {
+		p.byHost = make(map[string]netip.Addr)
+		p.byIP = make(map[netip.Addr]string)
+	}
+	// 跳过网络地址与广播地址
+	ip := p.next
+	if !fakeIPRange.Contains(ip) || ip == lastAddr(fakeIPRange) {
+		ip = fakeIPRange.Addr().Next()
+	}
+	p.next = ip.Next()
+
+	if old, ok := p.byIP[ip]; ok {
+		delete(p.byHost, old)
+	}
+	p.byHost[host] = ip
+	p.byIP[ip] = host
+	return ip
+}
+
+// lookup 假 IP 对应的域名
+func (p *fakeIPPool) lookup(ip netip.Addr) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	host, ok := p.byIP[ip]
+	return host, ok
+}
+
+// lastAddr 地址段的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As4()
+	bits := prefix.Bits()
+	for i := range b {
+		if keep := bits - i*8; keep < 8 {
+			b[i] |= byte(0xFF >> max(keep, 0))
+		}
+	}
+	return netip.AddrFrom4(b)
+}
+
+// SetFakeIP 开启/关闭假 IP 应答（tun 包模式下由 SDK 开启，可在运行中切换）
+// 开启后本地 DNS 服务对应走代理的域名的 A 查询回复 198.18.0.0/15 内的假 IP（AAAA 回复空结果，让应用使用 IPv4），
+// 其余查询都经隧道解析（包模式下直连的查询会重新进入 tun）；DialUDP 发往 53 端口的会话也由本地 DNS 服务应答。
+// 连接假 IP 时还原为域名交给节点解析，关闭后已分配的映射仍然有效
+func (c *Client) SetFakeIP(enabled bool) {
+	c.fakeIP.Store(enabled)
+}
+
+// realTarget 目标是已分配的假 IP 时还原为 域名:端口，其他目标原样返回
+func (c *Client) realTarget(target string) string {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !fakeIPRange.Contains(ip) {
+		return target
+	}
+	if domain, ok := c.fakeIPs.lookup(ip); ok {
+		return net.JoinHostPort(domain, port)
+	}
+	return target
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+
+	"uap-quic/pkg/target"
+)
+
+// 隧道内域名目标的地址族偏好（由服务端解析域名，偏好决定先连接哪个地址族）
+const (
+	FamilyAuto = "auto" // 不指定（默认，由服务端决定）
+	FamilyIPv4 = "ipv4" // 优先 IPv4，失败再试 IPv6
+	FamilyIPv6 = "ipv6" // 优先 IPv6，失败再试 IPv4
+)
+
+// SetPreferFamily 设置隧道内域名目标的地址族偏好（FamilyAuto / FamilyIPv4 / FamilyIPv6）
+// 需服务端支持结构化转发目标，旧版服务端忽略；可在运行中切换，对之后新建的 TCP 连接生效
+func (c *Client) SetPreferFamily(family string) error {
+	if err := CheckPreferFamily(family); err != nil {
+		return err
+	}
+	c.preferFamily.Store(family)
+	return nil
+}
+
+// CheckPreferFamily 校验地址族偏好
+func CheckPreferFamily(family string) error {
+	switch family {
+	case FamilyAuto, FamilyIPv4, FamilyIPv6:
+		return nil
+	}
+	return fmt.Errorf("未知的地址族偏好: %q（可选 %s / %s / %s）", family, FamilyAuto, FamilyIPv4, FamilyIPv6)
+}
+
+// preferredFamily 当前的地址族偏好
+func (c *Client) preferredFamily() string {
+	if family, ok := c.preferFamily.Load().(string); ok {
+		return family
+	}
+	return FamilyAuto
+}
+
+// familyFlags 当前地址族偏好对应的转发标志
+func (c *Client) familyFlags() target.Flags {
+	switch c.preferredFamily() {
+	case FamilyIPv4:
+		return target.FlagPreferIPv4
+	case FamilyIPv6:
+		return target.FlagPreferIPv6
+	}
+	return 0
+}
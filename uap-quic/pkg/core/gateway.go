@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"net"
+)
+
+// DefaultListenHost 默认的 SOCKS5 监听地址（只接受本机连接）
+const DefaultListenHost = "127.0.0.1"
+
+// SetListenHost 设置 SOCKS5 监听地址（IP），空字符串恢复默认的 127.0.0.1
+// 网关模式（局域网内其他设备共用代理）设为 0.0.0.0 或局域网网卡地址；在 Start 之前调用
+func (c *Client) SetListenHost(host string) error {
+	host, err := ParseListenHost(host)
+	if err != nil {
+		return err
+	}
+	c.listenHost = host
+	return nil
+}
+
+// ParseListenHost 校验 SOCKS5 监听地址，空字符串返回默认值
+func ParseListenHost(host string) (string, error) {
+	if host == "" {
+		return DefaultListenHost, nil
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("监听地址必须是 IP: %q", host)
+	}
+	return host, nil
+}
+
+// SetAdvertiseAddr 设置 UDP ASSOCIATE 回复中告知应用的地址（IP 或域名，不含端口），空字符串表示自动
+// 自动时回复控制连接到达的本机地址（网关模式下即应用访问的局域网地址）；
+// 应用经端口映射、容器网络等访问网关，本机地址对其不可达时设置为应用可达的地址，UDP 端口随之监听在监听地址上
+func (c *Client) SetAdvertiseAddr(host string) error {
+	if err := CheckAdvertiseAddr(host); err != nil {
+		return err
+	}
+	c.advertiseAddr = host
+	return nil
+}
+
+// CheckAdvertiseAddr 校验 UDP 关联的通告地址（IP 或域名，不含端口，空字符串表示自动）
+func CheckAdvertiseAddr(host string) error {
+	if len(host) > 255 {
+		return fmt.Errorf("通告地址过长: %d 字节", len(host))
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return fmt.Errorf("通告地址不能包含端口: %q", host)
+	}
+	return nil
+}
+
+// udpAssociateAddr UDP 关联的监听 IP 与回复给应用的地址
+// 未设置通告地址时两者都是控制连接到达的本机地址：回环监听时为 127.0.0.1，网关模式下为应用访问的网卡地址
+func (c *Client) udpAssociateAddr(clientConn net.Conn) (net.IP, string) {
+	if c.advertiseAddr != "" {
+		return net.ParseIP(c.listenHost), c.advertiseAddr
+	}
+	if local, ok := clientConn.LocalAddr().(*net.TCPAddr); ok && !local.IP.IsUnspecified() {
+		if ip4 := local.IP.To4(); ip4 != nil {
+			return ip4, ip4.String()
+		}
+		return local.IP, local.IP.String()
+	}
+	return net.IPv4(127, 0, 0, 1), DefaultListenHost
+}
+
+// udpFromApp UDP 包是否来自发起关联的应用（与控制连接同一 IP）
+// 网关模式下 UDP 端口对局域网开放，其他主机发来的包一律丢弃，防止冒充应用劫持回包
+func udpFromApp(clientConn net.Conn, addr *net.UDPAddr) bool {
+	remote, ok := clientConn.RemoteAddr().(*net.TCPAddr)
+	return !ok || remote.IP.Equal(addr.IP)
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addrConn 指定本端与对端地址的连接（模拟网关模式下从局域网到达的控制连接）
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+// gatewayConn 本端地址为 local、对端地址为 remote 的控制连接
+func gatewayConn(local, remote string) net.Conn {
+	l, _ := net.ResolveTCPAddr("tcp", local)
+	r, _ := net.ResolveTCPAddr("tcp", remote)
+	return addrConn{local: l, remote: r}
+}
+
+// nonLoopbackIPv4 本机任一非回环 IPv4 地址（没有时返回 nil）
+func nonLoopbackIPv4() net.IP {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4()
+		}
+	}
+	return nil
+}
+
+func TestUDPAssociateAddr(t *testing.T) {
+	c := NewClient("", "", 0, ModeGlobal)
+	cases := []struct {
+		name      string
+		local     string
+		bind      string
+		replyHost string
+	}{
+		{"本机回环", "127.0.0.1:1080", "127.0.0.1", "127.0.0.1"},
+		{"网关模式：局域网地址", "192.168.1.10:1080", "192.168.1.10", "192.168.1.10"},
+		{"IPv4 映射地址", "[::ffff:192.168.1.10]:1080", "192.168.1.10", "192.168.1.10"},
+		{"IPv6 局域网地址", "[fd00::10]:1080", "fd00::10", "fd00::10"},
+		{"未指定地址", "0.0.0.0:1080", "127.0.0.1", "127.0.0.1"},
+	}
+	for _, tc := range cases {
+		bind, reply := c.udpAssociateAddr(gatewayConn(tc.local, "192.168.1.20:50000"))
+		if bind.String() != tc.bind || reply != tc.replyHost {
+			t.Errorf("%s: 监听 %v 回复 %s，期望 %s / %s", tc.name, bind, reply, tc.bind, tc.replyHost)
+		}
+	}
+
+	// 设置通告地址：监听在监听地址上，回复通告地址
+	if err := c.SetListenHost("0.0.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetAdvertiseAddr("gw.lan"); err != nil {
+		t.Fatal(err)
+	}
+	if bind, reply := c.udpAssociateAddr(gatewayConn("192.168.1.10:1080", "192.168.1.20:50000")); !bind.IsUnspecified() || reply != "gw.lan" {
+		t.Fatalf("设置通告地址后监听 %v 回复 %s", bind, reply)
+	}
+}
+
+func TestUDPAssociateReplyGateway(t *testing.T) {
+	ip := nonLoopbackIPv4()
+	if ip == nil {
+		t.Skip("没有非回环的 IPv4 地址")
+	}
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	if err := c.SetListenHost("0.0.0.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 应用经局域网地址连接网关：回复的 BND 是该地址而不是回环地址，且 UDP 端口在该地址上可达
+	reply := associateVia(t, c, ip)
+	if reply[3] != 0x01 || !net.IP(reply[4:8]).Equal(ip) {
+		t.Fatalf("关联回复 %x，期望 BND 为 %s", reply, ip)
+	}
+	port := int(reply[8])<<8 | int(reply[9])
+	probe, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe.Close()
+
+	// 设置通告域名：回复 ATYP=0x03 的域名地址
+	c.SetAdvertiseAddr("gw.lan")
+	reply = associateVia(t, c, ip)
+	if reply[3] != 0x03 || string(reply[5:5+reply[4]]) != "gw.lan" {
+		t.Fatalf("设置通告域名后的关联回复 %x", reply)
+	}
+}
+
+// associateVia 经本机 ip 上的控制连接调用 handleUDPAssociate，返回关联回复
+func associateVia(t testing.TB, c *Client, ip net.IP) []byte {
+	t.Helper()
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	app, err := net.DialTCP("tcp", nil, ln.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Close() })
+	ctrl, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ctrl.Close() })
+	go c.handleUDPAssociate(ctrl)
+
+	app.SetReadDeadline(time.Now().Add(5 * time.Second))
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(app, head); err != nil || head[1] != 0x00 {
+		t.Fatalf("读取关联回复失败: %x %v", head, err)
+	}
+	// 已读的 head[4] 是 IPv4 地址的首字节或域名长度，之后是地址其余部分与 2 字节端口
+	var rest int
+	switch head[3] {
+	case 0x01:
+		rest = 3 + 2
+	case 0x03:
+		rest = int(head[4]) + 2
+	default:
+		t.Fatalf("关联回复的地址类型 0x%02x", head[3])
+	}
+	tail := make([]byte, rest)
+	if _, err := io.ReadFull(app, tail); err != nil {
+		t.Fatal(err)
+	}
+	return append(head, tail...)
+}
+
+func TestUDPFromApp(t *testing.T) {
+	ctrl := gatewayConn("192.168.1.10:1080", "192.168.1.20:50000")
+	if !udpFromApp(ctrl, &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 40000}) {
+		t.Fatal("来自应用所在主机的 UDP 包被丢弃")
+	}
+	if udpFromApp(ctrl, &net.UDPAddr{IP: net.ParseIP("192.168.1.30"), Port: 40000}) {
+		t.Fatal("来自局域网其他主机的 UDP 包被放行")
+	}
+}
+
+func TestGatewayAddrValidation(t *testing.T) {
+	if host, err := ParseListenHost(""); err != nil || host != DefaultListenHost {
+		t.Fatalf("空监听地址返回 %q %v", host, err)
+	}
+	for _, host := range []string{"localhost", "0.0.0.0:1080", "lan"} {
+		if _, err := ParseListenHost(host); err == nil {
+			t.Errorf("ParseListenHost(%q) 应返回错误", host)
+		}
+	}
+	for _, host := range []string{"gw.lan:1080", "[::1]:53", strings.Repeat("a", 256)} {
+		if err := CheckAdvertiseAddr(host); err == nil {
+			t.Errorf("CheckAdvertiseAddr(%q) 应返回错误", host)
+		}
+	}
+	for _, host := range []string{"", "gw.lan", "192.168.1.10", "fd00::10"} {
+		if err := CheckAdvertiseAddr(host); err != nil {
+			t.Errorf("CheckAdvertiseAddr(%q): %v", host, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// errCodeReconnect 节点因连接达到最长时长或维护模式排空而关闭连接的关闭码（与服务端一致，HTTP/3 的 H3_NO_ERROR）
+const errCodeReconnect = 0x100
+
+// goAwayMsg 节点在单向流上发送的换连通知（与服务端一致）
+const goAwayMsg = 0x01
+
+// goAwayReadTimeout 读取换连通知的超时
+const goAwayReadTimeout = 5 * time.Second
+
+// watchGoAway 监听节点的换连通知（连接建立后启动，连接关闭时退出）
+// 收到通知时建立新连接，之后的新流走新连接，旧连接上进行中的流继续，由节点排空后关闭；
+// 连接以 errCodeReconnect 关闭时（错过通知或换连失败）立即重连，不等断线重连守护的下一轮检查
+func (c *Client) watchGoAway(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptUniStream(conn.Context())
+		if err != nil {
+			break
+		}
+		stream.SetReadDeadline(time.Now().Add(goAwayReadTimeout))
+		msg := make([]byte, 1)
+		_, err = io.ReadFull(stream, msg)
+		stream.CancelRead(0)
+		if err == nil && msg[0] == goAwayMsg {
+			c.replaceConnection(conn, "🔄 节点要求换连（连接达到最长时长或节点维护），建立新连接")
+		}
+	}
+
+	var appErr *quic.ApplicationError
+	if errors.As(context.Cause(conn.Context()), &appErr) && appErr.Remote && appErr.ErrorCode == errCodeReconnect {
+		c.replaceConnection(conn, "🔄 节点关闭了连接（连接达到最长时长或节点维护），立即重连")
+	}
+	// 没有被新连接替换（意外断开，或换连失败）时通知宿主
+	c.disconnectedEvent(conn)
+}
+
+// replaceConnection conn 仍是当前连接时打印 reason 并建立新连接替换它（不关闭 conn）
+// 已经换过连接时不做任何事；失败时保留 conn，由断线重连守护继续重试
+func (c *Client) replaceConnection(conn quic.Connection, reason string) {
+	c.quicConnLock.Lock()
+	defer c.quicConnLock.Unlock()
+	if c.quicConn != conn || c.ctx.Err() != nil {
+		return
+	}
+	log.Println(reason)
+	if err := c.reconnectQuic(); err != nil {
+		log.Printf("❌ 换连失败: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"log"
+	"net"
+
+	"uap-quic/pkg/router"
+)
+
+// SetHosts 设置 hosts 覆盖表（nil 表示清除），可在运行中替换，对之后新建的连接生效
+// 命中的域名仍按原域名分流；走代理时隧道中发送覆盖 IP 而不是域名，直连时直接拨号覆盖 IP
+func (c *Client) SetHosts(h *router.Hosts) {
+	c.hosts.Store(h)
+	if h.Len() > 0 {
+		log.Printf("✅ hosts 覆盖已生效，条目数: %d", h.Len())
+	}
+}
+
+// applyHosts 按 hosts 覆盖表改写目标地址 (host:port)
+// 命中时返回改写后的地址和说明（"域名 → IP (命中条目)"，用于分流日志），否则原样返回
+func (c *Client) applyHosts(target string) (string, string) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return target, ""
+	}
+	ip, entry, ok := c.hosts.Load().Lookup(host)
+	if !ok {
+		return target, ""
+	}
+	return net.JoinHostPort(ip.String(), port), host + " → " + ip.String() + " (hosts: " + entry + ")"
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+
+	"uap-quic/pkg/router"
+)
+
+func TestApplyHosts(t *testing.T) {
+	c := NewClient("", "", 0, ModeSmart)
+	h, err := router.ParseHosts("10.0.0.1 staging.example.com\n2001:db8::1 *.v6.example.com\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetHosts(h)
+
+	cases := map[string][2]string{
+		"staging.example.com:443": {"10.0.0.1:443", "staging.example.com → 10.0.0.1 (hosts: staging.example.com)"},
+		"api.v6.example.com:80":   {"[2001:db8::1]:80", "api.v6.example.com → 2001:db8::1 (hosts: *.v6.example.com)"},
+		"other.example.com:443":   {"other.example.com:443", ""},
+		"10.0.0.2:443":            {"10.0.0.2:443", ""},
+		"no-port":                 {"no-port", ""},
+	}
+	for target, want := range cases {
+		if addr, note := c.applyHosts(target); addr != want[0] || note != want[1] {
+			t.Errorf("applyHosts(%q) = %q, %q，期望 %q, %q", target, addr, note, want[0], want[1])
+		}
+	}
+
+	// 分流诊断说明覆盖去向，分流仍按原域名判断
+	d := c.TestRoute("staging.example.com:443")
+	if d.Hosts != cases["staging.example.com:443"][1] || d.Host != "staging.example.com" || d.Action != RouteDirect {
+		t.Fatalf("TestRoute 返回 %+v", d)
+	}
+	if err := c.SetMode(ModeGlobal); err != nil {
+		t.Fatal(err)
+	}
+	if d := c.TestRoute("staging.example.com"); d.Action != RouteProxy || d.Hosts == "" {
+		t.Fatalf("global 模式下 TestRoute 返回 %+v", d)
+	}
+
+	// 运行中替换：清除后不再覆盖
+	c.SetHosts(nil)
+	if addr, note := c.applyHosts("staging.example.com:443"); addr != "staging.example.com:443" || note != "" {
+		t.Fatalf("清除覆盖后 applyHosts 返回 %q, %q", addr, note)
+	}
+	if d := c.TestRoute("staging.example.com"); d.Hosts != "" {
+		t.Fatalf("清除覆盖后 TestRoute 返回 %+v", d)
+	}
+}
@@ -0,0 +1,40 @@
+package core
+
+import "time"
+
+// DefaultIdleTimeout QUIC 连接的空闲超时：这段时间内没有收到对端的任何包（包括保活包的确认）即判定连接已断开，
+// conn.Context() 随之结束，monitorConnection 在下一轮检查时重连；两端取较小的一方
+const DefaultIdleTimeout = 45 * time.Second
+
+// MinIdleTimeout 空闲超时的下限（过短时一次短暂的网络抖动就会断开连接）
+const MinIdleTimeout = 5 * time.Second
+
+// maxKeepAlivePeriod 保活包的最长间隔（同时让 NAT 映射保持存活）
+const maxKeepAlivePeriod = 10 * time.Second
+
+// KeepAlivePeriod 空闲超时对应的保活间隔：不超过空闲超时的 1/3，丢失一两个保活包不会误判断开
+func KeepAlivePeriod(idle time.Duration) time.Duration {
+	return min(maxKeepAlivePeriod, idle/3)
+}
+
+// SetIdleTimeout 设置 QUIC 连接的空闲超时，<= 0 恢复默认值 DefaultIdleTimeout，小于 MinIdleTimeout 时按 MinIdleTimeout
+// 路径中断（没有任何回包）后，quic-go 从下一个没有得到回应的保活包开始计时，最迟在空闲超时加一个保活间隔
+// （不超过空闲超时的 4/3）后判定断开并开始重连；保活间隔随之调整（见 KeepAlivePeriod）。
+// 可在运行中设置，对之后建立的连接生效
+func (c *Client) SetIdleTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	if d > 0 && d < MinIdleTimeout {
+		d = MinIdleTimeout
+	}
+	c.idleTimeout.Store(int64(d))
+}
+
+// IdleTimeout 当前生效的空闲超时
+func (c *Client) IdleTimeout() time.Duration {
+	if d := time.Duration(c.idleTimeout.Load()); d > 0 {
+		return d
+	}
+	return DefaultIdleTimeout
+}
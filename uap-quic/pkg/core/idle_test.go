@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetIdleTimeout(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	if c.IdleTimeout() != DefaultIdleTimeout {
+		t.Fatalf("默认空闲超时 %v", c.IdleTimeout())
+	}
+	for _, tc := range []struct{ set, want time.Duration }{
+		{20 * time.Second, 20 * time.Second},
+		{time.Second, MinIdleTimeout},
+		{0, DefaultIdleTimeout},
+		{-time.Second, DefaultIdleTimeout},
+	} {
+		c.SetIdleTimeout(tc.set)
+		if got := c.IdleTimeout(); got != tc.want {
+			t.Errorf("SetIdleTimeout(%v) 后 %v，期望 %v", tc.set, got, tc.want)
+		}
+	}
+	c.SetIdleTimeout(20 * time.Second)
+	if s := c.ConfigSnapshot(); s.IdleTimeout != "20s" {
+		t.Fatalf("诊断快照的空闲超时 %q", s.IdleTimeout)
+	}
+}
+
+// TestKeepAlivePeriod 保活间隔不超过空闲超时的 1/3，最长 maxKeepAlivePeriod
+func TestKeepAlivePeriod(t *testing.T) {
+	for idle, want := range map[time.Duration]time.Duration{
+		MinIdleTimeout:     MinIdleTimeout / 3,
+		15 * time.Second:   5 * time.Second,
+		DefaultIdleTimeout: maxKeepAlivePeriod,
+		time.Hour:          maxKeepAlivePeriod,
+	} {
+		if got := KeepAlivePeriod(idle); got != want {
+			t.Errorf("KeepAlivePeriod(%v) = %v，期望 %v", idle, got, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package core
+
+import "fmt"
+
+// 代理模式
+const (
+	ModeSmart  = "smart"  // 按规则分流（白名单内走代理）
+	ModeGlobal = "global" // 全部走代理（本机地址除外）
+)
+
+// SetMode 切换代理模式（ModeSmart / ModeGlobal），可在运行中切换，对之后新建的连接生效
+func (c *Client) SetMode(mode string) error {
+	if err := CheckMode(mode); err != nil {
+		return err
+	}
+	c.mode.Store(mode)
+	return nil
+}
+
+// CheckMode 校验代理模式
+func CheckMode(mode string) error {
+	switch mode {
+	case ModeSmart, ModeGlobal:
+		return nil
+	}
+	return fmt.Errorf("未知的代理模式: %q（可选 %s / %s）", mode, ModeSmart, ModeGlobal)
+}
+
+// Mode 当前的代理模式（NewClient 传入的模式不做校验，除 ModeGlobal 外都按 ModeSmart 分流）
+func (c *Client) Mode() string {
+	mode, _ := c.mode.Load().(string)
+	return mode
+}
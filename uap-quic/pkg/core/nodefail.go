@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 节点连接失败的原因：节点能测速（TCP 可达）但 QUIC 握手或鉴权失败时，多半是节点配置错误，
+// 客户端按节点记录失败原因（GetStats 与选路结果输出，SDK 随连接结果上报给管理后台）
+const (
+	NodeFailTLSVerify = "tls-verify" // 证书校验失败：证书过期、域名不符或签发者不受信任
+	NodeFailALPN      = "alpn"       // ALPN 协商失败：两端信任模式不一致（见 SetTrusted）
+	NodeFailTimeout   = "timeout"    // 握手超时：UDP 被丢弃或节点进程未监听
+	NodeFailDNS       = "dns"        // 节点域名解析失败
+	NodeFailAuth      = "auth"       // 握手成功，但节点拒绝了鉴权凭证
+	NodeFailOther     = "other"
+)
+
+// maxNodeFailures 最多记录的节点数，满时淘汰最早失败的节点
+const maxNodeFailures = 32
+
+// TLS 告警中表示证书校验失败的告警码（RFC 8446 6.2），QUIC 错误码为 0x100 + 告警码
+var certAlerts = map[quic.TransportErrorCode]bool{
+	0x100 + 42: true, // bad_certificate
+	0x100 + 43: true, // unsupported_certificate
+	0x100 + 44: true, // certificate_revoked
+	0x100 + 45: true, // certificate_expired
+	0x100 + 46: true, // certificate_unknown
+	0x100 + 48: true, // unknown_ca
+}
+
+// ClassifyNodeError 连接节点失败的原因（NodeFail*），err 为 nil 时返回空
+// 本地证书校验失败时 quic-go 返回包装了 tls.CertificateVerificationError 的 TransportError，
+// 节点拒绝客户端时只有告警码，两种情况都归为 tls-verify
+func ClassifyNodeError(err error) string {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var te *quic.TransportError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrAuthRejected):
+		return NodeFailAuth
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostname), errors.As(err, &invalid),
+		errors.As(err, &te) && certAlerts[te.ErrorCode]:
+		return NodeFailTLSVerify
+	case trustedMismatch(err):
+		return NodeFailALPN
+	case errors.As(err, &dnsErr):
+		return NodeFailDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return NodeFailTimeout
+	}
+	return NodeFailOther
+}
+
+// NodeFailure 一个最近连接失败、尚未恢复的节点（GetStats 与选路结果输出）
+type NodeFailure struct {
+	Address     string    `json:"address"`      // 节点地址（与 SetServerAddr 一致）
+	Reason      string    `json:"reason"`       // NodeFail*
+	Error       string    `json:"error"`        // 最近一次失败的错误
+	Failures    int       `json:"failures"`     // 恢复前的累计失败次数
+	LastFailure time.Time `json:"last_failure"` // 最近一次失败的时间
+}
+
+// nodeFailureTable 各节点最近的连接失败（键为节点地址），零值可用；连接并鉴权成功后清除
+type nodeFailureTable struct {
+	mu      sync.Mutex
+	entries map[string]*NodeFailure
+}
+
+// record 记录一次失败，返回失败原因
+func (t *nodeFailureTable) record(addr string, err error, now time.Time) string {
+	reason := ClassifyNodeError(err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = make(map[string]*NodeFailure)
+	}
+	f := t.entries[addr]
+	if f == nil {
+		if len(t.entries) >= maxNodeFailures {
+			t.evictOldest()
+		}
+		f = &NodeFailure{Address: addr}
+		t.entries[addr] = f
+	}
+	f.Reason = reason
+	f.Error = err.Error()
+	f.Failures++
+	f.LastFailure = now
+	return reason
+}
+
+// evictOldest 淘汰最早失败的节点（调用方持有锁）
+func (t *nodeFailureTable) evictOldest() {
+	var oldest *NodeFailure
+	for _, f := range t.entries {
+		if oldest == nil || f.LastFailure.Before(oldest.LastFailure) {
+			oldest = f
+		}
+	}
+	if oldest != nil {
+		delete(t.entries, oldest.Address)
+	}
+}
+
+// clear 节点恢复后清除记录
+func (t *nodeFailureTable) clear(addr string) {
+	t.mu.Lock()
+	delete(t.entries, addr)
+	t.mu.Unlock()
+}
+
+// get 节点最近的失败（没有失败时返回 nil）
+func (t *nodeFailureTable) get(addr string) *NodeFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f := t.entries[addr]; f != nil {
+		copied := *f
+		return &copied
+	}
+	return nil
+}
+
+// snapshot 所有失败的节点（最近失败的在前）
+func (t *nodeFailureTable) snapshot() []NodeFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]NodeFailure, 0, len(t.entries))
+	for _, f := range t.entries {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastFailure.After(out[j].LastFailure) })
+	return out
+}
+
+// nodeFailed 记录当前节点的一次连接失败
+func (c *Client) nodeFailed(err error) {
+	addr := c.ServerAddr()
+	if reason := c.nodeFailures.record(addr, err, time.Now()); reason == NodeFailTLSVerify || reason == NodeFailALPN {
+		log.Printf("⚠️  节点 %s 握手失败 (%s)，节点配置可能有误", addr, reason)
+	}
+}
+
+// NodeFailure 节点最近一次尚未恢复的连接失败（连接并鉴权成功后清除，没有失败时返回 nil）
+func (c *Client) NodeFailure(addr string) *NodeFailure {
+	return c.nodeFailures.get(addr)
+}
+
+// NodeFailures 所有最近连接失败、尚未恢复的节点（最近失败的在前）
+func (c *Client) NodeFailures() []NodeFailure {
+	return c.nodeFailures.snapshot()
+}
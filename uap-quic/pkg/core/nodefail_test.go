@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestClassifyNodeError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"成功", nil, ""},
+		{"鉴权被拒", fmt.Errorf("验证隧道: %w", ErrAuthRejected), NodeFailAuth},
+		{"本地证书校验失败", &quic.TransportError{ErrorCode: 0x100 + 42}, NodeFailTLSVerify},
+		{"证书签发者不受信任", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, NodeFailTLSVerify},
+		{"证书域名不符", fmt.Errorf("dial: %w", x509.HostnameError{Host: "other.example"}), NodeFailTLSVerify},
+		{"证书过期", x509.CertificateInvalidError{Reason: x509.Expired}, NodeFailTLSVerify},
+		{"节点回复 unknown_ca", &quic.TransportError{Remote: true, ErrorCode: 0x100 + 48}, NodeFailTLSVerify},
+		{"节点回复 certificate_expired", &quic.TransportError{Remote: true, ErrorCode: 0x100 + 45}, NodeFailTLSVerify},
+		{"ALPN 协商失败", &quic.TransportError{Remote: true, ErrorCode: tlsAlertNoApplicationProtocol}, NodeFailALPN},
+		{"其他 TLS 告警", &quic.TransportError{Remote: true, ErrorCode: 0x100 + 40}, NodeFailOther},
+		{"域名解析失败", &net.DNSError{Err: "no such host", Name: "node.invalid", IsNotFound: true}, NodeFailDNS},
+		{"握手超时", &quic.IdleTimeoutError{}, NodeFailTimeout},
+		{"拨号超时", fmt.Errorf("拨号: %w", context.DeadlineExceeded), NodeFailTimeout},
+		{"其他", errors.New("connection refused"), NodeFailOther},
+	} {
+		if got := ClassifyNodeError(tc.err); got != tc.want {
+			t.Errorf("%s: ClassifyNodeError(%v) = %q，期望 %q", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestNodeFailureTable(t *testing.T) {
+	var table nodeFailureTable
+	if table.get("a:443") != nil || len(table.snapshot()) != 0 {
+		t.Fatal("零值的记录表不为空")
+	}
+
+	now := time.Now()
+	table.record("a:443", &quic.IdleTimeoutError{}, now)
+	if reason := table.record("a:443", ErrAuthRejected, now.Add(time.Second)); reason != NodeFailAuth {
+		t.Fatalf("失败原因 %q", reason)
+	}
+	table.record("b:443", errors.New("x"), now.Add(2*time.Second))
+	f := table.get("a:443")
+	if f == nil || f.Reason != NodeFailAuth || f.Failures != 2 || f.Error != ErrAuthRejected.Error() || !f.LastFailure.Equal(now.Add(time.Second)) {
+		t.Fatalf("节点 a 的失败记录 %+v", f)
+	}
+	f.Failures = 100
+	if table.get("a:443").Failures != 2 {
+		t.Fatal("get 返回的记录与记录表共用")
+	}
+	if s := table.snapshot(); len(s) != 2 || s[0].Address != "b:443" {
+		t.Fatalf("快照 %+v，期望最近失败的在前", s)
+	}
+
+	table.clear("a:443")
+	if table.get("a:443") != nil {
+		t.Fatal("恢复后仍有失败记录")
+	}
+
+	// 满时淘汰最早失败的节点
+	for i := 0; i < maxNodeFailures; i++ {
+		table.record(fmt.Sprintf("n%d:443", i), errors.New("x"), now.Add(time.Duration(10+i)*time.Second))
+	}
+	if n := len(table.snapshot()); n != maxNodeFailures {
+		t.Fatalf("记录了 %d 个节点", n)
+	}
+	if table.get("b:443") != nil || table.get("n0:443") == nil {
+		t.Fatal("没有淘汰最早失败的节点")
+	}
+}
+
+// connectFailure 连接节点失败后客户端记录的节点失败
+func connectFailure(t *testing.T, c *Client) *NodeFailure {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err == nil {
+		t.Fatal("连接成功")
+	}
+	f := c.NodeFailure(c.ServerAddr())
+	if f == nil {
+		t.Fatal("没有记录节点失败")
+	}
+	if len(c.GetStats(0).NodeFailures) != 1 {
+		t.Fatalf("统计中的节点失败 %+v", c.GetStats(0).NodeFailures)
+	}
+	return f
+}
+
+// listenNode 在本机启动只完成握手的 QUIC 节点（证书为自签名，不受客户端信任）
+func listenNode(t *testing.T, alpn string) string {
+	t.Helper()
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		NextProtos:   []string{alpn},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+// TestNodeFailureReasons 真实握手失败时按原因记录：证书不受信任、信任模式不一致、域名解析失败、握手超时
+func TestNodeFailureReasons(t *testing.T) {
+	t.Run("tls-verify", func(t *testing.T) {
+		c := NewClient(listenNode(t, "h3"), "token", 0, ModeGlobal)
+		t.Cleanup(c.Stop)
+		if f := connectFailure(t, c); f.Reason != NodeFailTLSVerify {
+			t.Fatalf("失败记录 %+v", f)
+		}
+	})
+
+	t.Run("alpn", func(t *testing.T) {
+		c := NewClient(listenNode(t, "h3"), "", 0, ModeGlobal)
+		c.SetTrusted(true)
+		t.Cleanup(c.Stop)
+		if f := connectFailure(t, c); f.Reason != NodeFailALPN {
+			t.Fatalf("失败记录 %+v", f)
+		}
+	})
+
+	t.Run("dns", func(t *testing.T) {
+		c, r := newResolveClient(t, "node.invalid:443")
+		r.set(&net.DNSError{Err: "no such host", Name: "node.invalid", IsNotFound: true})
+		if f := connectFailure(t, c); f.Reason != NodeFailDNS || f.Address != "node.invalid:443" {
+			t.Fatalf("失败记录 %+v", f)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("等待握手超时")
+		}
+		// 只接收不回复的 UDP 端口（模拟节点进程未监听、UDP 被丢弃）
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		c := NewClient(conn.LocalAddr().String(), "token", 0, ModeGlobal)
+		t.Cleanup(c.Stop)
+		f := connectFailure(t, c)
+		if f.Reason != NodeFailTimeout || f.Failures != 1 {
+			t.Fatalf("失败记录 %+v", f)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DefaultNodeWeight 节点未下发权重（旧版管理端）时使用的默认权重
+const DefaultNodeWeight = 100
+
+// DefaultSelectTolerance 默认选路容差：延迟与最快节点相差在此范围内的节点按权重挑选
+const DefaultSelectTolerance = 30 * time.Millisecond
+
+// 节点质量评分（管理后台综合拨测、客户端测速与负载计算，0-100）
+// 选路时评分每低 1 分，节点的排序延迟增加 scorePenalty（评分 50 的节点相当于慢 150ms）
+const (
+	MaxNodeScore = 100
+	scorePenalty = 3 * time.Millisecond
+)
+
+// Node 管理后台下发的节点（SDK 与命令行客户端共用的选路数据）
+type Node struct {
+	Name    string        `json:"name"`
+	Address string        `json:"address"`
+	Weight  int           `json:"weight"` // 运营方设置的选路权重（越大越优先）
+	Score   *int          `json:"score"`  // 管理后台计算的质量评分（旧版管理端不下发）
+	Pinned  bool          `json:"pinned"` // 当前账户的固定节点（粘性选路时下发）
+	Latency time.Duration `json:"-"`      // 延迟（不序列化到 JSON）
+	Probed  bool          `json:"-"`      // 是否完成测速（提前结束或取消时被放弃的节点为 false）
+}
+
+// FetchNodes 从管理后台的节点接口 (url) 获取节点列表
+// 管理后台返回业务错误时返回 *APIError，网络等其他错误返回普通 error；列表为空视为错误
+func FetchNodes(ctx context.Context, url string, token string) ([]Node, error) {
+	// 构建请求
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	// 设置 Authorization 与客户端版本号 Header
+	SetAPIHeaders(req, token)
+
+	// 发送请求
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second, // 设置超时
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	// 解析 JSON（错误响应同样是统一信封）
+	var apiResp struct {
+		Code  int    `json:"code"`
+		Error string `json:"error,omitempty"`
+		Data  []Node `json:"data"`
+		Msg   string `json:"msg,omitempty"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("解析 JSON 失败: %w, 响应: %s", err, string(body))
+	}
+
+	// 检查状态码
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("节点接口: %w", ParseAPIError(resp.StatusCode, apiResp.Code, apiResp.Error, apiResp.Msg))
+	}
+
+	// 检查节点列表是否为空
+	if len(apiResp.Data) == 0 {
+		return nil, fmt.Errorf("节点列表为空")
+	}
+
+	return apiResp.Data, nil
+}
+
+// PingNodes 并发测速节点并按评分修正后的延迟排序（从小到大）
+// ctx 取消时放弃其余测速并返回
+func PingNodes(ctx context.Context, nodes []Node, opts PingOptions) []Node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPingConcurrency
+	}
+	log.Printf("🚀 开始测速，共 %d 个节点（并发 %d）...", len(nodes), concurrency)
+
+	// 按管理后台返回的顺序测速（固定节点在首位），提前结束时靠前的节点一定已测速
+	addrs := make([]string, len(nodes))
+	for i := range nodes {
+		addrs[i] = nodes[i].Address
+	}
+	for i, result := range PingAddrsContext(ctx, addrs, opts) {
+		nodes[i].Latency = result.Latency
+		nodes[i].Probed = result.Probed
+	}
+
+	// 根据评分修正后的延迟排序（从小到大）
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return RankLatency(nodes[i]) < RankLatency(nodes[j])
+	})
+
+	// 打印测速结果
+	log.Printf("[测速结果]")
+	for _, node := range nodes {
+		if !node.Probed {
+			log.Printf("  %s: 未测速（已提前结束）", node.Name)
+		} else if node.Latency == Unreachable {
+			log.Printf("  %s: 超时/失败", node.Name)
+		} else {
+			latencyMs := node.Latency.Round(time.Millisecond)
+			log.Printf("  %s: %v (评分 %d)", node.Name, latencyMs, NodeScore(node))
+		}
+	}
+
+	return nodes
+}
+
+// SelectNode 从按修正延迟排序后的节点中选路
+// 修正延迟与最优节点相差不超过 tolerance 的节点视为同一档，其中权重最高者胜出（同权重取排序靠前的）
+// 所有节点都不可达时返回 false
+func SelectNode(nodes []Node, tolerance time.Duration) (Node, bool) {
+	if len(nodes) == 0 || nodes[0].Latency == Unreachable {
+		return Node{}, false
+	}
+
+	best := nodes[0]
+	for _, n := range nodes[1:] {
+		if n.Latency == Unreachable || RankLatency(n)-RankLatency(nodes[0]) > tolerance {
+			break
+		}
+		if NodeWeight(n) > NodeWeight(best) {
+			best = n
+		}
+	}
+	return best, true
+}
+
+// RankLatency 选路排序使用的延迟：客户端实测延迟按管理后台的质量评分加罚（丢包、高负载的节点排后）
+func RankLatency(n Node) time.Duration {
+	if n.Latency == Unreachable {
+		return Unreachable
+	}
+	return n.Latency + time.Duration(MaxNodeScore-NodeScore(n))*scorePenalty
+}
+
+// NodeScore 节点质量评分（未下发时视为满分，超出范围时截断）
+func NodeScore(n Node) int {
+	if n.Score == nil {
+		return MaxNodeScore
+	}
+	return min(max(*n.Score, 0), MaxNodeScore)
+}
+
+// NodeWeight 节点权重（未下发时取默认值）
+func NodeWeight(n Node) int {
+	if n.Weight <= 0 {
+		return DefaultNodeWeight
+	}
+	return n.Weight
+}
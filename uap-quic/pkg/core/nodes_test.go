@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testNode 测速完成的节点
+func testNode(name string, latency time.Duration, weight int) Node {
+	return Node{Name: name, Address: name + ":443", Latency: latency, Weight: weight, Probed: true}
+}
+
+func TestSelectNodeWeightWithinTolerance(t *testing.T) {
+	nodes := []Node{
+		testNode("fast", 40*time.Millisecond, 100),
+		testNode("heavy", 60*time.Millisecond, 500),
+		testNode("far", 200*time.Millisecond, 1000),
+	}
+	// 同一档（相差 30ms 以内）权重高者胜出，档外的节点权重再高也不选
+	if got, ok := SelectNode(nodes, DefaultSelectTolerance); !ok || got.Name != "heavy" {
+		t.Fatalf("选中 %q", got.Name)
+	}
+	if got, _ := SelectNode(nodes, 10*time.Millisecond); got.Name != "fast" {
+		t.Fatalf("容差 10ms 时选中 %q", got.Name)
+	}
+}
+
+func TestSelectNodeTieKeepsFastest(t *testing.T) {
+	nodes := []Node{
+		testNode("a", 40*time.Millisecond, 0), // 未下发权重按默认值
+		testNode("b", 50*time.Millisecond, DefaultNodeWeight),
+	}
+	if got, _ := SelectNode(nodes, DefaultSelectTolerance); got.Name != "a" {
+		t.Fatalf("同权重时选中 %q，期望排序靠前的 a", got.Name)
+	}
+}
+
+func TestSelectNodeUnreachable(t *testing.T) {
+	if _, ok := SelectNode(nil, DefaultSelectTolerance); ok {
+		t.Fatal("空列表不应选中节点")
+	}
+	nodes := []Node{testNode("a", Unreachable, 100), testNode("b", Unreachable, 1000)}
+	if _, ok := SelectNode(nodes, DefaultSelectTolerance); ok {
+		t.Fatal("全部不可达时不应选中节点")
+	}
+	// 不可达的节点不进入同一档
+	nodes = []Node{testNode("a", 40*time.Millisecond, 1), testNode("b", Unreachable, 1000)}
+	if got, _ := SelectNode(nodes, time.Hour); got.Name != "a" {
+		t.Fatalf("选中不可达的节点 %q", got.Name)
+	}
+}
+
+func TestRankLatencyScorePenalty(t *testing.T) {
+	score := 50
+	n := testNode("a", 40*time.Millisecond, 0)
+	if got := RankLatency(n); got != 40*time.Millisecond {
+		t.Fatalf("未下发评分时的排序延迟 %v", got)
+	}
+	n.Score = &score
+	if got := RankLatency(n); got != 40*time.Millisecond+50*scorePenalty {
+		t.Fatalf("评分 50 的排序延迟 %v", got)
+	}
+	for _, s := range []int{-5, 150} {
+		n.Score = &s
+		if got := NodeScore(n); got < 0 || got > MaxNodeScore {
+			t.Fatalf("评分 %d 未截断: %d", s, got)
+		}
+	}
+	if RankLatency(testNode("x", Unreachable, 0)) != Unreachable {
+		t.Fatal("不可达节点的排序延迟应为 Unreachable")
+	}
+}
+
+func TestFetchNodes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nodes":
+			w.Write([]byte(`{"code":200,"data":[{"name":"us-1","address":"us1:443","weight":300,"score":90}]}`))
+		case "/empty":
+			w.Write([]byte(`{"code":200,"data":[]}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":40100,"error":"unauthorized","msg":"未登录"}`))
+		}
+	}))
+	defer srv.Close()
+
+	nodes, err := FetchNodes(context.Background(), srv.URL+"/nodes", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Weight != 300 || NodeScore(nodes[0]) != 90 {
+		t.Fatalf("节点列表 %+v", nodes)
+	}
+	if _, err := FetchNodes(context.Background(), srv.URL+"/empty", "token"); err == nil {
+		t.Fatal("空列表应返回错误")
+	}
+	if _, err := FetchNodes(context.Background(), srv.URL+"/denied", "token"); err == nil {
+		t.Fatal("业务错误应返回错误")
+	}
+}
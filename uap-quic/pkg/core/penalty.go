@@ -0,0 +1,214 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// 连接失败的目标的冷却（负缓存）：目标拒绝连接或不可达时，之后冷却期内对同一目标的新请求直接在本地失败，
+// 不再开流、鉴权、让节点重新拨号（浏览器对挂掉的网站会反复重试）。冷却期从 penaltyBase 起每次失败翻倍，
+// 最长 penaltyMaxCooldown；目标连接成功一次即清除，最后一次失败超过 penaltyTTL 后也会遗忘
+const (
+	penaltyBase        = time.Second
+	penaltyMaxCooldown = time.Minute
+	penaltyTTL         = 10 * time.Minute
+	maxPenalties       = 1024 // 最多记录的目标数，满时淘汰冷却最早结束的目标
+)
+
+// TargetPenalty 一个最近拒绝连接或不可达的目标（GetStats 与 TestRoute 输出）
+type TargetPenalty struct {
+	Target      string    `json:"target"`       // host:port
+	Failures    int       `json:"failures"`     // 连续失败次数
+	Reason      string    `json:"reason"`       // refused / unreachable
+	Until       time.Time `json:"until"`        // 冷却结束时间，之前的新请求直接失败
+	Suppressed  uint64    `json:"suppressed"`   // 冷却期内在本地直接失败的请求数
+	LastFailure time.Time `json:"last_failure"` // 最近一次节点报告失败的时间
+}
+
+// 冷却原因
+const (
+	PenaltyRefused     = "refused"     // 目标拒绝连接
+	PenaltyUnreachable = "unreachable" // 连接目标超时或网络不可达
+)
+
+// targetError 节点连接目标失败（或目标处于冷却中），可用 errors.Is(err, ErrTargetUnreachable) 判断
+type targetError struct {
+	target string
+	status byte          // 节点回复的状态（见 target.Status*）
+	wait   time.Duration // 冷却剩余时间（大于 0 表示在本地直接失败，没有发出请求）
+}
+
+func (e *targetError) Error() string {
+	if e.wait > 0 {
+		return fmt.Sprintf("%v: %s（%s，冷却中，%v 后重试）", ErrTargetUnreachable, e.target, penaltyReason(e.status), e.wait.Round(time.Second))
+	}
+	if reason := penaltyReason(e.status); reason != "" {
+		return fmt.Sprintf("%v: %s（%s）", ErrTargetUnreachable, e.target, reason)
+	}
+	return fmt.Sprintf("%v: %s", ErrTargetUnreachable, e.target)
+}
+
+func (e *targetError) Unwrap() error { return ErrTargetUnreachable }
+
+// socksRep 对应的 SOCKS5 回复码：拒绝连接 0x05，其他 0x04（主机不可达）
+func (e *targetError) socksRep() byte {
+	if e.status == target.StatusRefused {
+		return 0x05
+	}
+	return 0x04
+}
+
+// penaltyReason 会进入冷却的失败状态对应的原因，其他状态返回空
+func penaltyReason(status byte) string {
+	switch status {
+	case target.StatusRefused:
+		return PenaltyRefused
+	case target.StatusUnreachable:
+		return PenaltyUnreachable
+	}
+	return ""
+}
+
+// penalty 一个目标的冷却状态
+type penalty struct {
+	failures    int
+	status      byte
+	until       time.Time
+	suppressed  uint64
+	lastFailure time.Time
+}
+
+// penaltyTable 冷却中的目标（键为规范化的 host:port），零值可用
+type penaltyTable struct {
+	mu      sync.Mutex
+	entries map[string]*penalty
+}
+
+// cooldown 第 failures 次连续失败后的冷却时长
+func cooldown(failures int) time.Duration {
+	d := penaltyBase
+	for i := 1; i < failures && d < penaltyMaxCooldown; i++ {
+		d *= 2
+	}
+	if d > penaltyMaxCooldown {
+		d = penaltyMaxCooldown
+	}
+	return d
+}
+
+// check 目标处于冷却中时返回本地失败的错误（计入 suppressed），否则返回 nil
+func (t *penaltyTable) check(addr string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.entries[addr]
+	if p == nil {
+		return nil
+	}
+	if now.Sub(p.lastFailure) > penaltyTTL {
+		delete(t.entries, addr)
+		return nil
+	}
+	if !now.Before(p.until) {
+		return nil // 冷却结束，放行一次重试（失败时冷却翻倍）
+	}
+	p.suppressed++
+	return &targetError{target: addr, status: p.status, wait: p.until.Sub(now)}
+}
+
+// fail 记录目标的一次失败，返回新的冷却时长；不会进入冷却的失败状态返回 0
+func (t *penaltyTable) fail(addr string, status byte, now time.Time) time.Duration {
+	if penaltyReason(status) == "" {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.entries[addr]
+	if p == nil || now.Sub(p.lastFailure) > penaltyTTL {
+		if t.entries == nil {
+			t.entries = make(map[string]*penalty)
+		}
+		if len(t.entries) >= maxPenalties {
+			t.evictLocked(now)
+		}
+		p = &penalty{}
+		t.entries[addr] = p
+	}
+	p.failures++
+	p.status = status
+	p.lastFailure = now
+	d := cooldown(p.failures)
+	p.until = now.Add(d)
+	return d
+}
+
+// succeed 目标连接成功，清除冷却
+func (t *penaltyTable) succeed(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, addr)
+}
+
+// evictLocked 表满时腾出位置：先删除已过期的目标，仍然满时删除冷却最早结束的目标
+func (t *penaltyTable) evictLocked(now time.Time) {
+	var oldest string
+	for addr, p := range t.entries {
+		if now.Sub(p.lastFailure) > penaltyTTL {
+			delete(t.entries, addr)
+			continue
+		}
+		if oldest == "" || p.until.Before(t.entries[oldest].until) {
+			oldest = addr
+		}
+	}
+	if len(t.entries) >= maxPenalties {
+		delete(t.entries, oldest)
+	}
+}
+
+// snapshot 最近失败、尚未遗忘的目标（包括冷却已结束、等待下一次重试的），按冷却结束时间从晚到早排序；
+// host 非空时只返回该主机（任意端口）的目标
+func (t *penaltyTable) snapshot(host string, now time.Time) []TargetPenalty {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []TargetPenalty
+	for a, p := range t.entries {
+		if now.Sub(p.lastFailure) > penaltyTTL {
+			continue
+		}
+		if h, _, _ := net.SplitHostPort(a); host != "" && h != host {
+			continue
+		}
+		out = append(out, TargetPenalty{
+			Target:      a,
+			Failures:    p.failures,
+			Reason:      penaltyReason(p.status),
+			Until:       p.until,
+			Suppressed:  p.suppressed,
+			LastFailure: p.lastFailure,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Until.Equal(out[j].Until) {
+			return out[i].Until.After(out[j].Until)
+		}
+		return out[i].Target < out[j].Target
+	})
+	return out
+}
+
+// recordTargetResult 按转发请求的结果更新目标的冷却：成功时清除，拒绝连接 / 不可达时延长冷却并记录日志
+func (c *Client) recordTargetResult(addr string, status byte) {
+	if status == target.StatusOK {
+		c.penalties.succeed(addr)
+		return
+	}
+	if d := c.penalties.fail(addr, status, time.Now()); d > 0 {
+		log.Printf("⏳ 目标 %s 连接失败 (%s)，%v 内的新请求直接失败", addr, penaltyReason(status), d)
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+func TestCooldownGrowth(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+	for i, d := range want {
+		if got := cooldown(i + 1); got != d {
+			t.Errorf("第 %d 次失败冷却 %v，期望 %v", i+1, got, d)
+		}
+	}
+	if got := cooldown(1000); got != penaltyMaxCooldown {
+		t.Fatalf("多次失败后冷却 %v，期望上限 %v", got, penaltyMaxCooldown)
+	}
+}
+
+func TestPenaltyCooldown(t *testing.T) {
+	var table penaltyTable
+	now := time.Now()
+	const addr = "down.example:443"
+
+	// 只有拒绝连接与不可达进入冷却
+	if d := table.fail(addr, target.StatusFailed, now); d != 0 || table.check(addr, now) != nil {
+		t.Fatal("StatusFailed 进入了冷却")
+	}
+
+	// 每次失败冷却翻倍，冷却期内的请求在本地失败并计数，冷却结束放行一次重试
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if d := table.fail(addr, target.StatusRefused, now); d != want {
+			t.Fatalf("第 %d 次失败冷却 %v，期望 %v", i+1, d, want)
+		}
+		err := table.check(addr, now.Add(want/2))
+		var te *targetError
+		if !errors.As(err, &te) || !errors.Is(err, ErrTargetUnreachable) || te.wait != want/2 || te.socksRep() != 0x05 {
+			t.Fatalf("冷却期内: %v", err)
+		}
+		if err := table.check(addr, now.Add(want)); err != nil {
+			t.Fatalf("冷却结束后仍失败: %v", err)
+		}
+		now = now.Add(want)
+	}
+	if s := table.snapshot("", now); len(s) != 1 || s[0].Failures != 3 || s[0].Suppressed != 3 || s[0].Reason != PenaltyRefused {
+		t.Fatalf("冷却状态 %+v", s)
+	}
+
+	// 第一次成功即清除
+	table.succeed(addr)
+	if table.check(addr, now) != nil || len(table.snapshot("", now)) != 0 {
+		t.Fatal("成功后未清除冷却")
+	}
+	if d := table.fail(addr, target.StatusUnreachable, now); d != time.Second {
+		t.Fatalf("清除后再次失败冷却 %v，期望从头开始", d)
+	}
+	var te *targetError
+	if !errors.As(table.check(addr, now), &te) || te.socksRep() != 0x04 {
+		t.Fatal("不可达的目标应回复 0x04")
+	}
+
+	// 最后一次失败超过 penaltyTTL 后遗忘，再次失败从头开始
+	later := now.Add(penaltyTTL + time.Second)
+	if table.check(addr, later) != nil || len(table.snapshot("", later)) != 0 {
+		t.Fatal("超过 TTL 后未遗忘")
+	}
+	table.fail(addr, target.StatusRefused, now)
+	if d := table.fail(addr, target.StatusRefused, later); d != time.Second {
+		t.Fatalf("超过 TTL 后再次失败冷却 %v，期望从头开始", d)
+	}
+}
+
+func TestPenaltyTableBounded(t *testing.T) {
+	var table penaltyTable
+	now := time.Now()
+	// 第一个目标失败两次，冷却最晚结束
+	table.fail("keep.example:443", target.StatusRefused, now)
+	table.fail("keep.example:443", target.StatusRefused, now)
+	for i := 0; i < maxPenalties+100; i++ {
+		table.fail(fmt.Sprintf("10.0.%d.%d:80", i/256, i%256), target.StatusRefused, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if n := len(table.entries); n != maxPenalties {
+		t.Fatalf("记录 %d 个目标，期望上限 %d", n, maxPenalties)
+	}
+	// 淘汰冷却最早结束的目标
+	if table.entries["keep.example:443"] == nil || table.entries["10.0.0.0:80"] != nil {
+		t.Fatal("淘汰了冷却较晚结束的目标")
+	}
+}
+
+func TestPenaltyVisible(t *testing.T) {
+	c := newRoutingClient(t, ModeGlobal, "")
+	now := time.Now()
+	c.penalties.fail("down.example:443", target.StatusRefused, now)
+	c.penalties.fail("down.example:80", target.StatusUnreachable, now)
+	c.penalties.fail("down.example:80", target.StatusUnreachable, now)
+	c.penalties.fail("other.example:443", target.StatusRefused, now)
+
+	// explain 只列出该主机的目标，冷却结束最晚的在前
+	d := c.TestRoute("down.example")
+	if len(d.Failing) != 2 || d.Failing[0].Target != "down.example:80" || d.Failing[0].Reason != PenaltyUnreachable || d.Failing[1].Target != "down.example:443" {
+		t.Fatalf("TestRoute 的冷却目标 %+v", d.Failing)
+	}
+	if d := c.TestRoute("up.example"); len(d.Failing) != 0 {
+		t.Fatalf("无关主机的冷却目标 %+v", d.Failing)
+	}
+	if s := c.GetStats(0); len(s.FailingTargets) != 3 {
+		t.Fatalf("GetStats 的冷却目标 %+v", s.FailingTargets)
+	}
+
+	// 冷却中的目标在本地失败，SOCKS5 回复与上次失败相同，不需要隧道
+	if rep := connectThrough(t, c, "down.example:443"); rep != 0x05 {
+		t.Fatalf("冷却中的目标回复 0x%02x，期望 0x05", rep)
+	}
+	if rep := connectThrough(t, c, "down.example:80"); rep != 0x04 {
+		t.Fatalf("冷却中的目标回复 0x%02x，期望 0x04", rep)
+	}
+	if s := c.TestRoute("down.example").Failing; s[0].Suppressed != 1 || s[1].Suppressed != 1 {
+		t.Fatalf("未计入本地失败的请求 %+v", s)
+	}
+}
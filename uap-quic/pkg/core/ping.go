@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultPingConcurrency 节点测速默认并发数（同时进行的 TCP 拨号上限）
+const DefaultPingConcurrency = 20
+
+// DefaultPingJitter 节点测速默认错开范围：大量客户端同时启动（如推送后集中打开 App）时，
+// 各自的拨号在此范围内随机错开，避免同一时刻涌向同一批节点
+const DefaultPingJitter = 300 * time.Millisecond
+
+// pingTimeout 单个节点测速超时
+const pingTimeout = 2 * time.Second
+
+// Unreachable 测速失败/超时节点的延迟（最大 time.Duration 值，排序时排在最后）
+const Unreachable = time.Duration(1<<63 - 1)
+
+// PingOptions 节点测速选项
+type PingOptions struct {
+	Concurrency int // 同时进行的拨号上限（<= 0 使用 DefaultPingConcurrency）
+
+	// 提前结束：已有 GoodCount 个节点的延迟不超过 GoodLatency 时放弃其余测速（任一为 0 表示测完所有节点）
+	// 地址按优先级排列时（如固定节点在前），靠前的节点先测速
+	GoodLatency time.Duration
+	GoodCount   int
+
+	// Jitter 错开范围：各节点的拨号在 [0, Jitter) 内随机延后开始，总测速时间最多增加 Jitter
+	// （0 使用 DefaultPingJitter，< 0 不错开）。延后量按地址顺序递增，靠前的节点仍先测速
+	Jitter time.Duration
+
+	// Dial 拨号函数（nil 时使用 TCP 连接），ctx 取消时应尽快返回
+	Dial func(ctx context.Context, addr string) error
+}
+
+// PingResult 单个节点的测速结果
+type PingResult struct {
+	Latency time.Duration // 延迟，失败或未测速时为 Unreachable
+	Probed  bool          // 是否完成了测速（取消或提前结束时被放弃的节点为 false，不应当作失败上报）
+}
+
+// PingAddrs 对节点地址做 TCP 连接测速，返回与 addrs 一一对应的延迟（失败为 Unreachable）
+// 最多 concurrency 个拨号同时进行（<= 0 使用 DefaultPingConcurrency），节点很多时不会瞬间占满文件描述符
+func PingAddrs(addrs []string, concurrency int) []time.Duration {
+	latencies := make([]time.Duration, len(addrs))
+	for i, r := range PingAddrsContext(context.Background(), addrs, PingOptions{Concurrency: concurrency}) {
+		latencies[i] = r.Latency
+	}
+	return latencies
+}
+
+// PingAddrsContext 带取消与提前结束的节点测速，返回与 addrs 一一对应的结果
+// ctx 取消（如 App 切到后台）时放弃尚未完成的测速并立即返回；已完成的结果保留
+func PingAddrsContext(ctx context.Context, addrs []string, opts PingOptions) []PingResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPingConcurrency
+	}
+	if concurrency > len(addrs) {
+		concurrency = len(addrs)
+	}
+	dial := opts.Dial
+	if dial == nil {
+		dial = dialPing
+	}
+
+	results := make([]PingResult, len(addrs))
+	for i := range results {
+		results[i].Latency = Unreachable
+	}
+
+	offsets := pingOffsets(len(addrs), opts.Jitter)
+	begin := time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		good int
+		wg   sync.WaitGroup
+	)
+	jobs := make(chan int)
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				if !sleepContext(ctx, time.Until(begin.Add(offsets[idx]))) {
+					continue // 已取消或提前结束
+				}
+				start := time.Now()
+				err := dial(ctx, addrs[idx])
+				latency := time.Since(start)
+
+				mu.Lock()
+				// 被取消的拨号不算失败：节点没有测完
+				if ctx.Err() == nil || err == nil {
+					results[idx].Probed = true
+					if err == nil {
+						results[idx].Latency = latency
+						if opts.GoodCount > 0 && opts.GoodLatency > 0 && latency <= opts.GoodLatency {
+							if good++; good >= opts.GoodCount {
+								cancel()
+							}
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for idx := range addrs {
+		select {
+		case jobs <- idx:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// pingOffsets 各地址拨号相对测速开始的延后量：[0, jitter) 内的随机值按地址顺序递增排列
+func pingOffsets(n int, jitter time.Duration) []time.Duration {
+	offsets := make([]time.Duration, n)
+	if jitter == 0 {
+		jitter = DefaultPingJitter
+	}
+	if jitter < 0 {
+		return offsets
+	}
+	for i := range offsets {
+		offsets[i] = time.Duration(rand.Int63n(int64(jitter)))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// sleepContext 等待 d，ctx 先取消时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// dialPing 一次 TCP 握手测速
+func dialPing(ctx context.Context, addr string) error {
+	dialer := net.Dialer{Timeout: pingTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,247 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPingConcurrencyLimit(t *testing.T) {
+	addrs := make([]string, 100)
+	for i := range addrs {
+		addrs[i] = "node-" + strconv.Itoa(i) + ":443"
+	}
+
+	var inFlight, maxInFlight, dials atomic.Int32
+	results := PingAddrsContext(context.Background(), addrs, PingOptions{
+		Concurrency: 10,
+		Jitter:      -1,
+		Dial: func(ctx context.Context, addr string) error {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				max := maxInFlight.Load()
+				if n <= max || maxInFlight.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			dials.Add(1)
+			time.Sleep(2 * time.Millisecond)
+			return nil
+		},
+	})
+
+	if got := maxInFlight.Load(); got > 10 {
+		t.Fatalf("同时进行的拨号 %d 个，超过并发上限 10", got)
+	} else if got < 2 {
+		t.Fatalf("同时进行的拨号只有 %d 个，测速没有并发", got)
+	}
+	if dials.Load() != 100 {
+		t.Fatalf("拨号 %d 次，期望 100", dials.Load())
+	}
+	for i, r := range results {
+		if !r.Probed || r.Latency == Unreachable {
+			t.Fatalf("节点 %d 的结果 %+v", i, r)
+		}
+	}
+}
+
+func TestPingNodesSortsAndMarksFailures(t *testing.T) {
+	delays := map[string]time.Duration{"a:1": 30 * time.Millisecond, "b:1": 5 * time.Millisecond, "c:1": -1, "d:1": 15 * time.Millisecond}
+	nodes := []Node{{Name: "a", Address: "a:1"}, {Name: "b", Address: "b:1"}, {Name: "c", Address: "c:1"}, {Name: "d", Address: "d:1"}}
+	sorted := PingNodes(context.Background(), nodes, PingOptions{
+		Concurrency: 2,
+		Jitter:      -1,
+		Dial: func(ctx context.Context, addr string) error {
+			if delays[addr] < 0 {
+				return errors.New("connection refused")
+			}
+			time.Sleep(delays[addr])
+			return nil
+		},
+	})
+
+	var order string
+	for _, n := range sorted {
+		order += n.Name
+	}
+	if order != "bdac" {
+		t.Fatalf("排序结果 %s，期望 bdac", order)
+	}
+	if last := sorted[3]; last.Latency != Unreachable || !last.Probed {
+		t.Fatalf("失败节点 %+v 应为已测速且不可达", last)
+	}
+}
+
+func TestPingEarlyStop(t *testing.T) {
+	addrs := []string{"fast-1:1", "fast-2:1", "slow-1:1", "slow-2:1"}
+	var dials atomic.Int32
+	results := PingAddrsContext(context.Background(), addrs, PingOptions{
+		Concurrency: 1,
+		Jitter:      -1,
+		GoodLatency: 50 * time.Millisecond,
+		GoodCount:   2,
+		Dial: func(ctx context.Context, addr string) error {
+			dials.Add(1)
+			return nil
+		},
+	})
+	if dials.Load() != 2 {
+		t.Fatalf("已有 2 个达标节点后仍拨号了 %d 次", dials.Load())
+	}
+	if !results[0].Probed || !results[1].Probed || results[2].Probed || results[3].Probed {
+		t.Fatalf("提前结束后的结果 %+v", results)
+	}
+	if results[2].Latency != Unreachable {
+		t.Fatalf("未测速节点的延迟 %v", results[2].Latency)
+	}
+}
+
+func TestPingEarlyStopScriptedLatencies(t *testing.T) {
+	// 按顺序测速：慢节点测完但不计入达标数，第 2 个达标节点之后的节点放弃
+	script := map[string]time.Duration{
+		"slow-1:1": 40 * time.Millisecond,
+		"fast-1:1": 0,
+		"down-1:1": -1,
+		"slow-2:1": 40 * time.Millisecond,
+		"fast-2:1": 0,
+		"fast-3:1": 0,
+	}
+	addrs := []string{"slow-1:1", "fast-1:1", "down-1:1", "slow-2:1", "fast-2:1", "fast-3:1"}
+	results := PingAddrsContext(context.Background(), addrs, PingOptions{
+		Concurrency: 1,
+		Jitter:      -1,
+		GoodLatency: 20 * time.Millisecond,
+		GoodCount:   2,
+		Dial: func(ctx context.Context, addr string) error {
+			if script[addr] < 0 {
+				return errors.New("connection refused")
+			}
+			time.Sleep(script[addr])
+			return nil
+		},
+	})
+
+	for i, want := range []bool{true, true, true, true, true, false} {
+		if results[i].Probed != want {
+			t.Fatalf("%s 的测速状态 %+v，期望 Probed=%v", addrs[i], results[i], want)
+		}
+	}
+	if results[0].Latency < 40*time.Millisecond || results[2].Latency != Unreachable || results[1].Latency >= 20*time.Millisecond {
+		t.Fatalf("测速结果 %+v", results)
+	}
+}
+
+func TestPingOffsets(t *testing.T) {
+	if offsets := pingOffsets(5, -1); offsets[4] != 0 {
+		t.Fatalf("不错开时的延后量 %v", offsets)
+	}
+	offsets := pingOffsets(50, 100*time.Millisecond)
+	for i, d := range offsets {
+		if d < 0 || d >= 100*time.Millisecond || i > 0 && d < offsets[i-1] {
+			t.Fatalf("延后量 %v 超出范围或未按顺序递增", offsets)
+		}
+	}
+	for _, d := range pingOffsets(50, 0) {
+		if d >= DefaultPingJitter {
+			t.Fatalf("默认错开范围的延后量 %v", d)
+		}
+	}
+}
+
+// TestPingStaggered 各节点的拨号在错开范围内分散开始，而不是同时在 t=0 发出；总测速时间最多增加错开范围
+func TestPingStaggered(t *testing.T) {
+	const jitter = 200 * time.Millisecond
+	addrs := make([]string, 20)
+	for i := range addrs {
+		addrs[i] = "node-" + strconv.Itoa(i) + ":443"
+	}
+
+	var mu sync.Mutex
+	var starts []time.Duration
+	begin := time.Now()
+	PingAddrsContext(context.Background(), addrs, PingOptions{
+		Concurrency: len(addrs),
+		Jitter:      jitter,
+		Dial: func(ctx context.Context, addr string) error {
+			mu.Lock()
+			starts = append(starts, time.Since(begin))
+			mu.Unlock()
+			return nil
+		},
+	})
+	if elapsed := time.Since(begin); elapsed > jitter+500*time.Millisecond {
+		t.Fatalf("测速耗时 %v，超出错开范围 %v 太多", elapsed, jitter)
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	if len(starts) != len(addrs) {
+		t.Fatalf("拨号 %d 次，期望 %d", len(starts), len(addrs))
+	}
+	if spread := starts[len(starts)-1] - starts[0]; spread < jitter/4 {
+		t.Fatalf("拨号开始时间只分散在 %v 内（%v），未错开", spread, starts)
+	}
+	if late := starts[len(starts)-1]; late >= jitter+100*time.Millisecond {
+		t.Fatalf("最晚的拨号在 %v 后才开始，超出错开范围 %v", late, jitter)
+	}
+}
+
+func TestPingCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	results := PingAddrsContext(ctx, []string{"a:1", "b:1"}, PingOptions{
+		Jitter: -1,
+		Dial: func(ctx context.Context, addr string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("取消后 %v 才返回", elapsed)
+	}
+	// 被取消的拨号不算失败
+	for i, r := range results {
+		if r.Probed {
+			t.Fatalf("节点 %d 被取消后标记为已测速", i)
+		}
+	}
+}
+
+func TestPingAddrsTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	latencies := PingAddrs([]string{ln.Addr().String(), closedAddr}, 0)
+	if latencies[0] == Unreachable || latencies[0] > pingTimeout {
+		t.Fatalf("在线节点延迟 %v", latencies[0])
+	}
+	if latencies[1] != Unreachable {
+		t.Fatalf("未监听端口的延迟 %v，期望 Unreachable", latencies[1])
+	}
+}
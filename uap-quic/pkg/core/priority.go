@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"uap-quic/pkg/prio"
+	"uap-quic/pkg/target"
+)
+
+// StreamPriority 隧道内交互流量优先于大流量（见 pkg/prio，只作用于上行；下行由节点的 -stream-priority 控制）
+// 规则标签为 bulk 或目标端口在 BulkPorts 中的连接从一开始按大流量处理，其他连接上行超过 BulkAfter 字节后降为大流量，
+// 标签为 game 的连接不会降级
+type StreamPriority struct {
+	BulkAfter int64    `json:"bulk_after"`           // 降为大流量的上行字节数（0 为默认 1MB，负数表示不按流量降级）
+	BulkPorts []uint16 `json:"bulk_ports,omitempty"` // 按大流量处理的目标端口
+}
+
+// streamPriority 生效的配置与调度器（切换配置时新建调度器，已建立的连接继续使用原来的）
+type streamPriority struct {
+	cfg   StreamPriority
+	sched *prio.Scheduler
+}
+
+// SetStreamPriority 开启隧道内的流优先级（nil 关闭，默认关闭）；可在运行中切换，对之后建立的连接生效
+// 按端口判为大流量的连接在转发请求中同样携带大流量标志，节点按 tag=bulk 处理（-bulk-rate 限速与下行优先级）
+func (c *Client) SetStreamPriority(p *StreamPriority) {
+	if p == nil {
+		c.priority.Store(nil)
+		return
+	}
+	cfg := *p
+	if cfg.BulkAfter == 0 {
+		cfg.BulkAfter = prio.DefaultBulkAfter
+	}
+	cfg.BulkPorts = append([]uint16(nil), cfg.BulkPorts...)
+	c.priority.Store(&streamPriority{cfg: cfg, sched: prio.NewScheduler()})
+}
+
+// StreamPriority 当前的流优先级配置（nil 表示关闭）
+func (c *Client) StreamPriority() *StreamPriority {
+	if p := c.priority.Load(); p != nil {
+		cfg := p.cfg
+		cfg.BulkPorts = append([]uint16(nil), cfg.BulkPorts...)
+		return &cfg
+	}
+	return nil
+}
+
+// priorityStats 流优先级统计（未开启时为 nil）
+func (c *Client) priorityStats() *prio.Stats {
+	p := c.priority.Load()
+	if p == nil {
+		return nil
+	}
+	s := p.sched.Stats()
+	return &s
+}
+
+// bulkPortFlags 目标端口在 BulkPorts 中时加上大流量标志（未开启流优先级或已是游戏流量时原样返回）
+func (c *Client) bulkPortFlags(addr string, flags target.Flags) target.Flags {
+	p := c.priority.Load()
+	if p == nil || flags&(target.FlagBulk|target.FlagGame) != 0 {
+		return flags
+	}
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return flags
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return flags
+	}
+	for _, bp := range p.cfg.BulkPorts {
+		if uint16(port) == bp {
+			return flags | target.FlagBulk
+		}
+	}
+	return flags
+}
+
+// priorityWriter 按转发标志包装写往隧道的方向（未开启流优先级时原样返回）
+func (c *Client) priorityWriter(w io.Writer, flags target.Flags) io.Writer {
+	p := c.priority.Load()
+	if p == nil {
+		return w
+	}
+	return p.sched.Writer(w, flagsClass(flags), p.cfg.BulkAfter)
+}
+
+// flagsClass 转发标志对应的流类型
+func flagsClass(flags target.Flags) prio.Class {
+	switch {
+	case flags&target.FlagGame != 0:
+		return prio.Realtime
+	case flags&target.FlagBulk != 0:
+		return prio.Bulk
+	}
+	return prio.Interactive
+}
+
+// ParseBulkPorts 解析逗号分隔的端口列表（如 "21,873"），空字符串返回空列表
+func ParseBulkPorts(s string) ([]uint16, error) {
+	var ports []uint16
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(f, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("端口无效: %q", f)
+		}
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
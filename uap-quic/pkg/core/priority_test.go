@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"uap-quic/pkg/prio"
+	"uap-quic/pkg/target"
+)
+
+func TestParseBulkPorts(t *testing.T) {
+	ports, err := ParseBulkPorts(" 21, 873,,6881 ")
+	if err != nil || !reflect.DeepEqual(ports, []uint16{21, 873, 6881}) {
+		t.Fatalf("ParseBulkPorts = %v, %v", ports, err)
+	}
+	if ports, err := ParseBulkPorts(""); ports != nil || err != nil {
+		t.Fatalf("空字符串: %v, %v", ports, err)
+	}
+	for _, s := range []string{"0", "abc", "21,65536", "-1"} {
+		if _, err := ParseBulkPorts(s); err == nil {
+			t.Errorf("ParseBulkPorts(%q) 未报错", s)
+		}
+	}
+}
+
+func TestSetStreamPriority(t *testing.T) {
+	c := newRoutingClient(t, ModeGlobal, "")
+	if c.StreamPriority() != nil || c.GetStats(0).Priority != nil {
+		t.Fatal("默认开启了流优先级")
+	}
+
+	ports := []uint16{21}
+	c.SetStreamPriority(&StreamPriority{BulkPorts: ports})
+	ports[0] = 22 // 调用方之后修改不影响生效的配置
+	got := c.StreamPriority()
+	if got == nil || got.BulkAfter != prio.DefaultBulkAfter || !reflect.DeepEqual(got.BulkPorts, []uint16{21}) {
+		t.Fatalf("生效的配置 %+v", got)
+	}
+	got.BulkPorts[0] = 23
+	if c.StreamPriority().BulkPorts[0] != 21 {
+		t.Fatal("StreamPriority 返回的端口列表与生效的配置共用")
+	}
+	if c.GetStats(0).Priority == nil {
+		t.Fatal("开启后没有流优先级统计")
+	}
+
+	c.SetStreamPriority(&StreamPriority{BulkAfter: -1})
+	if got := c.StreamPriority(); got.BulkAfter != -1 {
+		t.Fatalf("不按流量降级: %+v", got)
+	}
+	c.SetStreamPriority(nil)
+	if c.StreamPriority() != nil || c.GetStats(0).Priority != nil {
+		t.Fatal("关闭后仍有流优先级")
+	}
+}
+
+// TestBulkPortFlags 目标端口在 BulkPorts 中的连接加上大流量标志，游戏流量与未开启时不变
+func TestBulkPortFlags(t *testing.T) {
+	c := newRoutingClient(t, ModeGlobal, "")
+	if got := c.bulkPortFlags("example.com:21", 0); got != 0 {
+		t.Fatalf("未开启时加上了标志 %#x", got)
+	}
+
+	c.SetStreamPriority(&StreamPriority{BulkPorts: []uint16{21}})
+	for _, tc := range []struct {
+		addr  string
+		flags target.Flags
+		want  target.Flags
+	}{
+		{"example.com:21", 0, target.FlagBulk},
+		{"[2001:db8::1]:21", 0, target.FlagBulk},
+		{"example.com:443", 0, 0},
+		{"example.com:21", target.FlagGame, target.FlagGame},
+		{"example.com:21", target.FlagBulk, target.FlagBulk},
+		{"example.com", 0, 0},
+	} {
+		if got := c.bulkPortFlags(tc.addr, tc.flags); got != tc.want {
+			t.Errorf("bulkPortFlags(%q, %#x) = %#x，期望 %#x", tc.addr, tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestFlagsClass(t *testing.T) {
+	for flags, want := range map[target.Flags]prio.Class{
+		0:                                 prio.Interactive,
+		target.FlagBulk:                   prio.Bulk,
+		target.FlagGame:                   prio.Realtime,
+		target.FlagGame | target.FlagBulk: prio.Realtime,
+	} {
+		if got := flagsClass(flags); got != want {
+			t.Errorf("flagsClass(%#x) = %v，期望 %v", flags, got, want)
+		}
+	}
+}
+
+func TestPriorityWriter(t *testing.T) {
+	c := newRoutingClient(t, ModeGlobal, "")
+	var buf bytes.Buffer
+	if w := c.priorityWriter(&buf, target.FlagBulk); w != io.Writer(&buf) {
+		t.Fatal("未开启时包装了写入方向")
+	}
+
+	c.SetStreamPriority(&StreamPriority{})
+	w := c.priorityWriter(&buf, target.FlagBulk)
+	if w == io.Writer(&buf) {
+		t.Fatal("开启后未包装写入方向")
+	}
+	data := make([]byte, 3*prio.BulkChunk)
+	if n, err := w.Write(data); n != len(data) || err != nil || buf.Len() != len(data) {
+		t.Fatalf("写入 %d, %v，缓冲 %d 字节", n, err, buf.Len())
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+
+	"uap-quic/pkg/sockbuf"
+
+	"github.com/quic-go/quic-go"
+)
+
+// SetSocketProtector 设置 socket 保护回调：每次连接节点前，以 QUIC 连接 UDP socket 的 fd 调用
+// 客户端运行在 VPN 内时（Android VpnService / iOS NEPacketTunnelProvider），隧道自身的 socket 必须排除在 VPN 之外，
+// 否则发往节点的包会再次进入 VPN 形成回环。回调返回错误时放弃本次连接；传 nil 取消，对之后建立的连接生效
+func (c *Client) SetSocketProtector(protect func(fd int) error) {
+	if protect == nil {
+		c.socketProtector.Store(nil)
+		return
+	}
+	c.socketProtector.Store(&protect)
+}
+
+// SetUDPBuffers 设置连接节点的 UDP socket 的收发缓冲区（SO_RCVBUF / SO_SNDBUF，为 0 的项保持系统默认）
+// 下行吞吐高时内核默认的接收缓冲区容易被打满丢包（表现为重传增多）；对之后建立的 QUIC 连接生效，
+// 每次连接时记录请求与内核实际授予的大小
+func (c *Client) SetUDPBuffers(b sockbuf.Config) {
+	if b.IsZero() {
+		c.udpBuffers.Store(nil)
+		return
+	}
+	c.udpBuffers.Store(&b)
+}
+
+// dialQuic 连接节点（ctx 取消时放弃握手）：未设置 socket 保护回调与缓冲区时直接拨号，否则先创建 UDP socket（交给回调保护、设置缓冲区），再在其上建立 QUIC 连接
+func (c *Client) dialQuic(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.Connection, error) {
+	protect := c.socketProtector.Load()
+	buffers := c.udpBuffers.Load()
+	if protect == nil && buffers == nil {
+		return quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	if protect != nil {
+		if err := protectSocket(udpConn, *protect); err != nil {
+			udpConn.Close()
+			return nil, err
+		}
+	}
+	if buffers != nil {
+		if res, err := sockbuf.Apply(udpConn, *buffers); err != nil {
+			log.Printf("⚠️ UDP socket 缓冲区已设置，但无法读取实际大小: %v", err)
+		} else if res.Clamped() {
+			log.Printf("⚠️ UDP socket 缓冲区被系统截断 (请求/实际): %s", res)
+		} else {
+			log.Printf("✅ UDP socket 缓冲区 (请求/实际): %s", res)
+		}
+	}
+
+	// socket 由我们创建，Transport 关闭时不会关闭它，连接结束后一并关闭
+	tr := &quic.Transport{Conn: udpConn}
+	conn, err := tr.Dial(ctx, udpAddr, tlsConfig, quicConfig)
+	if err != nil {
+		tr.Close()
+		udpConn.Close()
+		return nil, err
+	}
+	go func() {
+		<-conn.Context().Done()
+		tr.Close()
+		udpConn.Close()
+	}()
+	return conn, nil
+}
+
+// protectSocket 以 socket 的 fd 调用保护回调（fd 只在回调期间有效，回调不得保存或关闭它）
+func protectSocket(udpConn *net.UDPConn, protect func(fd int) error) error {
+	raw, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var protectErr error
+	if err := raw.Control(func(fd uintptr) {
+		protectErr = protect(int(fd))
+	}); err != nil {
+		return err
+	}
+	if protectErr != nil {
+		return fmt.Errorf("socket 保护失败: %w", protectErr)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+//go:build unix
+
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// startProtectListener 本机 QUIC 监听，返回地址与接受到的连接
+func startProtectListener(t *testing.T) (string, chan quic.Connection) {
+	t.Helper()
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		NextProtos:   []string{"h3"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	accepted := make(chan quic.Connection, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	return listener.Addr().String(), accepted
+}
+
+// dialProtected 用 c 的 socket 设置连接 addr
+func dialProtected(c *Client, addr string) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.dialQuic(ctx, addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3"}}, nil)
+}
+
+func TestSocketProtector(t *testing.T) {
+	addr, accepted := startProtectListener(t)
+	c := NewClient(addr, "", 0, ModeGlobal)
+
+	var protected []int // 回调收到的 fd 对应的本地端口
+	c.SetSocketProtector(func(fd int) error {
+		// 拨号前以有效的 UDP socket fd 调用
+		typ, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+		if err != nil || typ != syscall.SOCK_DGRAM {
+			t.Errorf("fd %d 不是 UDP socket: %d %v", fd, typ, err)
+		}
+		sa, err := syscall.Getsockname(fd)
+		if err != nil {
+			t.Errorf("fd %d: %v", fd, err)
+		}
+		switch sa := sa.(type) {
+		case *syscall.SockaddrInet4:
+			protected = append(protected, sa.Port)
+		case *syscall.SockaddrInet6:
+			protected = append(protected, sa.Port)
+		}
+		select {
+		case <-accepted:
+			t.Error("回调之前已开始拨号")
+		default:
+		}
+		return nil
+	})
+
+	conn, err := dialProtected(c, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	// 回调保护的正是连接使用的 socket
+	if port := conn.LocalAddr().(*net.UDPAddr).Port; len(protected) != 1 || protected[0] != port {
+		t.Fatalf("回调收到端口 %v 的 socket，连接使用端口 %d", protected, port)
+	}
+
+	// 取消后直接拨号，不再调用回调
+	c.SetSocketProtector(nil)
+	conn, err = dialProtected(c, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	if len(protected) != 1 {
+		t.Fatalf("取消后仍调用了回调 %d 次", len(protected)-1)
+	}
+}
+
+func TestSocketProtectorError(t *testing.T) {
+	addr, accepted := startProtectListener(t)
+	c := NewClient(addr, "", 0, ModeGlobal)
+	errRefused := errors.New("refused")
+	c.SetSocketProtector(func(fd int) error { return errRefused })
+
+	// 回调返回错误时放弃本次连接，不向节点发出任何数据包
+	if _, err := dialProtected(c, addr); !errors.Is(err, errRefused) {
+		t.Fatalf("回调失败时返回 %v", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("回调失败后仍连接了节点")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
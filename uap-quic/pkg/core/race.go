@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// dialRaceStagger 拨号竞速中相邻两次握手的发起间隔（前一个候选地址提前失败时立即发起下一个）
+const dialRaceStagger = 250 * time.Millisecond
+
+// errCodeDialRaceLost 竞速中落败的连接的关闭码（HTTP/3 的 H3_REQUEST_CANCELLED）
+const errCodeDialRaceLost = 0x10c
+
+// dialResult 一个候选地址的拨号结果
+type dialResult struct {
+	addr string
+	conn quic.Connection
+	err  error
+}
+
+// raceDial 向候选地址错开 dialRaceStagger 依次发起握手，返回最先完成的连接与其地址
+// 节点同时有 A / AAAA 记录而本机 IPv6 不通时，不必等一次完整的握手超时；落败的连接以 errCodeDialRaceLost 关闭
+// 全部失败时返回各地址的错误（只有一个候选地址时原样返回）
+func (c *Client) raceDial(addrs []string, tlsConfig *tls.Config, quicConfig *quic.Config) (string, quic.Connection, error) {
+	if len(addrs) == 1 {
+		conn, err := c.dialQuic(c.ctx, addrs[0], tlsConfig, quicConfig)
+		return addrs[0], conn, err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	results := make(chan dialResult, len(addrs))
+	next, pending := 0, 0
+	var stagger <-chan time.Time
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := c.dialQuic(ctx, addr, tlsConfig, quicConfig)
+			results <- dialResult{addr: addr, conn: conn, err: err}
+		}()
+		stagger = nil
+		if next < len(addrs) {
+			stagger = time.After(dialRaceStagger)
+		}
+	}
+
+	start()
+	var errs []error
+	for pending > 0 {
+		select {
+		case <-stagger:
+			start()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				go closeRaceLosers(results, pending)
+				return r.addr, r.conn, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.addr, r.err))
+			if next < len(addrs) {
+				start()
+			}
+		}
+	}
+	return "", nil, errors.Join(errs...)
+}
+
+// closeRaceLosers 等待其余仍在握手的拨号结束（已被取消），关闭其中恰好也完成了握手的连接
+func closeRaceLosers(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-results; r.conn != nil {
+			r.conn.CloseWithError(errCodeDialRaceLost, "")
+		}
+	}
+}
+
+// addrFamily 地址所属的地址族（FamilyIPv4 / FamilyIPv6）
+func addrFamily(addr string) string {
+	host, _, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return FamilyIPv6
+	}
+	return FamilyIPv4
+}
+
+// interleaveFamilies 把候选地址按地址族交替排列，first 地址族在前（同一地址族内保持原有顺序）
+// 这样第二个发起的握手就换用另一个地址族，一个地址族整体不通时最多多等一个竞速间隔
+func interleaveFamilies(addrs []string, first string) []string {
+	var preferred, others []string
+	for _, addr := range addrs {
+		if addrFamily(addr) == first {
+			preferred = append(preferred, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+	out := make([]string, 0, len(addrs))
+	for i := 0; i < len(preferred) || i < len(others); i++ {
+		if i < len(preferred) {
+			out = append(out, preferred[i])
+		}
+		if i < len(others) {
+			out = append(out, others[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// raceTLSConfig 拨号竞速测试用的客户端 TLS 配置（testQUICPair 的节点使用自签证书）
+var raceTLSConfig = &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3"}}
+
+// startRaceListener 本机 QUIC 监听，接受的连接从 accepted 取出
+func startRaceListener(t *testing.T) (string, chan quic.Connection) {
+	t.Helper()
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		NextProtos:   []string{"h3"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	accepted := make(chan quic.Connection, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	return listener.Addr().String(), accepted
+}
+
+// startBlackhole 收下所有数据包但从不回复的 UDP 地址（模拟不通的地址族或节点）
+func startBlackhole(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestRaceDialSkipsUnresponsive 第一个候选地址不回复时，错开一个竞速间隔后第二个地址胜出，不必等握手超时
+func TestRaceDialSkipsUnresponsive(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	healthy, accepted := startRaceListener(t)
+	dead := startBlackhole(t)
+
+	start := time.Now()
+	addr, conn, err := c.raceDial([]string{dead, healthy}, raceTLSConfig, &quic.Config{HandshakeIdleTimeout: 10 * time.Second})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	if addr != healthy || conn.RemoteAddr().String() != healthy {
+		t.Fatalf("胜出的地址 %s，期望 %s", addr, healthy)
+	}
+	if elapsed < dialRaceStagger || elapsed > dialRaceStagger+time.Second {
+		t.Fatalf("连接耗时 %v，期望约为竞速间隔 %v 加一次握手", elapsed, dialRaceStagger)
+	}
+	<-accepted
+
+	// 健康地址在前时不等竞速间隔
+	start = time.Now()
+	if _, conn, err := c.raceDial([]string{healthy, dead}, raceTLSConfig, nil); err != nil {
+		t.Fatal(err)
+	} else {
+		conn.CloseWithError(0, "")
+	}
+	if elapsed := time.Since(start); elapsed >= dialRaceStagger {
+		t.Fatalf("第一个地址可用时耗时 %v", elapsed)
+	}
+}
+
+// TestRaceDialAllFail 全部候选地址失败时返回每个地址的错误
+func TestRaceDialAllFail(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	first, second := startBlackhole(t), startBlackhole(t)
+
+	_, conn, err := c.raceDial([]string{first, second}, raceTLSConfig, &quic.Config{HandshakeIdleTimeout: 300 * time.Millisecond})
+	if err == nil || conn != nil {
+		t.Fatal("全部地址不通时拨号成功")
+	}
+	if msg := err.Error(); !strings.Contains(msg, first) || !strings.Contains(msg, second) {
+		t.Fatalf("错误未包含各地址: %v", err)
+	}
+}
+
+// TestCloseRaceLosers 落败但也完成了握手的连接以 errCodeDialRaceLost 关闭
+func TestCloseRaceLosers(t *testing.T) {
+	client, server := testQUICPair(t, nil)
+	results := make(chan dialResult, 2)
+	results <- dialResult{addr: "192.0.2.1:443", err: context.Canceled}
+	results <- dialResult{addr: client.RemoteAddr().String(), conn: client}
+	closeRaceLosers(results, 2)
+
+	select {
+	case <-server.Context().Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("落败的连接未关闭")
+	}
+	var appErr *quic.ApplicationError
+	if err := context.Cause(server.Context()); !errors.As(err, &appErr) || appErr.ErrorCode != errCodeDialRaceLost {
+		t.Fatalf("节点收到的关闭原因 %v", err)
+	}
+}
+
+func TestInterleaveFamilies(t *testing.T) {
+	addrs := []string{"203.0.113.1:443", "203.0.113.2:443", "[2001:db8::1]:443", "[2001:db8::2]:443", "203.0.113.3:443"}
+	if got, want := interleaveFamilies(addrs, FamilyIPv6), []string{"[2001:db8::1]:443", "203.0.113.1:443", "[2001:db8::2]:443", "203.0.113.2:443", "203.0.113.3:443"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("IPv6 优先 %v", got)
+	}
+	if got, want := interleaveFamilies(addrs, FamilyIPv4), []string{"203.0.113.1:443", "[2001:db8::1]:443", "203.0.113.2:443", "[2001:db8::2]:443", "203.0.113.3:443"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("IPv4 优先 %v", got)
+	}
+	if addrFamily("[::ffff:203.0.113.1]:443") != FamilyIPv4 || addrFamily("node.example.com:443") != FamilyIPv4 {
+		t.Fatal("IPv4 映射地址与域名应按 IPv4 处理")
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 重连退避：一次重连的全部候选地址都失败后开始退避，每多失败一次翻倍，直到上限
+const (
+	reconnectBaseDelay = 5 * time.Second
+	reconnectMaxDelay  = 60 * time.Second
+)
+
+// resolveTimeout 单次解析节点域名的超时
+const resolveTimeout = 5 * time.Second
+
+// Resolver 节点域名解析器（*net.Resolver 满足该接口）
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dialTarget 节点地址的解析结果与重连状态
+// 每次重连都重新解析节点域名（运营方通过修改 DNS 迁移节点），多条 A / AAAA 记录同时参与拨号竞速（见 race.go）；
+// 解析结果变化时清零退避，立即连接新地址
+type dialTarget struct {
+	mu       sync.Mutex
+	addrs    []string  // 最近一次解析到的地址（ip:port，保持解析器返回的顺序）
+	next     int       // 下一次最先尝试的记录下标（上次连接成功的记录，失败后轮换）
+	family   string    // 上次竞速胜出的地址族（为空表示尚未连接成功过），之后的竞速优先尝试该地址族
+	failures int       // 连续失败次数（解析结果变化或连接成功时清零）
+	retryAt  time.Time // 退避结束时刻（零值表示不退避）
+}
+
+// SetResolver 设置节点域名解析器（如 DoH 解析器），nil 恢复系统解析器；在 Start 之前调用
+func (c *Client) SetResolver(r Resolver) {
+	c.resolver = r
+}
+
+// resolveServer 解析节点地址，返回 ip:port 列表（节点地址本身是 IP 时直接返回）
+func (c *Client) resolveServer() ([]string, error) {
+	server := c.ServerAddr()
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, fmt.Errorf("节点地址无效: %w", err)
+	}
+	if net.ParseIP(host) != nil {
+		return []string{server}, nil
+	}
+
+	r := c.resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, resolveTimeout)
+	defer cancel()
+	ips, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("解析节点域名失败: %w", err)
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.IP.String(), port)
+		if !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("节点域名没有解析记录: %s", host)
+	}
+	return addrs, nil
+}
+
+// refreshTarget 重新解析节点地址并更新记录集合，返回集合是否变化
+// 解析失败时沿用上次的结果（DNS 临时不可用不影响重连已知地址）；从未解析成功时返回错误
+func (c *Client) refreshTarget() (bool, error) {
+	addrs, err := c.resolveServer()
+
+	t := &c.target
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		if len(t.addrs) == 0 {
+			return false, err
+		}
+		log.Printf("⚠️ %v，沿用上次的解析结果 %v", err, t.addrs)
+		return false, nil
+	}
+	if sameAddrSet(t.addrs, addrs) {
+		return false, nil
+	}
+	if len(t.addrs) > 0 {
+		log.Printf("🌐 节点地址解析结果变化: %v → %v，重置重连退避", t.addrs, addrs)
+	}
+	t.addrs = addrs
+	t.next = 0
+	t.failures = 0
+	t.retryAt = time.Time{}
+	return true, nil
+}
+
+// dialCandidates 重新解析后给出本次拨号竞速的候选地址
+// 从 next 指向的记录开始轮换，再按地址族交替排列：上次胜出的地址族在前（尚未连接成功过时以第一条记录的地址族为准）
+func (c *Client) dialCandidates() ([]string, error) {
+	if _, err := c.refreshTarget(); err != nil {
+		return nil, err
+	}
+	t := &c.target
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	start := t.next % len(t.addrs)
+	addrs := append(slices.Clone(t.addrs[start:]), t.addrs[:start]...)
+	first := t.family
+	if first == "" {
+		first = addrFamily(addrs[0])
+	}
+	return interleaveFamilies(addrs, first), nil
+}
+
+// dialFinished 记录一次拨号竞速的结果：成功时清零退避，记住胜出的记录与地址族；失败时轮换起始记录并退避（5s、10s、20s… 最长 60s）
+// addrs 为本次的候选地址，winner 为胜出的地址
+func (c *Client) dialFinished(addrs []string, winner string, err error) {
+	t := &c.target
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !sameAddrSet(t.addrs, addrs) {
+		return // 拨号期间解析结果已变化
+	}
+	if err == nil {
+		t.next = slices.Index(t.addrs, winner)
+		t.family = addrFamily(winner)
+		t.failures = 0
+		t.retryAt = time.Time{}
+		return
+	}
+	t.next = (t.next + 1) % len(t.addrs)
+	t.failures++
+	delay := min(reconnectBaseDelay<<(min(t.failures, 8)-1), reconnectMaxDelay)
+	t.retryAt = time.Now().Add(delay)
+}
+
+// reconnectDue 断线重连守护是否应该在本轮尝试重连
+// 退避期间仍会重新解析节点地址，解析结果变化时立即重连
+func (c *Client) reconnectDue() bool {
+	c.target.mu.Lock()
+	waiting := time.Now().Before(c.target.retryAt)
+	c.target.mu.Unlock()
+	if !waiting {
+		return true
+	}
+	changed, _ := c.refreshTarget()
+	return changed
+}
+
+// sameAddrSet 两组地址是否相同（忽略顺序）
+func sameAddrSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, addr := range a {
+		if !slices.Contains(b, addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver 返回可随时修改的解析记录，并统计解析次数
+type fakeResolver struct {
+	mu      sync.Mutex
+	records []string
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	var ips []net.IPAddr
+	for _, s := range r.records {
+		ips = append(ips, net.IPAddr{IP: net.ParseIP(s)})
+	}
+	return ips, nil
+}
+
+// set 修改解析记录（err 不为 nil 时解析失败）
+func (r *fakeResolver) set(err error, records ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records, r.err = records, err
+}
+
+// newResolveClient 节点地址为 server、使用 fakeResolver 的客户端
+func newResolveClient(t *testing.T, server string) (*Client, *fakeResolver) {
+	t.Helper()
+	c := NewClient(server, "", 0, ModeGlobal)
+	r := &fakeResolver{}
+	c.SetResolver(r)
+	t.Cleanup(c.Stop)
+	return c, r
+}
+
+func TestDialCandidatesReResolve(t *testing.T) {
+	c, r := newResolveClient(t, "node.example.com:443")
+	r.set(nil, "203.0.113.1", "203.0.113.2", "203.0.113.1") // 重复记录只保留一条
+
+	addrs, err := c.dialCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"203.0.113.1:443", "203.0.113.2:443"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("候选地址 %v，期望 %v", addrs, want)
+	}
+
+	// 失败后轮换起始记录并退避
+	c.dialFinished(addrs, "", errors.New("timeout"))
+	if addrs, _ = c.dialCandidates(); addrs[0] != "203.0.113.2:443" {
+		t.Fatalf("失败后的候选地址 %v，期望从第二条记录开始", addrs)
+	}
+	if r.lookups != 2 {
+		t.Fatalf("解析了 %d 次，期望每次拨号都重新解析", r.lookups)
+	}
+	if c.reconnectDue() {
+		t.Fatal("退避期间且解析结果未变化时不应重连")
+	}
+
+	// 节点迁移：解析结果变化时清零退避并立即重连
+	r.set(nil, "198.51.100.7")
+	if !c.reconnectDue() {
+		t.Fatal("解析结果变化后未立即重连")
+	}
+	c.target.mu.Lock()
+	failures, retryAt := c.target.failures, c.target.retryAt
+	c.target.mu.Unlock()
+	if failures != 0 || !retryAt.IsZero() {
+		t.Fatalf("解析结果变化后退避未清零: %d %v", failures, retryAt)
+	}
+	if addrs, _ = c.dialCandidates(); !reflect.DeepEqual(addrs, []string{"198.51.100.7:443"}) {
+		t.Fatalf("迁移后的候选地址 %v", addrs)
+	}
+}
+
+func TestDialFinishedBackoff(t *testing.T) {
+	c, r := newResolveClient(t, "node.example.com:443")
+	r.set(nil, "203.0.113.1", "203.0.113.2")
+	addrs, _ := c.dialCandidates()
+
+	var delays []time.Duration
+	for i := 0; i < 6; i++ {
+		c.dialFinished(addrs, "", errors.New("timeout"))
+		c.target.mu.Lock()
+		delays = append(delays, time.Until(c.target.retryAt).Round(time.Second))
+		c.target.mu.Unlock()
+	}
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 60 * time.Second, 60 * time.Second}
+	if !reflect.DeepEqual(delays, want) {
+		t.Fatalf("退避 %v，期望 %v", delays, want)
+	}
+
+	// 成功后清零退避，下次从胜出的记录开始
+	c.dialFinished(addrs, "203.0.113.2:443", nil)
+	if !c.reconnectDue() {
+		t.Fatal("连接成功后仍在退避")
+	}
+	if addrs, _ := c.dialCandidates(); addrs[0] != "203.0.113.2:443" {
+		t.Fatalf("成功后的候选地址 %v，期望从胜出的记录开始", addrs)
+	}
+
+	// 拨号期间解析结果已变化：旧结果不影响新记录集合的状态
+	stale := addrs
+	r.set(nil, "198.51.100.7")
+	c.dialCandidates()
+	c.dialFinished(stale, "", errors.New("timeout"))
+	if !c.reconnectDue() {
+		t.Fatal("过期的拨号结果触发了退避")
+	}
+}
+
+func TestResolveServerFailures(t *testing.T) {
+	c, r := newResolveClient(t, "node.example.com:443")
+
+	// 从未解析成功：返回错误
+	r.set(errors.New("SERVFAIL"))
+	if _, err := c.dialCandidates(); err == nil {
+		t.Fatal("从未解析成功时应返回错误")
+	}
+	r.set(nil)
+	if _, err := c.dialCandidates(); err == nil {
+		t.Fatal("没有解析记录时应返回错误")
+	}
+
+	// 解析临时失败：沿用上次的结果
+	r.set(nil, "203.0.113.1")
+	c.dialCandidates()
+	r.set(errors.New("SERVFAIL"))
+	if addrs, err := c.dialCandidates(); err != nil || !reflect.DeepEqual(addrs, []string{"203.0.113.1:443"}) {
+		t.Fatalf("解析失败时返回 %v %v，期望沿用上次的结果", addrs, err)
+	}
+
+	// 节点地址是 IP 时不解析
+	ipClient, ipResolver := newResolveClient(t, "198.51.100.9:443")
+	if addrs, err := ipClient.dialCandidates(); err != nil || !reflect.DeepEqual(addrs, []string{"198.51.100.9:443"}) || ipResolver.lookups != 0 {
+		t.Fatalf("IP 地址返回 %v %v，解析 %d 次", addrs, err, ipResolver.lookups)
+	}
+}
+
+func TestDialCandidatesInterleaveFamilies(t *testing.T) {
+	c, r := newResolveClient(t, "node.example.com:443")
+	r.set(nil, "2001:db8::1", "2001:db8::2", "203.0.113.1")
+
+	addrs, _ := c.dialCandidates()
+	if want := []string{"[2001:db8::1]:443", "203.0.113.1:443", "[2001:db8::2]:443"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("候选地址 %v，期望 %v", addrs, want)
+	}
+	// 之后优先尝试上次胜出的地址族
+	c.dialFinished(addrs, "203.0.113.1:443", nil)
+	if addrs, _ := c.dialCandidates(); addrs[0] != "203.0.113.1:443" || addrFamily(addrs[1]) != FamilyIPv6 {
+		t.Fatalf("IPv4 胜出后的候选地址 %v", addrs)
+	}
+}
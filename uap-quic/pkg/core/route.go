@@ -0,0 +1,99 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// 分流动作
+const (
+	RouteProxy  = "proxy"  // 走代理
+	RouteDirect = "direct" // 直连
+	RouteBlock  = "block"  // 拒绝
+)
+
+// 分流原因
+const (
+	RouteReasonLocal      = "local"       // localhost / 回环地址 / 带 zone 的链路本地地址，任何模式下都直连
+	RouteReasonGlobal     = "global"      // 全局模式，全部走代理
+	RouteReasonRule       = "rule"        // 智能模式，命中规则走代理
+	RouteReasonUnmatched  = "unmatched"   // 智能模式，未命中规则，按策略处理（见 SetUnmatchedPolicy）
+	RouteReasonKillSwitch = "kill_switch" // 应走代理但隧道不可用，被 kill switch 拒绝
+)
+
+// RouteDecision 分流判断结果
+type RouteDecision struct {
+	Host      string `json:"host"`                // 规范化后的目标主机
+	Mode      string `json:"mode"`                // 当前代理模式（smart / global）
+	Action    string `json:"action"`              // proxy / direct / block
+	Reason    string `json:"reason"`              // 见 RouteReason* 常量
+	Rule      string `json:"rule,omitempty"`      // 命中的规则
+	Tag       string `json:"tag,omitempty"`       // 命中规则的流量类型标签（bulk / game，走代理时随转发请求告知服务端）
+	Unmatched string `json:"unmatched,omitempty"` // 生效的未命中规则策略（reason 为 unmatched 时）
+	Hosts     string `json:"hosts,omitempty"`     // hosts 覆盖（"域名 → IP (命中条目)"，分流仍按原域名判断）
+	TunnelUp  bool   `json:"tunnel_up"`           // 当前隧道是否可用（TestRoute 填写）
+
+	Failing []TargetPenalty `json:"failing,omitempty"` // 该主机最近拒绝连接或不可达的端口，冷却期内的请求直接失败（TestRoute 填写）
+}
+
+// TestRoute 按当前的模式、规则、未命中规则策略与 kill switch 判断 host 的去向，不建立连接、不计入规则命中统计
+// host 可以是域名、IP 字面量（IPv6 可带方括号）或 host:port，用于"为什么这个网站没走代理"之类的诊断
+func (c *Client) TestRoute(host string) RouteDecision {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = normalizeHost(host)
+
+	d := c.route(host, false)
+	_, d.Hosts = c.applyHosts(net.JoinHostPort(host, "0"))
+	d.TunnelUp = c.tunnelUp()
+	d.Failing = c.penalties.snapshot(host, time.Now())
+	return d
+}
+
+// route 分流判断（host 已规范化）；count 为 true 时计入规则命中次数（实际连接）
+func (c *Client) route(host string, count bool) RouteDecision {
+	d := RouteDecision{Host: host, Mode: c.Mode(), Action: RouteProxy}
+	switch {
+	case isLocalhost(host) || hasZone(host):
+		d.Action, d.Reason = RouteDirect, RouteReasonLocal
+	case d.Mode == ModeGlobal:
+		// 全局模式不按规则分流，但规则的流量类型标签仍然生效
+		d.Reason = RouteReasonGlobal
+		if c.proxyRouter != nil {
+			d.Tag = c.proxyRouter.Tag(host)
+		}
+	default:
+		if rule, tag, ok := c.matchRule(host, count); ok {
+			d.Reason, d.Rule, d.Tag = RouteReasonRule, rule, tag
+			break
+		}
+		d.Reason, d.Unmatched = RouteReasonUnmatched, c.unmatched()
+		switch d.Unmatched {
+		case UnmatchedDirect:
+			d.Action = RouteDirect
+		case UnmatchedBlock:
+			d.Action = RouteBlock
+		}
+	}
+
+	// 应走代理的连接受 kill switch 约束：隧道不可用时拒绝，而不是泄露到本机出口
+	if d.Action == RouteProxy && c.killSwitch.Load() && !c.tunnelUp() {
+		d.Action, d.Reason = RouteBlock, RouteReasonKillSwitch
+	}
+	return d
+}
+
+// matchRule 智能模式下 host 命中的规则与标签；count 为 true 时计入规则命中次数
+func (c *Client) matchRule(host string, count bool) (string, string, bool) {
+	if c.proxyRouter == nil {
+		return "", "", false
+	}
+	if count {
+		return c.proxyRouter.Hit(host)
+	}
+	rule, ok := c.proxyRouter.Match(host)
+	return rule, c.proxyRouter.Tag(host), ok
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"uap-quic/pkg/router"
+)
+
+// newRoutingClient 只用于分流判断的客户端（不连接节点），rules 为规则文本
+func newRoutingClient(t *testing.T, mode, rules string) *Client {
+	t.Helper()
+	c := NewClient("127.0.0.1:1", "", 0, mode)
+	c.proxyRouter = router.NewRouter()
+	c.proxyRouter.LoadRulesFromString(rules)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+// connectThrough 经 handleTCPConnect 转发到 target，返回 SOCKS5 回复码
+func connectThrough(t *testing.T, c *Client, target string) byte {
+	t.Helper()
+	app, local := net.Pipe()
+	defer app.Close()
+	go func() {
+		defer local.Close()
+		c.handleTCPConnect(local, target)
+	}()
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(app, reply); err != nil {
+		t.Fatalf("读取 SOCKS5 回复失败: %v", err)
+	}
+	return reply[1]
+}
+
+func TestGetStatsCountsDecisions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	c := newRoutingClient(t, ModeSmart, "example.com\n")
+	for i := 0; i < 2; i++ {
+		if rep := connectThrough(t, c, ln.Addr().String()); rep != 0x00 {
+			t.Fatalf("直连本机目标回复 0x%02x", rep)
+		}
+	}
+	c.route("www.example.com", true)
+	c.route("www.example.com", false) // 诊断查询不计入命中
+
+	stats := c.GetStats(0)
+	if stats.Direct != 2 || stats.Proxy != 0 {
+		t.Fatalf("直连 %d / 代理 %d，期望 2 / 0", stats.Direct, stats.Proxy)
+	}
+	if len(stats.TopRules) != 1 || stats.TopRules[0].Rule != "example.com" || stats.TopRules[0].Hits != 1 {
+		t.Fatalf("规则命中统计 %+v", stats.TopRules)
+	}
+	if stats.Mode != ModeSmart {
+		t.Fatalf("模式 %q", stats.Mode)
+	}
+}
+
+func TestKillSwitch(t *testing.T) {
+	c := newRoutingClient(t, ModeSmart, "example.com\n")
+
+	// 关闭时隧道断开也不拦截（之后由开流失败报错）
+	if d := c.route("www.example.com", false); d.Action != RouteProxy {
+		t.Fatalf("kill switch 关闭时的决策 %+v", d)
+	}
+
+	c.SetKillSwitch(true)
+	if d := c.route("www.example.com", false); d.Action != RouteBlock || d.Reason != RouteReasonKillSwitch {
+		t.Fatalf("隧道断开时应走代理的连接 %+v", d)
+	}
+	// 直连的目标不受影响
+	if d := c.route("other.org", false); d.Action != RouteDirect {
+		t.Fatalf("直连目标 %+v", d)
+	}
+	if rep := connectThrough(t, c, "www.example.com:443"); rep != 0x02 {
+		t.Fatalf("kill switch 拒绝时回复 0x%02x，期望 0x02", rep)
+	}
+	if stats := c.GetStats(0); stats.Blocked != 1 || stats.Proxy != 0 {
+		t.Fatalf("统计 %+v", stats)
+	}
+
+	// 隧道恢复后放行
+	conn, _ := testQUICPair(t, nil)
+	setQuicConnection(c, conn)
+	if d := c.route("www.example.com", false); d.Action != RouteProxy {
+		t.Fatalf("隧道可用时的决策 %+v", d)
+	}
+}
+
+func TestTestRoute(t *testing.T) {
+	c := newRoutingClient(t, ModeSmart, "google.com\n")
+	for _, tc := range []struct {
+		host, action, reason, rule string
+	}{
+		{"www.google.com", RouteProxy, RouteReasonRule, "google.com"},
+		{" Mail.Google.com:443 ", RouteProxy, RouteReasonRule, "google.com"},
+		{"google.com.hk", RouteDirect, RouteReasonUnmatched, ""},
+		{"localhost", RouteDirect, RouteReasonLocal, ""},
+		{"127.0.0.1:8080", RouteDirect, RouteReasonLocal, ""},
+		{"[::1]:443", RouteDirect, RouteReasonLocal, ""},
+	} {
+		d := c.TestRoute(tc.host)
+		if d.Action != tc.action || d.Reason != tc.reason || d.Rule != tc.rule || d.Mode != ModeSmart {
+			t.Errorf("TestRoute(%q) = %+v，期望 %s / %s / %q", tc.host, d, tc.action, tc.reason, tc.rule)
+		}
+	}
+	// 诊断查询不计入规则命中与分流统计
+	if stats := c.GetStats(0); len(stats.TopRules) != 0 || stats.Proxy+stats.Direct != 0 {
+		t.Fatalf("TestRoute 计入了统计 %+v", stats)
+	}
+
+	// 未命中规则时给出生效的策略
+	c.SetUnmatchedPolicy(UnmatchedBlock)
+	if d := c.TestRoute("example.org"); d.Action != RouteBlock || d.Unmatched != UnmatchedBlock {
+		t.Fatalf("未命中规则按 block 策略 %+v", d)
+	}
+	c.SetUnmatchedPolicy(UnmatchedProxy)
+	if d := c.TestRoute("example.org"); d.Action != RouteProxy || d.Reason != RouteReasonUnmatched || d.Unmatched != UnmatchedProxy || d.TunnelUp {
+		t.Fatalf("未命中规则按 proxy 策略 %+v", d)
+	}
+
+	// 全局模式全部走代理，不再给出命中的规则
+	g := newRoutingClient(t, ModeGlobal, "google.com\n")
+	if d := g.TestRoute("example.org"); d.Action != RouteProxy || d.Reason != RouteReasonGlobal || d.Mode != ModeGlobal || d.Rule != "" {
+		t.Fatalf("全局模式 %+v", d)
+	}
+}
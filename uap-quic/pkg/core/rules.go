@@ -0,0 +1,211 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"uap-quic/pkg/router"
+)
+
+// DefaultRulesRefresh 远程规则列表的默认刷新间隔
+const DefaultRulesRefresh = time.Hour
+
+// minRulesRefresh 远程规则列表的最短刷新间隔
+const minRulesRefresh = time.Minute
+
+// 当前规则的来源
+const (
+	RulesSourceFile   = "file"   // 本地规则文件
+	RulesSourceInline = "inline" // 通过 SetRules 传入的规则文本
+	RulesSourceCache  = "cache"  // 上次下载成功的远程列表（缓存文件）
+	RulesSourceRemote = "remote" // 本次运行中下载的远程列表
+)
+
+// rulesVersion 当前生效的远程规则（缓存或下载）
+type rulesVersion struct {
+	source    string
+	sha256    string
+	updatedAt time.Time
+}
+
+// SetRules 设置内存中的规则文本（格式与规则文件相同，换行分隔，需在 Start 之前设置）
+// 设置后 Start 直接加载该文本，不读取规则文件，适合没有可用文件路径的移动端；空字符串恢复使用规则文件
+func (c *Client) SetRules(rules string) {
+	c.rulesText = rules
+}
+
+// maxLoggedRuleWarnings 加载本地规则时逐条打印的诊断上限（其余只打印条数，完整列表用客户端的 -check-rules 查看）
+const maxLoggedRuleWarnings = 20
+
+// loadLocalRules 加载本地规则（Start 中调用）：设置了 SetRules 时加载内存中的文本，否则读取规则文件
+// 按严格模式解析（见 router.LoadStrict），纠正、跳过、重复与被覆盖的行逐条提示；
+// 没有加载到任何规则且没有远程规则列表时明确提示，避免 smart 模式下所有目标都按未命中规则处理却不知道原因
+func (c *Client) loadLocalRules(file string) {
+	// 先加载到新的路由器再整体替换：加载期间的分流查询不会读到正在插入的树
+	r := router.NewRouter()
+	if c.rulesText != "" {
+		c.rulesFile.Store("")
+		report := r.LoadRulesFromStringReport(c.rulesText, router.LoadStrict)
+		logRulesReport(report)
+		log.Printf("✅ 路由器加载成功（内存规则），规则数: %d，版本: %s", report.Loaded, r.Version())
+	} else {
+		c.rulesFile.Store(file)
+		if _, err := os.Stat(file); err != nil {
+			log.Printf("⚠️ 规则文件不可用: %v", err)
+		} else if report, err := r.LoadRulesReport(file, router.LoadStrict); err != nil {
+			log.Printf("⚠️ 路由规则加载失败: %v (默认空规则)", err)
+		} else {
+			logRulesReport(report)
+			log.Printf("✅ 路由器加载成功，规则数: %d，版本: %s", r.GetRuleCount(), r.Version())
+		}
+	}
+	c.proxyRouter.ReplaceWith(r)
+	if r.GetRuleCount() == 0 && c.rulesURL == "" {
+		log.Printf("⚠️ 没有任何分流规则：smart 模式下所有目标都按未命中规则的策略处理 (%s)", c.unmatched())
+	}
+}
+
+// logRulesReport 打印规则加载报告中的诊断（最多 maxLoggedRuleWarnings 条）
+func logRulesReport(report router.LoadReport) {
+	for i, w := range report.Warnings {
+		if i == maxLoggedRuleWarnings {
+			log.Printf("⚠️ [规则] 还有 %d 条诊断未显示", len(report.Warnings)-i)
+			break
+		}
+		log.Printf("⚠️ [规则] %s", w)
+	}
+	if report.Skipped > 0 {
+		log.Printf("⚠️ [规则] 已跳过 %d 行无法解析的规则", report.Skipped)
+	}
+}
+
+// SetRulesURL 设置远程规则列表地址（HTTPS，需在 Start 之前设置）：启动后立即下载，之后每隔 interval 刷新，
+// 下载成功且校验通过时整体替换规则（原子切换，进行中的分流判断不受影响）。interval <= 0 使用默认值（1 小时）
+// cacheFile 不为空时把最近一次可用的列表保存到该文件，下次启动先加载缓存；下载失败时继续使用当前规则。
+// 规则来源优先级：本次下载 > 缓存 > 本地规则文件
+func (c *Client) SetRulesURL(url string, interval time.Duration, cacheFile string) error {
+	if url != "" {
+		if err := router.CheckRulesURL(url); err != nil {
+			return err
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultRulesRefresh
+	}
+	if interval < minRulesRefresh {
+		interval = minRulesRefresh
+	}
+	c.rulesURL, c.rulesRefresh, c.rulesCache = url, interval, cacheFile
+	return nil
+}
+
+// startRemoteRules 加载缓存的远程规则并启动定期刷新（Start 中调用，本地规则文件已加载）
+func (c *Client) startRemoteRules() {
+	if c.rulesCache != "" {
+		if data, err := os.ReadFile(c.rulesCache); err == nil {
+			if n, err := c.proxyRouter.ReplaceRules(data); err != nil {
+				log.Printf("⚠️ 远程规则缓存无效，忽略: %v", err)
+			} else {
+				c.setRulesVersion(RulesSourceCache, data)
+				log.Printf("✅ 已加载远程规则缓存，规则数: %d，版本: %s", n, c.proxyRouter.Version())
+			}
+		}
+	}
+	go c.rulesRefreshLoop()
+}
+
+// rulesRefreshLoop 定期下载远程规则列表，直到客户端停止
+func (c *Client) rulesRefreshLoop() {
+	ticker := time.NewTicker(c.rulesRefresh)
+	defer ticker.Stop()
+
+	for {
+		c.refreshRules()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRules 下载一次远程规则列表；内容未变化时不替换（保留规则命中统计）
+func (c *Client) refreshRules() {
+	data, err := router.FetchRules(c.ctx, c.rulesURL)
+	if err == nil {
+		if v := c.remoteRules.Load(); v != nil && v.sha256 == rulesSHA256(data) {
+			if v.source != RulesSourceRemote {
+				c.setRulesVersion(RulesSourceRemote, data)
+			}
+			return
+		}
+		var n int
+		if n, err = c.proxyRouter.ReplaceRules(data); err == nil {
+			c.setRulesVersion(RulesSourceRemote, data)
+			log.Printf("✅ 远程规则已更新，规则数: %d，版本: %s", n, c.proxyRouter.Version())
+			c.saveRulesCache(data)
+			return
+		}
+	}
+	if c.ctx.Err() != nil {
+		return
+	}
+	source := c.localRulesSource()
+	if v := c.remoteRules.Load(); v != nil {
+		source = v.source
+	}
+	log.Printf("⚠️ 更新远程规则失败，继续使用当前规则 (%s): %v", source, err)
+}
+
+// saveRulesCache 保存最近一次可用的远程列表（先写临时文件再改名，避免留下半个文件）
+func (c *Client) saveRulesCache(data []byte) {
+	if c.rulesCache == "" {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.rulesCache), ".rules-*")
+	if err == nil {
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), c.rulesCache)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ 保存远程规则缓存失败: %v", err)
+	}
+}
+
+// loadedRulesFile 当前加载的规则文件（未启动或使用 SetRules 的文本时为空）
+func (c *Client) loadedRulesFile() string {
+	file, _ := c.rulesFile.Load().(string)
+	return file
+}
+
+// localRulesSource 本地规则的来源（规则文件或 SetRules 传入的文本）
+func (c *Client) localRulesSource() string {
+	if c.rulesText != "" {
+		return RulesSourceInline
+	}
+	return RulesSourceFile
+}
+
+// setRulesVersion 记录当前生效的远程规则
+func (c *Client) setRulesVersion(source string, data []byte) {
+	c.remoteRules.Store(&rulesVersion{source: source, sha256: rulesSHA256(data), updatedAt: time.Now()})
+}
+
+// rulesSHA256 规则内容的摘要（规则版本）
+func rulesSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rulesServer 可切换回复的远程规则列表服务
+type rulesServer struct {
+	mu     sync.Mutex
+	status int
+	body   string
+	url    string
+}
+
+func startRulesServer(t *testing.T, body string) *rulesServer {
+	s := &rulesServer{status: http.StatusOK, body: body}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.WriteHeader(s.status)
+		w.Write([]byte(s.body))
+	}))
+	t.Cleanup(srv.Close)
+	s.url = srv.URL
+	return s
+}
+
+func (s *rulesServer) set(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.body = status, body
+}
+
+// newRemoteRulesClient 使用本地规则 local 与远程列表 url 的客户端（不连接节点，不启动刷新循环）
+func newRemoteRulesClient(t *testing.T, local, url, cache string) *Client {
+	t.Helper()
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+	c.SetRules(local)
+	if err := c.SetRulesURL(url, 0, cache); err != nil {
+		t.Fatal(err)
+	}
+	c.loadLocalRules("")
+	return c
+}
+
+// rulesSource 当前规则的来源
+func rulesSource(c *Client) string {
+	if v := c.remoteRules.Load(); v != nil {
+		return v.source
+	}
+	return c.localRulesSource()
+}
+
+func TestRemoteRulesRefresh(t *testing.T) {
+	srv := startRulesServer(t, "example.com\n")
+	cache := filepath.Join(t.TempDir(), "rules-cache.txt")
+	c := newRemoteRulesClient(t, "google.com\n", srv.url, cache)
+	if d := c.TestRoute("www.google.com"); d.Action != RouteProxy || rulesSource(c) != RulesSourceInline {
+		t.Fatalf("下载前使用本地规则 %+v (%s)", d, rulesSource(c))
+	}
+
+	// 下载成功：整体替换规则并保存缓存
+	c.refreshRules()
+	if c.TestRoute("www.google.com").Action != RouteDirect || c.TestRoute("www.example.com").Rule != "example.com" || rulesSource(c) != RulesSourceRemote {
+		t.Fatalf("下载后的规则 (%s)", rulesSource(c))
+	}
+	if data, err := os.ReadFile(cache); err != nil || string(data) != "example.com\n" {
+		t.Fatalf("缓存 %q: %v", data, err)
+	}
+
+	// 内容未变化时不替换，保留规则命中统计
+	c.route("www.example.com", true)
+	c.refreshRules()
+	if top := c.GetStats(0).TopRules; len(top) != 1 || top[0].Hits != 1 {
+		t.Fatalf("内容未变化时命中统计被重置 %+v", top)
+	}
+
+	// 下载失败或内容无效：继续使用上次可用的列表，缓存不变
+	for _, tc := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusInternalServerError, "example.org\n"},
+		{http.StatusOK, "<html>login</html>\n"},
+	} {
+		srv.set(tc.status, tc.body)
+		c.refreshRules()
+		if c.TestRoute("www.example.com").Action != RouteProxy || c.TestRoute("www.example.org").Action != RouteDirect {
+			t.Fatalf("HTTP %d 后规则被替换", tc.status)
+		}
+	}
+	if data, _ := os.ReadFile(cache); string(data) != "example.com\n" {
+		t.Fatalf("失败的下载改写了缓存 %q", data)
+	}
+
+	// 列表更新后再次替换
+	srv.set(http.StatusOK, "example.org\n")
+	c.refreshRules()
+	if c.TestRoute("www.example.org").Action != RouteProxy || c.TestRoute("www.example.com").Action != RouteDirect {
+		t.Fatal("列表更新后规则未替换")
+	}
+}
+
+func TestRemoteRulesCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "rules-cache.txt")
+	if err := os.WriteFile(cache, []byte("cached.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 启动时先加载缓存：下载失败时缓存优先于本地规则
+	srv := startRulesServer(t, "")
+	srv.set(http.StatusServiceUnavailable, "")
+	c := newRemoteRulesClient(t, "google.com\n", srv.url, cache)
+	c.startRemoteRules()
+	if c.TestRoute("a.cached.example").Action != RouteProxy || c.TestRoute("www.google.com").Action != RouteDirect || rulesSource(c) != RulesSourceCache {
+		t.Fatalf("未使用缓存 (%s)", rulesSource(c))
+	}
+
+	// 缓存无效时忽略，继续使用本地规则
+	if err := os.WriteFile(cache, []byte("<html>\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c = newRemoteRulesClient(t, "google.com\n", srv.url, cache)
+	c.startRemoteRules()
+	if c.TestRoute("www.google.com").Action != RouteProxy || rulesSource(c) != RulesSourceInline {
+		t.Fatalf("无效缓存后未使用本地规则 (%s)", rulesSource(c))
+	}
+}
+
+func TestSetRulesURL(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+	if err := c.SetRulesURL("http://rules.example.com/list.txt", 0, ""); err == nil {
+		t.Fatal("非本机的 http 地址被接受")
+	}
+	if err := c.SetRulesURL("https://rules.example.com/list.txt", 0, ""); err != nil || c.rulesRefresh != DefaultRulesRefresh {
+		t.Fatalf("默认刷新间隔 %v: %v", c.rulesRefresh, err)
+	}
+	if err := c.SetRulesURL("https://rules.example.com/list.txt", 1, ""); err != nil || c.rulesRefresh != minRulesRefresh {
+		t.Fatalf("刷新间隔下限 %v: %v", c.rulesRefresh, err)
+	}
+}
+
+// TestLoadLocalRules 内存中的规则优先于规则文件；规则文件不可用时明确提示没有任何规则
+func TestLoadLocalRules(t *testing.T) {
+	var out bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(old) })
+
+	file := filepath.Join(t.TempDir(), "whitelist.txt")
+	if err := os.WriteFile(file, []byte("google.com\nyoutube.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("127.0.0.1:1", "", 0, ModeSmart)
+	t.Cleanup(c.Stop)
+
+	c.loadLocalRules(file)
+	if n := c.proxyRouter.GetRuleCount(); n != 2 || c.loadedRulesFile() != file || rulesSource(c) != RulesSourceFile {
+		t.Fatalf("规则文件: %d 条，文件 %q，来源 %s", n, c.loadedRulesFile(), rulesSource(c))
+	}
+
+	c.SetRules("example.org\n")
+	c.loadLocalRules(file)
+	if c.proxyRouter.GetRuleCount() != 1 || c.loadedRulesFile() != "" || rulesSource(c) != RulesSourceInline {
+		t.Fatalf("内存规则未替换规则文件: %d 条，来源 %s", c.proxyRouter.GetRuleCount(), rulesSource(c))
+	}
+	if d := c.TestRoute("www.example.org"); d.Action != RouteProxy || d.Rule != "example.org" {
+		t.Fatalf("内存规则的分流结果 %+v", d)
+	}
+	if s := c.ConfigSnapshot(); s.RulesSource != RulesSourceInline || s.RulesSHA256 != rulesSHA256([]byte("example.org\n")) {
+		t.Fatalf("诊断快照 %s / %s", s.RulesSource, s.RulesSHA256)
+	}
+	version := c.proxyRouter.Version()
+	if s := c.GetStats(0); s.RuleCount != 1 || s.RulesVersion != version {
+		t.Fatalf("统计中的规则 %d 条，版本 %s，期望 %s", s.RuleCount, s.RulesVersion, version)
+	}
+	if s := c.ConfigSnapshot(); s.RuleCount != 1 || s.RulesVersion != version {
+		t.Fatalf("诊断快照的规则 %d 条，版本 %s", s.RuleCount, s.RulesVersion)
+	}
+	if !strings.Contains(out.String(), "版本: "+version) {
+		t.Fatalf("加载日志没有规则版本:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "没有任何分流规则") {
+		t.Fatalf("加载到规则时仍提示没有规则:\n%s", out.String())
+	}
+
+	// 恢复使用规则文件；文件不存在时不静默加载空规则
+	c.SetRules("")
+	c.loadLocalRules(filepath.Join(t.TempDir(), "missing.txt"))
+	if c.proxyRouter.GetRuleCount() != 0 {
+		t.Fatal("规则文件不存在时仍有规则")
+	}
+	if logs := out.String(); !strings.Contains(logs, "规则文件不可用") || !strings.Contains(logs, "没有任何分流规则") {
+		t.Fatalf("没有提示规则为空:\n%s", logs)
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signResponse 托管签名接口响应（未导出，仅内部使用）
+type signResponse struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+	Data  struct {
+		Signature string `json:"signature"`
+		PublicKey string `json:"public_key"`
+	} `json:"data"`
+	Msg string `json:"msg,omitempty"`
+}
+
+// SetSignedHandshake 开启/关闭签名握手（需要同时设置票据接口）
+// 开启后申请的连接票据绑定账户钱包公钥，握手时附带钱包对 "uap-connect:<jti>:<时间戳>" 的签名，单独泄露的票据无法使用
+// 节点需支持签名握手；uap-admin 不支持时票据不绑定钱包，握手与未开启时相同
+func (c *Client) SetSignedHandshake(enabled bool) {
+	c.signedAuth = enabled
+}
+
+// SetWalletKey 设置本地钱包私钥（Hex 编码，见 ParseWalletKey），签名握手优先使用本地私钥
+func (c *Client) SetWalletKey(keyHex string) error {
+	key, err := ParseWalletKey(keyHex)
+	if err != nil {
+		return err
+	}
+	c.walletKey = key
+	return nil
+}
+
+// ParseWalletKey 解析 Hex 编码的 Ed25519 钱包私钥（64 字节私钥或 32 字节种子）
+func ParseWalletKey(keyHex string) (ed25519.PrivateKey, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(keyHex))
+	if err != nil {
+		return nil, fmt.Errorf("钱包私钥不是有效的 Hex: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	default:
+		return nil, fmt.Errorf("钱包私钥长度错误（期望 %d 或 %d 字节，实际 %d 字节）", ed25519.PrivateKeySize, ed25519.SeedSize, len(raw))
+	}
+}
+
+// SetSignURL 设置托管签名接口地址（uap-admin 的 /api/v1/client/sign）
+// 没有与票据匹配的本地私钥时（邮箱注册的托管钱包），由 uap-admin 用托管私钥代为签名
+func (c *Client) SetSignURL(url string) {
+	c.signURL = url
+}
+
+// handshakeProof 为连接票据生成签名握手部分 "<时间戳>:<签名 Hex>"
+// 票据没有绑定钱包公钥（uap-admin 不支持签名握手）时返回空字符串
+func (c *Client) handshakeProof(ticket string) (string, error) {
+	jti, wpk, err := ticketWalletClaims(ticket)
+	if err != nil {
+		return "", err
+	}
+	if wpk == "" {
+		return "", nil
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	challenge := "uap-connect:" + jti + ":" + timestamp
+
+	// 优先使用本地私钥，公钥与票据不匹配时交给托管签名接口
+	if c.walletKey != nil && hex.EncodeToString(c.walletKey.Public().(ed25519.PublicKey)) == wpk {
+		return timestamp + ":" + hex.EncodeToString(ed25519.Sign(c.walletKey, []byte(challenge))), nil
+	}
+	if c.signURL == "" {
+		return "", fmt.Errorf("没有与账户钱包匹配的本地私钥，且未设置托管签名接口")
+	}
+
+	signature, publicKey, err := c.fetchCustodialSignature(challenge)
+	if err != nil {
+		return "", err
+	}
+	if publicKey != wpk {
+		return "", fmt.Errorf("托管签名公钥与票据不一致")
+	}
+	log.Printf("🔏 已获取托管钱包签名")
+	return timestamp + ":" + signature, nil
+}
+
+// fetchCustodialSignature 请求 uap-admin 用托管钱包私钥签名挑战
+func (c *Client) fetchCustodialSignature(challenge string) (string, string, error) {
+	body, err := json.Marshal(map[string]string{"challenge": challenge})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.signURL, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	SetAPIHeaders(req, c.userToken())
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	var signResp signResponse
+	if err := json.Unmarshal(respBody, &signResp); err != nil {
+		return "", "", fmt.Errorf("解析签名响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || signResp.Code != 200 || signResp.Data.Signature == "" {
+		return "", "", fmt.Errorf("签名接口: %w", ParseAPIError(resp.StatusCode, signResp.Code, signResp.Error, signResp.Msg))
+	}
+
+	return signResp.Data.Signature, signResp.Data.PublicKey, nil
+}
+
+// ticketWalletClaims 读取票据中的 jti 和钱包公钥（不验签，票据由节点验证）
+func ticketWalletClaims(ticket string) (string, string, error) {
+	parts := strings.Split(ticket, ".")
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("票据格式错误")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("票据格式错误: %w", err)
+	}
+
+	var claims struct {
+		JTI string `json:"jti"`
+		WPK string `json:"wpk"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", fmt.Errorf("票据格式错误: %w", err)
+	}
+	return claims.JTI, claims.WPK, nil
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testTicket 构造 payload 为 jti / wpk 的票据（签名部分不校验）
+func testTicket(jti, wpk string) string {
+	payload, _ := json.Marshal(map[string]string{"jti": jti, "wpk": wpk})
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+// checkProof 校验 "<时间戳>:<签名 Hex>" 是 pub 对 uap-connect:<jti>:<时间戳> 的签名
+func checkProof(t *testing.T, proof, jti string, pub ed25519.PublicKey) {
+	t.Helper()
+	timestamp, sigHex, ok := strings.Cut(proof, ":")
+	if !ok {
+		t.Fatalf("签名握手格式错误: %q", proof)
+	}
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Fatalf("签名握手时间戳 %q", timestamp)
+	}
+	sig, _ := hex.DecodeString(sigHex)
+	if !ed25519.Verify(pub, []byte("uap-connect:"+jti+":"+timestamp), sig) {
+		t.Fatal("签名握手无法用钱包公钥验证")
+	}
+}
+
+// custodialSignServer 模拟 uap-admin 托管签名接口，用 priv 签名并统计请求次数
+func custodialSignServer(t *testing.T, priv ed25519.PrivateKey, calls *atomic.Int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer user-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":40103,"error":"token_invalid","msg":"无效的 token"}`))
+			return
+		}
+		var req struct {
+			Challenge string `json:"challenge"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		sig := ed25519.Sign(priv, []byte(req.Challenge))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": 200,
+			"data": map[string]string{
+				"signature":  hex.EncodeToString(sig),
+				"public_key": hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestHandshakeProofLocalKey(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	var calls atomic.Int32
+	c := NewClient("127.0.0.1:1", "user-token", 0, ModeGlobal)
+	c.SetSignURL(custodialSignServer(t, priv, &calls))
+	if err := c.SetWalletKey(hex.EncodeToString(priv.Seed())); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := c.handshakeProof(testTicket("jti-1", hex.EncodeToString(pub)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProof(t, proof, "jti-1", pub)
+	if calls.Load() != 0 {
+		t.Fatal("有匹配的本地私钥时不应请求托管签名")
+	}
+}
+
+func TestHandshakeProofCustodialFallback(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	var calls atomic.Int32
+	c := NewClient("127.0.0.1:1", "user-token", 0, ModeGlobal)
+	c.SetSignURL(custodialSignServer(t, priv, &calls))
+	// 本地私钥与票据绑定的钱包不一致：交给托管签名接口
+	c.SetWalletKey(hex.EncodeToString(other))
+
+	proof, err := c.handshakeProof(testTicket("jti-2", hex.EncodeToString(pub)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProof(t, proof, "jti-2", pub)
+	if calls.Load() != 1 {
+		t.Fatalf("托管签名请求了 %d 次", calls.Load())
+	}
+
+	// 托管签名的公钥与票据不一致时拒绝使用
+	stranger, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := c.handshakeProof(testTicket("jti-3", hex.EncodeToString(stranger))); err == nil {
+		t.Fatal("托管签名公钥与票据不一致时应返回错误")
+	}
+}
+
+func TestHandshakeProofErrors(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	// 票据未绑定钱包：不附带签名
+	c := NewClient("127.0.0.1:1", "user-token", 0, ModeGlobal)
+	if proof, err := c.handshakeProof(testTicket("jti", "")); err != nil || proof != "" {
+		t.Fatalf("未绑定钱包的票据: %q %v", proof, err)
+	}
+	// 没有本地私钥也没有托管签名接口
+	if _, err := c.handshakeProof(testTicket("jti", hex.EncodeToString(pub))); err == nil {
+		t.Fatal("无法签名时应返回错误")
+	}
+	if _, err := c.handshakeProof("not-a-ticket"); err == nil {
+		t.Fatal("票据格式错误时应返回错误")
+	}
+
+	// 托管签名接口拒绝（token 失效）：错误可与 ErrTokenInvalid 匹配
+	var calls atomic.Int32
+	c = NewClient("127.0.0.1:1", "stale-token", 0, ModeGlobal)
+	c.SetSignURL(custodialSignServer(t, priv, &calls))
+	if _, err := c.handshakeProof(testTicket("jti", hex.EncodeToString(pub))); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("托管签名被拒返回 %v", err)
+	}
+}
+
+func TestParseWalletKey(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	for _, keyHex := range []string{hex.EncodeToString(priv), hex.EncodeToString(priv.Seed()), " " + hex.EncodeToString(priv.Seed()) + "\n"} {
+		key, err := ParseWalletKey(keyHex)
+		if err != nil || !key.Equal(priv) {
+			t.Fatalf("ParseWalletKey(%q) = %v", keyHex, err)
+		}
+	}
+	for _, keyHex := range []string{"", "zz", hex.EncodeToString(priv[:16])} {
+		if _, err := ParseWalletKey(keyHex); err == nil {
+			t.Errorf("ParseWalletKey(%q) 应返回错误", keyHex)
+		}
+	}
+}
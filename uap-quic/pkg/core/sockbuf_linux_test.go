@@ -0,0 +1,52 @@
+//go:build linux
+
+package core
+
+import (
+	"syscall"
+	"testing"
+
+	"uap-quic/pkg/sockbuf"
+)
+
+// TestUDPBuffers 连接节点的 UDP socket 按 SetUDPBuffers 设置缓冲区（未设置 socket 保护回调时也生效）
+func TestUDPBuffers(t *testing.T) {
+	addr, _ := startProtectListener(t)
+	c := NewClient(addr, "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	// 低于 sockbuf.Recommended 的接收缓冲区会被 quic-go 自行调大，这里请求更大的值
+	want := sockbuf.Config{Recv: 3 << 20, Send: 3 << 20}
+	c.SetUDPBuffers(want)
+
+	var fd int
+	c.SetSocketProtector(func(f int) error {
+		fd = f
+		return nil
+	})
+	conn, err := dialProtected(c, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	rcv, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snd, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := (sockbuf.Config{Recv: rcv / 2, Send: snd / 2}); got != want {
+		if got.Recv < want.Recv && got.Recv >= sockbuf.Recommended {
+			t.Skipf("内核上限低于请求且没有 CAP_NET_ADMIN: %+v", got)
+		}
+		t.Fatalf("UDP socket 缓冲区 %+v，期望 %+v", got, want)
+	}
+
+	// 设置为 0 恢复直接拨号
+	c.SetUDPBuffers(sockbuf.Config{})
+	if c.udpBuffers.Load() != nil {
+		t.Fatal("清除后仍有缓冲区设置")
+	}
+}
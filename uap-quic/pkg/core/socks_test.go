@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/target"
+)
+
+// setSOCKSHandshakeTimeout 测试期间替换本地 SOCKS5 握手的完成时限
+func setSOCKSHandshakeTimeout(t *testing.T, d time.Duration) {
+	old := socksHandshakeTimeout
+	socksHandshakeTimeout = d
+	t.Cleanup(func() { socksHandshakeTimeout = old })
+}
+
+// socksHandshake 在内存连接上交给 handleSOCKS5Client 处理，返回应用一端与处理结束的信号
+func socksHandshake(t *testing.T, c *Client) (net.Conn, chan struct{}) {
+	t.Helper()
+	app, local := net.Pipe()
+	t.Cleanup(func() { app.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.handleSOCKS5Client(local)
+	}()
+	app.SetDeadline(time.Now().Add(5 * time.Second))
+	return app, done
+}
+
+// TestSOCKSHandshakeRejectsBadRequests 空域名、含空白或控制字符的域名回复 0x08，不支持的命令回复 0x07，没有方法的协商直接断开
+func TestSOCKSHandshakeRejectsBadRequests(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+
+	for name, tc := range map[string]struct {
+		request []byte
+		reply   byte
+	}{
+		"空域名":    {[]byte{0x05, 0x01, 0x00, 0x03, 0}, 0x08},
+		"域名含空格":  {append(append([]byte{0x05, 0x01, 0x00, 0x03, 8}, "bad host"...), 0, 80), 0x08},
+		"域名含换行":  {append(append([]byte{0x05, 0x01, 0x00, 0x03, 4}, "a\nbc"...), 0, 80), 0x08},
+		"未知地址类型": {[]byte{0x05, 0x01, 0x00, 0x02}, 0x08},
+		"BIND":   {[]byte{0x05, 0x02, 0x00, 0x01}, 0x07},
+	} {
+		app, done := socksHandshake(t, c)
+		go app.Write(append([]byte{0x05, 0x01, 0x00}, tc.request...))
+		reply := make([]byte, 12)
+		if _, err := io.ReadFull(app, reply); err != nil || reply[0] != 0x05 || reply[1] != 0x00 || reply[3] != tc.reply {
+			t.Fatalf("%s: 回复 %x, %v，期望 0x%02x", name, reply, err, tc.reply)
+		}
+		<-done
+	}
+
+	// 没有任何认证方法：不回复，直接断开
+	app, done := socksHandshake(t, c)
+	go app.Write([]byte{0x05, 0x00})
+	if n, err := app.Read(make([]byte, 2)); err != io.EOF {
+		t.Fatalf("没有认证方法时读到 %d 字节, %v", n, err)
+	}
+	<-done
+}
+
+// TestSOCKSHandshakeTimeout 只发了一半的握手在时限到达后断开，不长期占用 goroutine
+func TestSOCKSHandshakeTimeout(t *testing.T) {
+	setSOCKSHandshakeTimeout(t, 100*time.Millisecond)
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+
+	for name, partial := range map[string][]byte{
+		"协商":   {0x05, 0x02, 0x00},
+		"请求头部": {0x05, 0x01, 0x00, 0x05, 0x01},
+		"域名":   {0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x03, 20, 'e', 'x'},
+	} {
+		app, done := socksHandshake(t, c)
+		go io.Copy(io.Discard, app)
+		app.Write(partial)
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("停在%s的握手超过时限仍未断开", name)
+		}
+	}
+}
+
+// FuzzParseAddress 任意输入都不会导致崩溃；解析出的地址都能拆分，主机（带 zone 的 IPv6 除外）通过 target.CheckHost
+func FuzzParseAddress(f *testing.F) {
+	f.Add(byte(0x01), []byte{127, 0, 0, 1, 0, 80})
+	f.Add(byte(0x03), append(append([]byte{11}, "example.com"...), 1, 187))
+	f.Add(byte(0x03), append(append([]byte{13}, "[2001:db8::1]"...), 1, 187))
+	f.Add(byte(0x03), append(append([]byte{12}, "fe80::1%eth0"...), 1, 187))
+	f.Add(byte(0x03), []byte{0, 0, 80})
+	f.Add(byte(0x04), make([]byte, 18))
+	f.Add(byte(0x05), []byte{})
+	c := NewClient("", "", 0, ModeGlobal)
+	f.Fuzz(func(t *testing.T, atyp byte, data []byte) {
+		addr, err := c.parseAddress(bytes.NewReader(data), atyp)
+		if err != nil {
+			return
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("解析出的地址 %q 无法拆分: %v", addr, err)
+		}
+		if !hasZone(host) {
+			if err := target.CheckHost(host); err != nil {
+				t.Fatalf("解析出的主机 %q 未通过校验: %v", host, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 流控制指令码（与服务端一致：地址长度字节为 0 时紧跟 1 字节指令码）
+const (
+	opSpeedTest  byte = 0x01 // 隧道内测速
+	opUDPStream  byte = 0x02 // UDP over Stream（Datagram 不可用时的回退通道）
+	opPing       byte = 0x03 // 隧道验证（回显 nonce）
+	opHello      byte = 0x04 // 能力协商（交换 1 字节能力位）
+	opTCPDeflate byte = 0x05 // 压缩的 TCP 转发（后接地址长度 + 地址，数据按压缩帧传输）
+	opTCPConnect byte = 0x06 // TCP 转发（协议版本 1，后接结构化目标，见 pkg/target）
+	opWarmup     byte = 0x07 // 预热请求（请求随机数据，见 warmup.go）
+)
+
+// speedTestMaxBytes 单次测速上/下行最大字节数（与服务端上限一致）
+const speedTestMaxBytes = 64 * 1024 * 1024
+
+// SpeedTestResult 隧道内测速结果
+type SpeedTestResult struct {
+	UploadBytes   int64   `json:"upload_bytes"`
+	DownloadBytes int64   `json:"download_bytes"`
+	UploadMbps    float64 `json:"upload_mbps"`
+	DownloadMbps  float64 `json:"download_mbps"`
+	DurationMs    int64   `json:"duration_ms"`
+}
+
+// SpeedTest 在隧道内测速（不依赖外部测速服务器）
+// uploadBytes/downloadBytes: 上行/下行测试数据量（字节，最多 64MB）
+func (c *Client) SpeedTest(uploadBytes, downloadBytes int64) (SpeedTestResult, error) {
+	var result SpeedTestResult
+	if uploadBytes < 0 || uploadBytes > speedTestMaxBytes || downloadBytes < 0 || downloadBytes > speedTestMaxBytes {
+		return result, fmt.Errorf("测速数据量超出范围 (0 ~ %d 字节)", speedTestMaxBytes)
+	}
+
+	conn := c.getQuicConnection()
+	if conn == nil {
+		return result, fmt.Errorf("隧道未连接")
+	}
+
+	stream, err := c.openAuthedStream(conn)
+	if err != nil {
+		return result, err
+	}
+	defer stream.Close()
+	defer stream.CancelRead(0)
+
+	// 1. 发送测速指令
+	start := time.Now()
+	req := []byte{0x00, opSpeedTest, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(req[2:], uint32(downloadBytes))
+	if _, err := stream.Write(req); err != nil {
+		return result, err
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
+		return result, fmt.Errorf("服务端拒绝测速请求")
+	}
+
+	// 2. 上行：发送数据后关闭写方向
+	buf := c.bufPool.Get().([]byte)
+	defer c.bufPool.Put(buf)
+	uploadStart := time.Now()
+	for sent := int64(0); sent < uploadBytes; {
+		chunk := buf
+		if remain := uploadBytes - sent; remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		n, err := stream.Write(chunk)
+		sent += int64(n)
+		if err != nil {
+			return result, fmt.Errorf("上行中断: %w", err)
+		}
+	}
+	stream.Close()
+
+	// 服务端收完上行数据后回复实际收到的字节数
+	ack := make([]byte, 8)
+	if _, err := io.ReadFull(stream, ack); err != nil {
+		return result, fmt.Errorf("读取上行确认失败: %w", err)
+	}
+	uploadElapsed := time.Since(uploadStart)
+	result.UploadBytes = int64(binary.BigEndian.Uint64(ack))
+
+	// 3. 下行：读取随机数据直到 EOF
+	downloadStart := time.Now()
+	received, err := io.CopyBuffer(io.Discard, stream, buf)
+	if err != nil {
+		return result, fmt.Errorf("下行中断: %w", err)
+	}
+	downloadElapsed := time.Since(downloadStart)
+	result.DownloadBytes = received
+
+	result.UploadMbps = mbps(result.UploadBytes, uploadElapsed)
+	result.DownloadMbps = mbps(result.DownloadBytes, downloadElapsed)
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// mbps 计算吞吐量（Mbit/s）
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if bytes == 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes*8) / elapsed.Seconds() / 1e6
+}
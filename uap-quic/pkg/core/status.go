@@ -0,0 +1,120 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusPollInterval 账户状态轮询间隔
+const statusPollInterval = 5 * time.Minute
+
+// NotificationQuotaWarning 流量用量预警（Percent 为越过的预警线，如 80 / 95）
+const NotificationQuotaWarning = "quota_warning"
+
+// Notification 管理后台推送的通知（每条只会被轮询返回一次）
+type Notification struct {
+	ID      uint   `json:"id"`
+	Kind    string `json:"kind"`
+	Percent int    `json:"percent,omitempty"`
+}
+
+// AccountStatus 账户状态（uap-admin 的 /api/v1/client/status）
+type AccountStatus struct {
+	TrafficLimitBytes int64          `json:"traffic_limit_bytes"` // 0 表示不限
+	TrafficUsedBytes  int64          `json:"traffic_used_bytes"`
+	Notifications     []Notification `json:"notifications"`
+}
+
+// statusResponse 账户状态接口响应（未导出，仅内部使用）
+type statusResponse struct {
+	Code  int           `json:"code"`
+	Error string        `json:"error,omitempty"`
+	Data  AccountStatus `json:"data"`
+	Msg   string        `json:"msg,omitempty"`
+}
+
+// SetStatusURL 设置账户状态接口地址（uap-admin 的 /api/v1/client/status）
+// 设置后客户端运行期间定期轮询账户状态，取回的通知交给 SetNotificationHandler 设置的回调
+func (c *Client) SetStatusURL(url string) {
+	c.statusURL = url
+}
+
+// SetNotificationHandler 设置通知回调（在轮询 goroutine 中调用，需在 Start 之前设置）
+func (c *Client) SetNotificationHandler(handler func(Notification)) {
+	c.onNotification = handler
+}
+
+// FetchStatus 拉取一次账户状态（返回的通知已被服务端标记为已投递）
+func (c *Client) FetchStatus() (*AccountStatus, error) {
+	if c.statusURL == "" {
+		return nil, fmt.Errorf("未设置账户状态接口地址")
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "GET", c.statusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	SetAPIHeaders(req, c.userToken())
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var statusResp statusResponse
+	if err := json.Unmarshal(respBody, &statusResp); err != nil {
+		return nil, fmt.Errorf("解析账户状态失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || statusResp.Code != 200 {
+		return nil, fmt.Errorf("账户状态接口: %w", ParseAPIError(resp.StatusCode, statusResp.Code, statusResp.Error, statusResp.Msg))
+	}
+
+	return &statusResp.Data, nil
+}
+
+// statusPollLoop 定期轮询账户状态并分发通知
+func (c *Client) statusPollLoop() {
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.pollStatus()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollStatus 轮询一次账户状态
+func (c *Client) pollStatus() {
+	status, err := c.FetchStatus()
+	if err != nil {
+		if c.ctx.Err() == nil {
+			log.Printf("⚠️ 拉取账户状态失败: %v", err)
+		}
+		return
+	}
+
+	for _, n := range status.Notifications {
+		if n.Kind == NotificationQuotaWarning {
+			log.Printf("📈 流量用量已达 %d%% (%d / %d 字节)", n.Percent, status.TrafficUsedBytes, status.TrafficLimitBytes)
+		}
+		if c.onNotification != nil {
+			c.onNotification(n)
+		}
+	}
+}
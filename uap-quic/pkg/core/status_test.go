@@ -0,0 +1,46 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPollStatusDispatchesNotifications(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer user-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":40100,"error":"unauthorized","msg":"未登录"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"data":{"traffic_limit_bytes":1000,"traffic_used_bytes":960,"notifications":[{"id":1,"kind":"quota_warning","percent":95}]}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("127.0.0.1:1", "user-token", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	c.SetStatusURL(srv.URL)
+	var got []Notification
+	c.SetNotificationHandler(func(n Notification) { got = append(got, n) })
+
+	c.pollStatus()
+	if len(got) != 1 || got[0].Kind != NotificationQuotaWarning || got[0].Percent != 95 {
+		t.Fatalf("分发的通知 %+v", got)
+	}
+
+	// 接口错误不分发通知，并返回服务端的错误信息
+	bad := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(bad.Stop)
+	bad.SetStatusURL(srv.URL)
+	if _, err := bad.FetchStatus(); err == nil {
+		t.Fatal("未授权的请求应返回错误")
+	}
+}
+
+func TestFetchStatusRequiresURL(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	if _, err := c.FetchStatus(); err == nil {
+		t.Fatal("未设置接口地址时应返回错误")
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"net"
+
+	"uap-quic/pkg/router"
+	"uap-quic/pkg/target"
+)
+
+// maxUDPTagCache 单个 UDP 关联缓存的目标标签数，超出时清空重来
+const maxUDPTagCache = 256
+
+// tagFlags 规则标签对应的转发标志（服务端按流量类型应用策略，见 cmd/server/qos.go）
+func tagFlags(tag string) target.Flags {
+	switch tag {
+	case router.TagBulk:
+		return target.FlagBulk
+	case router.TagGame:
+		return target.FlagGame
+	}
+	return 0
+}
+
+// udpTagger 给发往隧道的 SOCKS5 UDP 包打上目标命中规则的流量类型标志（写入 RSV 的第一个字节，旧版服务端忽略）
+// 按目标主机缓存查询结果，只在单个关联的读取循环中使用，不需要加锁
+type udpTagger struct {
+	client *Client
+	cache  map[string]target.Flags
+}
+
+// newUDPTagger 创建 UDP 关联的标签器
+func (c *Client) newUDPTagger() *udpTagger {
+	return &udpTagger{client: c, cache: make(map[string]target.Flags)}
+}
+
+// tag 按包头中的目标主机写入流量类型标志（包头格式错误时不修改）
+func (t *udpTagger) tag(packet []byte) {
+	if len(packet) < 4 || t.client.proxyRouter == nil {
+		return
+	}
+	var host string
+	switch packet[3] {
+	case 0x01:
+		if len(packet) < 8 {
+			return
+		}
+		host = net.IP(packet[4:8]).String()
+	case 0x04:
+		if len(packet) < 20 {
+			return
+		}
+		host = net.IP(packet[4:20]).String()
+	case 0x03:
+		if len(packet) < 5 || len(packet) < 5+int(packet[4]) {
+			return
+		}
+		host = string(packet[5 : 5+int(packet[4])])
+	default:
+		return
+	}
+
+	flags, ok := t.cache[host]
+	if !ok {
+		if len(t.cache) >= maxUDPTagCache {
+			clear(t.cache)
+		}
+		flags = tagFlags(t.client.proxyRouter.Tag(normalizeHost(host)))
+		t.cache[host] = flags
+	}
+	packet[0] = byte(flags)
+}
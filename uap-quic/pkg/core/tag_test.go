@@ -0,0 +1,107 @@
+package core
+
+import (
+	"net"
+	"testing"
+
+	"uap-quic/pkg/router"
+	"uap-quic/pkg/target"
+)
+
+// udpHeader SOCKS5 UDP 包头（RSV 为 0）加 1 字节载荷
+func udpHeader(atyp byte, addr []byte) []byte {
+	packet := append([]byte{0, 0, 0, atyp}, addr...)
+	return append(packet, 0, 53, 'x')
+}
+
+func TestRouteTag(t *testing.T) {
+	rules := "PROXY,netflix.com,tag=bulk\nsteam.com,tag=game\ngoogle.com\n"
+	c := newRoutingClient(t, ModeSmart, rules)
+	for host, want := range map[string]string{
+		"www.netflix.com": router.TagBulk,
+		"api.steam.com":   router.TagGame,
+		"google.com":      "",
+		"example.org":     "",
+	} {
+		if d := c.route(host, true); d.Tag != want {
+			t.Errorf("route(%q) 的标签 %q，期望 %q", host, d.Tag, want)
+		}
+		if d := c.TestRoute(host); d.Tag != want {
+			t.Errorf("TestRoute(%q) 的标签 %q，期望 %q", host, d.Tag, want)
+		}
+	}
+
+	// 全局模式不按规则分流，但标签仍然生效
+	g := newRoutingClient(t, ModeGlobal, rules)
+	if d := g.route("www.netflix.com", true); d.Action != RouteProxy || d.Reason != RouteReasonGlobal || d.Tag != router.TagBulk {
+		t.Fatalf("全局模式 %+v", d)
+	}
+}
+
+func TestTagFlags(t *testing.T) {
+	for tag, want := range map[string]target.Flags{
+		router.TagBulk: target.FlagBulk,
+		router.TagGame: target.FlagGame,
+		"":             0,
+		"video":        0,
+	} {
+		if got := tagFlags(tag); got != want {
+			t.Errorf("tagFlags(%q) = %#x，期望 %#x", tag, got, want)
+		}
+	}
+}
+
+func TestUDPTagger(t *testing.T) {
+	c := newRoutingClient(t, ModeSmart, "steam.com,tag=game\n10.0.0.1,tag=game\n2001:db8::1,tag=bulk\n")
+	tagger := c.newUDPTagger()
+
+	domain := "cdn.Steam.com"
+	for _, tc := range []struct {
+		name   string
+		packet []byte
+		want   byte
+	}{
+		{"域名", udpHeader(0x03, append([]byte{byte(len(domain))}, domain...)), byte(target.FlagGame)},
+		{"IPv4", udpHeader(0x01, net.IPv4(10, 0, 0, 1).To4()), byte(target.FlagGame)},
+		{"IPv6", udpHeader(0x04, net.ParseIP("2001:db8::1")), byte(target.FlagBulk)},
+		{"未命中", udpHeader(0x01, net.IPv4(10, 0, 0, 2).To4()), 0},
+	} {
+		// 标志写入 RSV 的第一个字节，之后的包头不变
+		before := append([]byte(nil), tc.packet...)
+		tagger.tag(tc.packet)
+		if tc.packet[0] != tc.want || string(tc.packet[1:]) != string(before[1:]) {
+			t.Errorf("%s: 打标签后 %x，期望标志 %#x", tc.name, tc.packet, tc.want)
+		}
+	}
+
+	// 包头格式错误时不修改
+	for _, packet := range [][]byte{
+		{0, 0, 0},
+		{0, 0, 0, 0x01, 10, 0},
+		{0, 0, 0, 0x04, 0x20, 0x01},
+		{0, 0, 0, 0x03, 20, 'a'},
+		{0, 0, 0, 0x05, 1, 2, 3, 4},
+	} {
+		tagger.tag(packet)
+		if packet[0] != 0 {
+			t.Errorf("格式错误的包 %x 被修改", packet)
+		}
+	}
+
+	// 按目标主机缓存：替换规则后同一关联沿用缓存的结果，缓存满时清空重来
+	c.proxyRouter.ReplaceWith(router.NewRouter())
+	packet := udpHeader(0x01, net.IPv4(10, 0, 0, 1).To4())
+	tagger.tag(packet)
+	if packet[0] != byte(target.FlagGame) {
+		t.Fatalf("缓存的标志 %#x", packet[0])
+	}
+	for i := 0; len(tagger.cache) < maxUDPTagCache; i++ {
+		tagger.tag(udpHeader(0x01, net.IPv4(10, 1, byte(i>>8), byte(i)).To4()))
+	}
+	tagger.tag(udpHeader(0x01, net.IPv4(10, 2, 0, 1).To4()))
+	packet = udpHeader(0x01, net.IPv4(10, 0, 0, 1).To4())
+	tagger.tag(packet)
+	if packet[0] != 0 || len(tagger.cache) != 2 {
+		t.Fatalf("缓存满后标志 %#x，缓存 %d 条", packet[0], len(tagger.cache))
+	}
+}
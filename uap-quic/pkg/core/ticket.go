@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ticketResponse 连接票据接口响应（未导出，仅内部使用）
+type ticketResponse struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+	Data  struct {
+		Ticket    string `json:"ticket"`
+		ExpiresAt int64  `json:"expires_at"`
+	} `json:"data"`
+	Msg string `json:"msg,omitempty"`
+}
+
+// SetTicketURL 设置连接票据接口地址（uap-admin 的 /api/v1/client/ticket）
+// 设置后每次建立 QUIC 连接前都会用 token 换取绑定到目标节点的短期票据，隧道握手中只出示票据
+// 接口不可达时回退为直接出示 token（是否接受由服务端 -require-ticket 决定）
+func (c *Client) SetTicketURL(url string) {
+	c.ticketURL = url
+}
+
+// SetStickyNode 开启/关闭粘性选路：申请连接票据时让 uap-admin 把账户固定到当前节点，
+// 之后的节点列表（sticky=true）在该节点健康时把它排在首位，出口 IP 保持稳定
+func (c *Client) SetStickyNode(enabled bool) {
+	c.stickyNode = enabled
+}
+
+// fetchConnectTicket 向 uap-admin 换取连接票据
+func (c *Client) fetchConnectTicket() (string, error) {
+	body, err := json.Marshal(map[string]interface{}{"address": c.ServerAddr(), "signed": c.signedAuth, "sticky": c.stickyNode})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.ticketURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	SetAPIHeaders(req, c.userToken())
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var ticketResp ticketResponse
+	if err := json.Unmarshal(respBody, &ticketResp); err != nil {
+		return "", fmt.Errorf("解析票据响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || ticketResp.Code != 200 || ticketResp.Data.Ticket == "" {
+		return "", fmt.Errorf("票据接口: %w", ParseAPIError(resp.StatusCode, ticketResp.Code, ticketResp.Error, ticketResp.Msg))
+	}
+
+	return ticketResp.Data.Ticket, nil
+}
+
+// refreshConnToken 为即将建立的连接准备鉴权凭证（需持有 quicConnLock）
+func (c *Client) refreshConnToken() {
+	c.connToken = c.userToken()
+	if c.ticketURL == "" {
+		return
+	}
+
+	ticket, err := c.fetchConnectTicket()
+	if err != nil {
+		log.Printf("⚠️ 获取连接票据失败，回退为 JWT 鉴权: %v", err)
+		return
+	}
+	if c.signedAuth {
+		proof, err := c.handshakeProof(ticket)
+		if err != nil {
+			log.Printf("⚠️ 签名握手失败，回退为 JWT 鉴权: %v", err)
+			return
+		}
+		if proof != "" {
+			ticket += " " + proof
+		}
+	}
+	c.connToken = ticket
+	log.Printf("🎫 已获取连接票据")
+}
+
+// authToken 返回当前连接使用的鉴权凭证
+func (c *Client) authToken() string {
+	c.quicConnLock.RLock()
+	defer c.quicConnLock.RUnlock()
+	if c.connToken != "" {
+		return c.connToken
+	}
+	return c.userToken()
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/quic-go/quic-go"
+)
+
+// trustedALPN 信任模式的 ALPN（与服务端一致）
+const trustedALPN = "uap-trusted"
+
+// tlsAlertNoApplicationProtocol TLS no_application_protocol 告警在 QUIC 中的错误码 (0x100 + 120)
+const tlsAlertNoApplicationProtocol = quic.TransportErrorCode(0x100 + 120)
+
+// SetTrusted 信任模式：流上不再发送 Token 鉴权行，直接发送地址帧，每条新流省去一次往返
+// 只用于可信内网，节点必须同样以 -trusted 启动（两端不一致时 TLS 握手失败）；开启后不申请连接票据。在 Start 之前调用
+func (c *Client) SetTrusted(enabled bool) {
+	c.trusted = enabled
+}
+
+// alpn 客户端使用的 ALPN
+func (c *Client) alpn() string {
+	if c.trusted {
+		return trustedALPN
+	}
+	return "h3" // 伪装 HTTP/3
+}
+
+// trustedMismatch 握手失败是否因为两端信任模式不一致（ALPN 协商失败）
+func trustedMismatch(err error) bool {
+	var te *quic.TransportError
+	return errors.As(err, &te) && te.ErrorCode == tlsAlertNoApplicationProtocol
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitControlClose(t *testing.T) {
+	var out bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(old) })
+
+	app, local := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		waitControlClose(local, 1080)
+		close(done)
+	}()
+
+	// 控制连接上的数据不结束关联
+	app.Write([]byte("abc"))
+	app.Write(bytes.Repeat([]byte{'x'}, 600))
+	select {
+	case <-done:
+		t.Fatal("控制连接收到数据后关联结束")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	app.Close()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("控制连接断开后未返回")
+	}
+	// 数据不静默丢弃：第一次收到与关联结束时各记录一次
+	logs := out.String()
+	if !strings.Contains(logs, "控制连接收到 3 字节数据") || !strings.Contains(logs, "共忽略 603 字节数据") || strings.Count(logs, "\n") != 2 {
+		t.Fatalf("日志:\n%s", logs)
+	}
+}
+
+func TestWaitControlCloseSilent(t *testing.T) {
+	var out bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(old) })
+
+	// 按 RFC 1928 不发送数据的应用不产生日志
+	app, local := net.Pipe()
+	app.Close()
+	waitControlClose(local, 1080)
+	if out.Len() != 0 {
+		t.Fatalf("日志:\n%s", out.String())
+	}
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"log"
+
+	"uap-quic/pkg/udpstream"
+)
+
+// maxDatagramPacket 单个 QUIC Datagram 可承载的最大 SOCKS5 UDP 数据包（含头部）
+// quic-go 两端都固定通告 1200 字节的 max_datagram_frame_size (RFC 9221)，去掉帧类型与长度字段后剩 1197 字节；
+// 超出时 SendDatagram 直接失败，在 MTU 较小的路径上甚至会被静默丢弃，所以需要在发送前检查
+const maxDatagramPacket = 1197
+
+// socks5IPv4HeaderLen 发往 IPv4 目标的 SOCKS5 UDP 头部长度：RSV(2) + FRAG(1) + ATYP(1) + IPv4(4) + PORT(2)
+const socks5IPv4HeaderLen = 10
+
+// MaxDatagramUDPPayload 使用 Datagram 传输时发往 IPv4 目标的 UDP 单包载荷上限（字节）
+const MaxDatagramUDPPayload = maxDatagramPacket - socks5IPv4HeaderLen
+
+// SetMaxUDPPayload 设置 UDP 单包载荷上限（字节，不含 SOCKS5 头部），<= 0 表示只受传输方式限制
+// 超出该上限的包在本地丢弃并计数（无论使用哪种传输），适合已知路径 MTU 较小、宁可丢包也不要分片的游戏
+// 可在运行中切换，立即生效
+func (c *Client) SetMaxUDPPayload(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c.maxUDPPayload.Store(int64(n))
+}
+
+// SetUDPOversizeFallback 设置超出 Datagram 上限的 UDP 包的处理方式
+// false（默认）：在本地丢弃并计数，应用按丢包处理（与路径 MTU 不足时的表现一致，但不会浪费上行带宽）
+// true：把该 UDP 关联整体切换为 Stream 传输（可承载大包，代价是队头阻塞，且服务端的 UDP 出口端口会变化一次）
+// 可在运行中切换，对之后出现的超限包生效
+func (c *Client) SetUDPOversizeFallback(enabled bool) {
+	c.udpOversizeFallback.Store(enabled)
+}
+
+// MaxUDPPayload 当前生效的 UDP 单包载荷上限（发往 IPv4 目标，不含 SOCKS5 头部），供界面提示
+// 新建的 UDP 关联使用 Datagram 传输时不超过 Datagram 上限（1187 字节），使用 Stream 传输时只受帧大小限制；
+// 设置了 SetMaxUDPPayload 时取两者中较小的值。隧道未建立时按 Datagram 传输计算
+func (c *Client) MaxUDPPayload() int {
+	limit := MaxDatagramUDPPayload
+	if conn := c.getQuicConnection(); conn != nil && c.useUDPStream(conn) {
+		limit = udpstream.MaxFrameSize - socks5IPv4HeaderLen
+	}
+	if configured := int(c.maxUDPPayload.Load()); configured > 0 && configured < limit {
+		limit = configured
+	}
+	return limit
+}
+
+// udpOversize 超限检查结果
+type udpOversize int
+
+const (
+	udpFits     udpOversize = iota // 可以发送
+	udpDrop                        // 丢弃
+	udpFallback                    // 切换为 Stream 传输后发送
+)
+
+// checkUDPPacket 检查应用发出的 SOCKS5 UDP 数据包是否超出上限
+// datagram 为 true 表示当前关联使用 Datagram 传输
+func (c *Client) checkUDPPacket(packet []byte, datagram bool) udpOversize {
+	if configured := int(c.maxUDPPayload.Load()); configured > 0 {
+		if payload, ok := socks5UDPPayload(packet); ok && len(payload) > configured {
+			return udpDrop
+		}
+	}
+	if datagram && len(packet) > maxDatagramPacket {
+		if c.udpOversizeFallback.Load() {
+			return udpFallback
+		}
+		return udpDrop
+	}
+	return udpFits
+}
+
+// dropUDPPacket 丢弃一个超限的 UDP 包并计数；每个关联只在第一次丢包时记录日志
+func (c *Client) dropUDPPacket(packet []byte, localPort int, logged *bool) {
+	c.udpOversizeDropped.Add(1)
+	if !*logged {
+		*logged = true
+		size := len(packet)
+		if payload, ok := socks5UDPPayload(packet); ok {
+			size = len(payload)
+		}
+		log.Printf("[UDP] 丢弃超出上限的 UDP 包 (端口 %d): 载荷 %d 字节，当前上限 %d 字节（之后同一关联的超限包只计数）", localPort, size, c.MaxUDPPayload())
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"testing"
+
+	"uap-quic/pkg/udpstream"
+)
+
+// socksPacket 发往 IPv4 目标、载荷为 size 字节的 SOCKS5 UDP 数据包
+func socksPacket(size int) []byte {
+	return append([]byte{0, 0, 0, 0x01, 127, 0, 0, 1, 0, 53}, make([]byte, size)...)
+}
+
+func TestCheckUDPPacket(t *testing.T) {
+	c := NewClient("", "", 0, "global")
+	cases := []struct {
+		name       string
+		configured int
+		fallback   bool
+		payload    int
+		datagram   bool
+		want       udpOversize
+	}{
+		{"Datagram 上限以内", 0, false, MaxDatagramUDPPayload, true, udpFits},
+		{"超出 Datagram 上限：默认丢弃", 0, false, MaxDatagramUDPPayload + 1, true, udpDrop},
+		{"超出 Datagram 上限：回退到 Stream", 0, true, MaxDatagramUDPPayload + 1, true, udpFallback},
+		{"Stream 传输不受 Datagram 上限限制", 0, false, 4000, false, udpFits},
+		{"超出配置的上限：总是丢弃", 500, true, 501, true, udpDrop},
+		{"超出配置的上限：Stream 传输同样丢弃", 500, false, 501, false, udpDrop},
+		{"配置的上限以内", 500, false, 500, true, udpFits},
+	}
+	for _, tc := range cases {
+		c.SetMaxUDPPayload(tc.configured)
+		c.SetUDPOversizeFallback(tc.fallback)
+		if got := c.checkUDPPacket(socksPacket(tc.payload), tc.datagram); got != tc.want {
+			t.Errorf("%s: 返回 %d，期望 %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMaxUDPPayload(t *testing.T) {
+	c := NewClient("", "", 0, "global")
+	// 隧道未建立时按 Datagram 传输计算
+	if got := c.MaxUDPPayload(); got != MaxDatagramUDPPayload {
+		t.Fatalf("默认上限 %d，期望 %d", got, MaxDatagramUDPPayload)
+	}
+	c.SetMaxUDPPayload(500)
+	if got := c.MaxUDPPayload(); got != 500 {
+		t.Fatalf("配置 500 后上限 %d", got)
+	}
+	// 配置值大于传输方式的上限时取较小值
+	c.SetMaxUDPPayload(udpstream.MaxFrameSize)
+	if got := c.MaxUDPPayload(); got != MaxDatagramUDPPayload {
+		t.Fatalf("配置过大时上限 %d", got)
+	}
+	c.SetMaxUDPPayload(-1)
+	if got := c.GetStats(0).MaxUDPPayload; got != MaxDatagramUDPPayload {
+		t.Fatalf("负数配置后统计中的上限 %d", got)
+	}
+}
+
+func TestDropUDPPacketCounts(t *testing.T) {
+	c := NewClient("", "", 0, "global")
+	var logged bool
+	for i := 0; i < 3; i++ {
+		c.dropUDPPacket(socksPacket(2000), 1080, &logged)
+	}
+	if !logged || c.GetStats(0).UDPOversizeDropped != 3 {
+		t.Fatalf("丢弃计数 %d", c.GetStats(0).UDPOversizeDropped)
+	}
+}
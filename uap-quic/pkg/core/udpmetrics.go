@@ -0,0 +1,237 @@
+package core
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDP 关联的传输方式
+const (
+	UDPTransportDatagram = "datagram"
+	UDPTransportStream   = "stream"
+)
+
+// udpDupWindow 重复包检测窗口：每个方向记住最近这么多个包的指纹
+const udpDupWindow = 64
+
+// udpClosedKeep 保留的已结束会话数（诊断包能看到刚结束的游戏会话）
+const udpClosedKeep = 8
+
+// jitterGain 抖动平滑增益（与 RFC 3550 6.4.1 相同的 1/16）
+const jitterGain = 16
+
+// udpFingerprintSeed 包指纹的哈希种子（进程内固定）
+var udpFingerprintSeed = maphash.MakeSeed()
+
+// UDPDirectionStats 单个方向的 UDP 包统计（up: 应用 → 隧道，down: 隧道 → 应用）
+type UDPDirectionStats struct {
+	Packets    uint64  `json:"packets"`
+	Bytes      uint64  `json:"bytes"`       // SOCKS5 UDP 数据包字节数（含头部）
+	Duplicates uint64  `json:"duplicates"`  // 估计值：与最近 64 个包内容完全相同的包数
+	MeanGapMs  float64 `json:"mean_gap_ms"` // 平均包间隔
+	MaxGapMs   float64 `json:"max_gap_ms"`  // 最大包间隔（卡顿）
+	JitterMs   float64 `json:"jitter_ms"`   // 相邻包间隔之差的平滑平均（1/16 增益）
+}
+
+// UDPSessionStats 单个 UDP 会话（SOCKS5 关联或包模式的 UDP 会话）的统计
+type UDPSessionStats struct {
+	ID        uint64            `json:"id"`
+	Port      int               `json:"port,omitempty"`   // SOCKS5 关联的本地 UDP 端口
+	Target    string            `json:"target,omitempty"` // 包模式（DialUDP）的目标地址
+	Transport string            `json:"transport"`        // datagram / stream（超限包回退后变为 stream）
+	Seconds   int64             `json:"seconds"`          // 持续时间
+	Closed    bool              `json:"closed"`           // 已结束（只保留最近几个）
+	Up        UDPDirectionStats `json:"up"`
+	Down      UDPDirectionStats `json:"down"`
+}
+
+// udpDirection 单个方向的统计（每个方向只有一个写入者，加锁是为了与统计读取并发）
+type udpDirection struct {
+	mu      sync.Mutex
+	packets uint64
+	bytes   uint64
+	dups    uint64
+	last    time.Time
+	gap     time.Duration // 上一个包间隔
+	gapSum  time.Duration
+	maxGap  time.Duration
+	jitter  float64 // 纳秒
+
+	recent [udpDupWindow]uint64 // 最近的包指纹（环形）
+	next   int
+}
+
+// observe 记录一个包：只做统计，不影响转发
+func (d *udpDirection) observe(packet []byte, now time.Time) {
+	fp := maphash.Bytes(udpFingerprintSeed, packet)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	filled := d.recent[:]
+	if d.packets < udpDupWindow {
+		filled = d.recent[:d.packets]
+	}
+	for _, v := range filled {
+		if v == fp {
+			d.dups++
+			break
+		}
+	}
+	d.recent[d.next] = fp
+	d.next = (d.next + 1) % udpDupWindow
+
+	if !d.last.IsZero() {
+		gap := now.Sub(d.last)
+		d.gapSum += gap
+		if gap > d.maxGap {
+			d.maxGap = gap
+		}
+		if d.packets > 1 {
+			diff := gap - d.gap
+			if diff < 0 {
+				diff = -diff
+			}
+			d.jitter += (float64(diff) - d.jitter) / jitterGain
+		}
+		d.gap = gap
+	}
+	d.last = now
+	d.packets++
+	d.bytes += uint64(len(packet))
+}
+
+// stats 当前统计
+func (d *udpDirection) stats() UDPDirectionStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := UDPDirectionStats{
+		Packets:    d.packets,
+		Bytes:      d.bytes,
+		Duplicates: d.dups,
+		MaxGapMs:   durationMs(d.maxGap),
+		JitterMs:   d.jitter / float64(time.Millisecond),
+	}
+	if d.packets > 1 {
+		s.MeanGapMs = durationMs(d.gapSum / time.Duration(d.packets-1))
+	}
+	return s
+}
+
+// durationMs 转换为毫秒（保留小数）
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// udpSession 单个 UDP 会话的统计；未开启统计时为 nil，方法均可在 nil 上调用
+type udpSession struct {
+	id        uint64
+	port      int
+	target    string
+	started   time.Time
+	transport atomic.Value // string
+	up, down  udpDirection
+}
+
+// observeUp 记录应用发往隧道的包
+func (s *udpSession) observeUp(packet []byte) {
+	if s != nil {
+		s.up.observe(packet, time.Now())
+	}
+}
+
+// observeDown 记录隧道发往应用的包
+func (s *udpSession) observeDown(packet []byte) {
+	if s != nil {
+		s.down.observe(packet, time.Now())
+	}
+}
+
+// setTransport 记录传输方式的变化（超限包回退为 Stream）
+func (s *udpSession) setTransport(transport string) {
+	if s != nil {
+		s.transport.Store(transport)
+	}
+}
+
+// stats 当前统计
+func (s *udpSession) stats(closed bool) UDPSessionStats {
+	transport, _ := s.transport.Load().(string)
+	return UDPSessionStats{
+		ID:        s.id,
+		Port:      s.port,
+		Target:    s.target,
+		Transport: transport,
+		Seconds:   int64(time.Since(s.started).Seconds()),
+		Closed:    closed,
+		Up:        s.up.stats(),
+		Down:      s.down.stats(),
+	}
+}
+
+// udpSessionTable 活跃与最近结束的 UDP 会话
+type udpSessionTable struct {
+	mu     sync.Mutex
+	seq    uint64
+	active map[uint64]*udpSession
+	closed []UDPSessionStats // 最近结束的会话（最多 udpClosedKeep 个，旧的在前）
+}
+
+// SetUDPMetrics 开启/关闭 UDP 会话统计（默认关闭）：每个会话按方向统计包间隔、抖动与疑似重复包，
+// 在 GetStats 的 udp_sessions 中输出，用于判断游戏卡顿是否由隧道引起。统计只做观察，不会丢弃或重排任何包；
+// 每个会话占用固定内存（约 1KB）。可在运行中切换，对之后建立的会话生效
+func (c *Client) SetUDPMetrics(enabled bool) {
+	c.udpMetrics.Store(enabled)
+}
+
+// startUDPSession 开始统计一个 UDP 会话（未开启统计时返回 nil）
+func (c *Client) startUDPSession(port int, target, transport string) *udpSession {
+	if !c.udpMetrics.Load() {
+		return nil
+	}
+	t := &c.udpSessions
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	s := &udpSession{id: t.seq, port: port, target: target, started: time.Now()}
+	s.transport.Store(transport)
+	if t.active == nil {
+		t.active = make(map[uint64]*udpSession)
+	}
+	t.active[s.id] = s
+	return s
+}
+
+// endUDPSession 会话结束：移入最近结束列表（可重复调用）
+func (c *Client) endUDPSession(s *udpSession) {
+	if s == nil {
+		return
+	}
+	t := &c.udpSessions
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.active[s.id]; !ok {
+		return
+	}
+	delete(t.active, s.id)
+	t.closed = append(t.closed, s.stats(true))
+	if len(t.closed) > udpClosedKeep {
+		t.closed = t.closed[len(t.closed)-udpClosedKeep:]
+	}
+}
+
+// udpSessionStats 活跃会话（按建立顺序）与最近结束的会话
+func (c *Client) udpSessionStats() []UDPSessionStats {
+	t := &c.udpSessions
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]UDPSessionStats, 0, len(t.active)+len(t.closed))
+	for _, s := range t.active {
+		result = append(result, s.stats(false))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return append(result, t.closed...)
+}
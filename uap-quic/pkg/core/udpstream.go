@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"uap-quic/pkg/udpstream"
+
+	"github.com/quic-go/quic-go"
+)
+
+// SetUDPOverStream 强制 UDP 关联使用 Stream 传输（适用于丢弃/限制 QUIC Datagram 的网络）
+// 关闭时按连接协商：服务端支持 Datagram 则使用 Datagram，否则自动回退到 Stream
+// 可在运行中切换，对之后新建的 UDP 关联生效
+func (c *Client) SetUDPOverStream(enabled bool) {
+	c.udpOverStream.Store(enabled)
+}
+
+// useUDPStream 关联建立时决定是否使用 Stream 传输
+func (c *Client) useUDPStream(conn quic.Connection) bool {
+	return c.udpOverStream.Load() || !conn.ConnectionState().SupportsDatagrams
+}
+
+// openUDPStream 打开一条 UDP over Stream 流（发送控制指令并等待服务端确认）
+func (c *Client) openUDPStream(conn quic.Connection) (quic.Stream, error) {
+	stream, err := c.openAuthedStream(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stream.Write([]byte{0x00, opUDPStream}); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil || status[0] != 0x00 {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, fmt.Errorf("服务端拒绝 UDP over Stream 请求")
+	}
+	return stream, nil
+}
+
+// relayUDPStream 通过长度前缀帧在 QUIC 流上转发 UDP 关联（对 SOCKS5 应用透明）
+// stream 为关联建立时已打开的流；隧道重连后重新建流，重连超时则关闭控制连接，让应用重新发起 UDP 关联
+// appAddr 为已知的应用地址（从 Datagram 传输切换过来时），回包在应用发出下一个包之前也能送达；metrics 为会话统计（可为 nil）
+func (c *Client) relayUDPStream(ctx context.Context, conn quic.Connection, stream quic.Stream, clientConn net.Conn, udpConn *net.UDPConn, localPort int, appAddr *net.UDPAddr, metrics *udpSession) {
+	var (
+		currentAddr atomic.Value
+		streamLock  sync.Mutex
+		current     = stream
+	)
+	if appAddr != nil {
+		currentAddr.Store(appAddr)
+	}
+	setStream := func(s quic.Stream) {
+		streamLock.Lock()
+		current = s
+		streamLock.Unlock()
+	}
+	getStream := func() quic.Stream {
+		streamLock.Lock()
+		defer streamLock.Unlock()
+		return current
+	}
+
+	// 关联结束时关闭当前流，让读取循环退出
+	go func() {
+		<-ctx.Done()
+		if s := getStream(); s != nil {
+			s.CancelRead(0)
+			s.Close()
+		}
+	}()
+
+	// 1. Read Loop (App -> LocalUDP -> QUIC Stream)：流的唯一写入者，隧道重建期间的包直接丢弃
+	go func() {
+		buf := make([]byte, udpstream.MaxFrameSize)
+		tagger := c.newUDPTagger()
+		var logged bool
+		for {
+			n, addr, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !udpFromApp(clientConn, addr) {
+				continue
+			}
+			currentAddr.Store(addr)
+			tagger.tag(buf[:n])
+			if c.checkUDPPacket(buf[:n], false) != udpFits {
+				c.dropUDPPacket(buf[:n], localPort, &logged)
+				continue
+			}
+			if s := getStream(); s != nil {
+				metrics.observeUp(buf[:n])
+				udpstream.WriteFrame(s, buf[:n])
+			}
+		}
+	}()
+
+	// 2. Write Loop (QUIC Stream -> LocalUDP -> App)
+	buf := make([]byte, udpstream.MaxFrameSize)
+	for {
+		for {
+			data, err := udpstream.ReadFrame(stream, buf)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+					log.Printf("[UDP] UDP 流中断 (端口 %d): %v", localPort, err)
+				}
+				break
+			}
+			if c.udpUnreachableSignal(data) {
+				continue
+			}
+			metrics.observeDown(data)
+			if addr := currentAddr.Load(); addr != nil {
+				udpConn.WriteToUDP(data, addr.(*net.UDPAddr))
+			}
+		}
+		setStream(nil)
+		stream.CancelRead(0)
+		stream.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 流中断：隧道已断开时等待重连，之后重新建流
+		if conn.Context().Err() != nil {
+			newConn := c.waitForNewConnection(ctx, conn, udpRebindTimeout)
+			if newConn == nil {
+				if ctx.Err() == nil {
+					log.Printf("[UDP] 隧道重连超时，关闭 UDP 关联 (端口 %d)，应用需重新关联", localPort)
+					clientConn.Close()
+				}
+				return
+			}
+			conn = newConn
+		}
+
+		var err error
+		if stream, err = c.openUDPStream(conn); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[UDP] 重新建立 UDP 流失败，关闭 UDP 关联 (端口 %d): %v", localPort, err)
+				clientConn.Close()
+			}
+			return
+		}
+		setStream(stream)
+		log.Printf("[UDP] UDP 关联 (端口 %d) 已重新建流", localPort)
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// 智能模式下未命中任何规则的目标（新域名、IP 地址）的处理方式
+const (
+	UnmatchedDirect = "direct" // 直连（默认，与旧版本一致）
+	UnmatchedProxy  = "proxy"  // 走代理（宁可多走隧道也不泄露，受 kill switch 约束）
+	UnmatchedBlock  = "block"  // 拒绝（只允许规则内的目标）
+)
+
+// SetUnmatchedPolicy 设置智能模式下未命中规则的目标的处理方式（UnmatchedDirect / UnmatchedProxy / UnmatchedBlock）
+// 全局模式不受影响；localhost 始终直连。可在运行中切换，对之后新建的连接生效
+func (c *Client) SetUnmatchedPolicy(policy string) error {
+	if err := CheckUnmatchedPolicy(policy); err != nil {
+		return err
+	}
+	c.unmatchedPolicy.Store(policy)
+	return nil
+}
+
+// CheckUnmatchedPolicy 校验未命中规则策略
+func CheckUnmatchedPolicy(policy string) error {
+	switch policy {
+	case UnmatchedDirect, UnmatchedProxy, UnmatchedBlock:
+		return nil
+	}
+	return fmt.Errorf("未知的未命中规则策略: %q（可选 %s / %s / %s）", policy, UnmatchedDirect, UnmatchedProxy, UnmatchedBlock)
+}
+
+// unmatched 当前的未命中规则策略
+func (c *Client) unmatched() string {
+	if policy, ok := c.unmatchedPolicy.Load().(string); ok {
+		return policy
+	}
+	return UnmatchedDirect
+}
+
+// isLocalhost 本机地址（任何模式下都直连）：localhost 与回环地址（127.0.0.0/8、::1）
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Unmap().IsLoopback()
+}
@@ -0,0 +1,80 @@
+package core
+
+import "testing"
+
+func TestUnmatchedPolicy(t *testing.T) {
+	cases := []struct {
+		policy string
+		action string
+		rep    byte // 经 handleTCPConnect 转发时的 SOCKS5 回复码（直连不实际拨号，不检查）
+	}{
+		{UnmatchedDirect, RouteDirect, 0},
+		{UnmatchedProxy, RouteProxy, 0x04}, // 未连接节点：隧道不可用
+		{UnmatchedBlock, RouteBlock, 0x02},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			c := newRoutingClient(t, ModeSmart, "example.com\n")
+			if err := c.SetUnmatchedPolicy(tc.policy); err != nil {
+				t.Fatal(err)
+			}
+			// 新域名与没有规则的 IP 地址都按策略处理
+			for _, host := range []string{"new-site.org", "203.0.113.7", "2001:db8::7"} {
+				if d := c.route(host, false); d.Action != tc.action || d.Reason != RouteReasonUnmatched || d.Unmatched != tc.policy {
+					t.Errorf("%s 的决策 %+v", host, d)
+				}
+			}
+			// 命中规则与本机地址不受策略影响
+			if d := c.route("www.example.com", false); d.Action != RouteProxy || d.Reason != RouteReasonRule {
+				t.Errorf("命中规则的决策 %+v", d)
+			}
+			if d := c.route("127.0.0.1", false); d.Action != RouteDirect || d.Reason != RouteReasonLocal {
+				t.Errorf("本机地址的决策 %+v", d)
+			}
+			if tc.rep != 0 {
+				if rep := connectThrough(t, c, "new-site.org:443"); rep != tc.rep {
+					t.Fatalf("回复 0x%02x，期望 0x%02x", rep, tc.rep)
+				}
+			}
+			stats := c.GetStats(0)
+			if tc.policy == UnmatchedBlock && (stats.UnmatchedBlocked != 1 || stats.Proxy != 0) {
+				t.Fatalf("统计 %+v", stats)
+			}
+			if tc.policy == UnmatchedProxy && stats.Proxy != 1 {
+				t.Fatalf("统计 %+v", stats)
+			}
+		})
+	}
+}
+
+func TestUnmatchedPolicyKillSwitch(t *testing.T) {
+	c := newRoutingClient(t, ModeSmart, "")
+	c.SetKillSwitch(true)
+
+	// 策略为 proxy 时未命中的目标同样受 kill switch 约束，隧道断开时拒绝而不是直连
+	c.SetUnmatchedPolicy(UnmatchedProxy)
+	if d := c.route("new-site.org", false); d.Action != RouteBlock || d.Reason != RouteReasonKillSwitch {
+		t.Fatalf("proxy 策略在隧道断开时的决策 %+v", d)
+	}
+	// 策略为 direct 时不经过隧道，kill switch 不拦截
+	c.SetUnmatchedPolicy(UnmatchedDirect)
+	if d := c.route("new-site.org", false); d.Action != RouteDirect {
+		t.Fatalf("direct 策略的决策 %+v", d)
+	}
+	// 全局模式不使用未命中规则策略
+	c.SetUnmatchedPolicy(UnmatchedBlock)
+	c.SetMode(ModeGlobal)
+	if d := c.route("new-site.org", false); d.Reason != RouteReasonKillSwitch || d.Unmatched != "" {
+		t.Fatalf("全局模式的决策 %+v", d)
+	}
+}
+
+func TestSetUnmatchedPolicyInvalid(t *testing.T) {
+	c := NewClient("", "", 0, ModeSmart)
+	if err := c.SetUnmatchedPolicy("allow"); err == nil {
+		t.Fatal("未知策略应返回错误")
+	}
+	if c.unmatched() != UnmatchedDirect {
+		t.Fatalf("默认策略 %q", c.unmatched())
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultVerifyTimeout 隧道验证的默认超时
+// 服务端拒绝鉴权时会延迟 2-5 秒才回复伪装响应，超时需大于该延迟
+const DefaultVerifyTimeout = 10 * time.Second
+
+// ErrTunnelDown 当前没有可用的 QUIC 连接
+var ErrTunnelDown = errors.New("隧道未连接")
+
+// HandshakeTime 最近一次建立 QUIC 连接的耗时（拨号竞速开始到握手完成，不含鉴权），尚未连接成功时返回 0
+func (c *Client) HandshakeTime() time.Duration {
+	return time.Duration(c.handshakeTime.Load())
+}
+
+// Connect 建立 QUIC 连接并验证隧道可用，阻塞直到验证完成或 ctx 结束
+// 握手成功但鉴权被拒时返回 ErrAuthRejected，调用方可据此提示用户重新登录，而不是得到一条无法使用的隧道
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.ensureQuicConnection(); err != nil {
+		return fmt.Errorf("建立 QUIC 连接失败: %w", err)
+	}
+	return c.VerifyTunnel(ctx)
+}
+
+// VerifyTunnel 验证隧道端到端可用：开流、鉴权，再发送一次回显指令确认服务端正常处理流
+// ctx 没有截止时间时使用 DefaultVerifyTimeout
+func (c *Client) VerifyTunnel(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultVerifyTimeout)
+		defer cancel()
+	}
+
+	conn := c.getQuicConnection()
+	if conn == nil || conn.Context().Err() != nil {
+		return ErrTunnelDown
+	}
+
+	stream, err := c.openStream(conn)
+	if err != nil {
+		return fmt.Errorf("打开验证流失败: %w", err)
+	}
+	defer stream.Close()
+	defer stream.CancelRead(0)
+
+	deadline, _ := ctx.Deadline()
+	stream.SetDeadline(deadline)
+	// ctx 提前取消时中断阻塞的读写
+	stop := context.AfterFunc(ctx, func() { stream.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := c.authenticate(stream); err != nil {
+		if errors.Is(err, ErrAuthRejected) {
+			return err
+		}
+		return verifyError(ctx, "鉴权", err)
+	}
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	if _, err := stream.Write(append([]byte{0x00, opPing}, nonce...)); err != nil {
+		return verifyError(ctx, "发送验证指令", err)
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		return verifyError(ctx, "读取验证响应", err)
+	}
+	if status[0] != 0x00 {
+		// 旧版服务端不认识该指令（回复 0x01），但鉴权已通过且流被正常处理
+		return nil
+	}
+	echo := make([]byte, len(nonce))
+	if _, err := io.ReadFull(stream, echo); err != nil {
+		return verifyError(ctx, "读取验证响应", err)
+	}
+	if !bytes.Equal(echo, nonce) {
+		return fmt.Errorf("隧道验证失败: 回显数据不一致")
+	}
+	return nil
+}
+
+// verifyError 包装验证过程中的错误（超时 / 取消时返回 ctx 的错误）
+func verifyError(ctx context.Context, step string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("隧道验证失败（%s）: %w", step, ctxErr)
+	}
+	// 流的截止时间与 ctx 相同，可能先于 ctx 触发
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("隧道验证失败（%s）: %w", step, context.DeadlineExceeded)
+	}
+	return fmt.Errorf("隧道验证失败（%s）: %w", step, err)
+}
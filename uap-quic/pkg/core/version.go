@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Version 客户端版本号（语义化版本，发布时更新）
+const Version = "1.0.0"
+
+// VersionHeader 请求 uap-admin 时携带客户端版本号的请求头
+const VersionHeader = "X-UAP-Client-Version"
+
+// VersionInfo 客户端版本要求（uap-admin 的 /api/v1/client/version）
+type VersionInfo struct {
+	MinClientVersion string `json:"min_client_version"`
+	LatestVersion    string `json:"latest_version"`
+	UpgradeURL       string `json:"upgrade_url"`
+	UpgradeRequired  bool   `json:"upgrade_required"` // 当前版本低于最低要求
+	UpdateAvailable  bool   `json:"update_available"` // 有更新版本可用
+}
+
+// SetAPIHeaders 为发往 uap-admin 的请求设置鉴权与版本号请求头（token 为空时不设置鉴权头）
+func SetAPIHeaders(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	req.Header.Set(VersionHeader, Version)
+}
+
+// FetchVersionInfo 查询 uap-admin 的客户端版本要求（服务端根据请求头中的版本号计算是否需要升级）
+func FetchVersionInfo(url string) (*VersionInfo, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	SetAPIHeaders(req, "")
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var versionResp struct {
+		Code  int         `json:"code"`
+		Error string      `json:"error,omitempty"`
+		Data  VersionInfo `json:"data"`
+		Msg   string      `json:"msg,omitempty"`
+	}
+	if err := json.Unmarshal(respBody, &versionResp); err != nil {
+		return nil, fmt.Errorf("解析版本信息失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || versionResp.Code != 200 {
+		return nil, fmt.Errorf("版本接口: %w", ParseAPIError(resp.StatusCode, versionResp.Code, versionResp.Error, versionResp.Msg))
+	}
+
+	return &versionResp.Data, nil
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchVersionInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 服务端根据请求头中的版本号计算是否需要升级
+		required := r.Header.Get(VersionHeader) != Version
+		if required {
+			w.Write([]byte(`{"code":200,"data":{"upgrade_required":true}}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"data":{"min_client_version":"` + Version + `","upgrade_url":"https://example.com","upgrade_required":false}}`))
+	}))
+	defer srv.Close()
+
+	info, err := FetchVersionInfo(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UpgradeRequired || info.MinClientVersion != Version || info.UpgradeURL == "" {
+		t.Fatalf("版本信息 %+v", info)
+	}
+}
+
+func TestFetchVersionInfoError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUpgradeRequired)
+		w.Write([]byte(`{"code":42601,"error":"upgrade_required","msg":"客户端版本过低"}`))
+	}))
+	defer srv.Close()
+
+	if _, err := FetchVersionInfo(srv.URL); err == nil {
+		t.Fatal("错误响应应返回错误")
+	}
+}
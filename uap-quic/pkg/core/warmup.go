@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// 预热请求限制（与服务端一致）
+const (
+	warmupMaxBytes = 64 * 1024        // 单次预热最多请求的字节数
+	warmupMaxDelay = 10 * time.Second // 建立连接后最长等待多久再预热
+	warmupTimeout  = 10 * time.Second // 单次预热最长耗时
+)
+
+// WarmupConfig 建立连接后的预热请求：鉴权完成后等待一段随机时间，开一条短流向节点请求随机字节数的数据后关闭，
+// 模拟打开页面时的首次请求，避免握手后长时间静默被中间设备归类为低优先级流量。为 0 的项取 DefaultWarmup 的值
+type WarmupConfig struct {
+	MinBytes int           `json:"min_bytes"` // 请求的数据量下限（字节）
+	MaxBytes int           `json:"max_bytes"` // 请求的数据量上限（字节，最多 64KB）
+	MinDelay time.Duration `json:"min_delay"` // 连接建立后等待时间的下限
+	MaxDelay time.Duration `json:"max_delay"` // 连接建立后等待时间的上限（最长 10 秒）
+}
+
+// DefaultWarmup 默认的预热请求：2-24KB，连接后 0-300ms 内发出
+var DefaultWarmup = WarmupConfig{MinBytes: 2 * 1024, MaxBytes: 24 * 1024, MaxDelay: 300 * time.Millisecond}
+
+// WithDefaults 为 0 的项取默认值
+func (w WarmupConfig) WithDefaults() WarmupConfig {
+	if w.MinBytes == 0 {
+		w.MinBytes = DefaultWarmup.MinBytes
+	}
+	if w.MaxBytes == 0 {
+		w.MaxBytes = max(DefaultWarmup.MaxBytes, w.MinBytes)
+	}
+	if w.MaxDelay == 0 {
+		w.MaxDelay = max(DefaultWarmup.MaxDelay, w.MinDelay)
+	}
+	return w
+}
+
+// Validate 校验范围
+func (w WarmupConfig) Validate() error {
+	if w.MinBytes < 1 || w.MaxBytes < w.MinBytes || w.MaxBytes > warmupMaxBytes {
+		return fmt.Errorf("预热数据量范围无效 (%d-%d)，需满足 1 <= 下限 <= 上限 <= %d", w.MinBytes, w.MaxBytes, warmupMaxBytes)
+	}
+	if w.MinDelay < 0 || w.MaxDelay < w.MinDelay || w.MaxDelay > warmupMaxDelay {
+		return fmt.Errorf("预热等待时间范围无效 (%v-%v)，需满足 0 <= 下限 <= 上限 <= %v", w.MinDelay, w.MaxDelay, warmupMaxDelay)
+	}
+	return nil
+}
+
+// SetWarmup 开启建立连接后的预热请求（nil 关闭，默认关闭），配置不合法时返回错误并保留当前设置
+// 可在运行中切换，对之后建立的 QUIC 连接生效；需服务端支持，旧版服务端自动跳过
+// 预热流量只计入 GetStats 的 warmup 计数，不计入转发统计
+func (c *Client) SetWarmup(w *WarmupConfig) error {
+	if w == nil {
+		c.warmup.Store(nil)
+		return nil
+	}
+	cfg := w.WithDefaults()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	c.warmup.Store(&cfg)
+	return nil
+}
+
+// Warmup 当前的预热配置（nil 表示关闭）
+func (c *Client) Warmup() *WarmupConfig {
+	if w := c.warmup.Load(); w != nil {
+		cfg := *w
+		return &cfg
+	}
+	return nil
+}
+
+// WarmupStats 预热请求统计
+type WarmupStats struct {
+	Requests uint64 `json:"requests"` // 完成的预热请求数
+	Bytes    uint64 `json:"bytes"`    // 预热收到的数据量（字节）
+	Failures uint64 `json:"failures"` // 失败的预热请求数（服务端不支持时跳过，不计入）
+}
+
+// warmupStats 预热统计快照（没有发出过预热请求时返回 nil）
+func (c *Client) warmupStats() *WarmupStats {
+	s := WarmupStats{Requests: c.warmupRequests.Load(), Bytes: c.warmupBytes.Load(), Failures: c.warmupFailures.Load()}
+	if s == (WarmupStats{}) {
+		return nil
+	}
+	return &s
+}
+
+// startWarmup 新连接建立后按配置发出一次预热请求（未开启时什么都不做，不阻塞调用方）
+func (c *Client) startWarmup(conn quic.Connection) {
+	cfg := c.warmup.Load()
+	if cfg == nil {
+		return
+	}
+	delay := cfg.MinDelay + time.Duration(rand.Int63n(int64(cfg.MaxDelay-cfg.MinDelay)+1))
+	size := cfg.MinBytes + rand.Intn(cfg.MaxBytes-cfg.MinBytes+1)
+	go func() {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+		if c.serverCaps(conn)&capWarmup == 0 {
+			return // 旧版服务端不支持，跳过
+		}
+		n, err := c.warmupRequest(conn, size)
+		c.warmupBytes.Add(uint64(n))
+		if err != nil {
+			c.warmupFailures.Add(1)
+			log.Printf("⚠️ 预热请求失败: %v", err)
+			return
+		}
+		c.warmupRequests.Add(1)
+	}()
+}
+
+// warmupRequest 在新流上请求 size 字节的随机数据并读完，返回收到的字节数
+// 请求: 字节数 (2 字节, 大端)；响应: 0x00 + 数据后关闭流 / 0x01 拒绝（超出上限或过于频繁）
+func (c *Client) warmupRequest(conn quic.Connection, size int) (int64, error) {
+	stream, err := c.openAuthedStream(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	defer stream.CancelRead(0)
+	stream.SetDeadline(time.Now().Add(warmupTimeout))
+
+	req := []byte{0x00, opWarmup, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(size-1))
+	if _, err := stream.Write(req); err != nil {
+		return 0, err
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		return 0, err
+	}
+	if status[0] != 0x00 {
+		return 0, fmt.Errorf("服务端拒绝预热请求")
+	}
+	buf := c.bufPool.Get().([]byte)
+	defer c.bufPool.Put(buf)
+	return io.CopyBuffer(io.Discard, io.LimitReader(stream, warmupMaxBytes), buf)
+}
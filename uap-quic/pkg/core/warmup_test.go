@@ -0,0 +1,67 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWarmupConfig(t *testing.T) {
+	if got := (WarmupConfig{}).WithDefaults(); got != DefaultWarmup {
+		t.Fatalf("默认配置 %+v", got)
+	}
+	// 只设置下限时上限不低于下限
+	if got := (WarmupConfig{MinBytes: 32 * 1024, MinDelay: time.Second}).WithDefaults(); got.MaxBytes != 32*1024 || got.MaxDelay != time.Second {
+		t.Fatalf("只设置下限 %+v", got)
+	}
+
+	for _, tc := range []struct {
+		cfg WarmupConfig
+		ok  bool
+	}{
+		{DefaultWarmup, true},
+		{WarmupConfig{MinBytes: 1, MaxBytes: 1}, true},
+		{WarmupConfig{MinBytes: 1, MaxBytes: warmupMaxBytes, MaxDelay: warmupMaxDelay}, true},
+		{WarmupConfig{MinBytes: 0, MaxBytes: 10}, false},
+		{WarmupConfig{MinBytes: 10, MaxBytes: 5}, false},
+		{WarmupConfig{MinBytes: 1, MaxBytes: warmupMaxBytes + 1}, false},
+		{WarmupConfig{MinBytes: 1, MaxBytes: 1, MinDelay: -time.Second}, false},
+		{WarmupConfig{MinBytes: 1, MaxBytes: 1, MinDelay: 2 * time.Second, MaxDelay: time.Second}, false},
+		{WarmupConfig{MinBytes: 1, MaxBytes: 1, MaxDelay: warmupMaxDelay + 1}, false},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%+v: %v，期望有效=%v", tc.cfg, err, tc.ok)
+		}
+	}
+}
+
+func TestSetWarmup(t *testing.T) {
+	c := NewClient("127.0.0.1:1", "", 0, ModeGlobal)
+	t.Cleanup(c.Stop)
+	if c.Warmup() != nil {
+		t.Fatal("默认开启了预热")
+	}
+	if err := c.SetWarmup(&WarmupConfig{MinBytes: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	if w := c.Warmup(); w == nil || w.MinBytes != 1024 || w.MaxBytes != DefaultWarmup.MaxBytes {
+		t.Fatalf("预热配置 %+v", w)
+	}
+
+	// 不合法的配置保留当前设置；Warmup 返回副本
+	if err := c.SetWarmup(&WarmupConfig{MinBytes: warmupMaxBytes + 1}); err == nil || c.Warmup().MinBytes != 1024 {
+		t.Fatalf("不合法的配置: %v，当前 %+v", err, c.Warmup())
+	}
+	c.Warmup().MinBytes = 1
+	if c.Warmup().MinBytes != 1024 {
+		t.Fatal("修改返回值影响了当前配置")
+	}
+
+	if c.SetWarmup(nil); c.Warmup() != nil {
+		t.Fatal("关闭后仍有预热配置")
+	}
+	// 未开启时不发出请求，统计中没有预热项
+	c.startWarmup(nil)
+	if c.GetStats(0).Warmup != nil {
+		t.Fatal("未开启时统计中出现预热")
+	}
+}
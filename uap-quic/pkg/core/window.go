@@ -0,0 +1,22 @@
+package core
+
+import "uap-quic/pkg/window"
+
+// SetFlowWindows 设置客户端的 QUIC 接收窗口（下行方向的流控），配置不合法时返回错误并保留当前设置
+// 对之后建立的 QUIC 连接生效（重连或 Reconnect 后）；上行方向的窗口由服务端的同名参数决定
+func (c *Client) SetFlowWindows(w window.Config) error {
+	w = w.WithDefaults()
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	c.flowWindows.Store(&w)
+	return nil
+}
+
+// FlowWindows 当前的 QUIC 接收窗口
+func (c *Client) FlowWindows() window.Config {
+	if w := c.flowWindows.Load(); w != nil {
+		return *w
+	}
+	return window.Default
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"testing"
+
+	"uap-quic/pkg/window"
+)
+
+func TestSetFlowWindows(t *testing.T) {
+	c := NewClient("", "", 0, ModeGlobal)
+	if c.FlowWindows() != window.Default {
+		t.Fatalf("默认窗口 %s", c.FlowWindows())
+	}
+	if err := c.SetFlowWindows(window.FromKB(0, 1024, 0, 2048)); err != nil {
+		t.Fatal(err)
+	}
+	want := c.FlowWindows()
+	if want.MaxStream != 1<<20 || want.InitialStream != 1<<20 {
+		t.Fatalf("设置后的窗口 %s", want)
+	}
+	// 不合法的配置返回错误并保留当前设置
+	if err := c.SetFlowWindows(window.Config{MaxStream: 8 << 20, MaxConn: 4 << 20}); err == nil {
+		t.Fatal("单流最大窗口大于连接最大窗口时应返回错误")
+	}
+	if c.FlowWindows() != want || c.ConfigSnapshot().FlowWindows != want {
+		t.Fatalf("设置失败后窗口变为 %s", c.FlowWindows())
+	}
+}
@@ -0,0 +1,72 @@
+package diag
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// File 诊断包中的一个文件
+type File struct {
+	Name string
+	Data []byte
+}
+
+// JSONFile 把 v 编码为缩进的 JSON 文件（编码失败时文件内容为错误信息）
+func JSONFile(name string, v interface{}) File {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		data = []byte(fmt.Sprintf("编码失败: %v", err))
+	}
+	return File{Name: name, Data: data}
+}
+
+// ClientFiles 客户端的配置快照（敏感值只记录是否设置）与运行统计；client 为 nil 时只记录未运行
+func ClientFiles(client *core.Client) []File {
+	if client == nil {
+		return []File{JSONFile("config.json", map[string]interface{}{"running": false, "version": core.Version})}
+	}
+	return []File{
+		JSONFile("config.json", client.ConfigSnapshot()),
+		JSONFile("stats.json", client.GetStats(0)),
+	}
+}
+
+// Write 把 files 写入 zip 文件 path（已存在时覆盖），每个文件写入前都经过 Redact 脱敏
+func Write(path string, files []File, secrets []string) (err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建诊断包失败: %w", err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	zw := zip.NewWriter(out)
+	files = append(files, JSONFile("manifest.json", map[string]interface{}{
+		"client_version": core.Version,
+		"created_at":     time.Now().Format(time.RFC3339),
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+	}))
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(Redact(string(f.Data), secrets))); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,52 @@
+package diag
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRedactsBundle(t *testing.T) {
+	const token = "user-token-0123456789"
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	files := []File{
+		{Name: "client.log", Data: []byte("连接时使用 " + token)},
+		JSONFile("config.json", map[string]interface{}{"token_set": true, "ticket_url": "https://admin/ticket?token=" + token}),
+	}
+	if err := Write(path, files, []string{token}); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if bytes.Contains(data, []byte(token)) {
+			t.Fatalf("%s 中包含 token 原文: %s", f.Name, data)
+		}
+		if f.Name == "config.json" && !bytes.Contains(data, []byte(`"token_set": true`)) {
+			t.Fatalf("config.json 脱敏过度: %s", data)
+		}
+	}
+	if strings.Join(names, ",") != "client.log,config.json,manifest.json" {
+		t.Fatalf("诊断包中的文件 %v", names)
+	}
+
+	// 写入失败时不留下残缺文件
+	if err := Write(filepath.Join(t.TempDir(), "missing", "bundle.zip"), files, nil); err == nil {
+		t.Fatal("目录不存在时应返回错误")
+	}
+}
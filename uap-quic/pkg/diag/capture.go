@@ -0,0 +1,153 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 抓取时长
+const (
+	DefaultDuration = 60 * time.Second
+	MaxDuration     = 10 * time.Minute
+)
+
+// maxCaptureBytes 单次抓取的日志与 qlog 合计上限，超出后不再记录（诊断包中标记为截断）
+const maxCaptureBytes = 32 << 20
+
+// ErrCaptureRunning 已有诊断抓取在进行中（日志输出是全局的，同一时间只允许一个抓取）
+var ErrCaptureRunning = errors.New("已有诊断抓取在进行中")
+
+// errCaptureStopped 抓取结束或超出上限后写入 qlog 返回的错误，qlog 记录随之停止
+var errCaptureStopped = errors.New("诊断抓取已结束")
+
+// capturing 是否有抓取在进行中
+var capturing atomic.Bool
+
+// Capture 一次限时抓取：期间的客户端日志（全部输出，时间戳精确到微秒）与 QUIC 连接的 qlog
+type Capture struct {
+	started  time.Time
+	prevLog  io.Writer
+	prevFlag int
+	stopOnce sync.Once
+
+	mu        sync.Mutex
+	stopped   time.Time // 非零表示已结束
+	size      int
+	truncated bool
+	log       bytes.Buffer
+	qlogs     []*qlogFile
+}
+
+// qlogFile 单条 QUIC 连接的 qlog
+type qlogFile struct {
+	name string
+	buf  bytes.Buffer
+}
+
+// Start 开始抓取客户端日志；qlog 需要把 OpenQlog 交给 core.Client.SetQlog
+func Start() (*Capture, error) {
+	if !capturing.CompareAndSwap(false, true) {
+		return nil, ErrCaptureRunning
+	}
+	c := &Capture{started: time.Now(), prevLog: log.Writer(), prevFlag: log.Flags()}
+	// 原输出在前：抓取写入不会失败，不影响正常日志
+	log.SetOutput(io.MultiWriter(c.prevLog, logWriter{c}))
+	log.SetFlags(c.prevFlag | log.Lmicroseconds)
+	log.Printf("🩺 开始诊断抓取")
+	return c, nil
+}
+
+// logWriter 把日志写入抓取（超出上限时静默丢弃）
+type logWriter struct{ c *Capture }
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.c.write(&w.c.log, p)
+	return len(p), nil
+}
+
+// write 在上限内写入 dst，返回是否写入
+func (c *Capture) write(dst *bytes.Buffer, p []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stopped.IsZero() {
+		return false
+	}
+	if c.size+len(p) > maxCaptureBytes {
+		c.truncated = true
+		return false
+	}
+	c.size += len(p)
+	dst.Write(p)
+	return true
+}
+
+// OpenQlog 为一条 QUIC 连接创建 qlog 输出（传给 core.Client.SetQlog）
+// 抓取结束或超出上限后写入返回错误，该连接的 qlog 记录随之停止
+func (c *Capture) OpenQlog(odcid string) io.WriteCloser {
+	f := &qlogFile{name: "qlog/" + odcid + ".sqlog"}
+	c.mu.Lock()
+	c.qlogs = append(c.qlogs, f)
+	c.mu.Unlock()
+	return qlogWriter{c: c, f: f}
+}
+
+// qlogWriter 单条连接的 qlog 输出
+type qlogWriter struct {
+	c *Capture
+	f *qlogFile
+}
+
+func (w qlogWriter) Write(p []byte) (int, error) {
+	if !w.c.write(&w.f.buf, p) {
+		return 0, errCaptureStopped
+	}
+	return len(p), nil
+}
+
+func (w qlogWriter) Close() error { return nil }
+
+// Stop 结束抓取并恢复日志输出（可重复调用）
+func (c *Capture) Stop() {
+	c.stopOnce.Do(func() {
+		log.Printf("🩺 诊断抓取结束")
+		c.mu.Lock()
+		c.stopped = time.Now()
+		c.mu.Unlock()
+		log.SetOutput(c.prevLog)
+		log.SetFlags(c.prevFlag)
+		capturing.Store(false)
+	})
+}
+
+// Files 抓取到的日志与 qlog（需先 Stop）
+func (c *Capture) Files() []File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := []File{
+		{Name: "client.log", Data: c.log.Bytes()},
+		JSONFile("capture.json", map[string]interface{}{
+			"started_at":  c.started.Format(time.RFC3339),
+			"stopped_at":  c.stopped.Format(time.RFC3339),
+			"truncated":   c.truncated,
+			"qlog_files":  len(c.qlogs),
+			"limit_bytes": maxCaptureBytes,
+		}),
+	}
+	for _, f := range c.qlogs {
+		files = append(files, File{Name: f.name, Data: f.buf.Bytes()})
+	}
+	return files
+}
+
+// ClampDuration 把抓取时长限制在 (0, MaxDuration]，<= 0 使用 DefaultDuration
+func ClampDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return DefaultDuration
+	}
+	return min(d, MaxDuration)
+}
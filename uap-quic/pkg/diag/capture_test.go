@@ -0,0 +1,107 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fileData 按名称查找抓取或诊断包中的文件
+func fileData(files []File, name string) ([]byte, bool) {
+	for _, f := range files {
+		if f.Name == name {
+			return f.Data, true
+		}
+	}
+	return nil, false
+}
+
+func TestCaptureLogsAndStops(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+
+	c, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Start(); !errors.Is(err, ErrCaptureRunning) {
+		t.Fatalf("抓取进行中再次开始返回 %v", err)
+	}
+	log.Printf("抓取期间的日志")
+	qlog := c.OpenQlog("0a1b")
+	if _, err := qlog.Write([]byte(`{"qlog_version":"draft-02"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Stop()
+	c.Stop() // 可重复调用
+	log.Printf("抓取结束后的日志")
+	if _, err := qlog.Write([]byte("late")); !errors.Is(err, errCaptureStopped) {
+		t.Fatalf("抓取结束后写入 qlog 返回 %v", err)
+	}
+
+	files := c.Files()
+	logData, _ := fileData(files, "client.log")
+	if !bytes.Contains(logData, []byte("抓取期间的日志")) || bytes.Contains(logData, []byte("抓取结束后的日志")) {
+		t.Fatalf("抓取的日志:\n%s", logData)
+	}
+	// 原日志输出不受影响，结束后恢复
+	if !strings.Contains(out.String(), "抓取期间的日志") || !strings.Contains(out.String(), "抓取结束后的日志") {
+		t.Fatalf("原日志输出:\n%s", out.String())
+	}
+	if data, ok := fileData(files, "qlog/0a1b.sqlog"); !ok || string(data) != `{"qlog_version":"draft-02"}` {
+		t.Fatalf("qlog 文件 %q", data)
+	}
+	if log.Flags()&log.Lmicroseconds != 0 {
+		t.Fatal("抓取结束后未恢复日志格式")
+	}
+
+	// 结束后可以开始新的抓取
+	c, err = Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+}
+
+func TestCaptureLimit(t *testing.T) {
+	log.SetOutput(io.Discard)
+	c, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	qlog := c.OpenQlog("big")
+	if _, err := qlog.Write(make([]byte, maxCaptureBytes-100)); err != nil {
+		t.Fatal(err)
+	}
+	// 超出上限后停止记录并标记截断
+	if _, err := qlog.Write(make([]byte, 200)); !errors.Is(err, errCaptureStopped) {
+		t.Fatalf("超出上限后写入返回 %v", err)
+	}
+	c.Stop()
+	data, _ := fileData(c.Files(), "capture.json")
+	if !bytes.Contains(data, []byte(`"truncated": true`)) {
+		t.Fatalf("capture.json: %s", data)
+	}
+}
+
+func TestClampDuration(t *testing.T) {
+	for in, want := range map[time.Duration]time.Duration{
+		0:               DefaultDuration,
+		-time.Second:    DefaultDuration,
+		5 * time.Second: 5 * time.Second,
+		time.Hour:       MaxDuration,
+		MaxDuration:     MaxDuration,
+	} {
+		if got := ClampDuration(in); got != want {
+			t.Errorf("ClampDuration(%v) = %v，期望 %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package diag 诊断包：限时抓取客户端日志与 qlog，连同配置快照、统计打包为 zip，供用户反馈问题时提交
+package diag
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted 敏感值被替换后的占位符
+const Redacted = "[REDACTED]"
+
+// minSecretLen 参与替换的敏感值的最短长度（过短的值替换后会误伤正常文本）
+const minSecretLen = 8
+
+var (
+	// jwtPattern JWT / 连接票据（三段 base64url，头部以 eyJ 开头）
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// bearerPattern Authorization 头中的凭证
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',;]+`)
+	// keyValuePattern 形如 token=xxx / "psk": "xxx" 的键值（键名以 token、secret、psk、password、private_key、wallet_key、signature 结尾）
+	// 值为对象或数组时不匹配（qlog 中的结构化字段）
+	keyValuePattern = regexp.MustCompile(`(?i)("?[a-z_-]*(?:token|secret|psk|password|private_key|wallet_key|signature)"?\s*[:=]\s*"?)([^\s"',;&{}\[\]][^\s"',;&}]*)`)
+)
+
+// Redact 去除文本中的敏感信息：
+//  1. secrets 中的每个值（token、连接票据、PSK、钱包私钥等，短于 8 个字符的忽略）
+//  2. 任何 JWT 形式的字符串与 Bearer 凭证（即使不在 secrets 中，如已过期的旧票据）
+//  3. 键名像凭证的键值对的值（token=、"psk": 等）
+//
+// 布尔值与占位符本身不会被替换，结果可以重复脱敏
+func Redact(text string, secrets []string) string {
+	// 长的先替换，避免短值是长值的一部分时留下残片
+	sorted := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		if len(s) >= minSecretLen {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, s := range sorted {
+		text = strings.ReplaceAll(text, s, Redacted)
+	}
+
+	text = jwtPattern.ReplaceAllString(text, Redacted)
+	text = bearerPattern.ReplaceAllString(text, "${1}"+Redacted)
+	text = keyValuePattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := keyValuePattern.FindStringSubmatch(m)
+		switch strings.ToLower(parts[2]) {
+		case "true", "false", "null", strings.ToLower(Redacted):
+			return m
+		}
+		return parts[1] + Redacted
+	})
+	return text
+}
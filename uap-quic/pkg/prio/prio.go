@@ -0,0 +1,151 @@
+// Package prio 同一条 QUIC 连接上交互流量优先于大流量（应用层近似实现，客户端与服务端共用）
+//
+// quic-go 不提供流优先级：发送端在有数据的流之间轮询，一个大下载与一个网页请求平分发送机会，
+// 大流量流每次写入的数据都要排在前面。这里在写入 QUIC 流之前排队：
+//   - 交互流的写入（quic-go 的 Write 在数据被打包发出前不返回）正在进行时，大流量流的下一次写入最多等待 MaxBulkWait；
+//   - 大流量流的写入切成 BulkChunk 大小的分片，交互流的数据最多排在每条大流量流的一个分片之后。
+//
+// 只影响本端发出的方向（客户端的上行、节点的下行），网络中其他位置的排队不受控制。
+package prio
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBulkAfter 单条流写入超过该字节数后按大流量处理
+	DefaultBulkAfter = 1 << 20
+	// BulkChunk 大流量流单次写入的最大字节数
+	BulkChunk = 16 << 10
+	// MaxBulkWait 大流量流单个分片最多让路多久（之后照常写入，大流量不会被交互流量完全饿死）
+	MaxBulkWait = 20 * time.Millisecond
+)
+
+// Class 流的类型
+type Class int
+
+const (
+	Interactive Class = iota // 交互流量：写入超过 bulkAfter 字节后降为 Bulk
+	Bulk                     // 大流量：写入前给交互流量让路
+	Realtime                 // 实时流量（如 tag=game）：按交互流量处理，不会降级
+)
+
+// Scheduler 一条连接上的优先级调度（nil 表示不调度，Writer 原样返回）
+type Scheduler struct {
+	mu     sync.Mutex
+	active int           // 正在写入的交互流数
+	idle   chan struct{} // active 归零时关闭
+
+	demoted atomic.Int64 // 降为大流量的流数
+	waits   atomic.Int64 // 大流量分片让路的次数
+	waited  atomic.Int64 // 让路的总时长（纳秒）
+}
+
+// NewScheduler 创建调度器
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Stats 调度统计
+type Stats struct {
+	Demoted int64         `json:"demoted"` // 写入量超过阈值后降为大流量的流数
+	Waits   int64         `json:"waits"`   // 大流量分片给交互流量让路的次数
+	Waited  time.Duration `json:"waited"`  // 让路的总时长
+}
+
+// Stats 返回调度统计
+func (s *Scheduler) Stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{Demoted: s.demoted.Load(), Waits: s.waits.Load(), Waited: time.Duration(s.waited.Load())}
+}
+
+// Writer 包装一条流的写入方向；bulkAfter 为 Interactive 流降级的字节数（<= 0 表示不降级）
+func (s *Scheduler) Writer(w io.Writer, class Class, bulkAfter int64) io.Writer {
+	if s == nil {
+		return w
+	}
+	return &writer{s: s, w: w, class: class, bulkAfter: bulkAfter}
+}
+
+// begin 交互流开始写入
+func (s *Scheduler) begin() {
+	s.mu.Lock()
+	if s.active == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.active++
+	s.mu.Unlock()
+}
+
+// end 交互流写入结束
+func (s *Scheduler) end() {
+	s.mu.Lock()
+	s.active--
+	if s.active == 0 {
+		close(s.idle)
+	}
+	s.mu.Unlock()
+}
+
+// yield 大流量分片写入前等待交互流写完（最多 MaxBulkWait）
+func (s *Scheduler) yield() {
+	s.mu.Lock()
+	if s.active == 0 {
+		s.mu.Unlock()
+		return
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	start := time.Now()
+	t := time.NewTimer(MaxBulkWait)
+	select {
+	case <-idle:
+	case <-t.C:
+	}
+	t.Stop()
+	s.waits.Add(1)
+	s.waited.Add(int64(time.Since(start)))
+}
+
+// writer 单条流的写入方向（与底层流一样只由一个 goroutine 写入）
+type writer struct {
+	s         *Scheduler
+	w         io.Writer
+	class     Class
+	bulkAfter int64
+	written   int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.class == Interactive && w.bulkAfter > 0 && w.written >= w.bulkAfter {
+		w.class = Bulk
+		w.s.demoted.Add(1)
+	}
+	if w.class != Bulk {
+		w.s.begin()
+		n, err := w.w.Write(p)
+		w.s.end()
+		w.written += int64(n)
+		return n, err
+	}
+
+	total := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), BulkChunk)]
+		w.s.yield()
+		n, err := w.w.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[len(chunk):]
+	}
+	return total, nil
+}
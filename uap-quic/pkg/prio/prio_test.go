@@ -0,0 +1,202 @@
+package prio
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sharedLink 模拟同一条连接的发送通道：同一时刻只有一个写入，每个字节占用固定的发送时间
+// （与 quic-go 一样，Write 在数据发出前不返回）
+type sharedLink struct {
+	mu      sync.Mutex
+	perByte time.Duration
+	writes  []int // 每次写入的字节数
+}
+
+func (l *sharedLink) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writes = append(l.writes, len(p))
+	time.Sleep(time.Duration(len(p)) * l.perByte)
+	return len(p), nil
+}
+
+// linkRate 测试链路每字节的发送时间：一个大流量分片约 2ms
+const linkRate = 2 * time.Millisecond / BulkChunk
+
+// startBulk 在 link 上持续写入大块数据（s 为 nil 时不调度），直到返回的函数被调用
+func startBulk(s *Scheduler, link *sharedLink, class Class) func() {
+	w := s.Writer(link, class, 0)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		block := make([]byte, 64*BulkChunk)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			w.Write(block)
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// interactiveLatency 大流量写入进行中时，交互流一次小写入的耗时（s 为 nil 时不调度）
+func interactiveLatency(s *Scheduler, link *sharedLink) time.Duration {
+	w := s.Writer(link, Interactive, 0)
+	start := time.Now()
+	w.Write(make([]byte, 512))
+	return time.Since(start)
+}
+
+func TestNilScheduler(t *testing.T) {
+	var s *Scheduler
+	var buf bytes.Buffer
+	if w := s.Writer(&buf, Bulk, 1); w != io.Writer(&buf) {
+		t.Fatal("未开启调度时包装了写入方向")
+	}
+	if s.Stats() != (Stats{}) {
+		t.Fatal("未开启调度时有统计")
+	}
+}
+
+func TestBulkWritesChunked(t *testing.T) {
+	s := NewScheduler()
+	link := &sharedLink{}
+	data := make([]byte, 2*BulkChunk+100)
+	if n, err := s.Writer(link, Bulk, 0).Write(data); n != len(data) || err != nil {
+		t.Fatalf("写入 %d, %v", n, err)
+	}
+	if want := []int{BulkChunk, BulkChunk, 100}; len(link.writes) != 3 || link.writes[0] != want[0] || link.writes[2] != want[2] {
+		t.Fatalf("大流量分片 %v，期望 %v", link.writes, want)
+	}
+
+	// 交互流整块写入
+	link.writes = nil
+	s.Writer(link, Interactive, 0).Write(data)
+	if len(link.writes) != 1 {
+		t.Fatalf("交互流的写入被分片: %v", link.writes)
+	}
+}
+
+func TestDemoteAfterBulkAfter(t *testing.T) {
+	s := NewScheduler()
+	link := &sharedLink{}
+	w := s.Writer(link, Interactive, 2*BulkChunk)
+	w.Write(make([]byte, 2*BulkChunk))
+	if s.Stats().Demoted != 0 || len(link.writes) != 1 {
+		t.Fatalf("未超过阈值时降级: %+v %v", s.Stats(), link.writes)
+	}
+	// 超过阈值后的写入按大流量分片
+	w.Write(make([]byte, 2*BulkChunk))
+	if s.Stats().Demoted != 1 || len(link.writes) != 3 {
+		t.Fatalf("超过阈值后 %+v %v", s.Stats(), link.writes)
+	}
+
+	// 实时流量不降级；阈值 <= 0 时不降级
+	for _, w := range []io.Writer{s.Writer(link, Realtime, 1), s.Writer(link, Interactive, 0)} {
+		w.Write(make([]byte, 4*BulkChunk))
+		w.Write(make([]byte, 4*BulkChunk))
+	}
+	if s.Stats().Demoted != 1 {
+		t.Fatalf("实时流量或未设置阈值的流被降级: %+v", s.Stats())
+	}
+}
+
+// TestInteractiveNotStarved 大流量持续写满链路时，交互流的写入最多排在一个大流量分片之后
+func TestInteractiveNotStarved(t *testing.T) {
+	s := NewScheduler()
+	link := &sharedLink{perByte: linkRate}
+	stop := startBulk(s, link, Bulk)
+	defer stop()
+	time.Sleep(10 * time.Millisecond)
+
+	var worst time.Duration
+	for i := 0; i < 10; i++ {
+		worst = max(worst, interactiveLatency(s, link))
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 一个分片约 2ms；不调度时要等整块 64 个分片（约 128ms）写完
+	if worst > 30*time.Millisecond {
+		t.Fatalf("交互流写入最长耗时 %v，被大流量阻塞", worst)
+	}
+	if st := s.Stats(); st.Waits == 0 {
+		t.Fatalf("大流量没有给交互流让路: %+v", st)
+	}
+}
+
+// TestBulkNotStarved 交互流量持续写入时，大流量的每个分片最多让路 MaxBulkWait，仍能写完
+func TestBulkNotStarved(t *testing.T) {
+	s := NewScheduler()
+	link := &sharedLink{perByte: linkRate}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ { // 多条交互流轮流写入，调度器始终有交互写入在进行
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := s.Writer(link, Realtime, 0)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w.Write(make([]byte, BulkChunk))
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	const chunks = 8
+	done := make(chan struct{})
+	go func() {
+		s.Writer(link, Bulk, 0).Write(make([]byte, chunks*BulkChunk))
+		close(done)
+	}()
+	// 每个分片最多让路 MaxBulkWait，再排在几个交互写入之后
+	select {
+	case <-done:
+	case <-time.After(chunks * (MaxBulkWait + 50*time.Millisecond)):
+		t.Fatal("交互流量持续写入时大流量被饿死")
+	}
+}
+
+// BenchmarkInteractiveUnderBulk 两条大流量流持续写满链路时，交互流一次小写入的延迟（不调度与调度对比）
+func BenchmarkInteractiveUnderBulk(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		s    *Scheduler
+	}{{"off", nil}, {"on", NewScheduler()}} {
+		b.Run(tc.name, func(b *testing.B) {
+			link := &sharedLink{perByte: linkRate}
+			for i := 0; i < 2; i++ {
+				defer startBulk(tc.s, link, Bulk)()
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			latencies := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				latencies = append(latencies, interactiveLatency(tc.s, link))
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*9/10].Microseconds())/1000, "p90-ms")
+		})
+	}
+}
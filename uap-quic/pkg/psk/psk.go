@@ -0,0 +1,38 @@
+package psk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ProofLen 鉴权行开头 PSK 证明的长度（HMAC-SHA256 的十六进制编码）
+const ProofLen = sha256.Size * 2
+
+// proofLabel 域分隔标签，避免 PSK 证明被挪作他用
+const proofLabel = "uap-psk-v1:"
+
+// proof 计算 hex(HMAC-SHA256(psk, label + token))
+func proof(psk, token string) string {
+	mac := hmac.New(sha256.New, []byte(psk))
+	mac.Write([]byte(proofLabel + token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal 用 PSK 封装鉴权凭证：PSK 证明 + token
+// 没有 PSK 的一方无法构造合法的鉴权行，也无法把鉴权行与普通随机前缀区分开
+func Seal(psk, token string) string {
+	return proof(psk, token) + token
+}
+
+// Open 校验鉴权行开头的 PSK 证明并拆出 token，证明不匹配返回 false
+func Open(psk, line string) (string, bool) {
+	if len(line) <= ProofLen {
+		return "", false
+	}
+	token := line[ProofLen:]
+	if !hmac.Equal([]byte(line[:ProofLen]), []byte(proof(psk, token))) {
+		return "", false
+	}
+	return token, true
+}
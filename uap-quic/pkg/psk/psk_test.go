@@ -0,0 +1,30 @@
+package psk
+
+import "testing"
+
+func TestSealOpen(t *testing.T) {
+	line := Seal("secret", "token")
+	if len(line) != ProofLen+len("token") {
+		t.Fatalf("鉴权行长度 %d", len(line))
+	}
+	if token, ok := Open("secret", line); !ok || token != "token" {
+		t.Fatalf("Open = %q, %v", token, ok)
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	line := Seal("secret", "token")
+	tampered := line[:len(line)-1] + "x"
+
+	for name, tc := range map[string]struct{ key, line string }{
+		"错误的 PSK":   {"other", line},
+		"篡改 token":  {"secret", tampered},
+		"没有 PSK 证明": {"secret", "token"},
+		"只有 PSK 证明": {"secret", line[:ProofLen]},
+		"空鉴权行":      {"secret", ""},
+	} {
+		if _, ok := Open(tc.key, tc.line); ok {
+			t.Errorf("%s: 应校验失败", name)
+		}
+	}
+}
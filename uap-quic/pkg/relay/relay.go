@@ -0,0 +1,20 @@
+// Package relay 双向转发结束时的收尾（客户端、节点与 TUN 共用）
+package relay
+
+import "time"
+
+// Deadliner 可以用截止时间打断读写的连接（net.Conn 与 quic.Stream 都满足）
+type Deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// Stop 打断仍在进行的转发并等待转发协程退出：conns 的读写截止时间设为现在，阻塞中的读写立即返回，wait 返回时所有方向都已退出
+// 双向转发的一个方向结束后，须先调用 Stop 再关闭连接、再返回：quic.Stream 的 Close 不能与 Write 并发调用，
+// 转发协程从缓冲池借用的缓冲区也要在复制结束、归还之后，调用方才能认为转发已经完成
+func Stop(wait func(), conns ...Deadliner) {
+	now := time.Now()
+	for _, c := range conns {
+		c.SetDeadline(now)
+	}
+	wait()
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStop 打断阻塞中的读取，wait 返回时转发协程都已退出
+func TestStop(t *testing.T) {
+	a, peerA := net.Pipe()
+	b, peerB := net.Pipe()
+	defer peerA.Close()
+	defer peerB.Close()
+
+	done := make(chan struct{}, 2)
+	for _, c := range []net.Conn{a, b} {
+		go func(c net.Conn) {
+			io.Copy(io.Discard, c) // 对端没有写入，一直阻塞
+			done <- struct{}{}
+		}(c)
+	}
+
+	exited := 0
+	finished := make(chan struct{})
+	go func() {
+		Stop(func() {
+			<-done
+			<-done
+			exited = 2
+		}, a, b)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop 未打断阻塞中的读取")
+	}
+	if exited != 2 {
+		t.Fatal("Stop 在转发协程退出前返回")
+	}
+}
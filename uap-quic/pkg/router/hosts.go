@@ -0,0 +1,106 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Hosts 本地 hosts 覆盖表（域名 -> IP），在分流之前查询
+// 精确域名优先；"*.example.com" 匹配 example.com 的所有子域名（不含 example.com 本身），多个通配符取最具体的
+type Hosts struct {
+	exact  map[string]net.IP
+	suffix map[string]net.IP // 通配符去掉 "*." 后的后缀
+}
+
+// ParseHosts 解析 hosts 文件格式的文本：每行 "IP 域名 [域名...]"，# 之后为注释
+// 域名按规则相同的方式规范化（国际化域名转换为 punycode，见 CanonicalDomain）
+// 同一域名出现多次时以最后一次为准
+func ParseHosts(text string) (*Hosts, error) {
+	h := &Hosts{exact: make(map[string]net.IP), suffix: make(map[string]net.IP)}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("hosts 第 %d 行缺少域名: %q", lineNum, scanner.Text())
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("hosts 第 %d 行 IP 格式错误: %q", lineNum, fields[0])
+		}
+		for _, name := range fields[1:] {
+			if suffix, ok := strings.CutPrefix(name, "*."); ok {
+				if suffix == "" || strings.Contains(suffix, "*") {
+					return nil, fmt.Errorf("hosts 第 %d 行通配符格式错误: %q（应为 *.example.com）", lineNum, name)
+				}
+				if suffix, err := CanonicalDomain(suffix); err == nil {
+					h.suffix[suffix] = ip
+					continue
+				}
+			} else if !strings.Contains(name, "*") {
+				if name, err := CanonicalDomain(name); err == nil {
+					h.exact[name] = ip
+					continue
+				}
+			}
+			return nil, fmt.Errorf("hosts 第 %d 行域名格式错误: %q", lineNum, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 hosts 失败: %v", err)
+	}
+	return h, nil
+}
+
+// LoadHosts 从文件加载 hosts 覆盖表
+func LoadHosts(filename string) (*Hosts, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开 hosts 文件失败: %v", err)
+	}
+	return ParseHosts(string(data))
+}
+
+// Lookup 查询域名的覆盖 IP，返回命中的条目（精确域名或 "*.后缀"），用于日志说明流量去向
+// IP 地址与未命中的域名返回 false
+func (h *Hosts) Lookup(host string) (net.IP, string, bool) {
+	if h == nil || net.ParseIP(host) != nil {
+		return nil, "", false
+	}
+	host = canonicalLookup(host)
+	if ip, ok := h.exact[host]; ok {
+		return ip, host, true
+	}
+	// 从最长的父域名开始匹配通配符
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		parent := host[i+1:]
+		if ip, ok := h.suffix[parent]; ok {
+			return ip, "*." + parent, true
+		}
+		next := strings.IndexByte(parent, '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, "", false
+}
+
+// Len 覆盖条目数
+func (h *Hosts) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.exact) + len(h.suffix)
+}
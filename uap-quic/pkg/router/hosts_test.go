@@ -0,0 +1,94 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostsLookup(t *testing.T) {
+	h, err := ParseHosts(`
+# 测试环境
+10.0.0.1   api.example.com  www.example.com
+10.0.0.2   *.example.com          # 其余子域名
+10.0.0.3   *.cdn.example.com
+10.0.0.9   api.example.com        # 重复的域名以最后一次为准
+2001:db8::1 v6.test
+10.0.0.4   BÜCHER.example
+10.0.0.5   *.xn--bcher-kva.test
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != 7 {
+		t.Fatalf("条目数 %d，期望 7", h.Len())
+	}
+
+	cases := []struct {
+		host, ip, entry string
+	}{
+		{"api.example.com", "10.0.0.9", "api.example.com"},
+		{"WWW.Example.COM.", "10.0.0.1", "www.example.com"}, // 大小写、末尾的点与规则相同地规范化
+		{"mail.example.com", "10.0.0.2", "*.example.com"},
+		{"a.b.example.com", "10.0.0.2", "*.example.com"},
+		{"img.cdn.example.com", "10.0.0.3", "*.cdn.example.com"}, // 多个通配符取最具体的
+		{"v6.test", "2001:db8::1", "v6.test"},
+		{"bücher.example", "10.0.0.4", "xn--bcher-kva.example"}, // 国际化域名按 punycode 匹配
+		{"XN--BCHER-KVA.Example.", "10.0.0.4", "xn--bcher-kva.example"},
+		{"Shop.BÜCHER.test.", "10.0.0.5", "*.xn--bcher-kva.test"}, // 浏览器流量中的大写与末尾的点
+	}
+	for _, tc := range cases {
+		ip, entry, ok := h.Lookup(tc.host)
+		if !ok || ip.String() != tc.ip || entry != tc.entry {
+			t.Errorf("Lookup(%q) = %v %q %v，期望 %s %q", tc.host, ip, entry, ok, tc.ip, tc.entry)
+		}
+	}
+
+	// 通配符不匹配域名本身；IP 地址与未命中的域名不覆盖
+	for _, host := range []string{"example.com", "cdn.example.com.evil", "notexample.com", "10.0.0.1", "::1", ""} {
+		if ip, _, ok := h.Lookup(host); ok {
+			t.Errorf("Lookup(%q) 不应命中，返回 %v", host, ip)
+		}
+	}
+	if ip, entry, ok := h.Lookup("cdn.example.com"); !ok || entry != "*.example.com" || ip.String() != "10.0.0.2" {
+		t.Errorf("cdn.example.com 应命中 *.example.com，返回 %v %q", ip, entry)
+	}
+
+	var empty *Hosts
+	if _, _, ok := empty.Lookup("api.example.com"); ok || empty.Len() != 0 {
+		t.Error("nil 覆盖表不应命中")
+	}
+}
+
+func TestParseHostsErrors(t *testing.T) {
+	for _, text := range []string{
+		"10.0.0.1",                 // 缺少域名
+		"not-an-ip example.com",    // IP 格式错误
+		"10.0.0.1 *.",              // 通配符缺少后缀
+		"10.0.0.1 *.*.example.com", // 多个通配符
+		"10.0.0.1 a*b.example.com", // 通配符不在开头
+		"10.0.0.1 xn--a.example",   // 无效的 punycode 标签
+		"10.0.0.1 *.xn--a.example",
+	} {
+		if _, err := ParseHosts(text); err == nil {
+			t.Errorf("ParseHosts(%q) 应返回错误", text)
+		}
+	}
+}
+
+func TestLoadHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("10.0.0.1 staging.example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := LoadHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip, _, ok := h.Lookup("staging.example.com"); !ok || ip.String() != "10.0.0.1" {
+		t.Fatalf("Lookup 返回 %v %v", ip, ok)
+	}
+	if _, err := LoadHosts(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile 国际化域名转换：按查询规则映射（大小写、全角等）并校验标签与长度（不允许空标签），转换为 punycode
+// 不要求严格的主机名字符集，规则与实际流量中的下划线（如 _dmarc）仍然允许
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+	idna.VerifyDNSLength(true),
+)
+
+// CanonicalDomain 规范化规则或查询的主机：去掉首尾空白、末尾的点与 IPv6 方括号，转为小写，
+// 国际化域名转换为 punycode（bücher.example → xn--bcher-kva.example），规则与查询无论写成哪种形式都能互相匹配
+// IP 字面量原样返回（小写）；标签无效（如格式错误的 xn-- 标签）时返回错误
+func CanonicalDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if len(domain) >= 2 && domain[0] == '[' && domain[len(domain)-1] == ']' {
+		domain = domain[1 : len(domain)-1]
+	}
+	if domain == "" {
+		return "", fmt.Errorf("域名为空")
+	}
+	if net.ParseIP(domain) != nil {
+		return strings.ToLower(domain), nil
+	}
+	ascii, err := idnaProfile.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("域名无效 %q: %v", domain, err)
+	}
+	return ascii, nil
+}
+
+// canonicalLookup 查询时的规范化：纯 ASCII 的主机只需转为小写（punycode 标签与规则中转换后的形式一致），
+// 含非 ASCII 字符时转换为 punycode；转换失败时退回小写形式（不会命中任何规则）
+func canonicalLookup(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= 0x80 {
+			if ascii, err := CanonicalDomain(domain); err == nil {
+				return ascii
+			}
+			break
+		}
+	}
+	return strings.ToLower(domain)
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalDomain(t *testing.T) {
+	for in, want := range map[string]string{
+		"bücher.example":         "xn--bcher-kva.example",
+		"BÜCHER.Example.":        "xn--bcher-kva.example",
+		"xn--bcher-kva.example":  "xn--bcher-kva.example",
+		"XN--BCHER-KVA.EXAMPLE.": "xn--bcher-kva.example",
+		" WWW.Google.COM. ":      "www.google.com",
+		"例え.テスト":                 "xn--r8jz45g.xn--zckzah",
+		"ｅｘａｍｐｌｅ．com":            "example.com", // 全角字符按查询规则映射
+		"_dmarc.example.com":     "_dmarc.example.com",
+		"[2001:DB8::1]":          "2001:db8::1",
+		"10.0.0.1":               "10.0.0.1",
+	} {
+		if got, err := CanonicalDomain(in); err != nil || got != want {
+			t.Errorf("CanonicalDomain(%q) = %q, %v，期望 %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", " . ", "xn--a.example", "a..example", strings.Repeat("a", 64) + ".example"} {
+		if got, err := CanonicalDomain(in); err == nil {
+			t.Errorf("CanonicalDomain(%q) = %q，期望错误", in, got)
+		}
+	}
+}
+
+func TestIDNRules(t *testing.T) {
+	// 规则写成 unicode，查询为 punycode；反之亦然
+	unicode := NewRouter()
+	unicode.LoadRulesFromString("bücher.example\n")
+	punycode := NewRouter()
+	punycode.LoadRulesFromString("xn--bcher-kva.example\n")
+
+	for _, r := range []*Router{unicode, punycode} {
+		for _, host := range []string{
+			"bücher.example",
+			"www.bücher.example",
+			"xn--bcher-kva.example",
+			"shop.xn--bcher-kva.example",
+			// 浏览器流量中常见的大写与末尾的点
+			"WWW.BÜCHER.EXAMPLE.",
+			"Shop.XN--BCHER-KVA.Example.",
+		} {
+			if !r.ShouldProxy(host) {
+				t.Errorf("%q 未命中规则", host)
+			}
+		}
+		for _, host := range []string{"bucher.example", "xn--bcher-kva.example.com", "xn--a.example"} {
+			if r.ShouldProxy(host) {
+				t.Errorf("%q 误命中规则", host)
+			}
+		}
+		if rule, ok := r.Match("www.bücher.example"); !ok || rule != "xn--bcher-kva.example" {
+			t.Errorf("Match = %q, %v", rule, ok)
+		}
+	}
+}
+
+func TestIDNRulesInvalidLabel(t *testing.T) {
+	// 加载时拒绝无效的标签，诊断带行号，其他规则照常加载
+	r := NewRouter()
+	report := r.LoadRulesFromStringReport("bücher.example\nxn--a.example\n\nexample.com\n", LoadStrict)
+	if report.Loaded != 2 || report.Skipped != 1 || len(report.Warnings) != 1 || report.Warnings[0].Line != 2 || report.Warnings[0].Kind != WarnInvalid {
+		t.Fatalf("加载报告 %+v", report)
+	}
+
+	file := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(file, []byte("example.com\nxn--a.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := r.LoadRulesReport(file, LoadStrict); err != nil || report.Skipped != 1 || report.Warnings[0].Line != 2 {
+		t.Fatalf("规则文件的加载报告 %+v: %v", report, err)
+	}
+
+	// 远程规则列表整体替换：任一行无效时拒绝整个列表，错误中带行号
+	if _, err := r.ReplaceRules([]byte("example.com\n\nxn--a.example\n")); err == nil || !strings.Contains(err.Error(), "第 3 行") {
+		t.Fatalf("无效的远程规则列表: %v", err)
+	}
+}
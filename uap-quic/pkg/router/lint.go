@@ -0,0 +1,216 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadMode 规则解析模式（每次加载时选择）
+type LoadMode int
+
+const (
+	// LoadLenient 宽松模式（兼容旧版本）：只跳过无法解析的行，其余原样加入（带端口、路径的规则不会命中任何目标）
+	LoadLenient LoadMode = iota
+	// LoadStrict 严格模式：纠正常见的书写错误（http:// 前缀、路径、端口、*. 通配前缀），纠正后仍不像域名 / IP 的行跳过
+	LoadStrict
+)
+
+// 规则诊断的类别
+const (
+	WarnInvalid   = "invalid"   // 无法解析，已跳过
+	WarnFixed     = "fixed"     // 纠正后加载（严格模式）
+	WarnDuplicate = "duplicate" // 与之前的行是同一条规则
+	WarnShadowed  = "shadowed"  // 被更短的后缀规则覆盖，永远不会命中
+)
+
+// LoadReport 规则加载报告
+type LoadReport struct {
+	Loaded   int           `json:"loaded"`  // 加载的规则数（重复的规则只计一次）
+	Skipped  int           `json:"skipped"` // 跳过的行数
+	Warnings []RuleWarning `json:"warnings,omitempty"`
+}
+
+// RuleWarning 单行规则的诊断
+type RuleWarning struct {
+	Line    int    `json:"line"` // 行号（从 1 开始）
+	Kind    string `json:"kind"` // 见 Warn* 常量
+	Text    string `json:"text"` // 该行原文（去掉首尾空白）
+	Message string `json:"message"`
+}
+
+// String 单行诊断的可读形式
+func (w RuleWarning) String() string {
+	return fmt.Sprintf("第 %d 行 [%s] %s: %.80q", w.Line, w.Kind, w.Message, w.Text)
+}
+
+// LoadRulesReport 按 mode 从文件加载规则并返回逐行诊断（文件不存在时返回空报告，与 LoadRules 一致）
+func (r *Router) LoadRulesReport(filename string, mode LoadMode) (LoadReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return LoadReport{}, nil
+		}
+		return LoadReport{}, fmt.Errorf("打开规则文件失败: %v", err)
+	}
+	defer file.Close()
+
+	report, err := r.loadRules(file, mode)
+	if err != nil {
+		return report, fmt.Errorf("读取规则文件失败: %v", err)
+	}
+	return report, nil
+}
+
+// LoadRulesFromStringReport 按 mode 从字符串加载规则（格式与规则文件相同）并返回逐行诊断
+func (r *Router) LoadRulesFromStringReport(rules string, mode LoadMode) LoadReport {
+	report, _ := r.loadRules(strings.NewReader(rules), mode)
+	return report
+}
+
+// loadRules 按行读取规则并插入当前的树中，返回加载报告（不打日志，由调用方决定如何展示）
+func (r *Router) loadRules(rd io.Reader, mode LoadMode) (LoadReport, error) {
+	var report LoadReport
+	warn := func(line int, kind, text, format string, args ...any) {
+		report.Warnings = append(report.Warnings, RuleWarning{Line: line, Kind: kind, Text: text, Message: fmt.Sprintf(format, args...)})
+	}
+
+	type seenRule struct {
+		line int    // 首次出现的行号
+		text string // 首次出现的原文
+		tag  string // 最后一次出现时的标签（生效的标签）
+	}
+	seen := make(map[string]seenRule)
+	var order []string // 本次加载的规则（按首次出现的顺序），用于检查覆盖
+
+	root := r.root.Load()
+	scanner := bufio.NewScanner(rd)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// 跳过空行和注释行
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		text := line
+		if mode == LoadStrict {
+			fixed, notes, err := fixRuleLine(line)
+			if err != nil {
+				report.Skipped++
+				warn(lineNum, WarnInvalid, line, "%v", err)
+				continue
+			}
+			if len(notes) > 0 {
+				warn(lineNum, WarnFixed, line, "按 %q 加载（%s）", fixed, strings.Join(notes, "，"))
+			}
+			text = fixed
+		}
+
+		// 格式错误的行跳过，不影响其他规则
+		domain, tag, err := ParseRule(text)
+		if err == nil && mode == LoadStrict && !validRule(domain) {
+			err = fmt.Errorf("含有域名或 IP 中不会出现的字符")
+		}
+		if err != nil {
+			report.Skipped++
+			warn(lineNum, WarnInvalid, line, "%v", err)
+			continue
+		}
+
+		if prev, ok := seen[domain]; ok {
+			if prev.tag != tag {
+				warn(lineNum, WarnDuplicate, line, "与第 %d 行是同一条规则，标签以本行为准", prev.line)
+			} else {
+				warn(lineNum, WarnDuplicate, line, "与第 %d 行重复", prev.line)
+			}
+			prev.tag = tag
+			seen[domain] = prev
+		} else {
+			seen[domain] = seenRule{line: lineNum, text: line, tag: tag}
+			order = append(order, domain)
+			report.Loaded++
+		}
+		addRule(root, domain, tag)
+	}
+
+	// 被更短的后缀规则覆盖的规则：查询时先匹配到后缀规则（如 a.example.com 被 example.com 覆盖，其标签也不会生效）
+	for _, domain := range order {
+		if net.ParseIP(domain) != nil {
+			continue
+		}
+		for suffix := domain; ; {
+			_, rest, ok := strings.Cut(suffix, ".")
+			if !ok {
+				break
+			}
+			suffix = rest
+			if by, ok := seen[suffix]; ok {
+				warn(seen[domain].line, WarnShadowed, seen[domain].text, "已被第 %d 行的 %s 覆盖，永远不会命中", by.line, suffix)
+				break
+			}
+		}
+	}
+	sort.SliceStable(report.Warnings, func(i, j int) bool { return report.Warnings[i].Line < report.Warnings[j].Line })
+	return report, scanner.Err()
+}
+
+// fixRuleLine 纠正规则行中域名部分的常见错误：URL 的协议前缀、路径 / 查询参数、用户信息、端口、*. 或 . 通配前缀，
+// 返回纠正后的行与纠正说明；域名中含空白（如行尾注释）时返回错误
+func fixRuleLine(line string) (string, []string, error) {
+	fields := strings.Split(line, ",")
+	idx := 0
+	if len(fields) > 1 && strings.EqualFold(strings.TrimSpace(fields[0]), "PROXY") {
+		idx = 1
+	}
+	host := strings.TrimSpace(fields[idx])
+	if strings.ContainsAny(host, " \t") {
+		return "", nil, fmt.Errorf("域名中含有空白（注释需要单独一行，以 # 开头）")
+	}
+
+	var notes []string
+	if scheme, rest, ok := strings.Cut(host, "://"); ok {
+		notes = append(notes, "去掉协议前缀 "+scheme+"://")
+		host = rest
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		notes = append(notes, "去掉路径 "+host[i:])
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		notes = append(notes, "去掉用户信息")
+		host = host[i+1:]
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil && isDigits(port) {
+		notes = append(notes, "去掉端口 :"+port+"，规则匹配所有端口")
+		host = h
+	}
+	if trimmed := strings.TrimLeft(strings.TrimPrefix(host, "*"), "."); trimmed != host {
+		notes = append(notes, "去掉通配前缀，规则本身已包含所有子域名")
+		host = trimmed
+	}
+	if len(notes) == 0 {
+		return line, nil, nil
+	}
+	fields[idx] = host
+	return strings.Join(fields, ","), notes, nil
+}
+
+// isDigits s 是否为非空的纯数字
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRemoteRulesSize 远程规则列表的大小上限
+const maxRemoteRulesSize = 8 << 20
+
+// remoteRulesTimeout 下载远程规则列表的超时时间
+const remoteRulesTimeout = 30 * time.Second
+
+// ReplaceRules 解析规则列表（格式与规则文件相同），校验通过后整体替换当前规则，返回规则数（重复的规则只计一次）
+// 任意一行不像域名 / IP（例如下载到了登录页 HTML）或没有任何规则时返回错误，当前规则保持不变；
+// 替换后规则命中次数从零开始统计
+func (r *Router) ReplaceRules(data []byte) (int, error) {
+	root := newTrieRoot()
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// 跳过空行和注释行
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain, tag, err := ParseRule(line)
+		if err != nil || !validRule(domain) {
+			return 0, fmt.Errorf("第 %d 行不是有效的规则: %.40q", lineNum, line)
+		}
+		addRule(root, domain, tag)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("读取规则列表失败: %v", err)
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("规则列表为空")
+	}
+
+	r.root.Store(root)
+	return int(root.rules.Load()), nil
+}
+
+// validRule 规则是否只包含域名 / IP 字面量可能出现的字符
+func validRule(rule string) bool {
+	for i := 0; i < len(rule); i++ {
+		c := rule[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_', c == ':', c == '[', c == ']':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckRulesURL 校验远程规则列表地址：必须使用 HTTPS（本机地址允许 HTTP，便于调试）
+func CheckRulesURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("规则列表地址无效: %v", err)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("规则列表地址必须使用 https: %s", rawURL)
+}
+
+// LoadRulesFromURL 下载远程规则列表，校验通过后整体替换当前规则（见 FetchRules / ReplaceRules）
+// 返回下载的原始内容（调用方可缓存为上次可用的列表）与规则数；失败时当前规则保持不变
+func (r *Router) LoadRulesFromURL(ctx context.Context, rawURL string) ([]byte, int, error) {
+	data, err := FetchRules(ctx, rawURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := r.ReplaceRules(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, count, nil
+}
+
+// FetchRules 下载远程规则列表（只下载，不解析；地址要求见 CheckRulesURL）
+func FetchRules(ctx context.Context, rawURL string) ([]byte, error) {
+	if err := CheckRulesURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remoteRulesTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载规则列表失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载规则列表失败: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteRulesSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("下载规则列表失败: %w", err)
+	}
+	if len(data) > maxRemoteRulesSize {
+		return nil, fmt.Errorf("规则列表超过 %d MB", maxRemoteRulesSize>>20)
+	}
+	return data, nil
+}
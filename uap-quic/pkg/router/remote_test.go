@@ -0,0 +1,95 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplaceRules(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\n")
+	r.ShouldProxy("www.google.com")
+
+	n, err := r.ReplaceRules([]byte("# 远程列表\nexample.com\nexample.org,tag=bulk\nexample.com\n"))
+	if err != nil || n != 2 {
+		t.Fatalf("ReplaceRules = %d, %v", n, err)
+	}
+	// 整体替换：旧规则失效，命中次数从零开始
+	if r.ShouldProxy("www.google.com") || !r.ShouldProxy("a.example.org") || r.Tag("a.example.org") != TagBulk {
+		t.Fatal("替换后的规则不符")
+	}
+	if hits := r.TopRules(0); len(hits) != 1 || hits[0].Rule != "example.org" {
+		t.Fatalf("替换后的命中统计 %+v", hits)
+	}
+
+	// 任意一行无效或列表为空时保持当前规则
+	version := r.Version()
+	for _, bad := range []string{
+		"<html><body>login</body></html>\n",
+		"example.com\nnot a domain\n",
+		"# 只有注释\n\n",
+		"",
+	} {
+		if _, err := r.ReplaceRules([]byte(bad)); err == nil {
+			t.Errorf("列表 %q 应返回错误", bad)
+		}
+	}
+	if r.Version() != version || !r.ShouldProxy("example.com") {
+		t.Fatal("无效列表改变了当前规则")
+	}
+}
+
+func TestCheckRulesURL(t *testing.T) {
+	for _, ok := range []string{"https://rules.example.com/list.txt", "http://127.0.0.1:8080/rules", "http://localhost/rules", "http://[::1]/rules"} {
+		if err := CheckRulesURL(ok); err != nil {
+			t.Errorf("CheckRulesURL(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"http://rules.example.com/list.txt", "ftp://127.0.0.1/rules", "rules.txt", "://bad"} {
+		if err := CheckRulesURL(bad); err == nil {
+			t.Errorf("CheckRulesURL(%q) 应返回错误", bad)
+		}
+	}
+}
+
+func TestLoadRulesFromURL(t *testing.T) {
+	body := "example.com\n"
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\n")
+	data, n, err := r.LoadRulesFromURL(context.Background(), srv.URL)
+	if err != nil || n != 1 || string(data) != body || !r.ShouldProxy("example.com") || r.ShouldProxy("google.com") {
+		t.Fatalf("LoadRulesFromURL = %q, %d, %v", data, n, err)
+	}
+
+	// 下载失败、内容无效或超过大小上限时返回错误，当前规则保持不变
+	for _, tc := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusNotFound, "example.net\n"},
+		{http.StatusOK, "<!DOCTYPE html>\n"},
+		{http.StatusOK, strings.Repeat("a.example.net\n", maxRemoteRulesSize/len("a.example.net\n")+1)},
+	} {
+		status, body = tc.status, tc.body
+		if _, _, err := r.LoadRulesFromURL(context.Background(), srv.URL); err == nil {
+			t.Errorf("HTTP %d 内容 %.20q 应返回错误", tc.status, tc.body)
+		}
+		if !r.ShouldProxy("example.com") || r.ShouldProxy("a.example.net") {
+			t.Fatal("失败的下载改变了当前规则")
+		}
+	}
+
+	if _, _, err := r.LoadRulesFromURL(context.Background(), "http://rules.example.com/"); err == nil {
+		t.Fatal("非本机的 http 地址被接受")
+	}
+}
@@ -1,36 +1,68 @@
 package router
 
 import (
-	"bufio"
-	"fmt"
-	"os"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 // Router 域名后缀树路由器
+// 整棵树可以原子替换（见 ReplaceRules），查询时先取出当前的根节点，不会看到替换到一半的规则
 type Router struct {
-	root *TrieNode
+	root atomic.Pointer[TrieNode]
 }
 
 // TrieNode 后缀树节点
 type TrieNode struct {
 	children map[string]*TrieNode // 子节点映射（域名部分 -> 节点）
 	isEnd    bool                 // 是否为规则终点
+	rule     string               // 规则原文（仅规则终点有值，用于统计输出）
+	tag      string               // 流量类型标签（见 TagBulk / TagGame，仅规则终点有值，可为空）
+	hits     atomic.Uint64        // 命中次数（仅规则终点计数）
+
+	// 以下字段只在树根上使用，随整棵树一起原子替换
+	rules   atomic.Int64           // 规则数（插入新的规则终点时加一）
+	version atomic.Pointer[string] // 规则版本（插入规则后清空，见 Version）
+}
+
+// RuleHit 规则命中统计
+type RuleHit struct {
+	Rule string `json:"rule"`
+	Tag  string `json:"tag,omitempty"`
+	Hits uint64 `json:"hits"`
 }
 
 // NewRouter 创建新的路由器
 func NewRouter() *Router {
-	return &Router{
-		root: &TrieNode{
-			children: make(map[string]*TrieNode),
-			isEnd:    false,
-		},
+	r := &Router{}
+	r.root.Store(newTrieRoot())
+	return r
+}
+
+// ReplaceWith 用 src 当前的整棵树整体替换本路由器的规则（先在 src 中加载好，查询不会看到加载到一半的规则）
+func (r *Router) ReplaceWith(src *Router) {
+	r.root.Store(src.root.Load())
+}
+
+// newTrieRoot 创建空的树根
+func newTrieRoot() *TrieNode {
+	return &TrieNode{
+		children: make(map[string]*TrieNode),
+		isEnd:    false,
 	}
 }
 
 // AddRule 将域名倒序插入树中
 // 例如：google.com -> com -> google (isEnd=true)
 func (r *Router) AddRule(domain string) {
+	addRule(r.root.Load(), domain, "")
+}
+
+// addRule 将域名倒序插入以 root 为根的树中，tag 为规则的流量类型标签（可为空）
+func addRule(root *TrieNode, domain, tag string) {
 	domain = strings.TrimSpace(domain)
 	if domain == "" {
 		return
@@ -43,7 +75,7 @@ func (r *Router) AddRule(domain string) {
 	}
 
 	// 倒序插入（从 TLD 开始）
-	current := r.root
+	current := root
 	for i := len(parts) - 1; i >= 0; i-- {
 		part := parts[i]
 		if part == "" {
@@ -61,26 +93,47 @@ func (r *Router) AddRule(domain string) {
 		current = current.children[part]
 	}
 
-	// 标记为规则终点
+	// 标记为规则终点（同一条规则重复插入时只更新标签，不重复计数）
+	if !current.isEnd {
+		root.rules.Add(1)
+	}
+	root.version.Store(nil)
 	current.isEnd = true
+	current.rule = strings.Join(parts, ".")
+	current.tag = tag
 }
 
-// ShouldProxy 将域名倒序在树中查找，如果匹配到节点是 isEnd，则返回 true
+// ShouldProxy 将域名倒序在树中查找，如果匹配到节点是 isEnd，则返回 true（计入规则命中次数）
 // 例如：www.google.com -> 查找 com -> google，如果 google 节点 isEnd=true，返回 true
 func (r *Router) ShouldProxy(domain string) bool {
+	_, ok := r.ProxyTag(domain)
+	return ok
+}
+
+// Match 查找域名命中的规则（规则原文），不计入命中次数（用于分流诊断）
+func (r *Router) Match(domain string) (string, bool) {
+	node := r.lookup(domain)
+	if node == nil {
+		return "", false
+	}
+	return node.rule, true
+}
+
+// lookup 将域名倒序在树中查找，返回最先匹配到的规则终点（未命中返回 nil）
+func (r *Router) lookup(domain string) *TrieNode {
 	domain = strings.TrimSpace(domain)
 	if domain == "" {
-		return false
+		return nil
 	}
 
 	// 转换为小写并分割域名部分
 	parts := splitDomain(domain)
 	if len(parts) == 0 {
-		return false
+		return nil
 	}
 
 	// 倒序查找（从 TLD 开始）
-	current := r.root
+	current := r.root.Load()
 	for i := len(parts) - 1; i >= 0; i-- {
 		part := parts[i]
 		if part == "" {
@@ -89,33 +142,38 @@ func (r *Router) ShouldProxy(domain string) bool {
 
 		// 如果当前节点是规则终点，匹配成功
 		if current.isEnd {
-			return true
+			return current
 		}
 
 		// 查找子节点
 		child := current.children[part]
 		if child == nil {
 			// 没有匹配的子节点，查找失败
-			return false
+			return nil
 		}
 
 		current = child
 	}
 
 	// 检查最后一个节点是否为规则终点
-	return current.isEnd
+	if current.isEnd {
+		return current
+	}
+	return nil
 }
 
-// splitDomain 分割域名为部分
+// splitDomain 分割域名为部分（先规范化：小写、移除末尾的点，国际化域名转换为 punycode，见 canonicalLookup）
 // 例如：www.google.com -> ["www", "google", "com"]
 func splitDomain(domain string) []string {
-	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = canonicalLookup(domain)
 	if domain == "" {
 		return nil
 	}
 
-	// 移除末尾的点
-	domain = strings.TrimSuffix(domain, ".")
+	// IPv6 字面量去掉方括号（按不带方括号的地址匹配）
+	if len(domain) >= 2 && domain[0] == '[' && domain[len(domain)-1] == ']' {
+		domain = domain[1 : len(domain)-1]
+	}
 
 	var parts []string
 	start := 0
@@ -134,61 +192,103 @@ func splitDomain(domain string) []string {
 	return parts
 }
 
-// LoadRules 从文件加载规则
+// LoadRules 从文件加载规则（宽松模式，见 LoadMode）
 // 按行读取 whitelist.txt 并插入树中
 func (r *Router) LoadRules(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		// 如果文件不存在，不报错（允许可选的白名单文件）
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("打开规则文件失败: %v", err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		
-		// 跳过空行和注释行
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+	report, err := r.LoadRulesReport(filename, LoadLenient)
+	logSkipped(report, "规则文件")
+	return err
+}
+
+// LoadRulesFromString 从字符串加载规则（格式与规则文件相同，换行分隔，宽松模式），返回加载的规则数
+// 供没有可用文件路径的场景（如移动端 SDK 直接传入规则文本）使用，格式错误的行同样跳过
+func (r *Router) LoadRulesFromString(rules string) int {
+	report := r.LoadRulesFromStringReport(rules, LoadLenient)
+	logSkipped(report, "规则")
+	return report.Loaded
+}
 
-		// 添加规则
-		r.AddRule(line)
+// logSkipped 打印跳过的行（宽松模式只提示无法解析的行）；label 为日志中的规则来源
+func logSkipped(report LoadReport, label string) {
+	for _, w := range report.Warnings {
+		if w.Kind == WarnInvalid {
+			log.Printf("⚠️ %s第 %d 行已跳过: %s", label, w.Line, w.Message)
+		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取规则文件失败: %v", err)
+// GetRuleCount 获取规则数量（插入时计数，不遍历树）
+func (r *Router) GetRuleCount() int {
+	return int(r.root.Load().rules.Load())
+}
+
+// Version 规则版本："sha256:" 加规范化规则（小写、punycode，带标签时为 "规则,tag=标签"）排序后逐行拼接的摘要前 8 字节
+// 与规则文件中的顺序、注释、空白、重复行和书写方式（如 http:// 前缀被纠正）无关，规则相同的客户端版本相同；
+// 加载后第一次调用时计算，之后直到规则变化前直接返回
+func (r *Router) Version() string {
+	root := r.root.Load()
+	if v := root.version.Load(); v != nil {
+		return *v
+	}
+	var lines []string
+	collectRules(root, &lines)
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
 	}
+	v := "sha256:" + hex.EncodeToString(h.Sum(nil)[:8])
+	root.version.Store(&v)
+	return v
+}
 
-	return nil
+// collectRules 递归收集规则的规范形式（见 Version）
+func collectRules(node *TrieNode, lines *[]string) {
+	if node.isEnd {
+		line := node.rule
+		if node.tag != "" {
+			line += ",tag=" + node.tag
+		}
+		*lines = append(*lines, line)
+	}
+	for _, child := range node.children {
+		collectRules(child, lines)
+	}
 }
 
-// GetRuleCount 获取规则数量（用于调试）
-func (r *Router) GetRuleCount() int {
-	return r.countNodes(r.root)
+// TopRules 返回命中次数最多的前 n 条规则（按命中次数降序，n <= 0 表示全部）
+// 从未命中的规则不会出现在结果中，可用于清理无效规则
+func (r *Router) TopRules(n int) []RuleHit {
+	var result []RuleHit
+	r.collectHits(r.root.Load(), &result)
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Hits != result[j].Hits {
+			return result[i].Hits > result[j].Hits
+		}
+		return result[i].Rule < result[j].Rule
+	})
+
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
 }
 
-// countNodes 递归计算节点数量
-func (r *Router) countNodes(node *TrieNode) int {
+// collectHits 递归收集已命中的规则
+func (r *Router) collectHits(node *TrieNode, result *[]RuleHit) {
 	if node == nil {
-		return 0
+		return
 	}
 
-	count := 0
 	if node.isEnd {
-		count = 1
+		if hits := node.hits.Load(); hits > 0 {
+			*result = append(*result, RuleHit{Rule: node.rule, Tag: node.tag, Hits: hits})
+		}
 	}
 
 	for _, child := range node.children {
-		count += r.countNodes(child)
+		r.collectHits(child, result)
 	}
-
-	return count
 }
-
@@ -0,0 +1,179 @@
+package router
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShouldProxySuffixMatch(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\nexample.org\n")
+
+	for domain, want := range map[string]bool{
+		"google.com":       true,
+		"www.google.com":   true,
+		"a.b.google.com":   true,
+		"WWW.Google.COM.":  true,
+		"notgoogle.com":    false,
+		"google.com.evil":  false,
+		"com":              false,
+		"example.org":      true,
+		"mail.example.org": true,
+		"example.com":      false,
+		"":                 false,
+		"   ":              false,
+		"sub.example.org.": true,
+	} {
+		if got := r.ShouldProxy(domain); got != want {
+			t.Errorf("ShouldProxy(%q) = %v，期望 %v", domain, got, want)
+		}
+	}
+}
+
+func TestTopRules(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\nyoutube.com\ngithub.com\nunused.com\n")
+
+	for i := 0; i < 3; i++ {
+		r.ShouldProxy("www.youtube.com")
+	}
+	r.ShouldProxy("google.com")
+	r.ShouldProxy("mail.google.com")
+	r.ShouldProxy("github.com")
+	r.ShouldProxy("example.com") // 未命中
+
+	want := []RuleHit{
+		{Rule: "youtube.com", Hits: 3},
+		{Rule: "google.com", Hits: 2},
+		{Rule: "github.com", Hits: 1},
+	}
+	if got := r.TopRules(0); !reflect.DeepEqual(got, want) {
+		t.Fatalf("TopRules(0) = %+v，期望 %+v", got, want)
+	}
+	if got := r.TopRules(2); !reflect.DeepEqual(got, want[:2]) {
+		t.Fatalf("TopRules(2) = %+v，期望 %+v", got, want[:2])
+	}
+}
+
+func TestMatchDoesNotCountHits(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\n")
+
+	if rule, ok := r.Match("www.google.com"); !ok || rule != "google.com" {
+		t.Fatalf("Match = %q, %v", rule, ok)
+	}
+	r.Tag("www.google.com")
+	if got := r.TopRules(0); len(got) != 0 {
+		t.Fatalf("Match / Tag 不应计入命中次数: %+v", got)
+	}
+}
+
+func TestTopRulesTieOrder(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("b.com\na.com\n")
+	r.ShouldProxy("b.com")
+	r.ShouldProxy("a.com")
+
+	got := r.TopRules(0)
+	if len(got) != 2 || got[0].Rule != "a.com" || got[1].Rule != "b.com" {
+		t.Fatalf("命中次数相同时应按规则排序: %+v", got)
+	}
+}
+
+func TestShouldProxyIPv6Literal(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("2001:db8::1\n[2001:db8::2]\n")
+
+	// IPv6 字面量按不带方括号的地址匹配（规则与查询都去掉方括号）
+	for domain, want := range map[string]bool{
+		"2001:db8::1":   true,
+		"[2001:db8::1]": true,
+		"2001:db8::2":   true,
+		"[2001:db8::2]": true,
+		"2001:db8::3":   false,
+	} {
+		if got := r.ShouldProxy(domain); got != want {
+			t.Errorf("ShouldProxy(%q) = %v，期望 %v", domain, got, want)
+		}
+	}
+}
+
+func TestReplaceWith(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\n")
+	src := NewRouter()
+	src.LoadRulesFromString("example.com\nexample.org\n")
+
+	r.ReplaceWith(src)
+	if r.ShouldProxy("www.google.com") || !r.ShouldProxy("www.example.com") || r.GetRuleCount() != 2 || r.Version() != src.Version() {
+		t.Fatalf("替换后规则 %d 条，版本 %s", r.GetRuleCount(), r.Version())
+	}
+}
+
+// TestRuleCount 规则数在插入时计数：重复规则不重复计数，替换规则时随树一起替换
+func TestRuleCount(t *testing.T) {
+	r := NewRouter()
+	if r.GetRuleCount() != 0 {
+		t.Fatalf("空路由器规则数 %d", r.GetRuleCount())
+	}
+	r.LoadRulesFromString("google.com\nwww.google.com\nGoogle.com\nexample.org,tag=bulk\nexample.org\n")
+	if n := r.GetRuleCount(); n != 3 {
+		t.Fatalf("规则数 %d，期望 3", n)
+	}
+	r.AddRule("github.com")
+	r.AddRule("github.com")
+	if n := r.GetRuleCount(); n != 4 {
+		t.Fatalf("AddRule 后规则数 %d，期望 4", n)
+	}
+	if _, err := r.ReplaceRules([]byte("example.com\n")); err != nil || r.GetRuleCount() != 1 {
+		t.Fatalf("替换后规则数 %d: %v", r.GetRuleCount(), err)
+	}
+}
+
+// TestRulesVersion 版本只取决于规范化后的规则与标签，与顺序、注释、重复行和书写方式无关
+func TestRulesVersion(t *testing.T) {
+	version := func(rules string) string {
+		r := NewRouter()
+		r.LoadRulesFromStringReport(rules, LoadStrict)
+		return r.Version()
+	}
+	base := version("google.com\nnetflix.com,tag=bulk\n")
+	if !strings.HasPrefix(base, "sha256:") || len(base) != len("sha256:")+16 {
+		t.Fatalf("版本格式 %q", base)
+	}
+	for _, same := range []string{
+		"netflix.com,tag=bulk\ngoogle.com\n",
+		"# 注释\n\n  GOOGLE.com  \nhttps://netflix.com/,tag=bulk\ngoogle.com\n",
+	} {
+		if v := version(same); v != base {
+			t.Errorf("%q 的版本 %s，期望 %s", same, v, base)
+		}
+	}
+	for _, other := range []string{
+		"google.com\nnetflix.com\n",
+		"google.com\nnetflix.com,tag=game\n",
+		"google.com\n",
+		"",
+	} {
+		if v := version(other); v == base {
+			t.Errorf("%q 与基准规则版本相同", other)
+		}
+	}
+
+	// 版本缓存到规则变化为止
+	r := NewRouter()
+	r.LoadRulesFromString("google.com\n")
+	v := r.Version()
+	if r.Version() != v {
+		t.Fatal("规则未变化时版本改变")
+	}
+	r.AddRule("example.com")
+	if r.Version() == v {
+		t.Fatal("插入规则后版本未更新")
+	}
+	r.ReplaceRules([]byte("google.com\n"))
+	if r.Version() != v {
+		t.Fatal("替换回相同规则后版本不同")
+	}
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 流量类型标签：规则可以给命中的域名打标签，客户端随转发请求告知服务端，由服务端按类型应用策略
+const (
+	TagBulk = "bulk" // 大流量（下载、视频等），服务端可统一限速
+	TagGame = "game" // 游戏 / 实时流量，服务端按低时延策略处理（如 DSCP 标记）
+)
+
+// ParseRule 解析一行规则："域名[,tag=标签]"，可带前缀 "PROXY,"（如 PROXY,netflix.com,tag=bulk）
+// 返回规范化后的域名（见 CanonicalDomain）；标签只能是 TagBulk / TagGame，不带标签时 tag 为空
+func ParseRule(line string) (domain, tag string, err error) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) > 1 && strings.EqualFold(strings.TrimSpace(fields[0]), "PROXY") {
+		fields = fields[1:]
+	}
+	if strings.TrimSpace(fields[0]) == "" {
+		return "", "", fmt.Errorf("规则缺少域名: %q", line)
+	}
+	if domain, err = CanonicalDomain(fields[0]); err != nil {
+		return "", "", err
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "tag") {
+			return "", "", fmt.Errorf("规则选项无效: %q（只支持 tag=%s / tag=%s）", field, TagBulk, TagGame)
+		}
+		if tag != "" {
+			return "", "", fmt.Errorf("规则重复指定标签: %q", line)
+		}
+		tag = strings.ToLower(strings.TrimSpace(value))
+		if tag != TagBulk && tag != TagGame {
+			return "", "", fmt.Errorf("未知的流量类型标签: %q（只支持 %s / %s）", value, TagBulk, TagGame)
+		}
+	}
+	return domain, tag, nil
+}
+
+// ProxyTag 查找域名命中的规则并返回其标签（计入规则命中次数），未命中时第二个返回值为 false
+func (r *Router) ProxyTag(domain string) (string, bool) {
+	_, tag, ok := r.Hit(domain)
+	return tag, ok
+}
+
+// Hit 查找域名命中的规则，返回规则原文与标签（计入规则命中次数），未命中时第三个返回值为 false
+func (r *Router) Hit(domain string) (string, string, bool) {
+	node := r.lookup(domain)
+	if node == nil {
+		return "", "", false
+	}
+	node.hits.Add(1)
+	return node.rule, node.tag, true
+}
+
+// Tag 域名命中的规则的标签，未命中或规则没有标签时为空（不计入命中次数）
+func (r *Router) Tag(domain string) string {
+	if node := r.lookup(domain); node != nil {
+		return node.tag
+	}
+	return ""
+}
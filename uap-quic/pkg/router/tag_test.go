@@ -0,0 +1,92 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, tc := range []struct {
+		line, domain, tag string
+	}{
+		{"netflix.com", "netflix.com", ""},
+		{"PROXY,netflix.com,tag=bulk", "netflix.com", TagBulk},
+		{"proxy, Netflix.COM , TAG = Bulk ", "netflix.com", TagBulk},
+		{"steam.com,tag=game", "steam.com", TagGame},
+		{"PROXY,example.org", "example.org", ""},
+	} {
+		domain, tag, err := ParseRule(tc.line)
+		if err != nil || domain != tc.domain || tag != tc.tag {
+			t.Errorf("ParseRule(%q) = %q, %q, %v，期望 %q, %q", tc.line, domain, tag, err, tc.domain, tc.tag)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		"PROXY,",
+		",tag=bulk",
+		"netflix.com,tag=video",         // 未知标签
+		"netflix.com,bulk",              // 缺少 tag=
+		"netflix.com,prio=1",            // 不支持的选项
+		"netflix.com,tag=bulk,tag=game", // 重复指定标签
+	} {
+		if domain, tag, err := ParseRule(line); err == nil {
+			t.Errorf("ParseRule(%q) = %q, %q，期望错误", line, domain, tag)
+		}
+	}
+}
+
+func TestRuleTags(t *testing.T) {
+	r := NewRouter()
+	r.LoadRulesFromString("PROXY,netflix.com,tag=bulk\nsteam.com,tag=game\ngoogle.com\nbad.com,tag=video\n")
+	if n := r.GetRuleCount(); n != 3 {
+		t.Fatalf("规则数 %d，期望 3（标签无效的行跳过）", n)
+	}
+
+	for domain, want := range map[string]string{
+		"www.netflix.com": TagBulk,
+		"cdn.steam.com":   TagGame,
+		"google.com":      "",
+		"example.com":     "",
+		"bad.com":         "",
+	} {
+		if got := r.Tag(domain); got != want {
+			t.Errorf("Tag(%q) = %q，期望 %q", domain, got, want)
+		}
+	}
+
+	// ProxyTag / Hit 计入命中次数，命中统计带上标签
+	if tag, ok := r.ProxyTag("www.netflix.com"); !ok || tag != TagBulk {
+		t.Fatalf("ProxyTag = %q, %v", tag, ok)
+	}
+	if rule, tag, ok := r.Hit("api.steam.com"); !ok || rule != "steam.com" || tag != TagGame {
+		t.Fatalf("Hit = %q, %q, %v", rule, tag, ok)
+	}
+	if _, ok := r.ProxyTag("example.com"); ok {
+		t.Fatal("未命中规则的域名返回了命中")
+	}
+	want := []RuleHit{{Rule: "netflix.com", Tag: TagBulk, Hits: 1}, {Rule: "steam.com", Tag: TagGame, Hits: 1}}
+	if got := r.TopRules(0); !reflect.DeepEqual(got, want) {
+		t.Fatalf("TopRules = %+v，期望 %+v", got, want)
+	}
+}
+
+func TestRuleTagsStrict(t *testing.T) {
+	r := NewRouter()
+	report := r.LoadRulesFromStringReport("netflix.com,tag=bulk\nnetflix.com,tag=game\nsteam.com,tag=video\n", LoadStrict)
+	if report.Loaded != 1 || report.Skipped != 1 {
+		t.Fatalf("加载报告 %+v", report)
+	}
+	// 同一条规则重复出现时标签以最后一行为准
+	if got := r.Tag("netflix.com"); got != TagGame {
+		t.Fatalf("重复规则的标签 %q，期望 %q", got, TagGame)
+	}
+
+	// 远程规则列表整体替换：标签无效时拒绝整个列表
+	if _, err := r.ReplaceRules([]byte("netflix.com,tag=bulk\nsteam.com,tag=video\n")); err == nil {
+		t.Fatal("标签无效的远程规则列表被接受")
+	}
+	if n, err := r.ReplaceRules([]byte("netflix.com,tag=bulk\n")); err != nil || n != 1 || r.Tag("netflix.com") != TagBulk {
+		t.Fatalf("替换远程规则 %d: %v", n, err)
+	}
+}
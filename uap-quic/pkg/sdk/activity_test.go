@@ -0,0 +1,104 @@
+package sdk
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// activityEvent OnActivity 的 activityJSON
+type activityEvent struct {
+	core.Activity
+	Instance int `json:"instance"`
+}
+
+// expectActivity 等待下一条最近活动
+func (l *eventListener) expectActivity(t *testing.T) activityEvent {
+	t.Helper()
+	select {
+	case data := <-l.activities:
+		var a activityEvent
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			t.Fatalf("activityJSON %q: %v", data, err)
+		}
+		return a
+	case <-time.After(3 * time.Second):
+		t.Fatal("未收到最近活动")
+	}
+	return activityEvent{}
+}
+
+// recentActivity 解码 GetRecentActivityJSON
+func recentActivity(t *testing.T, limit int) []core.Activity {
+	t.Helper()
+	var list []core.Activity
+	if err := json.Unmarshal([]byte(GetRecentActivityJSON(limit)), &list); err != nil {
+		t.Fatalf("最近活动: %v", err)
+	}
+	return list
+}
+
+func TestRecentActivity(t *testing.T) {
+	l := withEventListener(t)
+	t.Cleanup(func() {
+		Stop()
+		SetActivityLog(0, false)
+	})
+	if GetRecentActivityJSON(0) != "" {
+		t.Fatal("未运行时返回了最近活动")
+	}
+
+	// 本机目标：接受后立即关闭
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	target := ln.Addr().(*net.TCPAddr)
+
+	SetActivityLog(4, false)
+	if e := effectiveConfig(t)["activity-log"]; e.Value != float64(4) {
+		t.Fatalf("activity-log %+v", e)
+	}
+	n := startFakeNode(t, "good-token")
+	port := freePort(t)
+	if err := StartWithHost("good-token", n.addr, port, core.ModeGlobal, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	socksConnectVia(t, port, target)
+	if a := l.expectActivity(t); a.Host != "127.0.0.1" || a.Port != target.Port || a.Action != core.RouteDirect || a.Instance != DefaultInstance {
+		t.Fatalf("OnActivity %+v", a)
+	}
+	if list := recentActivity(t, 0); len(list) != 1 || list[0].Port != target.Port {
+		t.Fatalf("GetRecentActivityJSON %+v", list)
+	}
+
+	// 运行中开启隐藏主机
+	SetActivityLog(4, true)
+	socksConnectVia(t, port, target)
+	if a := l.expectActivity(t); a.Host != "" || a.Port != target.Port {
+		t.Fatalf("隐藏主机后的 OnActivity %+v", a)
+	}
+	if list := recentActivity(t, 1); len(list) != 1 || list[0].Host != "" {
+		t.Fatalf("隐藏主机后的 GetRecentActivityJSON %+v", list)
+	}
+
+	// 关闭后清空
+	SetActivityLog(0, false)
+	if list := recentActivity(t, 0); len(list) != 0 {
+		t.Fatalf("关闭后仍有最近活动 %+v", list)
+	}
+}
@@ -0,0 +1,99 @@
+package sdk
+
+import (
+	"log"
+
+	"uap-quic/pkg/config"
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/window"
+)
+
+// GetEffectiveConfigJSON 返回合并后的生效配置（JSON 字符串）：每项的取值与来源，
+// 通过 Set* 设置过（与默认值不同）的项来源为 api，其余为 default；Token、PSK 与钱包私钥只输出指纹
+// 运行中时附带当前节点、Token、本地端口与代理模式；键按名称排序，输出确定，便于用户反馈问题时比对
+// 返回示例: {"program":"uap-sdk","config":{"compress":{"value":false,"source":"default"},"psk":{"value":"sha256:…","source":"api","secret":true},...}}
+func GetEffectiveConfigJSON() string {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	refresh := rulesRefresh
+	if refresh <= 0 {
+		refresh = core.DefaultRulesRefresh
+	}
+	hostCount := 0
+	if hosts != nil {
+		hostCount = hosts.Len()
+	}
+	entries := map[string]config.Entry{
+		"psk":        config.Secret(preSharedKey, source(preSharedKey != "")),
+		"wallet-key": config.Secret(walletKey, source(walletKey != "")),
+
+		"signed-handshake":      value(signedAuth, signedAuth),
+		"kill-switch":           value(killSwitch, killSwitch),
+		"unmatched":             value(orDefault(unmatched, core.UnmatchedDirect), unmatched != ""),
+		"udp-over-stream":       value(udpOverStream, udpOverStream),
+		"compress":              value(compression, compression),
+		"prefer-family":         value(orDefault(preferFamily, core.FamilyAuto), preferFamily != ""),
+		"max-udp-payload":       value(maxUDPPayload, maxUDPPayload != 0),
+		"udp-oversize-fallback": value(udpFallback, udpFallback),
+		"udp-metrics":           value(udpMetrics, udpMetrics),
+		"activity-log":          value(activitySize, activitySize != 0),
+		"activity-hide-hosts":   value(activityHide, activityHide),
+		"flow-windows":          value(flowWindows, flowWindows != window.Default),
+		"warmup":                value(warmup, warmup != nil),
+		"stream-priority":       value(streamPriority, streamPriority != nil),
+		"udp-buffers":           value(udpBuffers, !udpBuffers.IsZero()),
+		"dns":                   value(dnsServer, dnsServer != nil),
+		"connect-timeout":       value(connectTimeout.String(), connectTimeout != core.DefaultConnectTimeout),
+		"idle-timeout":          value(idleTimeout.String(), idleTimeout != core.DefaultIdleTimeout),
+		"listen":                value(gatewayHost, gatewayHost != core.DefaultListenHost),
+		"advertise":             value(gatewayAdvertise, gatewayAdvertise != ""),
+		"select-tolerance":      value(selectTolerance.String(), selectTolerance != core.DefaultSelectTolerance),
+		"sticky-node":           value(stickyNode, stickyNode),
+		"sticky-max-latency":    value(stickyMaxLatency.String(), stickyMaxLatency != defaultStickyMaxLatency),
+		"ping-concurrency":      value(pingConcurrency, pingConcurrency != core.DefaultPingConcurrency),
+		"ping-good-latency":     value(pingGoodLatency.String(), pingGoodLatency != 0),
+		"ping-good-count":       value(pingGoodCount, pingGoodCount != 0),
+		"ping-jitter":           value(pingJitter.String(), pingJitter != 0),
+		"hosts":                 value(hostCount, hosts != nil),
+		"rules-file":            value(rulesFile, rulesFile != defaultRulesFile),
+		"rules-url":             value(rulesURL, rulesURL != ""),
+		"rules-refresh":         value(refresh.String(), rulesRefresh > 0 && rulesRefresh != core.DefaultRulesRefresh),
+		"rules-cache":           value(rulesCache, rulesCache != ""),
+	}
+	if client != nil {
+		snap := client.ConfigSnapshot()
+		entries["server"] = value(snap.ServerAddr, true)
+		entries["token"] = config.Secret(client.Token(), config.SourceAPI)
+		entries["port"] = value(snap.LocalPort, true)
+		entries["mode"] = value(snap.Mode, true)
+	}
+
+	data, err := config.Marshal("uap-sdk", entries)
+	if err != nil {
+		log.Printf("❌ 序列化生效配置失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// value 非敏感的配置项，set 表示通过 Set* 设置过（与默认值不同）
+func value(v interface{}, set bool) config.Entry {
+	return config.Entry{Value: v, Source: source(set)}
+}
+
+// source 配置项的来源：设置过为 api，否则为 default
+func source(set bool) string {
+	if set {
+		return config.SourceAPI
+	}
+	return config.SourceDefault
+}
+
+// orDefault s 为空时取默认值 def
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
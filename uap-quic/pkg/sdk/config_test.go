@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"uap-quic/pkg/config"
+	"uap-quic/pkg/core"
+)
+
+// effectiveConfig 解码 GetEffectiveConfigJSON
+func effectiveConfig(t *testing.T) map[string]config.Entry {
+	t.Helper()
+	var out struct {
+		Program string                  `json:"program"`
+		Config  map[string]config.Entry `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(GetEffectiveConfigJSON()), &out); err != nil || out.Program != "uap-sdk" {
+		t.Fatalf("生效配置 %q: %v", out.Program, err)
+	}
+	return out.Config
+}
+
+func TestGetEffectiveConfigJSON(t *testing.T) {
+	t.Cleanup(func() {
+		Stop()
+		SetPSK("")
+		SetCompression(false)
+		SetConnectTimeout(0)
+	})
+
+	// 未设置时为默认值，敏感值为 Unset
+	cfg := effectiveConfig(t)
+	for _, name := range []string{"compress", "connect-timeout", "unmatched"} {
+		if cfg[name].Source != config.SourceDefault {
+			t.Errorf("%s 的来源 %s，期望 default", name, cfg[name].Source)
+		}
+	}
+	if cfg["psk"].Value != config.Unset || !cfg["psk"].Secret || cfg["unmatched"].Value != core.UnmatchedDirect {
+		t.Fatalf("默认配置 psk=%+v unmatched=%+v", cfg["psk"], cfg["unmatched"])
+	}
+	if _, ok := cfg["server"]; ok {
+		t.Fatal("未运行时输出了当前节点")
+	}
+
+	// Set* 设置过的项来源为 api，敏感值只输出指纹
+	SetPSK("sdk-secret-psk")
+	SetCompression(true)
+	SetConnectTimeout(3000)
+	cfg = effectiveConfig(t)
+	if e := cfg["psk"]; e.Source != config.SourceAPI || e.Value != config.Fingerprint("sdk-secret-psk") {
+		t.Fatalf("psk = %+v", e)
+	}
+	if e := cfg["compress"]; e.Source != config.SourceAPI || e.Value != true {
+		t.Fatalf("compress = %+v", e)
+	}
+	if e := cfg["connect-timeout"]; e.Source != config.SourceAPI || e.Value != "3s" {
+		t.Fatalf("connect-timeout = %+v", e)
+	}
+
+	// 运行中附带当前节点、Token、端口与模式
+	SetPSK("")
+	n := startFakeNode(t, "good-token")
+	port := freePort(t)
+	if err := StartWithHost("good-token", n.addr, port, core.ModeGlobal, ""); err != nil {
+		t.Fatal(err)
+	}
+	out := GetEffectiveConfigJSON()
+	if strings.Contains(out, "good-token") || strings.Contains(out, "sdk-secret-psk") {
+		t.Fatalf("输出包含敏感值原文: %s", out)
+	}
+	cfg = effectiveConfig(t)
+	if cfg["server"].Value != n.addr || cfg["token"].Value != config.Fingerprint("good-token") || cfg["port"].Value != float64(port) || cfg["mode"].Value != core.ModeGlobal {
+		t.Fatalf("运行中的配置 server=%+v token=%+v port=%+v mode=%+v", cfg["server"], cfg["token"], cfg["port"], cfg["mode"])
+	}
+
+	// 输出确定
+	if GetEffectiveConfigJSON() != out {
+		t.Fatal("两次输出不同")
+	}
+}
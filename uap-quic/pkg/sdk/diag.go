@@ -0,0 +1,69 @@
+package sdk
+
+import (
+	"log"
+	"time"
+
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/diag"
+)
+
+// capture 进行中的诊断抓取（由 clientLock 保护），抓取期间新建的客户端同样记录 qlog
+var capture *diag.Capture
+
+// applyCapture 让新建的客户端加入进行中的诊断抓取（调用方持有 clientLock）
+func applyCapture(c *core.Client) {
+	if capture != nil {
+		c.SetQlog(capture.OpenQlog)
+	}
+}
+
+// CreateSupportBundle 生成诊断包（zip）写入 path，用户反馈连接问题时提交给客服
+// 抓取 seconds 秒（<= 0 为 60 秒，最长 600 秒）内的客户端日志与 QUIC qlog，连同配置快照、规则版本、选路结果与统计打包；
+// token、连接票据、PSK、钱包私钥等敏感值在写入前全部脱敏。
+// 阻塞直到抓取结束，请在后台线程调用。VPN 运行中时会先重建一次隧道（进行中的连接会断开），让 qlog 包含握手过程；
+// 未运行时可在抓取期间调用 Start 复现问题
+func CreateSupportBundle(path string, seconds int) error {
+	c, err := diag.Start()
+	if err != nil {
+		return err
+	}
+
+	clientLock.Lock()
+	capture = c
+	running := client
+	if running != nil {
+		running.SetQlog(c.OpenQlog)
+	}
+	clientLock.Unlock()
+
+	if running != nil {
+		if err := running.Reconnect(); err != nil {
+			log.Printf("⚠️ 诊断抓取: 重建隧道失败: %v", err)
+		}
+	}
+	time.Sleep(diag.ClampDuration(time.Duration(seconds) * time.Second))
+
+	clientLock.Lock()
+	capture = nil
+	running = client
+	if running != nil {
+		running.SetQlog(nil)
+	}
+	secrets := []string{preSharedKey, walletKey}
+	clientLock.Unlock()
+	c.Stop()
+
+	files := append(c.Files(), diag.ClientFiles(running)...)
+	if report := selectionReport(running); report != nil {
+		files = append(files, diag.JSONFile("selection.json", report))
+	}
+	if running != nil {
+		secrets = append(secrets, running.Secrets()...)
+	}
+	if err := diag.Write(path, files, secrets); err != nil {
+		return err
+	}
+	log.Printf("📦 诊断包已保存: %s", path)
+	return nil
+}
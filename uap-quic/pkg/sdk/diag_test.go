@@ -0,0 +1,61 @@
+package sdk
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateSupportBundle(t *testing.T) {
+	const token = "support-bundle-token"
+	n := startFakeNode(t, token)
+	t.Cleanup(Stop)
+	if err := StartWithHost(token, n.addr, freePort(t), "global", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := CreateSupportBundle(path, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	found := map[string]bool{}
+	for _, f := range zr.File {
+		name := f.Name
+		if strings.HasPrefix(name, "qlog/") {
+			name = "qlog/"
+		}
+		found[name] = true
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if bytes.Contains(data, []byte(token)) {
+			t.Fatalf("%s 中包含 token 原文", f.Name)
+		}
+	}
+	// 运行中抓取会重建隧道，qlog 包含新连接的握手
+	for _, name := range []string{"client.log", "capture.json", "qlog/", "config.json", "stats.json", "selection.json", "manifest.json"} {
+		if !found[name] {
+			t.Errorf("诊断包中缺少 %s", name)
+		}
+	}
+
+	// 抓取结束后清除登记，之后新建的客户端不再记录 qlog
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if capture != nil {
+		t.Fatal("抓取结束后仍登记着进行中的抓取")
+	}
+}
@@ -0,0 +1,133 @@
+package sdk
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"uap-quic/pkg/core"
+)
+
+// EventListener 宿主 App 实现的事件回调接口（gomobile 导出为 Java interface / ObjC protocol）
+// 回调在后台线程触发，更新 UI 需自行切回主线程
+type EventListener interface {
+	// OnQuotaWarning 本计费周期流量用量越过预警线（percent: 80 或 95），每个阈值每个周期只触发一次
+	OnQuotaWarning(percent int)
+	// OnUpgradeRequired 客户端版本低于管理后台要求的最低版本（Start 返回错误前触发），App 应展示升级页面
+	OnUpgradeRequired(minVersion string, upgradeURL string)
+	// OnNodeSelected 选路完成（Start / StartWithHost 连接节点之前触发），reportJSON 与 GetLastSelectionJSON 的返回相同
+	// 可据此提示用户"正在使用备用节点"等情况
+	OnNodeSelected(reportJSON string)
+	// OnConnectionEvent 隧道连接的生命周期事件，用于实时更新连接状态（不需要轮询 IsRunning / CheckTunnel）
+	// kind 为 EventConnected / EventDisconnected / EventReconnecting / EventNodeSwitched / EventAuthFailed；
+	// eventJSON 示例: {"kind":"reconnecting","time":"2025-01-01T12:00:00Z","server":"uap.example.com:443","attempt":2,"error":"...","instance":0}
+	// 同一实例的事件按发生顺序投递
+	OnConnectionEvent(kind string, eventJSON string)
+	// OnActivity 一条连接结束（需先用 SetActivityLog 开启），用于实时更新"最近活动"列表
+	// activityJSON 示例: {"time":"2025-01-01T12:00:00Z","host":"www.youtube.com","port":443,"action":"proxy","reason":"rule","rule":"youtube.com","bytes":52340,"duration_ms":1830,"instance":0}
+	// 同一实例的记录按连接结束的顺序投递，回调处理不过来时丢弃最旧的记录
+	OnActivity(activityJSON string)
+}
+
+// 连接生命周期事件类型（OnConnectionEvent 的 kind）
+const (
+	EventConnected    = core.EventConnected    // 隧道建立成功（首次连接、断线重连、换连）
+	EventDisconnected = core.EventDisconnected // 隧道意外断开（之后会自动重连）
+	EventReconnecting = core.EventReconnecting // 开始一次重连尝试（attempt 为本轮断线后的第几次，error 为上一次失败的原因）
+	EventNodeSwitched = core.EventNodeSwitched // 连接到了与上一次不同的节点（from 为之前的地址）
+	EventAuthFailed   = core.EventAuthFailed   // 节点拒绝了鉴权凭证，App 应重新登录或调用 SetToken
+)
+
+var (
+	listener     EventListener
+	listenerLock sync.Mutex
+)
+
+// SetEventListener 注册事件回调（传 nil 取消注册），可在 Start 前后任意时刻调用
+func SetEventListener(l EventListener) {
+	listenerLock.Lock()
+	defer listenerLock.Unlock()
+	listener = l
+}
+
+// dispatchNotification 将 core 取回的通知转发给宿主 App
+func dispatchNotification(n core.Notification) {
+	listenerLock.Lock()
+	l := listener
+	listenerLock.Unlock()
+
+	if l == nil {
+		return
+	}
+
+	switch n.Kind {
+	case core.NotificationQuotaWarning:
+		l.OnQuotaWarning(n.Percent)
+	}
+}
+
+// dispatchNodeSelected 通知宿主 App 选路结果
+func dispatchNodeSelected(reportJSON string) {
+	listenerLock.Lock()
+	l := listener
+	listenerLock.Unlock()
+
+	if l != nil {
+		l.OnNodeSelected(reportJSON)
+	}
+}
+
+// dispatchUpgradeRequired 通知宿主 App 需要升级
+func dispatchUpgradeRequired(info *core.VersionInfo) {
+	listenerLock.Lock()
+	l := listener
+	listenerLock.Unlock()
+
+	if l != nil {
+		l.OnUpgradeRequired(info.MinClientVersion, info.UpgradeURL)
+	}
+}
+
+// connectionEvents 返回把实例 instance 的连接事件转发给宿主 App 的回调
+func connectionEvents(instance int) func(core.Event) {
+	return func(e core.Event) {
+		listenerLock.Lock()
+		l := listener
+		listenerLock.Unlock()
+		if l == nil {
+			return
+		}
+
+		data, err := json.Marshal(struct {
+			core.Event
+			Instance int `json:"instance"`
+		}{e, instance})
+		if err != nil {
+			log.Printf("❌ 序列化连接事件失败: %v", err)
+			return
+		}
+		l.OnConnectionEvent(e.Kind, string(data))
+	}
+}
+
+// activityEvents 返回把实例 instance 的最近活动转发给宿主 App 的回调
+func activityEvents(instance int) func(core.Activity) {
+	return func(a core.Activity) {
+		listenerLock.Lock()
+		l := listener
+		listenerLock.Unlock()
+		if l == nil {
+			return
+		}
+
+		data, err := json.Marshal(struct {
+			core.Activity
+			Instance int `json:"instance"`
+		}{a, instance})
+		if err != nil {
+			log.Printf("❌ 序列化最近活动失败: %v", err)
+			return
+		}
+		l.OnActivity(string(data))
+	}
+}
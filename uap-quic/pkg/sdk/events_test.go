@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// connectionEvent OnConnectionEvent 的 eventJSON
+type connectionEvent struct {
+	Kind     string `json:"kind"`
+	Server   string `json:"server"`
+	Attempt  int    `json:"attempt"`
+	Error    string `json:"error"`
+	Instance int    `json:"instance"`
+}
+
+// eventListener 记录 OnConnectionEvent 与 OnActivity 的 EventListener
+type eventListener struct {
+	events     chan connectionEvent
+	activities chan string // OnActivity 的 activityJSON
+}
+
+func (l *eventListener) OnQuotaWarning(int)               {}
+func (l *eventListener) OnUpgradeRequired(string, string) {}
+func (l *eventListener) OnNodeSelected(string)            {}
+func (l *eventListener) OnConnectionEvent(kind string, eventJSON string) {
+	var e connectionEvent
+	if err := json.Unmarshal([]byte(eventJSON), &e); err != nil || e.Kind != kind {
+		e.Kind = "invalid: " + eventJSON
+	}
+	l.events <- e
+}
+func (l *eventListener) OnActivity(activityJSON string) {
+	l.activities <- activityJSON
+}
+
+// withEventListener 测试期间注册 eventListener
+func withEventListener(t *testing.T) *eventListener {
+	l := &eventListener{events: make(chan connectionEvent, 64), activities: make(chan string, 64)}
+	SetEventListener(l)
+	t.Cleanup(func() { SetEventListener(nil) })
+	return l
+}
+
+// expect 等待实例 instance 的下一个 kind 事件（跳过其他实例的事件）
+func (l *eventListener) expect(t *testing.T, instance int, kind string, within time.Duration) connectionEvent {
+	t.Helper()
+	timeout := time.After(within)
+	for {
+		select {
+		case e := <-l.events:
+			if e.Instance != instance {
+				continue
+			}
+			if e.Kind != kind {
+				t.Fatalf("收到事件 %+v，期望 %s", e, kind)
+			}
+			return e
+		case <-timeout:
+			t.Fatalf("%v 内未收到实例 %d 的 %s 事件", within, instance, kind)
+		}
+	}
+}
+
+// TestConnectionEventListener 模拟节点断开连接：依次收到 disconnected、reconnecting 与 connected
+func TestConnectionEventListener(t *testing.T) {
+	l := withEventListener(t)
+	t.Cleanup(Stop)
+	n := startFakeNode(t, "good-token")
+	if err := StartWithHost("good-token", n.addr, freePort(t), core.ModeGlobal, ""); err != nil {
+		t.Fatal(err)
+	}
+	if e := l.expect(t, DefaultInstance, EventConnected, 3*time.Second); e.Server != n.addr {
+		t.Fatalf("connected %+v", e)
+	}
+
+	conn := <-n.conns
+	conn.CloseWithError(0x42, "node crashed")
+	if e := l.expect(t, DefaultInstance, EventDisconnected, 3*time.Second); e.Error == "" {
+		t.Fatalf("disconnected 未带原因: %+v", e)
+	}
+	// 断线重连守护每 5 秒检查一次
+	if e := l.expect(t, DefaultInstance, EventReconnecting, 10*time.Second); e.Attempt != 1 {
+		t.Fatalf("reconnecting %+v", e)
+	}
+	l.expect(t, DefaultInstance, EventConnected, 5*time.Second)
+}
+
+func TestConnectionEventInstance(t *testing.T) {
+	l := withEventListener(t)
+	n := startFakeNode(t, "token-a")
+	id, err := StartInstance(n.addr, "token-a", freePort(t), core.ModeGlobal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopInstance(id) })
+	// 实例的事件带上实例句柄，连接过程中的事件也是
+	l.expect(t, id, EventConnected, 3*time.Second)
+}
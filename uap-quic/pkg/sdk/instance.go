@@ -0,0 +1,230 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"uap-quic/pkg/core"
+)
+
+// DefaultInstance 默认实例的句柄：Start / StartWithHost / Stop / SetMode 等单实例接口操作的都是默认实例
+const DefaultInstance = 0
+
+var (
+	instances    = make(map[int]*core.Client) // StartInstance 启动的实例（默认实例仍保存在 client 中，受 clientLock 保护）
+	nextInstance = DefaultInstance
+)
+
+// StartInstance 启动一个独立实例（指定服务器地址，不选路），返回实例句柄，供桌面端按配置（工作 / 个人）同时运行多个实例
+// 每个实例有自己的 QUIC 连接、分流规则、统计与 SOCKS5 端口，互不影响；默认实例（Start / StartWithHost）不受影响
+// token: 鉴权密钥；host: 服务器地址；port: 本地 SOCKS5 监听端口（不能与其他实例相同）
+// mode: 代理模式 ("smart" 或 "global")；rulesPath: 规则文件路径（空字符串表示使用 SetRulesFile 设置的文件）
+// 启动时应用当前通过 Set* 设置的配置；之后在运行中调用 Set* 只影响默认实例（SetSocketProtector 除外），实例的模式用 SetInstanceMode 切换
+// 包模式（StartTun）与诊断包只作用于默认实例
+func StartInstance(host string, token string, port int, mode string, rulesPath string) (int, error) {
+	if err := core.CheckMode(mode); err != nil {
+		return 0, err
+	}
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("端口无效: %d", port)
+	}
+	clientLock.Lock()
+	if rulesPath == "" {
+		rulesPath = rulesFile
+	}
+
+	if err := checkPortLocked(port); err != nil {
+		clientLock.Unlock()
+		return 0, err
+	}
+
+	// 先分配句柄，连接过程中的事件也带上实例句柄（连接失败时句柄作废）
+	nextInstance++
+	id := nextInstance
+	c := newClient(host, token, port, mode)
+	c.SetEventHandler(connectionEvents(id))
+	c.SetActivityHandler(activityEvents(id))
+	clientLock.Unlock()
+
+	// 拨号与验证不持有 clientLock（同 StartWithHost）：一个实例连接慢时，其他实例的启动与查询不被阻塞
+	if err := connectClient(c); err != nil {
+		return 0, err
+	}
+
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	// 拨号期间端口可能已被其他实例占用
+	if err := checkPortLocked(port); err != nil {
+		c.Stop()
+		return 0, err
+	}
+	applySocketProtector(c) // 拨号期间可能更换了保护回调
+	instances[id] = c
+	go func() {
+		if err := c.Start(rulesPath); err != nil {
+			log.Printf("❌ 实例 %d 启动失败: %v", id, err)
+		}
+	}()
+	log.Printf("✅ 实例 %d 已启动: %s (端口 %d)", id, host, port)
+	return id, nil
+}
+
+// StopInstance 停止实例并释放资源（句柄不存在时忽略）；DefaultInstance 等同于 Stop
+func StopInstance(id int) {
+	if id == DefaultInstance {
+		Stop()
+		return
+	}
+
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if c, ok := instances[id]; ok {
+		c.Stop()
+		delete(instances, id)
+		log.Printf("🛑 实例 %d 已停止", id)
+	}
+}
+
+// IsInstanceRunning 检查实例是否正在运行；DefaultInstance 等同于 IsRunning
+func IsInstanceRunning(id int) bool {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	return instanceLocked(id) != nil
+}
+
+// GetInstanceStatsJSON 获取实例的分流统计（JSON 字符串，格式同 GetStatsJSON），实例未运行时返回空字符串
+// DefaultInstance 等同于 GetStatsJSON（附带选路结果）
+func GetInstanceStatsJSON(id int, topN int) string {
+	if id == DefaultInstance {
+		return GetStatsJSON(topN)
+	}
+
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	c := instanceLocked(id)
+	if c == nil {
+		return ""
+	}
+	data, err := json.Marshal(c.GetStats(topN))
+	if err != nil {
+		log.Printf("❌ 序列化统计失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// SetInstanceMode 切换实例的代理模式 ("smart" 或 "global")，对之后新建的连接生效；实例未运行时返回错误
+func SetInstanceMode(id int, mode string) error {
+	if err := core.CheckMode(mode); err != nil {
+		return err
+	}
+
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	c := instanceLocked(id)
+	if c == nil {
+		return notRunning(id)
+	}
+	return c.SetMode(mode)
+}
+
+// SetMode 切换默认实例的代理模式 ("smart" 或 "global")，对之后新建的连接生效；未运行时返回错误
+func SetMode(mode string) error {
+	return SetInstanceMode(DefaultInstance, mode)
+}
+
+// SetInstanceToken 更新实例的 token（如刷新令牌流程中轮换的 access token），不重启实例：
+// 只用新凭证重建 QUIC 连接并验证，SOCKS5 监听与直连的连接不受影响，旧连接上进行中的请求继续传输一段时间后关闭
+// 新 token 被节点拒绝时返回错误（实例继续运行，可再次调用更新）；实例未运行时返回错误
+func SetInstanceToken(id int, token string) error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	c := instanceLocked(id)
+	if c == nil {
+		return notRunning(id)
+	}
+	if err := c.SetToken(token); err != nil {
+		return fmt.Errorf("使用新 token 重建连接失败: %w", err)
+	}
+	return verifyClient(c)
+}
+
+// SetToken 更新默认实例的 token，见 SetInstanceToken
+func SetToken(token string) error {
+	return SetInstanceToken(DefaultInstance, token)
+}
+
+// SetInstanceServer 把实例切换到另一个节点 (host:port)，不重启实例：
+// 只重建 QUIC 连接，SOCKS5 监听与直连的连接不受影响，旧节点上进行中的请求继续传输一段时间后关闭
+// 新节点连接失败或拒绝鉴权时返回错误（实例留在新地址上由后台重连）；实例未运行时返回错误
+func SetInstanceServer(id int, host string) error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	c := instanceLocked(id)
+	if c == nil {
+		return notRunning(id)
+	}
+	if err := c.SetServer(host); err != nil {
+		return fmt.Errorf("切换节点失败: %w", err)
+	}
+	if id == DefaultInstance {
+		recordSelection(newSelectionReport(SelectionManual, nil, node{Address: host}, host))
+	}
+	return verifyClient(c)
+}
+
+// SetServer 把默认实例切换到另一个节点，见 SetInstanceServer
+func SetServer(host string) error {
+	return SetInstanceServer(DefaultInstance, host)
+}
+
+// verifyClient 验证重建后的隧道：只有鉴权被拒时返回错误，网络原因失败由后台重连处理
+func verifyClient(c *core.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), core.DefaultVerifyTimeout)
+	defer cancel()
+	err := c.VerifyTunnel(ctx)
+	if errors.Is(err, core.ErrAuthRejected) {
+		return fmt.Errorf("节点拒绝了鉴权凭证: %w", err)
+	}
+	if err != nil {
+		log.Printf("⚠️ 隧道验证失败 (后台重试): %v", err)
+	}
+	return nil
+}
+
+// notRunning 实例未运行的错误
+func notRunning(id int) error {
+	if id == DefaultInstance {
+		return fmt.Errorf("VPN 未运行")
+	}
+	return fmt.Errorf("实例 %d 未运行", id)
+}
+
+// instanceLocked 按句柄查找运行中的实例（调用方持有 clientLock）
+func instanceLocked(id int) *core.Client {
+	if id == DefaultInstance {
+		return client
+	}
+	return instances[id]
+}
+
+// checkPortLocked 本地 SOCKS5 端口是否已被运行中的实例（包括默认实例）使用（调用方持有 clientLock）
+func checkPortLocked(port int) error {
+	if client != nil && client.LocalPort() == port {
+		return fmt.Errorf("端口 %d 已被默认实例使用", port)
+	}
+	for id, c := range instances {
+		if c.LocalPort() == port {
+			return fmt.Errorf("端口 %d 已被实例 %d 使用", port, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package sdk
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// writeRules 把规则写入临时文件，返回路径
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// instanceStats 实例的分流统计
+func instanceStats(t *testing.T, id int) core.Stats {
+	t.Helper()
+	var stats core.Stats
+	if err := json.Unmarshal([]byte(GetInstanceStatsJSON(id, 0)), &stats); err != nil {
+		t.Fatalf("实例 %d 的统计: %v", id, err)
+	}
+	return stats
+}
+
+// socksConnectVia 经本机 port 上的 SOCKS5 代理连接 target（IPv4 地址），返回回复码
+func socksConnectVia(t *testing.T, port int, target *net.TCPAddr) byte {
+	t.Helper()
+	conn, rep := socksDial(t, port, target)
+	conn.Close()
+	return rep
+}
+
+// socksDial 经本机 port 上的 SOCKS5 代理连接 target（IPv4 地址），返回连接与回复码
+func socksDial(t *testing.T, port int, target *net.TCPAddr) (net.Conn, byte) {
+	t.Helper()
+	// 监听在实例启动后异步建立
+	var conn net.Conn
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := append([]byte{0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x01}, target.IP.To4()...)
+	req = binary.BigEndian.AppendUint16(req, uint16(target.Port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2+10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("读取 SOCKS5 回复失败: %v", err)
+	}
+	return conn, reply[3]
+}
+
+// waitRules 等待实例在后台加载规则
+func waitRules(t *testing.T, id, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for instanceStats(t, id).RuleCount != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("实例 %d 的规则数 %d，期望 %d", id, instanceStats(t, id).RuleCount, count)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTwoInstances(t *testing.T) {
+	nodeA, nodeB := startFakeNode(t, "token-a"), startFakeNode(t, "token-b")
+	portA, portB := freePort(t), freePort(t)
+
+	a, err := StartInstance(nodeA.addr, "token-a", portA, core.ModeSmart, writeRules(t, "a.example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopInstance(a) })
+	b, err := StartInstance(nodeB.addr, "token-b", portB, core.ModeGlobal, writeRules(t, "b.example\nb.example.org\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopInstance(b) })
+	if a == b || a == DefaultInstance || b == DefaultInstance {
+		t.Fatalf("实例句柄 %d / %d", a, b)
+	}
+
+	// 各自的 QUIC 连接：每个节点只收到自己实例的 token
+	for _, tc := range []struct {
+		node  *fakeNode
+		token string
+	}{{nodeA, "token-a"}, {nodeB, "token-b"}} {
+		select {
+		case got := <-tc.node.authed:
+			if got != tc.token {
+				t.Fatalf("节点收到 token %q，期望 %q", got, tc.token)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("节点未收到鉴权")
+		}
+	}
+
+	// 各自的规则
+	waitRules(t, a, 1)
+	waitRules(t, b, 2)
+
+	// 各自的 SOCKS5 端口与统计
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	if rep := socksConnectVia(t, portA, ln.Addr().(*net.TCPAddr)); rep != 0x00 {
+		t.Fatalf("经实例 %d 直连本机目标回复 0x%02x", a, rep)
+	}
+	if sa, sb := instanceStats(t, a), instanceStats(t, b); sa.Direct != 1 || sb.Direct != 0 {
+		t.Fatalf("直连计数 %d / %d，期望 1 / 0", sa.Direct, sb.Direct)
+	}
+
+	// 各自的模式
+	if err := SetInstanceMode(a, core.ModeGlobal); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetInstanceMode(b, core.ModeSmart); err != nil {
+		t.Fatal(err)
+	}
+	if sa, sb := instanceStats(t, a), instanceStats(t, b); sa.Mode != core.ModeGlobal || sb.Mode != core.ModeSmart {
+		t.Fatalf("模式 %s / %s", sa.Mode, sb.Mode)
+	}
+
+	// 停止一个实例不影响另一个
+	StopInstance(a)
+	if IsInstanceRunning(a) || !IsInstanceRunning(b) || GetInstanceStatsJSON(a, 0) != "" {
+		t.Fatal("停止实例影响了另一个实例")
+	}
+	if err := SetInstanceMode(a, core.ModeSmart); err == nil {
+		t.Fatal("已停止的实例切换模式成功")
+	}
+	if rep := socksConnectVia(t, portB, ln.Addr().(*net.TCPAddr)); rep != 0x00 {
+		t.Fatalf("经实例 %d 直连本机目标回复 0x%02x", b, rep)
+	}
+}
+
+func TestStartInstanceErrors(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+	port := freePort(t)
+	id, err := StartInstance(n.addr, "good-token", port, core.ModeSmart, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopInstance(id) })
+
+	if _, err := StartInstance(n.addr, "good-token", port, core.ModeSmart, ""); err == nil {
+		t.Fatal("端口冲突的实例启动成功")
+	}
+	if _, err := StartInstance(n.addr, "bad-token", freePort(t), core.ModeSmart, ""); err == nil {
+		t.Fatal("鉴权被拒的实例启动成功")
+	}
+	if _, err := StartInstance(n.addr, "good-token", freePort(t), "auto", ""); err == nil {
+		t.Fatal("模式无效的实例启动成功")
+	}
+	if _, err := StartInstance(n.addr, "good-token", 0, core.ModeSmart, ""); err == nil {
+		t.Fatal("端口无效的实例启动成功")
+	}
+}
+
+func TestStartInstanceDoesNotHoldLock(t *testing.T) {
+	slow, fast := startFakeNode(t, "good-token"), startFakeNode(t, "good-token")
+	var once sync.Once
+	gate := slow.withGate()
+	release := func() { once.Do(gate) }
+	defer release()
+
+	done := make(chan error, 1)
+	go func() {
+		id, err := StartInstance(slow.addr, "good-token", freePort(t), core.ModeSmart, "")
+		if err == nil {
+			t.Cleanup(func() { StopInstance(id) })
+		}
+		done <- err
+	}()
+	select {
+	case <-slow.authed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("节点未收到鉴权")
+	}
+
+	// 一个实例拨号期间，另一个实例照常启动
+	started := make(chan int, 1)
+	go func() {
+		id, err := StartInstance(fast.addr, "good-token", freePort(t), core.ModeSmart, "")
+		if err != nil {
+			t.Error(err)
+		}
+		started <- id
+	}()
+	select {
+	case id := <-started:
+		defer StopInstance(id)
+		if !IsInstanceRunning(id) {
+			t.Fatal("实例未运行")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("另一个实例拨号期间 StartInstance 被阻塞")
+	}
+
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartInstance 未返回")
+	}
+}
+
+// startTCPEcho 本机 TCP 回显服务
+func startTCPEcho(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+// waitAuthed 等待节点收到 token 的鉴权
+func waitAuthed(t *testing.T, n *fakeNode, token string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-n.authed:
+			if got == token {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("节点未收到 token %q 的鉴权", token)
+		}
+	}
+}
+
+// echoVia 在已建立的连接上回显一次
+func echoVia(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != msg {
+		t.Fatalf("回显 %q: %v", buf, err)
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	if err := SetToken("new-token"); err == nil {
+		t.Fatal("未运行时更新 token 成功")
+	}
+	n := startFakeNode(t, "old-token", "new-token")
+	port := freePort(t)
+	if err := StartWithHost("old-token", n.addr, port, core.ModeSmart, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Stop)
+	waitAuthed(t, n, "old-token")
+
+	// 进行中的直连（未命中规则）
+	echo := startTCPEcho(t)
+	conn, rep := socksDial(t, port, echo)
+	defer conn.Close()
+	if rep != 0x00 {
+		t.Fatalf("直连回复 0x%02x", rep)
+	}
+	echoVia(t, conn, "before")
+
+	// 用新凭证重建连接并验证，监听与直连不受影响
+	if err := SetToken("new-token"); err != nil {
+		t.Fatal(err)
+	}
+	waitAuthed(t, n, "new-token")
+	if !IsRunning() {
+		t.Fatal("更新 token 后实例未运行")
+	}
+	echoVia(t, conn, "after")
+	if rep := socksConnectVia(t, port, echo); rep != 0x00 {
+		t.Fatalf("更新 token 后 SOCKS5 监听回复 0x%02x", rep)
+	}
+
+	// 新 token 被拒绝时返回错误，实例继续运行
+	if err := SetToken("bad-token"); err == nil {
+		t.Fatal("被拒绝的 token 更新成功")
+	}
+	if err := SetToken(""); err == nil {
+		t.Fatal("空 token 更新成功")
+	}
+	if !IsRunning() {
+		t.Fatal("token 被拒绝后实例停止了")
+	}
+	echoVia(t, conn, "rejected")
+}
+
+func TestSetServer(t *testing.T) {
+	if err := SetServer("127.0.0.1:1"); err == nil {
+		t.Fatal("未运行时切换节点成功")
+	}
+	from, to := startFakeNode(t, "good-token"), startFakeNode(t, "good-token")
+	port := freePort(t)
+	if err := StartWithHost("good-token", from.addr, port, core.ModeSmart, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Stop)
+	waitAuthed(t, from, "good-token")
+
+	echo := startTCPEcho(t)
+	conn, rep := socksDial(t, port, echo)
+	defer conn.Close()
+	if rep != 0x00 {
+		t.Fatalf("直连回复 0x%02x", rep)
+	}
+
+	// 只重建 QUIC 连接：新节点收到鉴权，进行中的直连与监听不受影响
+	if err := SetServer(to.addr); err != nil {
+		t.Fatal(err)
+	}
+	waitAuthed(t, to, "good-token")
+	echoVia(t, conn, "switched")
+	if rep := socksConnectVia(t, port, echo); rep != 0x00 {
+		t.Fatalf("切换节点后 SOCKS5 监听回复 0x%02x", rep)
+	}
+	if err := SetServer("no-port"); err == nil {
+		t.Fatal("无效的节点地址切换成功")
+	}
+}
@@ -1,222 +1,323 @@
 package sdk
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
-	"sort"
-	"sync"
 	"time"
 
 	"uap-quic/pkg/core"
 )
 
 // API 服务器地址（可根据需要修改）
-const apiBaseURL = "http://localhost:8080/api/v1/client/nodes"
+const apiBaseURL = "http://localhost:8080/api/v1"
 
 // 备用节点地址（当 API 拉取失败时使用）
 const fallbackNodeAddr = "uaptest.org:52222"
 
-// node 节点结构体（未导出，仅内部使用）
-type node struct {
-	Name    string        `json:"name"`
-	Address string        `json:"address"`
-	Latency time.Duration `json:"-"` // 延迟（不序列化到 JSON）
+// maxLatency 测速失败节点的延迟（无穷大，最大 time.Duration 值）
+const maxLatency = core.Unreachable
+
+// defaultStickyMaxLatency 粘性选路时固定节点可接受的默认最大延迟
+const defaultStickyMaxLatency = 200 * time.Millisecond
+
+// node 节点（与命令行客户端共用 core.Node）
+type node = core.Node
+
+// fetchNodeList 从 API 获取节点列表（sticky 为 true 时管理后台标记账户的固定节点）
+func fetchNodeList(ctx context.Context, token string, sticky bool) ([]node, error) {
+	url := apiBaseURL + "/client/nodes"
+	if sticky {
+		url += "?sticky=true"
+	}
+	return core.FetchNodes(ctx, url, token)
 }
 
-// apiResponse API 响应结构体（未导出，仅内部使用）
-type apiResponse struct {
-	Code int    `json:"code"`
-	Data []node `json:"data"`
-	Msg  string `json:"msg,omitempty"`
+// nodeLatency 单个节点的测速结果（与 uap-admin 的 api.NodeLatency 一致）
+type nodeLatency struct {
+	Address   string `json:"address"`
+	LatencyMs int    `json:"latency_ms"` // -1 表示超时/失败
 }
 
-// fetchNodeList 从 API 获取节点列表
-func fetchNodeList(token string) []node {
-	// 构建请求
-	req, err := http.NewRequest("GET", apiBaseURL, nil)
-	if err != nil {
-		log.Printf("❌ 创建请求失败: %v", err)
-		return nil
+// reportNodeLatency 把测速结果上报给管理后台（尽力而为，失败只记录日志）
+func reportNodeLatency(token string, nodes []node) {
+	reports := make([]nodeLatency, 0, len(nodes))
+	for _, n := range nodes {
+		if !n.Probed {
+			continue // 未测速的节点不当作失败上报
+		}
+		ms := -1
+		if n.Latency != maxLatency {
+			ms = int(n.Latency / time.Millisecond)
+		}
+		reports = append(reports, nodeLatency{Address: n.Address, LatencyMs: ms})
 	}
+	postReport(token, "/client/nodes/latency", "测速结果", reports)
+}
 
-	// 设置 Authorization Header
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+// nodeConnect 单个节点的连接结果（与 uap-admin 的 api.ClientNodeReport 一致）
+type nodeConnect struct {
+	Address   string `json:"address"`
+	Success   bool   `json:"success"`
+	LatencyMs int    `json:"latency_ms"`       // QUIC 握手耗时，失败时为 0
+	Reason    string `json:"reason,omitempty"` // 失败原因（见 core.NodeFail*）
+}
 
-	// 发送请求
-	client := &http.Client{
-		Timeout: 10 * time.Second, // 设置超时
+// reportNodeConnect 把本次启动连接选中节点的结果上报给管理后台（尽力而为，失败只记录日志）
+// 节点从管理后台可达、从用户所在地区不可达时，只有客户端的连接结果能反映出来；
+// 附带的失败原因（证书、ALPN 等）供管理后台标记配置错误的节点
+func reportNodeConnect(token, address string, handshake time.Duration, failure *core.NodeFailure) {
+	report := nodeConnect{Address: address, Success: handshake > 0 && failure == nil}
+	if report.Success {
+		report.LatencyMs = max(int(handshake/time.Millisecond), 1)
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("❌ 请求失败: %v", err)
-		return nil
+	if failure != nil {
+		report.Reason = failure.Reason
 	}
-	defer resp.Body.Close()
+	postReport(token, "/client/report", "连接结果", []nodeConnect{report})
+}
 
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
+// postReport 把 nodes 上报给管理后台的 path 接口（尽力而为，失败只记录日志，被限流时忽略）
+func postReport(token, path, what string, nodes interface{}) {
+	body, err := json.Marshal(map[string]interface{}{"nodes": nodes})
 	if err != nil {
-		log.Printf("❌ 读取响应失败: %v", err)
-		return nil
+		return
 	}
 
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("❌ API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
-		return nil
+	req, err := http.NewRequest("POST", apiBaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return
 	}
+	req.Header.Set("Content-Type", "application/json")
+	core.SetAPIHeaders(req, token)
 
-	// 解析 JSON
-	var apiResp apiResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		log.Printf("❌ 解析 JSON 失败: %v, 响应: %s", err, string(body))
-		return nil
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("⚠️  %s上报失败: %v", what, err)
+		return
 	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusTooManyRequests {
+		log.Printf("⚠️  %s上报失败: 状态码 %d", what, resp.StatusCode)
+	}
+}
 
-	// 检查响应码
-	if apiResp.Code != 200 {
-		log.Printf("❌ API 返回错误: code=%d, msg=%s", apiResp.Code, apiResp.Msg)
-		return nil
+// ClearStickyNode 清除管理后台记录的固定节点（App 的"切换节点"操作）
+// 之后调用 Start 时按延迟与权重重新选路，并固定到新选中的节点（粘性选路开启时）
+func ClearStickyNode(token string) error {
+	req, err := http.NewRequest("DELETE", apiBaseURL+"/client/nodes/pin", nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
 	}
+	core.SetAPIHeaders(req, token)
 
-	// 检查节点列表是否为空
-	if len(apiResp.Data) == 0 {
-		log.Printf("⚠️  节点列表为空")
-		return nil
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return apiResp.Data
+	var apiResp struct {
+		Code  int    `json:"code"`
+		Error string `json:"error,omitempty"`
+		Msg   string `json:"msg,omitempty"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &apiResp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("清除固定节点: %w", core.ParseAPIError(resp.StatusCode, apiResp.Code, apiResp.Error, apiResp.Msg))
+	}
+	return nil
 }
 
-// pingNodes 并发测速所有节点
-func pingNodes(nodes []node) []node {
-	if len(nodes) == 0 {
-		return nodes
+// isFatalAPIError 是否为换节点也无法解决的错误（需要宿主 App 处理：重新登录、充值等）
+// 这类错误直接从 Start 返回，而不是回落到备用节点
+func isFatalAPIError(err error) bool {
+	for _, target := range []error{core.ErrTokenMissing, core.ErrTokenExpired, core.ErrTokenInvalid, core.ErrUserNotFound, core.ErrQuotaExceeded} {
+		if errors.Is(err, target) {
+			return true
+		}
 	}
+	return false
+}
 
-	log.Printf("🚀 开始测速，共 %d 个节点...", len(nodes))
-
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	const timeout = 2 * time.Second
-	const maxLatency = time.Duration(1<<63 - 1) // 无穷大（最大 time.Duration 值）
-
-	// 并发测速所有节点
-	for i := range nodes {
-		wg.Add(1)
-		go func(idx int) {
-			defer wg.Done()
-
-			node := &nodes[idx]
-			start := time.Now()
-
-			// 尝试建立 TCP 连接
-			conn, err := net.DialTimeout("tcp", node.Address, timeout)
-			if err != nil {
-				// 连接失败或超时，设置为无穷大
-				mu.Lock()
-				node.Latency = maxLatency
-				mu.Unlock()
-				return
-			}
-			conn.Close()
-
-			// 记录延迟
-			latency := time.Since(start)
-			mu.Lock()
-			node.Latency = latency
-			mu.Unlock()
-		}(i)
+// pinnedNode 粘性选路：返回管理后台标记的固定节点，不可达或延迟超过 limit 时返回 false
+func pinnedNode(nodes []node, limit time.Duration) (node, bool) {
+	for _, n := range nodes {
+		if !n.Pinned {
+			continue
+		}
+		switch {
+		case !n.Probed:
+			log.Printf("📌 固定节点 %s 未测速，重新选路", n.Name)
+			return node{}, false
+		case n.Latency == maxLatency:
+			log.Printf("📌 固定节点 %s 测速失败，重新选路", n.Name)
+			return node{}, false
+		case n.Latency > limit:
+			log.Printf("📌 固定节点 %s 延迟过高（%v > %v），重新选路", n.Name, n.Latency.Round(time.Millisecond), limit)
+			return node{}, false
+		}
+		return n, true
 	}
+	return node{}, false
+}
 
-	// 等待所有测速完成
-	wg.Wait()
-
-	// 根据延迟排序（从小到大）
-	sort.Slice(nodes, func(i, j int) bool {
-		return nodes[i].Latency < nodes[j].Latency
-	})
-
-	// 打印测速结果
-	log.Printf("[测速结果]")
-	for _, node := range nodes {
-		if node.Latency == maxLatency {
-			log.Printf("  %s: 超时/失败", node.Name)
-		} else {
-			latencyMs := node.Latency.Round(time.Millisecond)
-			log.Printf("  %s: %v", node.Name, latencyMs)
-		}
+// checkVersion 启动前检查客户端版本门槛
+// 版本低于最低要求时通知宿主 App 并返回 core.ErrUpgradeRequired；接口不可达时不阻止启动
+func checkVersion() error {
+	info, err := core.FetchVersionInfo(apiBaseURL + "/client/version")
+	if err != nil {
+		log.Printf("⚠️  版本检查失败（忽略）: %v", err)
+		return nil
 	}
 
-	return nodes
+	if info.UpgradeRequired {
+		log.Printf("⛔ 客户端版本过低: 当前 %s, 最低要求 %s, 升级地址: %s", core.Version, info.MinClientVersion, info.UpgradeURL)
+		dispatchUpgradeRequired(info)
+		return fmt.Errorf("%w（当前 %s，最低要求 %s）", core.ErrUpgradeRequired, core.Version, info.MinClientVersion)
+	}
+	if info.UpdateAvailable {
+		log.Printf("🆕 发现新版本 %s（当前 %s）", info.LatestVersion, core.Version)
+	}
+	return nil
 }
 
 // Start 移动端启动方法（智能选路版本）
 // token: 鉴权密钥（不再需要 host 参数，会自动从 API 获取节点并选路）
 // port: 本地 SOCKS5 监听端口 (e.g., 1080)
 // mode: 代理模式 ("smart" 或 "global")
-// rules: 路由规则字符串 (换行符分隔，空字符串表示使用默认文件)
+// rules: 路由规则字符串 (换行符分隔，格式与 whitelist.txt 相同；空字符串表示读取 SetRulesFile 设置的文件)
 func Start(token string, port int, mode string, rules string) error {
+	c, report, gen, err := selectClient(token, port, mode)
+	if err != nil {
+		return err
+	}
+
+	// 5. 同步验证隧道：握手成功但鉴权被拒（token 失效等）时直接返回错误（拨号不持有 clientLock，见 installClient）
+	err = connectClient(c)
+	failure := c.NodeFailure(report.Address)
+	setSelectionFailure(failure)
+	// 选路得到的节点上报连接结果，参与节点评分（备用节点不在节点列表中，不上报）
+	if report.Outcome == SelectionAPIOK {
+		go reportNodeConnect(token, report.Address, c.HandshakeTime(), failure)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 6. 登记为默认实例并在 goroutine 中启动（非阻塞）
+	return installClient(c, gen, rules)
+}
+
+// selectClient 停止运行中的默认实例，选路并创建客户端（步骤 0-4），返回客户端、选路结果与启动代次
+func selectClient(token string, port int, mode string) (*core.Client, *SelectionReport, uint64, error) {
 	clientLock.Lock()
 	defer clientLock.Unlock()
 
 	// 如果已经启动，先停止
+	stopTunLocked()
 	if client != nil {
 		client.Stop()
 		client = nil
 	}
+	if err := checkPortLocked(port); err != nil {
+		return nil, nil, 0, err
+	}
+
+	// 0. 版本门槛：过低版本直接返回错误，由宿主 App 展示升级页面
+	if err := checkVersion(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	// 选路期间（拉取节点列表、测速）可被 Stop 取消，如 App 切到后台
+	ctx, cancel := context.WithCancel(context.Background())
+	setStartCancel(cancel)
+	defer setStartCancel(nil)
 
 	var serverAddr string
+	var report *SelectionReport
 
 	// 1. 尝试从 API 获取节点列表
 	log.Println("🔍 正在从 API 获取节点列表...")
-	nodes := fetchNodeList(token)
+	nodes, err := fetchNodeList(ctx, token, stickyNode)
+	if ctx.Err() != nil {
+		return nil, nil, 0, ErrStartCanceled
+	}
+	if err != nil {
+		if isFatalAPIError(err) {
+			log.Printf("⛔ 获取节点列表被拒绝: %v", err)
+			return nil, nil, 0, err
+		}
+		log.Printf("❌ 获取节点列表失败: %v", err)
+	}
 
 	if len(nodes) > 0 {
-		// 2. 对节点进行测速并排序
-		nodes = pingNodes(nodes)
-
-		// 3. 选择延迟最低的节点（排序后的第一个）
-		bestNode := nodes[0]
-		const maxLatency = time.Duration(1<<63 - 1)
-		if bestNode.Latency == maxLatency {
+		// 2. 对节点进行测速并排序，测速结果异步上报给管理后台参与节点评分
+		nodes = core.PingNodes(ctx, nodes, core.PingOptions{
+			Concurrency: pingConcurrency,
+			GoodLatency: pingGoodLatency,
+			GoodCount:   pingGoodCount,
+			Jitter:      pingJitter,
+		})
+		if ctx.Err() != nil {
+			return nil, nil, 0, ErrStartCanceled
+		}
+		go reportNodeLatency(token, nodes)
+
+		// 3. 粘性选路优先使用固定节点，否则结合延迟与运营方权重选路
+		bestNode, ok := node{}, false
+		if stickyNode {
+			bestNode, ok = pinnedNode(nodes, stickyMaxLatency)
+			if ok {
+				log.Printf("📌 使用固定节点: %s", bestNode.Name)
+			}
+		}
+		if !ok {
+			bestNode, ok = core.SelectNode(nodes, selectTolerance)
+		}
+		if !ok {
 			// 所有节点都超时，使用备用地址
 			log.Printf("⚠️  所有节点测速失败，使用备用节点: %s", fallbackNodeAddr)
 			serverAddr = fallbackNodeAddr
+			report = newSelectionReport(SelectionAllPingsFailed, nodes, node{}, serverAddr)
 		} else {
-			// 使用最快的节点
 			serverAddr = bestNode.Address
 			latencyMs := bestNode.Latency.Round(time.Millisecond)
-			log.Printf("[SDK] 选中节点: %s (%v)", bestNode.Name, latencyMs)
+			log.Printf("[SDK] 选中节点: %s (%v, 权重 %d, 评分 %d)", bestNode.Name, latencyMs, core.NodeWeight(bestNode), core.NodeScore(bestNode))
+			report = newSelectionReport(SelectionAPIOK, nodes, bestNode, serverAddr)
 		}
 	} else {
 		// 获取失败，使用备用节点
 		log.Printf("⚠️  获取节点列表失败，使用备用节点: %s", fallbackNodeAddr)
 		serverAddr = fallbackNodeAddr
+		report = newSelectionReport(SelectionAPIFailed, nil, node{}, serverAddr)
+		if err != nil {
+			report.Error = err.Error()
+		}
 	}
-
-	// 4. 创建客户端实例
-	client = core.NewClient(serverAddr, token, port, mode)
-
-	// 5. 如果提供了规则字符串，写入临时文件
-	whitelistFile := "whitelist.txt"
-	if rules != "" {
-		// 这里可以扩展为写入临时文件，暂时使用默认文件
-		// 实际使用时，可以通过 core.Client 的接口扩展来支持直接传入规则
-		whitelistFile = "whitelist.txt"
+	recordSelection(report)
+
+	// 4. 创建客户端实例（拨号前用 token 换取短期连接票据）
+	c := newClient(serverAddr, token, port, mode)
+	c.SetTicketURL(apiBaseURL + "/client/ticket")
+	c.SetSignedHandshake(signedAuth)
+	c.SetStickyNode(stickyNode)
+	c.SetSignURL(apiBaseURL + "/client/sign")
+	if walletKey != "" {
+		c.SetWalletKey(walletKey) // SetWalletKey 时已校验
 	}
+	// 定期轮询账户状态，通知通过 EventListener 转发给宿主 App
+	c.SetStatusURL(apiBaseURL + "/client/status")
+	c.SetNotificationHandler(dispatchNotification)
 
-	// 6. 在 goroutine 中启动（非阻塞）
-	go func() {
-		if err := client.Start(whitelistFile); err != nil {
-			log.Printf("❌ SDK 启动失败: %v", err)
-		}
-	}()
-
-	return nil
+	startGen++
+	return c, report, startGen, nil
 }
-
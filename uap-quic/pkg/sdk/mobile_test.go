@@ -0,0 +1,61 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+func TestIsFatalAPIError(t *testing.T) {
+	fatal := []*core.APIError{
+		core.ParseAPIError(401, 40101, "token_missing", ""),
+		core.ParseAPIError(401, 40102, "token_expired", ""),
+		core.ParseAPIError(401, 40103, "token_invalid", ""),
+		core.ParseAPIError(404, 40401, "user_not_found", ""),
+		core.ParseAPIError(402, 40201, "quota_exceeded", ""),
+	}
+	for _, err := range fatal {
+		if !isFatalAPIError(fmt.Errorf("节点接口: %w", err)) {
+			t.Errorf("%s 应直接返回给宿主 App", err.Name)
+		}
+	}
+
+	// 换节点可能解决的错误回落到备用节点
+	for _, err := range []error{
+		core.ParseAPIError(404, 40402, "node_not_found", ""),
+		core.ParseAPIError(500, 50001, "database_error", ""),
+		errors.New("请求失败: connection refused"),
+	} {
+		if isFatalAPIError(err) {
+			t.Errorf("%v 不应视为致命错误", err)
+		}
+	}
+}
+
+func TestPinnedNode(t *testing.T) {
+	limit := 200 * time.Millisecond
+	pinned := func(latency time.Duration, probed bool) []node {
+		return []node{
+			{Name: "fast", Latency: 20 * time.Millisecond, Probed: true},
+			{Name: "pinned", Latency: latency, Probed: probed, Pinned: true},
+		}
+	}
+
+	// 固定节点可达且延迟不超过阈值时优先于更快的节点
+	if n, ok := pinnedNode(pinned(150*time.Millisecond, true), limit); !ok || n.Name != "pinned" {
+		t.Fatalf("选中 %q, %v", n.Name, ok)
+	}
+	for name, nodes := range map[string][]node{
+		"延迟过高":   pinned(250*time.Millisecond, true),
+		"测速失败":   pinned(maxLatency, true),
+		"未测速":    pinned(0, false),
+		"没有固定节点": {{Name: "fast", Latency: 20 * time.Millisecond, Probed: true}},
+	} {
+		if n, ok := pinnedNode(nodes, limit); ok {
+			t.Errorf("%s: 不应使用固定节点，选中 %q", name, n.Name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+
+	"github.com/quic-go/quic-go"
+)
+
+// testCert 测试节点使用的证书（TestMain 中生成并设为唯一的根证书）
+var testCert tls.Certificate
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+
+	dir, err := os.MkdirTemp("", "uap-sdk-test")
+	if err != nil {
+		panic(err)
+	}
+	var certPEM []byte
+	testCert, certPEM = generateTestCert()
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		panic(err)
+	}
+	// 客户端按系统根证书校验节点证书（必须在第一次校验证书之前设置）
+	os.Setenv("SSL_CERT_FILE", certFile)
+	os.Setenv("SSL_CERT_DIR", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// generateTestCert 生成包含 core.ServerName 的自签名证书
+func generateTestCert() (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: core.ServerName},
+		DNSNames:              []string{core.ServerName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// fakeNode 进程内的最小节点：token 在 accept 中时鉴权通过并回显验证指令，否则直接关闭流（同节点拒绝鉴权）
+type fakeNode struct {
+	addr   string
+	accept []string
+	authed chan string          // 每收到一行鉴权（token）时发送
+	conns  chan quic.Connection // 每接受一条连接时发送
+	gate   chan struct{}        // 不为 nil 时，回复鉴权结果前等待关闭
+}
+
+// startFakeNode 在本机临时端口启动 fakeNode，接受 accept 中的任一 token
+func startFakeNode(t *testing.T, accept ...string) *fakeNode {
+	t.Helper()
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCert},
+		NextProtos:   []string{"h3"},
+		MinVersion:   tls.VersionTLS13,
+	}, &quic.Config{EnableDatagrams: true, MaxIdleTimeout: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	n := &fakeNode{addr: ln.Addr().String(), accept: accept, authed: make(chan string, 16), conns: make(chan quic.Connection, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			select {
+			case n.conns <- conn:
+			default:
+			}
+			go n.serve(conn)
+		}
+	}()
+	return n
+}
+
+// withGate 让节点在回复鉴权结果前阻塞，直到返回的函数被调用（模拟慢速拨号）
+func (n *fakeNode) withGate() (release func()) {
+	n.gate = make(chan struct{})
+	return func() { close(n.gate) }
+}
+
+func (n *fakeNode) serve(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go n.handle(stream)
+	}
+}
+
+func (n *fakeNode) handle(stream quic.Stream) {
+	defer stream.Close()
+	r := bufio.NewReader(stream)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	token := strings.TrimSpace(line)
+	n.authed <- token
+	if n.gate != nil {
+		<-n.gate
+	}
+	if !slices.Contains(n.accept, token) {
+		stream.CancelRead(0)
+		return
+	}
+	stream.Write([]byte{0x00})
+
+	// 验证指令：[0x00, opPing, nonce(8)] -> [0x00, nonce]
+	req := make([]byte, 10)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return
+	}
+	stream.Write(append([]byte{0x00}, req[2:]...))
+}
+
+// freePort 返回一个当前空闲的本机 TCP 端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"errors"
+
+	"uap-quic/pkg/core"
+)
+
+// SocketProtector 宿主 App 实现的 socket 保护接口（gomobile 导出为 Java interface / ObjC protocol）
+type SocketProtector interface {
+	// Protect 把 fd 排除在 VPN 之外，成功返回 true；返回 false 时放弃本次连接
+	// Android: 调用 VpnService.protect(fd)；iOS: 按需用 IP_BOUND_IF 绑定到物理网卡
+	// 在拨号线程上同步调用，fd 只在调用期间有效，不得保存或关闭
+	Protect(fd int) bool
+}
+
+// socketProtector 由 SetSocketProtector 设置（受 clientLock 保护）
+var socketProtector SocketProtector
+
+// errSocketNotProtected 宿主 App 拒绝保护 socket
+var errSocketNotProtected = errors.New("宿主 App 未能把 socket 排除在 VPN 之外")
+
+// SetSocketProtector 注册 socket 保护回调（传 nil 取消注册）
+// 在 VPN 内运行（包模式，见 StartTun）时必须设置：连接节点使用的 UDP socket 在拨号前交给回调排除在 VPN 之外，避免流量回环
+// 可在 Start 前后任意时刻调用，对所有实例（见 StartInstance）之后建立（包括重连）的连接生效
+func SetSocketProtector(p SocketProtector) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	socketProtector = p
+	if client != nil {
+		applySocketProtector(client)
+	}
+	for _, c := range instances {
+		applySocketProtector(c)
+	}
+}
+
+// applySocketProtector 把已注册的保护回调交给客户端（调用方持有 clientLock）
+func applySocketProtector(c *core.Client) {
+	p := socketProtector
+	if p == nil {
+		c.SetSocketProtector(nil)
+		return
+	}
+	c.SetSocketProtector(func(fd int) error {
+		if !p.Protect(fd) {
+			return errSocketNotProtected
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package sdk
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// countingProtector 记录调用次数的 SocketProtector
+type countingProtector struct {
+	calls atomic.Int32
+	allow bool
+}
+
+func (p *countingProtector) Protect(fd int) bool {
+	p.calls.Add(1)
+	return fd >= 0 && p.allow
+}
+
+func TestSetSocketProtector(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+	t.Cleanup(func() {
+		Stop()
+		SetSocketProtector(nil)
+	})
+
+	// 宿主 App 拒绝保护时放弃连接（不是鉴权失败，启动成功后在后台重试）
+	deny := &countingProtector{}
+	SetSocketProtector(deny)
+	if err := StartWithHost("good-token", n.addr, freePort(t), "global", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTunnel(1000); err == nil {
+		t.Fatal("socket 未被保护时隧道验证通过")
+	}
+	if deny.calls.Load() == 0 {
+		t.Fatal("拨号前未调用保护回调")
+	}
+
+	allow := &countingProtector{allow: true}
+	SetSocketProtector(allow)
+	if err := StartWithHost("good-token", n.addr, freePort(t), "global", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTunnel(5000); err != nil {
+		t.Fatalf("隧道验证失败: %v", err)
+	}
+	if allow.calls.Load() == 0 {
+		t.Fatal("拨号前未调用保护回调")
+	}
+}
@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+func TestTestRoute(t *testing.T) {
+	Stop()
+	if got := TestRoute("www.google.com"); got != "" {
+		t.Fatalf("未运行时返回 %q", got)
+	}
+
+	n := startFakeNode(t, "good-token")
+	t.Cleanup(Stop)
+	if err := StartWithHost("good-token", n.addr, freePort(t), "smart", "google.com\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 规则在后台启动客户端时加载，加载完成前按空规则判断
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(TestRoute("www.google.com"), `"reason":"rule"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("规则未加载: %s", TestRoute("www.google.com"))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, tc := range []struct {
+		host, action, reason, rule string
+	}{
+		{"www.google.com", core.RouteProxy, core.RouteReasonRule, "google.com"},
+		{"example.org:443", core.RouteDirect, core.RouteReasonUnmatched, ""},
+		{"127.0.0.1", core.RouteDirect, core.RouteReasonLocal, ""},
+	} {
+		var d core.RouteDecision
+		if err := json.Unmarshal([]byte(TestRoute(tc.host)), &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Action != tc.action || d.Reason != tc.reason || d.Rule != tc.rule || d.Mode != core.ModeSmart {
+			t.Errorf("TestRoute(%q) = %+v，期望 %s / %s / %q", tc.host, d, tc.action, tc.reason, tc.rule)
+		}
+	}
+}
+
+// TestSetRulesFile rules 参数为空时默认实例与独立实例读取 SetRulesFile 设置的文件
+func TestSetRulesFile(t *testing.T) {
+	t.Cleanup(func() {
+		Stop()
+		SetRulesFile("")
+	})
+	SetRulesFile(writeRules(t, "youtube.com\ngoogle.com\n"))
+	if e := effectiveConfig(t)["rules-file"]; e.Value != rulesFile {
+		t.Fatalf("rules-file %+v", e)
+	}
+
+	n := startFakeNode(t, "good-token")
+	if err := StartWithHost("good-token", n.addr, freePort(t), core.ModeSmart, ""); err != nil {
+		t.Fatal(err)
+	}
+	waitRules(t, DefaultInstance, 2)
+	if !strings.Contains(TestRoute("www.youtube.com"), `"rule":"youtube.com"`) {
+		t.Fatalf("规则文件未生效: %s", TestRoute("www.youtube.com"))
+	}
+
+	id, err := StartInstance(n.addr, "good-token", freePort(t), core.ModeSmart, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopInstance(id) })
+	waitRules(t, id, 2)
+
+	// 空字符串恢复默认文件
+	SetRulesFile("")
+	if rulesFile != defaultRulesFile {
+		t.Fatalf("恢复默认后 %q", rulesFile)
+	}
+}
@@ -1,59 +1,671 @@
 package sdk
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"uap-quic/pkg/core"
+	"uap-quic/pkg/router"
+	"uap-quic/pkg/sockbuf"
+	"uap-quic/pkg/window"
 )
 
 var (
-	client     *core.Client
-	clientLock sync.Mutex
+	client        *core.Client
+	clientLock    sync.Mutex
+	preSharedKey  string // 预共享密钥（由 SetPSK 设置，Start 时生效）
+	killSwitch    bool   // kill switch 开关（由 SetKillSwitch 设置）
+	unmatched     string // 未命中规则策略（由 SetUnmatchedPolicy 设置，空表示默认直连）
+	udpOverStream bool   // UDP 强制走 Stream（由 SetUDPOverStream 设置）
+	compression   bool   // TCP 流压缩（由 SetCompression 设置）
+	preferFamily  string // 域名目标的地址族偏好（由 SetPreferFamily 设置，空表示默认 auto）
+	maxUDPPayload int    // UDP 单包载荷上限（由 SetMaxUDPPayload 设置）
+	udpFallback   bool   // 超限 UDP 包回退到 Stream（由 SetUDPOversizeFallback 设置）
+	udpMetrics    bool   // UDP 会话统计（由 SetUDPMetrics 设置）
+	activitySize  int    // 最近活动保留条数（由 SetActivityLog 设置，0 表示关闭）
+	activityHide  bool   // 最近活动不记录主机（由 SetActivityLog 设置）
+	signedAuth    bool   // 签名握手（由 SetSignedHandshake 设置）
+	walletKey     string // 本地钱包私钥 Hex（由 SetWalletKey 设置）
+
+	flowWindows    = window.Default      // QUIC 接收窗口（由 SetFlowWindows 设置）
+	warmup         *core.WarmupConfig    // 建立连接后的预热请求（由 SetWarmup 设置，nil 表示关闭）
+	streamPriority *core.StreamPriority  // 隧道内的流优先级（由 SetStreamPriority 设置，nil 表示关闭）
+	udpBuffers     sockbuf.Config        // 连接节点的 UDP socket 缓冲区（由 SetUDPBuffers 设置）
+	dnsServer      *core.DNSServerConfig // 本地 DNS 服务（由 SetDNSServer 设置，nil 表示关闭）
+
+	connectTimeout = core.DefaultConnectTimeout // 等待节点回复连接结果的时长（由 SetConnectTimeout 设置）
+	idleTimeout    = core.DefaultIdleTimeout    // QUIC 连接的空闲超时（由 SetIdleTimeout 设置）
+
+	gatewayHost      = core.DefaultListenHost // SOCKS5 监听地址（由 SetGateway 设置）
+	gatewayAdvertise string                   // UDP 关联回复中通告的地址（由 SetGateway 设置）
+
+	selectTolerance  = core.DefaultSelectTolerance // 选路容差（由 SetSelectTolerance 设置）
+	stickyNode       bool                          // 粘性选路（由 SetStickyNode 设置）
+	stickyMaxLatency = defaultStickyMaxLatency     // 固定节点可接受的最大延迟（由 SetStickyNode 设置）
+	pingConcurrency  = core.DefaultPingConcurrency // 测速并发数（由 SetPingConcurrency 设置）
+	pingGoodLatency  time.Duration                 // 测速提前结束的延迟阈值（由 SetPingEarlyExit 设置）
+	pingGoodCount    int                           // 测速提前结束所需的节点数（由 SetPingEarlyExit 设置）
+	pingJitter       time.Duration                 // 测速错开范围（由 SetPingJitter 设置，0 为默认值）
+
+	hosts *router.Hosts // hosts 覆盖表（由 SetHosts 设置）
+
+	rulesURL     string        // 远程规则列表地址（由 SetRulesURL 设置）
+	rulesRefresh time.Duration // 远程规则列表刷新间隔（由 SetRulesURL 设置）
+	rulesCache   string        // 远程规则列表缓存文件（由 SetRulesURL 设置）
+
+	rulesFile = defaultRulesFile // 本地规则文件（由 SetRulesFile 设置，Start 的 rules 参数为空时使用）
 )
 
+// defaultRulesFile 默认的本地规则文件（相对于进程工作目录，移动端通常不存在，见 SetRulesFile）
+const defaultRulesFile = "whitelist.txt"
+
+// Version 返回 SDK 版本号（每个发往管理后台的请求都会携带该版本号）
+func Version() string {
+	return core.Version
+}
+
+// SetSelectTolerance 设置自动选路的延迟容差（毫秒）
+// 按节点质量评分修正后的延迟与最优节点相差在容差内的节点按运营方下发的权重挑选；0 表示只看修正后的延迟，负数恢复默认值（30ms）
+// 在 Start 之前调用，下次启动时生效
+func SetSelectTolerance(ms int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if ms < 0 {
+		selectTolerance = core.DefaultSelectTolerance
+		return
+	}
+	selectTolerance = time.Duration(ms) * time.Millisecond
+}
+
+// SetStickyNode 开启/关闭粘性选路：每次启动优先连接上次使用的节点，出口 IP 保持稳定（避免被网站判定为异常登录）
+// 固定节点由管理后台记录，节点不健康时自动失效；测速延迟超过 maxLatencyMs 时本次改为正常选路
+// （并固定到新节点）。maxLatencyMs <= 0 使用默认值（200ms）。在 Start 之前调用，下次启动时生效
+func SetStickyNode(enabled bool, maxLatencyMs int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	stickyNode = enabled
+	if maxLatencyMs <= 0 {
+		stickyMaxLatency = defaultStickyMaxLatency
+		return
+	}
+	stickyMaxLatency = time.Duration(maxLatencyMs) * time.Millisecond
+}
+
+// SetPingConcurrency 设置自动选路测速的并发数（同时进行的 TCP 拨号上限）
+// <= 0 恢复默认值（20）；在 Start 之前调用，下次启动时生效
+func SetPingConcurrency(n int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if n <= 0 {
+		n = core.DefaultPingConcurrency
+	}
+	pingConcurrency = n
+}
+
+// SetPingEarlyExit 设置自动选路测速的提前结束条件：已有 count 个节点的延迟不超过 goodLatencyMs 时放弃其余节点的测速，
+// 节点很多时缩短启动时间（未测速的节点不参与本次选路）。任一参数 <= 0 表示测完所有节点（默认）
+// 在 Start 之前调用，下次启动时生效
+func SetPingEarlyExit(goodLatencyMs int, count int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if goodLatencyMs <= 0 || count <= 0 {
+		pingGoodLatency, pingGoodCount = 0, 0
+		return
+	}
+	pingGoodLatency = time.Duration(goodLatencyMs) * time.Millisecond
+	pingGoodCount = count
+}
+
+// SetPingJitter 设置自动选路测速的错开范围：各节点的拨号在 [0, jitterMs) 毫秒内随机延后开始，
+// 避免大量 App 同时启动时集中涌向节点，启动时间最多增加 jitterMs。0 恢复默认值（300ms），< 0 不错开
+// 在 Start 之前调用，下次启动时生效
+func SetPingJitter(jitterMs int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	pingJitter = time.Duration(jitterMs) * time.Millisecond
+}
+
+// SetKillSwitch 开启/关闭 kill switch（隐私模式）
+// 开启后隧道断开或重连期间，应走代理的连接会被直接拒绝而不是泄露到本机网络；智能模式下规则内的直连不受影响
+// 可在运行中切换，立即生效
+func SetKillSwitch(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	killSwitch = enabled
+	if client != nil {
+		client.SetKillSwitch(enabled)
+	}
+}
+
+// SetUnmatchedPolicy 设置 smart 模式下未命中规则的目标（新域名、IP 地址）的处理方式
+// "direct"（默认）直连；"proxy" 走代理（隧道不可用时受 kill switch 约束）；"block" 拒绝
+// 可在运行中切换，对之后新建的连接生效
+func SetUnmatchedPolicy(policy string) error {
+	if err := core.CheckUnmatchedPolicy(policy); err != nil {
+		return err
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	unmatched = policy
+	if client != nil {
+		client.SetUnmatchedPolicy(policy)
+	}
+	return nil
+}
+
+// SetUDPOverStream 强制 UDP 使用可靠流传输（适用于丢弃 QUIC Datagram 的网络）
+// 关闭时自动协商：服务端支持 Datagram 时使用 Datagram，否则回退到流传输
+// 可在运行中切换，对之后新建的 UDP 关联生效
+func SetUDPOverStream(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	udpOverStream = enabled
+	if client != nil {
+		client.SetUDPOverStream(enabled)
+	}
+}
+
+// SetCompression 开启/关闭 TCP 流压缩（需服务端支持，不支持时自动按未压缩传输）
+// 适合网页、API 等文本为主的流量和按流量计费的移动网络；HTTPS 等已加密流量不会被压缩
+// 可在运行中切换，对之后新建的 TCP 连接生效
+func SetCompression(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	compression = enabled
+	if client != nil {
+		client.SetCompression(enabled)
+	}
+}
+
+// SetPreferFamily 设置隧道内域名目标优先连接的地址族："auto"（默认）/ "ipv4" / "ipv6"
+// 由服务端解析域名，偏好的地址族连接失败时再试另一个；需服务端支持，旧版服务端忽略
+// 可在运行中切换，对之后新建的 TCP 连接生效
+func SetPreferFamily(family string) error {
+	if err := core.CheckPreferFamily(family); err != nil {
+		return err
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	preferFamily = family
+	if client != nil {
+		client.SetPreferFamily(family)
+	}
+	return nil
+}
+
+// SetMaxUDPPayload 设置 UDP 单包载荷上限（字节，不含 SOCKS5 头部），<= 0 表示只受传输方式限制
+// 超出上限的包在本地丢弃（计入 GetStats 的 udp_oversize_dropped）；可在运行中切换，立即生效
+func SetMaxUDPPayload(n int) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	maxUDPPayload = n
+	if client != nil {
+		client.SetMaxUDPPayload(n)
+	}
+}
+
+// SetUDPOversizeFallback 设置超出 Datagram 上限（1187 字节）的 UDP 包的处理方式
+// false（默认）丢弃；true 把该 UDP 关联切换为 Stream 传输（可承载大包，但有队头阻塞）
+// 可在运行中切换，对之后出现的超限包生效
+func SetUDPOversizeFallback(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	udpFallback = enabled
+	if client != nil {
+		client.SetUDPOversizeFallback(enabled)
+	}
+}
+
+// SetUDPMetrics 开启/关闭 UDP 会话统计（默认关闭）
+// 开启后每个 UDP 会话按方向统计包间隔、抖动与疑似重复包，在 GetStatsJSON 的 udp_sessions 中返回（诊断包同样包含），
+// 用于判断游戏卡顿是否由隧道引起；只观察，不会丢弃或重排任何包。可在运行中切换，对之后建立的会话生效
+func SetUDPMetrics(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	udpMetrics = enabled
+	if client != nil {
+		client.SetUDPMetrics(enabled)
+	}
+}
+
+// SetActivityLog 开启/关闭最近活动（size: 保留条数，<= 0 关闭，默认关闭）
+// 开启后每条连接结束时记录 {time, host, port, action, reason, rule, bytes, duration_ms}，可用 GetRecentActivityJSON 轮询，
+// 或在 EventListener.OnActivity 中实时接收（连接过多、回调处理不过来时丢弃最旧的未投递记录）；
+// hideHosts 为 true 时不记录主机与规则，只保留端口、分流动作与字节数。可在运行中切换
+func SetActivityLog(size int, hideHosts bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	activitySize, activityHide = max(size, 0), hideHosts
+	if client != nil {
+		client.SetActivityLog(activitySize, hideHosts)
+	}
+}
+
+// SetFlowWindows 设置 QUIC 接收窗口（KB，<= 0 的项取默认值：单流 2048/6144，连接 6144/15360）
+// 吞吐上限约为 窗口 / RTT：大文件下载可调大最大窗口，慢速移动网络调小可减少排队延迟（交互流量更灵敏）
+// 配置不合法时返回错误并保留当前设置；对之后建立的 QUIC 连接生效（运行中设置时在下次重连后生效）
+func SetFlowWindows(initialStreamKB int, maxStreamKB int, initialConnKB int, maxConnKB int) error {
+	w := window.FromKB(initialStreamKB, maxStreamKB, initialConnKB, maxConnKB)
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	flowWindows = w
+	if client != nil {
+		client.SetFlowWindows(w)
+	}
+	return nil
+}
+
+// SetUDPBuffers 设置连接节点的 UDP socket 收发缓冲区（KB，<= 0 的项保持系统默认）
+// 下行吞吐高时系统默认的接收缓冲区容易被打满丢包（表现为重传增多）；移动端系统通常有上限，请求与实际授予的大小记录在日志中。
+// 对之后建立的 QUIC 连接生效（运行中设置时在下次重连后生效）
+func SetUDPBuffers(recvKB int, sendKB int) {
+	b := sockbuf.FromKB(recvKB, sendKB)
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	udpBuffers = b
+	if client != nil {
+		client.SetUDPBuffers(b)
+	}
+}
+
+// SetConnectTimeout 设置发出目标地址后等待节点回复连接结果的时长（毫秒，<= 0 恢复默认 30000）
+// 超时后应用收到 SOCKS5 0x04（主机不可达），浏览器可立即报错或重试，而不是一直转圈；不影响 QUIC 握手与鉴权。
+// 可在运行中设置，对之后建立的连接生效
+func SetConnectTimeout(timeoutMs int) {
+	d := time.Duration(timeoutMs) * time.Millisecond
+	if d <= 0 {
+		d = core.DefaultConnectTimeout
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	connectTimeout = d
+	if client != nil {
+		client.SetConnectTimeout(d)
+	}
+}
+
+// SetIdleTimeout 设置 QUIC 连接的空闲超时（秒，<= 0 恢复默认 45，最小 5）
+// 网络中断（没有任何回包）后最迟在空闲超时加一个保活间隔内判定断开并开始重连，同时收到 Disconnected / Reconnecting 事件；
+// 保活间隔为其 1/3（最长 10 秒），默认设置下最迟约 55 秒。可在运行中设置，对之后建立的连接生效
+func SetIdleTimeout(seconds int) {
+	d := time.Duration(seconds) * time.Second
+	if d <= 0 {
+		d = core.DefaultIdleTimeout
+	}
+	d = max(d, core.MinIdleTimeout)
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	idleTimeout = d
+	if client != nil {
+		client.SetIdleTimeout(d)
+	}
+}
+
+// SetWarmup 开启/关闭建立连接后的预热请求（默认关闭）
+// 开启后每次建立连接，鉴权完成后等待 minDelayMs-maxDelayMs 毫秒内的随机时间，向节点请求 minBytes-maxBytes 字节内的随机数据，
+// 模拟打开页面时的首次请求，避免部分网络把握手后长时间静默的 QUIC 连接降级；<= 0 的项取默认值（2048-24576 字节，0-300ms）。
+// 预热流量只计入 GetStatsJSON 的 warmup，不计入其他统计；需节点支持，旧版节点自动跳过。
+// 配置不合法时返回错误并保留当前设置；对之后建立的连接生效
+func SetWarmup(enabled bool, minBytes int, maxBytes int, minDelayMs int, maxDelayMs int) error {
+	var w *core.WarmupConfig
+	if enabled {
+		cfg := core.WarmupConfig{
+			MinBytes: max(minBytes, 0),
+			MaxBytes: max(maxBytes, 0),
+			MinDelay: time.Duration(max(minDelayMs, 0)) * time.Millisecond,
+			MaxDelay: time.Duration(max(maxDelayMs, 0)) * time.Millisecond,
+		}.WithDefaults()
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		w = &cfg
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	warmup = w
+	if client != nil {
+		client.SetWarmup(w)
+	}
+	return nil
+}
+
+// SetDNSServer 开启/关闭本地 DNS 服务（listen 为空字符串时关闭，默认关闭）
+// listen 为监听地址 host:port（同时监听 UDP 与 TCP），把系统或局域网设备的 DNS 指向它后分流规则按域名生效：
+// 走代理的域名经隧道在节点侧解析（tunnel 为节点侧使用的 DNS，空字符串为 8.8.8.8:53），其余转发给 upstream（IP:端口）；
+// 移动端没有 /etc/resolv.conf，必须指定 upstream。包模式下本地应答与假 IP 自动启用，不需要监听（见 StartTun）
+// 配置不合法时返回错误并保留当前设置；在 Start 之前调用，下次启动时生效
+func SetDNSServer(listen string, upstream string, tunnel string) error {
+	var d *core.DNSServerConfig
+	if listen != "" {
+		cfg, err := core.DNSServerConfig{Listen: listen, Upstream: upstream, Tunnel: tunnel}.WithDefaults()
+		if err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		d = &cfg
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	dnsServer = d
+	return nil
+}
+
+// SetStreamPriority 开启/关闭隧道内的流优先级（默认关闭）
+// 开启后同一条隧道上的交互流量（网页、API 请求）优先于大流量发出：规则标签为 bulk、目标端口在 bulkPorts（逗号分隔，如 "21,873"）中，
+// 或上行超过 bulkAfterKB 的连接按大流量处理，分片写入并在交互流量待发送时短暂让路；标签为 game 的连接不会降级。
+// bulkAfterKB 为 0 取默认值 1024，负数表示不按流量降级。只作用于上行，下行需节点开启 -stream-priority。
+// 端口列表格式错误时返回错误并保留当前设置；对之后建立的连接生效
+func SetStreamPriority(enabled bool, bulkAfterKB int, bulkPorts string) error {
+	var p *core.StreamPriority
+	if enabled {
+		ports, err := core.ParseBulkPorts(bulkPorts)
+		if err != nil {
+			return err
+		}
+		after := int64(bulkAfterKB) << 10
+		if bulkAfterKB < 0 {
+			after = -1
+		}
+		p = &core.StreamPriority{BulkAfter: after, BulkPorts: ports}
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	streamPriority = p
+	if client != nil {
+		client.SetStreamPriority(p)
+	}
+	return nil
+}
+
+// GetMaxUDPPayload 返回当前生效的 UDP 单包载荷上限（字节，IPv4 目标），供界面提示游戏等应用的包大小限制
+// 未启动时按 Datagram 传输与 SetMaxUDPPayload 的设置计算
+func GetMaxUDPPayload() int {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	if client != nil {
+		return client.MaxUDPPayload()
+	}
+	if maxUDPPayload > 0 && maxUDPPayload < core.MaxDatagramUDPPayload {
+		return maxUDPPayload
+	}
+	return core.MaxDatagramUDPPayload
+}
+
+// SetHosts 设置 hosts 覆盖（hosts 文件格式：每行 "IP 域名 [域名...]"，支持 *.example.com 通配子域名，空字符串表示清除）
+// 命中的域名仍按原域名分流，走代理时隧道中发送覆盖 IP，直连时直接连接覆盖 IP，分流日志中会注明命中的条目
+// 可在运行中替换，对之后新建的连接生效；格式错误时返回错误并保留当前覆盖
+func SetHosts(text string) error {
+	h, err := router.ParseHosts(text)
+	if err != nil {
+		return err
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	hosts = h
+	if client != nil {
+		client.SetHosts(h)
+	}
+	return nil
+}
+
+// SetRulesURL 设置远程规则列表（HTTPS 地址，空字符串表示只使用本地规则）：启动后下载并每隔 refreshMinutes 分钟刷新，
+// 下载成功且校验通过时整体替换规则，失败时继续使用当前规则。refreshMinutes <= 0 使用默认值（60 分钟）
+// cachePath 为 App 可写目录下的文件路径（为空不缓存），保存最近一次可用的列表，下次启动先加载
+// 在 Start 之前调用，下次启动时生效
+func SetRulesURL(url string, refreshMinutes int, cachePath string) error {
+	if url != "" {
+		if err := router.CheckRulesURL(url); err != nil {
+			return err
+		}
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	rulesURL, rulesRefresh, rulesCache = url, time.Duration(refreshMinutes)*time.Minute, cachePath
+	return nil
+}
+
+// SetRulesFile 设置本地规则文件路径（App 可读的绝对路径，如随安装包分发、复制到沙盒内的 whitelist.txt）
+// Start / StartWithHost 的 rules 参数为空时读取该文件，不为空时直接使用 rules 的内容；空字符串恢复默认的 whitelist.txt
+// 文件不存在或没有任何规则时日志中会明确提示（smart 模式下所有目标按未命中规则处理）。在 Start 之前调用，下次启动时生效
+func SetRulesFile(path string) {
+	if path == "" {
+		path = defaultRulesFile
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	rulesFile = path
+}
+
+// SetGateway 设置网关模式：SOCKS5 代理监听在 listenHost（IP，空字符串恢复默认的 127.0.0.1），供局域网内其他设备使用
+// advertiseAddr 为 UDP 关联回复中告知应用的地址（IP 或域名），空字符串表示使用应用连接到的本机地址
+// 代理不需要认证，只应在可信网络中开启；在 Start 之前调用，下次启动时生效
+func SetGateway(listenHost string, advertiseAddr string) error {
+	host, err := core.ParseListenHost(listenHost)
+	if err != nil {
+		return err
+	}
+	if err := core.CheckAdvertiseAddr(advertiseAddr); err != nil {
+		return err
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	gatewayHost, gatewayAdvertise = host, advertiseAddr
+	return nil
+}
+
+// SetPSK 设置预共享密钥（需与服务端 -psk 一致，空字符串表示不启用）
+// 在 Start / StartWithHost 之前调用，下次启动时生效
+func SetPSK(psk string) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	preSharedKey = psk
+}
+
+// SetSignedHandshake 开启/关闭签名握手（需节点支持）
+// 开启后连接票据绑定账户钱包，握手时附带钱包签名；没有本地私钥时由 uap-admin 用托管钱包代为签名
+// 只对 Start 生效（StartWithHost 不申请票据）；在 Start 之前调用，下次启动时生效
+func SetSignedHandshake(enabled bool) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	signedAuth = enabled
+}
+
+// SetWalletKey 设置本地钱包私钥（Hex 编码的 64 字节私钥或 32 字节种子，空字符串表示清除）
+// 自托管钱包开启签名握手时必须设置；在 Start 之前调用，下次启动时生效
+func SetWalletKey(privateKeyHex string) error {
+	if privateKeyHex != "" {
+		if _, err := core.ParseWalletKey(privateKeyHex); err != nil {
+			return err
+		}
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	walletKey = privateKeyHex
+	return nil
+}
+
 // StartWithHost 初始化并启动 VPN 核心（指定服务器地址版本）
 // token: 鉴权密钥
 // host: 服务器地址 (e.g., "uap.example.com:443")
 // port: 本地 SOCKS5 监听端口 (e.g., 1080)
 // mode: 代理模式 ("smart" 或 "global")
-// rules: 路由规则字符串 (换行符分隔，空字符串表示使用默认文件)
+// rules: 路由规则字符串 (换行符分隔，格式与 whitelist.txt 相同；空字符串表示读取 SetRulesFile 设置的文件)
 func StartWithHost(token string, host string, port int, mode string, rules string) error {
 	clientLock.Lock()
-	defer clientLock.Unlock()
-
 	// 如果已经启动，先停止
+	stopTunLocked()
 	if client != nil {
 		client.Stop()
 		client = nil
 	}
+	if err := checkPortLocked(port); err != nil {
+		clientLock.Unlock()
+		return err
+	}
+
+	// 指定节点，不选路
+	recordSelection(newSelectionReport(SelectionManual, nil, node{Address: host}, host))
 
 	// 创建客户端实例
-	client = core.NewClient(host, token, port, mode)
+	c := newClient(host, token, port, mode)
+	startGen++
+	gen := startGen
+	clientLock.Unlock()
+
+	// 同步验证隧道：token 被拒时直接返回错误（拨号不持有 clientLock，见 installClient）
+	if err := connectClient(c); err != nil {
+		return err
+	}
+	return installClient(c, gen, rules)
+}
 
-	// 如果提供了规则字符串，写入临时文件
-	whitelistFile := "whitelist.txt"
-	if rules != "" {
-		// 这里可以扩展为写入临时文件，暂时使用默认文件
-		// 实际使用时，可以通过 core.Client 的接口扩展来支持直接传入规则
-		whitelistFile = "whitelist.txt"
+// installClient 登记已完成连接验证的客户端为默认实例，并在 goroutine 中启动（非阻塞）
+// 拨号与验证可能耗时数秒，Start / StartWithHost 不持有 clientLock 进行，期间 IsRunning、GetStatsJSON 等调用不被阻塞；
+// gen 为发起拨号时的启动代次，拨号期间被 Stop 或另一次启动取代时停止 c 并返回 ErrStartCanceled
+func installClient(c *core.Client, gen uint64, rules string) error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if gen != startGen {
+		c.Stop()
+		return ErrStartCanceled
+	}
+	// 拨号期间端口可能已被 StartInstance 占用
+	if err := checkPortLocked(c.LocalPort()); err != nil {
+		c.Stop()
+		return err
 	}
+	client = c
 
-	// 在 goroutine 中启动（非阻塞）
+	// 提供了规则字符串时直接加载到内存，否则读取本地规则文件（见 SetRulesFile）
+	c.SetRules(rules)
+	whitelistFile := rulesFile
 	go func() {
-		if err := client.Start(whitelistFile); err != nil {
+		if err := c.Start(whitelistFile); err != nil {
 			log.Printf("❌ SDK 启动失败: %v", err)
 		}
 	}()
+	return nil
+}
+
+// newClient 创建客户端并应用通过 Set* 设置的配置（调用方持有 clientLock）
+func newClient(host string, token string, port int, mode string) *core.Client {
+	c := core.NewClient(host, token, port, mode)
+	c.SetEventHandler(connectionEvents(DefaultInstance))
+	c.SetActivityHandler(activityEvents(DefaultInstance))
+	c.SetActivityLog(activitySize, activityHide)
+	applyCapture(c)
+	applySocketProtector(c)
+	c.SetHosts(hosts)
+	c.SetListenHost(gatewayHost)
+	c.SetAdvertiseAddr(gatewayAdvertise)
+	c.SetPSK(preSharedKey)
+	c.SetKillSwitch(killSwitch)
+	if unmatched != "" {
+		c.SetUnmatchedPolicy(unmatched)
+	}
+	c.SetUDPOverStream(udpOverStream)
+	c.SetCompression(compression)
+	if preferFamily != "" {
+		c.SetPreferFamily(preferFamily)
+	}
+	c.SetMaxUDPPayload(maxUDPPayload)
+	c.SetUDPOversizeFallback(udpFallback)
+	c.SetUDPMetrics(udpMetrics)
+	c.SetRulesURL(rulesURL, rulesRefresh, rulesCache)
+	c.SetFlowWindows(flowWindows)
+	c.SetWarmup(warmup)
+	c.SetStreamPriority(streamPriority)
+	c.SetUDPBuffers(udpBuffers)
+	c.SetConnectTimeout(connectTimeout)
+	c.SetIdleTimeout(idleTimeout)
+	c.SetDNSServer(dnsServer)
+	return c
+}
 
+// connectClient 建立连接并验证隧道（Start 时同步调用）
+// 鉴权被拒时停止客户端并返回错误；网络原因失败只记录日志，由客户端在后台重连
+func connectClient(c *core.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), core.DefaultVerifyTimeout)
+	defer cancel()
+
+	err := c.Connect(ctx)
+	if err == nil {
+		log.Println("✅ 隧道验证通过")
+		return nil
+	}
+	if errors.Is(err, core.ErrAuthRejected) {
+		c.Stop()
+		return fmt.Errorf("节点拒绝了鉴权凭证，请重新登录: %w", err)
+	}
+	log.Printf("⚠️ 隧道验证失败 (后台重试): %v", err)
 	return nil
 }
 
+// CheckTunnel 健康探测：验证当前隧道端到端可用（阻塞，建议在后台线程调用）
+// timeoutMs: 超时（毫秒），<= 0 使用默认值（10 秒）
+// 未运行、连接断开、鉴权被拒或超时时返回错误
+func CheckTunnel(timeoutMs int) error {
+	clientLock.Lock()
+	c := client
+	clientLock.Unlock()
+
+	if c == nil {
+		return fmt.Errorf("VPN 未运行")
+	}
+
+	timeout := core.DefaultVerifyTimeout
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.VerifyTunnel(ctx)
+}
+
+// ErrStartCanceled Start 在选路期间（拉取节点列表、测速）或拨号期间被 Stop 取消
+var ErrStartCanceled = errors.New("启动已取消")
+
+var (
+	startGen        uint64             // 默认实例的启动代次（受 clientLock 保护），每次启动与 Stop 时递增
+	startCancel     context.CancelFunc // 进行中的 Start 选路
+	startCancelLock sync.Mutex
+)
+
+// setStartCancel 登记（或清除）进行中的 Start 选路，清除时同时释放上一个 context
+func setStartCancel(cancel context.CancelFunc) {
+	startCancelLock.Lock()
+	defer startCancelLock.Unlock()
+	if startCancel != nil && cancel == nil {
+		startCancel()
+	}
+	startCancel = cancel
+}
+
 // Stop 停止 VPN 并释放资源
+// 正在选路或拨号的 Start 会被取消并返回 ErrStartCanceled（App 切到后台时不必等待测速完成）
 func Stop() {
+	startCancelLock.Lock()
+	if startCancel != nil {
+		startCancel()
+	}
+	startCancelLock.Unlock()
+
 	clientLock.Lock()
 	defer clientLock.Unlock()
 
+	startGen++ // 正在拨号的 Start 完成后不再登记客户端
+	stopTunLocked()
 	if client != nil {
 		client.Stop()
 		client = nil
@@ -67,3 +679,90 @@ func IsRunning() bool {
 	return client != nil
 }
 
+// GetStatsJSON 获取分流统计（JSON 字符串），附带最近一次启动的选路结果（selection，见 GetLastSelectionJSON）
+// topN: 返回命中次数最多的前 N 条规则（<= 0 表示全部）
+// 返回示例: {"mode":"smart","proxy":12,"direct":30,"blocked":0,"top_rules":[{"rule":"google.com","hits":8}],"selection":{"outcome":"api_ok",...}}
+// 未运行时返回空字符串
+func GetStatsJSON(topN int) string {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if client == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(struct {
+		core.Stats
+		Selection *SelectionReport `json:"selection,omitempty"`
+	}{client.GetStats(topN), selectionReport(client)})
+	if err != nil {
+		log.Printf("❌ 序列化统计失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// GetRecentActivityJSON 获取最近活动（JSON 数组，新的在前，需先用 SetActivityLog 开启），用于界面展示"最近活动"
+// limit: 返回的条数（<= 0 表示全部保留的记录）
+// 返回示例: [{"time":"2025-01-01T12:00:00Z","host":"www.youtube.com","port":443,"action":"proxy","reason":"rule","rule":"youtube.com","bytes":52340,"duration_ms":1830}]
+// 未运行时返回空字符串
+func GetRecentActivityJSON(limit int) string {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if client == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(client.RecentActivity(limit))
+	if err != nil {
+		log.Printf("❌ 序列化最近活动失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// TestRoute 判断访问 host 时的分流结果（不建立连接，不计入规则命中统计），用于"为什么这个网站没走代理"的诊断
+// host: 域名、IP 或 host:port
+// 返回示例: {"host":"www.google.com","mode":"smart","action":"proxy","reason":"rule","rule":"google.com","tunnel_up":true}
+// action 为 proxy / direct / block；reason 为 local（本机地址）/ global（全局模式）/ rule（命中规则）/
+// unmatched（未命中规则，unmatched 字段为生效的策略）/ kill_switch（隧道不可用被拒绝）。未运行时返回空字符串
+func TestRoute(host string) string {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if client == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(client.TestRoute(host))
+	if err != nil {
+		log.Printf("❌ 序列化分流结果失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// SpeedTest 隧道内测速（阻塞，建议在后台线程调用）
+// uploadKB/downloadKB: 上行/下行测试数据量（KB，最多 65536）
+// 返回 JSON: {"upload_bytes":..,"download_bytes":..,"upload_mbps":..,"download_mbps":..,"duration_ms":..}
+func SpeedTest(uploadKB int, downloadKB int) (string, error) {
+	clientLock.Lock()
+	c := client
+	clientLock.Unlock()
+
+	if c == nil {
+		return "", fmt.Errorf("VPN 未运行")
+	}
+
+	result, err := c.SpeedTest(int64(uploadKB)*1024, int64(downloadKB)*1024)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,239 @@
+package sdk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/config"
+	"uap-quic/pkg/core"
+	"uap-quic/pkg/prio"
+)
+
+func TestStartWithHostAuthRejected(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+
+	err := StartWithHost("bad-token", n.addr, freePort(t), "global", "")
+	if !errors.Is(err, core.ErrAuthRejected) {
+		t.Fatalf("鉴权被拒时返回 %v，期望 ErrAuthRejected", err)
+	}
+	if IsRunning() {
+		t.Fatal("鉴权被拒后默认实例仍在运行")
+	}
+}
+
+func TestStartWithHost(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+	t.Cleanup(Stop)
+
+	if err := StartWithHost("good-token", n.addr, freePort(t), "global", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !IsRunning() {
+		t.Fatal("启动成功后默认实例未运行")
+	}
+	if err := CheckTunnel(5000); err != nil {
+		t.Fatalf("隧道验证失败: %v", err)
+	}
+}
+
+func TestStartWithHostDoesNotHoldLock(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+	release := n.withGate()
+	t.Cleanup(Stop)
+
+	done := make(chan error, 1)
+	go func() { done <- StartWithHost("good-token", n.addr, freePort(t), "global", "") }()
+	select {
+	case <-n.authed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("节点未收到鉴权")
+	}
+
+	// 拨号（等待鉴权结果）期间其他接口不被阻塞
+	unblocked := make(chan bool, 1)
+	go func() {
+		running := IsRunning()
+		Stop()
+		unblocked <- running
+	}()
+	select {
+	case running := <-unblocked:
+		if running {
+			t.Fatal("拨号完成前默认实例已登记")
+		}
+	case <-time.After(time.Second):
+		release()
+		t.Fatal("拨号期间 IsRunning / Stop 被阻塞")
+	}
+
+	// 拨号期间已被 Stop 取代，完成后不再登记
+	release()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStartCanceled) {
+			t.Fatalf("被 Stop 取代的启动返回 %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartWithHost 未返回")
+	}
+	if IsRunning() {
+		t.Fatal("被 Stop 取代的启动登记了默认实例")
+	}
+}
+
+func TestSetPingEarlyExit(t *testing.T) {
+	t.Cleanup(func() { SetPingEarlyExit(0, 0) })
+
+	SetPingEarlyExit(80, 3)
+	if pingGoodLatency != 80*time.Millisecond || pingGoodCount != 3 {
+		t.Fatalf("提前结束条件 %v / %d", pingGoodLatency, pingGoodCount)
+	}
+	// 任一参数 <= 0 恢复为测完所有节点
+	SetPingEarlyExit(80, 0)
+	if pingGoodLatency != 0 || pingGoodCount != 0 {
+		t.Fatalf("关闭后的提前结束条件 %v / %d", pingGoodLatency, pingGoodCount)
+	}
+}
+
+func TestSetPingJitter(t *testing.T) {
+	t.Cleanup(func() { SetPingJitter(0) })
+
+	SetPingJitter(150)
+	if pingJitter != 150*time.Millisecond {
+		t.Fatalf("测速错开范围 %v", pingJitter)
+	}
+	if e := effectiveConfig(t)["ping-jitter"]; e.Source != config.SourceAPI || e.Value != "150ms" {
+		t.Fatalf("ping-jitter = %+v", e)
+	}
+	// 0 恢复默认值，< 0 不错开（原样传给 PingOptions）
+	SetPingJitter(-1)
+	if pingJitter >= 0 {
+		t.Fatalf("不错开时 %v", pingJitter)
+	}
+	SetPingJitter(0)
+	if e := effectiveConfig(t)["ping-jitter"]; pingJitter != 0 || e.Source != config.SourceDefault {
+		t.Fatalf("恢复默认后 %v / %+v", pingJitter, e)
+	}
+}
+
+func TestSetConnectTimeout(t *testing.T) {
+	t.Cleanup(func() { SetConnectTimeout(0) })
+
+	SetConnectTimeout(1500)
+	if connectTimeout != 1500*time.Millisecond {
+		t.Fatalf("连接结果等待时长 %v", connectTimeout)
+	}
+	c := newClient("127.0.0.1:1", "token", 1080, core.ModeGlobal)
+	defer c.Stop()
+	if got := c.ConnectTimeout(); got != 1500*time.Millisecond {
+		t.Fatalf("新客户端的连接结果等待时长 %v", got)
+	}
+	// <= 0 恢复默认
+	SetConnectTimeout(-1)
+	if connectTimeout != core.DefaultConnectTimeout {
+		t.Fatalf("恢复默认后 %v", connectTimeout)
+	}
+}
+
+func TestSetIdleTimeout(t *testing.T) {
+	t.Cleanup(func() { SetIdleTimeout(0) })
+
+	SetIdleTimeout(20)
+	if e := effectiveConfig(t)["idle-timeout"]; idleTimeout != 20*time.Second || e.Source != config.SourceAPI || e.Value != "20s" {
+		t.Fatalf("空闲超时 %v / %+v", idleTimeout, e)
+	}
+	c := newClient("127.0.0.1:1", "token", 1080, core.ModeGlobal)
+	defer c.Stop()
+	if got := c.IdleTimeout(); got != 20*time.Second {
+		t.Fatalf("新客户端的空闲超时 %v", got)
+	}
+	// 最小 5 秒，<= 0 恢复默认
+	SetIdleTimeout(1)
+	if idleTimeout != core.MinIdleTimeout {
+		t.Fatalf("低于下限时 %v", idleTimeout)
+	}
+	SetIdleTimeout(0)
+	if e := effectiveConfig(t)["idle-timeout"]; idleTimeout != core.DefaultIdleTimeout || e.Source != config.SourceDefault {
+		t.Fatalf("恢复默认后 %v / %+v", idleTimeout, e)
+	}
+}
+
+func TestSetStreamPriority(t *testing.T) {
+	t.Cleanup(func() { SetStreamPriority(false, 0, "") })
+
+	if err := SetStreamPriority(true, 64, "21, 873"); err != nil {
+		t.Fatal(err)
+	}
+	if streamPriority == nil || streamPriority.BulkAfter != 64<<10 || len(streamPriority.BulkPorts) != 2 {
+		t.Fatalf("流优先级 %+v", streamPriority)
+	}
+	if e := effectiveConfig(t)["stream-priority"]; e.Source != config.SourceAPI {
+		t.Fatalf("stream-priority = %+v", e)
+	}
+	c := newClient("127.0.0.1:1", "token", 1080, core.ModeGlobal)
+	defer c.Stop()
+	if p := c.StreamPriority(); p == nil || p.BulkAfter != 64<<10 || p.BulkPorts[1] != 873 {
+		t.Fatalf("新客户端的流优先级 %+v", p)
+	}
+
+	// 端口列表格式错误时返回错误并保留当前设置
+	if err := SetStreamPriority(true, 0, "21,abc"); err == nil || streamPriority == nil || streamPriority.BulkAfter != 64<<10 {
+		t.Fatalf("格式错误: %v / %+v", err, streamPriority)
+	}
+	// 0 取默认阈值，负数不按流量降级
+	SetStreamPriority(true, 0, "")
+	d := newClient("127.0.0.1:1", "token", 1080, core.ModeGlobal)
+	defer d.Stop()
+	if p := d.StreamPriority(); p.BulkAfter != prio.DefaultBulkAfter {
+		t.Fatalf("默认阈值 %+v", p)
+	}
+	SetStreamPriority(true, -1, "")
+	if streamPriority.BulkAfter != -1 {
+		t.Fatalf("不按流量降级时 %+v", streamPriority)
+	}
+	SetStreamPriority(false, 0, "")
+	if e := effectiveConfig(t)["stream-priority"]; streamPriority != nil || e.Source != config.SourceDefault {
+		t.Fatalf("关闭后 %+v / %+v", streamPriority, e)
+	}
+}
+
+func TestSetWarmup(t *testing.T) {
+	t.Cleanup(func() {
+		Stop()
+		SetWarmup(false, 0, 0, 0, 0)
+	})
+
+	// <= 0 的项取默认值
+	if err := SetWarmup(true, 0, -1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if warmup == nil || *warmup != core.DefaultWarmup {
+		t.Fatalf("预热配置 %+v", warmup)
+	}
+	// 不合法时保留当前设置
+	if err := SetWarmup(true, 100, 10, 0, 0); err == nil || *warmup != core.DefaultWarmup {
+		t.Fatalf("不合法的配置: %v，当前 %+v", err, warmup)
+	}
+
+	// 运行中切换立即应用到当前客户端
+	n := startFakeNode(t, "good-token")
+	if err := StartWithHost("good-token", n.addr, freePort(t), core.ModeGlobal, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetWarmup(true, 1000, 2000, 10, 20); err != nil {
+		t.Fatal(err)
+	}
+	want := core.WarmupConfig{MinBytes: 1000, MaxBytes: 2000, MinDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond}
+	current := func() *core.WarmupConfig {
+		clientLock.Lock()
+		defer clientLock.Unlock()
+		return client.Warmup()
+	}
+	if got := current(); got == nil || *got != want {
+		t.Fatalf("运行中的预热配置 %+v", got)
+	}
+	if SetWarmup(false, 0, 0, 0, 0); warmup != nil || current() != nil {
+		t.Fatal("关闭后仍有预热配置")
+	}
+}
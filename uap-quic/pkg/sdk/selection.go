@@ -0,0 +1,142 @@
+package sdk
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// 选路结果
+const (
+	SelectionAPIOK          = "api_ok"           // 从管理后台获取节点列表并测速选路
+	SelectionAPIFailed      = "api_failed"       // 节点列表获取失败（或为空），使用备用节点
+	SelectionAllPingsFailed = "all_pings_failed" // 所有节点测速失败，使用备用节点
+	SelectionManual         = "manual"           // StartWithHost 指定节点，未选路
+)
+
+// SelectionCandidate 参与选路的节点
+type SelectionCandidate struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	LatencyMs int    `json:"latency_ms"` // 测速延迟（毫秒），-1 表示超时/失败或未测速
+	Score     int    `json:"score"`      // 管理后台下发的质量评分
+	Weight    int    `json:"weight"`     // 运营方设置的选路权重
+	Pinned    bool   `json:"pinned,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"` // 测速提前结束，该节点未测速
+}
+
+// SelectionReport 最近一次启动的选路结果，用于排查"连到了错误地区的节点"一类问题
+type SelectionReport struct {
+	Outcome    string               `json:"outcome"`         // SelectionAPIOK / SelectionAPIFailed / SelectionAllPingsFailed / SelectionManual
+	Error      string               `json:"error,omitempty"` // 节点列表获取失败的原因（api_failed）
+	Node       string               `json:"node,omitempty"`  // 选中节点名称（使用备用节点时为空）
+	Address    string               `json:"address"`         // 实际连接的节点地址
+	Fallback   bool                 `json:"fallback"`        // 是否使用了内置备用节点
+	Sticky     bool                 `json:"sticky"`          // 是否使用了粘性选路的固定节点
+	Candidates []SelectionCandidate `json:"candidates"`      // 参与选路的节点（按修正延迟排序）
+	SelectedAt int64                `json:"selected_at"`     // 选路完成时间（Unix 秒）
+
+	Failure *core.NodeFailure `json:"failure,omitempty"` // 连接该节点尚未恢复的失败（握手失败或鉴权被拒的原因，见 core.NodeFail*）
+}
+
+var (
+	lastSelection     *SelectionReport
+	lastSelectionLock sync.Mutex
+)
+
+// newSelectionReport 汇总选路结果（nodes 为测速排序后的节点列表）
+func newSelectionReport(outcome string, nodes []node, chosen node, address string) *SelectionReport {
+	report := &SelectionReport{
+		Outcome:    outcome,
+		Node:       chosen.Name,
+		Address:    address,
+		Fallback:   address == fallbackNodeAddr && chosen.Address != fallbackNodeAddr,
+		Sticky:     chosen.Pinned,
+		Candidates: make([]SelectionCandidate, 0, len(nodes)),
+		SelectedAt: time.Now().Unix(),
+	}
+	for _, n := range nodes {
+		ms := -1
+		if n.Latency != maxLatency {
+			ms = int(n.Latency / time.Millisecond)
+		}
+		report.Candidates = append(report.Candidates, SelectionCandidate{
+			Name:      n.Name,
+			Address:   n.Address,
+			LatencyMs: ms,
+			Score:     core.NodeScore(n),
+			Weight:    core.NodeWeight(n),
+			Pinned:    n.Pinned,
+			Skipped:   !n.Probed,
+		})
+	}
+	return report
+}
+
+// recordSelection 保存选路结果并通知宿主 App（回调在新的 goroutine 中触发，避免在持有 clientLock 时回调）
+func recordSelection(report *SelectionReport) {
+	lastSelectionLock.Lock()
+	lastSelection = report
+	lastSelectionLock.Unlock()
+
+	if report.Fallback {
+		log.Printf("⚠️  选路结果: %s，使用备用节点 %s", report.Outcome, report.Address)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	go dispatchNodeSelected(string(data))
+}
+
+// lastSelectionReport 最近一次选路结果（从未启动时为 nil）
+func lastSelectionReport() *SelectionReport {
+	lastSelectionLock.Lock()
+	defer lastSelectionLock.Unlock()
+	return lastSelection
+}
+
+// setSelectionFailure 记录连接选中节点的失败（Start 验证隧道之后调用，停止运行后仍可查询）
+func setSelectionFailure(failure *core.NodeFailure) {
+	lastSelectionLock.Lock()
+	defer lastSelectionLock.Unlock()
+	if lastSelection != nil {
+		copied := *lastSelection
+		copied.Failure = failure
+		lastSelection = &copied
+	}
+}
+
+// selectionReport 最近一次选路结果，运行中（c 不为空）时附带所连节点当前的连接失败
+func selectionReport(c *core.Client) *SelectionReport {
+	report := lastSelectionReport()
+	if report == nil || c == nil {
+		return report
+	}
+	copied := *report
+	copied.Failure = c.NodeFailure(report.Address)
+	return &copied
+}
+
+// GetLastSelectionJSON 获取最近一次启动的选路结果（JSON 字符串），从未启动时返回空字符串
+// 连接节点失败时附带失败原因（failure.reason 为 tls-verify / alpn / timeout / dns / auth / other）
+// 返回示例: {"outcome":"all_pings_failed","address":"uaptest.org:52222","fallback":true,"sticky":false,
+// "candidates":[{"name":"🇯🇵 东京-01","address":"jp1.example.com:443","latency_ms":-1,"score":100,"weight":100}],"selected_at":1767225600,
+// "failure":{"address":"uaptest.org:52222","reason":"tls-verify","error":"...","failures":1,"last_failure":"2026-01-01T08:00:00+08:00"}}
+func GetLastSelectionJSON() string {
+	clientLock.Lock()
+	report := selectionReport(client)
+	clientLock.Unlock()
+	if report == nil {
+		return ""
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("❌ 序列化选路结果失败: %v", err)
+		return ""
+	}
+	return string(data)
+}
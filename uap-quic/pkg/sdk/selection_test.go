@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"uap-quic/pkg/core"
+)
+
+// selectionListener 记录 OnNodeSelected 的 EventListener
+type selectionListener struct {
+	selected chan string
+}
+
+func (l *selectionListener) OnQuotaWarning(int)               {}
+func (l *selectionListener) OnUpgradeRequired(string, string) {}
+func (l *selectionListener) OnConnectionEvent(string, string) {}
+func (l *selectionListener) OnActivity(string)                {}
+func (l *selectionListener) OnNodeSelected(reportJSON string) { l.selected <- reportJSON }
+
+func TestNewSelectionReport(t *testing.T) {
+	score := 80
+	nodes := []node{
+		{Name: "tokyo", Address: "jp.example.com:443", Latency: 40 * time.Millisecond, Probed: true, Score: &score, Weight: 200},
+		{Name: "paris", Address: "fr.example.com:443", Latency: maxLatency, Probed: true},
+		{Name: "lima", Address: "pe.example.com:443", Latency: maxLatency},
+	}
+
+	report := newSelectionReport(SelectionAPIOK, nodes, nodes[0], nodes[0].Address)
+	if report.Outcome != SelectionAPIOK || report.Node != "tokyo" || report.Address != "jp.example.com:443" || report.Fallback {
+		t.Fatalf("选路结果 %+v", report)
+	}
+	want := []SelectionCandidate{
+		{Name: "tokyo", Address: "jp.example.com:443", LatencyMs: 40, Score: 80, Weight: 200},
+		{Name: "paris", Address: "fr.example.com:443", LatencyMs: -1, Score: 100, Weight: 100},
+		{Name: "lima", Address: "pe.example.com:443", LatencyMs: -1, Score: 100, Weight: 100, Skipped: true},
+	}
+	for i, c := range report.Candidates {
+		if c != want[i] {
+			t.Errorf("候选节点 %d: %+v，期望 %+v", i, c, want[i])
+		}
+	}
+
+	// 所有节点测速失败时使用备用节点
+	report = newSelectionReport(SelectionAllPingsFailed, nodes, node{}, fallbackNodeAddr)
+	if !report.Fallback || report.Node != "" || len(report.Candidates) != 3 {
+		t.Fatalf("测速失败的选路结果 %+v", report)
+	}
+	// 选中的节点恰好是备用地址时不算使用备用节点
+	report = newSelectionReport(SelectionAPIOK, nil, node{Address: fallbackNodeAddr}, fallbackNodeAddr)
+	if report.Fallback {
+		t.Fatal("选中备用地址的节点被标记为使用备用节点")
+	}
+}
+
+func TestSelectionReportExposed(t *testing.T) {
+	l := &selectionListener{selected: make(chan string, 4)}
+	SetEventListener(l)
+	t.Cleanup(func() { SetEventListener(nil) })
+
+	n := startFakeNode(t, "good-token")
+	t.Cleanup(Stop)
+	if err := StartWithHost("good-token", n.addr, freePort(t), "global", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var event string
+	select {
+	case event = <-l.selected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到 OnNodeSelected")
+	}
+	var report SelectionReport
+	if err := json.Unmarshal([]byte(event), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Outcome != SelectionManual || report.Address != n.addr || report.Fallback || report.Failure != nil {
+		t.Fatalf("回调中的选路结果 %+v", report)
+	}
+	if got := GetLastSelectionJSON(); got != event {
+		t.Fatalf("GetLastSelectionJSON 返回 %s，期望与回调相同 %s", got, event)
+	}
+
+	var stats struct {
+		Selection *SelectionReport `json:"selection"`
+	}
+	if err := json.Unmarshal([]byte(GetStatsJSON(0)), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Selection == nil || stats.Selection.Outcome != SelectionManual {
+		t.Fatalf("统计中的选路结果 %+v", stats.Selection)
+	}
+}
+
+// TestSelectionFailure 选中节点拒绝鉴权时，选路结果附带失败原因，停止运行后仍可查询
+func TestSelectionFailure(t *testing.T) {
+	n := startFakeNode(t, "good-token")
+	recordSelection(newSelectionReport(SelectionManual, nil, node{Address: n.addr}, n.addr))
+	c := newClient(n.addr, "bad-token", freePort(t), "global")
+	t.Cleanup(c.Stop)
+	if err := connectClient(c); err == nil {
+		t.Fatal("鉴权被拒时未返回错误")
+	}
+	if report := selectionReport(c); report.Failure == nil || report.Failure.Reason != core.NodeFailAuth || report.Failure.Address != n.addr {
+		t.Fatalf("运行中的选路结果附带 %+v", report.Failure)
+	}
+
+	setSelectionFailure(c.NodeFailure(n.addr))
+	var report SelectionReport
+	if err := json.Unmarshal([]byte(GetLastSelectionJSON()), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Failure == nil || report.Failure.Reason != core.NodeFailAuth || report.Failure.Failures == 0 {
+		t.Fatalf("停止后的选路结果附带 %+v", report.Failure)
+	}
+
+	// 没有运行中的客户端时返回记录的结果
+	if got := selectionReport(nil); got.Failure == nil {
+		t.Fatal("没有运行中的客户端时丢失了失败原因")
+	}
+}
@@ -0,0 +1,61 @@
+package sdk
+
+import (
+	"fmt"
+	"log"
+
+	"uap-quic/pkg/tun"
+)
+
+// defaultTunMTU 未指定 MTU 时使用的值（与 Android / iOS VPN 配置常用值一致）
+const defaultTunMTU = 1500
+
+// tunStack 包模式协议栈（由 StartTun 创建，与 client 一起受 clientLock 保护）
+var tunStack *tun.Stack
+
+// StartTun 进入包模式：接管 VPN 系统接口交给 App 的 tun fd，所有 TCP / UDP 流量通过隧道转发
+// fd: Android VpnService.Builder.establish() 返回的 fd / iOS packetFlow 的 utun fd
+// mtu: 与 VPN 配置一致的 MTU，<= 0 使用默认值（1500）
+// 需先调用 Start / StartWithHost；包模式不经过分流规则（需要直连的流量请在 VPN 路由或分应用配置中排除），
+// 发往 53 端口的 DNS 查询由本地 DNS 服务应答：走代理的域名回复假 IP，连接时还原为域名交给节点解析，其余查询经隧道解析；
+// App 自身连接节点的 socket 必须排除在 VPN 之外（Android: addDisallowedApplication，或用 SetSocketProtector 逐个 protect）
+// fd 仍归调用方所有：StopTun 之后由调用方关闭
+func StartTun(fd int, mtu int) error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("VPN 未运行")
+	}
+	if mtu <= 0 {
+		mtu = defaultTunMTU
+	}
+	stopTunLocked()
+
+	s, err := tun.NewFD(fd, uint32(mtu), client)
+	if err != nil {
+		return err
+	}
+	tunStack = s
+	client.SetFakeIP(true)
+	log.Printf("✅ 包模式已启动 (fd %d, MTU %d)", fd, mtu)
+	return nil
+}
+
+// StopTun 退出包模式（VPN 核心继续运行，SOCKS5 代理不受影响）
+func StopTun() {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	stopTunLocked()
+}
+
+// stopTunLocked 关闭包模式协议栈（调用方需持有 clientLock）
+func stopTunLocked() {
+	if tunStack != nil {
+		tunStack.Close()
+		tunStack = nil
+	}
+	if client != nil {
+		client.SetFakeIP(false)
+	}
+}
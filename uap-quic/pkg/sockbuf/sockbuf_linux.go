@@ -0,0 +1,50 @@
+//go:build linux
+
+package sockbuf
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Read 读取 conn 当前的收发缓冲区大小（内核返回值的一半，即与 SO_RCVBUF 请求相同的口径）
+func Read(conn syscall.Conn) (Config, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	var recvErr, sendErr error
+	if err := raw.Control(func(fd uintptr) {
+		c.Recv, recvErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		c.Send, sendErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	}); err != nil {
+		return Config{}, err
+	}
+	if err := errors.Join(recvErr, sendErr); err != nil {
+		return Config{}, err
+	}
+	c.Recv /= 2
+	c.Send /= 2
+	return c, nil
+}
+
+// force 普通设置被 rmem_max / wmem_max 截断时，用 SO_RCVBUFFORCE / SO_SNDBUFFORCE 越过上限（没有 CAP_NET_ADMIN 时失败）
+func force(conn syscall.Conn, c, granted Config) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var recvErr, sendErr error
+	if err := raw.Control(func(fd uintptr) {
+		if c.Recv > 0 && granted.Recv < c.Recv {
+			recvErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, c.Recv)
+		}
+		if c.Send > 0 && granted.Send < c.Send {
+			sendErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUFFORCE, c.Send)
+		}
+	}); err != nil {
+		return err
+	}
+	return errors.Join(recvErr, sendErr)
+}
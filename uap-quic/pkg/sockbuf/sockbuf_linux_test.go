@@ -0,0 +1,93 @@
+//go:build linux
+
+package sockbuf
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// listenUDP 本机临时端口的 UDP socket
+func listenUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// sysctlInt 读取 /proc/sys 下的整数
+func sysctlInt(t *testing.T, name string) int {
+	t.Helper()
+	data, err := os.ReadFile("/proc/sys/" + strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		t.Skipf("无法读取 %s: %v", name, err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// TestApplyLinux setsockopt 生效，读回的大小与请求同口径（内核返回值的一半）
+func TestApplyLinux(t *testing.T) {
+	conn := listenUDP(t)
+	want := Config{Recv: 256 << 10, Send: 128 << 10}
+	res, err := Apply(conn, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requested != want || res.Granted != want || res.Clamped() {
+		t.Fatalf("设置结果 %+v", res)
+	}
+
+	// 与直接 getsockopt 的结果一致
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rcv, snd int
+	raw.Control(func(fd uintptr) {
+		rcv, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		snd, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if got, err := Read(conn); err != nil || got != (Config{Recv: rcv / 2, Send: snd / 2}) {
+		t.Fatalf("Read = %+v, %v，getsockopt %d / %d", got, err, rcv, snd)
+	}
+
+	// 为 0 的项不修改
+	before, _ := Read(conn)
+	if res, err := Apply(conn, Config{Recv: 512 << 10}); err != nil || res.Granted.Send != before.Send || res.Granted.Recv != 512<<10 {
+		t.Fatalf("只设置接收缓冲区: %+v, %v", res, err)
+	}
+}
+
+// TestApplyLinuxClamped 超过 rmem_max 时：有 CAP_NET_ADMIN 用 SO_RCVBUFFORCE 越过上限，否则如实报告被截断
+func TestApplyLinuxClamped(t *testing.T) {
+	rmemMax := sysctlInt(t, "net.core.rmem_max")
+	conn := listenUDP(t)
+	want := Config{Recv: 2 * rmemMax}
+	res, err := Apply(conn, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch res.Granted.Recv {
+	case want.Recv:
+		if res.Clamped() {
+			t.Fatalf("越过上限后仍报告截断 %+v", res)
+		}
+	case rmemMax:
+		if !res.Clamped() || !strings.Contains(res.String(), strconv.Itoa(want.Recv>>10)+"/"+strconv.Itoa(rmemMax>>10)+"KB") {
+			t.Fatalf("截断的结果 %+v (%s)", res, res)
+		}
+	default:
+		t.Fatalf("请求 %d，rmem_max %d，实际 %d", want.Recv, rmemMax, res.Granted.Recv)
+	}
+}
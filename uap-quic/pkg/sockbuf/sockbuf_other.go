@@ -0,0 +1,20 @@
+//go:build !unix
+
+package sockbuf
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// Read 当前平台不支持读取缓冲区大小
+func Read(conn syscall.Conn) (Config, error) {
+	return Config{}, fmt.Errorf("当前平台 (%s) 不支持读取 socket 缓冲区大小", runtime.GOOS)
+}
+
+// force 当前平台没有越过系统上限的选项
+func force(conn syscall.Conn, c, granted Config) error {
+	return errors.ErrUnsupported
+}
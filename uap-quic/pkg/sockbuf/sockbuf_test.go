@@ -0,0 +1,33 @@
+package sockbuf
+
+import "testing"
+
+func TestFromKB(t *testing.T) {
+	if c := FromKB(4096, 0); c != (Config{Recv: 4 << 20}) || c.IsZero() {
+		t.Fatalf("FromKB(4096, 0) = %+v", c)
+	}
+	if c := FromKB(-1, -1); !c.IsZero() {
+		t.Fatalf("FromKB(-1, -1) = %+v，期望保持系统默认", c)
+	}
+}
+
+func TestResult(t *testing.T) {
+	for _, tc := range []struct {
+		res     Result
+		clamped bool
+		str     string
+	}{
+		{Result{Requested: Config{Recv: 8 << 20}, Granted: Config{Recv: 4 << 20, Send: 208 << 10}}, true, "接收 8192/4096KB, 发送 默认/208KB"},
+		{Result{Requested: Config{Recv: 1 << 20, Send: 1 << 20}, Granted: Config{Recv: 1 << 20, Send: 1 << 20}}, false, "接收 1024/1024KB, 发送 1024/1024KB"},
+		{Result{Requested: Config{Send: 1 << 20}, Granted: Config{Recv: 208 << 10, Send: 512 << 10}}, true, "接收 默认/208KB, 发送 1024/512KB"},
+		// 未请求的项比系统默认小不算截断
+		{Result{Requested: Config{Recv: 64 << 10}, Granted: Config{Recv: 128 << 10, Send: 16 << 10}}, false, "接收 64/128KB, 发送 默认/16KB"},
+	} {
+		if got := tc.res.Clamped(); got != tc.clamped {
+			t.Errorf("%+v: Clamped = %v", tc.res, got)
+		}
+		if got := tc.res.String(); got != tc.str {
+			t.Errorf("String = %q，期望 %q", got, tc.str)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix && !linux
+
+package sockbuf
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Read 读取 conn 当前的收发缓冲区大小
+func Read(conn syscall.Conn) (Config, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	var recvErr, sendErr error
+	if err := raw.Control(func(fd uintptr) {
+		c.Recv, recvErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		c.Send, sendErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	}); err != nil {
+		return Config{}, err
+	}
+	if err := errors.Join(recvErr, sendErr); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// force 当前平台没有越过系统上限的选项
+func force(conn syscall.Conn, c, granted Config) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,193 @@
+// Package target 隧道 TCP 转发目标的编码（客户端与服务端共用）
+//
+// 版本 0（旧版）：地址长度 (1 字节) + "host:port" 字符串。IPv6 字面量依赖方括号，也没有位置携带附加信息
+// 版本 1（能力协商后使用）：ATYP (1 字节) + 地址 + 端口 (2 字节, 大端) + 标志 (1 字节)
+//
+//	ATYP 0x01 IPv4 (4 字节) / 0x03 域名 (长度 1 字节 + 域名) / 0x04 IPv6 (16 字节)，与 SOCKS5 一致
+package target
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 地址类型（与 SOCKS5 的 ATYP 一致）
+const (
+	AtypIPv4   byte = 0x01
+	AtypDomain byte = 0x03
+	AtypIPv6   byte = 0x04
+)
+
+// Flags 转发标志；接收方忽略不认识的位，新增标志不需要再升级协议版本
+type Flags byte
+
+const (
+	FlagCompress   Flags = 1 << 0 // 请求压缩转发（之后双向传输压缩帧，见 pkg/compress）
+	FlagBulk       Flags = 1 << 1 // 流量类型：大流量（下载、上传），不设置表示交互流量
+	FlagPreferIPv4 Flags = 1 << 2 // 域名目标优先连接 IPv4 地址，失败再试 IPv6
+	FlagPreferIPv6 Flags = 1 << 3 // 域名目标优先连接 IPv6 地址，失败再试 IPv4
+	FlagGame       Flags = 1 << 4 // 流量类型：游戏 / 实时流量（低时延优先）
+)
+
+// 转发请求的响应（1 字节，版本 0 与版本 1 相同）：StatusOK 之外都是失败，旧版客户端只区分是否为 StatusOK
+const (
+	StatusOK          byte = 0x00
+	StatusFailed      byte = 0x01 // 请求无效或其他原因失败
+	StatusRefused     byte = 0x02 // 目标拒绝连接
+	StatusUnreachable byte = 0x03 // 连接目标超时或网络不可达
+)
+
+// maxDomainLen 域名最大长度（长度字段 1 字节）
+const maxDomainLen = 255
+
+// ErrBadAddress 地址格式错误
+var ErrBadAddress = errors.New("目标地址格式错误")
+
+// Target 结构化的转发目标
+type Target struct {
+	Host  string // IP 字面量（不带方括号）或域名
+	Port  uint16
+	Flags Flags
+}
+
+// Parse 解析 "host:port"（IPv6 字面量必须带方括号，如 [2001:db8::1]:443）
+func Parse(hostport string) (Target, error) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: %v", ErrBadAddress, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: 端口无效 %q", ErrBadAddress, portStr)
+	}
+	t := Target{Host: host, Port: uint16(port)}
+	if err := t.check(); err != nil {
+		return Target{}, err
+	}
+	return t, nil
+}
+
+// String 返回 "host:port"（IPv6 带方括号），即版本 0 的地址格式
+func (t Target) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// CheckHost 校验主机：IP 字面量（不带方括号）或长度 1-255、不含冒号、方括号、空白与控制字符的域名
+func CheckHost(host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(host) == 0 || len(host) > maxDomainLen {
+		return fmt.Errorf("%w: 域名长度无效 %q", ErrBadAddress, host)
+	}
+	// 含冒号、方括号的只能是 IPv6 字面量，必须按 IPv6 类型编码；空白与控制字符不会出现在任何可解析的域名中
+	if strings.IndexFunc(host, func(r rune) bool { return r == ':' || r == '[' || r == ']' || r <= ' ' || r == 0x7f }) >= 0 {
+		return fmt.Errorf("%w: 域名包含非法字符 %q", ErrBadAddress, host)
+	}
+	return nil
+}
+
+// check 校验地址与标志
+func (t Target) check() error {
+	if err := CheckHost(t.Host); err != nil {
+		return err
+	}
+	if t.Flags&FlagPreferIPv4 != 0 && t.Flags&FlagPreferIPv6 != 0 {
+		return fmt.Errorf("%w: 不能同时优先 IPv4 与 IPv6", ErrBadAddress)
+	}
+	return nil
+}
+
+// Append 按版本 1 编码追加到 b
+func (t Target) Append(b []byte) ([]byte, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(t.Host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(append(b, AtypIPv4), ip4...)
+		} else {
+			b = append(append(b, AtypIPv6), ip.To16()...)
+		}
+	} else {
+		b = append(append(b, AtypDomain, byte(len(t.Host))), t.Host...)
+	}
+	b = binary.BigEndian.AppendUint16(b, t.Port)
+	return append(b, byte(t.Flags)), nil
+}
+
+// Read 读取版本 1 编码的目标
+func Read(r io.Reader) (Target, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return Target{}, err
+	}
+
+	var t Target
+	switch atyp[0] {
+	case AtypIPv4, AtypIPv6:
+		ip := make(net.IP, 4)
+		if atyp[0] == AtypIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return Target{}, err
+		}
+		t.Host = ip.String()
+	case AtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return Target{}, err
+		}
+		if n[0] == 0 {
+			return Target{}, fmt.Errorf("%w: 域名为空", ErrBadAddress)
+		}
+		domain := make([]byte, n[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return Target{}, err
+		}
+		t.Host = string(domain)
+	default:
+		return Target{}, fmt.Errorf("%w: 未知地址类型 0x%02x", ErrBadAddress, atyp[0])
+	}
+
+	var tail [3]byte
+	if _, err := io.ReadFull(r, tail[:]); err != nil {
+		return Target{}, err
+	}
+	t.Port = binary.BigEndian.Uint16(tail[:2])
+	t.Flags = Flags(tail[2])
+	if err := t.check(); err != nil {
+		return Target{}, err
+	}
+	return t, nil
+}
+
+// AppendV0 按版本 0 编码追加到 b：地址长度 (1 字节) + "host:port"
+func AppendV0(b []byte, hostport string) ([]byte, error) {
+	if len(hostport) == 0 || len(hostport) > maxDomainLen {
+		return nil, fmt.Errorf("%w: 地址长度无效 %q", ErrBadAddress, hostport)
+	}
+	return append(append(b, byte(len(hostport))), hostport...), nil
+}
+
+// ReadV0 读取版本 0 编码的目标地址（长度字节已由调用方读取），地址须能按 Parse 解析
+func ReadV0(r io.Reader, length int) (string, error) {
+	if length == 0 || length > maxDomainLen {
+		return "", fmt.Errorf("%w: 地址长度无效 %d", ErrBadAddress, length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	t, err := Parse(string(buf))
+	if err != nil {
+		return "", err
+	}
+	return t.String(), nil
+}
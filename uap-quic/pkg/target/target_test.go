@@ -0,0 +1,192 @@
+package target
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	long := strings.Repeat("a", maxDomainLen)
+	cases := []struct {
+		in, out string
+		atyp    byte
+	}{
+		{"1.2.3.4:80", "1.2.3.4:80", AtypIPv4},
+		{"[::1]:443", "[::1]:443", AtypIPv6},
+		{"[2001:db8::1]:8080", "[2001:db8::1]:8080", AtypIPv6},
+		{"[::ffff:1.2.3.4]:53", "1.2.3.4:53", AtypIPv4}, // IPv4 映射地址按 IPv4 编码
+		{"a:1", "a:1", AtypDomain},
+		{long + ":65535", long + ":65535", AtypDomain},
+		{"example.com:0", "example.com:0", AtypDomain},
+	}
+	// 接收方保留不认识的标志位
+	flags := []Flags{0, FlagCompress, FlagBulk | FlagPreferIPv6, FlagGame | FlagPreferIPv4, 0xE0}
+	for _, tc := range cases {
+		for _, f := range flags {
+			tgt, err := Parse(tc.in)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.in, err)
+			}
+			tgt.Flags = f
+			b, err := tgt.Append([]byte{0xAA})
+			if err != nil || b[0] != 0xAA || b[1] != tc.atyp {
+				t.Fatalf("Append(%q) = %x, %v", tc.in, b, err)
+			}
+			r := bytes.NewReader(b[1:])
+			got, err := Read(r)
+			if err != nil || got.String() != tc.out || got.Flags != f || r.Len() != 0 {
+				t.Fatalf("%q 标志 %#x 解码为 %+v（剩余 %d 字节）: %v", tc.in, f, got, r.Len(), err)
+			}
+			// 任何截断都不能被接受
+			for i := 0; i < len(b)-1; i++ {
+				if _, err := Read(bytes.NewReader(b[1 : 1+i])); err == nil {
+					t.Fatalf("%q 截断到 %d 字节时被接受", tc.in, i)
+				}
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		"::1:443",        // IPv6 字面量缺少方括号
+		"2001:db8::1:80", // 同上
+		"[fe80::1%eth0]:22",
+		"host",
+		"host:99999",
+		":80",
+		strings.Repeat("a", maxDomainLen+1) + ":1",
+		"a\x00b:1",
+		"a b:1",
+		"a\x7f:1",
+	} {
+		if _, err := Parse(bad); !errors.Is(err, ErrBadAddress) {
+			t.Errorf("Parse(%q) 返回 %v，期望 ErrBadAddress", bad, err)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, ok := range []string{"1.2.3.4", "::1", "2001:db8::1", "example.com", "xn--bcher-kva.example"} {
+		if err := CheckHost(ok); err != nil {
+			t.Errorf("CheckHost(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "[::1]", "a:b", "a]", "a\tb", "a\nb", strings.Repeat("a", maxDomainLen+1)} {
+		if err := CheckHost(bad); !errors.Is(err, ErrBadAddress) {
+			t.Errorf("CheckHost(%q) 返回 %v，期望 ErrBadAddress", bad, err)
+		}
+	}
+}
+
+func TestAppendRejectsBothPrefer(t *testing.T) {
+	tgt := Target{Host: "example.com", Port: 443, Flags: FlagPreferIPv4 | FlagPreferIPv6}
+	if _, err := tgt.Append(nil); !errors.Is(err, ErrBadAddress) {
+		t.Fatalf("同时优先 IPv4 与 IPv6 时返回 %v", err)
+	}
+	// 域名中的冒号只能来自未正确编码的 IPv6 字面量
+	if _, err := (Target{Host: "a:b", Port: 1}).Append(nil); !errors.Is(err, ErrBadAddress) {
+		t.Fatalf("域名含冒号时返回 %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, raw := range [][]byte{
+		{0x02, 1, 2, 3, 4, 0, 80, 0},                                         // 未知地址类型
+		{AtypDomain, 0, 0, 80, 0},                                            // 空域名
+		{AtypDomain, 3, 'a', ':', 'b', 0, 80, 0},                             // 域名含冒号
+		{AtypDomain, 3, 'a', ' ', 'b', 0, 80, 0},                             // 域名含空白
+		{AtypIPv4, 1, 2, 3, 4, 0, 80, byte(FlagPreferIPv4 | FlagPreferIPv6)}, // 同时优先两种地址族
+	} {
+		if _, err := Read(bytes.NewReader(raw)); !errors.Is(err, ErrBadAddress) {
+			t.Errorf("Read(%x) 返回 %v，期望 ErrBadAddress", raw, err)
+		}
+	}
+}
+
+func TestV0(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"[::1]:443", "[::1]:443"},
+		{"[2001:db8::1]:80", "[2001:db8::1]:80"},
+		{"example.com:443", "example.com:443"},
+	} {
+		b, err := AppendV0([]byte{0xAA}, tc.in)
+		if err != nil || b[0] != 0xAA || int(b[1]) != len(tc.in) {
+			t.Fatalf("AppendV0(%q) = %x, %v", tc.in, b, err)
+		}
+		got, err := ReadV0(bytes.NewReader(b[2:]), int(b[1]))
+		if err != nil || got != tc.out {
+			t.Fatalf("ReadV0(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+
+	if _, err := AppendV0(nil, ""); !errors.Is(err, ErrBadAddress) {
+		t.Fatal("空地址被接受")
+	}
+	if _, err := AppendV0(nil, strings.Repeat("a", maxDomainLen+1)); !errors.Is(err, ErrBadAddress) {
+		t.Fatal("超长地址被接受")
+	}
+	if _, err := ReadV0(bytes.NewReader(nil), 0); !errors.Is(err, ErrBadAddress) {
+		t.Fatal("长度 0 被接受")
+	}
+	if _, err := ReadV0(bytes.NewReader([]byte("a:1")), 4); err == nil {
+		t.Fatal("截断的地址被接受")
+	}
+	// 版本 0 同样不接受缺少方括号的 IPv6 字面量
+	if _, err := ReadV0(bytes.NewReader([]byte("::1:443")), 7); !errors.Is(err, ErrBadAddress) {
+		t.Fatalf("缺少方括号的 IPv6 字面量返回 %v", err)
+	}
+}
+
+// FuzzRead 任意输入都不会导致崩溃；能读出的目标都通过校验，编码后再读取得到同一个目标
+func FuzzRead(f *testing.F) {
+	for _, tgt := range []Target{{Host: "example.com", Port: 443}, {Host: "1.2.3.4", Port: 80}, {Host: "2001:db8::1", Port: 53, Flags: FlagPreferIPv6}} {
+		b, _ := tgt.Append(nil)
+		f.Add(b)
+	}
+	f.Add([]byte{AtypDomain, 0, 0, 80, 0})
+	f.Add([]byte{AtypDomain, 3, 'a', ' ', 'b', 0, 80, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tgt, err := Read(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err := CheckHost(tgt.Host); err != nil {
+			t.Fatalf("读出的主机 %q 未通过校验: %v", tgt.Host, err)
+		}
+		b, err := tgt.Append(nil)
+		if err != nil {
+			t.Fatalf("读出的目标 %+v 无法编码: %v", tgt, err)
+		}
+		// 按域名类型发送的 IP 字面量重新编码为 IP 类型，比较时按同一个 IP 处理
+		again, err := Read(bytes.NewReader(b))
+		ip := net.ParseIP(tgt.Host)
+		sameHost := again.Host == tgt.Host || ip != nil && ip.Equal(net.ParseIP(again.Host))
+		if err != nil || !sameHost || again.Port != tgt.Port || again.Flags != tgt.Flags {
+			t.Fatalf("编码后读取得到 %+v, %v，期望 %+v", again, err, tgt)
+		}
+	})
+}
+
+// FuzzReadV0 任意输入都不会导致崩溃；能读出的地址都能按 Parse 解析并重新编码
+func FuzzReadV0(f *testing.F) {
+	for _, seed := range []string{"example.com:443", "[::1]:443", "1.2.3.4:80", "::1:443", " :80", "a\x00b:1", ""} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		addr, err := ReadV0(bytes.NewReader(data), len(data))
+		if err != nil {
+			return
+		}
+		tgt, err := Parse(addr)
+		if err != nil || tgt.String() != addr {
+			t.Fatalf("读出的地址 %q 解析为 %+v, %v", addr, tgt, err)
+		}
+		if _, err := AppendV0(nil, addr); err != nil {
+			t.Fatalf("读出的地址 %q 无法编码: %v", addr, err)
+		}
+	})
+}
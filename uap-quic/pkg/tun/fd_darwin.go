@@ -0,0 +1,94 @@
+package tun
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// utunHeaderSize utun 每个包前的协议族头部（4 字节，大端 AF_INET / AF_INET6）
+const utunHeaderSize = 4
+
+// newFDEndpoint iOS / macOS utun 设备（NEPacketTunnelProvider 的 packetFlow 底层 fd）
+// 在 channel 端点上收发包并处理 utun 头部；清理函数停止收发循环（不关闭 fd）
+func newFDEndpoint(fd int, mtu uint32) (stack.LinkEndpoint, func(), error) {
+	// 复制一份 fd：关闭 os.File 只释放副本，原 fd 仍归调用方所有
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("接管 tun fd 失败: %w", err)
+	}
+	// 非阻塞模式下 os.File 走 poller，Close 能打断阻塞中的 Read
+	if err := syscall.SetNonblock(dup, true); err != nil {
+		syscall.Close(dup)
+		return nil, nil, fmt.Errorf("接管 tun fd 失败: %w", err)
+	}
+	file := os.NewFile(uintptr(dup), "utun")
+
+	ep := channel.New(512, mtu, "")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// 收包：tun -> 协议栈
+	go func() {
+		buf := make([]byte, utunHeaderSize+int(mtu))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			if n <= utunHeaderSize {
+				continue
+			}
+			packet := buf[utunHeaderSize:n]
+			var proto tcpip.NetworkProtocolNumber
+			switch header.IPVersion(packet) {
+			case header.IPv4Version:
+				proto = header.IPv4ProtocolNumber
+			case header.IPv6Version:
+				proto = header.IPv6ProtocolNumber
+			default:
+				continue
+			}
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Payload: buffer.MakeWithData(append([]byte(nil), packet...)),
+			})
+			ep.InjectInbound(proto, pkt)
+			pkt.DecRef()
+		}
+	}()
+
+	// 发包：协议栈 -> tun
+	go func() {
+		for {
+			pkt := ep.ReadContext(ctx)
+			if pkt.IsNil() {
+				return
+			}
+			family := uint32(syscall.AF_INET)
+			if pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber {
+				family = syscall.AF_INET6
+			}
+			out := make([]byte, utunHeaderSize, utunHeaderSize+pkt.Size())
+			binary.BigEndian.PutUint32(out, family)
+			for _, s := range pkt.AsSlices() {
+				out = append(out, s...)
+			}
+			pkt.DecRef()
+			file.Write(out)
+		}
+	}()
+
+	cleanup := func() {
+		cancel()
+		ep.Close()
+		file.Close() // 让收包循环的 Read 返回
+	}
+	return ep, cleanup, nil
+}
@@ -0,0 +1,21 @@
+package tun
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// newFDEndpoint Linux / Android tun 设备（IFF_NO_PI，包不带额外头部）
+// fdbased 在 RemoveNIC 时停止收包循环，无需额外清理
+func newFDEndpoint(fd int, mtu uint32) (stack.LinkEndpoint, func(), error) {
+	ep, err := fdbased.New(&fdbased.Options{
+		FDs: []int{fd},
+		MTU: mtu,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("接管 tun fd 失败: %w", err)
+	}
+	return ep, nil, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package tun
+
+import (
+	"fmt"
+	"runtime"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// newFDEndpoint 当前平台没有可接管的 tun fd（可自行实现 stack.LinkEndpoint 后使用 New）
+func newFDEndpoint(fd int, mtu uint32) (stack.LinkEndpoint, func(), error) {
+	return nil, nil, fmt.Errorf("当前平台 (%s) 不支持 tun fd", runtime.GOOS)
+}
@@ -0,0 +1,243 @@
+// Package tun 包模式接入：在用户态 TCP/IP 协议栈 (gVisor netstack) 上终结 tun 网卡的 IP 流量，
+// 把每个 TCP 连接 / UDP 会话转换为一次隧道拨号（Android VpnService、iOS NEPacketTunnelProvider 交给 App 的都是 tun fd 而不是 SOCKS5）
+package tun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"uap-quic/pkg/relay"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// Dialer 隧道拨号（core.Client 实现），target 为 host:port
+type Dialer interface {
+	DialTCP(ctx context.Context, target string) (net.Conn, error)
+	DialUDP(ctx context.Context, target string) (net.Conn, error)
+}
+
+// 协议栈参数
+const (
+	nicID          tcpip.NICID = 1
+	maxInFlight                = 1024             // 同时等待隧道拨号的 TCP 握手上限，超出的 SYN 被丢弃（由对端重传）
+	dialTimeout                = 10 * time.Second // 单次隧道拨号的最长时间
+	udpIdleTimeout             = 60 * time.Second // UDP 会话空闲超时
+	dnsIdleTimeout             = 10 * time.Second // DNS (53 端口) 会话空闲超时：一问一答，不必长时间占用流
+)
+
+// Stack tun 包模式协议栈
+type Stack struct {
+	stack   *stack.Stack
+	dialer  Dialer
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cleanup func() // 释放链路层资源（可为 nil）
+
+	closeOnce sync.Once
+}
+
+// New 在链路层 ep 上创建协议栈：所有目的地址的 TCP 连接与 UDP 会话都通过 d 拨号
+// ep 收到的是不带链路层头部的 IPv4 / IPv6 包
+func New(ep stack.LinkEndpoint, d Dialer) (*Stack, error) {
+	return newStack(ep, d, nil)
+}
+
+// NewFD 接管 tun 网卡的文件描述符（Android VpnService.establish / iOS utun）创建协议栈
+// fd 仍归调用方所有：Close 之后由调用方关闭
+func NewFD(fd int, mtu uint32, d Dialer) (*Stack, error) {
+	ep, cleanup, err := newFDEndpoint(fd, mtu)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newStack(ep, d, cleanup)
+	if err != nil && cleanup != nil {
+		cleanup()
+	}
+	return s, err
+}
+
+// newStack 创建协议栈并注册 TCP / UDP 转发
+func newStack(ep stack.LinkEndpoint, d Dialer, cleanup func()) (*Stack, error) {
+	ns := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+	})
+	sack := tcpip.TCPSACKEnabled(true)
+	ns.SetTransportProtocolOption(tcp.ProtocolNumber, &sack)
+
+	if err := ns.CreateNIC(nicID, ep); err != nil {
+		ns.Close()
+		return nil, fmt.Errorf("创建虚拟网卡失败: %s", err)
+	}
+	// 接收发往任意地址的包，并允许以任意地址回包（协议栈扮演所有目标主机）
+	ns.SetPromiscuousMode(nicID, true)
+	ns.SetSpoofing(nicID, true)
+	ns.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Stack{stack: ns, dialer: d, ctx: ctx, cancel: cancel, cleanup: cleanup}
+
+	tcpForwarder := tcp.NewForwarder(ns, 0, maxInFlight, s.handleTCP)
+	ns.SetTransportProtocolHandler(tcp.ProtocolNumber, tcpForwarder.HandlePacket)
+	udpForwarder := udp.NewForwarder(ns, s.handleUDP)
+	ns.SetTransportProtocolHandler(udp.ProtocolNumber, udpForwarder.HandlePacket)
+
+	log.Printf("📦 tun 包模式协议栈已启动 (MTU %d)", ep.MTU())
+	return s, nil
+}
+
+// Close 停止协议栈并断开所有连接
+func (s *Stack) Close() {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.stack.RemoveNIC(nicID) // 停止从链路层收包
+		s.stack.Close()
+		s.stack.Wait()
+		if s.cleanup != nil {
+			s.cleanup()
+		}
+		log.Println("📦 tun 包模式协议栈已停止")
+	})
+}
+
+// targetOf 连接的目标地址（协议栈一侧的本地地址就是应用要访问的地址）
+func targetOf(id stack.TransportEndpointID) string {
+	return net.JoinHostPort(id.LocalAddress.String(), strconv.Itoa(int(id.LocalPort)))
+}
+
+// handleTCP 处理新的 TCP 连接：先通过隧道拨号，成功后才完成与应用的握手，失败则回 RST
+// 应用看到的连接结果与目标的真实可达性一致
+func (s *Stack) handleTCP(r *tcp.ForwarderRequest) {
+	target := targetOf(r.ID())
+
+	ctx, cancel := context.WithTimeout(s.ctx, dialTimeout)
+	upstream, err := s.dialer.DialTCP(ctx, target)
+	cancel()
+	if err != nil {
+		log.Printf("[tun] TCP 拨号失败 %s: %v", target, err)
+		r.Complete(true)
+		return
+	}
+
+	var wq waiter.Queue
+	ep, tcpErr := r.CreateEndpoint(&wq)
+	if tcpErr != nil {
+		// 握手期间应用已放弃连接
+		r.Complete(true)
+		upstream.Close()
+		return
+	}
+	r.Complete(false)
+	ep.SocketOptions().SetKeepAlive(true)
+
+	local := gonet.NewTCPConn(&wq, ep)
+	go relayTCP(local, upstream)
+}
+
+// relayTCP 双向转发，任一方向结束即打断另一方向，等它退出后关闭两端（与服务端的转发语义一致，见 relay.Stop）
+func relayTCP(local, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	relay.Stop(func() { <-done }, local, upstream)
+	local.Close()
+	upstream.Close()
+}
+
+// handleUDP 处理新的 UDP 会话（同一四元组的后续包直接进入已创建的端点）
+// 转发器同步调用：先创建端点接住首包，拨号在后台进行
+func (s *Stack) handleUDP(r *udp.ForwarderRequest) {
+	id := r.ID()
+	var wq waiter.Queue
+	ep, tcpErr := r.CreateEndpoint(&wq)
+	if tcpErr != nil {
+		log.Printf("[tun] 创建 UDP 端点失败 %s: %s", targetOf(id), tcpErr)
+		return
+	}
+	local := gonet.NewUDPConn(s.stack, &wq, ep)
+
+	idle := udpIdleTimeout
+	if id.LocalPort == 53 {
+		idle = dnsIdleTimeout
+	}
+	go s.relayUDP(local, targetOf(id), idle)
+}
+
+// relayUDP 拨号并转发一个 UDP 会话，双向都空闲超过 idle 后结束
+func (s *Stack) relayUDP(local net.Conn, target string, idle time.Duration) {
+	defer local.Close()
+
+	ctx, cancel := context.WithTimeout(s.ctx, dialTimeout)
+	upstream, err := s.dialer.DialUDP(ctx, target)
+	cancel()
+	if err != nil {
+		log.Printf("[tun] UDP 拨号失败 %s: %v", target, err)
+		return
+	}
+	defer upstream.Close()
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
+	// copyPackets 逐包转发；读超时时如果另一方向仍有流量则继续等待
+	copyPackets := func(dst, src net.Conn) {
+		buf := make([]byte, 64*1024)
+		for {
+			src.SetReadDeadline(time.Now().Add(idle))
+			n, err := src.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() &&
+					time.Since(time.Unix(0, lastActive.Load())) < idle {
+					continue
+				}
+				return
+			}
+			lastActive.Store(time.Now().UnixNano())
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		copyPackets(upstream, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyPackets(local, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	local.Close()
+	upstream.Close()
+	<-done
+}
@@ -0,0 +1,320 @@
+package tun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeDialer 记录拨号目标；fail 时拨号失败，否则返回一端回显的内存连接
+type fakeDialer struct {
+	fail bool
+
+	mu      sync.Mutex
+	targets []string
+	dialed  chan string
+}
+
+func newFakeDialer(fail bool) *fakeDialer {
+	return &fakeDialer{fail: fail, dialed: make(chan string, 16)}
+}
+
+func (d *fakeDialer) dial(network, target string) (net.Conn, error) {
+	d.mu.Lock()
+	d.targets = append(d.targets, network+" "+target)
+	d.mu.Unlock()
+	d.dialed <- network + " " + target
+	if d.fail {
+		return nil, errors.New("隧道拨号失败")
+	}
+	local, remote := net.Pipe()
+	go func() {
+		defer remote.Close()
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := remote.Read(buf)
+			if err != nil {
+				return
+			}
+			if _, err := remote.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+	return local, nil
+}
+
+func (d *fakeDialer) DialTCP(ctx context.Context, target string) (net.Conn, error) {
+	return d.dial("tcp", target)
+}
+
+func (d *fakeDialer) DialUDP(ctx context.Context, target string) (net.Conn, error) {
+	return d.dial("udp", target)
+}
+
+// expectDial 等待一次拨号并检查目标
+func (d *fakeDialer) expectDial(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-d.dialed:
+		if got != want {
+			t.Fatalf("拨号 %s，期望 %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("未收到拨号 %s", want)
+	}
+}
+
+// newTestStack 在内存链路上创建协议栈
+func newTestStack(t *testing.T, d Dialer) *channel.Endpoint {
+	ep := channel.New(64, 1500, "")
+	s, err := New(ep, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		ep.Close()
+	})
+	return ep
+}
+
+var (
+	appAddr    = tcpip.AddrFrom4([4]byte{10, 0, 0, 2})
+	remoteAddr = tcpip.AddrFrom4([4]byte{93, 184, 216, 34})
+)
+
+// synPacket 构造应用发出的 TCP SYN 包
+func synPacket(srcPort, dstPort uint16) []byte {
+	b := make([]byte, header.IPv4MinimumSize+header.TCPMinimumSize)
+	ip := header.IPv4(b)
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(len(b)),
+		TTL:         64,
+		Protocol:    uint8(header.TCPProtocolNumber),
+		SrcAddr:     appAddr,
+		DstAddr:     remoteAddr,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	seg := header.TCP(b[header.IPv4MinimumSize:])
+	seg.Encode(&header.TCPFields{
+		SrcPort:    srcPort,
+		DstPort:    dstPort,
+		SeqNum:     1000,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      header.TCPFlagSyn,
+		WindowSize: 65535,
+	})
+	xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, appAddr, remoteAddr, header.TCPMinimumSize)
+	seg.SetChecksum(^seg.CalculateChecksum(xsum))
+	return b
+}
+
+// inject 把 IPv4 包注入协议栈
+func inject(ep *channel.Endpoint, b []byte) {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buffer.MakeWithData(b)})
+	ep.InjectInbound(ipv4.ProtocolNumber, pkt)
+	pkt.DecRef()
+}
+
+// readTCPReply 读取协议栈回给应用的 TCP 包
+func readTCPReply(t *testing.T, ep *channel.Endpoint) header.TCP {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pkt := ep.ReadContext(ctx)
+	if pkt.IsNil() {
+		t.Fatal("协议栈未回包")
+	}
+	defer pkt.DecRef()
+	ip := header.IPv4(pkt.ToView().AsSlice())
+	if !ip.IsValid(len(ip)) || ip.TransportProtocol() != header.TCPProtocolNumber {
+		t.Fatalf("回包不是 TCP: %x", []byte(ip))
+	}
+	if ip.SourceAddress() != remoteAddr || ip.DestinationAddress() != appAddr {
+		t.Fatalf("回包地址 %s -> %s", ip.SourceAddress(), ip.DestinationAddress())
+	}
+	return header.TCP(ip.Payload())
+}
+
+func TestSYNProducesTunnelDial(t *testing.T) {
+	d := newFakeDialer(false)
+	ep := newTestStack(t, d)
+
+	inject(ep, synPacket(40000, 443))
+	d.expectDial(t, "tcp 93.184.216.34:443")
+	// 隧道拨号成功后才回 SYN-ACK
+	seg := readTCPReply(t, ep)
+	if seg.Flags() != header.TCPFlagSyn|header.TCPFlagAck || seg.AckNumber() != 1001 {
+		t.Fatalf("回包标志 %s ack %d，期望 SYN-ACK", seg.Flags(), seg.AckNumber())
+	}
+}
+
+func TestSYNDialFailureResets(t *testing.T) {
+	d := newFakeDialer(true)
+	ep := newTestStack(t, d)
+
+	inject(ep, synPacket(40001, 80))
+	d.expectDial(t, "tcp 93.184.216.34:80")
+	// 隧道拨号失败：应用立即收到 RST，而不是等到超时
+	seg := readTCPReply(t, ep)
+	if seg.Flags()&header.TCPFlagRst == 0 || seg.SourcePort() != 80 || seg.DestinationPort() != 40001 {
+		t.Fatalf("回包 %d -> %d 标志 %s，期望 RST", seg.SourcePort(), seg.DestinationPort(), seg.Flags())
+	}
+}
+
+// newAppStack 模拟应用一侧的系统协议栈，与 ep 上的 tun 协议栈互相收发包
+func newAppStack(t *testing.T, tunEP *channel.Endpoint) *stack.Stack {
+	ep := channel.New(64, 1500, "")
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+	})
+	if err := s.CreateNIC(1, ep); err != nil {
+		t.Fatal(err)
+	}
+	protoAddr := tcpip.ProtocolAddress{Protocol: ipv4.ProtocolNumber, AddressWithPrefix: appAddr.WithPrefix()}
+	if err := s.AddProtocolAddress(1, protoAddr, stack.AddressProperties{}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: 1}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	forward := func(from, to *channel.Endpoint) {
+		defer wg.Done()
+		for {
+			pkt := from.ReadContext(ctx)
+			if pkt.IsNil() {
+				return
+			}
+			inject(to, pkt.ToView().AsSlice())
+			pkt.DecRef()
+		}
+	}
+	wg.Add(2)
+	go forward(ep, tunEP)
+	go forward(tunEP, ep)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		s.Close()
+		ep.Close()
+	})
+	return s
+}
+
+func TestTCPRelay(t *testing.T) {
+	d := newFakeDialer(false)
+	app := newAppStack(t, newTestStack(t, d))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := gonet.DialContextTCP(ctx, app, tcpip.FullAddress{Addr: remoteAddr, Port: 443}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	d.expectDial(t, "tcp 93.184.216.34:443")
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	payload := bytes.Repeat([]byte("uap-tun"), 10000)
+	go conn.Write(payload)
+	reply := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply, payload) {
+		t.Fatal("经隧道回显的数据不一致")
+	}
+}
+
+// TestRelayTCPInterrupts 一个方向结束后打断仍阻塞的另一方向，等它退出后关闭两端
+func TestRelayTCPInterrupts(t *testing.T) {
+	local, app := net.Pipe()
+	upstream, tunnel := net.Pipe()
+	defer app.Close()
+
+	done := make(chan struct{})
+	go func() {
+		relayTCP(local, upstream)
+		close(done)
+	}()
+	// 隧道一侧结束；应用既不写也不读，上行方向阻塞在读取应用连接
+	tunnel.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("隧道结束后转发未返回")
+	}
+	if _, err := app.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("应用连接读取返回 %v，期望已关闭", err)
+	}
+}
+
+func TestTCPRelayRefused(t *testing.T) {
+	d := newFakeDialer(true)
+	app := newAppStack(t, newTestStack(t, d))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := gonet.DialContextTCP(ctx, app, tcpip.FullAddress{Addr: remoteAddr, Port: 80}, ipv4.ProtocolNumber)
+	if err == nil || ctx.Err() != nil {
+		t.Fatalf("隧道拨号失败时应用连接返回 %v，期望立即被拒绝", err)
+	}
+}
+
+func TestUDPRelay(t *testing.T) {
+	d := newFakeDialer(false)
+	app := newAppStack(t, newTestStack(t, d))
+
+	conn, err := gonet.DialUDP(app, nil, &tcpip.FullAddress{Addr: remoteAddr, Port: 53}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, msg := range []string{"query-1", "query-2"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != msg {
+			t.Fatalf("回显 %q，期望 %q", buf[:n], msg)
+		}
+	}
+	// 同一会话的后续包复用首包触发的拨号
+	d.expectDial(t, "udp 93.184.216.34:53")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.targets) != 1 {
+		t.Fatalf("拨号 %d 次: %v", len(d.targets), d.targets)
+	}
+}
@@ -0,0 +1,39 @@
+package udpstream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxFrameSize 单帧最大长度（2 字节长度前缀所能表示的上限，覆盖任意 UDP 报文）
+const MaxFrameSize = 0xFFFF
+
+// WriteFrame 写入一帧：长度 (2 字节, 大端) + 数据
+// 长度前缀与数据合并为一次写入，调用方需保证同一流上只有一个写入者
+func WriteFrame(w io.Writer, packet []byte) error {
+	if len(packet) > MaxFrameSize {
+		return fmt.Errorf("UDP 帧过大: %d 字节", len(packet))
+	}
+	frame := make([]byte, 2+len(packet))
+	binary.BigEndian.PutUint16(frame, uint16(len(packet)))
+	copy(frame[2:], packet)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame 读取一帧到 buf（buf 至少 MaxFrameSize 字节），返回帧数据
+func ReadFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(lenBuf[:]))
+	if n > len(buf) {
+		return nil, fmt.Errorf("UDP 帧超出缓冲区: %d 字节", n)
+	}
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
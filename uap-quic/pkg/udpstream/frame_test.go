@@ -0,0 +1,50 @@
+package udpstream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	packets := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{0xAB}, MaxFrameSize)}
+	for _, p := range packets {
+		if err := WriteFrame(&buf, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readBuf := make([]byte, MaxFrameSize)
+	for i, want := range packets {
+		got, err := ReadFrame(&buf, readBuf)
+		if err != nil {
+			t.Fatalf("第 %d 帧: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("第 %d 帧内容不一致（%d 字节，期望 %d 字节）", i, len(got), len(want))
+		}
+	}
+	if _, err := ReadFrame(&buf, readBuf); err != io.EOF {
+		t.Fatalf("读完所有帧后应返回 EOF，实际 %v", err)
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	if err := WriteFrame(io.Discard, make([]byte, MaxFrameSize+1)); err == nil {
+		t.Fatal("超过 MaxFrameSize 的帧应被拒绝")
+	}
+
+	var buf bytes.Buffer
+	WriteFrame(&buf, make([]byte, 100))
+	if _, err := ReadFrame(&buf, make([]byte, 10)); err == nil {
+		t.Fatal("帧超出缓冲区时应返回错误")
+	}
+
+	// 数据不完整（流在帧中间断开）
+	buf.Reset()
+	WriteFrame(&buf, []byte("truncated"))
+	buf.Truncate(buf.Len() - 3)
+	if _, err := ReadFrame(&buf, make([]byte, MaxFrameSize)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("截断的帧应返回 ErrUnexpectedEOF，实际 %v", err)
+	}
+}
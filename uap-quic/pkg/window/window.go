@@ -0,0 +1,103 @@
+// Package window QUIC 流量控制窗口配置（客户端与服务端共用）
+package window
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Config QUIC 接收窗口（字节）：流控窗口从初始值起步，按需自动增长到最大值
+// 窗口决定单条流 / 单条连接在一个 RTT 内最多能收多少数据：吞吐上限约为 窗口 / RTT
+// 窗口过小跑不满高延迟链路，过大则在慢速下行链路上堆积排队（bufferbloat），交互流量的延迟随之升高
+type Config struct {
+	InitialStream uint64 `json:"initial_stream"`
+	MaxStream     uint64 `json:"max_stream"`
+	InitialConn   uint64 `json:"initial_conn"`
+	MaxConn       uint64 `json:"max_conn"`
+}
+
+// Default 默认窗口（黄金窗口参数：针对跨国高延迟 + 轻微丢包环境，单流足够跑满 100M+）
+var Default = Config{
+	InitialStream: 2 << 20,  // 2MB 起步
+	MaxStream:     6 << 20,  // 单流最大 6MB
+	InitialConn:   6 << 20,  // 连接起步 6MB
+	MaxConn:       15 << 20, // 连接最大 15MB
+}
+
+// MinSize 窗口下限（过小的窗口每个 RTT 只能收几个包，隧道几乎不可用）
+const MinSize = 64 << 10
+
+// FromKB 按 KB 构造窗口（命令行与 SDK 使用），<= 0 的项取默认值
+func FromKB(initialStream, maxStream, initialConn, maxConn int) Config {
+	kb := func(n int) uint64 {
+		if n <= 0 {
+			return 0
+		}
+		return uint64(n) << 10
+	}
+	return Config{
+		InitialStream: kb(initialStream),
+		MaxStream:     kb(maxStream),
+		InitialConn:   kb(initialConn),
+		MaxConn:       kb(maxConn),
+	}.WithDefaults()
+}
+
+// WithDefaults 为 0 的项取默认值；未设置的初始值不超过显式设置的最大值（只调小最大窗口时无需同时设置初始窗口）
+func (w Config) WithDefaults() Config {
+	out := w
+	if out.MaxStream == 0 {
+		out.MaxStream = Default.MaxStream
+	}
+	if out.MaxConn == 0 {
+		out.MaxConn = Default.MaxConn
+	}
+	if out.InitialStream == 0 {
+		out.InitialStream = min(Default.InitialStream, out.MaxStream)
+	}
+	if out.InitialConn == 0 {
+		out.InitialConn = min(Default.InitialConn, out.MaxConn)
+	}
+	return out
+}
+
+// Validate 检查窗口配置：每项不小于 MinSize，初始值不超过最大值，单流最大窗口不超过连接最大窗口
+func (w Config) Validate() error {
+	for _, v := range []struct {
+		name string
+		size uint64
+	}{
+		{"单流初始窗口", w.InitialStream},
+		{"单流最大窗口", w.MaxStream},
+		{"连接初始窗口", w.InitialConn},
+		{"连接最大窗口", w.MaxConn},
+	} {
+		if v.size < MinSize {
+			return fmt.Errorf("%s过小: %dKB（最小 %dKB）", v.name, v.size>>10, MinSize>>10)
+		}
+	}
+	if w.InitialStream > w.MaxStream {
+		return fmt.Errorf("单流初始窗口 (%dKB) 大于最大窗口 (%dKB)", w.InitialStream>>10, w.MaxStream>>10)
+	}
+	if w.InitialConn > w.MaxConn {
+		return fmt.Errorf("连接初始窗口 (%dKB) 大于最大窗口 (%dKB)", w.InitialConn>>10, w.MaxConn>>10)
+	}
+	if w.MaxStream > w.MaxConn {
+		return fmt.Errorf("单流最大窗口 (%dKB) 大于连接最大窗口 (%dKB)", w.MaxStream>>10, w.MaxConn>>10)
+	}
+	return nil
+}
+
+// Apply 把窗口写入 QUIC 配置
+func (w Config) Apply(cfg *quic.Config) {
+	cfg.InitialStreamReceiveWindow = w.InitialStream
+	cfg.MaxStreamReceiveWindow = w.MaxStream
+	cfg.InitialConnectionReceiveWindow = w.InitialConn
+	cfg.MaxConnectionReceiveWindow = w.MaxConn
+}
+
+// String 日志输出格式：流 初始/最大，连接 初始/最大（KB）
+func (w Config) String() string {
+	return fmt.Sprintf("流 %d/%dKB, 连接 %d/%dKB", w.InitialStream>>10, w.MaxStream>>10, w.InitialConn>>10, w.MaxConn>>10)
+}
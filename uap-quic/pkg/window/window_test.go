@@ -0,0 +1,52 @@
+package window
+
+import (
+	"testing"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestFromKB(t *testing.T) {
+	if got := FromKB(0, 0, 0, 0); got != Default {
+		t.Fatalf("全部未设置时 %s，期望默认值 %s", got, Default)
+	}
+	want := Config{InitialStream: 256 << 10, MaxStream: 512 << 10, InitialConn: 512 << 10, MaxConn: 1 << 20}
+	if got := FromKB(256, 512, 512, 1024); got != want {
+		t.Fatalf("FromKB 返回 %s，期望 %s", got, want)
+	}
+	// 只调小最大窗口：未设置的初始值跟随最大值
+	got := FromKB(0, 1024, -1, 2048)
+	if got.InitialStream != 1<<20 || got.InitialConn != 2<<20 || got.Validate() != nil {
+		t.Fatalf("只设置最大窗口时 %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Fatalf("默认窗口不合法: %v", err)
+	}
+	cases := map[string]Config{
+		"过小":         {InitialStream: 32 << 10, MaxStream: 1 << 20, InitialConn: 1 << 20, MaxConn: 2 << 20},
+		"单流初始大于最大":   {InitialStream: 2 << 20, MaxStream: 1 << 20, InitialConn: 1 << 20, MaxConn: 2 << 20},
+		"连接初始大于最大":   {InitialStream: 1 << 20, MaxStream: 1 << 20, InitialConn: 4 << 20, MaxConn: 2 << 20},
+		"单流最大大于连接最大": {InitialStream: 1 << 20, MaxStream: 4 << 20, InitialConn: 1 << 20, MaxConn: 2 << 20},
+	}
+	for name, w := range cases {
+		if err := w.Validate(); err == nil {
+			t.Errorf("%s: %s 应返回错误", name, w)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	w := FromKB(256, 512, 512, 1024)
+	var cfg quic.Config
+	w.Apply(&cfg)
+	if cfg.InitialStreamReceiveWindow != w.InitialStream || cfg.MaxStreamReceiveWindow != w.MaxStream ||
+		cfg.InitialConnectionReceiveWindow != w.InitialConn || cfg.MaxConnectionReceiveWindow != w.MaxConn {
+		t.Fatalf("写入 QUIC 配置 %+v", cfg)
+	}
+	if s := w.String(); s != "流 256/512KB, 连接 512/1024KB" {
+		t.Fatalf("String() = %q", s)
+	}
+}